@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"os"
 	"strings"
@@ -72,11 +73,15 @@ func (m model) View() string {
 	return m.screen
 }
 
+// httpClient is replaced with a client for the server's Unix domain socket
+// when attaching over it.
+var httpClient = http.DefaultClient
+
 func ReadScreenOverHTTP(ctx context.Context, url string, ch chan<- httpapi.ScreenUpdateBody) error {
 	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	req.Header.Set("Content-Type", "application/json")
 
-	res, err := http.DefaultClient.Do(req)
+	res, err := httpClient.Do(req)
 	if err != nil {
 		return xerrors.Errorf("failed to do request: %w", err)
 	}
@@ -90,6 +95,10 @@ func ReadScreenOverHTTP(ctx context.Context, url string, ch chan<- httpapi.Scree
 		if err != nil {
 			return xerrors.Errorf("failed to read sse: %w", err)
 		}
+		if ev.Type != "screen" {
+			// e.g. server_shutdown, after which the stream ends
+			continue
+		}
 		var screen httpapi.ScreenUpdateBody
 		if err := json.Unmarshal([]byte(ev.Data), &screen); err != nil {
 			return xerrors.Errorf("failed to unmarshal screen: %w", err)
@@ -111,7 +120,7 @@ func WriteRawInputOverHTTP(ctx context.Context, url string, msg string) error {
 	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(messageRequestBytes))
 	req.Header.Set("Content-Type", "application/json")
 
-	res, err := http.DefaultClient.Do(req)
+	res, err := httpClient.Do(req)
 	if err != nil {
 		return xerrors.Errorf("failed to do request: %w", err)
 	}
@@ -123,6 +132,27 @@ func WriteRawInputOverHTTP(ctx context.Context, url string, msg string) error {
 	return nil
 }
 
+// tokenTransport authenticates requests with a Bearer token.
+type tokenTransport struct {
+	token string
+	base  http.RoundTripper
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+t.token)
+	return t.base.RoundTrip(req)
+}
+
+// Attach attaches the terminal to the agent of the server at remoteUrl,
+// authenticating with token if it's set.
+func Attach(remoteUrl string, token string) error {
+	if token != "" {
+		httpClient = &http.Client{Transport: &tokenTransport{token: token, base: http.DefaultTransport}}
+	}
+	return runAttach(remoteUrl)
+}
+
 func runAttach(remoteUrl string) error {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -144,7 +174,7 @@ func runAttach(remoteUrl string) error {
 	readScreenErrCh := make(chan error, 1)
 	go func() {
 		defer close(readScreenErrCh)
-		if err := ReadScreenOverHTTP(ctx, remoteUrl+"/internal/screen", screenCh); err != nil {
+		if err := ReadScreenOverHTTP(ctx, remoteUrl+"/v1/internal/screen", screenCh); err != nil {
 			if errors.Is(err, context.Canceled) {
 				return
 			}
@@ -167,7 +197,7 @@ func runAttach(remoteUrl string) error {
 				if input == "\x03" {
 					continue
 				}
-				if err := WriteRawInputOverHTTP(ctx, remoteUrl+"/message", input); err != nil {
+				if err := WriteRawInputOverHTTP(ctx, remoteUrl+"/v1/message", input); err != nil {
 					writeRawInputErrCh <- xerrors.Errorf("failed to write raw input: %w", err)
 					return
 				}
@@ -213,14 +243,48 @@ func runAttach(remoteUrl string) error {
 	return err
 }
 
-var remoteUrlArg string
+var (
+	remoteUrlArg  string
+	unixSocketArg string
+	replArg       bool
+	stdinArg      bool
+	timeoutArg    time.Duration
+)
+
+// detectUnixSocket returns the path of the server's Unix domain socket if
+// one accepts connections.
+func detectUnixSocket(path string) (string, bool) {
+	if path == "" {
+		var err error
+		if path, err = httpapi.DefaultUnixSocketPath(); err != nil {
+			return "", false
+		}
+	}
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err != nil {
+		return "", false
+	}
+	_ = conn.Close()
+	return path, true
+}
 
 var AttachCmd = &cobra.Command{
 	Use:   "attach",
 	Short: "Attach to a running agent",
-	Long:  `Attach to a running agent`,
+	Long: `Attach to a running agent. If no URL is given and the server listens on a Unix domain socket, it's preferred over TCP.
+
+If stdin isn't a terminal, e.g. in CI, it's read to EOF and sent as a single message, and the agent's response is printed:
+
+  echo "fix the failing tests" | clauder attach --timeout 120s`,
 	Run: func(cmd *cobra.Command, args []string) {
 		remoteUrl := remoteUrlArg
+		if !cmd.Flags().Changed("url") {
+			if socketPath, ok := detectUnixSocket(unixSocketArg); ok {
+				httpClient = httpapi.UnixSocketClient(socketPath)
+				// the host is ignored by the socket client
+				remoteUrl = "http://unix"
+			}
+		}
 		if remoteUrl == "" {
 			fmt.Fprintln(os.Stderr, "URL is required")
 			os.Exit(1)
@@ -229,7 +293,16 @@ var AttachCmd = &cobra.Command{
 			remoteUrl = "http://" + remoteUrl
 		}
 		remoteUrl = strings.TrimRight(remoteUrl, "/")
-		if err := runAttach(remoteUrl); err != nil {
+		run := runAttach
+		switch {
+		case replArg:
+			run = runAttachREPL
+		case stdinArg || !term.IsTerminal(int(os.Stdin.Fd())):
+			run = func(remoteUrl string) error {
+				return runAttachStdin(cmd.Context(), remoteUrl, os.Stdin, os.Stdout, timeoutArg)
+			}
+		}
+		if err := run(remoteUrl); err != nil {
 			fmt.Fprintf(os.Stderr, "Attach failed: %+v\n", err)
 			os.Exit(1)
 		}
@@ -238,4 +311,8 @@ var AttachCmd = &cobra.Command{
 
 func init() {
 	AttachCmd.Flags().StringVarP(&remoteUrlArg, "url", "u", "localhost:3284", "URL of the clauder server to attach to. May optionally include a protocol and a path.")
+	AttachCmd.Flags().StringVar(&unixSocketArg, "unix-socket", "", "Path of the server's Unix domain socket. Defaults to ~/.clauder/clauder.sock. Ignored if --url is set")
+	AttachCmd.Flags().BoolVar(&replArg, "repl", false, "Send messages from a 'You: ' prompt and print the agent's responses instead of attaching to its terminal. History is kept in ~/.clauder/attach_history")
+	AttachCmd.Flags().BoolVar(&stdinArg, "stdin", false, "Send stdin as a single message and print the agent's response. The default if stdin isn't a terminal")
+	AttachCmd.Flags().DurationVar(&timeoutArg, "timeout", DefaultStdinTimeout, "How long --stdin waits for the agent's response before exiting with status 1")
 }
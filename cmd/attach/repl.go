@@ -0,0 +1,293 @@
+package attach
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/zohaibahmed/clauder/lib/httpapi"
+	st "github.com/zohaibahmed/clauder/lib/screentracker"
+	"golang.org/x/term"
+	"golang.org/x/xerrors"
+)
+
+// replPrompt is shown before each line typed in the REPL.
+const replPrompt = "You: "
+
+// maxReplHistory is how many of the last lines of the history file are
+// loaded, which is as many as x/term keeps.
+const maxReplHistory = 100
+
+// statusPollInterval is how often the agent's status is checked while it
+// responds. Tests shorten it.
+var statusPollInterval = time.Second
+
+// replHistoryPath returns the path of the REPL's history file,
+// ~/.clauder/attach_history.
+func replHistoryPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", xerrors.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".clauder", "attach_history"), nil
+}
+
+// loadReplHistory returns the last lines of the history file at path, oldest
+// first. A missing file is an empty history.
+func loadReplHistory(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("failed to read history: %w", err)
+	}
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(lines) == 1 && lines[0] == "" {
+		return nil, nil
+	}
+	if len(lines) > maxReplHistory {
+		lines = lines[len(lines)-maxReplHistory:]
+	}
+	return lines, nil
+}
+
+// appendReplHistory appends line to the history file at path.
+func appendReplHistory(path, line string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return xerrors.Errorf("failed to create history directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return xerrors.Errorf("failed to open history: %w", err)
+	}
+	defer f.Close()
+	if _, err := fmt.Fprintln(f, line); err != nil {
+		return xerrors.Errorf("failed to write history: %w", err)
+	}
+	return nil
+}
+
+// lineReader reads the lines typed in the REPL. It returns io.EOF once the
+// user is done.
+type lineReader interface {
+	ReadLine() (string, error)
+}
+
+// scannerLineReader reads lines from input that isn't a terminal, e.g. over
+// SSH without a TTY.
+type scannerLineReader struct {
+	scanner *bufio.Scanner
+	out     io.Writer
+}
+
+func (r *scannerLineReader) ReadLine() (string, error) {
+	fmt.Fprint(r.out, replPrompt)
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return "", err
+		}
+		fmt.Fprintln(r.out)
+		return "", io.EOF
+	}
+	return r.scanner.Text(), nil
+}
+
+// switchableReadWriter lets the terminal's input and output be replaced
+// after it's created.
+type switchableReadWriter struct {
+	io.Reader
+	io.Writer
+}
+
+// terminalLineReader reads lines with x/term's line editing and history.
+// The terminal is only in raw mode while a line is read, so that Ctrl+C
+// interrupts the REPL while it waits for the agent.
+type terminalLineReader struct {
+	fd       int
+	terminal *term.Terminal
+}
+
+func newTerminalLineReader(fd int, in io.Reader, out io.Writer, history []string) *terminalLineReader {
+	// x/term can't be given a history, so the saved lines are typed into
+	// the terminal before the user's.
+	rw := &switchableReadWriter{Reader: strings.NewReader(strings.Join(history, "\r") + "\r"), Writer: io.Discard}
+	terminal := term.NewTerminal(rw, "")
+	for range history {
+		_, _ = terminal.ReadLine()
+	}
+	rw.Reader, rw.Writer = in, out
+	terminal.SetPrompt(replPrompt)
+	return &terminalLineReader{fd: fd, terminal: terminal}
+}
+
+func (r *terminalLineReader) ReadLine() (string, error) {
+	oldState, err := term.MakeRaw(r.fd)
+	if err != nil {
+		return "", xerrors.Errorf("failed to make raw: %w", err)
+	}
+	defer term.Restore(r.fd, oldState)
+	if width, height, err := term.GetSize(r.fd); err == nil {
+		_ = r.terminal.SetSize(width, height)
+	}
+	return r.terminal.ReadLine()
+}
+
+// doJSON sends a request to the server and decodes the JSON response into
+// out if it's not nil.
+func doJSON(ctx context.Context, method, url string, body any, out any) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
+	if err != nil {
+		return xerrors.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return xerrors.Errorf("failed to do request: %w", err)
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return xerrors.Errorf("failed to read response: %w", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		// huma errors explain what went wrong in their detail
+		var apiErr struct {
+			Detail string `json:"detail"`
+		}
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Detail != "" {
+			return xerrors.Errorf("%s %s failed: %s: %s", method, url, res.Status, apiErr.Detail)
+		}
+		return xerrors.Errorf("%s %s failed: %s", method, url, res.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return xerrors.Errorf("invalid response to %s %s: %w", method, url, err)
+	}
+	return nil
+}
+
+// getMessages returns the conversation of the agent at remoteUrl.
+func getMessages(ctx context.Context, remoteUrl string) ([]httpapi.Message, error) {
+	var messages httpapi.MessagesResponse
+	if err := doJSON(ctx, http.MethodGet, remoteUrl+"/v1/messages", nil, &messages.Body); err != nil {
+		return nil, err
+	}
+	return messages.Body.Messages, nil
+}
+
+// sendAndWait sends content to the agent at remoteUrl as a user message,
+// waits until the agent is done responding, and returns its response.
+func sendAndWait(ctx context.Context, remoteUrl, content string) (string, error) {
+	messages, err := getMessages(ctx, remoteUrl)
+	if err != nil {
+		return "", err
+	}
+	lastID := -1
+	if len(messages) > 0 {
+		lastID = messages[len(messages)-1].Id
+	}
+
+	message := httpapi.MessageRequestBody{Type: httpapi.MessageTypeUser, Content: content}
+	if err := doJSON(ctx, http.MethodPost, remoteUrl+"/v1/message", message, nil); err != nil {
+		return "", err
+	}
+	for {
+		var status httpapi.StatusResponse
+		if err := doJSON(ctx, http.MethodGet, remoteUrl+"/v1/status", nil, &status.Body); err != nil {
+			return "", err
+		}
+		if status.Body.Status == httpapi.AgentStatusStable {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(statusPollInterval):
+		}
+	}
+
+	if messages, err = getMessages(ctx, remoteUrl); err != nil {
+		return "", err
+	}
+	var response []string
+	for _, message := range messages {
+		if message.Id > lastID && message.Role == st.ConversationRoleAgent {
+			response = append(response, message.Content)
+		}
+	}
+	return strings.Join(response, "\n"), nil
+}
+
+// runREPL reads lines from lines and sends each of them to the agent at
+// remoteUrl, printing its responses to out, until lines returns io.EOF.
+// The lines are appended to the history file at historyPath if it's set.
+func runREPL(ctx context.Context, remoteUrl string, lines lineReader, out io.Writer, historyPath string) error {
+	for {
+		line, err := lines.ReadLine()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return xerrors.Errorf("failed to read line: %w", err)
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if historyPath != "" {
+			if err := appendReplHistory(historyPath, line); err != nil {
+				fmt.Fprintf(out, "Warning: %v\n", err)
+			}
+		}
+		response, err := sendAndWait(ctx, remoteUrl, line)
+		if err != nil {
+			fmt.Fprintf(out, "Error: %v\n", err)
+			continue
+		}
+		fmt.Fprintf(out, "%s\n\n", response)
+	}
+}
+
+// runAttachREPL attaches to the agent at remoteUrl with a line-based REPL
+// instead of the agent's terminal. Line editing and history are only
+// available if stdin is a terminal.
+func runAttachREPL(remoteUrl string) error {
+	historyPath, err := replHistoryPath()
+	if err != nil {
+		return err
+	}
+	var lines lineReader
+	stdin := int(os.Stdin.Fd())
+	if term.IsTerminal(stdin) {
+		history, err := loadReplHistory(historyPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+		lines = newTerminalLineReader(stdin, os.Stdin, os.Stdout, history)
+	} else {
+		lines = &scannerLineReader{scanner: bufio.NewScanner(os.Stdin), out: os.Stdout}
+	}
+	return runREPL(context.Background(), remoteUrl, lines, os.Stdout, historyPath)
+}
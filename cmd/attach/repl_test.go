@@ -0,0 +1,112 @@
+package attach
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/httpapi"
+	st "github.com/zohaibahmed/clauder/lib/screentracker"
+)
+
+// mockAgentServer answers each user message with "You said: <message>"
+// after reporting the agent as running for a few status checks, or for
+// good if the message contains "take forever".
+func mockAgentServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	var mu sync.Mutex
+	messages := []httpapi.Message{{Id: 0, Role: st.ConversationRoleAgent, Content: "Welcome"}}
+	runningChecks := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method + " " + r.URL.Path {
+		case "POST /v1/message":
+			var body httpapi.MessageRequestBody
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			if len(strings.Fields(body.Content)) < 3 {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				_, _ = w.Write([]byte(`{"status":422,"detail":"message is too short"}`))
+				return
+			}
+			messages = append(messages,
+				httpapi.Message{Id: len(messages), Role: st.ConversationRoleUser, Content: body.Content},
+				httpapi.Message{Id: len(messages) + 1, Role: st.ConversationRoleAgent, Content: "You said: " + body.Content})
+			runningChecks = 3
+			if strings.Contains(body.Content, "take forever") {
+				runningChecks = math.MaxInt
+			}
+			_, _ = w.Write([]byte(`{"ok":true}`))
+		case "GET /v1/status":
+			status := httpapi.AgentStatusStable
+			if runningChecks > 0 {
+				runningChecks--
+				status = httpapi.AgentStatusRunning
+			}
+			_, _ = fmt.Fprintf(w, `{"status":%q}`, status)
+		case "GET /v1/messages":
+			_ = json.NewEncoder(w).Encode(map[string]any{"messages": messages})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRunREPL(t *testing.T) {
+	statusPollInterval = time.Millisecond
+	srv := mockAgentServer(t)
+	historyPath := filepath.Join(t.TempDir(), ".clauder", "attach_history")
+
+	var out bytes.Buffer
+	lines := &scannerLineReader{scanner: bufio.NewScanner(strings.NewReader("hello there agent\n\n  hi  \nhow are you\n")), out: &out}
+	require.NoError(t, runREPL(context.Background(), srv.URL, lines, &out, historyPath))
+	assert.Equal(t, "You: You said: hello there agent\n\n"+
+		"You: You: Error: POST "+srv.URL+"/v1/message failed: 422 Unprocessable Entity: message is too short\n"+
+		"You: You said: how are you\n\n"+
+		"You: \n", out.String())
+
+	history, err := loadReplHistory(historyPath)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"hello there agent", "hi", "how are you"}, history)
+}
+
+func TestReplHistory(t *testing.T) {
+	historyPath := filepath.Join(t.TempDir(), "attach_history")
+	history, err := loadReplHistory(historyPath)
+	require.NoError(t, err)
+	assert.Empty(t, history)
+
+	for i := range maxReplHistory + 5 {
+		require.NoError(t, appendReplHistory(historyPath, fmt.Sprintf("line %d", i)))
+	}
+	history, err = loadReplHistory(historyPath)
+	require.NoError(t, err)
+	require.Len(t, history, maxReplHistory)
+	assert.Equal(t, "line 5", history[0])
+	assert.Equal(t, fmt.Sprintf("line %d", maxReplHistory+4), history[maxReplHistory-1])
+	info, err := os.Stat(historyPath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	// the loaded history is available with the up arrow
+	r := newTerminalLineReader(-1, strings.NewReader("\x1b[A\x1b[A\r"), &bytes.Buffer{}, []string{"first line", "second line"})
+	line, err := r.terminal.ReadLine()
+	require.NoError(t, err)
+	assert.Equal(t, "first line", line)
+}
@@ -0,0 +1,43 @@
+package attach
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// DefaultStdinTimeout is how long --stdin waits for the agent's response
+// by default.
+const DefaultStdinTimeout = 5 * time.Minute
+
+// runAttachStdin reads in to EOF, sends it to the agent at remoteUrl as a
+// single message, and prints the agent's response to out. It fails if the
+// agent doesn't respond within timeout, or if the server stops answering,
+// e.g. because the agent exited.
+func runAttachStdin(ctx context.Context, remoteUrl string, in io.Reader, out io.Writer, timeout time.Duration) error {
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return xerrors.Errorf("failed to read stdin: %w", err)
+	}
+	content := strings.TrimSpace(string(data))
+	if content == "" {
+		return xerrors.New("stdin is empty")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	response, err := sendAndWait(ctx, remoteUrl, content)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return xerrors.Errorf("the agent didn't respond within %s", timeout)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out, response)
+	return nil
+}
@@ -0,0 +1,58 @@
+package attach
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunAttachStdin(t *testing.T) {
+	statusPollInterval = time.Millisecond
+	srv := mockAgentServer(t)
+	ctx := context.Background()
+
+	var out bytes.Buffer
+	require.NoError(t, runAttachStdin(ctx, srv.URL, strings.NewReader("fix the failing tests\n"), &out, time.Minute))
+	assert.Equal(t, "You said: fix the failing tests\n", out.String())
+
+	out.Reset()
+	err := runAttachStdin(ctx, srv.URL, strings.NewReader("this will take forever"), &out, 50*time.Millisecond)
+	assert.ErrorContains(t, err, "the agent didn't respond within 50ms")
+	assert.Empty(t, out.String())
+
+	assert.ErrorContains(t, runAttachStdin(ctx, srv.URL, strings.NewReader(" \n"), &out, time.Minute), "stdin is empty")
+
+	srv.Close()
+	assert.Error(t, runAttachStdin(ctx, srv.URL, strings.NewReader("is anyone there"), &out, time.Minute))
+}
+
+func TestAttachCmdStdin(t *testing.T) {
+	statusPollInterval = time.Millisecond
+	srv := mockAgentServer(t)
+
+	// a pipe isn't a terminal, so stdin mode is used without --stdin
+	stdinReader, stdinWriter, err := os.Pipe()
+	require.NoError(t, err)
+	stdoutReader, stdoutWriter, err := os.Pipe()
+	require.NoError(t, err)
+	oldStdin, oldStdout := os.Stdin, os.Stdout
+	os.Stdin, os.Stdout = stdinReader, stdoutWriter
+	defer func() { os.Stdin, os.Stdout = oldStdin, oldStdout }()
+	_, err = stdinWriter.WriteString("fix the failing tests")
+	require.NoError(t, err)
+	require.NoError(t, stdinWriter.Close())
+
+	AttachCmd.SetArgs([]string{"--url", srv.URL})
+	require.NoError(t, AttachCmd.Execute())
+	require.NoError(t, stdoutWriter.Close())
+	out, err := io.ReadAll(stdoutReader)
+	require.NoError(t, err)
+	assert.Equal(t, "You said: fix the failing tests\n", string(out))
+}
@@ -0,0 +1,271 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/spf13/cobra"
+	cfg "github.com/zohaibahmed/clauder/lib/config"
+	mf "github.com/zohaibahmed/clauder/lib/msgfmt"
+	"github.com/zohaibahmed/clauder/lib/tunnel"
+	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v3"
+)
+
+var fileArg string
+
+// environment is what the validation inspects besides the config. It's
+// replaced in tests.
+type environment struct {
+	lookPath func(file string) (string, error)
+	stat     func(name string) (os.FileInfo, error)
+	getenv   func(key string) string
+}
+
+func defaultEnvironment() environment {
+	return environment{lookPath: exec.LookPath, stat: os.Stat, getenv: os.Getenv}
+}
+
+// checkResult is the outcome of a single validation rule.
+type checkResult struct {
+	rule    string
+	ok      bool
+	message string
+}
+
+func pass(rule, format string, args ...any) checkResult {
+	return checkResult{rule: rule, ok: true, message: fmt.Sprintf(format, args...)}
+}
+
+func fail(rule, format string, args ...any) checkResult {
+	return checkResult{rule: rule, message: fmt.Sprintf(format, args...)}
+}
+
+func validateAgent(c cfg.Config) checkResult {
+	if _, ok := mf.DefaultRegistry.Lookup(c.Agent); !ok {
+		return fail("agent", "unknown agent type %q (registered agent types: %s)", c.Agent, strings.Join(mf.DefaultRegistry.AgentTypes(), ", "))
+	}
+	return pass("agent", "%s", c.Agent)
+}
+
+func validateAgentBinary(c cfg.Config, env environment) checkResult {
+	if c.AgentPath != "" {
+		info, err := env.stat(c.AgentPath)
+		if err != nil {
+			return fail("agent_path", "%s doesn't exist", c.AgentPath)
+		}
+		if info.IsDir() {
+			return fail("agent_path", "%s is a directory", c.AgentPath)
+		}
+		return pass("agent_path", "%s", c.AgentPath)
+	}
+	if c.Agent == string(mf.AgentTypeCustom) {
+		return fail("agent_path", "required for the custom agent type")
+	}
+	path, err := env.lookPath(c.Agent)
+	if err != nil {
+		return fail("agent_path", "%s not found in PATH", c.Agent)
+	}
+	return pass("agent_path", "%s", path)
+}
+
+func validatePort(c cfg.Config) checkResult {
+	if c.Port < 1 || c.Port > 65535 {
+		return fail("port", "%d is not between 1 and 65535", c.Port)
+	}
+	return pass("port", "%d", c.Port)
+}
+
+func validateLimits(c cfg.Config) checkResult {
+	switch {
+	case c.ContextWindow < 0:
+		return fail("context_window", "%d is negative", c.ContextWindow)
+	case c.MessageQueueDepth < 0:
+		return fail("message_queue_depth", "%d is negative", c.MessageQueueDepth)
+	case c.ResponseCacheTTL < 0:
+		return fail("response_cache_ttl", "%s is negative", c.ResponseCacheTTL)
+	case c.PTYRateLimit < 0:
+		return fail("pty_rate_limit", "%g is negative", c.PTYRateLimit)
+	case c.PTYBurst < 0:
+		return fail("pty_burst", "%d is negative", c.PTYBurst)
+	}
+	return pass("limits", "context_window %d, message_queue_depth %d, response_cache_ttl %s", c.ContextWindow, c.MessageQueueDepth, c.ResponseCacheTTL)
+}
+
+func validateLogLevel(c cfg.Config) checkResult {
+	if c.LogLevel == "" {
+		return pass("log_level", "not set, the server logs at the info level")
+	}
+	if _, err := cfg.ParseLogLevel(c.LogLevel); err != nil {
+		return fail("log_level", "%s", err)
+	}
+	return pass("log_level", "%s", c.LogLevel)
+}
+
+func validateCORSOrigins(c cfg.Config) checkResult {
+	if len(c.CORSOrigins) == 0 {
+		return pass("cors_origins", "not set, any origin is allowed")
+	}
+	if err := cfg.ValidateCORSOrigins(c.CORSOrigins); err != nil {
+		return fail("cors_origins", "%s", err)
+	}
+	return pass("cors_origins", "%s", strings.Join(c.CORSOrigins, ", "))
+}
+
+func validateTunnelProvider(c cfg.Config, env environment) checkResult {
+	if c.TunnelProvider == "" {
+		return pass("tunnel_provider", "not set, the first available provider is used")
+	}
+	for _, provider := range tunnel.Providers {
+		if string(provider) != c.TunnelProvider {
+			continue
+		}
+		if _, err := env.lookPath(provider.Binary()); err != nil {
+			return fail("tunnel_provider", "%s needs %s, which isn't in PATH", provider, provider.Binary())
+		}
+		return pass("tunnel_provider", "%s", provider)
+	}
+	providers := make([]string, len(tunnel.Providers))
+	for i, provider := range tunnel.Providers {
+		providers[i] = string(provider)
+	}
+	return fail("tunnel_provider", "unknown provider %q (one of: %s)", c.TunnelProvider, strings.Join(providers, ", "))
+}
+
+func validateCoordinatorURL(c cfg.Config) checkResult {
+	u, err := url.Parse(c.CoordinatorURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fail("coordinator_url", "%q is not an http or https URL", c.CoordinatorURL)
+	}
+	return pass("coordinator_url", "%s", c.CoordinatorURL)
+}
+
+// validateAPIKey checks that the agent's API key is set, in the config file
+// or in the environment.
+func validateAPIKey(c cfg.Config) checkResult {
+	var key, name string
+	switch c.Agent {
+	case string(mf.AgentTypeClaude):
+		key, name = c.AnthropicAPIKey, "ANTHROPIC_API_KEY"
+	case string(mf.AgentTypeCodex):
+		key, name = c.OpenAIAPIKey, "OPENAI_API_KEY"
+	default:
+		return pass("api_key", "not needed for the %s agent type", c.Agent)
+	}
+	if key == "" {
+		return fail("api_key", "%s or %s must be set for the %s agent type", name, strings.ToLower(name), c.Agent)
+	}
+	return pass("api_key", "set")
+}
+
+// validate checks the values of the config. Unknown keys are rejected when
+// it's parsed.
+func validate(c cfg.Config, env environment) []checkResult {
+	return []checkResult{
+		validateAgent(c),
+		validateAgentBinary(c, env),
+		validatePort(c),
+		validateLimits(c),
+		validateLogLevel(c),
+		validateCORSOrigins(c),
+		validateTunnelProvider(c, env),
+		validateCoordinatorURL(c),
+		validateAPIKey(c),
+	}
+}
+
+// validateFile loads the config at path, validates it and prints a report.
+// It returns whether the config is valid.
+func validateFile(w io.Writer, path string, env environment) bool {
+	c, found, err := cfg.Load(path, env.getenv)
+	results := []checkResult{}
+	switch {
+	case err != nil:
+		results = append(results, fail("config file", "%s", err))
+	case !found:
+		results = append(results, pass("config file", "%s not found, using defaults", path))
+	default:
+		results = append(results, pass("config file", "%s", path))
+	}
+	if err == nil {
+		results = append(results, validate(c, env)...)
+	}
+
+	valid := true
+	for _, result := range results {
+		icon := "✅"
+		if !result.ok {
+			icon = "❌"
+			valid = false
+		}
+		fmt.Fprintf(w, "%s %s: %s\n", icon, result.rule, result.message)
+	}
+	return valid
+}
+
+// showConfig prints the effective config as YAML, with secrets masked.
+func showConfig(w io.Writer, path string, getenv func(string) string) error {
+	c, _, err := cfg.Load(path, getenv)
+	if err != nil {
+		return err
+	}
+	out, err := yaml.Marshal(c.Masked())
+	if err != nil {
+		return xerrors.Errorf("failed to marshal config: %w", err)
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+func configPath() string {
+	if fileArg != "" {
+		return fileArg
+	}
+	path, err := cfg.DefaultPath()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%+v\n", err)
+		os.Exit(1)
+	}
+	return path
+}
+
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validate the config file",
+	Long:  `Load the config file, check its keys and values, that the binaries it refers to exist and that the agent's API key is set. Exits with status 1 if the config is invalid.`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if !validateFile(os.Stdout, configPath(), defaultEnvironment()) {
+			os.Exit(1)
+		}
+	},
+}
+
+var showCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show the effective configuration",
+	Long:  `Print the configuration that applies, merged from the defaults, the config file and the environment, as YAML. Secrets are masked.`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := showConfig(os.Stdout, configPath(), os.Getenv); err != nil {
+			fmt.Fprintf(os.Stderr, "%+v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+var ConfigCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the config file",
+	Long:  `Inspect the config file, ~/.clauder/config.yaml.`,
+}
+
+func init() {
+	ConfigCmd.PersistentFlags().StringVarP(&fileArg, "file", "f", "", "Path of the config file. Defaults to ~/.clauder/config.yaml")
+	ConfigCmd.AddCommand(validateCmd)
+	ConfigCmd.AddCommand(showCmd)
+}
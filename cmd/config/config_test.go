@@ -0,0 +1,217 @@
+package config
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	cfg "github.com/zohaibahmed/clauder/lib/config"
+)
+
+type fakeFileInfo struct {
+	fs.FileInfo
+	dir bool
+}
+
+func (f fakeFileInfo) IsDir() bool { return f.dir }
+
+// fakeEnvironment finds the given commands in PATH, has the files
+// /opt/agent/bin/agent and /opt/agent, and the given environment variables.
+func fakeEnvironment(commands []string, vars map[string]string) environment {
+	return environment{
+		lookPath: func(file string) (string, error) {
+			for _, command := range commands {
+				if file == command {
+					return "/usr/bin/" + file, nil
+				}
+			}
+			return "", &exec.Error{Name: file, Err: exec.ErrNotFound}
+		},
+		stat: func(name string) (os.FileInfo, error) {
+			switch name {
+			case "/opt/agent/bin/agent":
+				return fakeFileInfo{}, nil
+			case "/opt/agent":
+				return fakeFileInfo{dir: true}, nil
+			}
+			return nil, fs.ErrNotExist
+		},
+		getenv: func(key string) string { return vars[key] },
+	}
+}
+
+func TestValidateFile(t *testing.T) {
+	env := fakeEnvironment([]string{"claude", "ssh"}, map[string]string{"ANTHROPIC_API_KEY": "sk-ant-test"})
+
+	for _, tc := range []struct {
+		name    string
+		fixture string
+		env     environment
+		valid   bool
+		// want are lines the report must contain
+		want []string
+	}{
+		{
+			name:    "valid",
+			fixture: "valid.yaml",
+			env:     env,
+			valid:   true,
+			want: []string{
+				"✅ agent: claude",
+				"✅ agent_path: /usr/bin/claude",
+				"✅ port: 8080",
+				"✅ limits: context_window 100000, message_queue_depth 5, response_cache_ttl 5m0s",
+				"✅ tunnel_provider: localhost.run",
+				"✅ coordinator_url: https://coordinator.example.com",
+				"✅ log_level: warn",
+				"✅ cors_origins: https://app.example.com",
+				"✅ api_key: set",
+			},
+		},
+		{
+			name:    "missing file",
+			fixture: "missing.yaml",
+			env:     env,
+			valid:   true,
+			want:    []string{"not found, using defaults", "✅ port: 3284"},
+		},
+		{
+			name:    "unknown key",
+			fixture: "unknown-key.yaml",
+			env:     env,
+			want:    []string{"❌ config file:", "field prot not found"},
+		},
+		{
+			name:    "syntax error",
+			fixture: "syntax-error.yaml",
+			env:     env,
+			want:    []string{"❌ config file:", "did not find expected"},
+		},
+		{
+			name:    "invalid values",
+			fixture: "invalid-values.yaml",
+			env:     env,
+			want: []string{
+				`❌ agent: unknown agent type "cursor"`,
+				"❌ agent_path: cursor not found in PATH",
+				"❌ port: 70000 is not between 1 and 65535",
+				"❌ message_queue_depth: -1 is negative",
+				`❌ tunnel_provider: unknown provider "cloudflared"`,
+				`❌ coordinator_url: "coordinator.example.com" is not an http or https URL`,
+				`❌ log_level: invalid log level "verbose"`,
+				`❌ cors_origins: invalid CORS origin "app.example.com"`,
+			},
+		},
+		{
+			name:    "tunnel provider not installed",
+			fixture: "valid.yaml",
+			env:     fakeEnvironment([]string{"claude"}, map[string]string{"ANTHROPIC_API_KEY": "sk-ant-test"}),
+			want:    []string{"❌ tunnel_provider: localhost.run needs ssh, which isn't in PATH"},
+		},
+		{
+			name:    "missing API key",
+			fixture: "no-api-key.yaml",
+			env:     fakeEnvironment([]string{"claude", "ssh"}, nil),
+			want:    []string{"❌ api_key: ANTHROPIC_API_KEY or anthropic_api_key must be set for the claude agent type"},
+		},
+		{
+			name:    "custom agent",
+			fixture: "custom-agent.yaml",
+			env:     env,
+			valid:   true,
+			want:    []string{"✅ agent: custom", "✅ agent_path: /opt/agent/bin/agent", "✅ api_key: not needed for the custom agent type"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+			valid := validateFile(&out, filepath.Join("testdata", tc.fixture), tc.env)
+			assert.Equal(t, tc.valid, valid, out.String())
+			for _, want := range tc.want {
+				assert.Contains(t, out.String(), want)
+			}
+			if tc.valid {
+				assert.NotContains(t, out.String(), "❌")
+			}
+		})
+	}
+}
+
+func TestValidateAgentBinary(t *testing.T) {
+	env := fakeEnvironment(nil, nil)
+
+	result := validateAgentBinary(cfg.Config{Agent: "custom"}, env)
+	assert.Equal(t, checkResult{rule: "agent_path", message: "required for the custom agent type"}, result)
+
+	result = validateAgentBinary(cfg.Config{Agent: "custom", AgentPath: "/opt/agent"}, env)
+	assert.Equal(t, "/opt/agent is a directory", result.message)
+	assert.False(t, result.ok)
+
+	result = validateAgentBinary(cfg.Config{Agent: "claude", AgentPath: "/usr/local/bin/claude"}, env)
+	assert.Equal(t, "/usr/local/bin/claude doesn't exist", result.message)
+	assert.False(t, result.ok)
+}
+
+func TestValidateLimits(t *testing.T) {
+	c := cfg.Default()
+	assert.True(t, validateLimits(c).ok)
+
+	c.ContextWindow = -1
+	assert.Equal(t, "context_window", validateLimits(c).rule)
+	assert.False(t, validateLimits(c).ok)
+
+	c = cfg.Default()
+	c.ResponseCacheTTL = -time.Second
+	assert.Equal(t, "response_cache_ttl", validateLimits(c).rule)
+	assert.False(t, validateLimits(c).ok)
+
+	c = cfg.Default()
+	c.PTYBurst = -1
+	assert.Equal(t, "pty_burst", validateLimits(c).rule)
+	assert.False(t, validateLimits(c).ok)
+}
+
+func TestShowConfig(t *testing.T) {
+	getenv := func(key string) string {
+		if key == "PORT" {
+			return "9090"
+		}
+		return ""
+	}
+	var out bytes.Buffer
+	require.NoError(t, showConfig(&out, filepath.Join("testdata", "valid.yaml"), getenv))
+	shown := out.String()
+	assert.Contains(t, shown, "agent: claude\n")
+	assert.Contains(t, shown, "port: 9090\n", "the environment overrides the file")
+	assert.Contains(t, shown, "response_cache_ttl: 5m0s\n")
+	assert.Contains(t, shown, "admin_token: '********'\n")
+	assert.Contains(t, shown, "coordinator_secret: '********'\n")
+
+	// No token value may leak, whether it comes from the file or the
+	// environment.
+	secrets := map[string]string{
+		"COORDINATOR_SECRET":  "env-coordinator-secret",
+		"CLAUDER_ADMIN_TOKEN": "env-admin-token",
+		"ANTHROPIC_API_KEY":   "env-anthropic-key",
+	}
+	for _, getenv := range []func(string) string{
+		func(string) string { return "" },
+		func(key string) string { return secrets[key] },
+	} {
+		out.Reset()
+		require.NoError(t, showConfig(&out, filepath.Join("testdata", "valid.yaml"), getenv))
+		for _, secret := range []string{"coordinator-secret-value", "admin-token-value", "sk-ant-file-key", "env-coordinator-secret", "env-admin-token", "env-anthropic-key"} {
+			assert.NotContains(t, out.String(), secret)
+		}
+		assert.Equal(t, 3, strings.Count(out.String(), "********"))
+	}
+
+	err := showConfig(&out, filepath.Join("testdata", "unknown-key.yaml"), getenv)
+	assert.ErrorContains(t, err, "field prot not found")
+}
@@ -0,0 +1,123 @@
+package connect
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zohaibahmed/clauder/cmd/attach"
+	"github.com/zohaibahmed/clauder/cmd/quickstart"
+	"github.com/zohaibahmed/clauder/lib/coordinator"
+	"golang.org/x/xerrors"
+)
+
+// handoffCodeRegex matches the codes created with POST /session/handoff.
+var handoffCodeRegex = regexp.MustCompile(`^[ABCDEFGHJKLMNPQRSTUVWXYZ23456789]{8}$`)
+
+var (
+	hashPasscodeArg      bool
+	coordinatorSecretArg string
+)
+
+// handoff is a session handed off from another device.
+type handoff struct {
+	url   string
+	token string
+}
+
+// resolveHandoff looks up the handoff code on the coordinator, and claims
+// the handoff with a request authenticated with its token, which tells the
+// other device that the code was used.
+func resolveHandoff(ctx context.Context, client *http.Client, code string) (handoff, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if !handoffCodeRegex.MatchString(code) {
+		return handoff{}, xerrors.Errorf("invalid handoff code %q, expected 8 letters and digits", code)
+	}
+	session, err := coordinator.Lookup(code)
+	if err != nil {
+		return handoff{}, xerrors.Errorf("failed to look up handoff code: %w", err)
+	}
+	h := handoff{url: strings.TrimRight(session.TunnelURL, "/"), token: session.Token}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.url+"/v1/status", nil)
+	if err != nil {
+		return handoff{}, xerrors.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+h.token)
+	resp, err := client.Do(req)
+	if err != nil {
+		return handoff{}, xerrors.Errorf("failed to reach the server at %s: %w", h.url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return handoff{}, xerrors.Errorf("the server at %s rejected the handoff: %s", h.url, resp.Status)
+	}
+	return h, nil
+}
+
+// resolveLink parses a deep link created with `clauder link`, and looks up
+// the session token with the link's passcode, which the link's signature
+// is checked with.
+func resolveLink(link string, now time.Time, opts ...coordinator.Option) (handoff, error) {
+	l, err := quickstart.ParseLink(link, now)
+	if err != nil {
+		return handoff{}, err
+	}
+	session, err := coordinator.Lookup(l.Passcode, opts...)
+	if err != nil {
+		return handoff{}, xerrors.Errorf("failed to look up the link's passcode: %w", err)
+	}
+	if err := l.Verify(session.Token); err != nil {
+		return handoff{}, err
+	}
+	url := strings.TrimRight(l.TunnelURL, "/")
+	if strings.TrimRight(session.TunnelURL, "/") != url {
+		return handoff{}, xerrors.Errorf("the session's tunnel changed since the link was created, create a new one with `clauder link`")
+	}
+	return handoff{url: url, token: session.Token}, nil
+}
+
+var ConnectCmd = &cobra.Command{
+	Use:   "connect <handoff-code|link>",
+	Short: "Continue a session from another device",
+	Long: `Continue a session from another device. Create a handoff code on the other
+device, which is valid for 30 seconds, or a link with 'clauder link', which
+is valid for 15 minutes, and pass it here to attach to its agent.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var h handoff
+		var err error
+		if strings.HasPrefix(args[0], quickstart.LinkScheme+":") {
+			var opts []coordinator.Option
+			if hashPasscodeArg || coordinatorSecretArg != "" {
+				key, keyErr := coordinator.ResolvePasscodeKey(coordinatorSecretArg)
+				if keyErr != nil {
+					fmt.Fprintf(os.Stderr, "Connect failed: %v\n", keyErr)
+					os.Exit(1)
+				}
+				opts = append(opts, coordinator.WithPasscodeKey(key))
+			}
+			h, err = resolveLink(args[0], time.Now(), opts...)
+		} else {
+			h, err = resolveHandoff(cmd.Context(), http.DefaultClient, args[0])
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Connect failed: %v\n", err)
+			os.Exit(1)
+		}
+		if err := attach.Attach(h.url, h.token); err != nil {
+			fmt.Fprintf(os.Stderr, "Attach failed: %+v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	ConnectCmd.Flags().BoolVar(&hashPasscodeArg, "hash-passcode", false, "Look up the link's passcode by its hash, for sessions started with 'clauder quickstart --hash-passcode'")
+	ConnectCmd.Flags().StringVar(&coordinatorSecretArg, "coordinator-secret", "", "Secret the passcode is hashed with, implies --hash-passcode. Defaults to the secret in ~/.clauder/coordinator_key")
+}
@@ -0,0 +1,86 @@
+package connect
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/cmd/quickstart"
+	"github.com/zohaibahmed/clauder/lib/coordinator"
+)
+
+func TestResolveHandoff(t *testing.T) {
+	var claimed bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/status" || r.Header.Get("Authorization") != "Bearer handoff-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		claimed = true
+		_, _ = w.Write([]byte(`{"status":"stable"}`))
+	}))
+	defer server.Close()
+	coordinatorSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/lookup/ABCD2345":
+			_ = json.NewEncoder(w).Encode(coordinator.LookupResponse{TunnelURL: server.URL + "/", Token: "handoff-token"})
+		case "/lookup/WRNG2345":
+			_ = json.NewEncoder(w).Encode(coordinator.LookupResponse{TunnelURL: server.URL, Token: "wrong-token"})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(coordinator.LookupResponse{Error: "Invalid or expired passcode"})
+		}
+	}))
+	defer coordinatorSrv.Close()
+	t.Setenv("COORDINATOR_URL", coordinatorSrv.URL)
+	ctx := context.Background()
+
+	h, err := resolveHandoff(ctx, http.DefaultClient, " abcd2345\n")
+	require.NoError(t, err)
+	assert.Equal(t, handoff{url: server.URL, token: "handoff-token"}, h)
+	assert.True(t, claimed, "the handoff is claimed before attaching")
+
+	_, err = resolveHandoff(ctx, http.DefaultClient, "ABC234")
+	assert.ErrorContains(t, err, `invalid handoff code "ABC234"`)
+	_, err = resolveHandoff(ctx, http.DefaultClient, "ZZZZ2345")
+	assert.ErrorContains(t, err, "failed to look up handoff code: lookup failed: Invalid or expired passcode")
+	_, err = resolveHandoff(ctx, http.DefaultClient, "WRNG2345")
+	assert.ErrorContains(t, err, "rejected the handoff: 401 Unauthorized")
+}
+
+func TestResolveLink(t *testing.T) {
+	coordinatorSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/lookup/ABC234":
+			_ = json.NewEncoder(w).Encode(coordinator.LookupResponse{TunnelURL: "https://abc.lhr.life/", Token: "session-token"})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(coordinator.LookupResponse{Error: "Invalid or expired passcode"})
+		}
+	}))
+	defer coordinatorSrv.Close()
+	t.Setenv("COORDINATOR_URL", coordinatorSrv.URL)
+	now := time.Now()
+
+	link := quickstart.GenerateLink("session-token", "https://abc.lhr.life", "ABC234", now.Add(quickstart.LinkTTL))
+	h, err := resolveLink(link, now)
+	require.NoError(t, err)
+	assert.Equal(t, handoff{url: "https://abc.lhr.life", token: "session-token"}, h)
+
+	_, err = resolveLink(link, now.Add(quickstart.LinkTTL))
+	assert.ErrorContains(t, err, "the link expired")
+	forged := quickstart.GenerateLink("guessed-token", "https://abc.lhr.life", "ABC234", now.Add(quickstart.LinkTTL))
+	_, err = resolveLink(forged, now)
+	assert.ErrorContains(t, err, "signature is invalid")
+	moved := quickstart.GenerateLink("session-token", "https://old.lhr.life", "ABC234", now.Add(quickstart.LinkTTL))
+	_, err = resolveLink(moved, now)
+	assert.ErrorContains(t, err, "the session's tunnel changed")
+	unknown := quickstart.GenerateLink("session-token", "https://abc.lhr.life", "XYZ789", now.Add(quickstart.LinkTTL))
+	_, err = resolveLink(unknown, now)
+	assert.ErrorContains(t, err, "lookup failed: Invalid or expired passcode")
+}
@@ -0,0 +1,85 @@
+// Command coordinatord is a self-hosted implementation of the coordinator
+// service that maps passcodes to tunnel sessions. It's useful in environments
+// that can't reach the hosted coordinator. Point clients at it with
+// COORDINATOR_URL, e.g. COORDINATOR_URL=http://myserver:9090.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const purgeInterval = 60 * time.Second
+
+var (
+	dbPath     string
+	port       int
+	sessionTTL time.Duration
+)
+
+func runCoordinator(ctx context.Context, logger *slog.Logger) error {
+	store, err := OpenStore(dbPath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	secret := os.Getenv("COORDINATOR_SECRET")
+	if secret == "" {
+		logger.Warn("COORDINATOR_SECRET is not set, anyone can register sessions")
+	}
+
+	srv := NewServer(store, secret, sessionTTL, logger)
+	srv.StartPurgeLoop(ctx, purgeInterval)
+
+	httpServer := &http.Server{
+		Addr:    fmt.Sprintf(":%d", port),
+		Handler: srv.Handler(),
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = httpServer.Shutdown(shutdownCtx)
+	}()
+
+	logger.Info("Starting coordinator", "port", port, "db", dbPath)
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to start server: %w", err)
+	}
+	return nil
+}
+
+var coordinatorCmd = &cobra.Command{
+	Use:   "coordinatord",
+	Short: "Run a self-hosted coordinator",
+	Long:  `Run a self-hosted coordinator that maps passcodes to tunnel sessions, persisted in SQLite.`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+		return runCoordinator(ctx, logger)
+	},
+}
+
+func init() {
+	coordinatorCmd.Flags().StringVar(&dbPath, "db", "coordinator.db", "Path to the SQLite database")
+	coordinatorCmd.Flags().IntVarP(&port, "port", "p", 9090, "Port to run the coordinator on")
+	coordinatorCmd.Flags().DurationVar(&sessionTTL, "session-ttl", 24*time.Hour, "How long a registered session stays valid")
+}
+
+func main() {
+	if err := coordinatorCmd.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
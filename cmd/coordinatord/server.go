@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/zohaibahmed/clauder/lib/coordinator"
+)
+
+// Passcodes are 6 characters from an alphabet without easily confused
+// characters, matching the hosted coordinator. Handoff codes are 8
+// characters from the same alphabet.
+var passcodeRegex = regexp.MustCompile(`^[ABCDEFGHJKLMNPQRSTUVWXYZ23456789]{6}([ABCDEFGHJKLMNPQRSTUVWXYZ23456789]{2})?$`)
+
+// Server implements the coordinator API on top of a Store.
+type Server struct {
+	store  *Store
+	secret string
+	ttl    time.Duration
+	logger *slog.Logger
+	// now is overridden in tests.
+	now func() time.Time
+}
+
+// NewServer creates a coordinator server. If secret is non-empty, requests
+// that modify sessions must send it in the coordinator.SecretHeader header.
+func NewServer(store *Store, secret string, ttl time.Duration, logger *slog.Logger) *Server {
+	return &Server{
+		store:  store,
+		secret: secret,
+		ttl:    ttl,
+		logger: logger,
+		now:    time.Now,
+	}
+}
+
+// Handler returns the HTTP handler serving the coordinator API.
+func (s *Server) Handler() http.Handler {
+	router := chi.NewMux()
+	router.Get("/health", s.health)
+	router.With(s.requireSecret).Post("/register", s.register)
+	router.Get("/lookup/{passcode}", s.lookup)
+	router.With(s.requireSecret).Delete("/sessions/{passcode}", s.deleteSession)
+	return router
+}
+
+// StartPurgeLoop removes expired sessions every interval until ctx is done.
+func (s *Server) StartPurgeLoop(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				n, err := s.store.PurgeExpired(ctx, s.now())
+				if err != nil {
+					s.logger.Error("Failed to purge expired sessions", "error", err)
+					continue
+				}
+				if n > 0 {
+					s.logger.Info("Purged expired sessions", "count", n)
+				}
+			}
+		}
+	}()
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func (s *Server) requireSecret(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.secret != "" &&
+			subtle.ConstantTimeCompare([]byte(r.Header.Get(coordinator.SecretHeader)), []byte(s.secret)) != 1 {
+			writeJSON(w, http.StatusUnauthorized, coordinator.RegisterResponse{Error: "Invalid coordinator secret"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) health(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (s *Server) register(w http.ResponseWriter, r *http.Request) {
+	var req coordinator.RegisterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, coordinator.RegisterResponse{Error: "Invalid request body"})
+		return
+	}
+	// a session is registered with either its passcode or its passcode's
+	// hash, which lookups then use in place of the passcode
+	passcode := req.Passcode
+	if passcode == "" {
+		passcode = req.PasscodeHash
+	}
+	if passcode == "" || req.TunnelURL == "" || req.Token == "" {
+		writeJSON(w, http.StatusBadRequest, coordinator.RegisterResponse{Error: "Missing required fields: passcode or passcode_hash, tunnel_url, token"})
+		return
+	}
+	if req.Passcode != "" && req.PasscodeHash != "" {
+		writeJSON(w, http.StatusBadRequest, coordinator.RegisterResponse{Error: "Only one of passcode and passcode_hash may be set"})
+		return
+	}
+	if req.Passcode != "" && !passcodeRegex.MatchString(req.Passcode) {
+		writeJSON(w, http.StatusBadRequest, coordinator.RegisterResponse{Error: "Invalid passcode format. Expected: 6 or 8-character alphanumeric code (e.g. ABC123)"})
+		return
+	}
+	if req.PasscodeHash != "" && !coordinator.PasscodeHashRegex.MatchString(req.PasscodeHash) {
+		writeJSON(w, http.StatusBadRequest, coordinator.RegisterResponse{Error: "Invalid passcode_hash format. Expected: hex-encoded HMAC-SHA256"})
+		return
+	}
+	if req.ExpiresIn < 0 {
+		writeJSON(w, http.StatusBadRequest, coordinator.RegisterResponse{Error: "Invalid expires_in, expected a positive number of seconds"})
+		return
+	}
+	// sessions can ask to expire sooner, but not later
+	ttl := s.ttl
+	if requested := time.Duration(req.ExpiresIn) * time.Second; requested > 0 && requested < ttl {
+		ttl = requested
+	}
+
+	err := s.store.Put(r.Context(), Session{
+		Passcode:  passcode,
+		TunnelURL: req.TunnelURL,
+		APIURL:    req.APIURL,
+		Token:     req.Token,
+		ExpiresAt: s.now().Add(ttl),
+	})
+	if err != nil {
+		s.logger.Error("Failed to register session", "error", err)
+		writeJSON(w, http.StatusInternalServerError, coordinator.RegisterResponse{Error: "Internal server error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, coordinator.RegisterResponse{
+		Success:   true,
+		Passcode:  passcode,
+		ExpiresIn: int(ttl.Seconds()),
+	})
+}
+
+func (s *Server) lookup(w http.ResponseWriter, r *http.Request) {
+	session, err := s.store.Get(r.Context(), chi.URLParam(r, "passcode"), s.now())
+	if errors.Is(err, ErrSessionNotFound) {
+		writeJSON(w, http.StatusNotFound, coordinator.LookupResponse{Error: "Invalid or expired passcode"})
+		return
+	}
+	if err != nil {
+		s.logger.Error("Failed to look up session", "error", err)
+		writeJSON(w, http.StatusInternalServerError, coordinator.LookupResponse{Error: "Internal server error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, coordinator.LookupResponse{
+		TunnelURL: session.TunnelURL,
+		APIURL:    session.APIURL,
+		Token:     session.Token,
+		ExpiresAt: session.ExpiresAt.UnixMilli(),
+	})
+}
+
+func (s *Server) deleteSession(w http.ResponseWriter, r *http.Request) {
+	err := s.store.Delete(r.Context(), chi.URLParam(r, "passcode"))
+	if errors.Is(err, ErrSessionNotFound) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Session not found"})
+		return
+	}
+	if err != nil {
+		s.logger.Error("Failed to delete session", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zohaibahmed/clauder/lib/coordinator"
+)
+
+const testSecret = "s3cret"
+
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newTestServer(t *testing.T) (*Server, *httptest.Server, *testClock) {
+	t.Helper()
+	store, err := OpenStore(filepath.Join(t.TempDir(), "coordinator.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+
+	clock := &testClock{now: time.Unix(1_700_000_000, 0)}
+	srv := NewServer(store, testSecret, time.Hour, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	srv.now = clock.Now
+	ts := httptest.NewServer(srv.Handler())
+	t.Cleanup(ts.Close)
+	return srv, ts, clock
+}
+
+func doRequest(t *testing.T, method, url, secret string, body any) (*http.Response, map[string]any) {
+	t.Helper()
+	var reqBody bytes.Buffer
+	if body != nil {
+		require.NoError(t, json.NewEncoder(&reqBody).Encode(body))
+	}
+	req, err := http.NewRequest(method, url, &reqBody)
+	require.NoError(t, err)
+	if secret != "" {
+		req.Header.Set(coordinator.SecretHeader, secret)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var respBody map[string]any
+	if resp.StatusCode != http.StatusNoContent {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&respBody))
+	}
+	return resp, respBody
+}
+
+func register(t *testing.T, ts *httptest.Server, passcode string) {
+	t.Helper()
+	resp, body := doRequest(t, http.MethodPost, ts.URL+"/register", testSecret, coordinator.RegisterRequest{
+		Passcode:  passcode,
+		TunnelURL: "https://" + passcode + ".lhr.life",
+		Token:     "token-" + passcode,
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode, body)
+}
+
+func TestRegister(t *testing.T) {
+	_, ts, _ := newTestServer(t)
+	req := coordinator.RegisterRequest{Passcode: "ABC234", TunnelURL: "https://abc.lhr.life", Token: "tok"}
+
+	t.Run("success", func(t *testing.T) {
+		resp, body := doRequest(t, http.MethodPost, ts.URL+"/register", testSecret, req)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, map[string]any{"success": true, "passcode": "ABC234", "expires_in": float64(3600)}, body)
+	})
+
+	t.Run("missing-secret", func(t *testing.T) {
+		resp, _ := doRequest(t, http.MethodPost, ts.URL+"/register", "", req)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	t.Run("wrong-secret", func(t *testing.T) {
+		resp, _ := doRequest(t, http.MethodPost, ts.URL+"/register", "nope", req)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	t.Run("missing-fields", func(t *testing.T) {
+		resp, body := doRequest(t, http.MethodPost, ts.URL+"/register", testSecret, coordinator.RegisterRequest{Passcode: "ABC234"})
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, false, body["success"])
+	})
+
+	t.Run("invalid-passcode", func(t *testing.T) {
+		bad := req
+		bad.Passcode = "abc-01"
+		resp, _ := doRequest(t, http.MethodPost, ts.URL+"/register", testSecret, bad)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("client", func(t *testing.T) {
+		t.Setenv("COORDINATOR_URL", ts.URL)
+		t.Setenv("COORDINATOR_SECRET", testSecret)
+		require.NoError(t, coordinator.Register("XYZ789", "https://xyz.lhr.life", "tok"))
+
+		lookup, err := coordinator.Lookup("XYZ789")
+		require.NoError(t, err)
+		assert.Equal(t, "https://xyz.lhr.life", lookup.TunnelURL)
+		assert.Equal(t, "https://xyz.lhr.life/v1", lookup.APIURL)
+		assert.Equal(t, "tok", lookup.Token)
+
+		require.NoError(t, coordinator.Deregister("XYZ789"))
+		_, err = coordinator.Lookup("XYZ789")
+		assert.Error(t, err)
+		// deregistering twice isn't an error
+		require.NoError(t, coordinator.Deregister("XYZ789"))
+	})
+}
+
+func TestRegisterHandoffCode(t *testing.T) {
+	_, ts, clock := newTestServer(t)
+	t.Setenv("COORDINATOR_URL", ts.URL)
+	t.Setenv("COORDINATOR_SECRET", testSecret)
+	require.NoError(t, coordinator.RegisterHandoff("ABCD2345", "https://abc.lhr.life", "handoff-tok", 30*time.Second))
+
+	lookup, err := coordinator.Lookup("ABCD2345")
+	require.NoError(t, err)
+	assert.Equal(t, "handoff-tok", lookup.Token)
+	assert.Equal(t, clock.Now().Add(30*time.Second).UnixMilli(), lookup.ExpiresAt)
+	clock.Advance(30 * time.Second)
+	_, err = coordinator.Lookup("ABCD2345")
+	assert.Error(t, err)
+
+	// sessions can't outlive the coordinator's TTL
+	resp, body := doRequest(t, http.MethodPost, ts.URL+"/register", testSecret, coordinator.RegisterRequest{
+		Passcode: "ABC234", TunnelURL: "https://abc.lhr.life", Token: "tok", ExpiresIn: 7200,
+	})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, float64(3600), body["expires_in"])
+
+	resp, _ = doRequest(t, http.MethodPost, ts.URL+"/register", testSecret, coordinator.RegisterRequest{
+		Passcode: "ABC234", TunnelURL: "https://abc.lhr.life", Token: "tok", ExpiresIn: -1,
+	})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp, _ = doRequest(t, http.MethodPost, ts.URL+"/register", testSecret, coordinator.RegisterRequest{
+		Passcode: "ABCD234", TunnelURL: "https://abc.lhr.life", Token: "tok",
+	})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "7-character codes are invalid")
+}
+
+func TestRegisterPasscodeHash(t *testing.T) {
+	srv, ts, _ := newTestServer(t)
+	t.Setenv("COORDINATOR_URL", ts.URL)
+	t.Setenv("COORDINATOR_SECRET", testSecret)
+	const key = "server-key"
+	require.NoError(t, coordinator.Register("XYZ789", "https://xyz.lhr.life", "tok", coordinator.WithPasscodeKey(key)))
+
+	// the coordinator only stores the hash
+	var stored string
+	require.NoError(t, srv.store.db.QueryRow(`SELECT passcode FROM sessions`).Scan(&stored))
+	assert.Equal(t, coordinator.HashPasscode("XYZ789", key), stored)
+
+	lookup, err := coordinator.Lookup("XYZ789", coordinator.WithPasscodeKey(key))
+	require.NoError(t, err)
+	assert.Equal(t, "https://xyz.lhr.life", lookup.TunnelURL)
+	assert.Equal(t, "tok", lookup.Token)
+
+	_, err = coordinator.Lookup("XYZ789", coordinator.WithPasscodeKey("wrong-key"))
+	assert.ErrorContains(t, err, "Invalid or expired passcode")
+	_, err = coordinator.Lookup("XYZ788", coordinator.WithPasscodeKey(key))
+	assert.ErrorContains(t, err, "Invalid or expired passcode")
+	_, err = coordinator.Lookup("XYZ789")
+	assert.ErrorContains(t, err, "Invalid or expired passcode", "the plaintext passcode isn't registered")
+
+	require.NoError(t, coordinator.Deregister("XYZ789", coordinator.WithPasscodeKey(key)))
+	_, err = coordinator.Lookup("XYZ789", coordinator.WithPasscodeKey(key))
+	assert.Error(t, err)
+
+	for _, req := range []coordinator.RegisterRequest{
+		{PasscodeHash: "not-a-hash", TunnelURL: "https://xyz.lhr.life", Token: "tok"},
+		{Passcode: "XYZ789", PasscodeHash: coordinator.HashPasscode("XYZ789", key), TunnelURL: "https://xyz.lhr.life", Token: "tok"},
+	} {
+		resp, _ := doRequest(t, http.MethodPost, ts.URL+"/register", testSecret, req)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, req)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	_, ts, clock := newTestServer(t)
+	register(t, ts, "ABC234")
+
+	resp, body := doRequest(t, http.MethodGet, ts.URL+"/lookup/ABC234", "", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, map[string]any{
+		"tunnel_url": "https://ABC234.lhr.life",
+		"token":      "token-ABC234",
+		"expires_at": float64(clock.Now().Add(time.Hour).UnixMilli()),
+	}, body)
+
+	resp, _ = doRequest(t, http.MethodGet, ts.URL+"/lookup/ZZZ999", "", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// Expired sessions aren't returned even before they're purged.
+	clock.Advance(time.Hour)
+	resp, _ = doRequest(t, http.MethodGet, ts.URL+"/lookup/ABC234", "", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestDeleteSession(t *testing.T) {
+	_, ts, _ := newTestServer(t)
+	register(t, ts, "ABC234")
+
+	resp, _ := doRequest(t, http.MethodDelete, ts.URL+"/sessions/ABC234", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp, _ = doRequest(t, http.MethodDelete, ts.URL+"/sessions/ABC234", testSecret, nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp, _ = doRequest(t, http.MethodGet, ts.URL+"/lookup/ABC234", "", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, _ = doRequest(t, http.MethodDelete, ts.URL+"/sessions/ABC234", testSecret, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestPurgeLoop(t *testing.T) {
+	srv, ts, clock := newTestServer(t)
+	register(t, ts, "ABC234")
+	clock.Advance(30 * time.Minute)
+	register(t, ts, "XYZ789")
+	clock.Advance(45 * time.Minute)
+
+	countSessions := func() int {
+		var n int
+		require.NoError(t, srv.store.db.QueryRow(`SELECT COUNT(*) FROM sessions`).Scan(&n))
+		return n
+	}
+	require.Equal(t, 2, countSessions())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv.StartPurgeLoop(ctx, 10*time.Millisecond)
+
+	// Only the first session has expired.
+	require.Eventually(t, func() bool { return countSessions() == 1 }, 5*time.Second, 10*time.Millisecond)
+	resp, _ := doRequest(t, http.MethodGet, ts.URL+"/lookup/XYZ789", "", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	clock.Advance(time.Hour)
+	require.Eventually(t, func() bool { return countSessions() == 0 }, 5*time.Second, 10*time.Millisecond)
+}
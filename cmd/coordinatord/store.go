@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// ErrSessionNotFound is returned when a passcode has no live session.
+var ErrSessionNotFound = errors.New("session not found")
+
+// Session is a registered tunnel session, keyed by its passcode, or by its
+// passcode's hash if it was registered with one.
+type Session struct {
+	Passcode  string
+	TunnelURL string
+	// APIURL is empty for sessions registered by older clients.
+	APIURL    string
+	Token     string
+	ExpiresAt time.Time
+}
+
+// Store persists sessions in a SQLite database.
+type Store struct {
+	db *sql.DB
+}
+
+const createSessionsTable = `
+CREATE TABLE IF NOT EXISTS sessions (
+	passcode   TEXT PRIMARY KEY,
+	tunnel_url TEXT NOT NULL,
+	api_url    TEXT NOT NULL DEFAULT '',
+	token      TEXT NOT NULL,
+	expires_at INTEGER NOT NULL
+)`
+
+// addAPIURLColumn adds the api_url column to the sessions tables created
+// before it existed.
+const addAPIURLColumn = `ALTER TABLE sessions ADD COLUMN api_url TEXT NOT NULL DEFAULT ''`
+
+// OpenStore opens the SQLite database at path, creating it and the sessions
+// table if they don't exist.
+func OpenStore(path string) (*Store, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	// SQLite only supports a single writer. Serializing access through one
+	// connection avoids "database is locked" errors under concurrent requests.
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(createSessionsTable); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create sessions table: %w", err)
+	}
+	if err := migrateAPIURL(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+// migrateAPIURL adds the api_url column if the sessions table doesn't have
+// it yet.
+func migrateAPIURL(db *sql.DB) error {
+	var n int
+	err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('sessions') WHERE name = 'api_url'`).Scan(&n)
+	if err != nil {
+		return fmt.Errorf("failed to read sessions table schema: %w", err)
+	}
+	if n > 0 {
+		return nil
+	}
+	if _, err := db.Exec(addAPIURLColumn); err != nil {
+		return fmt.Errorf("failed to add api_url column: %w", err)
+	}
+	return nil
+}
+
+// Close closes the underlying database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Put stores the session, replacing any existing session with the same passcode.
+func (s *Store) Put(ctx context.Context, session Session) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT OR REPLACE INTO sessions (passcode, tunnel_url, api_url, token, expires_at) VALUES (?, ?, ?, ?, ?)`,
+		session.Passcode, session.TunnelURL, session.APIURL, session.Token, session.ExpiresAt.Unix())
+	if err != nil {
+		return fmt.Errorf("failed to store session: %w", err)
+	}
+	return nil
+}
+
+// Get returns the session for the passcode, or ErrSessionNotFound if it
+// doesn't exist or expired before now.
+func (s *Store) Get(ctx context.Context, passcode string, now time.Time) (Session, error) {
+	session := Session{Passcode: passcode}
+	var expiresAt int64
+	err := s.db.QueryRowContext(ctx,
+		`SELECT tunnel_url, api_url, token, expires_at FROM sessions WHERE passcode = ? AND expires_at > ?`,
+		passcode, now.Unix()).Scan(&session.TunnelURL, &session.APIURL, &session.Token, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Session{}, ErrSessionNotFound
+	}
+	if err != nil {
+		return Session{}, fmt.Errorf("failed to look up session: %w", err)
+	}
+	session.ExpiresAt = time.Unix(expiresAt, 0)
+	return session, nil
+}
+
+// Delete removes the session for the passcode. It returns ErrSessionNotFound
+// if there was no such session.
+func (s *Store) Delete(ctx context.Context, passcode string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM sessions WHERE passcode = ?`, passcode)
+	if err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	if n == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// PurgeExpired removes all sessions that expired before now and returns how
+// many were removed.
+func (s *Store) PurgeExpired(ctx context.Context, now time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM sessions WHERE expires_at <= ?`, now.Unix())
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge expired sessions: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge expired sessions: %w", err)
+	}
+	return n, nil
+}
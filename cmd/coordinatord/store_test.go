@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenStoreMigratesAPIURL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "coordinator.db")
+	db, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	// the sessions table before the api_url column
+	_, err = db.Exec(`CREATE TABLE sessions (
+	passcode   TEXT PRIMARY KEY,
+	tunnel_url TEXT NOT NULL,
+	token      TEXT NOT NULL,
+	expires_at INTEGER NOT NULL
+)`)
+	require.NoError(t, err)
+	expiresAt := time.Now().Add(time.Hour)
+	_, err = db.Exec(`INSERT INTO sessions VALUES ('ABC234', 'https://abc.lhr.life', 'tok', ?)`, expiresAt.Unix())
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	ctx := context.Background()
+	for range 2 {
+		store, err := OpenStore(path)
+		require.NoError(t, err)
+		session, err := store.Get(ctx, "ABC234", time.Now())
+		require.NoError(t, err)
+		assert.Equal(t, "https://abc.lhr.life", session.TunnelURL)
+		assert.Empty(t, session.APIURL)
+
+		require.NoError(t, store.Put(ctx, Session{Passcode: "XYZ789", TunnelURL: "https://xyz.lhr.life", APIURL: "https://xyz.lhr.life/v1", Token: "tok", ExpiresAt: expiresAt}))
+		session, err = store.Get(ctx, "XYZ789", time.Now())
+		require.NoError(t, err)
+		assert.Equal(t, "https://xyz.lhr.life/v1", session.APIURL)
+		require.NoError(t, store.Close())
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !windows
+
+package doctor
+
+import "golang.org/x/sys/unix"
+
+// diskFree returns the disk space available to the current user on the
+// file system containing path.
+func diskFree(path string) (uint64, error) {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return stat.Bavail * uint64(stat.Bsize), nil
+}
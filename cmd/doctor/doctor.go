@@ -0,0 +1,275 @@
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zohaibahmed/clauder/lib/coordinator"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	"github.com/zohaibahmed/clauder/lib/msgfmt"
+	"github.com/zohaibahmed/clauder/lib/termexec"
+	"github.com/zohaibahmed/clauder/lib/tunnel"
+	"golang.org/x/xerrors"
+)
+
+var (
+	agentArg string
+	portArg  int
+	verbose  bool
+)
+
+// minFreeDiskSpace is the free disk space below which the disk check fails.
+const minFreeDiskSpace = 100 * 1024 * 1024
+
+// system is what the checks inspect. It's replaced in tests.
+type system struct {
+	lookPath       func(file string) (string, error)
+	getenv         func(key string) string
+	httpClient     *http.Client
+	coordinatorURL string
+	listen         func(network, address string) (net.Listener, error)
+	startPTY       func(ctx context.Context) error
+	diskFree       func(path string) (uint64, error)
+	dataDir        string
+}
+
+func defaultSystem() system {
+	dataDir, err := os.UserHomeDir()
+	if err != nil {
+		dataDir = os.TempDir()
+	}
+	return system{
+		// agents are looked up where the server looks them up
+		lookPath: func(file string) (string, error) {
+			return termexec.ResolveBinary(file, msgfmt.BinarySearchPaths(msgfmt.AgentType(file)))
+		},
+		getenv:         os.Getenv,
+		httpClient:     &http.Client{Timeout: 5 * time.Second},
+		coordinatorURL: coordinator.URL(),
+		listen:         net.Listen,
+		startPTY:       startPTY,
+		diskFree:       diskFree,
+		dataDir:        dataDir,
+	}
+}
+
+// checkResult is the outcome of a single check.
+type checkResult struct {
+	name    string
+	ok      bool
+	message string
+	// details are only printed with --verbose.
+	details []string
+	// remediation is printed if the check failed.
+	remediation string
+}
+
+func checkBinary(sys system, agent string) checkResult {
+	result := checkResult{name: "Agent binary"}
+	path, err := sys.lookPath(agent)
+	if err != nil {
+		result.message = fmt.Sprintf("%s not found in PATH", agent)
+		result.details = []string{err.Error(), "PATH=" + sys.getenv("PATH")}
+		result.remediation = fmt.Sprintf("Install %s and make sure it's in your PATH", agent)
+		if agent == "claude" {
+			result.remediation = "Install Claude Code: npm install -g @anthropic-ai/claude-code"
+		}
+		return result
+	}
+	result.ok = true
+	result.message = fmt.Sprintf("%s found", agent)
+	result.details = []string{path}
+	return result
+}
+
+func checkAPIKey(sys system) checkResult {
+	result := checkResult{name: "API key"}
+	key := sys.getenv("ANTHROPIC_API_KEY")
+	if key == "" {
+		result.message = "ANTHROPIC_API_KEY is not set"
+		result.remediation = "Export ANTHROPIC_API_KEY with a key from https://console.anthropic.com/settings/keys"
+		return result
+	}
+	result.ok = true
+	result.message = "ANTHROPIC_API_KEY is set"
+	// never print the key itself
+	result.details = []string{fmt.Sprintf("%d characters", len(key))}
+	return result
+}
+
+func checkCoordinator(ctx context.Context, sys system) checkResult {
+	result := checkResult{name: "Coordinator"}
+	fail := func(message string) checkResult {
+		result.message = message
+		result.remediation = "Check your internet connection. To use a self-hosted coordinator, set COORDINATOR_URL"
+		return result
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sys.coordinatorURL+"/health", nil)
+	if err != nil {
+		return fail(fmt.Sprintf("invalid coordinator URL: %s", err))
+	}
+	start := time.Now()
+	res, err := sys.httpClient.Do(req)
+	if err != nil {
+		result.details = append(result.details, err.Error())
+		return fail(fmt.Sprintf("%s is unreachable", sys.coordinatorURL))
+	}
+	defer res.Body.Close()
+	result.details = append(result.details, fmt.Sprintf("responded in %s", time.Since(start).Round(time.Millisecond)))
+	if res.StatusCode != http.StatusOK {
+		return fail(fmt.Sprintf("%s responded with %s", sys.coordinatorURL, res.Status))
+	}
+	result.ok = true
+	result.message = fmt.Sprintf("%s is reachable", sys.coordinatorURL)
+	return result
+}
+
+func checkTunnelProviders(sys system) checkResult {
+	result := checkResult{name: "Tunnel provider"}
+	var available []string
+	for _, provider := range tunnel.Providers {
+		path, err := sys.lookPath(provider.Binary())
+		if err != nil {
+			result.details = append(result.details, fmt.Sprintf("%s: %s not found", provider, provider.Binary()))
+			continue
+		}
+		available = append(available, string(provider))
+		result.details = append(result.details, fmt.Sprintf("%s: %s", provider, path))
+	}
+	if len(available) == 0 {
+		result.message = "no tunnel provider found"
+		result.remediation = tunnel.InstallInstructions()[tunnel.ProviderLocal]
+		return result
+	}
+	result.ok = true
+	result.message = "found " + strings.Join(available, ", ")
+	return result
+}
+
+func checkPort(sys system, port int) checkResult {
+	result := checkResult{name: "Port"}
+	listener, err := sys.listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		result.message = fmt.Sprintf("port %d is in use", port)
+		result.details = []string{err.Error()}
+		result.remediation = fmt.Sprintf("Stop the process listening on port %d, e.g. with 'clauder stop', or pass --port", port)
+		return result
+	}
+	_ = listener.Close()
+	result.ok = true
+	result.message = fmt.Sprintf("port %d is free", port)
+	return result
+}
+
+func checkPTY(ctx context.Context, sys system) checkResult {
+	result := checkResult{name: "Pseudo terminal"}
+	if err := sys.startPTY(ctx); err != nil {
+		result.message = "failed to start a process in a pseudo terminal"
+		result.details = []string{err.Error()}
+		result.remediation = "On Linux, make sure /dev/ptmx is accessible and /dev/pts is mounted. On Windows, version 1903 or later is required"
+		return result
+	}
+	result.ok = true
+	result.message = "pseudo terminal allocated"
+	return result
+}
+
+func checkDiskSpace(sys system) checkResult {
+	result := checkResult{name: "Disk space", details: []string{sys.dataDir}}
+	free, err := sys.diskFree(sys.dataDir)
+	if err != nil {
+		result.message = "failed to get free disk space"
+		result.details = append(result.details, err.Error())
+		result.remediation = fmt.Sprintf("Make sure %s exists and is readable", sys.dataDir)
+		return result
+	}
+	freeMB := free / 1024 / 1024
+	if free < minFreeDiskSpace {
+		result.message = fmt.Sprintf("only %d MB free", freeMB)
+		result.remediation = fmt.Sprintf("Free up at least %d MB of disk space", minFreeDiskSpace/1024/1024)
+		return result
+	}
+	result.ok = true
+	result.message = fmt.Sprintf("%d MB free", freeMB)
+	return result
+}
+
+// startPTY starts a short-lived process in a pseudo terminal, like the
+// server does with the agent.
+func startPTY(ctx context.Context) error {
+	config := termexec.StartProcessConfig{Program: "sh", Args: []string{"-c", "sleep 10"}, TerminalWidth: 80, TerminalHeight: 24}
+	if runtime.GOOS == "windows" {
+		config.Program, config.Args = "cmd", []string{"/c", "pause"}
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	process, err := termexec.StartProcess(logctx.WithLogger(ctx, logger), config)
+	if err != nil {
+		return xerrors.Errorf("failed to start process: %w", err)
+	}
+	// how the process exits doesn't matter
+	_ = process.Close(logger, time.Second)
+	return nil
+}
+
+// runChecks runs all checks in order and prints their results. It returns
+// whether all of them passed.
+func runChecks(ctx context.Context, w io.Writer, sys system, agent string, port int, verbose bool) bool {
+	checks := []func() checkResult{
+		func() checkResult { return checkBinary(sys, agent) },
+		func() checkResult { return checkAPIKey(sys) },
+		func() checkResult { return checkCoordinator(ctx, sys) },
+		func() checkResult { return checkTunnelProviders(sys) },
+		func() checkResult { return checkPort(sys, port) },
+		func() checkResult { return checkPTY(ctx, sys) },
+		func() checkResult { return checkDiskSpace(sys) },
+	}
+	passed := true
+	for _, check := range checks {
+		result := check()
+		printResult(w, result, verbose)
+		passed = passed && result.ok
+	}
+	return passed
+}
+
+func printResult(w io.Writer, result checkResult, verbose bool) {
+	icon := "✅"
+	if !result.ok {
+		icon = "❌"
+	}
+	fmt.Fprintf(w, "%s %s: %s\n", icon, result.name, result.message)
+	if verbose {
+		for _, detail := range result.details {
+			fmt.Fprintf(w, "   %s\n", detail)
+		}
+	}
+	if !result.ok {
+		fmt.Fprintf(w, "   💡 %s\n", result.remediation)
+	}
+}
+
+var DoctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check that everything needed to run clauder is set up",
+	Long:  `Check the agent binary, the API key, the coordinator, the tunnel providers, the server port, pseudo terminal support and free disk space. Exits with status 1 if any check fails.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if !runChecks(context.Background(), os.Stdout, defaultSystem(), agentArg, portArg, verbose) {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	DoctorCmd.Flags().StringVar(&agentArg, "agent", "claude", "Agent binary to look for")
+	DoctorCmd.Flags().IntVarP(&portArg, "port", "p", 3284, "Port the server will run on")
+	DoctorCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Print detailed diagnostics for each check")
+}
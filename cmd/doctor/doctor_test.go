@@ -0,0 +1,204 @@
+package doctor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSystem returns a system on which every check passes.
+func fakeSystem(t *testing.T) system {
+	t.Helper()
+	coordinator := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(`{"status":"ok"}`))
+	}))
+	t.Cleanup(coordinator.Close)
+	return system{
+		lookPath: lookPathOf("claude", "ssh"),
+		getenv: func(key string) string {
+			if key == "ANTHROPIC_API_KEY" {
+				return "sk-ant-test"
+			}
+			return ""
+		},
+		httpClient:     coordinator.Client(),
+		coordinatorURL: coordinator.URL,
+		listen: func(network, address string) (net.Listener, error) {
+			return fakeListener{}, nil
+		},
+		startPTY: func(ctx context.Context) error { return nil },
+		diskFree: func(path string) (uint64, error) { return 1 << 30, nil },
+		dataDir:  "/home/user",
+	}
+}
+
+// lookPathOf returns a lookPath that only finds the given commands.
+func lookPathOf(commands ...string) func(string) (string, error) {
+	return func(file string) (string, error) {
+		for _, command := range commands {
+			if file == command {
+				return "/usr/bin/" + file, nil
+			}
+		}
+		return "", &exec.Error{Name: file, Err: exec.ErrNotFound}
+	}
+}
+
+type fakeListener struct{ net.Listener }
+
+func (fakeListener) Close() error { return nil }
+
+func TestCheckBinary(t *testing.T) {
+	sys := fakeSystem(t)
+	result := checkBinary(sys, "claude")
+	assert.True(t, result.ok)
+	assert.Equal(t, []string{"/usr/bin/claude"}, result.details)
+
+	result = checkBinary(sys, "aider")
+	assert.False(t, result.ok)
+	assert.Equal(t, "aider not found in PATH", result.message)
+	assert.Contains(t, result.remediation, "Install aider")
+
+	sys.lookPath = lookPathOf()
+	result = checkBinary(sys, "claude")
+	assert.False(t, result.ok)
+	assert.Contains(t, result.remediation, "npm install -g @anthropic-ai/claude-code")
+}
+
+func TestCheckAPIKey(t *testing.T) {
+	sys := fakeSystem(t)
+	result := checkAPIKey(sys)
+	assert.True(t, result.ok)
+	assert.NotContains(t, result.details, "sk-ant-test", "the key must not be printed")
+
+	sys.getenv = func(string) string { return "" }
+	result = checkAPIKey(sys)
+	assert.False(t, result.ok)
+	assert.NotEmpty(t, result.remediation)
+}
+
+func TestCheckCoordinator(t *testing.T) {
+	ctx := context.Background()
+	sys := fakeSystem(t)
+	result := checkCoordinator(ctx, sys)
+	assert.True(t, result.ok, result.message)
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+	sys.coordinatorURL = failing.URL
+	result = checkCoordinator(ctx, sys)
+	assert.False(t, result.ok)
+	assert.Contains(t, result.message, "502")
+
+	// nothing listens on a closed server's port
+	failing.Close()
+	result = checkCoordinator(ctx, sys)
+	assert.False(t, result.ok)
+	assert.Contains(t, result.message, "unreachable")
+	assert.Contains(t, result.remediation, "COORDINATOR_URL")
+}
+
+func TestCheckTunnelProviders(t *testing.T) {
+	sys := fakeSystem(t)
+	sys.lookPath = lookPathOf("bore", "ssh")
+	result := checkTunnelProviders(sys)
+	assert.True(t, result.ok)
+	assert.Equal(t, "found bore, localhost.run", result.message)
+
+	sys.lookPath = lookPathOf()
+	result = checkTunnelProviders(sys)
+	assert.False(t, result.ok)
+	assert.Contains(t, result.remediation, "SSH")
+}
+
+func TestCheckPort(t *testing.T) {
+	sys := fakeSystem(t)
+	result := checkPort(sys, 3284)
+	assert.True(t, result.ok)
+	assert.Equal(t, "port 3284 is free", result.message)
+
+	sys.listen = func(network, address string) (net.Listener, error) {
+		return nil, errors.New("listen tcp :3284: bind: address already in use")
+	}
+	result = checkPort(sys, 3284)
+	assert.False(t, result.ok)
+	assert.Equal(t, "port 3284 is in use", result.message)
+	assert.Contains(t, result.remediation, "clauder stop")
+
+	// the real listener detects a port that's taken
+	listener, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	defer listener.Close()
+	sys.listen = net.Listen
+	result = checkPort(sys, listener.Addr().(*net.TCPAddr).Port)
+	assert.False(t, result.ok)
+}
+
+func TestCheckPTY(t *testing.T) {
+	sys := fakeSystem(t)
+	assert.True(t, checkPTY(context.Background(), sys).ok)
+
+	sys.startPTY = func(ctx context.Context) error { return errors.New("open /dev/ptmx: permission denied") }
+	result := checkPTY(context.Background(), sys)
+	assert.False(t, result.ok)
+	assert.Equal(t, []string{"open /dev/ptmx: permission denied"}, result.details)
+
+	// the real implementation starts a shell
+	require.NoError(t, startPTY(context.Background()))
+}
+
+func TestCheckDiskSpace(t *testing.T) {
+	sys := fakeSystem(t)
+	result := checkDiskSpace(sys)
+	assert.True(t, result.ok)
+	assert.Equal(t, "1024 MB free", result.message)
+
+	sys.diskFree = func(path string) (uint64, error) { return 50 * 1024 * 1024, nil }
+	result = checkDiskSpace(sys)
+	assert.False(t, result.ok)
+	assert.Equal(t, "only 50 MB free", result.message)
+
+	sys.diskFree = func(path string) (uint64, error) { return 0, errors.New("no such file or directory") }
+	result = checkDiskSpace(sys)
+	assert.False(t, result.ok)
+
+	// the real implementation works on the test's temporary directory
+	free, err := diskFree(t.TempDir())
+	require.NoError(t, err)
+	assert.Greater(t, free, uint64(0))
+}
+
+func TestRunChecks(t *testing.T) {
+	ctx := context.Background()
+	sys := fakeSystem(t)
+
+	var out bytes.Buffer
+	assert.True(t, runChecks(ctx, &out, sys, "claude", 3284, false))
+	assert.Equal(t, 7, bytes.Count(out.Bytes(), []byte("✅")))
+	assert.NotContains(t, out.String(), "❌")
+	assert.NotContains(t, out.String(), "/usr/bin/claude", "details are only printed with --verbose")
+
+	out.Reset()
+	assert.True(t, runChecks(ctx, &out, sys, "claude", 3284, true))
+	assert.Contains(t, out.String(), "   /usr/bin/claude\n")
+
+	out.Reset()
+	sys.getenv = func(string) string { return "" }
+	assert.False(t, runChecks(ctx, &out, sys, "claude", 3284, false))
+	assert.Contains(t, out.String(), "❌ API key: ANTHROPIC_API_KEY is not set\n   💡 Export ANTHROPIC_API_KEY")
+	assert.Equal(t, 6, bytes.Count(out.Bytes(), []byte("✅")), "the remaining checks still run")
+}
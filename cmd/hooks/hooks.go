@@ -0,0 +1,192 @@
+package hooks
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+)
+
+var (
+	remoteUrlArg string
+	keywordArg   string
+	yesArg       bool
+)
+
+// confirmFunc asks the user a yes or no question.
+type confirmFunc func(question string) (bool, error)
+
+// promptConfirm returns a confirmFunc that asks on out and reads the answer
+// from in. Anything but y or yes is a no.
+func promptConfirm(in io.Reader, out io.Writer) confirmFunc {
+	reader := bufio.NewReader(in)
+	return func(question string) (bool, error) {
+		fmt.Fprintf(out, "%s [y/N]: ", question)
+		line, err := reader.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return false, xerrors.Errorf("failed to read answer: %w", err)
+		}
+		answer := strings.ToLower(strings.TrimSpace(line))
+		return answer == "y" || answer == "yes", nil
+	}
+}
+
+// hooksDir returns the hooks directory of the git repository in the
+// working directory.
+func hooksDir(ctx context.Context) (string, error) {
+	out, err := exec.CommandContext(ctx, "git", "rev-parse", "--git-path", "hooks").Output()
+	if err != nil {
+		return "", xerrors.Errorf("not in a git repository: %w", err)
+	}
+	return filepath.Abs(strings.TrimSpace(string(out)))
+}
+
+// readHook returns the contents of the hook at path, and whether it exists.
+func readHook(path string) (string, bool, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, xerrors.Errorf("failed to read %s: %w", path, err)
+	}
+	return string(data), true, nil
+}
+
+// installHook writes the pre-commit hook to dir. An existing hook that
+// clauder didn't install is only overwritten if confirm agrees. It returns
+// whether the hook was written.
+func installHook(dir, script string, confirm confirmFunc) (bool, error) {
+	path := filepath.Join(dir, "pre-commit")
+	existing, ok, err := readHook(path)
+	if err != nil {
+		return false, err
+	}
+	if ok && !strings.Contains(existing, hookMarker) {
+		overwrite, err := confirm(fmt.Sprintf("%s already exists, overwrite it?", path))
+		if err != nil || !overwrite {
+			return false, err
+		}
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return false, xerrors.Errorf("failed to create %s: %w", dir, err)
+	}
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		return false, xerrors.Errorf("failed to write %s: %w", path, err)
+	}
+	// WriteFile keeps the mode of an existing file
+	if err := os.Chmod(path, 0o755); err != nil {
+		return false, xerrors.Errorf("failed to make %s executable: %w", path, err)
+	}
+	return true, nil
+}
+
+// uninstallHook removes the pre-commit hook from dir. A hook that clauder
+// didn't install is only removed if confirm agrees. It returns whether the
+// hook was removed.
+func uninstallHook(dir string, confirm confirmFunc) (bool, error) {
+	path := filepath.Join(dir, "pre-commit")
+	existing, ok, err := readHook(path)
+	if err != nil || !ok {
+		return false, err
+	}
+	if !strings.Contains(existing, hookMarker) {
+		remove, err := confirm(fmt.Sprintf("%s wasn't installed by clauder, remove it anyway?", path))
+		if err != nil || !remove {
+			return false, err
+		}
+	}
+	if err := os.Remove(path); err != nil {
+		return false, xerrors.Errorf("failed to remove %s: %w", path, err)
+	}
+	return true, nil
+}
+
+func confirmer() confirmFunc {
+	if yesArg {
+		return func(string) (bool, error) { return true, nil }
+	}
+	return promptConfirm(os.Stdin, os.Stdout)
+}
+
+var installCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Install a pre-commit hook that asks the agent to review commits",
+	Long: `Install a git pre-commit hook in the current repository. The hook sends
+the staged changes to the clauder server's agent for review, waits until the
+agent is done, and blocks the commit if the agent's reply contains the
+failure keyword. The review is skipped if the server isn't running.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		serverURL := remoteUrlArg
+		if !strings.HasPrefix(serverURL, "http://") && !strings.HasPrefix(serverURL, "https://") {
+			serverURL = "http://" + serverURL
+		}
+		script, err := renderPreCommit(strings.TrimRight(serverURL, "/"), keywordArg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Install failed: %v\n", err)
+			os.Exit(1)
+		}
+		dir, err := hooksDir(cmd.Context())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Install failed: %v\n", err)
+			os.Exit(1)
+		}
+		installed, err := installHook(dir, script, confirmer())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Install failed: %v\n", err)
+			os.Exit(1)
+		}
+		if !installed {
+			fmt.Println("Kept the existing pre-commit hook.")
+			return
+		}
+		fmt.Printf("Installed the pre-commit hook in %s.\n", dir)
+	},
+}
+
+var uninstallCmd = &cobra.Command{
+	Use:   "uninstall",
+	Short: "Remove the pre-commit hook",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		dir, err := hooksDir(cmd.Context())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Uninstall failed: %v\n", err)
+			os.Exit(1)
+		}
+		removed, err := uninstallHook(dir, confirmer())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Uninstall failed: %v\n", err)
+			os.Exit(1)
+		}
+		if !removed {
+			fmt.Println("No pre-commit hook was removed.")
+			return
+		}
+		fmt.Printf("Removed the pre-commit hook from %s.\n", dir)
+	},
+}
+
+var HooksCmd = &cobra.Command{
+	Use:   "hooks",
+	Short: "Manage git hooks that ask the agent to review commits",
+}
+
+func init() {
+	installCmd.Flags().StringVarP(&remoteUrlArg, "url", "u", "localhost:3284", "URL of the clauder server")
+	installCmd.Flags().StringVarP(&keywordArg, "keyword", "k", "REJECT:", "Keyword in the agent's reply that blocks the commit")
+	installCmd.Flags().BoolVarP(&yesArg, "yes", "y", false, "Overwrite an existing hook without asking")
+	uninstallCmd.Flags().BoolVarP(&yesArg, "yes", "y", false, "Remove a hook clauder didn't install without asking")
+	HooksCmd.AddCommand(installCmd)
+	HooksCmd.AddCommand(uninstallCmd)
+}
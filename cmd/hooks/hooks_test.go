@@ -0,0 +1,203 @@
+package hooks
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/httpapi"
+)
+
+func answer(ok bool) (confirmFunc, *int) {
+	asked := 0
+	return func(string) (bool, error) {
+		asked++
+		return ok, nil
+	}, &asked
+}
+
+func TestRenderPreCommit(t *testing.T) {
+	script, err := renderPreCommit("http://localhost:4000", "DON'T COMMIT")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(script, "#!/bin/sh\n"))
+	assert.Contains(t, script, hookMarker)
+	assert.Contains(t, script, "CLAUDER_URL=${CLAUDER_URL:-'http://localhost:4000'}")
+	assert.Contains(t, script, `CLAUDER_KEYWORD=${CLAUDER_KEYWORD:-'DON'\''T COMMIT'}`)
+
+	path := filepath.Join(t.TempDir(), "pre-commit")
+	require.NoError(t, os.WriteFile(path, []byte(script), 0o644))
+	out, err := exec.Command("sh", "-n", path).CombinedOutput()
+	assert.NoError(t, err, string(out))
+
+	_, err = renderPreCommit("http://localhost:4000", " ")
+	assert.Error(t, err)
+	_, err = renderPreCommit("http://localhost:4000", "REJECT:\nrm -rf /")
+	assert.Error(t, err)
+}
+
+func TestInstallHook(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "hooks")
+	path := filepath.Join(dir, "pre-commit")
+	script, err := renderPreCommit("http://localhost:3284", "REJECT:")
+	require.NoError(t, err)
+
+	confirm, asked := answer(false)
+	installed, err := installHook(dir, script, confirm)
+	require.NoError(t, err)
+	assert.True(t, installed)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o755), info.Mode().Perm())
+
+	// replacing our own hook doesn't ask
+	installed, err = installHook(dir, script, confirm)
+	require.NoError(t, err)
+	assert.True(t, installed)
+	assert.Equal(t, 0, *asked)
+
+	require.NoError(t, os.WriteFile(path, []byte("#!/bin/sh\nmake lint\n"), 0o600))
+	installed, err = installHook(dir, script, confirm)
+	require.NoError(t, err)
+	assert.False(t, installed)
+	assert.Equal(t, 1, *asked)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "#!/bin/sh\nmake lint\n", string(data))
+
+	confirm, _ = answer(true)
+	installed, err = installHook(dir, script, confirm)
+	require.NoError(t, err)
+	assert.True(t, installed)
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, script, string(data))
+	info, err = os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o755), info.Mode().Perm())
+}
+
+func TestUninstallHook(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "pre-commit")
+	confirm, asked := answer(false)
+
+	removed, err := uninstallHook(dir, confirm)
+	require.NoError(t, err)
+	assert.False(t, removed)
+
+	require.NoError(t, os.WriteFile(path, []byte("#!/bin/sh\nmake lint\n"), 0o755))
+	removed, err = uninstallHook(dir, confirm)
+	require.NoError(t, err)
+	assert.False(t, removed)
+	assert.Equal(t, 1, *asked)
+	assert.FileExists(t, path)
+
+	script, err := renderPreCommit("http://localhost:3284", "REJECT:")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, []byte(script), 0o755))
+	removed, err = uninstallHook(dir, confirm)
+	require.NoError(t, err)
+	assert.True(t, removed)
+	assert.Equal(t, 1, *asked)
+	assert.NoFileExists(t, path)
+}
+
+func TestPromptConfirm(t *testing.T) {
+	for input, expected := range map[string]bool{"y\n": true, "YES\n": true, "n\n": false, "\n": false, "": false, "y": true} {
+		var out strings.Builder
+		ok, err := promptConfirm(strings.NewReader(input), &out)("Overwrite?")
+		require.NoError(t, err)
+		assert.Equal(t, expected, ok, "input %q", input)
+		assert.Equal(t, "Overwrite? [y/N]: ", out.String())
+	}
+}
+
+// TestPreCommitScript runs the hook against a fake server.
+func TestPreCommitScript(t *testing.T) {
+	for _, bin := range []string{"sh", "git", "curl", "jq"} {
+		if _, err := exec.LookPath(bin); err != nil {
+			t.Skipf("%s not found", bin)
+		}
+	}
+
+	var mu sync.Mutex
+	var reply string
+	var prompts []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/v1/message":
+			var body httpapi.MessageRequestBody
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			assert.Equal(t, httpapi.MessageTypeUser, body.Type)
+			prompts = append(prompts, body.Content)
+			_, _ = w.Write([]byte(`{"ok":true}`))
+		case "/v1/status":
+			_, _ = w.Write([]byte(`{"status":"stable"}`))
+		case "/v1/messages":
+			messages := []map[string]string{{"role": "agent", "content": "REJECT: old reply"}}
+			for _, prompt := range prompts {
+				messages = append(messages, map[string]string{"role": "user", "content": prompt})
+				messages = append(messages, map[string]string{"role": "agent", "content": reply})
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{"messages": messages})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	setReply := func(r string) {
+		mu.Lock()
+		defer mu.Unlock()
+		reply = r
+	}
+	sent := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(prompts)
+	}
+
+	repo := t.TempDir()
+	git := func(args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	git("init", "-q")
+	script, err := renderPreCommit(server.URL, "REJECT:")
+	require.NoError(t, err)
+	hook := filepath.Join(t.TempDir(), "pre-commit")
+	require.NoError(t, os.WriteFile(hook, []byte(script), 0o755))
+	runHook := func() error {
+		cmd := exec.Command(hook)
+		cmd.Dir = repo
+		return cmd.Run()
+	}
+
+	// nothing staged
+	assert.NoError(t, runHook())
+	assert.Empty(t, sent())
+
+	require.NoError(t, os.WriteFile(filepath.Join(repo, "main.go"), []byte("package main\n"), 0o644))
+	git("add", "main.go")
+
+	setReply("Looks good to me.")
+	assert.NoError(t, runHook())
+	require.Len(t, sent(), 1)
+	assert.Contains(t, sent()[0], "+package main")
+	assert.Contains(t, sent()[0], "start your reply with REJECT:")
+
+	setReply("REJECT: main is missing a main function.")
+	assert.Error(t, runHook())
+}
@@ -0,0 +1,111 @@
+package hooks
+
+import (
+	"strings"
+	"text/template"
+
+	"golang.org/x/xerrors"
+)
+
+// hookMarker identifies the hooks written by clauder, which can be
+// replaced or removed without asking.
+const hookMarker = "# Installed by `clauder hooks install`."
+
+// preCommitTemplate sends the staged changes to the agent, waits until it
+// has replied, and blocks the commit if the reply contains the keyword.
+// The review is skipped if curl, jq or the server aren't available, so
+// that a stopped server doesn't block every commit.
+var preCommitTemplate = template.Must(template.New("pre-commit").Funcs(template.FuncMap{
+	"quote": shellQuote,
+}).Parse(`#!/bin/sh
+{{.Marker}}
+# Asks the clauder agent to review the staged changes, and blocks the commit
+# if its reply contains the failure keyword. Skip it with --no-verify.
+
+CLAUDER_URL=${CLAUDER_URL:-{{quote .URL}}}
+CLAUDER_KEYWORD=${CLAUDER_KEYWORD:-{{quote .Keyword}}}
+CLAUDER_REVIEW_TIMEOUT=${CLAUDER_REVIEW_TIMEOUT:-600}
+
+for bin in curl jq; do
+	if ! command -v "$bin" >/dev/null 2>&1; then
+		echo "clauder: $bin not found, skipping the review" >&2
+		exit 0
+	fi
+done
+
+diff=$(git diff --cached)
+if [ -z "$diff" ]; then
+	exit 0
+fi
+
+clauder_api() {
+	if [ -n "$CLAUDER_TOKEN" ]; then
+		curl -fsS -H "Authorization: Bearer $CLAUDER_TOKEN" "$@"
+	else
+		curl -fsS "$@"
+	fi
+}
+
+if ! messages=$(clauder_api "$CLAUDER_URL/v1/messages" 2>/dev/null); then
+	echo "clauder: no server at $CLAUDER_URL, skipping the review" >&2
+	exit 0
+fi
+before=$(printf '%s' "$messages" | jq '.messages | length')
+
+prompt="Review the following staged changes before they're committed. If they shouldn't be committed, start your reply with $CLAUDER_KEYWORD and explain why.
+
+$diff"
+echo "clauder: waiting for the agent to review the staged changes..." >&2
+if ! printf '%s' "$prompt" | jq -Rs '{content: ., type: "user"}' |
+	clauder_api -X POST -H "Content-Type: application/json" --data-binary @- "$CLAUDER_URL/v1/message" >/dev/null; then
+	echo "clauder: failed to send the changes to the agent" >&2
+	exit 1
+fi
+
+waited=0
+while :; do
+	sleep 1
+	status=$(clauder_api "$CLAUDER_URL/v1/status" | jq -r '.status')
+	if [ "$status" = "stable" ]; then
+		break
+	fi
+	waited=$((waited + 1))
+	if [ "$waited" -ge "$CLAUDER_REVIEW_TIMEOUT" ]; then
+		echo "clauder: the agent didn't reply within $CLAUDER_REVIEW_TIMEOUT seconds" >&2
+		exit 1
+	fi
+done
+
+reply=$(clauder_api "$CLAUDER_URL/v1/messages" |
+	jq -r --argjson before "$before" '[.messages[$before:][] | select(.role == "agent")] | last | .content // ""')
+case $reply in
+*"$CLAUDER_KEYWORD"*)
+	printf '%s\n' "$reply" >&2
+	echo "clauder: the agent rejected the commit" >&2
+	exit 1
+	;;
+esac
+exit 0
+`))
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// renderPreCommit returns the pre-commit hook that asks the server at url
+// for a review, and rejects commits whose review contains keyword.
+func renderPreCommit(url, keyword string) (string, error) {
+	if strings.TrimSpace(keyword) == "" {
+		return "", xerrors.Errorf("the failure keyword can't be empty")
+	}
+	if strings.ContainsAny(url+keyword, "\r\n") {
+		return "", xerrors.Errorf("the server URL and the failure keyword can't contain line breaks")
+	}
+	var sb strings.Builder
+	err := preCommitTemplate.Execute(&sb, struct{ Marker, URL, Keyword string }{hookMarker, url, keyword})
+	if err != nil {
+		return "", xerrors.Errorf("failed to render the hook: %w", err)
+	}
+	return sb.String(), nil
+}
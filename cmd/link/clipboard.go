@@ -0,0 +1,38 @@
+package link
+
+import (
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// clipboardCommands are the commands that copy their input to the
+// clipboard, in order of preference, by operating system.
+var clipboardCommands = map[string][][]string{
+	"darwin":  {{"pbcopy"}},
+	"windows": {{"clip"}},
+	"linux": {
+		{"wl-copy"},
+		{"xclip", "-selection", "clipboard"},
+		{"xsel", "--clipboard", "--input"},
+	},
+}
+
+// copyToClipboard copies text to the clipboard with the first available
+// clipboard command.
+func copyToClipboard(text string) error {
+	for _, command := range clipboardCommands[runtime.GOOS] {
+		if _, err := exec.LookPath(command[0]); err != nil {
+			continue
+		}
+		cmd := exec.Command(command[0], command[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		if err := cmd.Run(); err != nil {
+			return xerrors.Errorf("%s failed: %w", command[0], err)
+		}
+		return nil
+	}
+	return xerrors.Errorf("no clipboard command found")
+}
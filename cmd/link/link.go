@@ -0,0 +1,110 @@
+package link
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zohaibahmed/clauder/cmd/quickstart"
+	"github.com/zohaibahmed/clauder/lib/httpapi"
+	"github.com/zohaibahmed/clauder/lib/qrcode"
+	"golang.org/x/xerrors"
+)
+
+var remoteUrlArg string
+
+// fetchTunnelURL returns the public URL of the server at serverURL.
+func fetchTunnelURL(ctx context.Context, client *http.Client, serverURL string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(serverURL, "/")+"/v1/health", nil)
+	if err != nil {
+		return "", xerrors.Errorf("failed to create request: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", xerrors.Errorf("failed to reach the server at %s: %w", serverURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", xerrors.Errorf("unexpected status from %s: %s", serverURL, resp.Status)
+	}
+	var health httpapi.HealthBody
+	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
+		return "", xerrors.Errorf("failed to decode health response: %w", err)
+	}
+	if health.TunnelURL == "" {
+		return "", xerrors.Errorf("the server at %s isn't reachable through a tunnel", serverURL)
+	}
+	return health.TunnelURL, nil
+}
+
+// createLink returns a deep link to the running quickstart session, which
+// expires after quickstart.LinkTTL.
+func createLink(ctx context.Context, client *http.Client, serverURL string, sessionFile string, now time.Time) (string, time.Time, error) {
+	session, err := quickstart.ReadSessionFile(sessionFile)
+	if err != nil {
+		return "", time.Time{}, xerrors.Errorf("no quickstart session found, start one with `clauder quickstart`: %w", err)
+	}
+	tunnelURL, err := fetchTunnelURL(ctx, client, serverURL)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	expiresAt := now.Add(quickstart.LinkTTL)
+	return quickstart.GenerateLink(session.Token, tunnelURL, session.Passcode, expiresAt), expiresAt, nil
+}
+
+// printLink prints the link and a QR code of it.
+func printLink(w io.Writer, link string, expiresAt time.Time) error {
+	qr, err := qrcode.Encode([]byte(link))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, qr.String())
+	fmt.Fprintln(w, link)
+	fmt.Fprintf(w, "\nScan the QR code or open the link on another device before %s.\n", expiresAt.Local().Format(time.Kitchen))
+	return nil
+}
+
+var LinkCmd = &cobra.Command{
+	Use:   "link",
+	Short: "Create a link that opens the session on another device",
+	Long: `Create a deep link that opens the running quickstart session on another
+device, and show it as a QR code. The link is copied to the clipboard and
+expires after 15 minutes. Open it with the Clauder app, or pass it to
+'clauder connect' on another computer.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		sessionFile, err := quickstart.DefaultSessionFilePath()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Link failed: %v\n", err)
+			os.Exit(1)
+		}
+		serverURL := remoteUrlArg
+		if !strings.HasPrefix(serverURL, "http://") && !strings.HasPrefix(serverURL, "https://") {
+			serverURL = "http://" + serverURL
+		}
+		link, expiresAt, err := createLink(cmd.Context(), http.DefaultClient, serverURL, sessionFile, time.Now())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Link failed: %v\n", err)
+			os.Exit(1)
+		}
+		if err := printLink(os.Stdout, link, expiresAt); err != nil {
+			fmt.Fprintf(os.Stderr, "Link failed: %v\n", err)
+			os.Exit(1)
+		}
+		if err := copyToClipboard(link); err != nil {
+			fmt.Fprintf(os.Stderr, "Couldn't copy the link to the clipboard: %v\n", err)
+		} else {
+			fmt.Println("📋 Copied the link to the clipboard.")
+		}
+	},
+}
+
+func init() {
+	LinkCmd.Flags().StringVarP(&remoteUrlArg, "url", "u", "localhost:3284", "URL of the local clauder server")
+}
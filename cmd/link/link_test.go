@@ -0,0 +1,52 @@
+package link
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/cmd/quickstart"
+	"github.com/zohaibahmed/clauder/lib/httpapi"
+)
+
+func TestCreateLink(t *testing.T) {
+	tunnelURL := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/health", r.URL.Path)
+		_ = json.NewEncoder(w).Encode(httpapi.HealthBody{Status: "ok", TunnelURL: tunnelURL})
+	}))
+	defer server.Close()
+	sessionFile := filepath.Join(t.TempDir(), "session.json")
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	_, _, err := createLink(ctx, http.DefaultClient, server.URL, sessionFile, now)
+	assert.ErrorContains(t, err, "no quickstart session found")
+
+	_, err = quickstart.WriteSessionFile(sessionFile, quickstart.Session{Passcode: "ABC234", Token: "session-token"})
+	require.NoError(t, err)
+	_, _, err = createLink(ctx, http.DefaultClient, server.URL, sessionFile, now)
+	assert.ErrorContains(t, err, "isn't reachable through a tunnel")
+
+	tunnelURL = "https://abc.lhr.life"
+	link, expiresAt, err := createLink(ctx, http.DefaultClient, server.URL, sessionFile, now)
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(15*time.Minute), expiresAt)
+	l, err := quickstart.ParseLink(link, now)
+	require.NoError(t, err)
+	assert.Equal(t, "https://abc.lhr.life", l.TunnelURL)
+	assert.Equal(t, "ABC234", l.Passcode)
+	assert.NoError(t, l.Verify("session-token"))
+
+	var out bytes.Buffer
+	require.NoError(t, printLink(&out, link, expiresAt))
+	assert.Contains(t, out.String(), "█")
+	assert.Contains(t, out.String(), link)
+}
@@ -0,0 +1,113 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zohaibahmed/clauder/cmd/quickstart"
+	"github.com/zohaibahmed/clauder/cmd/version"
+	"github.com/zohaibahmed/clauder/lib/coordinator"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	"github.com/zohaibahmed/clauder/lib/mcp"
+	"golang.org/x/xerrors"
+)
+
+var (
+	remoteUrlArg string
+	tokenArg     string
+)
+
+// requestTimeout bounds the requests the tools send. Sending a message
+// waits for the agent to start working on it, which can take a while.
+const requestTimeout = 2 * time.Minute
+
+// normalizeURL adds the http scheme to url if it has none, and removes
+// its trailing slash.
+func normalizeURL(url string) string {
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		url = "http://" + url
+	}
+	return strings.TrimRight(url, "/")
+}
+
+// sessionResolver resolves the session IDs the tools are called with. An
+// empty ID is the default session, an http(s) URL is a server that doesn't
+// require authentication unless it's the default session's, and anything
+// else is a passcode looked up on the coordinator.
+func sessionResolver(defaultSession mcp.Session, lookup func(passcode string) (*coordinator.LookupResponse, error)) mcp.SessionResolver {
+	return func(ctx context.Context, sessionID string) (mcp.Session, error) {
+		switch {
+		case sessionID == "":
+			return defaultSession, nil
+		case strings.HasPrefix(sessionID, "http://") || strings.HasPrefix(sessionID, "https://"):
+			url := normalizeURL(sessionID)
+			if url == defaultSession.URL {
+				return defaultSession, nil
+			}
+			return mcp.Session{URL: url}, nil
+		}
+		resp, err := lookup(strings.ToUpper(sessionID))
+		if err != nil {
+			return mcp.Session{}, xerrors.Errorf("failed to look up session %s: %w", sessionID, err)
+		}
+		return mcp.Session{URL: strings.TrimRight(resp.TunnelURL, "/"), Token: resp.Token}, nil
+	}
+}
+
+// defaultToken returns the token of the running quickstart session, if
+// there is one.
+func defaultToken() string {
+	if token := os.Getenv("CLAUDER_TOKEN"); token != "" {
+		return token
+	}
+	path, err := quickstart.DefaultSessionFilePath()
+	if err != nil {
+		return ""
+	}
+	session, err := quickstart.ReadSessionFile(path)
+	if err != nil {
+		return ""
+	}
+	return session.Token
+}
+
+var McpCmd = &cobra.Command{
+	Use:   "mcp",
+	Short: "Expose clauder sessions to other agents as MCP tools",
+	Long: `Start a Model Context Protocol server on stdin and stdout, whose tools send messages to the agents of clauder sessions, and read their screens and files. Add it to Claude Code with:
+
+  claude mcp add clauder -- clauder mcp
+
+The tools use the server at --url unless they're given another session.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		// stdout is the protocol's, so logs go to stderr
+		logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+		ctx := logctx.WithLogger(context.Background(), logger)
+
+		token := tokenArg
+		if token == "" {
+			token = defaultToken()
+		}
+		server := mcp.NewServer("clauder", version.Version)
+		resolve := sessionResolver(mcp.Session{URL: normalizeURL(remoteUrlArg), Token: token}, func(passcode string) (*coordinator.LookupResponse, error) {
+			return coordinator.Lookup(passcode)
+		})
+		mcp.AddClauderTools(server, resolve, &http.Client{Timeout: requestTimeout})
+		if err := server.Serve(ctx, os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "MCP server failed: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	McpCmd.Flags().StringVarP(&remoteUrlArg, "url", "u", "localhost:3284", "URL of the default clauder server")
+	McpCmd.Flags().StringVar(&tokenArg, "token", "", "Token of the default clauder server. Defaults to the CLAUDER_TOKEN environment variable, or the token of the running quickstart session")
+}
@@ -0,0 +1,37 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/coordinator"
+	"github.com/zohaibahmed/clauder/lib/mcp"
+)
+
+func TestSessionResolver(t *testing.T) {
+	defaultSession := mcp.Session{URL: normalizeURL("localhost:3284/"), Token: "local"}
+	assert.Equal(t, "http://localhost:3284", defaultSession.URL)
+	resolve := sessionResolver(defaultSession, func(passcode string) (*coordinator.LookupResponse, error) {
+		if passcode != "ABC234" {
+			return nil, errors.New("lookup failed: session not found")
+		}
+		return &coordinator.LookupResponse{TunnelURL: "https://example.trycloudflare.com/", Token: "remote"}, nil
+	})
+	ctx := context.Background()
+
+	for id, expected := range map[string]mcp.Session{
+		"":                       defaultSession,
+		"http://localhost:3284/": defaultSession,
+		"https://other.example":  {URL: "https://other.example"},
+		"abc234":                 {URL: "https://example.trycloudflare.com", Token: "remote"},
+	} {
+		session, err := resolve(ctx, id)
+		require.NoError(t, err, id)
+		assert.Equal(t, expected, session, id)
+	}
+	_, err := resolve(ctx, "XYZ999")
+	assert.ErrorContains(t, err, "session not found")
+}
@@ -0,0 +1,175 @@
+package quickstart
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/zohaibahmed/clauder/lib/httpapi"
+)
+
+const (
+	// ClipboardPlaceholder is replaced with the clipboard's content in the
+	// clipboard template.
+	ClipboardPlaceholder = "{clipboard}"
+	// DefaultClipboardTemplate is the default of --clipboard-template,
+	// with its line break escaped like on the command line.
+	DefaultClipboardTemplate = `Please review this code:\n` + ClipboardPlaceholder
+	ClipboardPollInterval    = time.Second
+)
+
+// clipboardPasteCommands are the commands that print the clipboard's
+// content, in order of preference, by operating system.
+var clipboardPasteCommands = map[string][][]string{
+	"darwin":  {{"pbpaste"}},
+	"windows": {{"powershell", "-NoProfile", "-Command", "Get-Clipboard -Raw"}},
+	"linux": {
+		{"wl-paste", "--no-newline"},
+		{"xclip", "-selection", "clipboard", "-o"},
+		{"xsel", "--clipboard", "--output"},
+	},
+}
+
+// readClipboard returns the clipboard's content with the first available
+// clipboard command.
+func readClipboard() (string, error) {
+	for _, command := range clipboardPasteCommands[runtime.GOOS] {
+		if _, err := exec.LookPath(command[0]); err != nil {
+			continue
+		}
+		out, err := exec.Command(command[0], command[1:]...).Output()
+		if err != nil {
+			return "", fmt.Errorf("%s failed: %w", command[0], err)
+		}
+		return string(out), nil
+	}
+	return "", fmt.Errorf("no clipboard command found")
+}
+
+// ParseClipboardTemplate returns the template with \n escapes replaced by
+// line breaks, so that they can be passed on the command line.
+func ParseClipboardTemplate(template string) (string, error) {
+	template = strings.ReplaceAll(template, `\n`, "\n")
+	if !strings.Contains(template, ClipboardPlaceholder) {
+		return "", fmt.Errorf("the clipboard template must contain %s", ClipboardPlaceholder)
+	}
+	return template, nil
+}
+
+// looksLikeCode reports whether copied text is worth sending to the agent:
+// it has at least minLength characters, at least 20% of them are printable
+// and not spaces, and it isn't a lone URL.
+func looksLikeCode(text string, minLength int) bool {
+	text = strings.TrimSpace(text)
+	total := utf8.RuneCountInString(text)
+	if total == 0 || total < minLength {
+		return false
+	}
+	visible := 0
+	for _, r := range text {
+		if unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			visible++
+		}
+	}
+	if visible*5 < total {
+		return false
+	}
+	if !strings.ContainsAny(text, " \t\n") {
+		if u, err := url.Parse(text); err == nil && u.Scheme != "" && (u.Host != "" || u.Opaque != "") {
+			return false
+		}
+	}
+	return true
+}
+
+// clipboardWatcher sends new clipboard content to the agent.
+type clipboardWatcher struct {
+	read      func() (string, error)
+	send      func(ctx context.Context, content string) error
+	template  string
+	minLength int
+	logger    *slog.Logger
+
+	// last is the hash of the clipboard's content when it was last read,
+	// and seen is false until it was read once.
+	last [sha256.Size]byte
+	seen bool
+}
+
+// poll reads the clipboard, and sends its content to the agent if it
+// changed since the last poll and looks like code. What was on the
+// clipboard before the first poll isn't sent.
+func (w *clipboardWatcher) poll(ctx context.Context) {
+	text, err := w.read()
+	if err != nil {
+		w.logger.Debug("Failed to read the clipboard", "error", err)
+		return
+	}
+	hash := sha256.Sum256([]byte(text))
+	if hash == w.last {
+		return
+	}
+	first := !w.seen
+	w.last, w.seen = hash, true
+	if first || !looksLikeCode(text, w.minLength) {
+		return
+	}
+	content := strings.ReplaceAll(w.template, ClipboardPlaceholder, strings.TrimSpace(text))
+	if err := w.send(ctx, content); err != nil {
+		w.logger.Warn("Failed to send the clipboard to the agent", "error", err)
+		return
+	}
+	w.logger.Info("📋 Sent the clipboard to the agent", "chars", utf8.RuneCountInString(text))
+}
+
+// run polls the clipboard every interval until ctx is done.
+func (w *clipboardWatcher) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	w.poll(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.poll(ctx)
+		}
+	}
+}
+
+// sendMessage returns a function that sends user messages to the server at
+// serverURL with POST /v1/message.
+func sendMessage(client *http.Client, serverURL, token string) func(ctx context.Context, content string) error {
+	return func(ctx context.Context, content string) error {
+		body, err := json.Marshal(httpapi.MessageRequestBody{Content: content, Type: httpapi.MessageTypeUser})
+		if err != nil {
+			return fmt.Errorf("failed to marshal message: %w", err)
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, serverURL+"/v1/message", bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := client.Do(req)
+		if err != nil {
+			return fmt.Errorf("failed to send message: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("server returned status %d", resp.StatusCode)
+		}
+		return nil
+	}
+}
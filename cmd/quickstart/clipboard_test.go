@@ -0,0 +1,109 @@
+package quickstart
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/httpapi"
+)
+
+const copiedCode = "func add(a, b int) int {\n\treturn a + b\n}\n"
+
+func TestLooksLikeCode(t *testing.T) {
+	for text, expected := range map[string]bool{
+		copiedCode:                         true,
+		"SELECT * FROM users WHERE id = 1": true,
+		"x := 1":                           false,
+		"https://github.com/zohaibahmed/clauder/pull/42": false,
+		"mailto:someone@example.com?subject=hello":       false,
+		"a" + strings.Repeat(" ", 30) + "b":              false,
+		"  " + copiedCode + "\n\n":                       true,
+		"":                                               false,
+	} {
+		assert.Equal(t, expected, looksLikeCode(text, 20), "%q", text)
+	}
+	assert.True(t, looksLikeCode("x := 1", 5))
+}
+
+func TestParseClipboardTemplate(t *testing.T) {
+	template, err := ParseClipboardTemplate(DefaultClipboardTemplate)
+	require.NoError(t, err)
+	assert.Equal(t, "Please review this code:\n{clipboard}", template)
+
+	_, err = ParseClipboardTemplate("Please review this code")
+	assert.ErrorContains(t, err, "{clipboard}")
+}
+
+func TestClipboardWatcher(t *testing.T) {
+	clipboard := "copied before quickstart started"
+	var readErr error
+	var sent []string
+	w := &clipboardWatcher{
+		read: func() (string, error) { return clipboard, readErr },
+		send: func(ctx context.Context, content string) error {
+			sent = append(sent, content)
+			return nil
+		},
+		template:  "Review:\n{clipboard}",
+		minLength: 20,
+		logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	ctx := context.Background()
+
+	w.poll(ctx)
+	assert.Empty(t, sent, "the initial content isn't sent")
+
+	clipboard = copiedCode
+	w.poll(ctx)
+	w.poll(ctx)
+	assert.Equal(t, []string{"Review:\n" + strings.TrimSpace(copiedCode)}, sent, "unchanged content is sent once")
+
+	clipboard = "https://example.com/some/long/path"
+	w.poll(ctx)
+	clipboard = "short"
+	w.poll(ctx)
+	readErr = errors.New("no clipboard command found")
+	clipboard = "def f():\n    return 42\n"
+	w.poll(ctx)
+	assert.Len(t, sent, 1)
+
+	readErr = nil
+	w.poll(ctx)
+	require.Len(t, sent, 2)
+	assert.Equal(t, "Review:\ndef f():\n    return 42", sent[1])
+
+	// copying the same code again after something else sends it again
+	clipboard = copiedCode
+	w.poll(ctx)
+	assert.Len(t, sent, 3)
+}
+
+func TestSendMessage(t *testing.T) {
+	var received httpapi.MessageRequestBody
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/clauder/v1/message", r.URL.Path)
+		if r.Header.Get("Authorization") != "Bearer session-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+
+	send := sendMessage(server.Client(), server.URL+"/clauder", "session-token")
+	require.NoError(t, send(context.Background(), "Review:\n"+copiedCode))
+	assert.Equal(t, httpapi.MessageRequestBody{Content: "Review:\n" + copiedCode, Type: httpapi.MessageTypeUser}, received)
+
+	send = sendMessage(server.Client(), server.URL+"/clauder", "wrong")
+	assert.ErrorContains(t, send(context.Background(), "hi"), "status 401")
+}
@@ -0,0 +1,98 @@
+package quickstart
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// LinkScheme is the URL scheme the Clauder app opens deep links with.
+	LinkScheme = "clauderapp"
+	// LinkTTL is how long a deep link can be used after it's created.
+	LinkTTL = 15 * time.Minute
+)
+
+var passcodeRegex = regexp.MustCompile(`^[ABCDEFGHJKLMNPQRSTUVWXYZ23456789]{6}$`)
+
+// Link is a deep link that continues a session on another device, like
+// clauderapp://session?tunnel=<url>&token=<token>&passcode=<passcode>.
+// The token isn't the session token: it holds the time the link expires
+// at, and an HMAC of the link's values keyed with the session token. A
+// device that looks up the session token with the passcode can tell that
+// the link was created by the session's owner, and wasn't changed.
+type Link struct {
+	TunnelURL string
+	Token     string
+	Passcode  string
+	ExpiresAt time.Time
+}
+
+// linkSignature returns the HMAC-SHA256 of the link's values.
+func linkSignature(sessionToken, tunnelURL, passcode string, expiresAt int64) []byte {
+	mac := hmac.New(sha256.New, []byte(sessionToken))
+	fmt.Fprintf(mac, "%s\n%s\n%d", tunnelURL, passcode, expiresAt)
+	return mac.Sum(nil)
+}
+
+// GenerateLink returns a deep link to the session that expires at
+// expiresAt.
+func GenerateLink(sessionToken, tunnelURL, passcode string, expiresAt time.Time) string {
+	expiry := expiresAt.Unix()
+	signature := linkSignature(sessionToken, tunnelURL, passcode, expiry)
+	query := url.Values{}
+	query.Set("tunnel", tunnelURL)
+	query.Set("token", fmt.Sprintf("%d.%s", expiry, base64.RawURLEncoding.EncodeToString(signature)))
+	query.Set("passcode", passcode)
+	u := url.URL{Scheme: LinkScheme, Host: "session", RawQuery: query.Encode()}
+	return u.String()
+}
+
+// ParseLink parses a deep link created with GenerateLink, and checks that
+// it hasn't expired. Its token can only be verified with the session token,
+// with Verify.
+func ParseLink(link string, now time.Time) (Link, error) {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil {
+		return Link{}, fmt.Errorf("invalid link: %w", err)
+	}
+	if u.Scheme != LinkScheme || u.Host != "session" {
+		return Link{}, fmt.Errorf("invalid link, expected %s://session?...", LinkScheme)
+	}
+	query := u.Query()
+	l := Link{TunnelURL: query.Get("tunnel"), Token: query.Get("token"), Passcode: query.Get("passcode")}
+	tunnel, err := url.Parse(l.TunnelURL)
+	if err != nil || (tunnel.Scheme != "http" && tunnel.Scheme != "https") || tunnel.Host == "" {
+		return Link{}, fmt.Errorf("invalid link, the tunnel %q isn't an http or https URL", l.TunnelURL)
+	}
+	if !passcodeRegex.MatchString(l.Passcode) {
+		return Link{}, fmt.Errorf("invalid link, the passcode %q isn't 6 letters and digits", l.Passcode)
+	}
+	expiry, _, ok := strings.Cut(l.Token, ".")
+	seconds, err := strconv.ParseInt(expiry, 10, 64)
+	if !ok || err != nil {
+		return Link{}, fmt.Errorf("invalid link, malformed token")
+	}
+	l.ExpiresAt = time.Unix(seconds, 0)
+	if !now.Before(l.ExpiresAt) {
+		return Link{}, fmt.Errorf("the link expired at %s, create a new one with `clauder link`", l.ExpiresAt.Local().Format(time.DateTime))
+	}
+	return l, nil
+}
+
+// Verify checks that the link was created with the session token, and
+// that none of its values were changed since.
+func (l Link) Verify(sessionToken string) error {
+	_, encoded, _ := strings.Cut(l.Token, ".")
+	signature, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || !hmac.Equal(signature, linkSignature(sessionToken, l.TunnelURL, l.Passcode, l.ExpiresAt.Unix())) {
+		return fmt.Errorf("the link's signature is invalid, it was changed or isn't for this session")
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package quickstart
+
+import (
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLink(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	expiresAt := now.Add(LinkTTL)
+	link := GenerateLink("session-token", "https://abc.lhr.life", "ABC234", expiresAt)
+	assert.True(t, strings.HasPrefix(link, "clauderapp://session?"), link)
+	assert.NotContains(t, link, "session-token")
+
+	l, err := ParseLink(link, now)
+	require.NoError(t, err)
+	assert.Equal(t, "https://abc.lhr.life", l.TunnelURL)
+	assert.Equal(t, "ABC234", l.Passcode)
+	assert.True(t, expiresAt.Equal(l.ExpiresAt))
+	assert.NoError(t, l.Verify("session-token"))
+	assert.ErrorContains(t, l.Verify("other-token"), "signature is invalid")
+
+	_, err = ParseLink(link, expiresAt)
+	assert.ErrorContains(t, err, "the link expired")
+	_, err = ParseLink(link, expiresAt.Add(-time.Second))
+	assert.NoError(t, err)
+}
+
+func TestLinkTampering(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	link := GenerateLink("session-token", "https://abc.lhr.life", "ABC234", now.Add(LinkTTL))
+	u, err := url.Parse(link)
+	require.NoError(t, err)
+	tamper := func(key, value string) string {
+		query := u.Query()
+		query.Set(key, value)
+		tampered := *u
+		tampered.RawQuery = query.Encode()
+		return tampered.String()
+	}
+	_, signature, _ := strings.Cut(u.Query().Get("token"), ".")
+	later := strconv.FormatInt(now.Add(24*time.Hour).Unix(), 10)
+
+	for name, tampered := range map[string]string{
+		"tunnel":    tamper("tunnel", "https://evil.example.com"),
+		"passcode":  tamper("passcode", "XYZ789"),
+		"expiry":    tamper("token", later+"."+signature),
+		"signature": tamper("token", strconv.FormatInt(now.Add(LinkTTL).Unix(), 10)+".c2lnbmF0dXJl"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			l, err := ParseLink(tampered, now)
+			require.NoError(t, err)
+			assert.ErrorContains(t, l.Verify("session-token"), "signature is invalid")
+		})
+	}
+}
+
+func TestParseLinkErrors(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		link string
+		want string
+	}{
+		{"https://session?tunnel=https://abc.lhr.life", "expected clauderapp://session?..."},
+		{"clauderapp://other?tunnel=https://abc.lhr.life", "expected clauderapp://session?..."},
+		{"clauderapp://session?tunnel=ftp://abc&token=1.a&passcode=ABC234", "isn't an http or https URL"},
+		{"clauderapp://session?tunnel=https://abc.lhr.life&token=1.a&passcode=abc", "isn't 6 letters and digits"},
+		{"clauderapp://session?tunnel=https://abc.lhr.life&token=soon&passcode=ABC234", "malformed token"},
+	} {
+		_, err := ParseLink(tc.link, now)
+		assert.ErrorContains(t, err, tc.want, tc.link)
+	}
+}
+
+func TestSessionFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clauder", "session.json")
+	remove, err := WriteSessionFile(path, Session{Passcode: "ABC234", Token: "tok"})
+	require.NoError(t, err)
+	session, err := ReadSessionFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, Session{Passcode: "ABC234", Token: "tok"}, session)
+	require.NoError(t, remove())
+	_, err = ReadSessionFile(path)
+	assert.Error(t, err)
+}
@@ -4,20 +4,23 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"os"
-	"os/exec"
 	"os/signal"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/zohaibahmed/clauder/cmd/telemetry"
 	"github.com/zohaibahmed/clauder/lib/coordinator"
 	"github.com/zohaibahmed/clauder/lib/httpapi"
 	"github.com/zohaibahmed/clauder/lib/logctx"
 	mf "github.com/zohaibahmed/clauder/lib/msgfmt"
+	"github.com/zohaibahmed/clauder/lib/project"
 	"github.com/zohaibahmed/clauder/lib/termexec"
 	"github.com/zohaibahmed/clauder/lib/tunnel"
+	"golang.org/x/term"
 )
 
 var QuickstartCmd = &cobra.Command{
@@ -29,6 +32,17 @@ var QuickstartCmd = &cobra.Command{
 
 func init() {
 	QuickstartCmd.Flags().IntP("port", "p", 3284, "Port to run the server on")
+	QuickstartCmd.Flags().String("base-path", "", "Serve every endpoint under this path, e.g. /clauder when a reverse proxy mounts the server there")
+	QuickstartCmd.Flags().Bool("clipboard-mode", false, "Send code copied to the clipboard to the agent")
+	QuickstartCmd.Flags().String("clipboard-template", DefaultClipboardTemplate, "Message sent to the agent in clipboard mode, where "+ClipboardPlaceholder+" is replaced with the clipboard's content")
+	QuickstartCmd.Flags().Int("clipboard-min-length", 20, "Minimum number of characters of clipboard content sent to the agent in clipboard mode")
+	QuickstartCmd.Flags().String("direct-url", "", "URL at which this machine's port is reachable from the internet, e.g. https://home.example.com:3284. If a probe service can connect to it, it's used instead of a tunnel")
+	QuickstartCmd.Flags().Bool("allow-insecure-direct", false, "Allow an http --direct-url, over which clients send the session's token in cleartext")
+	QuickstartCmd.Flags().Bool("skip-tunnel-check", false, "Start a tunnel without checking whether --direct-url is reachable from the internet")
+	QuickstartCmd.Flags().Bool("force-tunnel", false, "Start a tunnel even if the port is forwarded or --direct-url is reachable from the internet")
+	QuickstartCmd.Flags().Bool("hash-passcode", false, "Register the HMAC-SHA256 of the passcode with the coordinator instead of the passcode, so that the coordinator never learns it. Lookups need the same secret, e.g. 'clauder connect --hash-passcode' on this machine; the mobile app can't look up hashed passcodes")
+	QuickstartCmd.Flags().String("coordinator-secret", "", "Secret the passcode is hashed with, implies --hash-passcode. Defaults to a secret generated in ~/.clauder/coordinator_key")
+	QuickstartCmd.Flags().Bool("dual-tunnel", false, "Keep a standby tunnel connected, which takes over when the primary tunnel fails its health checks")
 }
 
 func runQuickstart(cmd *cobra.Command, args []string) {
@@ -42,6 +56,51 @@ func runQuickstart(cmd *cobra.Command, args []string) {
 	ctx = logctx.WithLogger(ctx, logger)
 
 	port, _ := cmd.Flags().GetInt("port")
+	basePathArg, _ := cmd.Flags().GetString("base-path")
+	basePath, err := httpapi.NormalizeBasePath(basePathArg)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+	clipboardMode, _ := cmd.Flags().GetBool("clipboard-mode")
+	clipboardTemplateArg, _ := cmd.Flags().GetString("clipboard-template")
+	clipboardTemplate, err := ParseClipboardTemplate(clipboardTemplateArg)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+	clipboardMinLength, _ := cmd.Flags().GetInt("clipboard-min-length")
+	var tunnelOpts []tunnel.ConnectOption
+	directURL, _ := cmd.Flags().GetString("direct-url")
+	allowInsecureDirect, _ := cmd.Flags().GetBool("allow-insecure-direct")
+	if directURL != "" {
+		if _, err := tunnel.ValidateDirectURL(directURL, allowInsecureDirect); err != nil {
+			fmt.Printf("❌ %v. Pass --allow-insecure-direct to use it anyway\n", err)
+			os.Exit(1)
+		}
+		tunnelOpts = append(tunnelOpts, tunnel.WithDirectURL(directURL))
+		if allowInsecureDirect {
+			tunnelOpts = append(tunnelOpts, tunnel.WithPlaintextDirectURL())
+		}
+	}
+	if skip, _ := cmd.Flags().GetBool("skip-tunnel-check"); skip {
+		tunnelOpts = append(tunnelOpts, tunnel.WithSkipReachabilityCheck())
+	}
+	forceTunnel, _ := cmd.Flags().GetBool("force-tunnel")
+	if forceTunnel {
+		tunnelOpts = append(tunnelOpts, tunnel.WithForceTunnel())
+	}
+	dualTunnel, _ := cmd.Flags().GetBool("dual-tunnel")
+	coordinatorOpts, err := passcodeKeyOptions(cmd)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		if err := telemetry.AskOnFirstRun(os.Stdin, os.Stdout); err != nil {
+			logger.Warn("Failed to save the telemetry settings", "error", err)
+		}
+	}
 
 	// Step 1: Generate session credentials
 	session := generateSession()
@@ -59,6 +118,18 @@ func runQuickstart(cmd *cobra.Command, args []string) {
 	// Step 3: Start Clauder server with authentication
 	fmt.Println("🌐 Starting Clauder server with authentication...")
 	server := startAuthenticatedServer(ctx, session.Token, claudeProcess, port)
+	if err := server.SetBasePath(basePath); err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+	// The session token doubles as the admin token, since its holder already
+	// controls the agent.
+	server.EnableAdminShutdown(session.Token, func(context.Context) { cancel() })
+	// the tunnel serves the session over HTTPS
+	server.EnableSecurityHeaders(true)
+	if webhook := os.Getenv("CLAUDER_SLACK_WEBHOOK"); webhook != "" {
+		server.EnableSlackNotifications(ctx, httpapi.NewSlackNotifier(webhook))
+	}
 
 	// Start the server in a goroutine
 	go func() {
@@ -71,23 +142,60 @@ func runQuickstart(cmd *cobra.Command, args []string) {
 	// Wait a moment for server to start
 	time.Sleep(1 * time.Second)
 
-	// Step 4: Check available tunnel providers
-	fmt.Println("🔍 Checking available tunnel providers...")
-	availableProviders := tunnel.CheckAvailableProviders()
-	if len(availableProviders) == 0 {
-		fmt.Println("❌ No tunnel providers found!")
-		fmt.Println("\n📦 Install a tunnel provider:")
-		for provider, instruction := range tunnel.InstallInstructions() {
-			fmt.Printf("   %s: %s\n", provider, instruction)
+	// Write the PID file so that 'clauder stop' can find the server
+	if pidFile, err := httpapi.DefaultPIDFilePath(); err == nil {
+		if removePIDFile, err := httpapi.WritePIDFile(pidFile); err != nil {
+			logger.Warn("Failed to write PID file", "error", err)
+		} else {
+			defer func() {
+				if err := removePIDFile(); err != nil {
+					logger.Error("Failed to remove PID file", "error", err)
+				}
+			}()
 		}
-		os.Exit(1)
 	}
 
-	fmt.Printf("✅ Found tunnel providers: %v\n", availableProviders)
+	// Steps 4 and 5: Check available tunnel providers and establish tunnel,
+	// unless the editor forwards the port already
+	// dual is the dual tunnel, if --dual-tunnel was given and a tunnel is
+	// needed
+	var dual *tunnel.DualTunnel
+	tunnelURL, tunnelProvider, err := publicURL(port, forceTunnel, func() (string, tunnel.TunnelProvider, error) {
+		fmt.Println("🔍 Checking available tunnel providers...")
+		availableProviders := tunnel.CheckAvailableProviders()
+		if len(availableProviders) == 0 {
+			fmt.Println("❌ No tunnel providers found!")
+			fmt.Println("\n📦 Install a tunnel provider:")
+			for provider, instruction := range tunnel.InstallInstructions() {
+				fmt.Printf("   %s: %s\n", provider, instruction)
+			}
+			os.Exit(1)
+		}
 
-	// Step 5: Establish tunnel
-	fmt.Println("🔗 Establishing secure tunnel...")
-	tunnelURL, err := establishTunnel(ctx, port)
+		fmt.Printf("✅ Found tunnel providers: %v\n", availableProviders)
+
+		fmt.Println("🔗 Establishing secure tunnel...")
+		if dualTunnel {
+			dual = tunnel.NewDualTunnel(tunnel.DualTunnelConfig{
+				LocalPort: port,
+				OnURLChange: func(oldURL, newURL string) {
+					fmt.Printf("🔀 Tunnel failed, switched to the standby tunnel: %s\n", newURL)
+					server.FailoverTunnel(oldURL+basePath, newURL+basePath)
+					if err := registerWithCoordinator(session.Passcode, newURL+basePath, session.Token, coordinatorOpts...); err != nil {
+						logger.Error("Failed to register the new tunnel URL", "error", err)
+					}
+				},
+			})
+			tunnelURL, err := dual.Start(ctx)
+			return tunnelURL, dual.PrimaryProvider(), err
+		}
+		var tunnelProvider tunnel.TunnelProvider
+		tunnelOpts = append(tunnelOpts, tunnel.WithProviderCallback(func(provider tunnel.TunnelProvider) {
+			tunnelProvider = provider
+		}))
+		tunnelURL, err := establishTunnel(ctx, port, tunnelOpts...)
+		return tunnelURL, tunnelProvider, err
+	})
 	if err != nil {
 		fmt.Printf("❌ Failed to establish tunnel: %v\n", err)
 		fmt.Println("\n💡 Troubleshooting:")
@@ -96,37 +204,106 @@ func runQuickstart(cmd *cobra.Command, args []string) {
 		fmt.Println("   - Try running the tunnel manually to test")
 		os.Exit(1)
 	}
+	// clients reach the endpoints through the tunnel under the base path
+	tunnelURL += basePath
+	server.SetTunnelURL(tunnelURL)
+	server.SetTunnelInfo(func() httpapi.TunnelInfo {
+		if dual == nil {
+			return httpapi.TunnelInfo{Provider: string(tunnelProvider)}
+		}
+		return tunnelInfo(dual.PrimaryProvider(), dual.ReconnectStatus())
+	})
 
 	// Step 6: Register with coordinator
 	fmt.Println("📋 Registering session with coordinator...")
-	err = registerWithCoordinator(session.Passcode, tunnelURL, session.Token)
+	err = registerWithCoordinator(session.Passcode, tunnelURL, session.Token, coordinatorOpts...)
 	if err != nil {
-		fmt.Printf("❌ Failed to register session: %v\n", err)
-		os.Exit(1)
+		// the server works without the coordinator, only the mobile app
+		// can't find it until the registration goes through
+		fmt.Printf("⚠️  Failed to register session, retrying every %s in the background: %v\n", coordinator.DefaultRegisterRetryInterval, err)
+		go retryRegistration(ctx, server, session.Passcode, session.Token, coordinatorOpts)
+	}
+
+	// Save the session for `clauder link`
+	if sessionFile, err := DefaultSessionFilePath(); err == nil {
+		if removeSessionFile, err := WriteSessionFile(sessionFile, session); err != nil {
+			logger.Warn("Failed to write session file", "error", err)
+		} else {
+			defer func() {
+				if err := removeSessionFile(); err != nil {
+					logger.Error("Failed to remove session file", "error", err)
+				}
+			}()
+		}
 	}
 
 	// Step 7: Display connection info
-	displayConnectionInfo(session.Passcode, tunnelURL, port)
+	displayConnectionInfo(session.Passcode, tunnelURL, tunnelProvider, port, basePath)
 
 	// Step 8: Start snapshot loop
 	server.StartSnapshotLoop(ctx)
+	telemetrySession := telemetry.SessionStart(ctx, string(mf.AgentTypeClaude), string(tunnelProvider))
+	defer telemetrySession.End(ctx)
+
+	if clipboardMode {
+		watcher := &clipboardWatcher{
+			read:      readClipboard,
+			send:      sendMessage(http.DefaultClient, fmt.Sprintf("http://localhost:%d%s", port, basePath), session.Token),
+			template:  clipboardTemplate,
+			minLength: clipboardMinLength,
+			logger:    logger,
+		}
+		go watcher.run(ctx, ClipboardPollInterval)
+		fmt.Println("📋 Clipboard mode: code you copy is sent to Claude")
+	}
 
 	// Step 9: Wait for interrupt
-	waitForInterrupt(ctx, cancel, server)
+	waitForInterrupt(ctx, cancel, server, session.Passcode, coordinatorOpts)
+}
+
+// passcodeKeyOptions returns the options that make the coordinator calls
+// use the passcode's hash, with --hash-passcode or --coordinator-secret.
+func passcodeKeyOptions(cmd *cobra.Command) ([]coordinator.Option, error) {
+	hashPasscode, _ := cmd.Flags().GetBool("hash-passcode")
+	secret, _ := cmd.Flags().GetString("coordinator-secret")
+	if !hashPasscode && secret == "" {
+		return nil, nil
+	}
+	key, err := coordinator.ResolvePasscodeKey(secret)
+	if err != nil {
+		return nil, err
+	}
+	return []coordinator.Option{coordinator.WithPasscodeKey(key)}, nil
 }
 
 func startClaudeCode(ctx context.Context) (*termexec.Process, error) {
 	// Check if claude is available
-	if _, err := exec.LookPath("claude"); err != nil {
-		return nil, fmt.Errorf("claude command not found in PATH. Please install Claude Code first")
+	claude, err := termexec.ResolveBinary("claude", mf.BinarySearchPaths(mf.AgentTypeClaude))
+	if err != nil {
+		return nil, fmt.Errorf("claude command not found in PATH or the usual install directories. Please install Claude Code first")
+	}
+
+	// Run Claude Code in the root of the git repository, if there's one
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get working directory: %w", err)
+	}
+	dir, isGitRoot, err := project.WorkDir(cwd, "", false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the working directory: %w", err)
+	}
+	if isGitRoot {
+		logctx.From(ctx).Info("Running Claude Code in the git repository root", "dir", dir)
 	}
 
 	// Start Claude Code
+	terminal := mf.AgentTerminalDimensions(mf.AgentTypeClaude)
 	process, err := termexec.StartProcess(ctx, termexec.StartProcessConfig{
-		Program:        "claude",
+		Program:        claude,
 		Args:           []string{},
-		TerminalWidth:  120,
-		TerminalHeight: 30,
+		Dir:            dir,
+		TerminalWidth:  terminal.Width,
+		TerminalHeight: terminal.Height,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to start Claude Code: %w", err)
@@ -144,35 +321,93 @@ func startAuthenticatedServer(ctx context.Context, token string, process *termex
 	return server
 }
 
-func establishTunnel(ctx context.Context, localPort int) (string, error) {
-	return tunnel.Connect(ctx, localPort)
+// publicURL returns the URL the server on port is reachable at from the
+// internet, and the provider serving it. In GitHub Codespaces and VS Code
+// Remote sessions, the editor forwards the port already, so its URL is
+// returned without calling connect, unless force is set. Otherwise, connect
+// starts a tunnel.
+func publicURL(port int, force bool, connect func() (string, tunnel.TunnelProvider, error)) (string, tunnel.TunnelProvider, error) {
+	if !force {
+		if provider, ok := tunnel.DetectPortForwarding(); ok {
+			forwarded, err := tunnel.ForwardedURL(provider, port)
+			return forwarded, provider, err
+		}
+	}
+	return connect()
 }
 
-func registerWithCoordinator(passcode, tunnelURL, token string) error {
-	return coordinator.Register(passcode, tunnelURL, token)
+func establishTunnel(ctx context.Context, localPort int, opts ...tunnel.ConnectOption) (string, error) {
+	return tunnel.Connect(ctx, localPort, opts...)
 }
 
-func displayConnectionInfo(passcode, tunnelURL string, port int) {
+// tunnelInfo returns the GET /tunnel/info response of a tunnel of provider
+// in the given reconnection state.
+func tunnelInfo(provider tunnel.TunnelProvider, status tunnel.ReconnectStatus) httpapi.TunnelInfo {
+	info := httpapi.TunnelInfo{
+		Provider:         string(provider),
+		ReconnectAttempt: status.Attempt,
+		ReconnectDelayMs: status.Delay.Milliseconds(),
+		ReconnectCount:   status.Count,
+	}
+	if !status.NextRetryAt.IsZero() {
+		info.NextRetryAt = &status.NextRetryAt
+	}
+	return info
+}
+
+func registerWithCoordinator(passcode, tunnelURL, token string, opts ...coordinator.Option) error {
+	return coordinator.Register(passcode, tunnelURL, token, opts...)
+}
+
+// retryRegistration registers the session with the coordinator in the
+// background, with the tunnel's URL at the time of each attempt, and sends
+// a coordinator_registered event once it succeeds.
+func retryRegistration(ctx context.Context, server *httpapi.Server, passcode, token string, opts []coordinator.Option) {
+	logger := logctx.From(ctx)
+	err := coordinator.RegisterWithRetry(ctx, passcode, server.TunnelURL, token, coordinator.RetryConfig{
+		OnFailure: func(attempt int, err error) {
+			logger.Warn("Failed to register session", "attempt", attempt, "error", err)
+		},
+	}, opts...)
+	if err != nil {
+		if ctx.Err() == nil {
+			fmt.Printf("❌ Gave up registering session: %v\n", err)
+		}
+		return
+	}
+	server.CoordinatorRegistered(passcode)
+}
+
+func displayConnectionInfo(passcode, tunnelURL string, provider tunnel.TunnelProvider, port int, basePath string) {
 	fmt.Println("\n" + strings.Repeat("=", 70))
 	fmt.Println("🎉 Claude Coder is Ready!")
 	fmt.Println(strings.Repeat("=", 70))
 	fmt.Printf("📱 Mobile Passcode: %s\n", passcode)
 	fmt.Printf("🌐 Tunnel URL: %s\n", tunnelURL)
+	switch provider {
+	case tunnel.ProviderCodespaces:
+		// forwarded ports are private to the codespace's owner by default
+		fmt.Println("🔀 Using Codespaces port forwarding, no tunnel is running.")
+		fmt.Printf("   Make the port public for the mobile app: gh codespace ports visibility %d:public -c %s\n", port, os.Getenv("CODESPACE_NAME"))
+	case tunnel.ProviderVSCode:
+		fmt.Println("🔀 Using VS Code port forwarding, no tunnel is running.")
+	}
 	fmt.Printf("💻 Local Port: %d\n", port)
 	fmt.Println(strings.Repeat("-", 70))
 	fmt.Println("📋 Usage Options:")
 	fmt.Println("  📱 MOBILE: Open Claude Coder app and enter passcode: " + passcode)
 	fmt.Println("  🖥️  LAPTOP: In a new terminal, run:")
-	fmt.Printf("             ./out/clauder attach --url localhost:%d\n", port)
+	fmt.Printf("             ./out/clauder attach --url localhost:%d%s\n", port, basePath)
 	fmt.Println(strings.Repeat("-", 70))
 	fmt.Println("💡 You can now use Claude Code from both your laptop and phone!")
 	fmt.Println("💡 The attach command gives you direct terminal access on your laptop.")
+	fmt.Println("💡 Run 'clauder link' for a link and QR code that open this session on another device.")
 	fmt.Println("⏰ Mobile session expires in 24 hours")
 	fmt.Println("🛑 Press Ctrl+C to stop")
 	fmt.Println(strings.Repeat("=", 70) + "\n")
 }
 
-func waitForInterrupt(ctx context.Context, cancel context.CancelFunc, server *httpapi.Server) {
+func waitForInterrupt(ctx context.Context, cancel context.CancelFunc, server *httpapi.Server, passcode string, coordinatorOpts []coordinator.Option) {
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 
@@ -193,5 +428,11 @@ func waitForInterrupt(ctx context.Context, cancel context.CancelFunc, server *ht
 		fmt.Println("✅ Server stopped gracefully")
 	}
 
+	// The tunnel URL is gone once we exit, so the passcode shouldn't
+	// resolve to it anymore.
+	if err := coordinator.Deregister(passcode, coordinatorOpts...); err != nil {
+		fmt.Printf("❌ Failed to deregister session: %v\n", err)
+	}
+
 	cancel()
 }
@@ -0,0 +1,69 @@
+package quickstart
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/coordinator"
+	"github.com/zohaibahmed/clauder/lib/httpapi"
+	"github.com/zohaibahmed/clauder/lib/tunnel"
+)
+
+func TestPublicURL(t *testing.T) {
+	for _, name := range []string{"CODESPACES", "CODESPACE_NAME", "GITHUB_CODESPACES_PORT_FORWARDING_DOMAIN", "VSCODE_INJECTION", "REMOTE_CONTAINERS", "SSH_CONNECTION"} {
+		t.Setenv(name, "")
+	}
+	var registered []coordinator.RegisterRequest
+	coordinatorSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req coordinator.RegisterRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		registered = append(registered, req)
+		_ = json.NewEncoder(w).Encode(coordinator.RegisterResponse{Success: true, Passcode: req.Passcode})
+	}))
+	defer coordinatorSrv.Close()
+	t.Setenv("COORDINATOR_URL", coordinatorSrv.URL)
+	connects := 0
+	connect := func() (string, tunnel.TunnelProvider, error) {
+		connects++
+		return "https://abc.lhr.life", tunnel.ProviderLocal, nil
+	}
+
+	url, provider, err := publicURL(3284, false, connect)
+	require.NoError(t, err)
+	assert.Equal(t, "https://abc.lhr.life", url)
+	assert.Equal(t, tunnel.ProviderLocal, provider)
+	assert.Equal(t, 1, connects)
+
+	// in a codespace, the port forwarded by Codespaces is registered and no
+	// tunnel is started
+	t.Setenv("CODESPACES", "true")
+	t.Setenv("CODESPACE_NAME", "fuzzy-space")
+	t.Setenv("GITHUB_CODESPACES_PORT_FORWARDING_DOMAIN", "app.github.dev")
+	url, provider, err = publicURL(3284, false, connect)
+	require.NoError(t, err)
+	assert.Equal(t, 1, connects)
+	assert.Equal(t, tunnel.ProviderCodespaces, provider)
+	require.NoError(t, registerWithCoordinator("ABC234", url+"/clauder", "session-token"))
+	require.Len(t, registered, 1)
+	assert.Equal(t, "https://fuzzy-space-3284.app.github.dev/clauder", registered[0].TunnelURL)
+	assert.Equal(t, "ABC234", registered[0].Passcode)
+
+	// unless a tunnel is forced
+	url, _, err = publicURL(3284, true, connect)
+	require.NoError(t, err)
+	assert.Equal(t, "https://abc.lhr.life", url)
+	assert.Equal(t, 2, connects)
+}
+
+func TestTunnelInfo(t *testing.T) {
+	assert.Equal(t, httpapi.TunnelInfo{Provider: "localhost.run"}, tunnelInfo(tunnel.ProviderLocal, tunnel.ReconnectStatus{}))
+
+	nextRetryAt := time.Now().Add(4 * time.Second)
+	info := tunnelInfo(tunnel.ProviderBore, tunnel.ReconnectStatus{Attempt: 2, Delay: 4 * time.Second, NextRetryAt: nextRetryAt, Count: 1})
+	assert.Equal(t, httpapi.TunnelInfo{Provider: "bore", ReconnectAttempt: 2, ReconnectDelayMs: 4000, NextRetryAt: &nextRetryAt, ReconnectCount: 1}, info)
+}
@@ -3,13 +3,16 @@ package quickstart
 import (
 	"crypto/rand"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"math/big"
+	"os"
+	"path/filepath"
 )
 
 type Session struct {
-	Passcode string
-	Token    string
+	Passcode string `json:"passcode"`
+	Token    string `json:"token"`
 }
 
 // Character set for passcode generation (uppercase letters and numbers, excluding ambiguous characters)
@@ -46,3 +49,48 @@ func randInt(max int) int {
 	}
 	return int(n.Int64())
 }
+
+// DefaultSessionFilePath returns the path of the file the running
+// quickstart session is saved to, ~/.clauder/session.json.
+func DefaultSessionFilePath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".clauder", "session.json"), nil
+}
+
+// WriteSessionFile saves the session to path, so that other commands like
+// `clauder link` can use it. Only the current user can read the file. The
+// returned function removes it.
+func WriteSessionFile(path string, session Session) (func() error, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create session file directory: %w", err)
+	}
+	data, err := json.Marshal(session)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal session: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return nil, fmt.Errorf("failed to write session file: %w", err)
+	}
+	return func() error {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove session file: %w", err)
+		}
+		return nil
+	}, nil
+}
+
+// ReadSessionFile returns the session saved to path by WriteSessionFile.
+func ReadSessionFile(path string) (Session, error) {
+	var session Session
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return session, fmt.Errorf("failed to read session file: %w", err)
+	}
+	if err := json.Unmarshal(data, &session); err != nil {
+		return session, fmt.Errorf("invalid session file %s: %w", path, err)
+	}
+	return session, nil
+}
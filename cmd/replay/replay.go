@@ -0,0 +1,221 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	sse "github.com/tmaxmax/go-sse"
+	"github.com/zohaibahmed/clauder/lib/httpapi"
+	"golang.org/x/xerrors"
+)
+
+var (
+	remoteUrlArg string
+	tokenArg     string
+	delayArg     time.Duration
+	dryRunArg    bool
+)
+
+// replayer replays conversations to the server at url.
+type replayer struct {
+	client *http.Client
+	url    string
+	token  string
+}
+
+func (r *replayer) newRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, r.url+path, body)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to create request: %w", err)
+	}
+	if r.token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.token)
+	}
+	return req, nil
+}
+
+// subscription reads the replay events.
+type subscription struct {
+	body io.Closer
+	// next returns the next event, and false once the stream ended.
+	next func() (sse.Event, error, bool)
+	stop func()
+}
+
+func (s *subscription) Close() {
+	s.stop()
+	_ = s.body.Close()
+}
+
+// subscribe subscribes to the replay events, and returns once the
+// subscription is active so that none of them are missed.
+func (r *replayer) subscribe(ctx context.Context) (*subscription, error) {
+	req, err := r.newRequest(ctx, http.MethodGet, "/v1/events?topics=replay_progress,replay_complete", nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := r.client.Do(req)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to subscribe to the events: %w", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, xerrors.Errorf("failed to subscribe to the events: unexpected status: %s", res.Status)
+	}
+	// each iteration of the sequence reads with a new parser, so it's
+	// pulled from to keep reading the same stream
+	next, stop := iter.Pull2(iter.Seq2[sse.Event, error](sse.Read(res.Body, nil)))
+	sub := &subscription{body: res.Body, next: next, stop: stop}
+	for {
+		ev, err, ok := sub.next()
+		switch {
+		case !ok:
+			sub.Close()
+			return nil, xerrors.New("the server closed the event stream")
+		case err != nil:
+			sub.Close()
+			return nil, xerrors.Errorf("failed to read the events: %w", err)
+		case ev.Type == "subscribed":
+			return sub, nil
+		}
+	}
+}
+
+// start sends the conversation to POST /replay, and returns the number of
+// user messages that are replayed.
+func (r *replayer) start(ctx context.Context, conversation []byte, delay time.Duration, dryRun bool) (int, error) {
+	query := url.Values{}
+	query.Set("delay_ms", strconv.FormatInt(delay.Milliseconds(), 10))
+	query.Set("dry_run", strconv.FormatBool(dryRun))
+	req, err := r.newRequest(ctx, http.MethodPost, "/v1/replay?"+query.Encode(), bytes.NewReader(conversation))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := r.client.Do(req)
+	if err != nil {
+		return 0, xerrors.Errorf("failed to do request: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusAccepted {
+		var problem struct {
+			Detail string `json:"detail"`
+			Errors []struct {
+				Message  string `json:"message"`
+				Location string `json:"location"`
+			} `json:"errors"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&problem); err != nil || problem.Detail == "" {
+			return 0, xerrors.Errorf("unexpected status: %s", res.Status)
+		}
+		for _, detail := range problem.Errors {
+			problem.Detail += fmt.Sprintf("; %s: %s", detail.Location, detail.Message)
+		}
+		return 0, xerrors.Errorf("the server rejected the conversation: %s", problem.Detail)
+	}
+	var body httpapi.ReplayResponse
+	if err := json.NewDecoder(res.Body).Decode(&body.Body); err != nil {
+		return 0, xerrors.Errorf("failed to decode response: %w", err)
+	}
+	return body.Body.Messages, nil
+}
+
+// runReplay replays the conversation in file, printing the progress to w
+// until the agent responded to every message.
+func runReplay(ctx context.Context, w io.Writer, r *replayer, file string, delay time.Duration, dryRun bool) error {
+	conversation, err := os.ReadFile(file)
+	if err != nil {
+		return xerrors.Errorf("failed to read the conversation: %w", err)
+	}
+	var messages []httpapi.ReplayMessage
+	if err := json.Unmarshal(conversation, &messages); err != nil {
+		return xerrors.Errorf("%s isn't a conversation, i.e. a JSON array of messages with a role and a content: %w", file, err)
+	}
+	if dryRun {
+		count, err := r.start(ctx, conversation, delay, true)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "The conversation is valid, with %d user messages to replay.\n", count)
+		return nil
+	}
+
+	// the events are subscribed to first, so that none are missed
+	sub, err := r.subscribe(ctx)
+	if err != nil {
+		return err
+	}
+	defer sub.Close()
+	count, err := r.start(ctx, conversation, delay, false)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Replaying %d user messages...\n", count)
+	for {
+		ev, err, ok := sub.next()
+		if !ok {
+			return xerrors.New("the server closed the event stream before the replay was complete")
+		}
+		if err != nil {
+			return xerrors.Errorf("failed to read the events: %w", err)
+		}
+		switch ev.Type {
+		case "replay_progress":
+			var progress httpapi.ReplayProgressBody
+			if err := json.Unmarshal([]byte(ev.Data), &progress); err != nil {
+				return xerrors.Errorf("failed to decode event: %w", err)
+			}
+			fmt.Fprintf(w, "Replayed %d/%d messages\n", progress.Sent, progress.Total)
+		case "replay_complete":
+			var complete httpapi.ReplayCompleteBody
+			if err := json.Unmarshal([]byte(ev.Data), &complete); err != nil {
+				return xerrors.Errorf("failed to decode event: %w", err)
+			}
+			if complete.Error != "" {
+				return xerrors.Errorf("the replay stopped after %d/%d messages: %s", complete.Sent, complete.Total, complete.Error)
+			}
+			fmt.Fprintln(w, "Done.")
+			return nil
+		}
+	}
+}
+
+var ReplayCmd = &cobra.Command{
+	Use:   "replay <file>",
+	Short: "Replay a saved conversation to a running server",
+	Long:  `Replay a saved conversation to the agent of a running server, e.g. to check how it responds after a fix. The file is a JSON array of messages like [{"role":"user","content":"...","ts":"..."}]. The user messages are sent one at a time, each once the agent finished responding to the previous one, and the agent's messages are skipped.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		url := remoteUrlArg
+		if !strings.HasPrefix(url, "http") {
+			url = "http://" + url
+		}
+		token := tokenArg
+		if token == "" {
+			token = os.Getenv("CLAUDER_TOKEN")
+		}
+		r := &replayer{client: http.DefaultClient, url: strings.TrimRight(url, "/"), token: token}
+		if err := runReplay(context.Background(), os.Stdout, r, args[0], delayArg, dryRunArg); err != nil {
+			fmt.Fprintf(os.Stderr, "%+v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	ReplayCmd.Flags().StringVarP(&remoteUrlArg, "url", "u", "localhost:3284", "URL of the clauder server. May optionally include a protocol")
+	ReplayCmd.Flags().StringVar(&tokenArg, "token", "", "Token of the clauder server. Defaults to the CLAUDER_TOKEN environment variable")
+	ReplayCmd.Flags().DurationVar(&delayArg, "delay", time.Second, "How long to wait between the messages once the agent finished responding to the previous one")
+	ReplayCmd.Flags().BoolVar(&dryRunArg, "dry-run", false, "Only check that the server accepts the conversation, without sending it")
+}
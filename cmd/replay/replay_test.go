@@ -0,0 +1,85 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/httpapi"
+)
+
+// newMockServer returns a server that accepts conversations with two user
+// messages, and sends the events of replaying them, ending with complete.
+func newMockServer(t *testing.T, complete string) (*httptest.Server, <-chan []byte) {
+	t.Helper()
+	started := make(chan struct{})
+	replayed := make(chan []byte, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/events", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "replay_progress,replay_complete", r.URL.Query().Get("topics"))
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: subscribed\ndata: {}\n\n")
+		w.(http.Flusher).Flush()
+		<-started
+		fmt.Fprint(w, "event: replay_progress\ndata: {\"type\":\"replay_progress\",\"sent\":1,\"total\":2}\n\n")
+		fmt.Fprint(w, "event: replay_progress\ndata: {\"type\":\"replay_progress\",\"sent\":2,\"total\":2}\n\n")
+		fmt.Fprintf(w, "event: replay_complete\ndata: %s\n\n", complete)
+	})
+	mux.HandleFunc("POST /v1/replay", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		assert.Equal(t, "250", r.URL.Query().Get("delay_ms"))
+		body, _ := io.ReadAll(r.Body)
+		var resp httpapi.ReplayResponse
+		resp.Body.Messages = 2
+		resp.Body.DryRun = r.URL.Query().Get("dry_run") == "true"
+		if !resp.Body.DryRun {
+			replayed <- body
+			w.WriteHeader(http.StatusAccepted)
+			defer close(started)
+		}
+		_ = json.NewEncoder(w).Encode(resp.Body)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv, replayed
+}
+
+func TestRunReplay(t *testing.T) {
+	ctx := context.Background()
+	srv, replayed := newMockServer(t, `{"type":"replay_complete","sent":2,"total":2}`)
+	r := &replayer{client: srv.Client(), url: srv.URL, token: "secret"}
+
+	var out bytes.Buffer
+	require.NoError(t, runReplay(ctx, &out, r, "testdata/conversation.json", 250*time.Millisecond, false))
+	assert.Equal(t, "Replaying 2 user messages...\nReplayed 1/2 messages\nReplayed 2/2 messages\nDone.\n", out.String())
+	var conversation []httpapi.ReplayMessage
+	require.NoError(t, json.Unmarshal(<-replayed, &conversation))
+	assert.Len(t, conversation, 4, "the whole conversation is sent")
+
+	out.Reset()
+	require.NoError(t, runReplay(ctx, &out, r, "testdata/conversation.json", 250*time.Millisecond, true))
+	assert.Equal(t, "The conversation is valid, with 2 user messages to replay.\n", out.String())
+}
+
+func TestRunReplayFailure(t *testing.T) {
+	ctx := context.Background()
+	srv, _ := newMockServer(t, `{"type":"replay_complete","sent":1,"total":2,"error":"failed to send message 2: boom"}`)
+	r := &replayer{client: srv.Client(), url: srv.URL, token: "secret"}
+
+	err := runReplay(ctx, io.Discard, r, "testdata/conversation.json", 250*time.Millisecond, false)
+	require.ErrorContains(t, err, "the replay stopped after 1/2 messages: failed to send message 2: boom")
+
+	invalid := t.TempDir() + "/invalid.json"
+	require.NoError(t, os.WriteFile(invalid, []byte(`{"role":"user"}`), 0o644))
+	err = runReplay(ctx, io.Discard, r, invalid, 250*time.Millisecond, false)
+	require.ErrorContains(t, err, "isn't a conversation")
+}
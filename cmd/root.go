@@ -6,15 +6,27 @@ import (
 
 	"github.com/spf13/cobra"
 	"github.com/zohaibahmed/clauder/cmd/attach"
+	"github.com/zohaibahmed/clauder/cmd/config"
+	"github.com/zohaibahmed/clauder/cmd/connect"
+	"github.com/zohaibahmed/clauder/cmd/doctor"
+	"github.com/zohaibahmed/clauder/cmd/hooks"
+	"github.com/zohaibahmed/clauder/cmd/link"
+	"github.com/zohaibahmed/clauder/cmd/mcp"
 	"github.com/zohaibahmed/clauder/cmd/quickstart"
+	"github.com/zohaibahmed/clauder/cmd/replay"
 	"github.com/zohaibahmed/clauder/cmd/server"
+	"github.com/zohaibahmed/clauder/cmd/setup"
+	"github.com/zohaibahmed/clauder/cmd/status"
+	"github.com/zohaibahmed/clauder/cmd/stop"
+	"github.com/zohaibahmed/clauder/cmd/telemetry"
+	"github.com/zohaibahmed/clauder/cmd/version"
 )
 
 var rootCmd = &cobra.Command{
 	Use:     "clauder",
 	Short:   "Clauder CLI",
 	Long:    `Clauder - HTTP API for Claude Code, Goose, Aider, and Codex`,
-	Version: "0.2.3",
+	Version: version.Version,
 }
 
 func Execute() {
@@ -29,4 +41,16 @@ func init() {
 	rootCmd.AddCommand(server.ServerCmd)
 	rootCmd.AddCommand(attach.AttachCmd)
 	rootCmd.AddCommand(quickstart.QuickstartCmd)
+	rootCmd.AddCommand(status.StatusCmd)
+	rootCmd.AddCommand(stop.StopCmd)
+	rootCmd.AddCommand(doctor.DoctorCmd)
+	rootCmd.AddCommand(version.VersionCmd)
+	rootCmd.AddCommand(config.ConfigCmd)
+	rootCmd.AddCommand(setup.SetupCmd)
+	rootCmd.AddCommand(connect.ConnectCmd)
+	rootCmd.AddCommand(link.LinkCmd)
+	rootCmd.AddCommand(hooks.HooksCmd)
+	rootCmd.AddCommand(mcp.McpCmd)
+	rootCmd.AddCommand(telemetry.TelemetryCmd)
+	rootCmd.AddCommand(replay.ReplayCmd)
 }
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/zohaibahmed/clauder/lib/config"
+	"github.com/zohaibahmed/clauder/lib/httpapi"
+	"github.com/zohaibahmed/clauder/lib/termexec"
+	"golang.org/x/xerrors"
+)
+
+// logLevel is the level of the server's logs. The log_level key of the
+// config file changes it when the config is reloaded.
+var logLevel slog.LevelVar
+
+// reloadableConfig are the settings that the config file can change while
+// the server is running.
+type reloadableConfig struct {
+	logLevel    slog.Level
+	corsOrigins []string
+	writeLimit  termexec.WriteRateLimiter
+}
+
+// newReloadableConfig returns the reloadable settings of cfg, or an error
+// if one of them is invalid. Keys that aren't set in cfg keep the values of
+// the command line flags.
+func newReloadableConfig(cfg config.Config) (reloadableConfig, error) {
+	rc := reloadableConfig{
+		logLevel:    slog.LevelInfo,
+		corsOrigins: cfg.CORSOrigins,
+		writeLimit: termexec.WriteRateLimiter{
+			RateCharsPerSecond: ptyRateLimit,
+			BurstChars:         ptyBurst,
+		},
+	}
+	if logBodies {
+		rc.logLevel = slog.LevelDebug
+	}
+	if cfg.LogLevel != "" {
+		level, err := config.ParseLogLevel(cfg.LogLevel)
+		if err != nil {
+			return reloadableConfig{}, err
+		}
+		rc.logLevel = level
+	}
+	if err := config.ValidateCORSOrigins(cfg.CORSOrigins); err != nil {
+		return reloadableConfig{}, err
+	}
+	if cfg.PTYRateLimit != 0 {
+		rc.writeLimit.RateCharsPerSecond = cfg.PTYRateLimit
+	}
+	if cfg.PTYBurst != 0 {
+		rc.writeLimit.BurstChars = cfg.PTYBurst
+	}
+	if err := rc.writeLimit.Validate(); err != nil {
+		return reloadableConfig{}, xerrors.Errorf("invalid pty_rate_limit or pty_burst: %w", err)
+	}
+	return rc, nil
+}
+
+// configReloader applies the config file at path to the server and the
+// agent's process every time the server receives SIGHUP.
+type configReloader struct {
+	path    string
+	logger  *slog.Logger
+	srv     *httpapi.Server
+	process *termexec.Process
+	// started is the config the server started with. The keys that are
+	// only read when the server starts are compared against it.
+	started config.Config
+}
+
+// load reads the config file and validates its reloadable settings.
+func (r *configReloader) load() (config.Config, reloadableConfig, error) {
+	cfg, _, err := config.Load(r.path, os.Getenv)
+	if err != nil {
+		return config.Config{}, reloadableConfig{}, err
+	}
+	rc, err := newReloadableConfig(cfg)
+	if err != nil {
+		return config.Config{}, reloadableConfig{}, xerrors.Errorf("%s: %w", r.path, err)
+	}
+	return cfg, rc, nil
+}
+
+// apply applies the reloadable settings. Requests and writes to the agent
+// that start afterwards use them.
+func (r *configReloader) apply(rc reloadableConfig) error {
+	if err := r.process.SetWriteRateLimiter(rc.writeLimit); err != nil {
+		return xerrors.Errorf("failed to set the PTY rate limit: %w", err)
+	}
+	r.srv.SetCORSOrigins(rc.corsOrigins)
+	logLevel.Set(rc.logLevel)
+	return nil
+}
+
+// reload reads and validates the config file, then applies the reloadable
+// settings. Nothing is applied if the config is invalid. Changed keys that
+// are only read when the server starts are logged and otherwise ignored.
+func (r *configReloader) reload() error {
+	cfg, rc, err := r.load()
+	if err != nil {
+		return err
+	}
+	for _, key := range config.RestartKeys(r.started, cfg) {
+		r.logger.Warn("Config key requires restart, ignoring it", "key", key)
+	}
+	return r.apply(rc)
+}
+
+// watch reloads the config every time the server receives SIGHUP, until
+// ctx is done. Invalid configs are logged and leave the settings as they
+// were.
+func (r *configReloader) watch(ctx context.Context) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-signals:
+				if err := r.reload(); err != nil {
+					r.logger.Error("Failed to reload config", "error", err)
+					continue
+				}
+				r.logger.Info("Reloaded config", "path", r.path, "log_level", logLevel.Level())
+			}
+		}
+	}()
+}
@@ -0,0 +1,138 @@
+//go:build !windows
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/config"
+	"github.com/zohaibahmed/clauder/lib/httpapi"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	"github.com/zohaibahmed/clauder/lib/termexec"
+)
+
+// syncBuffer is a bytes.Buffer that can be written to concurrently.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestConfigReload(t *testing.T) {
+	t.Cleanup(func() { logLevel.Set(slog.LevelInfo) })
+	var logs syncBuffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: &logLevel}))
+	ctx, cancel := context.WithCancel(logctx.WithLogger(context.Background(), logger))
+	defer cancel()
+
+	process, err := termexec.StartProcess(ctx, termexec.StartProcessConfig{
+		Program:        "sh",
+		Args:           []string{"-c", "cat > /dev/null"},
+		TerminalWidth:  80,
+		TerminalHeight: 24,
+	})
+	require.NoError(t, err)
+	defer process.Close(logger, time.Second)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := listener.Addr().(*net.TCPAddr).Port
+	require.NoError(t, listener.Close())
+	srv := httpapi.NewServer(ctx, AgentTypeCustom, process, port, "/chat")
+	go func() { _ = srv.Start() }()
+	defer srv.Stop(ctx)
+
+	// allowedOrigin returns the Access-Control-Allow-Origin header of a
+	// request from origin
+	allowedOrigin := func(origin string) string {
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://127.0.0.1:%d/status", port), nil)
+		require.NoError(t, err)
+		req.Header.Set("Origin", origin)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		return resp.Header.Get("Access-Control-Allow-Origin")
+	}
+	require.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+		if err == nil {
+			_ = conn.Close()
+		}
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	// writeDuration returns how long writing 300 characters to the agent
+	// takes
+	writeDuration := func() time.Duration {
+		start := time.Now()
+		_, err := process.Write([]byte(strings.Repeat("a", 300)))
+		require.NoError(t, err)
+		return time.Since(start)
+	}
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	reloader := &configReloader{path: path, logger: logger, srv: srv, process: process, started: config.Default()}
+	reloader.watch(ctx)
+	assert.Equal(t, "*", allowedOrigin("https://other.example.com"), "any origin is allowed by default")
+	assert.Less(t, writeDuration(), 100*time.Millisecond)
+
+	require.NoError(t, os.WriteFile(path, []byte("port: 8080\nlog_level: warn\ncors_origins: [https://app.example.com]\npty_rate_limit: 1000\npty_burst: 100\n"), 0o600))
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGHUP))
+	require.Eventually(t, func() bool { return logLevel.Level() == slog.LevelWarn }, 5*time.Second, 10*time.Millisecond)
+	assert.Empty(t, allowedOrigin("https://other.example.com"))
+	assert.Equal(t, "https://app.example.com", allowedOrigin("https://app.example.com"))
+	assert.GreaterOrEqual(t, writeDuration(), 150*time.Millisecond, "200 characters over the burst take 200ms")
+	assert.Contains(t, logs.String(), `msg="Config key requires restart, ignoring it" key=port`)
+
+	// an invalid config leaves the settings as they were
+	require.NoError(t, os.WriteFile(path, []byte("log_level: verbose\ncors_origins: [https://other.example.com]\n"), 0o600))
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGHUP))
+	require.Eventually(t, func() bool {
+		return strings.Contains(logs.String(), `invalid log level \"verbose\"`)
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, slog.LevelWarn, logLevel.Level())
+	assert.Empty(t, allowedOrigin("https://other.example.com"))
+}
+
+func TestNewReloadableConfig(t *testing.T) {
+	ptyRateLimit, ptyBurst = 500, 0
+	t.Cleanup(func() { ptyRateLimit, ptyBurst = 0, 0 })
+
+	rc, err := newReloadableConfig(config.Config{})
+	require.NoError(t, err)
+	assert.Equal(t, reloadableConfig{logLevel: slog.LevelInfo, writeLimit: termexec.WriteRateLimiter{RateCharsPerSecond: 500}}, rc, "the flags apply without a config")
+
+	rc, err = newReloadableConfig(config.Config{LogLevel: "error", PTYBurst: 50})
+	require.NoError(t, err)
+	assert.Equal(t, slog.LevelError, rc.logLevel)
+	assert.Equal(t, termexec.WriteRateLimiter{RateCharsPerSecond: 500, BurstChars: 50}, rc.writeLimit)
+
+	_, err = newReloadableConfig(config.Config{PTYRateLimit: -1})
+	assert.ErrorContains(t, err, "invalid pty_rate_limit or pty_burst")
+	_, err = newReloadableConfig(config.Config{CORSOrigins: []string{"app.example.com"}})
+	assert.ErrorContains(t, err, "invalid CORS origin")
+}
@@ -4,17 +4,36 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"maps"
 	"net/http"
 	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"regexp"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/joho/godotenv"
+	"github.com/pion/webrtc/v4"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 	"golang.org/x/xerrors"
 
+	"github.com/zohaibahmed/clauder/cmd/telemetry"
+	"github.com/zohaibahmed/clauder/lib/config"
+	"github.com/zohaibahmed/clauder/lib/coordinator"
+	"github.com/zohaibahmed/clauder/lib/daemon"
 	"github.com/zohaibahmed/clauder/lib/httpapi"
 	"github.com/zohaibahmed/clauder/lib/logctx"
 	"github.com/zohaibahmed/clauder/lib/msgfmt"
+	"github.com/zohaibahmed/clauder/lib/notify"
+	"github.com/zohaibahmed/clauder/lib/project"
+	st "github.com/zohaibahmed/clauder/lib/screentracker"
 	"github.com/zohaibahmed/clauder/lib/termexec"
 )
 
@@ -23,8 +42,103 @@ var (
 	port         int
 	printOpenAPI bool
 	chatBasePath string
+	basePath     string
 	termWidth    uint16
 	termHeight   uint16
+	jsonMode     bool
+	jsonStdout   bool
+	// watchdogRestart makes the server exit when the watchdog detects a
+	// stuck component, so that a supervisor can restart it.
+	watchdogRestart   bool
+	responseCacheTTL  time.Duration
+	enableWebRTC      bool
+	iceServers        []string
+	contextWindow     int
+	messageQueueDepth int
+	unixSocket        string
+	adminToken        string
+	enableWorkspaces  bool
+	ttfbWarning       time.Duration
+	snapshotPoll      time.Duration
+	slackWebhook      string
+	vapidSubject      string
+	desktopNotify     bool
+	recordingsDir     string
+	ptyRateLimit      float64
+	ptyBurst          int
+	nicePriority      int
+	ioPriorityClass   string
+	workdir           string
+	// workdirGitRoot requires the agent to run in the root of the git
+	// repository the server is started in.
+	workdirGitRoot bool
+	// sandbox is the termexec.SandboxLevel of the agent.
+	sandbox          string
+	sandboxAllowExec []string
+	preinject        []string
+	preinjectDelay   time.Duration
+	// healthCheckURL is the agent's HTTP health endpoint, checked before
+	// the server starts, within startupTimeout.
+	healthCheckURL string
+	startupTimeout time.Duration
+	// keepaliveInterval is how long the agent can go without a user
+	// message before keepaliveMsg is sent to it. 0 disables keepalives.
+	keepaliveInterval time.Duration
+	keepaliveMsg      string
+	// logBodies logs the HTTP bodies, which makes the server log at the
+	// debug level.
+	logBodies    bool
+	logBodyBytes int
+	// noSecurityHeaders turns off the security headers, to test the chat
+	// UI from other origins or in a frame.
+	noSecurityHeaders bool
+	sloP95            int
+	sloErrorRate      float64
+	sloWebhooks       []string
+	// ptyLog is the file the agent's terminal output is logged to.
+	ptyLog string
+	// termType and colorProfile set the agent's TERM and COLORTERM.
+	termType     string
+	colorProfile string
+	// strictVersion stops the server if the agent's version isn't
+	// supported, instead of logging a warning.
+	strictVersion bool
+	// background runs the server as a daemon, detached from the terminal.
+	background bool
+	// suppressPatterns and suppressNoise drop lines from the line events.
+	suppressPatterns []string
+	suppressNoise    bool
+	// autoResize adjusts the width of the agent's terminal to its output.
+	autoResize bool
+	// workspacePool is the number of workspace agents started ahead of
+	// time, and workspaceWarmupProbe the command run before each one.
+	workspacePool        int
+	workspaceWarmupProbe string
+	// workspaceLazyStart starts the agents of workspaces on their first
+	// message.
+	workspaceLazyStart bool
+	// configFile is the config file whose reloadable settings override
+	// the flags.
+	configFile string
+	// listenTCP is false if only --unix-socket was given, without --port.
+	listenTCP bool
+	// ptyBatchWrites batches the input written to the agent's terminal.
+	ptyBatchWrites bool
+	// sseMaxEventsPerSecond limits the line events sent to each client.
+	sseMaxEventsPerSecond float64
+	// sseDedupTTL suppresses the line events that repeat the previous line.
+	sseDedupTTL time.Duration
+	// sseWriteTimeout closes the connections of clients that stopped reading.
+	sseWriteTimeout time.Duration
+	// slashCommands runs the messages like /resize 200 50 on the server.
+	slashCommands bool
+	// eventLog is the SQLite database the workspaces' events are logged to.
+	eventLog string
+	// adaptiveSnapshots polls the conversation less often while the
+	// POST /message latency exceeds --slo-p95-ms.
+	adaptiveSnapshots bool
+	// pushSnapshot sends new clients of GET /events the agent's screen.
+	pushSnapshot bool
 )
 
 type AgentType = msgfmt.AgentType
@@ -34,44 +148,127 @@ const (
 	AgentTypeGoose  AgentType = msgfmt.AgentTypeGoose
 	AgentTypeAider  AgentType = msgfmt.AgentTypeAider
 	AgentTypeCodex  AgentType = msgfmt.AgentTypeCodex
+	AgentTypeGemini AgentType = msgfmt.AgentTypeGemini
 	AgentTypeCustom AgentType = msgfmt.AgentTypeCustom
 )
 
+// parseAgentType returns the agent type set with --type, or else the one
+// named by the program, falling back to the custom agent type. Agent types
+// are valid if a formatter is registered for them in msgfmt.DefaultRegistry.
 func parseAgentType(firstArg string, agentTypeVar string) (AgentType, error) {
-	var agentType AgentType
-	switch agentTypeVar {
-	case string(AgentTypeClaude):
-		agentType = AgentTypeClaude
-	case string(AgentTypeGoose):
-		agentType = AgentTypeGoose
-	case string(AgentTypeAider):
-		agentType = AgentTypeAider
-	case string(AgentTypeCustom):
-		agentType = AgentTypeCustom
-	case string(AgentTypeCodex):
-		agentType = AgentTypeCodex
-	case "":
-		// do nothing
-	default:
-		return "", fmt.Errorf("invalid agent type: %s", agentTypeVar)
+	if agentTypeVar != "" {
+		if _, ok := msgfmt.DefaultRegistry.Lookup(agentTypeVar); !ok {
+			return "", fmt.Errorf("invalid agent type: %s (registered agent types: %s)", agentTypeVar, strings.Join(msgfmt.DefaultRegistry.AgentTypes(), ", "))
+		}
+		return AgentType(agentTypeVar), nil
 	}
-	if agentType != "" {
-		return agentType, nil
+	if _, ok := msgfmt.DefaultRegistry.Lookup(firstArg); ok {
+		return AgentType(firstArg), nil
 	}
+	return AgentTypeCustom, nil
+}
 
-	switch firstArg {
-	case string(AgentTypeClaude):
-		agentType = AgentTypeClaude
-	case string(AgentTypeGoose):
-		agentType = AgentTypeGoose
-	case string(AgentTypeAider):
-		agentType = AgentTypeAider
-	case string(AgentTypeCodex):
-		agentType = AgentTypeCodex
-	default:
-		agentType = AgentTypeCustom
+// checkAgentEnv returns an error if the environment variables the agent
+// needs to authenticate aren't set, so that the server doesn't start an
+// agent that can only show a login prompt.
+func checkAgentEnv(agentType AgentType, getenv func(string) string) error {
+	if agentType == AgentTypeGemini && getenv("GEMINI_API_KEY") == "" && getenv("GOOGLE_CLOUD_PROJECT") == "" {
+		return xerrors.Errorf("GEMINI_API_KEY or GOOGLE_CLOUD_PROJECT must be set for the gemini agent type")
+	}
+	return nil
+}
+
+// agentVersionTimeout is how long the agent's --version flag may take.
+const agentVersionTimeout = 10 * time.Second
+
+// checkAgentVersion runs program with --version, and returns an error if
+// the version is outside of the versions the formatters of agentType were
+// written for, see msgfmt.AgentVersionConstraint, or if it can't be
+// determined. Custom agents aren't checked.
+func checkAgentVersion(ctx context.Context, agentType AgentType, program string) error {
+	constraint := msgfmt.AgentVersionConstraint(agentType)
+	if constraint == "" {
+		return nil
+	}
+	path, err := termexec.ResolveBinary(program, msgfmt.BinarySearchPaths(agentType))
+	if err != nil {
+		return xerrors.Errorf("failed to find %s: %w", program, err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, agentVersionTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, path, "--version").Output()
+	if err != nil {
+		return xerrors.Errorf("failed to run %s --version: %w", program, err)
 	}
-	return agentType, nil
+	version, err := msgfmt.ParseAgentVersion(string(output))
+	if err != nil {
+		return xerrors.Errorf("failed to parse the version of %s: %w", program, err)
+	}
+	ok, err := msgfmt.CheckVersionConstraint(version, constraint)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return xerrors.Errorf("%s %s isn't a supported version (%s), so its messages may not be formatted correctly", program, version, constraint)
+	}
+	return nil
+}
+
+// agentEnvFile holds environment variables, e.g. API keys, that are only
+// set for the agent, unlike those in .env, which are loaded into the
+// server's own environment.
+const agentEnvFile = ".env.agent"
+
+// loadAgentEnv reads the environment variables of the agent from the
+// dotenv file at path. It's read rather than loaded with os.Setenv, so
+// that the variables don't end up in the server's environment. A missing
+// file holds no variables.
+func loadAgentEnv(path string) (map[string]string, error) {
+	env, err := godotenv.Read(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("failed to read %s: %w", path, err)
+	}
+	if err := termexec.ValidateEnv(env); err != nil {
+		return nil, xerrors.Errorf("invalid %s: %w", path, err)
+	}
+	return env, nil
+}
+
+// outputFilter returns the filter of --suppress-pattern and
+// --suppress-noise, or nil if neither is set.
+func outputFilter(patterns []string, noise bool) (*st.OutputFilter, error) {
+	var compiled []*regexp.Regexp
+	if noise {
+		compiled = append(compiled, st.DefaultSuppressPatterns...)
+	}
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, xerrors.Errorf("invalid --suppress-pattern %q: %w", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	if len(compiled) == 0 {
+		return nil, nil
+	}
+	return st.NewOutputFilter(compiled), nil
+}
+
+// terminalDimensions returns the size of the terminal of an agent of the
+// given type: --terminal-width and --terminal-height, or the agent's
+// defaults for the ones that weren't given.
+func terminalDimensions(agentType msgfmt.AgentType) msgfmt.TerminalDimensions {
+	dimensions := msgfmt.AgentTerminalDimensions(agentType)
+	if termWidth != 0 {
+		dimensions.Width = termWidth
+	}
+	if termHeight != 0 {
+		dimensions.Height = termHeight
+	}
+	return dimensions
 }
 
 func runServer(ctx context.Context, logger *slog.Logger, argsToPass []string) error {
@@ -81,38 +278,454 @@ func runServer(ctx context.Context, logger *slog.Logger, argsToPass []string) er
 		return xerrors.Errorf("failed to parse agent type: %w", err)
 	}
 
-	if termWidth < 10 {
-		return xerrors.Errorf("term width must be at least 10")
+	if termWidth != 0 && termWidth < 10 {
+		return xerrors.Errorf("terminal width must be at least 10")
 	}
-	if termHeight < 10 {
-		return xerrors.Errorf("term height must be at least 10")
+	if termHeight != 0 && termHeight < 10 {
+		return xerrors.Errorf("terminal height must be at least 10")
+	}
+	terminal := terminalDimensions(agentType)
+
+	normalizedBasePath, err := httpapi.NormalizeBasePath(basePath)
+	if err != nil {
+		return xerrors.Errorf("failed to parse --base-path: %w", err)
+	}
+	// the chat interface is served under the base path too
+	if chatBasePath == "/chat" {
+		chatBasePath = normalizedBasePath + "/chat"
+	}
+
+	agentEnv, err := loadAgentEnv(agentEnvFile)
+	if err != nil {
+		return err
+	}
+	if !printOpenAPI {
+		getenv := func(key string) string {
+			if value, ok := agentEnv[key]; ok {
+				return value
+			}
+			return os.Getenv(key)
+		}
+		if err := checkAgentEnv(agentType, getenv); err != nil {
+			return err
+		}
+		if err := checkAgentVersion(ctx, agentType, agent); err != nil {
+			if strictVersion {
+				return err
+			}
+			logger.Warn("Failed to check the agent's version", "error", err)
+		}
+	}
+
+	programArgs := argsToPass[1:]
+	var jsonEventParser *st.JSONEventParser
+	if jsonMode {
+		if agentType != AgentTypeClaude {
+			return xerrors.Errorf("json mode is only supported for the claude agent type")
+		}
+		programArgs = append(programArgs, "--output-format", "json")
+		if !jsonStdout {
+			jsonEventParser = st.NewJSONEventParser(1024)
+		}
+	}
+	// stdoutJSONParser reads the agent's standard output, which the process
+	// writes to stdoutWriter, with --json-stdout
+	var stdoutJSONParser *st.StdoutJSONParser
+	var stdoutWriter io.Writer
+	if jsonStdout && !printOpenAPI {
+		pr, pw := io.Pipe()
+		stdoutJSONParser = st.NewStdoutJSONParser(pr, 1024)
+		stdoutWriter = pw
+	}
+
+	// lineEmitter sends the lines the agent prints to GET /events?mode=lines
+	lineEmitter := st.NewLineEmitter(1024)
+	filter, err := outputFilter(suppressPatterns, suppressNoise)
+	if err != nil {
+		return err
+	}
+	if filter != nil {
+		httpapi.CountSuppressedLines(filter)
+		lineEmitter.SetFilter(filter)
+	}
+
+	// resizer picks the width of the agent's terminal with --auto-resize
+	var resizer *st.AutoResizer
+	if autoResize {
+		resizer = st.NewAutoResizer(int(terminal.Width))
+	}
+
+	var ptyOutput *httpapi.PTYBroadcaster
+	if enableWebRTC {
+		ptyOutput = httpapi.NewPTYBroadcaster(4096)
 	}
 
 	var process *termexec.Process
+	// agentDir is the agent's working directory, which GET /files lists
+	var agentDir string
 	if printOpenAPI {
 		process = nil
 	} else {
-		process, err = httpapi.SetupProcess(ctx, httpapi.SetupProcessConfig{
-			Program:        agent,
-			ProgramArgs:    argsToPass[1:],
-			TerminalWidth:  termWidth,
-			TerminalHeight: termHeight,
-		})
+		cwd, err := os.Getwd()
+		if err != nil {
+			return xerrors.Errorf("failed to get working directory: %w", err)
+		}
+		dir, isGitRoot, err := project.WorkDir(cwd, workdir, workdirGitRoot)
+		if err != nil {
+			return xerrors.Errorf("failed to find the agent's working directory: %w", err)
+		}
+		if isGitRoot {
+			logger.Info("Running the agent in the git repository root", "dir", dir)
+		}
+		agentDir = dir
+		setupConfig := httpapi.SetupProcessConfig{
+			Program:     agent,
+			ProgramArgs: programArgs,
+			// the agent may not be in the PATH of a service
+			BinarySearchPaths: msgfmt.BinarySearchPaths(agentType),
+			Dir:               dir,
+			TerminalWidth:     terminal.Width,
+			TerminalHeight:    terminal.Height,
+			WriteRateLimiter: termexec.WriteRateLimiter{
+				RateCharsPerSecond: ptyRateLimit,
+				BurstChars:         ptyBurst,
+			},
+			BatchWrites:          ptyBatchWrites,
+			NicePriority:         nicePriority,
+			IOPriorityClass:      ioPriorityClass,
+			Sandbox:              termexec.SandboxLevel(sandbox),
+			SandboxExecAllowlist: sandboxAllowExec,
+			PreinjectLines:       preinject,
+			PreinjectDelay:       preinjectDelay,
+			Env:                  agentEnv,
+			TermType:             termType,
+			ColorProfile:         colorProfile,
+		}
+		if healthCheckURL != "" {
+			setupConfig.HealthCheck = &termexec.HealthCheckConfig{URL: healthCheckURL}
+			setupConfig.StartupTimeout = startupTimeout
+		}
+		if ptyLog != "" {
+			if setupConfig.LogFile, err = expandHome(ptyLog); err != nil {
+				return xerrors.Errorf("failed to resolve PTY log path: %w", err)
+			}
+		}
+		outputs := []io.Writer{lineEmitter}
+		if jsonEventParser != nil {
+			outputs = append(outputs, jsonEventParser)
+		}
+		if ptyOutput != nil {
+			outputs = append(outputs, ptyOutput)
+		}
+		if resizer != nil {
+			outputs = append(outputs, resizer)
+		}
+		setupConfig.Output = io.MultiWriter(outputs...)
+		setupConfig.Stdout = stdoutWriter
+		process, err = httpapi.SetupProcess(ctx, setupConfig)
 		if err != nil {
 			return xerrors.Errorf("failed to setup process: %w", err)
 		}
 	}
 	srv := httpapi.NewServer(ctx, agentType, process, port, chatBasePath)
+	if err := srv.SetBasePath(normalizedBasePath); err != nil {
+		return xerrors.Errorf("failed to set base path: %w", err)
+	}
 	if printOpenAPI {
 		fmt.Println(srv.GetOpenAPI())
 		return nil
 	}
+	// the reloadable settings of the config file override the flags, and
+	// are read again on SIGHUP
+	reloader := &configReloader{path: configFile, logger: logger, srv: srv, process: process}
+	if reloader.path == "" {
+		if reloader.path, err = config.DefaultPath(); err != nil {
+			return xerrors.Errorf("failed to resolve config path: %w", err)
+		}
+	}
+	started, reloadable, err := reloader.load()
+	if err != nil {
+		if configFile != "" {
+			return xerrors.Errorf("failed to load config: %w", err)
+		}
+		logger.Warn("Ignoring the config file", "error", err)
+		started = config.Default()
+		if reloadable, err = newReloadableConfig(config.Config{}); err != nil {
+			return err
+		}
+	}
+	reloader.started = started
+	if err := reloader.apply(reloadable); err != nil {
+		return err
+	}
+	reloader.watch(ctx)
+	if ptyOutput != nil {
+		srv.EnableWebRTC(httpapi.WebRTCConfig{
+			Output:     ptyOutput,
+			Input:      process,
+			ICEServers: []webrtc.ICEServer{{URLs: iceServers}},
+		})
+	}
+	if responseCacheTTL > 0 {
+		srv.EnableResponseCache(responseCacheTTL)
+	}
+	if contextWindow > 0 {
+		srv.EnableContextTrimming(contextWindow)
+	}
+	if messageQueueDepth > 0 {
+		srv.EnableMessageQueue(ctx, messageQueueDepth)
+	}
+	if adminToken == "" {
+		adminToken = os.Getenv("CLAUDER_ADMIN_TOKEN")
+	}
+	if adminToken != "" {
+		srv.EnableAdminShutdown(adminToken, nil)
+	}
+	if enableWorkspaces {
+		if adminToken == "" {
+			return xerrors.Errorf("--workspaces requires --admin-token")
+		}
+		// workspaceProcessConfig is how the agent of a workspace is started
+		workspaceProcessConfig := func(agent httpapi.WorkspaceAgentConfig) termexec.StartProcessConfig {
+			return termexec.StartProcessConfig{
+				Program:           agent.Program,
+				Args:              agent.Args,
+				BinarySearchPaths: msgfmt.BinarySearchPaths(agent.Type),
+				Dir:               agent.Dir,
+				TerminalWidth:     terminalDimensions(agent.Type).Width,
+				TerminalHeight:    terminalDimensions(agent.Type).Height,
+				WriteRateLimiter: termexec.WriteRateLimiter{
+					RateCharsPerSecond: ptyRateLimit,
+					BurstChars:         ptyBurst,
+				},
+				BatchWrites:          ptyBatchWrites,
+				NicePriority:         nicePriority,
+				IOPriorityClass:      ioPriorityClass,
+				Sandbox:              termexec.SandboxLevel(sandbox),
+				SandboxExecAllowlist: sandboxAllowExec,
+				Env:                  agent.Env,
+				TermType:             termType,
+				ColorProfile:         colorProfile,
+				WarmupProbeCommand:   strings.Fields(workspaceWarmupProbe),
+			}
+		}
+		// pool holds agents started ahead of time for the workspaces that
+		// run the server's agent program, without arguments, in its
+		// working directory and with its environment variables
+		var pool *termexec.ProcessPool
+		pooledAgent := httpapi.WorkspaceAgentConfig{Type: agentType, Program: agent, Dir: agentDir, Env: agentEnv}
+		if workspacePool > 0 {
+			pool = termexec.NewProcessPool(ctx, workspaceProcessConfig(pooledAgent), workspacePool)
+		}
+		srv.SetLazyWorkspaceAgents(workspaceLazyStart)
+		srv.EnableWorkspaces(ctx, func(ctx context.Context, workspace httpapi.Workspace) (*termexec.Process, error) {
+			agent := workspace.AgentConfig
+			if agent.Dir == "" {
+				agent.Dir = agentDir
+			}
+			if pool != nil && agent.Type == pooledAgent.Type && agent.Program == pooledAgent.Program && len(agent.Args) == 0 && agent.Dir == pooledAgent.Dir && maps.Equal(agent.Env, pooledAgent.Env) {
+				logger.Info("Using a pooled workspace agent", "workspace", workspace.ID, "program", agent.Program, "dir", agent.Dir)
+				return pool.Acquire(ctx)
+			}
+			logger.Info("Starting workspace agent", "workspace", workspace.ID, "program", agent.Program, "dir", agent.Dir)
+			return termexec.StartProcess(ctx, workspaceProcessConfig(agent))
+		})
+		// branches of the default workspace run the server's agent
+		srv.SetDefaultWorkspaceAgent(httpapi.WorkspaceAgentConfig{Type: agentType, Program: agent, Args: argsToPass[1:], Dir: agentDir, Env: agentEnv})
+		if eventLog != "" {
+			path, err := expandHome(eventLog)
+			if err != nil {
+				return xerrors.Errorf("failed to resolve event log path: %w", err)
+			}
+			store, err := httpapi.OpenEventStore(path)
+			if err != nil {
+				return xerrors.Errorf("failed to open event log: %w", err)
+			}
+			defer func() { _ = store.Close() }()
+			srv.EnableEventLog(ctx, store)
+		}
+	} else if workspacePool > 0 || workspaceWarmupProbe != "" || workspaceLazyStart || eventLog != "" {
+		return xerrors.Errorf("--workspace-pool, --workspace-warmup-probe, --workspace-lazy-start and --event-log require --workspaces")
+	}
+	srv.SetTTFBWarningThreshold(ttfbWarning)
+	if logBodies {
+		srv.EnableBodyLogging(logBodyBytes)
+	}
+	if !noSecurityHeaders {
+		// the server doesn't terminate TLS itself, so HSTS is left to the
+		// proxy in front of it
+		srv.EnableSecurityHeaders(false)
+	}
+	srv.SetSnapshotPollInterval(snapshotPoll)
+	if pushSnapshot {
+		srv.EnablePushSnapshot()
+	}
+	if sseMaxEventsPerSecond < 0 {
+		return xerrors.Errorf("--sse-max-events-per-second must not be negative")
+	}
+	srv.SetSSEMaxEventsPerSecond(sseMaxEventsPerSecond)
+	if sseDedupTTL < 0 {
+		return xerrors.Errorf("--sse-dedup-ttl must not be negative")
+	}
+	srv.SetSSEDeduplicationTTL(sseDedupTTL)
+	if sseWriteTimeout < 0 {
+		return xerrors.Errorf("--sse-write-timeout must not be negative")
+	}
+	srv.SetSSEWriteTimeout(sseWriteTimeout)
+	srv.EnableFileListing(agentDir)
+	srv.EnableMessageRouting(ctx, resolveRouteSession, &http.Client{Timeout: 2 * time.Minute})
+	srv.EnablePushTargets(ctx, http.DefaultClient)
+	srv.EnableReplay(ctx)
+	if keepaliveInterval > 0 {
+		if keepaliveMsg == "" || keepaliveMsg != strings.TrimSpace(keepaliveMsg) {
+			return xerrors.Errorf("--keepalive-msg must not be empty or start or end with whitespace")
+		}
+		srv.EnableSessionKeepalive(ctx, httpapi.SessionKeepalive{Interval: keepaliveInterval, Message: keepaliveMsg})
+	}
+	slo := httpapi.NewSLOMonitor(logger, httpapi.SLOConfig{
+		P95Threshold:       time.Duration(sloP95) * time.Millisecond,
+		ErrorRateThreshold: sloErrorRate,
+	})
+	for _, webhook := range sloWebhooks {
+		slo.AddAlertWebhook(webhook)
+	}
+	srv.EnableSLOMonitor(slo)
+	if adaptiveSnapshots {
+		if sloP95 <= 0 {
+			return xerrors.Errorf("--adaptive-snapshots requires --slo-p95-ms")
+		}
+		srv.EnableAdaptiveSnapshots(ctx, httpapi.NewAdaptiveSnapshotScheduler(slo, snapshotPoll))
+	}
+	if recordingsDir != "" {
+		dir, err := expandHome(recordingsDir)
+		if err != nil {
+			return xerrors.Errorf("failed to resolve recordings directory: %w", err)
+		}
+		srv.EnableRecordingExport(dir)
+	}
+	if slackWebhook == "" {
+		slackWebhook = os.Getenv("CLAUDER_SLACK_WEBHOOK")
+	}
+	var slack *httpapi.SlackNotifier
+	if slackWebhook != "" {
+		slack = httpapi.NewSlackNotifier(slackWebhook)
+		srv.EnableSlackNotifications(ctx, slack)
+	}
+	if vapidSubject != "" {
+		webPush, err := httpapi.NewWebPushNotifier(vapidSubject)
+		if err != nil {
+			return xerrors.Errorf("failed to set up push notifications: %w", err)
+		}
+		srv.EnableWebPush(ctx, webPush)
+	}
+	if desktopNotify {
+		notifier, err := notify.PlatformNotifier()
+		if err != nil {
+			return xerrors.Errorf("failed to set up desktop notifications: %w", err)
+		}
+		srv.EnableDesktopNotifications(ctx, notifier)
+	}
+	if unixSocket != "" {
+		socketPath, err := expandHome(unixSocket)
+		if err != nil {
+			return xerrors.Errorf("failed to resolve unix socket path: %w", err)
+		}
+		srv.EnableUnixSocket(socketPath, listenTCP)
+		logger.Info("Listening on unix socket", "path", socketPath)
+	}
 	srv.StartSnapshotLoop(ctx)
-	logger.Info("Starting server on port", "port", port)
+	telemetrySession := telemetry.SessionStart(ctx, string(agentType), "")
+	defer telemetrySession.End(ctx)
+	srv.StartLineLoop(ctx, lineEmitter.Lines())
+	if resizer != nil {
+		srv.EnableAutoResize(ctx, resizer, terminal.Height)
+	}
+	if jsonEventParser != nil {
+		srv.StartJSONEventLoop(ctx, jsonEventParser.Events())
+	}
+	if stdoutJSONParser != nil {
+		go func() {
+			if err := stdoutJSONParser.Run(); err != nil {
+				logger.Error("Failed to read the agent's standard output", "error", err)
+			}
+		}()
+		srv.StartStdoutJSONLoop(ctx, stdoutJSONParser.Events())
+	}
+	// restartAgent closes the agent, which makes the server exit with an
+	// error, so that a supervisor can restart it.
+	var restartOnce sync.Once
+	restartAgent := func() {
+		restartOnce.Do(func() {
+			go func() {
+				if err := process.Close(logger, 5*time.Second); err != nil {
+					logger.Error("Failed to close agent process", "error", err)
+				}
+			}()
+		})
+	}
+	if slashCommands {
+		srv.EnableSlashCommands(func() error {
+			restartAgent()
+			return nil
+		})
+	}
+	srv.StartWatchdog(ctx, func(status httpapi.WatchdogStatus) {
+		logger.Error("Watchdog check failed", "failures", status.Failures)
+		if watchdogRestart {
+			restartAgent()
+		}
+	})
+	pidFile, err := httpapi.DefaultPIDFilePath()
+	if err != nil {
+		return xerrors.Errorf("failed to resolve PID file path: %w", err)
+	}
+	// the PID file is only written once the server listens, so that a
+	// server that fails to start, e.g. because the port is in use, doesn't
+	// replace or remove the one of the server that's running
+	var removePIDFile func() error
+	srv.OnListening(func() {
+		var err error
+		if removePIDFile, err = httpapi.WritePIDFile(pidFile); err != nil {
+			logger.Error("Failed to write PID file", "error", err)
+		}
+		if background {
+			// the original process exits once the server listens
+			if err := daemon.Ready(); err != nil {
+				logger.Error("Failed to notify the original process", "error", err)
+			}
+		}
+	})
+	defer func() {
+		if removePIDFile == nil {
+			return
+		}
+		if err := removePIDFile(); err != nil {
+			logger.Error("Failed to remove PID file", "error", err)
+		}
+	}()
+	// stop the server on interrupt so that the PID file is removed
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		<-signals
+		logger.Info("Shutting down")
+		if err := srv.Stop(ctx); err != nil {
+			logger.Error("Failed to stop server", "error", err)
+		}
+	}()
+	if listenTCP {
+		logger.Info("Starting server on port", "port", port)
+	}
 	processExitCh := make(chan error, 1)
 	go func() {
 		defer close(processExitCh)
 		if err := process.Wait(); err != nil {
+			if slack != nil {
+				if _, err := slack.Notify(ctx, httpapi.SlackEventAgentExited, fmt.Sprintf("The %s agent exited: %v", agentType, err)); err != nil {
+					logger.Error("Failed to send Slack notification", "error", err)
+				}
+			}
 			if errors.Is(err, termexec.ErrNonZeroExitCode) {
 				processExitCh <- xerrors.Errorf("========\n%s\n========\n: %w", strings.TrimSpace(process.ReadScreen()), err)
 			} else {
@@ -134,14 +747,67 @@ func runServer(ctx context.Context, logger *slog.Logger, argsToPass []string) er
 	return nil
 }
 
+// resolveRouteSession resolves the destination of a message route: the URL
+// of a clauder server, or the passcode of a session registered with the
+// coordinator.
+func resolveRouteSession(ctx context.Context, sessionID string) (httpapi.RouteSession, error) {
+	if strings.HasPrefix(sessionID, "http://") || strings.HasPrefix(sessionID, "https://") {
+		return httpapi.RouteSession{URL: strings.TrimRight(sessionID, "/")}, nil
+	}
+	resp, err := coordinator.Lookup(strings.ToUpper(sessionID))
+	if err != nil {
+		return httpapi.RouteSession{}, xerrors.Errorf("failed to look up session %s: %w", sessionID, err)
+	}
+	return httpapi.RouteSession{URL: strings.TrimRight(resp.TunnelURL, "/"), Token: resp.Token}, nil
+}
+
+// expandHome replaces a leading ~ in path with the user's home directory.
+func expandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~")), nil
+}
+
 var ServerCmd = &cobra.Command{
 	Use:   "server [agent]",
 	Short: "Run the server",
-	Long:  `Run the server with the specified agent (claude, goose, aider, codex)`,
+	Long:  `Run the server with the specified agent (claude, goose, aider, codex, gemini)`,
 	Args:  cobra.MinimumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+		// ask before the daemon loses the terminal
+		if !printOpenAPI && term.IsTerminal(int(os.Stdin.Fd())) {
+			if err := telemetry.AskOnFirstRun(os.Stdin, os.Stdout); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to save the telemetry settings: %v\n", err)
+			}
+		}
+		if background {
+			logPath, err := daemon.DefaultLogPath()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%+v\n", err)
+				os.Exit(1)
+			}
+			isDaemon, err := daemon.Daemonize(logPath)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%+v\n", err)
+				os.Exit(1)
+			}
+			if !isDaemon {
+				fmt.Printf("The server is running in the background. Its output is appended to %s\n", logPath)
+				return
+			}
+		}
+		logOptions := &slog.HandlerOptions{Level: &logLevel}
+		if logBodies {
+			logLevel.Set(slog.LevelDebug)
+		}
+		logger := slog.New(slog.NewTextHandler(os.Stdout, logOptions))
 		ctx := logctx.WithLogger(context.Background(), logger)
+		listenTCP = unixSocket == "" || cmd.Flags().Changed("port")
 		if err := runServer(ctx, logger, cmd.Flags().Args()); err != nil {
 			fmt.Fprintf(os.Stderr, "%+v\n", err)
 			os.Exit(1)
@@ -150,10 +816,74 @@ var ServerCmd = &cobra.Command{
 }
 
 func init() {
-	ServerCmd.Flags().StringVarP(&agentTypeVar, "type", "t", "", "Override the agent type (one of: claude, goose, aider, custom)")
+	ServerCmd.Flags().StringVarP(&agentTypeVar, "type", "t", "", "Override the agent type (one of: claude, goose, aider, codex, gemini, custom)")
 	ServerCmd.Flags().IntVarP(&port, "port", "p", 3284, "Port to run the server on")
 	ServerCmd.Flags().BoolVarP(&printOpenAPI, "print-openapi", "P", false, "Print the OpenAPI schema to stdout and exit")
 	ServerCmd.Flags().StringVarP(&chatBasePath, "chat-base-path", "c", "/chat", "Base path for assets and routes used in the static files of the chat interface")
-	ServerCmd.Flags().Uint16VarP(&termWidth, "term-width", "W", 80, "Width of the emulated terminal")
-	ServerCmd.Flags().Uint16VarP(&termHeight, "term-height", "H", 1000, "Height of the emulated terminal")
+	ServerCmd.Flags().StringVar(&basePath, "base-path", "", "Serve every endpoint under this path, e.g. /clauder when a reverse proxy mounts the server there")
+	ServerCmd.Flags().StringVar(&workdir, "workdir", "", "Working directory of the agent. Defaults to the root of the git repository the server is started in, or else the current directory")
+	ServerCmd.Flags().BoolVar(&workdirGitRoot, "workdir-git-root", false, "Run the agent in the root of the git repository the server is started in, and fail if there isn't one")
+	ServerCmd.Flags().StringVar(&sandbox, "sandbox", string(termexec.SandboxOff), "Isolate the agent from the rest of the machine on Linux and macOS (one of: off, restricted, strict). restricted cuts it off from the network and only lets it write to its working directory, strict also only lets it execute the agent and --sandbox-allow-exec")
+	ServerCmd.Flags().StringSliceVar(&sandboxAllowExec, "sandbox-allow-exec", nil, "Path that can be executed with --sandbox strict, e.g. the interpreter of the agent. Directories allow everything in them. Can be repeated")
+	ServerCmd.Flags().StringArrayVar(&preinject, "preinject", nil, "Line to type into the agent when it starts, once its screen stopped changing, e.g. to answer a setup prompt. Can be repeated; the lines are typed in order")
+	ServerCmd.Flags().DurationVar(&preinjectDelay, "preinject-delay", time.Second, "Time between the lines of --preinject")
+	ServerCmd.Flags().StringVar(&healthCheckURL, "health-check-url", "", "Local HTTP endpoint of the agent, e.g. http://localhost:8080/health, that must respond with 200 to a GET request before the server starts, for agents that keep loading after their screen stopped changing")
+	ServerCmd.Flags().DurationVar(&startupTimeout, "startup-timeout", termexec.DefaultStartupTimeout, "How long the agent may take to pass --health-check-url after it started")
+	ServerCmd.Flags().DurationVar(&keepaliveInterval, "keepalive-interval", 25*time.Minute, "Send --keepalive-msg to the agent after this long without a user message, so that its session doesn't expire. The keepalives and their responses are hidden from the message history. 0 disables keepalives")
+	ServerCmd.Flags().StringVar(&keepaliveMsg, "keepalive-msg", ".", "Message sent to the agent to keep its session alive")
+	ServerCmd.Flags().Uint16VarP(&termWidth, "terminal-width", "W", 0, "Width of the emulated terminal. Defaults to the width the agent renders best at, e.g. 220 for claude, 100 for goose and 80 for aider")
+	ServerCmd.Flags().Uint16VarP(&termHeight, "terminal-height", "H", 0, "Height of the emulated terminal. Defaults to 1000")
+	// the flags were called --term-width and --term-height before
+	ServerCmd.Flags().Uint16Var(&termWidth, "term-width", 0, "Width of the emulated terminal")
+	ServerCmd.Flags().Uint16Var(&termHeight, "term-height", 0, "Height of the emulated terminal")
+	_ = ServerCmd.Flags().MarkDeprecated("term-width", "use --terminal-width instead")
+	_ = ServerCmd.Flags().MarkDeprecated("term-height", "use --terminal-height instead")
+	ServerCmd.Flags().BoolVar(&jsonStdout, "json-stdout", false, "Read the agent's standard output through a pipe instead of its terminal, and stream every JSON object it prints as an agent_output SSE event. With --json-mode, Claude Code's events are streamed as tool_use events too. Not supported on Windows")
+	ServerCmd.Flags().BoolVar(&jsonMode, "json-mode", false, "Start Claude Code with --output-format json and stream its structured events as tool_use SSE events")
+	ServerCmd.Flags().DurationVar(&responseCacheTTL, "response-cache-ttl", 0, "Cache the agent's response to each user message for this long and answer identical messages from the cache. Disabled if 0")
+	ServerCmd.Flags().IntVar(&contextWindow, "context-window", 200000, "Size of the agent's context window in tokens. The oldest messages are trimmed from the server's conversation history once it fills 80% of it. The agent's own context isn't affected. Disabled if 0")
+	ServerCmd.Flags().IntVar(&messageQueueDepth, "message-queue-depth", 10, "Number of messages that can wait to be sent to the agent. POST /message returns right away with the message's position in the queue, before the agent received it, and GET /status reports the agent as running until the queued messages were answered. Failures are reported with message_failed events. If 0, messages are sent synchronously")
+	ServerCmd.Flags().StringVar(&unixSocket, "unix-socket", "", "Listen on a Unix domain socket that only the current user can connect to, instead of TCP. Defaults to ~/.clauder/clauder.sock if given without a value. Set --port too to listen on both")
+	ServerCmd.Flags().Lookup("unix-socket").NoOptDefVal = "~/.clauder/clauder.sock"
+	ServerCmd.Flags().BoolVar(&enableWebRTC, "webrtc", false, "Allow clients to stream the terminal over a WebRTC data channel")
+	ServerCmd.Flags().StringSliceVar(&iceServers, "ice-server", []string{"stun:stun.l.google.com:19302"}, "STUN or TURN server URL used for WebRTC connections. Can be repeated")
+	ServerCmd.Flags().StringVar(&adminToken, "admin-token", "", "Allow stopping the server with POST /admin/shutdown and this Bearer token. Defaults to the CLAUDER_ADMIN_TOKEN environment variable")
+	ServerCmd.Flags().BoolVar(&enableWorkspaces, "workspaces", false, "Allow creating workspaces, each running its own agent, with POST /admin/workspaces and the admin token. Requires --admin-token")
+	ServerCmd.Flags().IntVar(&workspacePool, "workspace-pool", 0, "Keep this many agents started ahead of time for workspaces that run the server's agent program, without arguments, in its working directory, so that creating them doesn't wait for the agent to start. Requires --workspaces")
+	ServerCmd.Flags().StringVar(&eventLog, "event-log", "", "SQLite database to log the messages and status changes of every workspace to, so that GET /admin/workspaces/{id}/events returns them and POST /admin/workspaces/{id}/restore restores a workspace to any point of its history. Requires --workspaces and a clauder built with cgo")
+	ServerCmd.Flags().StringVar(&workspaceWarmupProbe, "workspace-warmup-probe", "", "Command run in the working directory of every workspace agent before it starts, e.g. \"claude --version\", so that an agent that can't run fails early. Requires --workspaces")
+	ServerCmd.Flags().BoolVar(&workspaceLazyStart, "workspace-lazy-start", false, "Start the agent of a workspace on its first message rather than when the workspace is created. Its status is not_started until then. Requires --workspaces")
+	ServerCmd.Flags().BoolVar(&pushSnapshot, "push-snapshot", false, "Send new clients of GET /events the agent's screen right away: by HTTP/2 server push of GET /snapshot, or as a snapshot event for HTTP/1.1 clients. Also accepts HTTP/2 without TLS (h2c), for proxies and tunnels that terminate TLS")
+	ServerCmd.Flags().DurationVar(&snapshotPoll, "snapshot-poll-interval", 25*time.Millisecond, "How often the conversation is polled for events with one client connected. With more clients, it's polled proportionally more often, down to every 100ms. It isn't polled while no client is connected")
+	ServerCmd.Flags().Float64Var(&sseMaxEventsPerSecond, "sse-max-events-per-second", httpapi.DefaultSSEMaxEventsPerSecond, "Maximum number of line events sent to each client of GET /events?mode=lines per second. Lines beyond it are dropped and counted in a throttled event. 0 disables the limit")
+	ServerCmd.Flags().DurationVar(&sseDedupTTL, "sse-dedup-ttl", httpapi.DefaultSSEDeduplicationTTL, "How long a line event that repeats the previous line is suppressed for, e.g. the frames of a spinner. 0 sends every line")
+	ServerCmd.Flags().DurationVar(&sseWriteTimeout, "sse-write-timeout", httpapi.DefaultSSEWriteTimeout, "Close the connection of an SSE client when writing an event to it blocks for longer than this, e.g. a mobile client that can't keep up. The client is expected to reconnect. 0 waits indefinitely")
+	ServerCmd.Flags().DurationVar(&ttfbWarning, "ttfb-warning-threshold", time.Second, "Log a warning when an SSE client waits longer than this for its first event")
+	ServerCmd.Flags().StringVar(&vapidSubject, "vapid-subject", "https://github.com/zohaibahmed/clauder", "Contact URL (mailto: or https:) sent to push services with browser push notifications. Disables push notifications if empty")
+	ServerCmd.Flags().BoolVar(&desktopNotify, "notify", false, "Show a desktop notification when the agent finishes a task, with osascript on macOS, notify-send on Linux and PowerShell on Windows")
+	ServerCmd.Flags().BoolVar(&logBodies, "log-bodies", false, "Log the bodies of HTTP requests and responses, except SSE streams, to debug message formatting. Enables debug logging")
+	ServerCmd.Flags().IntVar(&logBodyBytes, "log-body-bytes", httpapi.DefaultBodyLogMaxBytes, "Number of bytes of each body logged with --log-bodies")
+	ServerCmd.Flags().StringVar(&ptyLog, "pty-log", "", "File to append everything the agent writes to its terminal to, in timestamped chunks, to debug what it printed exactly")
+	ServerCmd.Flags().StringVar(&termType, "term", "", "TERM of the agent's terminal (default "+termexec.DefaultTermType+", or one that supports --color-profile)")
+	ServerCmd.Flags().StringVar(&colorProfile, "color-profile", "", fmt.Sprintf("Colors the agent is told its terminal supports, through COLORTERM and NO_COLOR, one of %v", termexec.ColorProfiles))
+	ServerCmd.Flags().StringArrayVar(&suppressPatterns, "suppress-pattern", nil, "Regular expression of lines of the agent's output that aren't sent as line events, matched with and without ANSI escape sequences. Can be repeated")
+	ServerCmd.Flags().BoolVar(&suppressNoise, "suppress-noise", false, "Don't send lines that move the cursor up, start with a spinner frame or are blank as line events")
+	ServerCmd.Flags().StringVar(&configFile, "config", "", "Config file whose log_level, cors_origins, pty_rate_limit and pty_burst keys override the flags. It's read again when the server receives SIGHUP. Defaults to ~/.clauder/config.yaml")
+	ServerCmd.Flags().BoolVar(&autoResize, "auto-resize", false, fmt.Sprintf("Widen the agent's terminal by %d columns when most of the lines it printed in the last %s fill its width, and narrow it when few reach half of it. Clients get a pty_resized event", st.AutoResizeStep, st.AutoResizeWindow))
+	ServerCmd.Flags().BoolVar(&strictVersion, "strict-version", false, "Don't start if the agent's version isn't one its messages are known to be formatted correctly for, or can't be determined with --version, instead of logging a warning")
+	ServerCmd.Flags().BoolVar(&background, "background", false, "Run the server in the background, detached from the terminal, on Linux and macOS. Waits until it listens, and fails if it exits before. Its PID is written to ~/.clauder/server.pid, and its output is appended to ~/.clauder/server.log")
+	ServerCmd.Flags().BoolVar(&noSecurityHeaders, "no-security-headers", false, "Don't set the X-Frame-Options, Content-Security-Policy and other security headers, for testing")
+	ServerCmd.Flags().StringVar(&slackWebhook, "slack-webhook", "", "Slack incoming webhook URL to notify when the agent finishes a task, exits unexpectedly or the tunnel reconnects. Defaults to the CLAUDER_SLACK_WEBHOOK environment variable")
+	ServerCmd.Flags().StringVar(&recordingsDir, "recordings-dir", "~/.clauder/recordings", "Directory of the asciinema recordings that can be converted to GIFs with POST /recording/gif. Disabled if empty")
+	ServerCmd.Flags().Float64Var(&ptyRateLimit, "pty-rate-limit", 0, "Maximum number of characters per second written to the agent's terminal, so that it doesn't lose input. Disabled if 0")
+	ServerCmd.Flags().IntVar(&ptyBurst, "pty-burst", 0, "Number of characters that can be written to the agent's terminal at once with --pty-rate-limit. Defaults to a second's worth")
+	ServerCmd.Flags().BoolVar(&ptyBatchWrites, "pty-batch-writes", false, "Collect the input written to the agent's terminal within 5ms and write it at once, to save syscalls when clients send many small messages in quick succession")
+	ServerCmd.Flags().IntVar(&nicePriority, "nice", 0, "Nice value of the agent process, from -20 (highest priority) to 19 (lowest), so that it doesn't compete with other applications for CPU")
+	ServerCmd.Flags().StringVar(&ioPriorityClass, "ionice", "", "IO scheduling class of the agent process on Linux (one of: "+strings.Join(termexec.IOPriorityClasses, ", ")+")")
+	ServerCmd.Flags().IntVar(&sloP95, "slo-p95-ms", 2000, "Alert when the 95th percentile of the POST /message latency over the last 5 minutes exceeds this many milliseconds. Disabled if 0")
+	ServerCmd.Flags().Float64Var(&sloErrorRate, "slo-error-rate", 0.01, "Alert when more than this share of the POST /message requests over the last 5 minutes fail with a server error. Disabled if 0")
+	ServerCmd.Flags().BoolVar(&adaptiveSnapshots, "adaptive-snapshots", false, "While the 95th percentile of the POST /message latency exceeds --slo-p95-ms, double the interval the conversation is polled for events at, up to 30 seconds, and restore it once the latency stayed below the threshold for a minute. Clients get a quality_degraded event whenever it changes")
+	ServerCmd.Flags().StringSliceVar(&sloWebhooks, "slo-alert-webhook", nil, "URL to post SLO alerts to as JSON, like {\"type\":\"slo_breach\",\"metric\":\"p95_latency_ms\",\"value\":2500,\"threshold\":2000}. Alerts are logged either way. Can be repeated")
+	ServerCmd.Flags().BoolVar(&slashCommands, "slash-commands", false, "Run the messages /resize <cols> <rows>, /status, /export and /restart on the server instead of sending them to the agent. /restart stops the agent and exits, so that a supervisor can restart the server")
+	ServerCmd.Flags().BoolVar(&watchdogRestart, "watchdog-restart", false, "Stop the agent and exit when the watchdog detects a stuck component, so that a supervisor can restart the server")
 }
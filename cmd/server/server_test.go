@@ -1,10 +1,22 @@
 package server
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	"github.com/zohaibahmed/clauder/lib/msgfmt"
+	"github.com/zohaibahmed/clauder/lib/termexec"
 )
 
 func TestParseAgentType(t *testing.T) {
@@ -33,6 +45,11 @@ func TestParseAgentType(t *testing.T) {
 			agentTypeVar: "",
 			want:         AgentTypeAider,
 		},
+		{
+			firstArg:     "gemini",
+			agentTypeVar: "",
+			want:         AgentTypeGemini,
+		},
 		{
 			firstArg:     "whatever",
 			agentTypeVar: "",
@@ -70,6 +87,115 @@ func TestParseAgentType(t *testing.T) {
 
 	t.Run("invalid agent type", func(t *testing.T) {
 		_, err := parseAgentType("claude", "invalid")
-		require.Error(t, err)
+		require.ErrorContains(t, err, "registered agent types: aider, claude, codex, custom, gemini, goose")
+	})
+}
+
+func TestCheckAgentEnv(t *testing.T) {
+	env := map[string]string{}
+	getenv := func(key string) string { return env[key] }
+
+	require.NoError(t, checkAgentEnv(AgentTypeClaude, getenv))
+	require.ErrorContains(t, checkAgentEnv(AgentTypeGemini, getenv), "GEMINI_API_KEY or GOOGLE_CLOUD_PROJECT must be set")
+
+	env["GEMINI_API_KEY"] = "key"
+	require.NoError(t, checkAgentEnv(AgentTypeGemini, getenv))
+
+	env = map[string]string{"GOOGLE_CLOUD_PROJECT": "project"}
+	require.NoError(t, checkAgentEnv(AgentTypeGemini, getenv))
+}
+
+func TestLoadAgentEnv(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".env.agent")
+
+	env, err := loadAgentEnv(path)
+	require.NoError(t, err)
+	require.Empty(t, env, "the file is optional")
+
+	require.NoError(t, os.WriteFile(path, []byte("# agent keys\nCLAUDER_TEST_AGENT_KEY=sk-agent-only\n"), 0o600))
+	env, err = loadAgentEnv(path)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"CLAUDER_TEST_AGENT_KEY": "sk-agent-only"}, env)
+
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	process, err := termexec.StartProcess(ctx, termexec.StartProcessConfig{
+		Program:        "sh",
+		Args:           []string{"-c", `echo "key=$CLAUDER_TEST_AGENT_KEY"; sleep 5`},
+		TerminalWidth:  80,
+		TerminalHeight: 24,
+		Env:            env,
 	})
+	require.NoError(t, err)
+	defer process.Close(slog.New(slog.NewTextHandler(io.Discard, nil)), time.Second)
+	require.Eventually(t, func() bool {
+		return strings.Contains(process.ReadScreen(), "key=sk-agent-only")
+	}, 5*time.Second, 10*time.Millisecond, "the agent gets the key")
+	for _, kv := range os.Environ() {
+		require.NotContains(t, kv, "CLAUDER_TEST_AGENT_KEY", "the server doesn't")
+	}
+
+	require.NoError(t, os.WriteFile(path, []byte("PATH=/tmp\n"), 0o600))
+	_, err = loadAgentEnv(path)
+	require.ErrorContains(t, err, "PATH")
+}
+
+func TestCheckAgentVersion(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+	ctx := context.Background()
+	agent := func(output string) string {
+		path := filepath.Join(t.TempDir(), "agent")
+		require.NoError(t, os.WriteFile(path, []byte("#!/bin/sh\necho '"+output+"'\n"), 0o700))
+		return path
+	}
+
+	require.NoError(t, checkAgentVersion(ctx, AgentTypeClaude, agent("1.0.51 (Claude Code)")))
+	require.ErrorContains(t, checkAgentVersion(ctx, AgentTypeClaude, agent("2.1.0 (Claude Code)")), "v2.1.0 isn't a supported version (>=1.0.0 <2.0.0)")
+	require.ErrorContains(t, checkAgentVersion(ctx, AgentTypeCodex, agent("codex-cli")), "failed to parse the version")
+	require.ErrorContains(t, checkAgentVersion(ctx, AgentTypeGemini, filepath.Join(t.TempDir(), "missing")), "failed to find")
+	require.NoError(t, checkAgentVersion(ctx, AgentTypeCustom, "missing"), "custom agents aren't checked")
+}
+
+func TestOutputFilter(t *testing.T) {
+	filter, err := outputFilter(nil, false)
+	require.NoError(t, err)
+	assert.Nil(t, filter)
+
+	filter, err = outputFilter([]string{`^npm WARN`}, true)
+	require.NoError(t, err)
+	assert.True(t, filter.Suppress("npm WARN deprecated"))
+	assert.True(t, filter.Suppress("⠋ Thinking"), "--suppress-noise adds the default patterns")
+	assert.False(t, filter.Suppress("added 3 packages"))
+
+	_, err = outputFilter([]string{`(`}, false)
+	assert.ErrorContains(t, err, `invalid --suppress-pattern "("`)
+}
+
+func TestTerminalDimensions(t *testing.T) {
+	defer func(width, height uint16) { termWidth, termHeight = width, height }(termWidth, termHeight)
+	termWidth, termHeight = 0, 0
+	assert.Equal(t, msgfmt.TerminalDimensions{Width: 220, Height: 1000}, terminalDimensions(AgentTypeClaude))
+	assert.Equal(t, msgfmt.TerminalDimensions{Width: 100, Height: 1000}, terminalDimensions(AgentTypeGoose))
+	assert.Equal(t, msgfmt.TerminalDimensions{Width: 80, Height: 1000}, terminalDimensions(AgentTypeAider))
+	assert.Equal(t, msgfmt.TerminalDimensions{Width: 80, Height: 1000}, terminalDimensions(AgentTypeCustom))
+
+	// the flags override the agent's defaults
+	termWidth = 120
+	assert.Equal(t, msgfmt.TerminalDimensions{Width: 120, Height: 1000}, terminalDimensions(AgentTypeClaude))
+	termHeight = 40
+	assert.Equal(t, msgfmt.TerminalDimensions{Width: 120, Height: 40}, terminalDimensions(AgentTypeGoose))
+}
+
+func TestDeprecatedTerminalFlags(t *testing.T) {
+	defer func(width, height uint16) { termWidth, termHeight = width, height }(termWidth, termHeight)
+	flags := ServerCmd.Flags()
+	require.NoError(t, flags.Set("term-width", "132"))
+	assert.Equal(t, uint16(132), termWidth, "--term-width sets the same width as --terminal-width")
+	require.NoError(t, flags.Set("terminal-height", "50"))
+	assert.Equal(t, uint16(50), termHeight)
 }
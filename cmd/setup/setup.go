@@ -0,0 +1,387 @@
+package setup
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+	cfg "github.com/zohaibahmed/clauder/lib/config"
+	mf "github.com/zohaibahmed/clauder/lib/msgfmt"
+	"github.com/zohaibahmed/clauder/lib/tunnel"
+	"golang.org/x/term"
+	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	fileArg        string
+	nonInteractive bool
+)
+
+// prompter asks the user for the value of a setting.
+type prompter interface {
+	// prompt returns the answer to question, or def if there's none.
+	// Secret answers aren't echoed.
+	prompt(id, question, def string, secret bool) (string, error)
+	// interactive reports whether invalid answers can be asked again.
+	interactive() bool
+}
+
+// terminalPrompter asks the user on the terminal.
+type terminalPrompter struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+func (p *terminalPrompter) prompt(id, question, def string, secret bool) (string, error) {
+	shown := def
+	if secret && def != "" {
+		shown = "keep current"
+	}
+	if shown != "" {
+		fmt.Fprintf(p.out, "%s [%s]: ", question, shown)
+	} else {
+		fmt.Fprintf(p.out, "%s: ", question)
+	}
+	var answer string
+	if secret && term.IsTerminal(int(os.Stdin.Fd())) {
+		data, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(p.out)
+		if err != nil {
+			return "", xerrors.Errorf("failed to read answer: %w", err)
+		}
+		answer = string(data)
+	} else {
+		line, err := p.in.ReadString('\n')
+		if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+			return "", xerrors.Errorf("failed to read answer: %w", err)
+		}
+		answer = line
+	}
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return def, nil
+	}
+	return answer, nil
+}
+
+func (p *terminalPrompter) interactive() bool { return true }
+
+// envPrompter takes the answers from CLAUDER_SETUP_<ID> environment
+// variables, for use in CI.
+type envPrompter struct {
+	getenv func(string) string
+}
+
+func envVarName(id string) string {
+	return "CLAUDER_SETUP_" + strings.ToUpper(id)
+}
+
+func (p *envPrompter) prompt(id, question, def string, secret bool) (string, error) {
+	if answer := strings.TrimSpace(p.getenv(envVarName(id))); answer != "" {
+		return answer, nil
+	}
+	return def, nil
+}
+
+func (p *envPrompter) interactive() bool { return false }
+
+// ask prompts until the answer passes validate.
+func ask(w io.Writer, p prompter, id, question, def string, secret bool, validate func(string) error) (string, error) {
+	for {
+		answer, err := p.prompt(id, question, def, secret)
+		if err != nil {
+			return "", err
+		}
+		err = validate(answer)
+		if err == nil {
+			return answer, nil
+		}
+		if !p.interactive() {
+			return "", xerrors.Errorf("invalid %s: %w", envVarName(id), err)
+		}
+		fmt.Fprintf(w, "❌ %s\n", err)
+	}
+}
+
+// wizard holds what the setup needs besides the answers. It's replaced in
+// tests.
+type wizard struct {
+	out      io.Writer
+	prompter prompter
+	lookPath func(file string) (string, error)
+}
+
+// section is a part of the config the wizard asks about.
+type section struct {
+	key   string
+	value any
+}
+
+func (wz *wizard) askAgent(current cfg.Config) (string, error) {
+	var installed, agentTypes []string
+	for _, agentType := range mf.DefaultRegistry.AgentTypes() {
+		// custom agents need agent_path, which is set by editing the file
+		if agentType == string(mf.AgentTypeCustom) {
+			continue
+		}
+		agentTypes = append(agentTypes, agentType)
+		if _, err := wz.lookPath(agentType); err == nil {
+			installed = append(installed, agentType)
+		}
+	}
+	fmt.Fprintln(wz.out, "\n🤖 Agent")
+	if len(installed) == 0 {
+		fmt.Fprintf(wz.out, "No agent found in PATH. Supported agents: %s\n", strings.Join(agentTypes, ", "))
+	} else {
+		fmt.Fprintf(wz.out, "Installed agents: %s\n", strings.Join(installed, ", "))
+	}
+	return ask(wz.out, wz.prompter, "agent", "Agent", current.Agent, false, func(answer string) error {
+		if !slices.Contains(agentTypes, answer) {
+			return xerrors.Errorf("unknown agent %q, expected one of: %s", answer, strings.Join(agentTypes, ", "))
+		}
+		if !slices.Contains(installed, answer) {
+			fmt.Fprintf(wz.out, "⚠️  %s isn't installed yet\n", answer)
+		}
+		return nil
+	})
+}
+
+func (wz *wizard) askTunnelProvider(current cfg.Config) (string, error) {
+	var providers, available []string
+	for _, provider := range tunnel.Providers {
+		providers = append(providers, string(provider))
+		if _, err := wz.lookPath(provider.Binary()); err == nil {
+			available = append(available, string(provider))
+		}
+	}
+	fmt.Fprintln(wz.out, "\n🔗 Tunnel provider")
+	fmt.Fprintf(wz.out, "Available providers: %s. Answer 'auto' to use the first available one.\n", orNone(available))
+	def := current.TunnelProvider
+	if def == "" {
+		def = "auto"
+	}
+	answer, err := ask(wz.out, wz.prompter, "tunnel_provider", "Tunnel provider", def, false, func(answer string) error {
+		if answer != "auto" && !slices.Contains(providers, answer) {
+			return xerrors.Errorf("unknown tunnel provider %q, expected auto or one of: %s", answer, strings.Join(providers, ", "))
+		}
+		return nil
+	})
+	if answer == "auto" {
+		answer = ""
+	}
+	return answer, err
+}
+
+// askAPIKey asks for the API key the agent needs, if any. It returns the
+// config key it's stored in.
+func (wz *wizard) askAPIKey(current cfg.Config, agent string) (string, string, error) {
+	var id, name, prefix, def string
+	switch agent {
+	case string(mf.AgentTypeClaude):
+		id, name, prefix, def = "anthropic_api_key", "Anthropic API key", "sk-ant-", current.AnthropicAPIKey
+	case string(mf.AgentTypeCodex):
+		id, name, prefix, def = "openai_api_key", "OpenAI API key", "sk-", current.OpenAIAPIKey
+	default:
+		return "", "", nil
+	}
+	fmt.Fprintln(wz.out, "\n🔑 API key")
+	fmt.Fprintf(wz.out, "Leave empty to use the %s environment variable instead.\n", strings.ToUpper(id))
+	answer, err := ask(wz.out, wz.prompter, id, name, def, true, func(answer string) error {
+		if answer != "" && (!strings.HasPrefix(answer, prefix) || strings.ContainsAny(answer, " \t")) {
+			return xerrors.Errorf("an %s starts with %s", name, prefix)
+		}
+		return nil
+	})
+	return id, answer, err
+}
+
+func (wz *wizard) askNotifications(current cfg.Config) (bool, error) {
+	fmt.Fprintln(wz.out, "\n🔔 Notifications")
+	def := "no"
+	if current.Notifications.Enabled {
+		def = "yes"
+	}
+	answer, err := ask(wz.out, wz.prompter, "notifications", "Notify you when the agent finishes responding? (yes/no)", def, false, func(answer string) error {
+		switch strings.ToLower(answer) {
+		case "y", "yes", "n", "no":
+			return nil
+		}
+		return xerrors.Errorf("answer yes or no")
+	})
+	return strings.HasPrefix(strings.ToLower(answer), "y"), err
+}
+
+// run asks about each section and writes the sections that changed to the
+// config file at path. Other keys and comments in the file are kept.
+func (wz *wizard) run(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return xerrors.Errorf("failed to read config: %w", err)
+	}
+	firstRun := err != nil
+	current, err := cfg.Parse(data)
+	if err != nil {
+		return xerrors.Errorf("%s: %w", path, err)
+	}
+
+	agent, err := wz.askAgent(current)
+	if err != nil {
+		return err
+	}
+	tunnelProvider, err := wz.askTunnelProvider(current)
+	if err != nil {
+		return err
+	}
+	apiKeyKey, apiKey, err := wz.askAPIKey(current, agent)
+	if err != nil {
+		return err
+	}
+	notifications, err := wz.askNotifications(current)
+	if err != nil {
+		return err
+	}
+
+	var changed []section
+	update := func(key string, value, currentValue any) {
+		if firstRun || value != currentValue {
+			changed = append(changed, section{key: key, value: value})
+		}
+	}
+	update("agent", agent, current.Agent)
+	update("tunnel_provider", tunnelProvider, current.TunnelProvider)
+	switch apiKeyKey {
+	case "anthropic_api_key":
+		update(apiKeyKey, apiKey, current.AnthropicAPIKey)
+	case "openai_api_key":
+		update(apiKeyKey, apiKey, current.OpenAIAPIKey)
+	}
+	update("notifications", cfg.Notifications{Enabled: notifications}, current.Notifications)
+
+	fmt.Fprintln(wz.out)
+	if len(changed) == 0 {
+		fmt.Fprintf(wz.out, "✅ No changes, %s is up to date\n", path)
+		return nil
+	}
+	out, err := setKeys(data, changed)
+	if err != nil {
+		return err
+	}
+	if _, err := cfg.Parse(out); err != nil {
+		return xerrors.Errorf("generated an invalid config: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return xerrors.Errorf("failed to create config directory: %w", err)
+	}
+	// the file may hold API keys
+	if err := os.WriteFile(path, out, 0o600); err != nil {
+		return xerrors.Errorf("failed to write config: %w", err)
+	}
+	keys := make([]string, len(changed))
+	for i, s := range changed {
+		keys[i] = s.key
+	}
+	fmt.Fprintf(wz.out, "✅ Updated %s in %s\n", strings.Join(keys, ", "), path)
+	fmt.Fprintln(wz.out, "💡 Run 'clauder config validate' to check the whole configuration")
+	return nil
+}
+
+// setKeys sets the top-level keys of the YAML document in data, adding the
+// ones that are missing at the end. Empty strings remove the key.
+func setKeys(data []byte, sections []section) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, xerrors.Errorf("failed to parse config: %w", err)
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, xerrors.New("config must be a mapping")
+	}
+	for _, s := range sections {
+		index := -1
+		for i := 0; i < len(root.Content); i += 2 {
+			if root.Content[i].Value == s.key {
+				index = i
+				break
+			}
+		}
+		if s.value == "" {
+			if index >= 0 {
+				root.Content = slices.Delete(root.Content, index, index+2)
+			}
+			continue
+		}
+		var value yaml.Node
+		if err := value.Encode(s.value); err != nil {
+			return nil, xerrors.Errorf("failed to encode %s: %w", s.key, err)
+		}
+		if index >= 0 {
+			root.Content[index+1] = &value
+			continue
+		}
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: s.key}, &value)
+	}
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return nil, xerrors.Errorf("failed to encode config: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, xerrors.Errorf("failed to encode config: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+func orNone(values []string) string {
+	if len(values) == 0 {
+		return "none"
+	}
+	return strings.Join(values, ", ")
+}
+
+var SetupCmd = &cobra.Command{
+	Use:   "setup",
+	Short: "Set up clauder interactively",
+	Long: `Ask for the agent, the tunnel provider, the API key and notification preferences, and save them to ~/.clauder/config.yaml. Running it again only updates the settings that changed.
+
+With --non-interactive, the answers are read from the CLAUDER_SETUP_AGENT, CLAUDER_SETUP_TUNNEL_PROVIDER, CLAUDER_SETUP_ANTHROPIC_API_KEY, CLAUDER_SETUP_OPENAI_API_KEY and CLAUDER_SETUP_NOTIFICATIONS environment variables. Unset variables keep the current setting.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		path := fileArg
+		if path == "" {
+			var err error
+			if path, err = cfg.DefaultPath(); err != nil {
+				fmt.Fprintf(os.Stderr, "%+v\n", err)
+				os.Exit(1)
+			}
+		}
+		wz := &wizard{out: os.Stdout, lookPath: exec.LookPath}
+		if nonInteractive {
+			wz.prompter = &envPrompter{getenv: os.Getenv}
+		} else {
+			wz.prompter = &terminalPrompter{in: bufio.NewReader(os.Stdin), out: os.Stdout}
+			fmt.Println("👋 Welcome to clauder! Press Enter to keep the value in brackets.")
+		}
+		if err := wz.run(path); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	SetupCmd.Flags().StringVarP(&fileArg, "file", "f", "", "Path of the config file. Defaults to ~/.clauder/config.yaml")
+	SetupCmd.Flags().BoolVar(&nonInteractive, "non-interactive", false, "Read the answers from CLAUDER_SETUP_* environment variables instead of prompting")
+}
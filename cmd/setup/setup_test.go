@@ -0,0 +1,133 @@
+package setup
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	cfg "github.com/zohaibahmed/clauder/lib/config"
+	"gopkg.in/yaml.v3"
+)
+
+// newWizard returns a non-interactive wizard that finds claude and ssh in
+// PATH and answers from vars.
+func newWizard(out *bytes.Buffer, vars map[string]string) *wizard {
+	return &wizard{
+		out:      out,
+		prompter: &envPrompter{getenv: func(key string) string { return vars[key] }},
+		lookPath: func(file string) (string, error) {
+			if file == "claude" || file == "ssh" {
+				return "/usr/bin/" + file, nil
+			}
+			return "", &exec.Error{Name: file, Err: exec.ErrNotFound}
+		},
+	}
+}
+
+func TestNonInteractive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".clauder", "config.yaml")
+	var out bytes.Buffer
+	require.NoError(t, newWizard(&out, map[string]string{
+		"CLAUDER_SETUP_AGENT":             "claude",
+		"CLAUDER_SETUP_TUNNEL_PROVIDER":   "localhost.run",
+		"CLAUDER_SETUP_ANTHROPIC_API_KEY": "sk-ant-test",
+		"CLAUDER_SETUP_NOTIFICATIONS":     "yes",
+	}).run(path))
+	assert.Contains(t, out.String(), "Installed agents: claude")
+	assert.Contains(t, out.String(), "Available providers: localhost.run")
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var raw map[string]any
+	require.NoError(t, yaml.Unmarshal(data, &raw), "the output is valid YAML")
+	c, err := cfg.Parse(data)
+	require.NoError(t, err, "the output is a valid config")
+	assert.Equal(t, "claude", c.Agent)
+	assert.Equal(t, "localhost.run", c.TunnelProvider)
+	assert.Equal(t, "sk-ant-test", c.AnthropicAPIKey)
+	assert.True(t, c.Notifications.Enabled)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm(), "the file holds an API key")
+
+	// Running it again without answers keeps everything.
+	out.Reset()
+	require.NoError(t, newWizard(&out, nil).run(path))
+	assert.Contains(t, out.String(), "No changes")
+	unchanged, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, string(data), string(unchanged))
+}
+
+func TestUpdatesOnlyChangedSections(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	existing := "# my settings\nport: 8080 # not the default\nagent: claude\ntunnel_provider: ngrok\nanthropic_api_key: sk-ant-old\n"
+	require.NoError(t, os.WriteFile(path, []byte(existing), 0o600))
+
+	var out bytes.Buffer
+	require.NoError(t, newWizard(&out, map[string]string{
+		"CLAUDER_SETUP_TUNNEL_PROVIDER": "auto",
+		"CLAUDER_SETUP_NOTIFICATIONS":   "y",
+	}).run(path))
+	assert.Contains(t, out.String(), "Updated tunnel_provider, notifications")
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "# my settings")
+	assert.Contains(t, string(data), "port: 8080 # not the default")
+	assert.NotContains(t, string(data), "tunnel_provider", "auto removes the key")
+	c, err := cfg.Parse(data)
+	require.NoError(t, err)
+	assert.Equal(t, 8080, c.Port)
+	assert.Equal(t, "sk-ant-old", c.AnthropicAPIKey)
+	assert.True(t, c.Notifications.Enabled)
+}
+
+func TestNonInteractiveInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		vars map[string]string
+		want string
+	}{
+		{"agent", map[string]string{"CLAUDER_SETUP_AGENT": "cursor"}, `invalid CLAUDER_SETUP_AGENT: unknown agent "cursor"`},
+		{"tunnel provider", map[string]string{"CLAUDER_SETUP_TUNNEL_PROVIDER": "cloudflared"}, "invalid CLAUDER_SETUP_TUNNEL_PROVIDER"},
+		{"API key", map[string]string{"CLAUDER_SETUP_ANTHROPIC_API_KEY": "not-a-key"}, "an Anthropic API key starts with sk-ant-"},
+		{"notifications", map[string]string{"CLAUDER_SETUP_NOTIFICATIONS": "maybe"}, "answer yes or no"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			var out bytes.Buffer
+			err := newWizard(&out, tc.vars).run(path)
+			assert.ErrorContains(t, err, tc.want)
+			assert.NoFileExists(t, path)
+		})
+	}
+}
+
+func TestInteractiveReprompts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	var out bytes.Buffer
+	wz := newWizard(&out, nil)
+	// codex isn't installed and asks for an OpenAI key
+	wz.prompter = &terminalPrompter{in: bufio.NewReader(strings.NewReader("cursor\ncodex\n\nbad\nsk-openai\nno\n")), out: &out}
+	require.NoError(t, wz.run(path))
+	assert.Contains(t, out.String(), `❌ unknown agent "cursor"`)
+	assert.Contains(t, out.String(), "⚠️  codex isn't installed yet")
+	assert.Contains(t, out.String(), "❌ an OpenAI API key starts with sk-")
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	c, err := cfg.Parse(data)
+	require.NoError(t, err)
+	assert.Equal(t, "codex", c.Agent)
+	assert.Equal(t, "sk-openai", c.OpenAIAPIKey)
+	assert.Empty(t, c.AnthropicAPIKey)
+	assert.False(t, c.Notifications.Enabled)
+}
@@ -0,0 +1,166 @@
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zohaibahmed/clauder/lib/httpapi"
+	"golang.org/x/xerrors"
+)
+
+var (
+	remoteUrlArg  string
+	unixSocketArg string
+	jsonOutput    bool
+)
+
+// errNotRunning is returned when no server could be reached.
+var errNotRunning = errors.New("no clauder server running")
+
+// serverStatus is what `clauder status` reports about a running server.
+type serverStatus struct {
+	httpapi.HealthBody
+	Running bool   `json:"running"`
+	URL     string `json:"url"`
+	// PID is 0 if the server didn't write a PID file.
+	PID int `json:"pid,omitempty"`
+}
+
+// target is a server that may be running.
+type target struct {
+	client *http.Client
+	url    string
+}
+
+// findServer returns the server to query. An explicit URL is used as is.
+// Otherwise the Unix domain socket is preferred, like in `clauder attach`,
+// and the default URL is used if the server wrote a PID file.
+func findServer(url string, urlSet bool, socketPath string, pidFile string) (target, int, bool) {
+	pid, _ := httpapi.ReadPIDFile(pidFile)
+	if urlSet {
+		return target{client: http.DefaultClient, url: url}, pid, true
+	}
+	if conn, err := net.DialTimeout("unix", socketPath, time.Second); err == nil {
+		_ = conn.Close()
+		// the host is ignored by the socket client
+		return target{client: httpapi.UnixSocketClient(socketPath), url: "http://unix"}, pid, true
+	}
+	if pid != 0 {
+		return target{client: http.DefaultClient, url: url}, pid, true
+	}
+	return target{}, 0, false
+}
+
+// fetchHealth queries GET /v1/health on the server.
+func fetchHealth(ctx context.Context, t target) (httpapi.HealthBody, error) {
+	var health httpapi.HealthBody
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.url+"/v1/health", nil)
+	if err != nil {
+		return health, xerrors.Errorf("failed to create request: %w", err)
+	}
+	res, err := t.client.Do(req)
+	if err != nil {
+		return health, xerrors.Errorf("failed to do request: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return health, xerrors.Errorf("unexpected status: %s", res.Status)
+	}
+	if err := json.NewDecoder(res.Body).Decode(&health); err != nil {
+		return health, xerrors.Errorf("failed to decode health response: %w", err)
+	}
+	return health, nil
+}
+
+func getStatus(ctx context.Context, url string, urlSet bool, socketPath string, pidFile string) (serverStatus, error) {
+	t, pid, ok := findServer(url, urlSet, socketPath, pidFile)
+	if !ok {
+		return serverStatus{}, errNotRunning
+	}
+	health, err := fetchHealth(ctx, t)
+	if err != nil {
+		return serverStatus{}, xerrors.Errorf("failed to query %s: %w", t.url, err)
+	}
+	status := serverStatus{HealthBody: health, Running: true, URL: t.url, PID: pid}
+	if t.url == "http://unix" {
+		status.URL = "unix://" + socketPath
+	}
+	return status, nil
+}
+
+// printStatus prints the status as a table.
+func printStatus(w io.Writer, status serverStatus, now time.Time) {
+	orNone := func(value string) string {
+		if value == "" {
+			return "-"
+		}
+		return value
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "URL:\t%s\n", status.URL)
+	if status.PID != 0 {
+		fmt.Fprintf(tw, "PID:\t%d\n", status.PID)
+	}
+	fmt.Fprintf(tw, "Agent type:\t%s\n", orNone(status.AgentType))
+	fmt.Fprintf(tw, "Uptime:\t%s\n", time.Duration(status.UptimeSeconds)*time.Second)
+	fmt.Fprintf(tw, "Tunnel URL:\t%s\n", orNone(status.TunnelURL))
+	fmt.Fprintf(tw, "SSE clients:\t%d\n", status.SSEClients)
+	lastMessage := "-"
+	if !status.LastMessageTime.IsZero() {
+		lastMessage = fmt.Sprintf("%s (%s ago)", status.LastMessageTime.Local().Format(time.DateTime), now.Sub(status.LastMessageTime).Round(time.Second))
+	}
+	fmt.Fprintf(tw, "Last message:\t%s\n", lastMessage)
+	_ = tw.Flush()
+}
+
+var StatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the status of a running server",
+	Long:  `Show the status of a running server. If no URL is given, the server is found through its Unix domain socket or the PID file it writes to ~/.clauder/server.pid.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		url := remoteUrlArg
+		if !strings.HasPrefix(url, "http") {
+			url = "http://" + url
+		}
+		url = strings.TrimRight(url, "/")
+		socketPath := unixSocketArg
+		if socketPath == "" {
+			socketPath, _ = httpapi.DefaultUnixSocketPath()
+		}
+		pidFile, _ := httpapi.DefaultPIDFilePath()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		status, err := getStatus(ctx, url, cmd.Flags().Changed("url"), socketPath, pidFile)
+		if err != nil {
+			if jsonOutput {
+				fmt.Println(`{"running":false}`)
+			} else {
+				fmt.Println("No clauder server running.")
+			}
+			os.Exit(1)
+		}
+		if jsonOutput {
+			out, _ := json.MarshalIndent(status, "", "  ")
+			fmt.Println(string(out))
+			return
+		}
+		printStatus(os.Stdout, status, time.Now())
+	},
+}
+
+func init() {
+	StatusCmd.Flags().StringVarP(&remoteUrlArg, "url", "u", "localhost:3284", "URL of the clauder server. May optionally include a protocol")
+	StatusCmd.Flags().StringVar(&unixSocketArg, "unix-socket", "", "Path of the server's Unix domain socket. Defaults to ~/.clauder/clauder.sock. Ignored if --url is set")
+	StatusCmd.Flags().BoolVar(&jsonOutput, "json", false, "Print the status as JSON")
+}
@@ -0,0 +1,111 @@
+package status
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/httpapi"
+)
+
+func newMockServer(t *testing.T, health httpapi.HealthBody) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/health" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(health)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestGetStatus(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	socketPath := filepath.Join(dir, "clauder.sock")
+	pidFile := filepath.Join(dir, "server.pid")
+	lastMessage := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	health := httpapi.HealthBody{
+		Status:          "ok",
+		AgentType:       "claude",
+		UptimeSeconds:   3723,
+		TunnelURL:       "https://example.trycloudflare.com",
+		SSEClients:      2,
+		LastMessageTime: lastMessage,
+	}
+	srv := newMockServer(t, health)
+
+	t.Run("no server", func(t *testing.T) {
+		_, err := getStatus(ctx, srv.URL, false, socketPath, pidFile)
+		assert.ErrorIs(t, err, errNotRunning)
+	})
+
+	t.Run("explicit URL", func(t *testing.T) {
+		status, err := getStatus(ctx, srv.URL, true, socketPath, pidFile)
+		require.NoError(t, err)
+		assert.Equal(t, serverStatus{HealthBody: health, Running: true, URL: srv.URL}, status)
+	})
+
+	t.Run("PID file", func(t *testing.T) {
+		removePIDFile, err := httpapi.WritePIDFile(pidFile)
+		require.NoError(t, err)
+		status, err := getStatus(ctx, srv.URL, false, socketPath, pidFile)
+		require.NoError(t, err)
+		assert.Equal(t, os.Getpid(), status.PID)
+		assert.Equal(t, "claude", status.AgentType)
+
+		require.NoError(t, removePIDFile())
+		_, err = getStatus(ctx, srv.URL, false, socketPath, pidFile)
+		assert.ErrorIs(t, err, errNotRunning)
+	})
+
+	t.Run("stale PID file", func(t *testing.T) {
+		removePIDFile, err := httpapi.WritePIDFile(pidFile)
+		require.NoError(t, err)
+		defer removePIDFile()
+		srv := httptest.NewServer(http.NotFoundHandler())
+		srv.Close()
+		_, err = getStatus(ctx, srv.URL, false, socketPath, pidFile)
+		assert.Error(t, err)
+	})
+
+	t.Run("table", func(t *testing.T) {
+		var out bytes.Buffer
+		status := serverStatus{HealthBody: health, Running: true, URL: srv.URL, PID: 42}
+		printStatus(&out, status, lastMessage.Add(90*time.Second))
+		assert.Contains(t, out.String(), "PID:           42\n")
+		assert.Contains(t, out.String(), "Agent type:    claude\n")
+		assert.Contains(t, out.String(), "Uptime:        1h2m3s\n")
+		assert.Contains(t, out.String(), "Tunnel URL:    https://example.trycloudflare.com\n")
+		assert.Contains(t, out.String(), "SSE clients:   2\n")
+		assert.Contains(t, out.String(), "(1m30s ago)\n")
+	})
+
+	t.Run("json", func(t *testing.T) {
+		status, err := getStatus(ctx, srv.URL, true, socketPath, pidFile)
+		require.NoError(t, err)
+		out, err := json.Marshal(status)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{
+			"status": "ok",
+			"agent_type": "claude",
+			"uptime_seconds": 3723,
+			"tunnel_url": "https://example.trycloudflare.com",
+			"sse_clients": 2,
+			"last_message_time": "2025-01-01T12:00:00Z",
+			"running": true,
+			"url": "`+srv.URL+`"
+		}`, string(out))
+	})
+}
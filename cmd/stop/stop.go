@@ -0,0 +1,89 @@
+package stop
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zohaibahmed/clauder/lib/httpapi"
+	"golang.org/x/xerrors"
+)
+
+var timeoutArg time.Duration
+
+// errNotRunning is returned when the PID file doesn't point to a running
+// process.
+var errNotRunning = errors.New("no clauder server running")
+
+// pollInterval is how often stopServer checks whether the server exited.
+const pollInterval = 100 * time.Millisecond
+
+// stopServer asks the server whose PID is in pidFile to shut down
+// gracefully, and kills it if it's still running after timeout.
+func stopServer(w io.Writer, pidFile string, timeout time.Duration) error {
+	pid, err := httpapi.ReadPIDFile(pidFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return errNotRunning
+	}
+	if err != nil {
+		return err
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil || !isAlive(process) {
+		// the server was killed before it could remove its PID file
+		_ = os.Remove(pidFile)
+		return errNotRunning
+	}
+
+	fmt.Fprintf(w, "Stopping clauder server (PID %d)...\n", pid)
+	if err := terminate(process); err != nil {
+		return xerrors.Errorf("failed to signal process %d: %w", pid, err)
+	}
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if !isAlive(process) {
+			fmt.Fprintln(w, "Server stopped.")
+			return nil
+		}
+		time.Sleep(pollInterval)
+	}
+
+	fmt.Fprintf(w, "Server didn't stop within %s, killing it.\n", timeout)
+	if err := process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return xerrors.Errorf("failed to kill process %d: %w", pid, err)
+	}
+	if err := os.Remove(pidFile); err != nil && !os.IsNotExist(err) {
+		return xerrors.Errorf("failed to remove PID file: %w", err)
+	}
+	fmt.Fprintln(w, "Server killed.")
+	return nil
+}
+
+var StopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Stop a running server",
+	Long:  `Stop the server whose PID is in ~/.clauder/server.pid. The server is asked to shut down gracefully, notifying its SSE subscribers, and is killed if it doesn't exit within the timeout.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		pidFile, err := httpapi.DefaultPIDFilePath()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%+v\n", err)
+			os.Exit(1)
+		}
+		if err := stopServer(os.Stdout, pidFile, timeoutArg); err != nil {
+			if errors.Is(err, errNotRunning) {
+				fmt.Println("No clauder server running.")
+			} else {
+				fmt.Fprintf(os.Stderr, "%+v\n", err)
+			}
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	StopCmd.Flags().DurationVar(&timeoutArg, "timeout", 10*time.Second, "How long to wait for the server to shut down before killing it")
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+
+package stop
+
+import (
+	"os"
+	"syscall"
+)
+
+// terminate asks the process to shut down. The server stops gracefully on
+// SIGTERM.
+func terminate(process *os.Process) error {
+	return process.Signal(syscall.SIGTERM)
+}
+
+func isAlive(process *os.Process) bool {
+	// Signal 0 performs error checking without sending a signal.
+	return process.Signal(syscall.Signal(0)) == nil
+}
@@ -0,0 +1,112 @@
+//go:build !windows
+
+package stop
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestHelperProcess isn't a real test. It's started by startServerProcess
+// to stand in for a server.
+func TestHelperProcess(t *testing.T) {
+	mode := os.Getenv("CLAUDER_STOP_HELPER")
+	if mode == "" {
+		t.Skip("helper process")
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM)
+	if mode == "ignore-sigterm" {
+		signal.Ignore(syscall.SIGTERM)
+	}
+	os.Stdout.WriteString("ready\n")
+	select {
+	case <-signals:
+		os.Exit(0)
+	case <-time.After(time.Minute):
+		os.Exit(1)
+	}
+}
+
+// startServerProcess starts a process that exits on SIGTERM, or ignores it,
+// and writes its PID file. The returned channel is closed once it exited.
+func startServerProcess(t *testing.T, mode string) (string, <-chan struct{}) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestHelperProcess$")
+	cmd.Env = append(os.Environ(), "CLAUDER_STOP_HELPER="+mode)
+	stdout, err := cmd.StdoutPipe()
+	require.NoError(t, err)
+	require.NoError(t, cmd.Start())
+	t.Cleanup(func() { _ = cmd.Process.Kill() })
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "ready\n", line)
+
+	// reap the process, or it would stay alive as a zombie
+	exited := make(chan struct{})
+	go func() {
+		_ = cmd.Wait()
+		close(exited)
+	}()
+
+	pidFile := filepath.Join(t.TempDir(), "server.pid")
+	require.NoError(t, os.WriteFile(pidFile, []byte(strconv.Itoa(cmd.Process.Pid)+"\n"), 0o600))
+	return pidFile, exited
+}
+
+func TestStopServer(t *testing.T) {
+	t.Run("graceful", func(t *testing.T) {
+		pidFile, exited := startServerProcess(t, "exit-on-sigterm")
+		var out bytes.Buffer
+		require.NoError(t, stopServer(&out, pidFile, 10*time.Second))
+		select {
+		case <-exited:
+		case <-time.After(time.Second):
+			t.Fatal("process didn't exit")
+		}
+		assert.Contains(t, out.String(), "Server stopped.")
+	})
+
+	t.Run("killed after timeout", func(t *testing.T) {
+		pidFile, exited := startServerProcess(t, "ignore-sigterm")
+		var out bytes.Buffer
+		require.NoError(t, stopServer(&out, pidFile, 300*time.Millisecond))
+		select {
+		case <-exited:
+		case <-time.After(time.Second):
+			t.Fatal("process wasn't killed")
+		}
+		assert.Contains(t, out.String(), "Server killed.")
+		assert.NoFileExists(t, pidFile)
+	})
+
+	t.Run("no PID file", func(t *testing.T) {
+		err := stopServer(&bytes.Buffer{}, filepath.Join(t.TempDir(), "server.pid"), time.Second)
+		assert.ErrorIs(t, err, errNotRunning)
+	})
+
+	t.Run("stale PID file", func(t *testing.T) {
+		pidFile, exited := startServerProcess(t, "exit-on-sigterm")
+		pid, err := os.ReadFile(pidFile)
+		require.NoError(t, err)
+		p, err := strconv.Atoi(string(bytes.TrimSpace(pid)))
+		require.NoError(t, err)
+		require.NoError(t, syscall.Kill(p, syscall.SIGKILL))
+		<-exited
+
+		err = stopServer(&bytes.Buffer{}, pidFile, time.Second)
+		assert.ErrorIs(t, err, errNotRunning)
+		assert.NoFileExists(t, pidFile, "a stale PID file is removed")
+	})
+}
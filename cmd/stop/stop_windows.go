@@ -0,0 +1,32 @@
+//go:build windows
+
+package stop
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// stillActive is the exit code GetExitCodeProcess reports for a running process.
+const stillActive = 259
+
+// terminate kills the process. Windows has no equivalent of SIGTERM that
+// can be sent to a process without a console, so use POST /admin/shutdown
+// to stop the server gracefully.
+func terminate(process *os.Process) error {
+	return process.Kill()
+}
+
+func isAlive(process *os.Process) bool {
+	handle, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(process.Pid))
+	if err != nil {
+		return false
+	}
+	defer windows.CloseHandle(handle)
+	var exitCode uint32
+	if err := windows.GetExitCodeProcess(handle, &exitCode); err != nil {
+		return false
+	}
+	return exitCode == stillActive
+}
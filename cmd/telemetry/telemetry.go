@@ -0,0 +1,403 @@
+package telemetry
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zohaibahmed/clauder/cmd/version"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	mf "github.com/zohaibahmed/clauder/lib/msgfmt"
+	"github.com/zohaibahmed/clauder/lib/tunnel"
+	"golang.org/x/xerrors"
+)
+
+const (
+	eventURL = "https://telemetry.claudecode.app/v1/event"
+	// sendTimeout is how long sending an event may take. Events are sent
+	// in the background, so a slow telemetry server doesn't delay anything.
+	sendTimeout = 5 * time.Second
+	// categoryEpsilon is the privacy parameter of the randomised response
+	// on the agent type and the tunnel provider: the reported one is the
+	// real one with a probability of only e^ε/(e^ε+k-1) for k categories.
+	categoryEpsilon = 1.0
+	// durationEpsilon and durationSensitivity are the privacy parameters of
+	// the Laplace noise added to the session duration: sessions whose
+	// durations differ by up to durationSensitivity are indistinguishable
+	// up to a factor of e^ε.
+	durationEpsilon     = 1.0
+	durationSensitivity = 600.0
+)
+
+// agentTypes are the agent types that are reported. Other agent types, e.g.
+// the ones of a custom formatter registry, are reported as custom so that
+// their names don't identify the user.
+var agentTypes = []string{
+	string(mf.AgentTypeClaude),
+	string(mf.AgentTypeGoose),
+	string(mf.AgentTypeAider),
+	string(mf.AgentTypeCodex),
+	string(mf.AgentTypeGemini),
+	string(mf.AgentTypeCustom),
+}
+
+// tunnelProviders are the tunnel providers that are reported. none means
+// that the server isn't reachable through a tunnel, and other providers
+// are reported as other.
+var tunnelProviders = []string{
+	"none",
+	string(tunnel.ProviderLocal),
+	string(tunnel.ProviderBore),
+	string(tunnel.ProviderNgrok),
+	string(tunnel.ProviderCodespaces),
+	string(tunnel.ProviderVSCode),
+	"other",
+}
+
+// settings is the user's choice, as saved in ~/.clauder/telemetry.json.
+type settings struct {
+	Enabled bool `json:"enabled"`
+}
+
+// Event is the anonymous event sent when a session starts.
+type Event struct {
+	Event          string `json:"event"`
+	AgentType      string `json:"agent_type"`
+	TunnelProvider string `json:"tunnel_provider"`
+	Version        string `json:"version"`
+	// SessionDurationS is only set on session_end events. Laplace noise is
+	// added to it, so it may even be negative.
+	SessionDurationS *float64 `json:"session_duration_s,omitempty"`
+}
+
+type reporter struct {
+	client       *http.Client
+	eventURL     string
+	settingsPath string
+	// randFloat and randIntN are replaced in tests.
+	randFloat func() float64
+	randIntN  func(n int) int
+}
+
+func defaultSettingsPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", xerrors.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".clauder", "telemetry.json"), nil
+}
+
+func newReporter() (*reporter, error) {
+	settingsPath, err := defaultSettingsPath()
+	if err != nil {
+		return nil, err
+	}
+	return &reporter{
+		client:       &http.Client{Timeout: sendTimeout},
+		eventURL:     eventURL,
+		settingsPath: settingsPath,
+		randFloat:    rand.Float64,
+		randIntN:     rand.IntN,
+	}, nil
+}
+
+// disabledByEnv reports whether the user opted out of telemetry with
+// CLAUDER_NO_TELEMETRY=1, which overrides telemetry.json.
+func disabledByEnv() bool {
+	return os.Getenv("CLAUDER_NO_TELEMETRY") == "1"
+}
+
+// readSettings returns the saved settings, and false if the user hasn't
+// been asked yet.
+func (r *reporter) readSettings() (settings, bool, error) {
+	var s settings
+	data, err := os.ReadFile(r.settingsPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, false, nil
+	}
+	if err != nil {
+		return s, false, xerrors.Errorf("failed to read telemetry settings: %w", err)
+	}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return s, false, xerrors.Errorf("invalid telemetry settings %s: %w", r.settingsPath, err)
+	}
+	return s, true, nil
+}
+
+func (r *reporter) writeSettings(s settings) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return xerrors.Errorf("failed to marshal telemetry settings: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(r.settingsPath), 0o700); err != nil {
+		return xerrors.Errorf("failed to create telemetry settings directory: %w", err)
+	}
+	if err := os.WriteFile(r.settingsPath, data, 0o600); err != nil {
+		return xerrors.Errorf("failed to write telemetry settings: %w", err)
+	}
+	return nil
+}
+
+// askOnFirstRun asks the user whether to enable telemetry and saves the
+// answer, unless they answered before. Anything but yes disables it.
+func (r *reporter) askOnFirstRun(in io.Reader, out io.Writer) error {
+	if _, asked, err := r.readSettings(); err != nil || asked {
+		return err
+	}
+	fmt.Fprintln(out, "Help improve clauder by sending an anonymous event when a session starts?")
+	fmt.Fprintln(out, "It only contains the agent type, the tunnel provider and the session duration, all randomised for privacy, and the clauder version.")
+	fmt.Fprint(out, "Change your mind anytime with `clauder telemetry on|off`. Enable telemetry? [y/N]: ")
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && answer != "") {
+		return xerrors.Errorf("failed to read answer: %w", err)
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return r.writeSettings(settings{Enabled: answer == "y" || answer == "yes"})
+}
+
+// randomizedResponse applies randomised response to value, one of the k
+// categories: it's kept with a probability of e^ε/(e^ε+k-1), and otherwise
+// replaced with one of the k-1 other categories picked uniformly. Every
+// category is thus at most e^ε times as likely to be reported for one real
+// value as for another, which gives every user plausible deniability, while
+// the overall usage can still be estimated from many sessions.
+func (r *reporter) randomizedResponse(categories []string, value string) string {
+	k := float64(len(categories))
+	keep := math.Exp(categoryEpsilon) / (math.Exp(categoryEpsilon) + k - 1)
+	if r.randFloat() < keep {
+		return value
+	}
+	others := slices.DeleteFunc(slices.Clone(categories), func(c string) bool { return c == value })
+	return others[r.randIntN(len(others))]
+}
+
+// randomizeAgentType applies randomised response to agentType. Agent types
+// that aren't reported are treated as custom.
+func (r *reporter) randomizeAgentType(agentType string) string {
+	if !slices.Contains(agentTypes, agentType) {
+		agentType = string(mf.AgentTypeCustom)
+	}
+	return r.randomizedResponse(agentTypes, agentType)
+}
+
+// randomizeTunnelProvider applies randomised response to tunnelProvider,
+// which is "" if the server isn't reachable through a tunnel. Tunnel
+// providers that aren't reported are treated as other.
+func (r *reporter) randomizeTunnelProvider(tunnelProvider string) string {
+	switch {
+	case tunnelProvider == "":
+		tunnelProvider = "none"
+	case !slices.Contains(tunnelProviders, tunnelProvider):
+		tunnelProvider = "other"
+	}
+	return r.randomizedResponse(tunnelProviders, tunnelProvider)
+}
+
+// laplaceNoise returns noise drawn from the Laplace distribution with a scale
+// of b = Δ/ε, by inverting its CDF: -b·sgn(U-½)·ln(1-2|U-½|) for U uniform
+// in [0, 1). Adding it to a value that one user can change by at most Δ
+// makes the result ε-differentially private: any reported value is at most
+// e^ε times as likely for one of two such values as for the other. The
+// noise is 0 on average, and larger than b·ln(1/p) in magnitude with a
+// probability of only p, e.g. more than b·ln(20) ≈ 3b 5% of the time.
+func (r *reporter) laplaceNoise(sensitivity, epsilon float64) float64 {
+	u := r.randFloat()
+	for u == 0 {
+		// ln(0) is infinite
+		u = r.randFloat()
+	}
+	sign := 1.0
+	if u < 0.5 {
+		sign = -1.0
+	}
+	return -sign * math.Log(1-2*math.Abs(u-0.5)) * sensitivity / epsilon
+}
+
+// randomizeDuration adds Laplace noise with a scale of 10 minutes to the
+// session duration, rounded to the second. Sessions whose durations differ
+// by up to 10 minutes are thus indistinguishable up to a factor of e, and
+// longer differences are only hidden proportionally less, e.g. up to a
+// factor of e^6 for an hour, while the average duration of many sessions
+// can still be estimated.
+func (r *reporter) randomizeDuration(duration time.Duration) float64 {
+	return math.Round(duration.Seconds() + r.laplaceNoise(durationSensitivity, durationEpsilon))
+}
+
+// Session is a session whose events are reported. Its agent type and tunnel
+// provider are randomised once, when it starts, and every event of the
+// session reports the same ones: randomising them again for every event
+// would let the real ones be guessed from the most frequent ones, undoing
+// the plausible deniability.
+type Session struct {
+	reporter       *reporter
+	agentType      string
+	tunnelProvider string
+	started        time.Time
+}
+
+// newSession starts a session with a randomised agent type and tunnel
+// provider.
+func (r *reporter) newSession(agentType, tunnelProvider string) *Session {
+	return &Session{
+		reporter:       r,
+		agentType:      r.randomizeAgentType(agentType),
+		tunnelProvider: r.randomizeTunnelProvider(tunnelProvider),
+		started:        time.Now(),
+	}
+}
+
+// start sends the session_start event if the user enabled telemetry. It
+// returns false if it didn't send one.
+func (s *Session) start(ctx context.Context) (bool, error) {
+	return s.reporter.send(ctx, Event{
+		Event:          "session_start",
+		AgentType:      s.agentType,
+		TunnelProvider: s.tunnelProvider,
+	})
+}
+
+// end sends the session_end event with the randomised duration of the
+// session if the user enabled telemetry. It returns false if it didn't send
+// one.
+func (s *Session) end(ctx context.Context, duration time.Duration) (bool, error) {
+	noisyDuration := s.reporter.randomizeDuration(duration)
+	return s.reporter.send(ctx, Event{
+		Event:            "session_end",
+		AgentType:        s.agentType,
+		TunnelProvider:   s.tunnelProvider,
+		SessionDurationS: &noisyDuration,
+	})
+}
+
+// send sends event if the user enabled telemetry. It returns false if it
+// didn't send it.
+func (r *reporter) send(ctx context.Context, event Event) (bool, error) {
+	if disabledByEnv() {
+		return false, nil
+	}
+	s, _, err := r.readSettings()
+	if err != nil || !s.Enabled {
+		return false, err
+	}
+	event.Version = version.Version
+	data, err := json.Marshal(event)
+	if err != nil {
+		return false, xerrors.Errorf("failed to marshal event: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.eventURL, bytes.NewReader(data))
+	if err != nil {
+		return false, xerrors.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "clauder/"+version.Version)
+	res, err := r.client.Do(req)
+	if err != nil {
+		return false, xerrors.Errorf("failed to send event: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return false, xerrors.Errorf("failed to send event: unexpected status: %s", res.Status)
+	}
+	return true, nil
+}
+
+// AskOnFirstRun asks the user on the terminal whether to enable telemetry,
+// unless they answered before or opted out with CLAUDER_NO_TELEMETRY=1. The
+// caller checks that in and out are a terminal.
+func AskOnFirstRun(in io.Reader, out io.Writer) error {
+	if disabledByEnv() {
+		return nil
+	}
+	r, err := newReporter()
+	if err != nil {
+		return err
+	}
+	return r.askOnFirstRun(in, out)
+}
+
+// SessionStart starts a session, and sends its anonymous session_start event
+// in the background if the user enabled telemetry. tunnelProvider is "" if
+// the server isn't reachable through a tunnel. Failures are only logged at
+// debug level.
+func SessionStart(ctx context.Context, agentType, tunnelProvider string) *Session {
+	logger := logctx.From(ctx)
+	r, err := newReporter()
+	if err != nil {
+		logger.Debug("Failed to send telemetry", "error", err)
+		return nil
+	}
+	s := r.newSession(agentType, tunnelProvider)
+	go func() {
+		if _, err := s.start(context.WithoutCancel(ctx)); err != nil {
+			logger.Debug("Failed to send telemetry", "error", err)
+		}
+	}()
+	return s
+}
+
+// End sends the anonymous session_end event, with the duration of the
+// session, if the user enabled telemetry. It's sent before returning, since
+// the process is about to exit, and gives up after sendTimeout. Failures
+// are only logged at debug level. It does nothing on a nil session, which
+// SessionStart returns if it failed.
+func (s *Session) End(ctx context.Context) {
+	if s == nil {
+		return
+	}
+	if _, err := s.end(context.WithoutCancel(ctx), time.Since(s.started)); err != nil {
+		logctx.From(ctx).Debug("Failed to send telemetry", "error", err)
+	}
+}
+
+var TelemetryCmd = &cobra.Command{
+	Use:       "telemetry [on|off]",
+	Short:     "Enable or disable anonymous telemetry",
+	Long:      `Enable or disable the anonymous events sent when a session starts and ends, or print whether they're enabled. The events only contain the agent type, the tunnel provider and the session duration, all randomised so that they can't be attributed to a user, and the clauder version. The choice is saved in ~/.clauder/telemetry.json. Setting CLAUDER_NO_TELEMETRY=1 disables telemetry regardless.`,
+	Args:      cobra.MatchAll(cobra.MaximumNArgs(1), cobra.OnlyValidArgs),
+	ValidArgs: []string{"on", "off"},
+	Run: func(cmd *cobra.Command, args []string) {
+		r, err := newReporter()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%+v\n", err)
+			os.Exit(1)
+		}
+		if err := runTelemetry(os.Stdout, r, args); err != nil {
+			fmt.Fprintf(os.Stderr, "%+v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func runTelemetry(w io.Writer, r *reporter, args []string) error {
+	if len(args) == 1 {
+		if err := r.writeSettings(settings{Enabled: args[0] == "on"}); err != nil {
+			return err
+		}
+	}
+	s, _, err := r.readSettings()
+	if err != nil {
+		return err
+	}
+	switch {
+	case disabledByEnv():
+		fmt.Fprintln(w, "telemetry is disabled by CLAUDER_NO_TELEMETRY")
+	case s.Enabled:
+		fmt.Fprintln(w, "telemetry is enabled")
+	default:
+		fmt.Fprintln(w, "telemetry is disabled")
+	}
+	return nil
+}
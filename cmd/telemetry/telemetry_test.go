@@ -0,0 +1,265 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/cmd/version"
+)
+
+// newMockTelemetry records the events it receives.
+func newMockTelemetry(t *testing.T) (*httptest.Server, *[]Event) {
+	t.Helper()
+	var events []Event
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/event" {
+			http.NotFound(w, r)
+			return
+		}
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		var event Event
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+		events = append(events, event)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &events
+}
+
+func newTestReporter(t *testing.T, srv *httptest.Server) *reporter {
+	t.Helper()
+	rnd := rand.New(rand.NewPCG(1, 2))
+	return &reporter{
+		client:       srv.Client(),
+		eventURL:     srv.URL + "/v1/event",
+		settingsPath: filepath.Join(t.TempDir(), ".clauder", "telemetry.json"),
+		randFloat:    rnd.Float64,
+		randIntN:     rnd.IntN,
+	}
+}
+
+func TestSessionStart(t *testing.T) {
+	t.Setenv("CLAUDER_NO_TELEMETRY", "")
+	srv, events := newMockTelemetry(t)
+	r := newTestReporter(t, srv)
+	// the agent type and tunnel provider are always kept
+	r.randFloat = func() float64 { return 0 }
+
+	// nothing is sent before the user enabled telemetry
+	sent, err := r.newSession("claude", "localhost.run").start(context.Background())
+	require.NoError(t, err)
+	assert.False(t, sent)
+	require.NoError(t, runTelemetry(&bytes.Buffer{}, r, []string{"off"}))
+	sent, err = r.newSession("claude", "localhost.run").start(context.Background())
+	require.NoError(t, err)
+	assert.False(t, sent)
+	assert.Empty(t, *events)
+
+	require.NoError(t, runTelemetry(&bytes.Buffer{}, r, []string{"on"}))
+	sent, err = r.newSession("claude", "localhost.run").start(context.Background())
+	require.NoError(t, err)
+	assert.True(t, sent)
+	_, err = r.newSession("my-agent", "").start(context.Background())
+	require.NoError(t, err)
+	_, err = r.newSession("claude", "my-tunnel").start(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []Event{
+		{Event: "session_start", AgentType: "claude", TunnelProvider: "localhost.run", Version: version.Version},
+		{Event: "session_start", AgentType: "custom", TunnelProvider: "none", Version: version.Version},
+		{Event: "session_start", AgentType: "claude", TunnelProvider: "other", Version: version.Version},
+	}, *events)
+
+	// the environment variable overrides the settings
+	t.Setenv("CLAUDER_NO_TELEMETRY", "1")
+	sent, err = r.newSession("claude", "localhost.run").start(context.Background())
+	require.NoError(t, err)
+	assert.False(t, sent)
+	assert.Len(t, *events, 3)
+}
+
+func TestRandomizedResponse(t *testing.T) {
+	srv, _ := newMockTelemetry(t)
+	r := newTestReporter(t, srv)
+	for _, tc := range []struct {
+		categories []string
+		value      string
+		randomize  func(string) string
+	}{
+		{agentTypes, "goose", r.randomizeAgentType},
+		{tunnelProviders, "bore", r.randomizeTunnelProvider},
+	} {
+		const samples = 60000
+		counts := map[string]int{}
+		for range samples {
+			counts[tc.randomize(tc.value)]++
+		}
+		assert.Len(t, counts, len(tc.categories))
+		keep := math.E / (math.E + float64(len(tc.categories)-1))
+		assert.InDelta(t, keep, float64(counts[tc.value])/samples, 0.01)
+		// the other categories are reported equally often
+		for _, category := range tc.categories {
+			if category != tc.value {
+				assert.InDelta(t, (1-keep)/float64(len(tc.categories)-1), float64(counts[category])/samples, 0.01, category)
+			}
+		}
+	}
+}
+
+func TestSessionRandomizesOnce(t *testing.T) {
+	t.Setenv("CLAUDER_NO_TELEMETRY", "")
+	srv, events := newMockTelemetry(t)
+	r := newTestReporter(t, srv)
+	require.NoError(t, runTelemetry(&bytes.Buffer{}, r, []string{"on"}))
+
+	// every event of a session reports the same agent type and tunnel
+	// provider, so that the real ones can't be guessed from many events
+	agentTypeCounts := map[string]int{}
+	for range 20 {
+		session := r.newSession("claude", "bore")
+		_, err := session.start(context.Background())
+		require.NoError(t, err)
+		for range 10 {
+			_, err = session.end(context.Background(), time.Minute)
+			require.NoError(t, err)
+		}
+		require.Len(t, *events, 11)
+		for _, event := range *events {
+			assert.Equal(t, session.agentType, event.AgentType)
+			assert.Equal(t, session.tunnelProvider, event.TunnelProvider)
+		}
+		agentTypeCounts[session.agentType]++
+		*events = nil
+	}
+	// while sessions are randomised independently
+	assert.Greater(t, len(agentTypeCounts), 1)
+}
+
+func TestLaplaceNoise(t *testing.T) {
+	srv, _ := newMockTelemetry(t)
+	r := newTestReporter(t, srv)
+	const samples = 100000
+	scale := durationSensitivity / durationEpsilon
+	var sum, sumAbs float64
+	beyond := 0
+	for range samples {
+		noise := r.laplaceNoise(durationSensitivity, durationEpsilon)
+		sum += noise
+		sumAbs += math.Abs(noise)
+		if math.Abs(noise) > 3*scale {
+			beyond++
+		}
+	}
+	// the noise is 0 on average, its magnitude is the scale on average, and
+	// it's larger than 3 times the scale with a probability of e^-3
+	assert.InDelta(t, 0, sum/samples, 15)
+	assert.InEpsilon(t, scale, sumAbs/samples, 0.02)
+	assert.InDelta(t, math.Exp(-3), float64(beyond)/samples, 0.005)
+
+	values := []float64{0, 0.75}
+	r.randFloat = func() float64 {
+		v := values[0]
+		values = values[1:]
+		return v
+	}
+	assert.InDelta(t, scale*math.Ln2, r.laplaceNoise(durationSensitivity, durationEpsilon), 1e-9, "0 is skipped")
+	r.randFloat = func() float64 { return 0.25 }
+	assert.InDelta(t, -scale*math.Ln2, r.laplaceNoise(durationSensitivity, durationEpsilon), 1e-9)
+	r.randFloat = func() float64 { return 0.5 }
+	assert.Zero(t, r.laplaceNoise(durationSensitivity, durationEpsilon))
+}
+
+func TestSessionEnd(t *testing.T) {
+	t.Setenv("CLAUDER_NO_TELEMETRY", "")
+	srv, events := newMockTelemetry(t)
+	r := newTestReporter(t, srv)
+
+	session := r.newSession("claude", "bore")
+	sent, err := session.end(context.Background(), time.Hour)
+	require.NoError(t, err)
+	assert.False(t, sent)
+
+	require.NoError(t, runTelemetry(&bytes.Buffer{}, r, []string{"on"}))
+	for range 200 {
+		sent, err = r.newSession("claude", "bore").end(context.Background(), time.Hour)
+		require.NoError(t, err)
+		assert.True(t, sent)
+	}
+	require.Len(t, *events, 200)
+	var sum float64
+	for _, event := range *events {
+		assert.Equal(t, "session_end", event.Event)
+		assert.Contains(t, tunnelProviders, event.TunnelProvider)
+		assert.Equal(t, version.Version, event.Version)
+		require.NotNil(t, event.SessionDurationS)
+		duration := *event.SessionDurationS
+		assert.Equal(t, math.Round(duration), duration, "the duration is rounded to the second")
+		// the noise exceeds 10 times the scale with a probability of e^-10
+		assert.InDelta(t, 3600, duration, 10*durationSensitivity/durationEpsilon)
+		sum += duration
+	}
+	assert.InDelta(t, 3600, sum/200, 150)
+}
+
+func TestAskOnFirstRun(t *testing.T) {
+	srv, _ := newMockTelemetry(t)
+	r := newTestReporter(t, srv)
+
+	var out bytes.Buffer
+	require.NoError(t, r.askOnFirstRun(strings.NewReader("y\n"), &out))
+	assert.Contains(t, out.String(), "Enable telemetry? [y/N]")
+	s, asked, err := r.readSettings()
+	require.NoError(t, err)
+	assert.True(t, asked)
+	assert.True(t, s.Enabled)
+
+	// the user is only asked once
+	out.Reset()
+	require.NoError(t, r.askOnFirstRun(strings.NewReader("n\n"), &out))
+	assert.Empty(t, out.String())
+	s, _, err = r.readSettings()
+	require.NoError(t, err)
+	assert.True(t, s.Enabled)
+
+	// anything but yes disables telemetry
+	r = newTestReporter(t, srv)
+	require.NoError(t, r.askOnFirstRun(strings.NewReader("\n"), &out))
+	s, asked, err = r.readSettings()
+	require.NoError(t, err)
+	assert.True(t, asked)
+	assert.False(t, s.Enabled)
+}
+
+func TestRunTelemetry(t *testing.T) {
+	t.Setenv("CLAUDER_NO_TELEMETRY", "")
+	srv, _ := newMockTelemetry(t)
+	r := newTestReporter(t, srv)
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{nil, "telemetry is disabled\n"},
+		{[]string{"on"}, "telemetry is enabled\n"},
+		{nil, "telemetry is enabled\n"},
+		{[]string{"off"}, "telemetry is disabled\n"},
+	} {
+		var out bytes.Buffer
+		require.NoError(t, runTelemetry(&out, r, tc.args))
+		assert.Equal(t, tc.want, out.String(), tc.args)
+	}
+
+	t.Setenv("CLAUDER_NO_TELEMETRY", "1")
+	var out bytes.Buffer
+	require.NoError(t, runTelemetry(&out, r, []string{"on"}))
+	assert.Equal(t, "telemetry is disabled by CLAUDER_NO_TELEMETRY\n", out.String())
+}
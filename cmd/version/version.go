@@ -0,0 +1,225 @@
+package version
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+)
+
+// Version is the version of clauder.
+const Version = "0.2.3"
+
+const (
+	latestReleaseURL = "https://api.github.com/repos/zohaibahmed/clauder/releases/latest"
+	// updateCheckTTL is how long the latest release is cached, to stay well
+	// below GitHub's rate limit for unauthenticated requests.
+	updateCheckTTL = 24 * time.Hour
+)
+
+var checkArg bool
+
+// updateCheck is the latest release, as cached in ~/.clauder/update_check.json.
+type updateCheck struct {
+	CheckedAt     time.Time `json:"checked_at"`
+	LatestVersion string    `json:"latest_version"`
+	URL           string    `json:"url"`
+}
+
+type updateChecker struct {
+	client    *http.Client
+	apiURL    string
+	cachePath string
+	now       func() time.Time
+}
+
+func defaultCachePath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", xerrors.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".clauder", "update_check.json"), nil
+}
+
+// latest returns the latest release, from the cache if it was checked less
+// than updateCheckTTL ago.
+func (c *updateChecker) latest(ctx context.Context) (updateCheck, error) {
+	if cached, err := c.readCache(); err == nil && c.now().Sub(cached.CheckedAt) < updateCheckTTL {
+		return cached, nil
+	}
+	check, err := c.fetch(ctx)
+	if err != nil {
+		return updateCheck{}, err
+	}
+	// a failure to cache only costs another request next time
+	_ = c.writeCache(check)
+	return check, nil
+}
+
+func (c *updateChecker) fetch(ctx context.Context) (updateCheck, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.apiURL, nil)
+	if err != nil {
+		return updateCheck{}, xerrors.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("User-Agent", "clauder/"+Version)
+	res, err := c.client.Do(req)
+	if err != nil {
+		return updateCheck{}, xerrors.Errorf("failed to fetch latest release: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return updateCheck{}, xerrors.Errorf("failed to fetch latest release: unexpected status: %s", res.Status)
+	}
+	var release struct {
+		TagName string `json:"tag_name"`
+		HTMLURL string `json:"html_url"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&release); err != nil {
+		return updateCheck{}, xerrors.Errorf("failed to decode release: %w", err)
+	}
+	if release.TagName == "" {
+		return updateCheck{}, xerrors.New("latest release has no tag")
+	}
+	return updateCheck{CheckedAt: c.now(), LatestVersion: release.TagName, URL: release.HTMLURL}, nil
+}
+
+func (c *updateChecker) readCache() (updateCheck, error) {
+	var check updateCheck
+	data, err := os.ReadFile(c.cachePath)
+	if err != nil {
+		return check, err
+	}
+	if err := json.Unmarshal(data, &check); err != nil {
+		return check, err
+	}
+	return check, nil
+}
+
+func (c *updateChecker) writeCache(check updateCheck) error {
+	data, err := json.Marshal(check)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.cachePath), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(c.cachePath, data, 0o600)
+}
+
+// parseVersion splits a version like v1.2.3-rc.1 into its numeric parts and
+// its pre-release suffix.
+func parseVersion(version string) ([3]int, string, error) {
+	var parts [3]int
+	version = strings.TrimPrefix(version, "v")
+	version, prerelease, _ := strings.Cut(version, "-")
+	fields := strings.Split(version, ".")
+	if len(fields) > 3 {
+		return parts, "", xerrors.Errorf("invalid version %q", version)
+	}
+	for i, field := range fields {
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 0 {
+			return parts, "", xerrors.Errorf("invalid version %q", version)
+		}
+		parts[i] = n
+	}
+	return parts, prerelease, nil
+}
+
+// compareVersions returns -1, 0 or 1 if a is older than, the same as or
+// newer than b. A pre-release is older than its release.
+func compareVersions(a, b string) (int, error) {
+	aParts, aPrerelease, err := parseVersion(a)
+	if err != nil {
+		return 0, err
+	}
+	bParts, bPrerelease, err := parseVersion(b)
+	if err != nil {
+		return 0, err
+	}
+	for i := range aParts {
+		if aParts[i] != bParts[i] {
+			if aParts[i] < bParts[i] {
+				return -1, nil
+			}
+			return 1, nil
+		}
+	}
+	switch {
+	case aPrerelease == bPrerelease:
+		return 0, nil
+	case aPrerelease == "":
+		return 1, nil
+	case bPrerelease == "":
+		return -1, nil
+	}
+	return strings.Compare(aPrerelease, bPrerelease), nil
+}
+
+// updateCheckDisabled reports whether the user opted out of update checks.
+func updateCheckDisabled() bool {
+	return os.Getenv("CLAUDER_NO_UPDATE_CHECK") == "1"
+}
+
+// checkForUpdate prints whether a newer release than current is available.
+func checkForUpdate(ctx context.Context, w io.Writer, checker *updateChecker, current string) error {
+	latest, err := checker.latest(ctx)
+	if err != nil {
+		return err
+	}
+	cmp, err := compareVersions(current, latest.LatestVersion)
+	if err != nil {
+		return err
+	}
+	if cmp >= 0 {
+		fmt.Fprintf(w, "clauder %s is up to date\n", current)
+		return nil
+	}
+	fmt.Fprintf(w, "update available: v%s (download: %s)\n", strings.TrimPrefix(latest.LatestVersion, "v"), latest.URL)
+	return nil
+}
+
+var VersionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Print the version",
+	Long:  `Print the version. With --check, also check GitHub for a newer release. The latest release is cached in ~/.clauder/update_check.json for 24 hours. Set CLAUDER_NO_UPDATE_CHECK=1 to disable the check.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Printf("clauder version %s\n", Version)
+		if !checkArg {
+			return
+		}
+		if updateCheckDisabled() {
+			fmt.Println("update check disabled by CLAUDER_NO_UPDATE_CHECK")
+			return
+		}
+		cachePath, err := defaultCachePath()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%+v\n", err)
+			os.Exit(1)
+		}
+		checker := &updateChecker{
+			client:    &http.Client{Timeout: 10 * time.Second},
+			apiURL:    latestReleaseURL,
+			cachePath: cachePath,
+			now:       time.Now,
+		}
+		if err := checkForUpdate(context.Background(), os.Stdout, checker, Version); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to check for updates: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	VersionCmd.Flags().BoolVar(&checkArg, "check", false, "Check whether a newer release is available")
+}
@@ -0,0 +1,145 @@
+package version
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newMockGitHub serves tag as the latest release and counts the requests.
+func newMockGitHub(t *testing.T, tag string) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.URL.Path != "/repos/zohaibahmed/clauder/releases/latest" {
+			http.NotFound(w, r)
+			return
+		}
+		assert.Equal(t, "application/vnd.github+json", r.Header.Get("Accept"))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"tag_name":"` + tag + `","html_url":"https://github.com/zohaibahmed/clauder/releases/tag/` + tag + `"}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func newTestChecker(t *testing.T, srv *httptest.Server, now *time.Time) *updateChecker {
+	t.Helper()
+	return &updateChecker{
+		client:    srv.Client(),
+		apiURL:    srv.URL + "/repos/zohaibahmed/clauder/releases/latest",
+		cachePath: filepath.Join(t.TempDir(), ".clauder", "update_check.json"),
+		now:       func() time.Time { return *now },
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		want int
+	}{
+		{"0.2.3", "v0.2.3", 0},
+		{"0.2.3", "v0.2.4", -1},
+		{"0.2.3", "v0.10.0", -1},
+		{"1.0.0", "v0.99.99", 1},
+		{"0.3", "v0.3.0", 0},
+		{"0.3.0-rc.1", "v0.3.0", -1},
+		{"0.3.0", "v0.3.0-rc.1", 1},
+		{"0.3.0-rc.1", "v0.3.0-rc.2", -1},
+	} {
+		got, err := compareVersions(tc.a, tc.b)
+		require.NoError(t, err, "%s vs %s", tc.a, tc.b)
+		assert.Equal(t, tc.want, got, "%s vs %s", tc.a, tc.b)
+	}
+
+	for _, invalid := range []string{"", "latest", "v1.2.3.4", "v1.x.0", "v-1.0.0"} {
+		_, err := compareVersions("0.2.3", invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestCheckForUpdate(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("up to date", func(t *testing.T) {
+		srv, _ := newMockGitHub(t, "v0.2.3")
+		var out bytes.Buffer
+		require.NoError(t, checkForUpdate(ctx, &out, newTestChecker(t, srv, &now), "0.2.3"))
+		assert.Equal(t, "clauder 0.2.3 is up to date\n", out.String())
+	})
+
+	t.Run("newer than the latest release", func(t *testing.T) {
+		srv, _ := newMockGitHub(t, "v0.2.3")
+		var out bytes.Buffer
+		require.NoError(t, checkForUpdate(ctx, &out, newTestChecker(t, srv, &now), "0.3.0-rc.1"))
+		assert.Equal(t, "clauder 0.3.0-rc.1 is up to date\n", out.String())
+	})
+
+	t.Run("update available", func(t *testing.T) {
+		srv, _ := newMockGitHub(t, "v0.3.0")
+		var out bytes.Buffer
+		require.NoError(t, checkForUpdate(ctx, &out, newTestChecker(t, srv, &now), "0.2.3"))
+		assert.Equal(t, "update available: v0.3.0 (download: https://github.com/zohaibahmed/clauder/releases/tag/v0.3.0)\n", out.String())
+	})
+
+	t.Run("API error", func(t *testing.T) {
+		srv, _ := newMockGitHub(t, "v0.3.0")
+		checker := newTestChecker(t, srv, &now)
+		checker.apiURL = srv.URL + "/repos/zohaibahmed/clauder/releases/missing"
+		err := checkForUpdate(ctx, &bytes.Buffer{}, checker, "0.2.3")
+		assert.ErrorContains(t, err, "404")
+		assert.NoFileExists(t, checker.cachePath, "failures aren't cached")
+	})
+}
+
+func TestUpdateCheckCache(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	srv, requests := newMockGitHub(t, "v0.3.0")
+	checker := newTestChecker(t, srv, &now)
+
+	latest, err := checker.latest(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "v0.3.0", latest.LatestVersion)
+	assert.Equal(t, int32(1), requests.Load())
+	info, err := os.Stat(checker.cachePath)
+	require.NoError(t, err)
+	if os.PathSeparator == '/' {
+		assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	}
+
+	now = now.Add(23 * time.Hour)
+	cached, err := checker.latest(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, latest, cached)
+	assert.Equal(t, int32(1), requests.Load(), "the cached release must be used")
+
+	now = now.Add(time.Hour)
+	_, err = checker.latest(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), requests.Load(), "the cache expires after 24 hours")
+
+	// a corrupt cache is ignored
+	require.NoError(t, os.WriteFile(checker.cachePath, []byte("{"), 0o600))
+	_, err = checker.latest(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), requests.Load())
+}
+
+func TestUpdateCheckDisabled(t *testing.T) {
+	t.Setenv("CLAUDER_NO_UPDATE_CHECK", "")
+	assert.False(t, updateCheckDisabled())
+	t.Setenv("CLAUDER_NO_UPDATE_CHECK", "1")
+	assert.True(t, updateCheckDisabled())
+}
@@ -19,28 +19,32 @@ export default {
     try {
       // POST /register - Register new session
       if (url.pathname === '/register' && request.method === 'POST') {
-        const { passcode, tunnel_url, token } = await request.json();
+        const { passcode: plainPasscode, passcode_hash, tunnel_url, api_url, token } = await request.json();
+        // Sessions are registered with either their passcode or its
+        // HMAC-SHA256, which lookups then use in place of the passcode
+        const passcode = plainPasscode || passcode_hash;
         
         // Validate input
         if (!passcode || !tunnel_url || !token) {
           return new Response(JSON.stringify({
             success: false,
-            error: 'Missing required fields: passcode, tunnel_url, token',
+            error: 'Missing required fields: passcode or passcode_hash, tunnel_url, token',
           }), { status: 400, headers });
         }
         
-        // Validate passcode format (6-character alphanumeric)
-        const passcodeRegex = /^[ABCDEFGHJKLMNPQRSTUVWXYZ23456789]{6}$/;
-        if (!passcodeRegex.test(passcode)) {
+        // Validate passcode format (6-character alphanumeric, or a hex hash)
+        const passcodeRegex = plainPasscode ? /^[ABCDEFGHJKLMNPQRSTUVWXYZ23456789]{6}$/ : /^[0-9a-f]{64}$/;
+        if ((plainPasscode && passcode_hash) || !passcodeRegex.test(passcode)) {
           return new Response(JSON.stringify({
             success: false,
-            error: 'Invalid passcode format. Expected: 6-character alphanumeric code (e.g. ABC123)',
+            error: 'Invalid passcode format. Expected: 6-character alphanumeric code (e.g. ABC123) or a hex-encoded HMAC-SHA256 passcode_hash',
           }), { status: 400, headers });
         }
         
         // Store session data in KV with 24-hour expiration
         const sessionData = { 
           tunnel_url, 
+          api_url,
           token, 
           created_at: Date.now(),
           expires_at: Date.now() + (24 * 60 * 60 * 1000) // 24 hours
@@ -89,6 +93,7 @@ export default {
         
         return new Response(JSON.stringify({
           tunnel_url: sessionData.tunnel_url,
+          api_url: sessionData.api_url,
           token: sessionData.token,
           created_at: sessionData.created_at,
           expires_at: sessionData.expires_at,
@@ -111,7 +116,7 @@ export default {
           version: '1.0.0',
           description: 'Coordinates passcode-based connections between Mac and iOS devices',
           endpoints: {
-            'POST /register': 'Register a new session with passcode, tunnel_url, and token',
+            'POST /register': 'Register a new session with passcode, tunnel_url, and token, and optionally api_url',
             'GET /lookup/:passcode': 'Get session details for a passcode',
             'GET /health': 'Health check endpoint',
           },
@@ -122,6 +127,7 @@ export default {
               body: {
                 passcode: 'ABC123',
                 tunnel_url: 'https://abc123.lhr.life',
+                api_url: 'https://abc123.lhr.life/v1',
                 token: 'eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9...',
               }
             },
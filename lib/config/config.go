@@ -0,0 +1,208 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/zohaibahmed/clauder/lib/coordinator"
+	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the configuration read from ~/.clauder/config.yaml. Every key is
+// optional.
+type Config struct {
+	// Agent is the agent type, e.g. claude.
+	Agent string `yaml:"agent"`
+	// AgentPath is the path of the agent's binary. If empty, the binary
+	// named after the agent type is looked up in PATH.
+	AgentPath         string `yaml:"agent_path,omitempty"`
+	Port              int    `yaml:"port"`
+	UnixSocket        string `yaml:"unix_socket,omitempty"`
+	ContextWindow     int    `yaml:"context_window"`
+	MessageQueueDepth int    `yaml:"message_queue_depth"`
+	// ResponseCacheTTL is a duration like 5m. Disabled if 0.
+	ResponseCacheTTL time.Duration `yaml:"response_cache_ttl"`
+	// TunnelProvider is the tunnel provider to use. If empty, the first
+	// available one is used.
+	TunnelProvider    string `yaml:"tunnel_provider,omitempty"`
+	CoordinatorURL    string `yaml:"coordinator_url"`
+	CoordinatorSecret string `yaml:"coordinator_secret,omitempty"`
+	AdminToken        string `yaml:"admin_token,omitempty"`
+	// AnthropicAPIKey and OpenAIAPIKey are passed to the agent.
+	AnthropicAPIKey string        `yaml:"anthropic_api_key,omitempty"`
+	OpenAIAPIKey    string        `yaml:"openai_api_key,omitempty"`
+	Notifications   Notifications `yaml:"notifications"`
+	// LogLevel is the level of the server's logs: debug, info, warn or
+	// error. If empty, the server logs at the info level, or the debug
+	// level with --log-bodies.
+	LogLevel string `yaml:"log_level,omitempty"`
+	// CORSOrigins are the origins that can make cross-origin requests to
+	// the server. If empty, any origin can.
+	CORSOrigins []string `yaml:"cors_origins,omitempty"`
+	// PTYRateLimit and PTYBurst limit how fast input is written to the
+	// agent, like the server's --pty-rate-limit and --pty-burst.
+	PTYRateLimit float64 `yaml:"pty_rate_limit,omitempty"`
+	PTYBurst     int     `yaml:"pty_burst,omitempty"`
+}
+
+// Notifications are the notification preferences.
+type Notifications struct {
+	// Enabled sends a notification when the agent finishes responding.
+	Enabled bool `yaml:"enabled"`
+}
+
+// envOverrides maps environment variables to the keys they override. They
+// take precedence over the config file.
+var envOverrides = []struct {
+	name  string
+	apply func(c *Config, value string) error
+}{
+	{"PORT", func(c *Config, value string) error {
+		port, err := strconv.Atoi(value)
+		if err != nil {
+			return xerrors.Errorf("invalid PORT %q: %w", value, err)
+		}
+		c.Port = port
+		return nil
+	}},
+	{"COORDINATOR_URL", func(c *Config, value string) error { c.CoordinatorURL = value; return nil }},
+	{"COORDINATOR_SECRET", func(c *Config, value string) error { c.CoordinatorSecret = value; return nil }},
+	{"CLAUDER_ADMIN_TOKEN", func(c *Config, value string) error { c.AdminToken = value; return nil }},
+	{"ANTHROPIC_API_KEY", func(c *Config, value string) error { c.AnthropicAPIKey = value; return nil }},
+	{"OPENAI_API_KEY", func(c *Config, value string) error { c.OpenAIAPIKey = value; return nil }},
+}
+
+// Default returns the configuration used for keys that aren't set. It matches
+// the defaults of the command line flags.
+func Default() Config {
+	return Config{
+		Agent:             "claude",
+		Port:              3284,
+		ContextWindow:     200000,
+		MessageQueueDepth: 10,
+		CoordinatorURL:    coordinator.DefaultCoordinatorURL,
+	}
+}
+
+// DefaultPath returns the path of the config file, ~/.clauder/config.yaml.
+func DefaultPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", xerrors.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".clauder", "config.yaml"), nil
+}
+
+// Parse decodes a config file on top of the defaults. Unknown keys are
+// errors, so that misspelled keys aren't silently ignored.
+func Parse(data []byte) (Config, error) {
+	cfg := Default()
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return Config{}, xerrors.Errorf("failed to parse config: %w", err)
+	}
+	return cfg, nil
+}
+
+// Load returns the effective configuration: the defaults, overridden by the
+// config file at path if it exists, overridden by the environment. found is
+// false if there's no config file.
+func Load(path string, getenv func(string) string) (cfg Config, found bool, err error) {
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		cfg = Default()
+	case err != nil:
+		return Config{}, false, xerrors.Errorf("failed to read config: %w", err)
+	default:
+		found = true
+		if cfg, err = Parse(data); err != nil {
+			return Config{}, true, xerrors.Errorf("%s: %w", path, err)
+		}
+	}
+	for _, override := range envOverrides {
+		if value := getenv(override.name); value != "" {
+			if err := override.apply(&cfg, value); err != nil {
+				return Config{}, found, err
+			}
+		}
+	}
+	return cfg, found, nil
+}
+
+// ParseLogLevel returns the level named by level, one of debug, info, warn
+// or error.
+func ParseLogLevel(level string) (slog.Level, error) {
+	switch level {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "warn":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, xerrors.Errorf("invalid log level %q (one of: debug, info, warn, error)", level)
+}
+
+// ValidateCORSOrigins checks that every origin is "*" or a URL with a
+// scheme and a host, without a path, e.g. https://app.example.com. The host
+// may contain a "*" wildcard.
+func ValidateCORSOrigins(origins []string) error {
+	for _, origin := range origins {
+		if origin == "*" {
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			return xerrors.Errorf("invalid CORS origin %q, e.g. https://app.example.com", origin)
+		}
+	}
+	return nil
+}
+
+// RestartKeys returns the keys that differ between old and new whose
+// values the server only reads when it starts, so that a reload can report
+// them.
+func RestartKeys(old, new Config) []string {
+	var keys []string
+	if old.Port != new.Port {
+		keys = append(keys, "port")
+	}
+	if old.Agent != new.Agent {
+		keys = append(keys, "agent")
+	}
+	if old.AgentPath != new.AgentPath {
+		keys = append(keys, "agent_path")
+	}
+	if old.UnixSocket != new.UnixSocket {
+		keys = append(keys, "unix_socket")
+	}
+	return keys
+}
+
+// Masked returns a copy of the config in which the values of secret keys are
+// replaced, so that it can be printed.
+func (c Config) Masked() Config {
+	mask := func(value string) string {
+		if value == "" {
+			return ""
+		}
+		return "********"
+	}
+	c.CoordinatorSecret = mask(c.CoordinatorSecret)
+	c.AdminToken = mask(c.AdminToken)
+	c.AnthropicAPIKey = mask(c.AnthropicAPIKey)
+	c.OpenAIAPIKey = mask(c.OpenAIAPIKey)
+	return c
+}
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	c, err := Parse([]byte("agent: aider\nresponse_cache_ttl: 90s\n"))
+	require.NoError(t, err)
+	want := Default()
+	want.Agent = "aider"
+	want.ResponseCacheTTL = 90 * time.Second
+	assert.Equal(t, want, c, "unset keys keep their defaults")
+
+	c, err = Parse(nil)
+	require.NoError(t, err)
+	assert.Equal(t, Default(), c)
+
+	_, err = Parse([]byte("agent: aider\nagnet: claude\n"))
+	assert.ErrorContains(t, err, "field agnet not found")
+
+	_, err = Parse([]byte("port: eighty\n"))
+	assert.Error(t, err)
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	env := map[string]string{}
+	getenv := func(key string) string { return env[key] }
+
+	c, found, err := Load(path, getenv)
+	require.NoError(t, err)
+	assert.False(t, found)
+	assert.Equal(t, Default(), c)
+
+	require.NoError(t, os.WriteFile(path, []byte("port: 8080\ncoordinator_url: https://file.example.com\n"), 0o600))
+	c, found, err = Load(path, getenv)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, 8080, c.Port)
+	assert.Equal(t, "https://file.example.com", c.CoordinatorURL)
+
+	env["COORDINATOR_URL"] = "https://env.example.com"
+	env["CLAUDER_ADMIN_TOKEN"] = "token"
+	c, _, err = Load(path, getenv)
+	require.NoError(t, err)
+	assert.Equal(t, 8080, c.Port)
+	assert.Equal(t, "https://env.example.com", c.CoordinatorURL, "the environment overrides the file")
+	assert.Equal(t, "token", c.AdminToken)
+
+	env["PORT"] = "http"
+	_, _, err = Load(path, getenv)
+	assert.ErrorContains(t, err, "invalid PORT")
+}
+
+func TestMasked(t *testing.T) {
+	c := Default()
+	c.AdminToken = "admin-token"
+	masked := c.Masked()
+	assert.Equal(t, "********", masked.AdminToken)
+	assert.Empty(t, masked.CoordinatorSecret, "unset secrets stay empty")
+	assert.Equal(t, "admin-token", c.AdminToken, "the original is unchanged")
+}
+
+func TestParseLogLevel(t *testing.T) {
+	level, err := ParseLogLevel("warn")
+	require.NoError(t, err)
+	assert.Equal(t, slog.LevelWarn, level)
+	_, err = ParseLogLevel("verbose")
+	assert.ErrorContains(t, err, `invalid log level "verbose"`)
+}
+
+func TestValidateCORSOrigins(t *testing.T) {
+	assert.NoError(t, ValidateCORSOrigins([]string{"*", "https://app.example.com", "https://*.example.com", "http://localhost:3000"}))
+	for _, origin := range []string{"app.example.com", "https://app.example.com/chat", ""} {
+		assert.Error(t, ValidateCORSOrigins([]string{origin}), origin)
+	}
+}
+
+func TestRestartKeys(t *testing.T) {
+	old := Default()
+	new := old
+	new.Port = 8080
+	new.LogLevel = "debug"
+	new.CORSOrigins = []string{"https://app.example.com"}
+	assert.Equal(t, []string{"port"}, RestartKeys(old, new), "only the keys the server can't reload")
+	assert.Empty(t, RestartKeys(old, old))
+}
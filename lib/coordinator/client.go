@@ -5,8 +5,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 )
 
@@ -14,20 +16,103 @@ const (
 	// Default coordinator service URL (can be overridden with COORDINATOR_URL env var)
 	DefaultCoordinatorURL = "https://coordinator.claudecode.app"
 	ClientTimeout         = 10 * time.Second
+	// SecretHeader carries the shared secret of a self-hosted coordinator,
+	// read from the COORDINATOR_SECRET env var.
+	SecretHeader = "X-Coordinator-Secret"
 )
 
-// getCoordinatorURL returns the coordinator URL from environment or default
-func getCoordinatorURL() string {
+// URL returns the coordinator URL from environment or default
+func URL() string {
 	if url := os.Getenv("COORDINATOR_URL"); url != "" {
 		return url
 	}
 	return DefaultCoordinatorURL
 }
 
+// PersistentCoordinatorClient keeps its connections to a coordinator open
+// between calls, and multiplexes them over HTTP/2 if the coordinator
+// supports it, so that calls don't each pay for a new TCP and TLS
+// handshake. Pass it to Register and Lookup with WithPersistentClient.
+type PersistentCoordinatorClient struct {
+	url    string
+	client *http.Client
+}
+
+func NewPersistentCoordinatorClient(coordinatorURL string) *PersistentCoordinatorClient {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConnsPerHost:   5,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	return &PersistentCoordinatorClient{
+		url:    coordinatorURL,
+		client: &http.Client{Transport: transport, Timeout: ClientTimeout},
+	}
+}
+
+// Close closes the client's idle connections.
+func (c *PersistentCoordinatorClient) Close() {
+	c.client.CloseIdleConnections()
+}
+
+// Option configures a call to the coordinator.
+type Option func(*options)
+
+type options struct {
+	url         string
+	client      *http.Client
+	passcodeKey string
+}
+
+// WithPersistentClient makes a call use the persistent client's connections
+// and coordinator URL, instead of a new connection to URL().
+func WithPersistentClient(c *PersistentCoordinatorClient) Option {
+	return func(o *options) {
+		o.url = c.url
+		o.client = c.client
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		url:    URL(),
+		client: &http.Client{Timeout: ClientTimeout},
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// APIPath is the path the API of a clauder server is served under,
+// relative to its tunnel URL. It matches httpapi.APIVersionPrefix.
+const APIPath = "/v1"
+
+// APIURL returns the URL of the API of the server at tunnelURL, which is
+// also the URL of its web UI.
+func APIURL(tunnelURL string) string {
+	return strings.TrimRight(tunnelURL, "/") + APIPath
+}
+
 type RegisterRequest struct {
-	Passcode  string `json:"passcode"`
-	TunnelURL string `json:"tunnel_url"`
-	Token     string `json:"token"`
+	Passcode string `json:"passcode,omitempty"`
+	// PasscodeHash is sent instead of Passcode with WithPasscodeKey.
+	PasscodeHash string `json:"passcode_hash,omitempty"`
+	TunnelURL    string `json:"tunnel_url"`
+	// APIURL is the URL of the session's API, set by register from
+	// TunnelURL.
+	APIURL string `json:"api_url,omitempty"`
+	Token  string `json:"token"`
+	// ExpiresIn, if set, shortens how long the session stays valid, in
+	// seconds.
+	ExpiresIn int `json:"expires_in,omitempty"`
 }
 
 type RegisterResponse struct {
@@ -39,36 +124,54 @@ type RegisterResponse struct {
 
 type LookupResponse struct {
 	TunnelURL string `json:"tunnel_url"`
+	// APIURL is empty for sessions registered by older clients.
+	APIURL    string `json:"api_url,omitempty"`
 	Token     string `json:"token"`
+	ExpiresAt int64  `json:"expires_at,omitempty"`
 	Error     string `json:"error,omitempty"`
 }
 
 // Register registers a new session with the coordinator service
-func Register(passcode, tunnelURL, token string) error {
-	client := &http.Client{
-		Timeout: ClientTimeout,
+func Register(passcode, tunnelURL, token string, opts ...Option) error {
+	reqBody := RegisterRequest{Passcode: passcode, TunnelURL: tunnelURL, Token: token}
+	if o := newOptions(opts); o.passcodeKey != "" {
+		reqBody.Passcode, reqBody.PasscodeHash = "", o.passcodeID(passcode)
 	}
-
-	reqBody := RegisterRequest{
-		Passcode:  passcode,
-		TunnelURL: tunnelURL,
-		Token:     token,
+	if err := register(reqBody, opts...); err != nil {
+		return err
 	}
 
+	fmt.Printf("✅ Session registered with coordinator: %s\n", passcode)
+	return nil
+}
+
+// RegisterHandoff registers a handoff code, which can be looked up like a
+// passcode until it expires after ttl.
+func RegisterHandoff(code, tunnelURL, token string, ttl time.Duration) error {
+	return register(RegisterRequest{Passcode: code, TunnelURL: tunnelURL, Token: token, ExpiresIn: int(ttl.Seconds())})
+}
+
+func register(reqBody RegisterRequest, opts ...Option) error {
+	o := newOptions(opts)
+	reqBody.APIURL = APIURL(reqBody.TunnelURL)
+
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
 		return fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	url := fmt.Sprintf("%s/register", getCoordinatorURL())
+	url := fmt.Sprintf("%s/register", o.url)
 	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
+	if secret := os.Getenv("COORDINATOR_SECRET"); secret != "" {
+		req.Header.Set(SecretHeader, secret)
+	}
 
-	resp, err := client.Do(req)
+	resp, err := o.client.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to make request: %w", err)
 	}
@@ -87,19 +190,15 @@ func Register(passcode, tunnelURL, token string) error {
 	if !registerResp.Success {
 		return fmt.Errorf("registration failed: %s", registerResp.Error)
 	}
-
-	fmt.Printf("✅ Session registered with coordinator: %s\n", passcode)
 	return nil
 }
 
 // Lookup retrieves session details for a given passcode
-func Lookup(passcode string) (*LookupResponse, error) {
-	client := &http.Client{
-		Timeout: ClientTimeout,
-	}
+func Lookup(passcode string, opts ...Option) (*LookupResponse, error) {
+	o := newOptions(opts)
 
-	url := fmt.Sprintf("%s/lookup/%s", getCoordinatorURL(), passcode)
-	resp, err := client.Get(url)
+	url := fmt.Sprintf("%s/lookup/%s", o.url, o.passcodeID(passcode))
+	resp, err := o.client.Get(url)
 	if err != nil {
 		return nil, fmt.Errorf("failed to make request: %w", err)
 	}
@@ -121,3 +220,30 @@ func Lookup(passcode string) (*LookupResponse, error) {
 
 	return &lookupResp, nil
 }
+
+// Deregister removes the session for the passcode from the coordinator
+// service, so that it can no longer be looked up.
+func Deregister(passcode string, opts ...Option) error {
+	o := newOptions(opts)
+
+	url := fmt.Sprintf("%s/sessions/%s", o.url, o.passcodeID(passcode))
+	req, err := http.NewRequest("DELETE", url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if secret := os.Getenv("COORDINATOR_SECRET"); secret != "" {
+		req.Header.Set(SecretHeader, secret)
+	}
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// the session may have expired already
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("deregistration failed: %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package coordinator
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newLookupServer returns a coordinator that resolves every passcode, and
+// counts the connections opened to it and the ones that are still open.
+func newLookupServer(t testing.TB) (srv *httptest.Server, opened, open *atomic.Int64) {
+	opened, open = &atomic.Int64{}, &atomic.Int64{}
+	srv = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(LookupResponse{TunnelURL: "https://abc.lhr.life", Token: "tok"})
+	}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		switch state {
+		case http.StateNew:
+			opened.Add(1)
+			open.Add(1)
+		case http.StateClosed, http.StateHijacked:
+			open.Add(-1)
+		}
+	}
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return srv, opened, open
+}
+
+func TestPersistentCoordinatorClient(t *testing.T) {
+	srv, opened, open := newLookupServer(t)
+	client := NewPersistentCoordinatorClient(srv.URL)
+
+	for range 100 {
+		lookup, err := Lookup("ABC234", WithPersistentClient(client))
+		require.NoError(t, err)
+		assert.Equal(t, "tok", lookup.Token)
+	}
+	assert.Equal(t, int64(1), opened.Load(), "sequential calls share a connection")
+
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := Lookup("ABC234", WithPersistentClient(client))
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	// no connection stays open once the client is closed
+	client.Close()
+	require.Eventually(t, func() bool { return open.Load() == 0 }, 5*time.Second, 10*time.Millisecond)
+}
+
+func BenchmarkLookup(b *testing.B) {
+	srv, _, _ := newLookupServer(b)
+	for _, tc := range []struct {
+		name string
+		opt  Option
+	}{
+		{"new-connection", func(o *options) {
+			o.url = srv.URL
+			o.client = &http.Client{Transport: &http.Transport{DisableKeepAlives: true}, Timeout: ClientTimeout}
+		}},
+		{"persistent", WithPersistentClient(NewPersistentCoordinatorClient(srv.URL))},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for range 100 {
+					if _, err := Lookup("ABC234", tc.opt); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package coordinator
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// passcodeKeySize is the number of random bytes of a generated passcode
+// key.
+const passcodeKeySize = 32
+
+// PasscodeHashRegex matches the passcode hashes returned by HashPasscode.
+var PasscodeHashRegex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// HashPasscode returns HMAC-SHA256(passcode, key) in hex. A coordinator that
+// only stores the hash can match lookups against it, but doesn't learn the
+// passcode, and can't tell which passcode it belongs to without the key.
+func HashPasscode(passcode, key string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(passcode))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// WithPasscodeKey makes Register, Lookup and Deregister send the
+// HashPasscode of the passcode with key instead of the passcode itself.
+// Sessions registered with a key can only be looked up with the same key.
+func WithPasscodeKey(key string) Option {
+	return func(o *options) {
+		o.passcodeKey = key
+	}
+}
+
+// passcodeID returns what identifies the session of passcode on the
+// coordinator.
+func (o options) passcodeID(passcode string) string {
+	if o.passcodeKey == "" {
+		return passcode
+	}
+	return HashPasscode(passcode, o.passcodeKey)
+}
+
+// DefaultPasscodeKeyPath returns the path of the generated passcode key,
+// ~/.clauder/coordinator_key.
+func DefaultPasscodeKeyPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".clauder", "coordinator_key"), nil
+}
+
+// LoadOrCreatePasscodeKey returns the passcode key saved at path, or
+// generates one and saves it there if the file doesn't exist. Only the
+// current user can read the file.
+func LoadOrCreatePasscodeKey(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		key := strings.TrimSpace(string(data))
+		if key == "" {
+			return "", fmt.Errorf("passcode key file %s is empty", path)
+		}
+		return key, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("failed to read passcode key: %w", err)
+	}
+
+	b := make([]byte, passcodeKeySize)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate passcode key: %w", err)
+	}
+	key := hex.EncodeToString(b)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return "", fmt.Errorf("failed to create passcode key directory: %w", err)
+	}
+	// O_EXCL so that two servers starting at once don't overwrite each
+	// other's key
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if errors.Is(err, os.ErrExist) {
+		return LoadOrCreatePasscodeKey(path)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to create passcode key: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(key + "\n"); err != nil {
+		return "", fmt.Errorf("failed to write passcode key: %w", err)
+	}
+	return key, nil
+}
+
+// ResolvePasscodeKey returns secret if it's set, or else the key saved at
+// DefaultPasscodeKeyPath, which is generated the first time.
+func ResolvePasscodeKey(secret string) (string, error) {
+	if secret != "" {
+		return secret, nil
+	}
+	path, err := DefaultPasscodeKeyPath()
+	if err != nil {
+		return "", err
+	}
+	return LoadOrCreatePasscodeKey(path)
+}
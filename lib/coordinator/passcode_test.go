@@ -0,0 +1,36 @@
+package coordinator
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashPasscode(t *testing.T) {
+	// echo -n ABC234 | openssl dgst -sha256 -hmac key
+	assert.Equal(t, "907cbc65758adb7d1b6b4928bb3c444e5eaadf61fcafa42c44909881982b1604", HashPasscode("ABC234", "key"))
+	assert.Regexp(t, PasscodeHashRegex, HashPasscode("ABC234", "key"))
+	assert.NotEqual(t, HashPasscode("ABC234", "key"), HashPasscode("ABC234", "other-key"))
+}
+
+func TestLoadOrCreatePasscodeKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".clauder", "coordinator_key")
+	key, err := LoadOrCreatePasscodeKey(path)
+	require.NoError(t, err)
+	assert.Len(t, key, 2*passcodeKeySize)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	// the key is kept
+	again, err := LoadOrCreatePasscodeKey(path)
+	require.NoError(t, err)
+	assert.Equal(t, key, again)
+
+	require.NoError(t, os.WriteFile(path, []byte("\n"), 0o600))
+	_, err = LoadOrCreatePasscodeKey(path)
+	assert.ErrorContains(t, err, "is empty")
+}
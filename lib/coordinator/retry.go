@@ -0,0 +1,65 @@
+package coordinator
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	// DefaultRegisterRetryInterval is how long RegisterWithRetry waits
+	// before each attempt by default.
+	DefaultRegisterRetryInterval = 30 * time.Second
+	// DefaultRegisterMaxAttempts is how many times RegisterWithRetry tries
+	// to register by default.
+	DefaultRegisterMaxAttempts = 20
+)
+
+// RetryConfig configures RegisterWithRetry.
+type RetryConfig struct {
+	// Interval is how long to wait before each attempt. Defaults to
+	// DefaultRegisterRetryInterval.
+	Interval time.Duration
+	// MaxAttempts is how many times to try to register. Defaults to
+	// DefaultRegisterMaxAttempts.
+	MaxAttempts int
+	// OnFailure, if set, is called after every failed attempt.
+	OnFailure func(attempt int, err error)
+}
+
+// RegisterWithRetry registers a session like Register, trying again until
+// it succeeds, ctx is done or it failed cfg.MaxAttempts times. It's meant
+// for retrying after Register failed, so it waits cfg.Interval before the
+// first attempt too.
+//
+// tunnelURL is called before every attempt, so that the session points at
+// the tunnel's current URL if it changed in the meantime. Registering a
+// passcode again replaces its session, so an attempt that reached the
+// coordinator although it failed, e.g. because the response was lost, is
+// safe to repeat.
+func RegisterWithRetry(ctx context.Context, passcode string, tunnelURL func() string, token string, cfg RetryConfig, opts ...Option) error {
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultRegisterRetryInterval
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = DefaultRegisterMaxAttempts
+	}
+	timer := time.NewTimer(cfg.Interval)
+	defer timer.Stop()
+	var err error
+	for attempt := 1; attempt <= cfg.MaxAttempts; attempt++ {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+		if err = Register(passcode, tunnelURL(), token, opts...); err == nil {
+			return nil
+		}
+		if cfg.OnFailure != nil {
+			cfg.OnFailure(attempt, err)
+		}
+		timer.Reset(cfg.Interval)
+	}
+	return fmt.Errorf("failed to register after %d attempts: %w", cfg.MaxAttempts, err)
+}
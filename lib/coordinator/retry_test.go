@@ -0,0 +1,91 @@
+package coordinator
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newFlakyCoordinator returns a coordinator that fails the first failures
+// registrations, and records the ones it receives.
+func newFlakyCoordinator(t *testing.T, failures int) (*httptest.Server, func() []RegisterRequest) {
+	t.Helper()
+	var mu sync.Mutex
+	var requests []RegisterRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req RegisterRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		mu.Lock()
+		requests = append(requests, req)
+		n := len(requests)
+		mu.Unlock()
+		if n <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_ = json.NewEncoder(w).Encode(RegisterResponse{Error: "coordinator is overloaded"})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(RegisterResponse{Success: true, Passcode: req.Passcode})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []RegisterRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]RegisterRequest(nil), requests...)
+	}
+}
+
+func TestRegisterWithRetry(t *testing.T) {
+	srv, requests := newFlakyCoordinator(t, 3)
+	t.Setenv("COORDINATOR_URL", srv.URL)
+
+	// the tunnel URL changes after the second failure
+	var failures atomic.Int64
+	tunnelURL := func() string {
+		if failures.Load() >= 2 {
+			return "https://standby.lhr.life"
+		}
+		return "https://primary.lhr.life"
+	}
+	err := RegisterWithRetry(context.Background(), "ABC234", tunnelURL, "tok", RetryConfig{
+		Interval:    10 * time.Millisecond,
+		MaxAttempts: 5,
+		OnFailure: func(attempt int, err error) {
+			assert.Equal(t, failures.Add(1), int64(attempt))
+			assert.ErrorContains(t, err, "coordinator is overloaded")
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), failures.Load())
+
+	var urls []string
+	for _, req := range requests() {
+		assert.Equal(t, "ABC234", req.Passcode)
+		assert.Equal(t, "tok", req.Token)
+		urls = append(urls, req.TunnelURL)
+	}
+	assert.Equal(t, []string{"https://primary.lhr.life", "https://primary.lhr.life", "https://standby.lhr.life", "https://standby.lhr.life"}, urls)
+}
+
+func TestRegisterWithRetryGivesUp(t *testing.T) {
+	srv, requests := newFlakyCoordinator(t, 100)
+	t.Setenv("COORDINATOR_URL", srv.URL)
+	tunnelURL := func() string { return "https://abc.lhr.life" }
+
+	err := RegisterWithRetry(context.Background(), "ABC234", tunnelURL, "tok", RetryConfig{Interval: time.Millisecond, MaxAttempts: 3})
+	assert.ErrorContains(t, err, "failed to register after 3 attempts: registration failed: coordinator is overloaded")
+	assert.Len(t, requests(), 3)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = RegisterWithRetry(ctx, "ABC234", tunnelURL, "tok", RetryConfig{Interval: time.Hour})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Len(t, requests(), 3, "nothing is sent once ctx is done")
+}
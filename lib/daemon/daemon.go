@@ -0,0 +1,34 @@
+// Package daemon runs the current program in the background, detached from
+// the terminal it was started in.
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+
+	"golang.org/x/xerrors"
+)
+
+// stageEnv tells the processes started by Daemonize which of them they are.
+const stageEnv = "CLAUDER_DAEMON_STAGE"
+
+const (
+	// stageSessionLeader is the process that starts a new session.
+	stageSessionLeader = "session-leader"
+	// stageDaemon is the process that keeps running in the background.
+	stageDaemon = "daemon"
+)
+
+// readyMessage is what the daemon writes to the original process once it's
+// ready.
+const readyMessage = "ready\n"
+
+// DefaultLogPath returns the path of the file the daemon's output is
+// appended to, ~/.clauder/server.log.
+func DefaultLogPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", xerrors.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".clauder", "server.log"), nil
+}
@@ -0,0 +1,16 @@
+//go:build !linux && !darwin
+
+package daemon
+
+import "golang.org/x/xerrors"
+
+// Daemonize isn't supported on this operating system.
+func Daemonize(logPath string) (bool, error) {
+	return false, xerrors.Errorf("running in the background isn't supported on this operating system")
+}
+
+// Ready does nothing, since Daemonize isn't supported on this operating
+// system.
+func Ready() error {
+	return nil
+}
@@ -0,0 +1,136 @@
+//go:build linux || darwin
+
+package daemon
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+
+	"golang.org/x/xerrors"
+)
+
+// readyFD is the file descriptor of the pipe every stage of Daemonize
+// passes on, which the daemon writes to once it's ready.
+const readyFD = 3
+
+// readyPipe is the pipe to the original process, set in the daemon until
+// Ready is called.
+var readyPipe *os.File
+
+// Daemonize moves the current program to the background with a double
+// fork. Go can't fork a running program, so the program is started again
+// instead: the original process starts a copy in a new session, which
+// starts the daemon and exits, so that the daemon isn't a session leader
+// and can't acquire a controlling terminal again. The daemon's standard
+// input is /dev/null, its output is appended to logPath, and it keeps the
+// working directory.
+//
+// Daemonize returns true in the daemon, which must call Ready once it
+// started successfully. In the original process, it waits for that and
+// returns false, or an error if the daemon exits before it's ready, and the
+// program should exit. The session leader exits once it started the
+// daemon, so Daemonize must be called before the program does anything
+// that shouldn't happen twice.
+func Daemonize(logPath string) (bool, error) {
+	switch os.Getenv(stageEnv) {
+	case "":
+		return false, waitForDaemon(logPath)
+	case stageSessionLeader:
+		ready := os.NewFile(readyFD, "ready")
+		if err := startStage(stageDaemon, false, os.Stdout, ready); err != nil {
+			return false, err
+		}
+		os.Exit(0)
+	}
+	// the agent and other programs the daemon starts mustn't keep the
+	// pipe open
+	syscall.CloseOnExec(readyFD)
+	readyPipe = os.NewFile(readyFD, "ready")
+	if err := os.Unsetenv(stageEnv); err != nil {
+		return true, xerrors.Errorf("failed to unset %s: %w", stageEnv, err)
+	}
+	return true, nil
+}
+
+// Ready tells the original process that the daemon started successfully,
+// so that it exits with status 0. It does nothing if the program isn't a
+// daemon, or if it was called before.
+func Ready() error {
+	if readyPipe == nil {
+		return nil
+	}
+	pipe := readyPipe
+	readyPipe = nil
+	defer pipe.Close()
+	if _, err := pipe.WriteString(readyMessage); err != nil {
+		return xerrors.Errorf("failed to notify the original process: %w", err)
+	}
+	return nil
+}
+
+// waitForDaemon starts the session leader, with its output appended to
+// logPath, and waits until the daemon it starts is ready.
+func waitForDaemon(logPath string) error {
+	if err := os.MkdirAll(filepath.Dir(logPath), 0o700); err != nil {
+		return xerrors.Errorf("failed to create log directory: %w", err)
+	}
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return xerrors.Errorf("failed to open log file: %w", err)
+	}
+	defer logFile.Close()
+	r, w, err := os.Pipe()
+	if err != nil {
+		return xerrors.Errorf("failed to create pipe: %w", err)
+	}
+	defer r.Close()
+	err = startStage(stageSessionLeader, true, logFile, w)
+	// only the daemon may keep the pipe open, so that reading it ends
+	// once the daemon is ready or exits
+	_ = w.Close()
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return xerrors.Errorf("failed to wait for the daemon: %w", err)
+	}
+	if string(data) != readyMessage {
+		return xerrors.Errorf("the daemon exited before it was ready, see its output in %s", logPath)
+	}
+	return nil
+}
+
+// startStage starts the program again with its arguments, as the given
+// stage of Daemonize, in a new session if setsid is set. Its output goes
+// to out, and ready is passed on as readyFD. It waits until the session
+// leader exits, which it does as soon as it started the daemon.
+func startStage(stage string, setsid bool, out, ready *os.File) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return xerrors.Errorf("failed to find executable: %w", err)
+	}
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		return xerrors.Errorf("failed to open %s: %w", os.DevNull, err)
+	}
+	defer devNull.Close()
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), stageEnv+"="+stage)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = devNull, out, out
+	cmd.ExtraFiles = []*os.File{ready}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: setsid}
+	if err := cmd.Start(); err != nil {
+		return xerrors.Errorf("failed to start the %s process: %w", stage, err)
+	}
+	if stage == stageDaemon {
+		return cmd.Process.Release()
+	}
+	if err := cmd.Wait(); err != nil {
+		return xerrors.Errorf("the %s process failed: %w", stage, err)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+//go:build linux || darwin
+
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+// helperOutEnv makes the test binary daemonize and report on itself to the
+// file it names instead of running the tests.
+const helperOutEnv = "CLAUDER_DAEMON_TEST_OUT"
+
+// helperFailEnv makes the daemonized test binary exit before it's ready.
+const helperFailEnv = "CLAUDER_DAEMON_TEST_FAIL"
+
+// helperReport is what the daemonized test binary reports.
+type helperReport struct {
+	PID     int
+	SID     int
+	TTYOpen bool
+	Stage   string
+}
+
+func TestMain(m *testing.M) {
+	if out := os.Getenv(helperOutEnv); out != "" {
+		isDaemon, err := Daemonize(out + ".log")
+		if err != nil {
+			os.Exit(2)
+		}
+		if !isDaemon {
+			os.Exit(0)
+		}
+		if os.Getenv(helperFailEnv) != "" {
+			fmt.Fprintln(os.Stderr, "failed to start")
+			os.Exit(1)
+		}
+		report := helperReport{PID: os.Getpid(), Stage: os.Getenv(stageEnv)}
+		report.SID, _ = unix.Getsid(0)
+		if tty, err := os.Open("/dev/tty"); err == nil {
+			report.TTYOpen = true
+			_ = tty.Close()
+		}
+		data, _ := json.Marshal(report)
+		_ = os.WriteFile(out+".tmp", data, 0o600)
+		_ = os.Rename(out+".tmp", out)
+		if err := Ready(); err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func TestDaemonize(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "report.json")
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), helperOutEnv+"="+out)
+	start := time.Now()
+	require.NoError(t, cmd.Run(), "the original process exits once the daemon is ready")
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	// the daemon reported before it was ready
+	data, err := os.ReadFile(out)
+	require.NoError(t, err)
+	var report helperReport
+	require.NoError(t, json.Unmarshal(data, &report))
+	assert.Empty(t, report.Stage, "the stage isn't passed on to the daemon's children")
+
+	sid, err := unix.Getsid(0)
+	require.NoError(t, err)
+	assert.NotEqual(t, sid, report.SID, "the daemon runs in a new session")
+	assert.NotEqual(t, report.PID, report.SID, "the daemon isn't the session leader")
+	assert.NotEqual(t, cmd.Process.Pid, report.PID)
+	assert.False(t, report.TTYOpen, "the daemon has no controlling terminal")
+}
+
+func TestDaemonizeFailure(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "report.json")
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), helperOutEnv+"="+out, helperFailEnv+"=1")
+	var exitErr *exec.ExitError
+	require.ErrorAs(t, cmd.Run(), &exitErr, "the original process fails if the daemon exits before it's ready")
+	assert.Equal(t, 2, exitErr.ExitCode())
+
+	// the daemon's output is logged
+	data, err := os.ReadFile(out + ".log")
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "failed to start")
+	assert.NoFileExists(t, out)
+}
@@ -0,0 +1,66 @@
+// Package events provides a publish-subscribe bus that decouples the
+// components producing the agent's state from the ones consuming it.
+package events
+
+import "sync"
+
+const (
+	// TopicPTYOutput events carry the agent's screen, as a string, every
+	// time it's read from the pseudo terminal.
+	TopicPTYOutput = "pty_output"
+	// TopicMessageSent events carry a user message, as a
+	// screentracker.ConversationMessage, once it was sent to the agent.
+	TopicMessageSent = "message_sent"
+)
+
+// EventBus fans out the payloads published on a topic to all of the topic's
+// subscribers. Publishing never blocks: a payload is dropped for subscribers
+// whose buffer is full, so slow subscribers can't hold up publishers.
+type EventBus struct {
+	mu      sync.RWMutex
+	subs    map[string]map[<-chan any]chan any
+	bufSize int
+}
+
+// NewEventBus creates a bus whose subscriptions buffer up to bufSize payloads.
+func NewEventBus(bufSize int) *EventBus {
+	return &EventBus{
+		subs:    make(map[string]map[<-chan any]chan any),
+		bufSize: bufSize,
+	}
+}
+
+// Publish sends payload to the subscribers of topic.
+func (b *EventBus) Publish(topic string, payload any) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, ch := range b.subs[topic] {
+		select {
+		case ch <- payload:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel that receives the payloads published on topic
+// until it's passed to Unsubscribe.
+func (b *EventBus) Subscribe(topic string) <-chan any {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ch := make(chan any, b.bufSize)
+	if b.subs[topic] == nil {
+		b.subs[topic] = make(map[<-chan any]chan any)
+	}
+	b.subs[topic][ch] = ch
+	return ch
+}
+
+// Unsubscribe closes a channel returned by Subscribe.
+func (b *EventBus) Unsubscribe(topic string, ch <-chan any) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if sub, ok := b.subs[topic][ch]; ok {
+		close(sub)
+		delete(b.subs[topic], ch)
+	}
+}
@@ -0,0 +1,95 @@
+package events
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventBusConcurrentPublishers(t *testing.T) {
+	bus := NewEventBus(1000)
+	ch := bus.Subscribe("topic")
+	other := bus.Subscribe("other")
+
+	var wg sync.WaitGroup
+	for publisher := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 100 {
+				bus.Publish("topic", publisher*100+i)
+			}
+		}()
+	}
+	wg.Wait()
+
+	received := make(map[int]bool)
+	for range 1000 {
+		received[(<-ch).(int)] = true
+	}
+	assert.Len(t, received, 1000)
+	assert.Empty(t, ch)
+	assert.Empty(t, other, "payloads must only be sent to the topic's subscribers")
+}
+
+func TestEventBusFanOut(t *testing.T) {
+	bus := NewEventBus(10)
+	var wg sync.WaitGroup
+	subs := make([]<-chan any, 3)
+	results := make([][]any, len(subs))
+	for i := range subs {
+		subs[i] = bus.Subscribe("topic")
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for payload := range subs[i] {
+				results[i] = append(results[i], payload)
+			}
+		}()
+	}
+
+	bus.Publish("topic", "a")
+	bus.Publish("topic", "b")
+	for _, sub := range subs {
+		bus.Unsubscribe("topic", sub)
+	}
+	wg.Wait()
+	for _, result := range results {
+		assert.Equal(t, []any{"a", "b"}, result)
+	}
+}
+
+func TestEventBusSlowSubscriber(t *testing.T) {
+	bus := NewEventBus(2)
+	slow := bus.Subscribe("topic")
+	fast := bus.Subscribe("topic")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range 5 {
+			bus.Publish("topic", i)
+			if !assert.Equal(t, i, <-fast) {
+				return
+			}
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("a slow subscriber blocked the publisher")
+	}
+
+	// the slow subscriber only gets the payloads that fit in its buffer
+	assert.Equal(t, 0, <-slow)
+	assert.Equal(t, 1, <-slow)
+	assert.Empty(t, slow)
+
+	bus.Unsubscribe("topic", slow)
+	_, ok := <-slow
+	assert.False(t, ok)
+	bus.Publish("topic", 5)
+	assert.Equal(t, 5, <-fast)
+}
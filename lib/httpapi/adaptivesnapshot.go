@@ -0,0 +1,129 @@
+package httpapi
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// MaxAdaptiveSnapshotInterval is the longest interval the adaptive
+	// snapshot scheduler degrades the snapshot loop to.
+	MaxAdaptiveSnapshotInterval = 30 * time.Second
+	// adaptiveSnapshotRecovery is how long the latency must stay below the
+	// threshold before the snapshot interval is restored.
+	adaptiveSnapshotRecovery = 60 * time.Second
+	// defaultAdaptiveSnapshotCheckInterval is how often the scheduler checks
+	// the latency.
+	defaultAdaptiveSnapshotCheckInterval = 5 * time.Second
+)
+
+// QualityDegradedBody is sent when the snapshot interval changed because of
+// the POST /message latency.
+type QualityDegradedBody struct {
+	Type          string `json:"type" enum:"quality_degraded" doc:"Always 'quality_degraded'"`
+	NewIntervalMs int64  `json:"new_interval_ms" doc:"Interval the conversation is polled for events at now, in milliseconds. It's back to the configured one once the latency recovered."`
+}
+
+// AdaptiveSnapshotScheduler trades the freshness of the events for latency
+// under load. Polling the conversation competes with the requests, so while
+// the 95th percentile of the POST /message latency exceeds the SLO
+// monitor's threshold, it doubles the interval of the snapshot loop at
+// every check, up to MaxAdaptiveSnapshotInterval. Once the latency stayed
+// below the threshold for a minute, it restores the base interval.
+type AdaptiveSnapshotScheduler struct {
+	monitor       *SLOMonitor
+	base          time.Duration
+	checkInterval time.Duration
+	getTime       func() time.Time
+
+	mu       sync.Mutex
+	interval time.Duration
+	// healthySince is when the latency went back below the threshold while
+	// the interval is degraded, or zero if it's above it.
+	healthySince time.Time
+}
+
+// NewAdaptiveSnapshotScheduler returns a scheduler that adapts the base
+// snapshot interval to the latency measured by monitor. It never degrades
+// the interval if the monitor has no P95Threshold.
+func NewAdaptiveSnapshotScheduler(monitor *SLOMonitor, base time.Duration) *AdaptiveSnapshotScheduler {
+	return &AdaptiveSnapshotScheduler{
+		monitor:       monitor,
+		base:          base,
+		checkInterval: defaultAdaptiveSnapshotCheckInterval,
+		getTime:       time.Now,
+		interval:      base,
+	}
+}
+
+// Interval returns the current snapshot interval.
+func (a *AdaptiveSnapshotScheduler) Interval() time.Duration {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.interval
+}
+
+// Check compares the latency to the threshold and adjusts the interval. It
+// returns the interval, and whether it changed.
+func (a *AdaptiveSnapshotScheduler) Check() (time.Duration, bool) {
+	threshold := a.monitor.config.P95Threshold
+	_, p95, _ := a.monitor.Percentiles()
+	now := a.getTime()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	previous := a.interval
+	switch {
+	case threshold <= 0:
+	case p95 > threshold:
+		a.healthySince = time.Time{}
+		a.interval = min(2*a.interval, max(a.base, MaxAdaptiveSnapshotInterval))
+	case a.interval == a.base:
+	case a.healthySince.IsZero():
+		a.healthySince = now
+	case now.Sub(a.healthySince) >= adaptiveSnapshotRecovery:
+		a.healthySince = time.Time{}
+		a.interval = a.base
+	}
+	return a.interval, a.interval != previous
+}
+
+// EnableAdaptiveSnapshots makes the snapshot loop poll the conversation at
+// the interval of scheduler instead of the one set with
+// SetSnapshotPollInterval, and checks the latency until ctx is done. The
+// subscribers are sent a quality_degraded event whenever the interval
+// changes. It must be called before StartSnapshotLoop and StartWatchdog.
+func (s *Server) EnableAdaptiveSnapshots(ctx context.Context, scheduler *AdaptiveSnapshotScheduler) {
+	s.snapshotScheduler.Store(scheduler)
+	go func() {
+		ticker := time.NewTicker(scheduler.checkInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				interval, changed := scheduler.Check()
+				if !changed {
+					continue
+				}
+				if interval > scheduler.base {
+					s.logger.Warn("POST /message latency exceeds the SLO, polling the conversation less often", "interval", interval)
+				} else {
+					s.logger.Info("POST /message latency recovered, restored the snapshot interval", "interval", interval)
+				}
+				s.emitter.EmitQualityDegraded(interval)
+			}
+		}
+	}()
+}
+
+// snapshotPollBaseInterval returns the interval the snapshot loop polls at
+// with a single client.
+func (s *Server) snapshotPollBaseInterval() time.Duration {
+	if scheduler := s.snapshotScheduler.Load(); scheduler != nil {
+		return scheduler.Interval()
+	}
+	return s.snapshotPollBase
+}
@@ -0,0 +1,126 @@
+package httpapi
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+)
+
+func TestAdaptiveSnapshotScheduler(t *testing.T) {
+	m, advance, _ := newTestSLOMonitor(SLOConfig{P95Threshold: 2 * time.Second, Window: time.Minute})
+	a := NewAdaptiveSnapshotScheduler(m, time.Second)
+	a.getTime = m.getTime
+	check := func(expected time.Duration, expectChanged bool) {
+		t.Helper()
+		interval, changed := a.Check()
+		assert.Equal(t, expected, interval)
+		assert.Equal(t, expectChanged, changed)
+		assert.Equal(t, expected, a.Interval())
+	}
+
+	for range 100 {
+		m.Record(100*time.Millisecond, false)
+	}
+	check(time.Second, false)
+
+	// a latency spike doubles the interval at every check, up to 30s
+	for range 10 {
+		m.Record(3*time.Second, false)
+	}
+	check(2*time.Second, true)
+	check(4*time.Second, true)
+	check(8*time.Second, true)
+	check(16*time.Second, true)
+	check(MaxAdaptiveSnapshotInterval, true)
+	check(MaxAdaptiveSnapshotInterval, false)
+
+	// the spike leaves the window, but the interval is only restored after
+	// the latency stayed below the threshold for a minute
+	advance(time.Minute)
+	m.Record(100*time.Millisecond, false)
+	check(MaxAdaptiveSnapshotInterval, false)
+	advance(30 * time.Second)
+	check(MaxAdaptiveSnapshotInterval, false)
+
+	// another spike starts the minute over
+	for range 10 {
+		m.Record(3*time.Second, false)
+	}
+	check(MaxAdaptiveSnapshotInterval, false)
+	advance(time.Minute + time.Second)
+	m.Record(100*time.Millisecond, false)
+	check(MaxAdaptiveSnapshotInterval, false)
+	advance(59 * time.Second)
+	check(MaxAdaptiveSnapshotInterval, false)
+	advance(time.Second)
+	check(time.Second, true)
+	check(time.Second, false)
+}
+
+func TestAdaptiveSnapshotSchedulerWithoutThreshold(t *testing.T) {
+	m, _, _ := newTestSLOMonitor(SLOConfig{})
+	a := NewAdaptiveSnapshotScheduler(m, time.Second)
+	m.Record(time.Minute, false)
+	interval, changed := a.Check()
+	assert.Equal(t, time.Second, interval)
+	assert.False(t, changed)
+}
+
+func TestQualityDegradedEvent(t *testing.T) {
+	ctx, cancel := context.WithCancel(logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil))))
+	defer cancel()
+	srv, httpSrv := newRoutingTestServer(t, ctx, &echoAgent{})
+	// the clock is read by the scheduler's goroutine
+	var now atomic.Int64
+	now.Store(time.Unix(1_700_000_000, 0).UnixNano())
+	getTime := func() time.Time { return time.Unix(0, now.Load()) }
+	advance := func(d time.Duration) { now.Add(int64(d)) }
+	m := NewSLOMonitor(slog.New(slog.NewTextHandler(io.Discard, nil)), SLOConfig{P95Threshold: time.Second})
+	m.getTime = getTime
+	scheduler := NewAdaptiveSnapshotScheduler(m, 2*time.Second)
+	scheduler.checkInterval = 10 * time.Millisecond
+	scheduler.getTime = getTime
+	srv.EnableAdaptiveSnapshots(ctx, scheduler)
+
+	resp, err := http.Get(httpSrv.URL + "/v1/events?topics=quality_degraded")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+	name, _ := nextEvent(t, reader)
+	require.Equal(t, "subscribed", name)
+
+	m.Record(5*time.Second, false)
+	name, data := nextEvent(t, reader)
+	require.Equal(t, "quality_degraded", name)
+	assert.JSONEq(t, `{"type":"quality_degraded","new_interval_ms":4000}`, data)
+
+	// once the spike left the window and a minute passed, the interval is
+	// restored
+	advance(DefaultSLOWindow + time.Second)
+	m.Record(time.Millisecond, false)
+	require.Eventually(t, func() bool {
+		scheduler.mu.Lock()
+		defer scheduler.mu.Unlock()
+		return !scheduler.healthySince.IsZero()
+	}, 5*time.Second, 10*time.Millisecond)
+	advance(adaptiveSnapshotRecovery)
+	for {
+		// the interval may have been degraded further before the spike
+		// left the window
+		name, data = nextEvent(t, reader)
+		require.Equal(t, "quality_degraded", name)
+		if data == `{"type":"quality_degraded","new_interval_ms":2000}` {
+			break
+		}
+	}
+	assert.Equal(t, 2*time.Second, srv.snapshotPollBaseInterval())
+}
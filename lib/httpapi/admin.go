@@ -0,0 +1,81 @@
+package httpapi
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+)
+
+// adminShutdownTimeout is how long POST /admin/shutdown waits for the server
+// to stop before onShutdown is called anyway.
+const adminShutdownTimeout = 10 * time.Second
+
+type AdminShutdownRequest struct {
+	Authorization string `header:"Authorization" doc:"Bearer token with the admin token"`
+}
+
+type AdminShutdownResponse struct {
+	Status int
+	Body   struct {
+		Ok bool `json:"ok" doc:"Indicates whether the shutdown was started"`
+	}
+}
+
+// EnableAdminShutdown allows clients with the admin token to stop the server
+// with POST /admin/shutdown. Once the server stopped, onShutdown is called,
+// e.g. to deregister the session from the coordinator. It may be nil.
+func (s *Server) EnableAdminShutdown(token string, onShutdown func(ctx context.Context)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.adminToken = token
+	s.onAdminShutdown = onShutdown
+}
+
+// shutdownServer handles POST /admin/shutdown
+func (s *Server) shutdownServer(ctx context.Context, input *AdminShutdownRequest) (*AdminShutdownResponse, error) {
+	if err := s.checkAdminToken(input.Authorization, "admin shutdown is not enabled"); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	onShutdown := s.onAdminShutdown
+	s.mu.RUnlock()
+
+	s.logger.Info("Shutting down on admin request")
+	// Stop waits for active requests to finish, including this one, so it
+	// must not block the response.
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), adminShutdownTimeout)
+		defer cancel()
+		if err := s.Stop(ctx); err != nil {
+			s.logger.Error("Failed to stop server", "error", err)
+		}
+		if onShutdown != nil {
+			onShutdown(ctx)
+		}
+	}()
+
+	resp := &AdminShutdownResponse{Status: http.StatusAccepted}
+	resp.Body.Ok = true
+	return resp, nil
+}
+
+// checkAdminToken returns a 401 error unless authorization is the admin
+// token as a Bearer token, or a 503 error with the message disabled if the
+// server has no admin token.
+func (s *Server) checkAdminToken(authorization string, disabled string) error {
+	s.mu.RLock()
+	token := s.adminToken
+	s.mu.RUnlock()
+	if token == "" {
+		return huma.Error503ServiceUnavailable(disabled)
+	}
+	provided, ok := strings.CutPrefix(authorization, "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+		return huma.Error401Unauthorized("invalid admin token")
+	}
+	return nil
+}
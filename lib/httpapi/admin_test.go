@@ -0,0 +1,56 @@
+package httpapi
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	mf "github.com/zohaibahmed/clauder/lib/msgfmt"
+)
+
+func TestAdminShutdown(t *testing.T) {
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(os.Stdout, nil)))
+	srv := NewServer(ctx, mf.AgentTypeClaude, nil, 0, "/chat")
+
+	shutdown := func(authorization string) int {
+		req := httptest.NewRequest(http.MethodPost, "/v1/admin/shutdown", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		srv.router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusServiceUnavailable, shutdown("Bearer secret"), "disabled by default")
+
+	stopped := make(chan struct{})
+	srv.EnableAdminShutdown("secret", func(context.Context) { close(stopped) })
+
+	assert.Equal(t, http.StatusUnauthorized, shutdown(""))
+	assert.Equal(t, http.StatusUnauthorized, shutdown("Bearer wrong"))
+	assert.Equal(t, http.StatusUnauthorized, shutdown("secret"))
+	select {
+	case <-stopped:
+		t.Fatal("server stopped without a valid token")
+	default:
+	}
+
+	assert.Equal(t, http.StatusAccepted, shutdown("Bearer secret"))
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("server didn't stop")
+	}
+	select {
+	case <-srv.shutdown:
+	default:
+		t.Fatal("SSE subscribers weren't notified")
+	}
+}
@@ -10,16 +10,23 @@ import (
 
 // AuthMiddleware creates a middleware that requires Bearer token authentication
 func AuthMiddleware(token string) func(http.Handler) http.Handler {
+	return authMiddleware(func(provided string) bool { return provided == token })
+}
+
+// authMiddleware requires a Bearer token for which valid returns true.
+func authMiddleware(valid func(token string) bool) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Skip auth for certain endpoints
-			if r.URL.Path == "/health" || strings.HasPrefix(r.URL.Path, "/internal/") {
+			// Skip auth for certain endpoints, in every API version. The
+			// workspaces check their own tokens.
+			path := unversionedPath(r.URL.Path)
+			if path == "/health" || path == "/livez" || strings.HasPrefix(path, "/internal/") || strings.HasPrefix(r.URL.Path, "/workspaces/") {
 				next.ServeHTTP(w, r)
 				return
 			}
 
 			// Skip auth for raw message types (used by attach command)
-			if r.URL.Path == "/message" && r.Method == "POST" {
+			if path == "/message" && r.Method == "POST" {
 				if isRawMessage(r) {
 					next.ServeHTTP(w, r)
 					return
@@ -40,7 +47,7 @@ func AuthMiddleware(token string) func(http.Handler) http.Handler {
 			}
 
 			providedToken := auth[len(prefix):]
-			if providedToken != token {
+			if !valid(providedToken) {
 				http.Error(w, "Invalid token", http.StatusUnauthorized)
 				return
 			}
@@ -0,0 +1,42 @@
+package httpapi
+
+import (
+	"context"
+	"time"
+
+	st "github.com/zohaibahmed/clauder/lib/screentracker"
+)
+
+// EnableAutoResize resizes the agent's terminal to the width resizer picks
+// from the agent's output, which must be written to resizer, until ctx is
+// done. The height stays the same. Clients are sent a pty_resized event
+// after every resize.
+func (s *Server) EnableAutoResize(ctx context.Context, resizer *st.AutoResizer, height uint16) {
+	s.startAutoResize(ctx, resizer, height, st.AutoResizeWindow)
+}
+
+// startAutoResize checks whether to resize the agent's terminal every
+// interval.
+func (s *Server) startAutoResize(ctx context.Context, resizer *st.AutoResizer, height uint16, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			width, resize := resizer.Check()
+			if !resize {
+				continue
+			}
+			if err := s.agentio.Resize(uint16(width), height); err != nil {
+				s.logger.Warn("Failed to resize the agent's terminal", "width", width, "height", height, "error", err)
+				continue
+			}
+			s.logger.Info("Resized the agent's terminal", "width", width, "height", height)
+			s.emitter.EmitPTYResized(width, int(height))
+		}
+	}()
+}
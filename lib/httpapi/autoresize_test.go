@@ -0,0 +1,63 @@
+package httpapi
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	mf "github.com/zohaibahmed/clauder/lib/msgfmt"
+	st "github.com/zohaibahmed/clauder/lib/screentracker"
+	"github.com/zohaibahmed/clauder/lib/termexec"
+)
+
+func TestAutoResize(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("stty isn't available on Windows")
+	}
+	if _, err := exec.LookPath("stty"); err != nil {
+		t.Skip("stty not found")
+	}
+	ctx, cancel := context.WithCancel(logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil))))
+	defer cancel()
+	// the agent fills the whole width of its terminal
+	resizer := st.NewAutoResizer(80)
+	process, err := termexec.StartProcess(ctx, termexec.StartProcessConfig{
+		Program:        "sh",
+		Args:           []string{"-c", `line=$(printf '%080d' 0); for i in $(seq 20); do echo "$line"; done; read resized; echo "size=$(stty size)"; sleep 5`},
+		TerminalWidth:  80,
+		TerminalHeight: 24,
+		Output:         resizer,
+	})
+	require.NoError(t, err)
+	defer process.Close(slog.New(slog.NewTextHandler(io.Discard, nil)), time.Second)
+
+	srv := NewServer(ctx, mf.AgentTypeClaude, process, 0, "/chat")
+	_, ch, _ := srv.emitter.Subscribe()
+	srv.startAutoResize(ctx, resizer, 24, 50*time.Millisecond)
+
+	timeout := time.After(5 * time.Second)
+	for resized := false; !resized; {
+		select {
+		case event := <-ch:
+			if event.Type == EventTypePTYResized {
+				assert.Equal(t, PTYResizedBody{Type: "pty_resized", Width: 100, Height: 24}, event.Payload)
+				resized = true
+			}
+		case <-timeout:
+			t.Fatal("the terminal wasn't resized")
+		}
+	}
+	_, err = process.Write([]byte("\n"))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return strings.Contains(process.ReadScreen(), "size=24 100")
+	}, 5*time.Second, 10*time.Millisecond, "the agent sees the new size")
+}
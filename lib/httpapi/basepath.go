@@ -0,0 +1,77 @@
+package httpapi
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/danielgtaylor/huma/v2"
+	"golang.org/x/xerrors"
+)
+
+// basePathRegex matches base paths like /clauder or /tools/clauder. The
+// characters are limited so that they can be used in a ServeMux pattern.
+var basePathRegex = regexp.MustCompile(`^(/[A-Za-z0-9._~-]+)+$`)
+
+// NormalizeBasePath returns basePath with a leading slash and without a
+// trailing one, or "" if basePath is empty or "/".
+func NormalizeBasePath(basePath string) (string, error) {
+	basePath = strings.TrimRight(strings.TrimSpace(basePath), "/")
+	if basePath == "" {
+		return "", nil
+	}
+	if !strings.HasPrefix(basePath, "/") {
+		basePath = "/" + basePath
+	}
+	if !basePathRegex.MatchString(basePath) {
+		return "", xerrors.Errorf("invalid base path %q, expected path segments of letters, digits, '.', '_', '~' and '-'", basePath)
+	}
+	for _, segment := range strings.Split(basePath, "/") {
+		if segment == "." || segment == ".." {
+			return "", xerrors.Errorf("invalid base path %q, it can't contain '.' or '..' segments", basePath)
+		}
+	}
+	return basePath, nil
+}
+
+// SetBasePath serves every endpoint under basePath instead of /, for when
+// the server runs behind a reverse proxy that mounts it at e.g. /clauder.
+// Requests outside of basePath get a 404. It must be called before Start.
+func (s *Server) SetBasePath(basePath string) error {
+	basePath, err := NormalizeBasePath(basePath)
+	if err != nil {
+		return err
+	}
+	s.basePath = basePath
+	if basePath != "" {
+		s.api.OpenAPI().Servers = []*huma.Server{{URL: basePath}}
+	} else {
+		s.api.OpenAPI().Servers = nil
+	}
+	return nil
+}
+
+// handler returns the handler that serves the routes under the base path.
+// The routes are registered without it, and the auth middleware sees the
+// paths with the base path removed. The bodies are logged if
+// EnableBodyLogging was called, and the security headers are set on every
+// response, including the 404s outside of the base path, if
+// EnableSecurityHeaders was called.
+func (s *Server) handler() http.Handler {
+	var router http.Handler = s.router
+	s.mu.RLock()
+	bodyLogging, securityHeaders := s.bodyLogging, s.securityHeaders
+	s.mu.RUnlock()
+	if bodyLogging != nil {
+		router = bodyLogging(router)
+	}
+	if s.basePath != "" {
+		mux := http.NewServeMux()
+		mux.Handle(s.basePath+"/", http.StripPrefix(s.basePath, router))
+		router = mux
+	}
+	if securityHeaders != nil {
+		router = securityHeaders(router)
+	}
+	return router
+}
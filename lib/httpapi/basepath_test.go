@@ -0,0 +1,89 @@
+package httpapi
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	mf "github.com/zohaibahmed/clauder/lib/msgfmt"
+)
+
+func TestNormalizeBasePath(t *testing.T) {
+	for input, expected := range map[string]string{
+		"":                "",
+		"/":               "",
+		"/clauder":        "/clauder",
+		"clauder":         "/clauder",
+		"/clauder/":       "/clauder",
+		"/tools/clauder/": "/tools/clauder",
+		"/v1.2_a~b-c":     "/v1.2_a~b-c",
+	} {
+		basePath, err := NormalizeBasePath(input)
+		require.NoError(t, err, input)
+		assert.Equal(t, expected, basePath, input)
+	}
+	for _, input := range []string{"/a b", "/{name}", "/a?b", "/a//b", "/../etc", "/a/./b", "/é"} {
+		_, err := NormalizeBasePath(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestBasePath(t *testing.T) {
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	srv := NewServerWithAuth(ctx, mf.AgentTypeClaude, nil, 0, "/clauder/chat", "secret")
+	require.NoError(t, srv.SetBasePath("/clauder/"))
+	httpSrv := httptest.NewServer(srv.handler())
+	defer httpSrv.Close()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	get := func(path string, token string) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, httpSrv.URL+path, nil)
+		require.NoError(t, err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		return resp
+	}
+
+	for _, endpoint := range []string{"/v1/health", "/v1/livez", "/v1/status", "/v1/messages", "/v1/templates", "/openapi.json"} {
+		assert.Equal(t, http.StatusOK, get("/clauder"+endpoint, "secret").StatusCode, endpoint)
+		assert.Equal(t, http.StatusNotFound, get(endpoint, "secret").StatusCode, endpoint)
+	}
+
+	// the auth middleware sees the paths without the base path
+	assert.Equal(t, http.StatusOK, get("/clauder/v1/health", "").StatusCode)
+	assert.Equal(t, http.StatusUnauthorized, get("/clauder/v1/status", "").StatusCode)
+	assert.Equal(t, http.StatusUnauthorized, get("/clauder/v1/status", "wrong").StatusCode)
+
+	resp := get("/clauder/", "secret")
+	assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+	assert.Equal(t, "/clauder/chat/embed", resp.Header.Get("Location"))
+	assert.Equal(t, http.StatusNotFound, get("/", "secret").StatusCode)
+	assert.Equal(t, http.StatusNotFound, get("/clauderx/health", "").StatusCode)
+
+	servers := srv.api.OpenAPI().Servers
+	require.Len(t, servers, 1)
+	assert.Equal(t, "/clauder", servers[0].URL)
+}
+
+func TestNoBasePath(t *testing.T) {
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	srv := NewServer(ctx, mf.AgentTypeClaude, nil, 0, "/chat")
+	require.NoError(t, srv.SetBasePath("/"))
+	rec := httptest.NewRecorder()
+	srv.handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/health", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, srv.api.OpenAPI().Servers)
+
+	assert.Error(t, srv.SetBasePath("/a b"))
+}
@@ -0,0 +1,118 @@
+package httpapi
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// DefaultBodyLogMaxBytes is how much of the bodies BodyLoggingMiddleware
+// logs if it's passed 0.
+const DefaultBodyLogMaxBytes = 200
+
+// BodyLoggingMiddleware logs the body of requests, and of the responses
+// that aren't SSE streams, at the debug level of the default logger. The
+// bodies are truncated to maxBytes.
+func BodyLoggingMiddleware(maxBytes int) func(http.Handler) http.Handler {
+	return bodyLoggingMiddleware(slog.Default(), maxBytes)
+}
+
+func bodyLoggingMiddleware(logger *slog.Logger, maxBytes int) func(http.Handler) http.Handler {
+	if maxBytes <= 0 {
+		maxBytes = DefaultBodyLogMaxBytes
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !logger.Enabled(r.Context(), slog.LevelDebug) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, "Failed to read request body", http.StatusBadRequest)
+				return
+			}
+			// Restore the body for the next handler
+			r.Body = io.NopCloser(bytes.NewBuffer(body))
+			if len(body) > 0 {
+				logger.Debug("HTTP request body", "method", r.Method, "path", r.URL.Path, "size", len(body), "body", truncateBody(body, maxBytes))
+			}
+
+			rec := &bodyRecorder{ResponseWriter: w, maxBytes: maxBytes, status: http.StatusOK}
+			next.ServeHTTP(rec, r)
+			if !rec.sse {
+				logger.Debug("HTTP response body", "method", r.Method, "path", r.URL.Path, "status", rec.status, "size", rec.size, "body", string(rec.body.Bytes()))
+			}
+		})
+	}
+}
+
+// truncateBody returns the first maxBytes bytes of body.
+func truncateBody(body []byte, maxBytes int) string {
+	if len(body) > maxBytes {
+		body = body[:maxBytes]
+	}
+	return string(body)
+}
+
+// bodyRecorder keeps the first maxBytes bytes of a response, unless it's
+// an SSE stream. The response is passed through.
+type bodyRecorder struct {
+	http.ResponseWriter
+	maxBytes int
+
+	wroteHeader bool
+	sse         bool
+	status      int
+	size        int
+	body        bytes.Buffer
+}
+
+func (w *bodyRecorder) WriteHeader(statusCode int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.status = statusCode
+		w.sse = strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream")
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *bodyRecorder) Write(data []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.sse {
+		w.size += len(data)
+		if remaining := w.maxBytes - w.body.Len(); remaining > 0 {
+			w.body.Write(data[:min(remaining, len(data))])
+		}
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *bodyRecorder) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController and the sse package reach the
+// underlying writer.
+func (w *bodyRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// EnableBodyLogging makes the server log the bodies of requests and
+// responses at the debug level, truncated to maxBytes. See
+// BodyLoggingMiddleware.
+func (s *Server) EnableBodyLogging(maxBytes int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bodyLogging = bodyLoggingMiddleware(s.logger, maxBytes)
+}
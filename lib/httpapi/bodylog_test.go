@@ -0,0 +1,92 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// logRecords parses the records a JSON handler wrote to buf.
+func logRecords(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &record))
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestBodyLoggingMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	var received []string
+	handler := bodyLoggingMiddleware(logger, 10)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the downstream handler still reads the whole body
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		received = append(received, string(body))
+		_, _ = io.WriteString(w, `{"ok":true,`)
+		_, _ = io.WriteString(w, `"more":"fields"}`)
+	}))
+
+	for _, body := range []string{"0123456789", "0123456789X"} {
+		buf.Reset()
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/message", strings.NewReader(body)))
+		assert.Equal(t, `{"ok":true,"more":"fields"}`, rec.Body.String())
+
+		records := logRecords(t, &buf)
+		require.Len(t, records, 2)
+		assert.Equal(t, "HTTP request body", records[0]["msg"])
+		assert.Equal(t, "/message", records[0]["path"])
+		assert.Equal(t, "0123456789", records[0]["body"], "the body is truncated to exactly 10 bytes")
+		assert.EqualValues(t, len(body), records[0]["size"])
+		assert.Equal(t, "HTTP response body", records[1]["msg"])
+		assert.Equal(t, `{"ok":true`, records[1]["body"])
+		assert.EqualValues(t, 27, records[1]["size"])
+		assert.EqualValues(t, http.StatusOK, records[1]["status"])
+	}
+	assert.Equal(t, []string{"0123456789", "0123456789X"}, received)
+}
+
+func TestBodyLoggingMiddlewareSSE(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	handler := bodyLoggingMiddleware(logger, 10)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, "event: status_change\ndata: {}\n\n")
+		// SSE responses must still be flushed
+		require.NoError(t, http.NewResponseController(w).Flush())
+	}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/events", nil))
+	assert.True(t, rec.Flushed)
+	assert.Equal(t, "event: status_change\ndata: {}\n\n", rec.Body.String())
+	assert.Empty(t, logRecords(t, &buf), "GET requests have no body, and SSE responses aren't logged")
+}
+
+func TestBodyLoggingMiddlewareInfoLevel(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	handler := bodyLoggingMiddleware(logger, 0)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(body)
+	}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/message", strings.NewReader("hello")))
+	assert.Equal(t, "hello", rec.Body.String())
+	assert.Empty(t, buf.String())
+}
@@ -0,0 +1,157 @@
+package httpapi
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	st "github.com/zohaibahmed/clauder/lib/screentracker"
+)
+
+// maxWorkspaceBranches is the number of branches a workspace can have at
+// the same time.
+const maxWorkspaceBranches = 3
+
+// BranchBody is the branch to create from a workspace.
+type BranchBody struct {
+	ID          string `json:"id,omitempty" required:"false" pattern:"^[a-z0-9][a-z0-9-]*$" maxLength:"64" example:"team-a-retry" doc:"ID of the branch. Generated if empty."`
+	Name        string `json:"name,omitempty" required:"false" maxLength:"128" example:"Team A, asked differently" doc:"Name of the branch. Defaults to the name of the workspace it's branched from."`
+	Token       string `json:"token,omitempty" required:"false" minLength:"16" doc:"Bearer token the branch's endpoints require. Generated if empty."`
+	ReplayDelay int    `json:"replay_delay_ms" required:"false" minimum:"0" maximum:"60000" default:"1000" doc:"Milliseconds to wait between the replayed messages once the agent finished responding to the previous one"`
+}
+
+type BranchWorkspaceRequest struct {
+	Authorization string `header:"Authorization" doc:"Bearer token with the admin token"`
+	ID            string `path:"id" doc:"ID of the workspace to branch"`
+	Body          BranchBody
+}
+
+type ListBranchesRequest struct {
+	Authorization string `header:"Authorization" doc:"Bearer token with the admin token"`
+	ID            string `path:"id" doc:"ID of the workspace"`
+}
+
+type BranchesResponse struct {
+	Body struct {
+		Branches []Workspace `json:"branches" nullable:"false" doc:"Branches of the workspace sorted by ID. Their tokens are left out."`
+	}
+}
+
+// branches returns the IDs of the branches of the workspace parent,
+// including those whose agent is starting. mu must be held.
+func (w *workspaceStore) branches(parent string) []string {
+	var ids []string
+	for id, p := range w.parents {
+		if p == parent {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// lookupWorkspace returns the workspace with the given ID, including the
+// default workspace, and its server.
+func (s *Server) lookupWorkspace(store *workspaceStore, id string) (Workspace, *Server, error) {
+	if id == DefaultWorkspaceID {
+		return s.defaultWorkspace(), s, nil
+	}
+	ws, ok := store.get(id)
+	if !ok || ws == nil {
+		return Workspace{}, nil, huma.Error404NotFound(fmt.Sprintf("workspace %s not found", id))
+	}
+	return ws.Workspace, ws.server, nil
+}
+
+// branchWorkspace handles POST /admin/workspaces/{id}/branch
+func (s *Server) branchWorkspace(ctx context.Context, input *BranchWorkspaceRequest) (*WorkspaceResponse, error) {
+	store, err := s.loadWorkspaces(input.Authorization)
+	if err != nil {
+		return nil, err
+	}
+	parent, parentServer, err := s.lookupWorkspace(store, input.ID)
+	if err != nil {
+		return nil, err
+	}
+	// the messages are those sent before the branch was requested
+	var userMessages []string
+	for _, message := range parentServer.messages() {
+		if message.Role == st.ConversationRoleUser {
+			userMessages = append(userMessages, message.Message)
+		}
+	}
+	created, err := s.startBranch(store, parent, input.Body, userMessages)
+	if err != nil {
+		return nil, err
+	}
+	return &WorkspaceResponse{Body: created.withMaskedEnv()}, nil
+}
+
+// startBranch starts a branch of parent, and sends it messages in the
+// background.
+func (s *Server) startBranch(store *workspaceStore, parent Workspace, body BranchBody, messages []string) (Workspace, error) {
+	if parent.AgentConfig.Program == "" {
+		return Workspace{}, huma.Error400BadRequest("the agent program of the default workspace is unknown, so it can't be branched")
+	}
+	created := Workspace{ID: body.ID, Name: body.Name, Token: body.Token, AgentConfig: parent.AgentConfig, Parent: parent.ID}
+	if created.Name == "" {
+		created.Name = parent.Name
+	}
+	if err := generateWorkspaceCredentials(&created); err != nil {
+		return Workspace{}, err
+	}
+	ws, err := s.startWorkspace(store, created)
+	if err != nil {
+		return Workspace{}, err
+	}
+	go s.replayMessages(ws, messages, time.Duration(body.ReplayDelay)*time.Millisecond)
+	return created, nil
+}
+
+// replayMessages sends the user messages of the workspace a branch was
+// branched from to the branch's agent, one at a time, each once the agent
+// finished responding to the previous one and delay passed.
+func (s *Server) replayMessages(ws *workspace, messages []string, delay time.Duration) {
+	for i, message := range messages {
+		if i > 0 {
+			select {
+			case <-ws.ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+		}
+		ws.server.dispatchMessage(ws.ctx, MessageRequestBody{Type: MessageTypeUser, Content: message})
+	}
+	if ws.ctx.Err() == nil {
+		s.logger.Info("Replayed the messages of the branch", "id", ws.ID, "parent", ws.Parent, "messages", len(messages))
+	}
+}
+
+// listBranches handles GET /admin/workspaces/{id}/branches
+func (s *Server) listBranches(ctx context.Context, input *ListBranchesRequest) (*BranchesResponse, error) {
+	store, err := s.loadWorkspaces(input.Authorization)
+	if err != nil {
+		return nil, err
+	}
+	store.mu.RLock()
+	_, ok := store.workspaces[input.ID]
+	branches := []Workspace{}
+	for _, id := range store.branches(input.ID) {
+		if ws := store.workspaces[id]; ws != nil {
+			listed := ws.Workspace.withMaskedEnv()
+			listed.Token = ""
+			branches = append(branches, listed)
+		}
+	}
+	store.mu.RUnlock()
+	if !ok && input.ID != DefaultWorkspaceID {
+		return nil, huma.Error404NotFound(fmt.Sprintf("workspace %s not found", input.ID))
+	}
+	slices.SortFunc(branches, func(a, b Workspace) int { return strings.Compare(a.ID, b.ID) })
+
+	resp := &BranchesResponse{}
+	resp.Body.Branches = branches
+	return resp, nil
+}
@@ -0,0 +1,139 @@
+package httpapi
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	mf "github.com/zohaibahmed/clauder/lib/msgfmt"
+	st "github.com/zohaibahmed/clauder/lib/screentracker"
+)
+
+// userMessages returns the contents of the user messages of a server.
+func userMessages(srv *Server) []string {
+	contents := []string{}
+	for _, message := range srv.messages() {
+		if message.Role == st.ConversationRoleUser {
+			contents = append(contents, message.Message)
+		}
+	}
+	return contents
+}
+
+func TestBranchWorkspace(t *testing.T) {
+	ctx, cancel := context.WithCancel(logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil))))
+	defer cancel()
+	srv := NewServer(ctx, mf.AgentTypeClaude, nil, 0, "/chat")
+	httpSrv := httptest.NewServer(srv.handler())
+	defer httpSrv.Close()
+	srv.EnableAdminShutdown("admin", nil)
+	srv.EnableWorkspaces(ctx, nil)
+	started := map[string]Workspace{}
+	srv.workspaces.Load().startServer = func(ctx context.Context, workspace Workspace, basePath string) (*Server, error) {
+		started[workspace.ID] = workspace
+		wsSrv := NewServerWithAuth(ctx, workspace.AgentConfig.Type, nil, 0, basePath+"/chat", workspace.Token)
+		require.NoError(t, wsSrv.SetBasePath(basePath))
+		wsSrv.conversation = st.NewConversation(ctx, st.ConversationConfig{
+			AgentIO:               &echoAgent{},
+			GetTime:               time.Now,
+			SnapshotInterval:      time.Millisecond,
+			ScreenStabilityLength: 20 * time.Millisecond,
+		})
+		wsSrv.StartSnapshotLoop(ctx)
+		return wsSrv, nil
+	}
+	admin := httpSrv.URL + "/v1/admin/workspaces"
+	workspaceURL := func(id string) string { return httpSrv.URL + "/workspaces/" + id }
+	get := func(id string) *workspace {
+		ws, ok := srv.workspaces.Load().get(id)
+		require.True(t, ok)
+		return ws
+	}
+	send := func(id, token, content string) {
+		require.Eventually(t, func() bool {
+			return get(id).server.conversation.Status() == st.ConversationStatusStable
+		}, 5*time.Second, 10*time.Millisecond)
+		resp := doWorkspaceRequest(t, http.MethodPost, workspaceURL(id)+"/v1/message", token, `{"type":"user","content":"`+content+`"}`, nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	require.Equal(t, http.StatusCreated, doWorkspaceRequest(t, http.MethodPost, admin, "admin", `{"id":"a","name":"Team A","token":"token-a-0123456789","agent_config":{"program":"agent-a","args":["--verbose"]}}`, nil).StatusCode)
+	send("a", "token-a-0123456789", "fix the parser")
+	send("a", "token-a-0123456789", "now add tests")
+	require.Eventually(t, func() bool { return len(userMessages(get("a").server)) == 2 }, 5*time.Second, 10*time.Millisecond)
+
+	var branch Workspace
+	assert.Equal(t, http.StatusUnauthorized, doWorkspaceRequest(t, http.MethodPost, admin+"/a/branch", "wrong", `{}`, nil).StatusCode)
+	assert.Equal(t, http.StatusNotFound, doWorkspaceRequest(t, http.MethodPost, admin+"/c/branch", "admin", `{}`, nil).StatusCode)
+	require.Equal(t, http.StatusCreated, doWorkspaceRequest(t, http.MethodPost, admin+"/a/branch", "admin", `{"id":"a-retry","token":"token-a-retry-0123456789","replay_delay_ms":10}`, &branch).StatusCode)
+	assert.Equal(t, Workspace{
+		ID:          "a-retry",
+		Name:        "Team A",
+		Token:       "token-a-retry-0123456789",
+		AgentConfig: WorkspaceAgentConfig{Type: mf.AgentTypeCustom, Program: "agent-a", Args: []string{"--verbose"}},
+		Parent:      "a",
+	}, branch)
+	assert.Equal(t, branch, started["a-retry"], "the branch runs a new agent with the same config")
+
+	// the branch's history is replayed from the parent's
+	require.Eventually(t, func() bool {
+		return len(userMessages(get("a-retry").server)) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"fix the parser", "now add tests"}, userMessages(get("a-retry").server))
+
+	// a message sent to the branch isn't in the parent's event stream
+	resp := doWorkspaceRequest(t, http.MethodGet, workspaceURL("a")+"/v1/events?topics=message_update", "token-a-0123456789", "", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	defer resp.Body.Close()
+	events := bufio.NewReader(resp.Body)
+	send("a-retry", "token-a-retry-0123456789", "add tests first")
+	send("a", "token-a-0123456789", "thanks, that works")
+	for {
+		message := nextUserMessage(t, events)
+		assert.NotEqual(t, "add tests first", message)
+		if message == "thanks, that works" {
+			break
+		}
+	}
+	assert.Equal(t, []string{"fix the parser", "now add tests", "thanks, that works"}, userMessages(get("a").server))
+	assert.Equal(t, http.StatusUnauthorized, doWorkspaceRequest(t, http.MethodGet, workspaceURL("a-retry")+"/v1/status", "token-a-0123456789", "", nil).StatusCode)
+
+	// a workspace has at most 3 branches
+	require.Equal(t, http.StatusCreated, doWorkspaceRequest(t, http.MethodPost, admin+"/a/branch", "admin", `{"id":"a-2"}`, &branch).StatusCode)
+	assert.Len(t, branch.Token, 64)
+	require.Equal(t, http.StatusCreated, doWorkspaceRequest(t, http.MethodPost, admin+"/a/branch", "admin", `{"id":"a-3"}`, nil).StatusCode)
+	assert.Equal(t, http.StatusConflict, doWorkspaceRequest(t, http.MethodPost, admin+"/a/branch", "admin", `{"id":"a-4"}`, nil).StatusCode)
+	assert.Equal(t, http.StatusConflict, doWorkspaceRequest(t, http.MethodPost, admin+"/a-retry/branch", "admin", `{"id":"a-2"}`, nil).StatusCode, "the ID is taken")
+	require.Equal(t, http.StatusCreated, doWorkspaceRequest(t, http.MethodPost, admin+"/a-retry/branch", "admin", `{}`, &branch).StatusCode, "branches can be branched")
+	assert.Equal(t, "a-retry", branch.Parent)
+
+	var branches BranchesResponse
+	require.Equal(t, http.StatusOK, doWorkspaceRequest(t, http.MethodGet, admin+"/a/branches", "admin", "", &branches.Body).StatusCode)
+	ids := []string{}
+	for _, listed := range branches.Body.Branches {
+		ids = append(ids, listed.ID)
+		assert.Empty(t, listed.Token)
+		assert.Equal(t, "a", listed.Parent)
+	}
+	assert.Equal(t, []string{"a-2", "a-3", "a-retry"}, ids)
+	assert.Equal(t, http.StatusNotFound, doWorkspaceRequest(t, http.MethodGet, admin+"/c/branches", "admin", "", nil).StatusCode)
+
+	// deleting a branch frees its slot
+	require.Equal(t, http.StatusNoContent, doWorkspaceRequest(t, http.MethodDelete, admin+"/a-3", "admin", "", nil).StatusCode)
+	assert.Equal(t, http.StatusCreated, doWorkspaceRequest(t, http.MethodPost, admin+"/a/branch", "admin", `{"id":"a-4"}`, nil).StatusCode)
+
+	// the default workspace is only branched if its agent is known
+	assert.Equal(t, http.StatusBadRequest, doWorkspaceRequest(t, http.MethodPost, admin+"/default/branch", "admin", `{}`, nil).StatusCode)
+	srv.SetDefaultWorkspaceAgent(WorkspaceAgentConfig{Type: mf.AgentTypeClaude, Program: "claude"})
+	require.Equal(t, http.StatusCreated, doWorkspaceRequest(t, http.MethodPost, admin+"/default/branch", "admin", `{}`, &branch).StatusCode)
+	assert.Equal(t, DefaultWorkspaceID, branch.Parent)
+	assert.Equal(t, "claude", started[branch.ID].AgentConfig.Program)
+}
@@ -0,0 +1,96 @@
+package httpapi
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	mf "github.com/zohaibahmed/clauder/lib/msgfmt"
+)
+
+type cacheEntry struct {
+	response  string
+	expiresAt time.Time
+}
+
+// ContentAddressedCache stores agent responses keyed by the hash of the
+// agent type and the user message, so that repeated prompts don't have to
+// be processed by the agent again.
+type ContentAddressedCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]cacheEntry
+	getTime func() time.Time
+	// nextSweep is when Put next removes the expired entries, so that
+	// entries that are never looked up again don't pile up.
+	nextSweep time.Time
+}
+
+func NewContentAddressedCache(ttl time.Duration) *ContentAddressedCache {
+	return &ContentAddressedCache{
+		ttl:     ttl,
+		entries: make(map[string]cacheEntry),
+		getTime: time.Now,
+	}
+}
+
+// CacheKey returns the cache key for a message sent to an agent. The agent
+// type is part of the key because different agents respond differently to
+// the same prompt.
+func CacheKey(agentType mf.AgentType, message string) string {
+	// message validation rejects null bytes, so the separator can't be forged
+	sum := sha256.Sum256([]byte(string(agentType) + "\x00" + message))
+	return hex.EncodeToString(sum[:])
+}
+
+// TTL returns how long responses are cached.
+func (c *ContentAddressedCache) TTL() time.Duration {
+	return c.ttl
+}
+
+// Get returns the cached response for the message, if it hasn't expired.
+func (c *ContentAddressedCache) Get(agentType mf.AgentType, message string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := CacheKey(agentType, message)
+	entry, ok := c.entries[key]
+	if !ok {
+		return "", false
+	}
+	if !c.getTime().Before(entry.expiresAt) {
+		delete(c.entries, key)
+		return "", false
+	}
+	return entry.response, true
+}
+
+// Put caches the agent's response to the message.
+func (c *ContentAddressedCache) Put(agentType mf.AgentType, message string, response string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.getTime()
+	if !now.Before(c.nextSweep) {
+		// sweeping once per TTL keeps entries at most twice the TTL
+		for key, entry := range c.entries {
+			if !now.Before(entry.expiresAt) {
+				delete(c.entries, key)
+			}
+		}
+		c.nextSweep = now.Add(c.ttl)
+	}
+	c.entries[CacheKey(agentType, message)] = cacheEntry{
+		response:  response,
+		expiresAt: now.Add(c.ttl),
+	}
+}
+
+// Len returns the number of cached responses, including the expired ones
+// that weren't removed yet.
+func (c *ContentAddressedCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
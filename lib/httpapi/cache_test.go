@@ -0,0 +1,151 @@
+package httpapi
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	mf "github.com/zohaibahmed/clauder/lib/msgfmt"
+	st "github.com/zohaibahmed/clauder/lib/screentracker"
+)
+
+// echoAgent echoes everything written to it on its screen.
+type echoAgent struct {
+	mu     sync.Mutex
+	screen strings.Builder
+	writes int
+}
+
+func (a *echoAgent) Write(data []byte) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.writes++
+	return a.screen.Write(data)
+}
+
+func (a *echoAgent) ReadScreen() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.screen.String()
+}
+
+func (a *echoAgent) Writes() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.writes
+}
+
+func TestContentAddressedCache(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := NewContentAddressedCache(time.Minute)
+	cache.getTime = func() time.Time { return now }
+
+	_, ok := cache.Get(mf.AgentTypeClaude, "explain this code")
+	assert.False(t, ok)
+
+	cache.Put(mf.AgentTypeClaude, "explain this code", "It adds two numbers.")
+	response, ok := cache.Get(mf.AgentTypeClaude, "explain this code")
+	assert.True(t, ok)
+	assert.Equal(t, "It adds two numbers.", response)
+
+	// Responses aren't shared between agent types.
+	_, ok = cache.Get(mf.AgentTypeAider, "explain this code")
+	assert.False(t, ok)
+	assert.NotEqual(t, CacheKey(mf.AgentTypeClaude, "explain this code"), CacheKey(mf.AgentTypeAider, "explain this code"))
+
+	now = now.Add(time.Minute)
+	_, ok = cache.Get(mf.AgentTypeClaude, "explain this code")
+	assert.False(t, ok)
+}
+
+func TestContentAddressedCacheSweep(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := NewContentAddressedCache(time.Minute)
+	cache.getTime = func() time.Time { return now }
+
+	// distinct messages that are never looked up again
+	for i := range 100 {
+		cache.Put(mf.AgentTypeClaude, fmt.Sprintf("message %d", i), "response")
+		now = now.Add(100 * time.Millisecond)
+	}
+	assert.Equal(t, 100, cache.Len())
+
+	now = now.Add(time.Minute)
+	cache.Put(mf.AgentTypeClaude, "another message", "response")
+	assert.Equal(t, 1, cache.Len(), "the expired entries are removed")
+	response, ok := cache.Get(mf.AgentTypeClaude, "another message")
+	assert.True(t, ok)
+	assert.Equal(t, "response", response)
+
+	// with a steady stream of messages, the cache holds at most twice the
+	// messages of a TTL
+	for i := range 1000 {
+		cache.Put(mf.AgentTypeClaude, fmt.Sprintf("stream %d", i), "response")
+		now = now.Add(time.Second)
+		assert.LessOrEqual(t, cache.Len(), 121)
+	}
+}
+
+func TestCreateMessageResponseCache(t *testing.T) {
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(os.Stdout, nil)))
+	srv := NewServer(ctx, mf.AgentTypeCustom, nil, 0, "/chat")
+	agent := &echoAgent{}
+	srv.conversation = st.NewConversation(ctx, st.ConversationConfig{
+		AgentIO:                    agent,
+		GetTime:                    time.Now,
+		SnapshotInterval:           time.Millisecond,
+		ScreenStabilityLength:      2 * time.Millisecond,
+		SkipSendMessageStatusCheck: true,
+	})
+	srv.EnableResponseCache(time.Minute)
+	now := time.Now()
+	srv.responseCache.getTime = func() time.Time { return now }
+
+	request := &MessageRequest{Body: MessageRequestBody{Type: MessageTypeUser, Content: "what does main do"}}
+	sendAndRespond := func() {
+		t.Helper()
+		resp, err := srv.createMessage(ctx, request)
+		require.NoError(t, err)
+		assert.Equal(t, "MISS", resp.Cache)
+		assert.Equal(t, "max-age=60", resp.CacheControl)
+		assert.Empty(t, resp.Body.CachedResponse)
+
+		// The agent responds and goes idle.
+		srv.updateResponseCache()
+		agent.mu.Lock()
+		agent.screen.WriteString("\nIt prints hello.")
+		agent.mu.Unlock()
+		for range 3 {
+			srv.conversation.AddSnapshot(agent.ReadScreen())
+		}
+		srv.updateResponseCache()
+	}
+
+	sendAndRespond()
+	writes := agent.Writes()
+	require.Greater(t, writes, 0)
+	messages := srv.conversation.Messages()
+	agentResponse := messages[len(messages)-1]
+	require.Equal(t, st.ConversationRoleAgent, agentResponse.Role)
+	require.Contains(t, agentResponse.Message, "It prints hello.")
+
+	resp, err := srv.createMessage(ctx, request)
+	require.NoError(t, err)
+	assert.Equal(t, "HIT", resp.Cache)
+	assert.Equal(t, "max-age=60", resp.CacheControl)
+	assert.True(t, resp.Body.Ok)
+	assert.Equal(t, agentResponse.Message, resp.Body.CachedResponse)
+	assert.Equal(t, writes, agent.Writes(), "a cache hit must not write to the agent")
+
+	now = now.Add(time.Minute)
+	sendAndRespond()
+	assert.Greater(t, agent.Writes(), writes, "an expired entry must be sent to the agent")
+}
@@ -27,7 +27,7 @@ func formatClaudeCodeMessage(message string) []st.MessagePart {
 }
 
 func FormatMessage(agentType mf.AgentType, message string) []st.MessagePart {
-	message = mf.TrimWhitespace(message)
+	message = mf.FormatUserMessage(agentType, message)
 	// for now Claude Code formatting seems to also work for Goose and Aider
 	// so we can use the same function for all three
 	return formatClaudeCodeMessage(message)
@@ -0,0 +1,181 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// CodeBlock is a block of code extracted from an agent message.
+type CodeBlock struct {
+	Language  string `json:"language" doc:"Language of the code block. Taken from the opening fence if present, otherwise inferred from the content. Empty if the language could not be determined."`
+	Content   string `json:"content" doc:"Contents of the code block, without the fences."`
+	StartLine int    `json:"start_line" doc:"1-based line number of the first line of the code block content in the message."`
+	EndLine   int    `json:"end_line" doc:"1-based line number of the last line of the code block content in the message."`
+}
+
+type codeBlockParserState int
+
+const (
+	codeBlockStateText codeBlockParserState = iota
+	codeBlockStateFenced
+	codeBlockStateIndented
+)
+
+const indentedCodePrefix = "    "
+
+// fenceMarker returns the fence marker (e.g. "```" or "~~~~") and the info
+// string if the line opens or closes a fenced code block.
+func fenceMarker(line string) (string, string, bool) {
+	trimmed := strings.TrimLeft(line, " ")
+	// More than 3 spaces of indentation makes it an indented code block
+	// line, not a fence.
+	if len(line)-len(trimmed) > 3 {
+		return "", "", false
+	}
+	for _, c := range []byte{'`', '~'} {
+		n := 0
+		for n < len(trimmed) && trimmed[n] == c {
+			n++
+		}
+		if n >= 3 {
+			return trimmed[:n], strings.TrimSpace(trimmed[n:]), true
+		}
+	}
+	return "", "", false
+}
+
+func isBlank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+func isIndentedCodeLine(line string) bool {
+	return (strings.HasPrefix(line, indentedCodePrefix) || strings.HasPrefix(line, "\t")) && !isBlank(line)
+}
+
+func trimIndent(line string) string {
+	if strings.HasPrefix(line, "\t") {
+		return line[1:]
+	}
+	return strings.TrimPrefix(line, indentedCodePrefix)
+}
+
+// ExtractCodeBlocks returns all fenced and indented code blocks in the message.
+//
+// The message is parsed line by line with a small state machine. A fence opens
+// a block that runs until a matching closing fence or the end of the message;
+// an unterminated block is returned as is, since the agent may still be writing
+// it. Lines inside a fenced block are never treated as indented code.
+// Indented blocks follow the Markdown rule that they can't interrupt a
+// paragraph, so they must be preceded by a blank line, another block, or
+// start the message.
+func ExtractCodeBlocks(message string) []CodeBlock {
+	lines := strings.Split(message, "\n")
+	blocks := make([]CodeBlock, 0)
+
+	state := codeBlockStateText
+	var openingFence string
+	var language string
+	var blockLines []string
+	startIdx := 0
+	inParagraph := false
+
+	emit := func(endIdx int) {
+		// indented blocks may end with blank lines that belong to the text
+		for len(blockLines) > 0 && state == codeBlockStateIndented && isBlank(blockLines[len(blockLines)-1]) {
+			blockLines = blockLines[:len(blockLines)-1]
+			endIdx--
+		}
+		if len(blockLines) == 0 {
+			return
+		}
+		content := strings.Join(blockLines, "\n")
+		lang := language
+		if lang == "" {
+			lang = inferLanguage(content)
+		}
+		blocks = append(blocks, CodeBlock{
+			Language:  lang,
+			Content:   content,
+			StartLine: startIdx + 1,
+			EndLine:   endIdx + 1,
+		})
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], " \t\r")
+		switch state {
+		case codeBlockStateText:
+			if marker, info, ok := fenceMarker(line); ok {
+				state = codeBlockStateFenced
+				openingFence = marker
+				language = ""
+				if fields := strings.Fields(info); len(fields) > 0 {
+					language = strings.ToLower(fields[0])
+				}
+				blockLines = nil
+				startIdx = i + 1
+				continue
+			}
+			if isIndentedCodeLine(line) && !inParagraph {
+				state = codeBlockStateIndented
+				language = ""
+				blockLines = []string{trimIndent(line)}
+				startIdx = i
+				continue
+			}
+			inParagraph = !isBlank(line)
+		case codeBlockStateFenced:
+			if marker, info, ok := fenceMarker(line); ok && info == "" &&
+				marker[0] == openingFence[0] && len(marker) >= len(openingFence) {
+				emit(i - 1)
+				state = codeBlockStateText
+				inParagraph = false
+				continue
+			}
+			blockLines = append(blockLines, lines[i])
+		case codeBlockStateIndented:
+			if isIndentedCodeLine(line) || isBlank(line) {
+				blockLines = append(blockLines, trimIndent(line))
+				continue
+			}
+			emit(i - 1)
+			state = codeBlockStateText
+			inParagraph = false
+			// The line that ended the block may open the next one.
+			i--
+		}
+	}
+	if state != codeBlockStateText {
+		emit(len(lines) - 1)
+	}
+
+	return blocks
+}
+
+var languageHeuristics = []struct {
+	language string
+	pattern  *regexp.Regexp
+}{
+	{"go", regexp.MustCompile(`(?m)^package \w+$|^import \($|^import "[\w/.-]+"$|^func (\(\w+ \*?\w+\) )?\w+\(.*\{$|\w+ := `)},
+	{"python", regexp.MustCompile(`(?m)^\s*def \w+\(.*\):$|^\s*class \w+(\(.*\))?:$|^from [\w.]+ import |^import \w+(\.\w+)*$|^if __name__ == `)},
+	{"rust", regexp.MustCompile(`(?m)^\s*(pub )?fn \w+|^use \w+::|let mut `)},
+	{"typescript", regexp.MustCompile(`(?m)^\s*(export )?interface \w+ \{|: (string|number|boolean)\b`)},
+	{"javascript", regexp.MustCompile(`(?m)^\s*(const|let|var) \w+ = |^\s*function \w+\(|=> \{|console\.log\(|require\(`)},
+	{"bash", regexp.MustCompile(`(?m)^#!/(usr/)?bin/(env )?(ba)?sh|^\$ `)},
+}
+
+// inferLanguage makes a best effort guess of the language of a code block
+// without a language fence. It returns an empty string if there's no match.
+func inferLanguage(content string) string {
+	trimmed := strings.TrimSpace(content)
+	if (strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[")) && json.Valid([]byte(trimmed)) {
+		return "json"
+	}
+	for _, h := range languageHeuristics {
+		if h.pattern.MatchString(content) {
+			return h.language
+		}
+	}
+	return ""
+}
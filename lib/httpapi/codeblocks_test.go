@@ -0,0 +1,152 @@
+package httpapi
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	mf "github.com/zohaibahmed/clauder/lib/msgfmt"
+)
+
+func TestExtractCodeBlocks(t *testing.T) {
+	t.Run("no-code-blocks", func(t *testing.T) {
+		blocks := ExtractCodeBlocks("Sure! I'll take a look.\nThere is nothing to change.")
+		assert.NotNil(t, blocks)
+		assert.Empty(t, blocks)
+	})
+
+	t.Run("multi-language", func(t *testing.T) {
+		msg := strings.Join([]string{
+			"Here's the Go version:",
+			"",
+			"```go",
+			"func add(a, b int) int {",
+			"\treturn a + b",
+			"}",
+			"```",
+			"",
+			"And the Python version:",
+			"",
+			"```python",
+			"def add(a, b):",
+			"    return a + b",
+			"```",
+		}, "\n")
+		assert.Equal(t, []CodeBlock{
+			{Language: "go", Content: "func add(a, b int) int {\n\treturn a + b\n}", StartLine: 4, EndLine: 6},
+			{Language: "python", Content: "def add(a, b):\n    return a + b", StartLine: 12, EndLine: 13},
+		}, ExtractCodeBlocks(msg))
+	})
+
+	t.Run("adjacent-blocks", func(t *testing.T) {
+		msg := strings.Join([]string{
+			"```bash",
+			"go test ./...",
+			"```",
+			"```",
+			"package main",
+			"",
+			"import \"fmt\"",
+			"```",
+			"    x := 1",
+			"```json",
+			"{\"ok\": true}",
+			"```",
+		}, "\n")
+		assert.Equal(t, []CodeBlock{
+			{Language: "bash", Content: "go test ./...", StartLine: 2, EndLine: 2},
+			{Language: "go", Content: "package main\n\nimport \"fmt\"", StartLine: 5, EndLine: 7},
+			{Language: "go", Content: "x := 1", StartLine: 9, EndLine: 9},
+			{Language: "json", Content: "{\"ok\": true}", StartLine: 11, EndLine: 11},
+		}, ExtractCodeBlocks(msg))
+	})
+
+	t.Run("overlapping-blocks", func(t *testing.T) {
+		// Indented lines and nested fences inside a fenced block belong to the
+		// fenced block. A shorter fence doesn't close a longer one.
+		msg := strings.Join([]string{
+			"Update the README:",
+			"",
+			"````markdown",
+			"Run:",
+			"",
+			"    make build",
+			"",
+			"```sh",
+			"./out/clauder server claude",
+			"```",
+			"````",
+			"",
+			"    from os import path",
+			"    print(path.sep)",
+			"",
+			"",
+			"Done.",
+		}, "\n")
+		assert.Equal(t, []CodeBlock{
+			{
+				Language:  "markdown",
+				Content:   "Run:\n\n    make build\n\n```sh\n./out/clauder server claude\n```",
+				StartLine: 4,
+				EndLine:   10,
+			},
+			{Language: "python", Content: "from os import path\nprint(path.sep)", StartLine: 13, EndLine: 14},
+		}, ExtractCodeBlocks(msg))
+	})
+
+	t.Run("indented-block-cannot-interrupt-paragraph", func(t *testing.T) {
+		msg := "This is a paragraph\n    that continues here\n\n    const x = 1"
+		assert.Equal(t, []CodeBlock{
+			{Language: "javascript", Content: "const x = 1", StartLine: 4, EndLine: 4},
+		}, ExtractCodeBlocks(msg))
+	})
+
+	t.Run("unterminated-fence", func(t *testing.T) {
+		msg := "Writing the file now:\n```rust\nfn main() {\n"
+		assert.Equal(t, []CodeBlock{
+			{Language: "rust", Content: "fn main() {\n", StartLine: 3, EndLine: 4},
+		}, ExtractCodeBlocks(msg))
+	})
+}
+
+func TestInferLanguage(t *testing.T) {
+	cases := []struct {
+		content  string
+		expected string
+	}{
+		{"package main\n\nfunc main() {}", "go"},
+		{"import (\n\t\"fmt\"\n)", "go"},
+		{"def main():\n    pass", "python"},
+		{"from typing import List", "python"},
+		{"fn main() {\n    println!(\"hi\");\n}", "rust"},
+		{"interface User {\n  name: string\n}", "typescript"},
+		{"const x = require('fs')", "javascript"},
+		{"#!/bin/bash\necho hi", "bash"},
+		{"$ npm install", "bash"},
+		{"[1, 2, 3]", "json"},
+		{"just some words", ""},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.expected, inferLanguage(c.content), c.content)
+	}
+}
+
+func TestGetMessageCodeBlocks(t *testing.T) {
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(os.Stdout, nil)))
+	srv := NewServer(ctx, mf.AgentTypeClaude, nil, 0, "/chat")
+	srv.conversation.AddSnapshot("Try this:\n\n```go\nfmt.Println(1)\n```")
+
+	resp, err := srv.getMessageCodeBlocks(ctx, &CodeBlocksRequest{Seq: 0})
+	require.NoError(t, err)
+	assert.Equal(t, []CodeBlock{
+		{Language: "go", Content: "fmt.Println(1)", StartLine: 4, EndLine: 4},
+	}, resp.Body)
+
+	_, err = srv.getMessageCodeBlocks(ctx, &CodeBlocksRequest{Seq: 1})
+	assert.Error(t, err)
+}
@@ -0,0 +1,36 @@
+package httpapi
+
+import (
+	"context"
+	"runtime"
+)
+
+// DebugMemoryResponse is the memory used by the server.
+type DebugMemoryResponse struct {
+	Body struct {
+		Snapshots struct {
+			Count             int `json:"count" doc:"Number of snapshots of the agent's screen kept to check whether it's stable"`
+			Compressed        int `json:"compressed" doc:"Number of these snapshots that are compressed, all but the most recent ones"`
+			UncompressedBytes int `json:"uncompressed_bytes" doc:"Size of the snapshots' screens"`
+			StoredBytes       int `json:"stored_bytes" doc:"Size of the snapshots as they're stored, with the compressed ones compressed"`
+		} `json:"snapshots" doc:"Memory used by the snapshot history"`
+		HeapAllocBytes uint64 `json:"heap_alloc_bytes" doc:"Bytes of allocated heap objects, as reported by the Go runtime"`
+	}
+}
+
+// getDebugMemory handles GET /debug/memory
+func (s *Server) getDebugMemory(ctx context.Context, input *struct{}) (*DebugMemoryResponse, error) {
+	s.mu.RLock()
+	memory := s.conversation.SnapshotMemory()
+	s.mu.RUnlock()
+
+	resp := &DebugMemoryResponse{}
+	resp.Body.Snapshots.Count = memory.Snapshots
+	resp.Body.Snapshots.Compressed = memory.Compressed
+	resp.Body.Snapshots.UncompressedBytes = memory.UncompressedBytes
+	resp.Body.Snapshots.StoredBytes = memory.StoredBytes
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	resp.Body.HeapAllocBytes = stats.HeapAlloc
+	return resp, nil
+}
@@ -0,0 +1,42 @@
+package httpapi
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	st "github.com/zohaibahmed/clauder/lib/screentracker"
+)
+
+func TestDebugMemory(t *testing.T) {
+	ctx, cancel := context.WithCancel(logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil))))
+	defer cancel()
+	srv, httpSrv := newRoutingTestServer(t, ctx, &echoAgent{})
+	// a history of 100 snapshots, the last 10 of which are uncompressed
+	srv.conversation = st.NewConversation(ctx, st.ConversationConfig{
+		AgentIO:                      &echoAgent{},
+		GetTime:                      time.Now,
+		SnapshotInterval:             10 * time.Millisecond,
+		ScreenStabilityLength:        990 * time.Millisecond,
+		SnapshotCompressionThreshold: 10,
+	})
+	screen := strings.Repeat(strings.Repeat(" ", 200)+"\n", 50)
+	for range 100 {
+		srv.conversation.AddSnapshot(screen)
+	}
+
+	var memory DebugMemoryResponse
+	require.Equal(t, http.StatusOK, doJSON(t, http.MethodGet, httpSrv.URL+"/v1/debug/memory", "", &memory.Body))
+	assert.Equal(t, 100, memory.Body.Snapshots.Count)
+	assert.Equal(t, 90, memory.Body.Snapshots.Compressed)
+	assert.Equal(t, 100*len(screen), memory.Body.Snapshots.UncompressedBytes)
+	assert.Less(t, memory.Body.Snapshots.StoredBytes, 11*len(screen))
+	assert.Positive(t, memory.Body.HeapAllocBytes)
+}
@@ -0,0 +1,56 @@
+package httpapi
+
+import (
+	"hash/crc32"
+	"time"
+)
+
+// DefaultSSEDeduplicationTTL is how long a line event is suppressed when it
+// repeats the previous one, unless SetSSEDeduplicationTTL was called.
+const DefaultSSEDeduplicationTTL = 2 * time.Second
+
+var sseDeduplicatedEvents = newCounterVec(
+	"sse_deduplicated_events_total",
+	"Number of line events dropped because they repeated the previous line.",
+)
+
+// Deduplicator suppresses payloads that repeat the previous one, e.g. the
+// frames of a spinner that redraws the same line, by comparing their CRC-32.
+// A repeated payload is sent again once the TTL passed since it was last
+// sent, so that a line that's printed periodically, like a progress
+// percentage that didn't change, still shows up. It isn't safe for
+// concurrent use.
+type Deduplicator struct {
+	ttl     time.Duration
+	getTime func() time.Time
+
+	hash uint32
+	sent time.Time
+}
+
+// NewDeduplicator returns a deduplicator that suppresses repeated payloads
+// for ttl, which must be positive.
+func NewDeduplicator(ttl time.Duration) *Deduplicator {
+	return &Deduplicator{ttl: ttl, getTime: time.Now}
+}
+
+// Duplicate reports whether payload should be suppressed, because it's the
+// same as the previous one, which was sent less than the TTL ago.
+func (d *Deduplicator) Duplicate(payload []byte) bool {
+	hash := crc32.ChecksumIEEE(payload)
+	now := d.getTime()
+	if !d.sent.IsZero() && hash == d.hash && now.Sub(d.sent) < d.ttl {
+		return true
+	}
+	d.hash = hash
+	d.sent = now
+	return false
+}
+
+// SetSSEDeduplicationTTL suppresses the line events that repeat the
+// previous line for ttl, DefaultSSEDeduplicationTTL by default. The
+// suppressed lines aren't sent to any subscriber of GET /events. 0 sends
+// every line.
+func (s *Server) SetSSEDeduplicationTTL(ttl time.Duration) {
+	s.emitter.setLineDeduplicator(ttl)
+}
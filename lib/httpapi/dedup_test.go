@@ -0,0 +1,77 @@
+package httpapi
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+)
+
+func TestDeduplicator(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	d := NewDeduplicator(2 * time.Second)
+	d.getTime = func() time.Time { return now }
+
+	assert.False(t, d.Duplicate([]byte("⠋ Thinking")))
+	assert.True(t, d.Duplicate([]byte("⠋ Thinking")))
+	now = now.Add(time.Second)
+	assert.True(t, d.Duplicate([]byte("⠋ Thinking")))
+	assert.False(t, d.Duplicate([]byte("⠙ Thinking")))
+	assert.False(t, d.Duplicate([]byte("⠋ Thinking")), "only the previous payload is suppressed")
+
+	// a repeated payload is sent again once the TTL passed since it was
+	// last sent
+	now = now.Add(1500 * time.Millisecond)
+	assert.True(t, d.Duplicate([]byte("⠋ Thinking")))
+	now = now.Add(500 * time.Millisecond)
+	assert.False(t, d.Duplicate([]byte("⠋ Thinking")))
+	assert.True(t, d.Duplicate([]byte("⠋ Thinking")))
+
+	assert.False(t, NewDeduplicator(time.Second).Duplicate(nil), "the first payload is never a duplicate")
+}
+
+func TestSSELineDeduplication(t *testing.T) {
+	ctx, cancel := context.WithCancel(logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil))))
+	defer cancel()
+	srv, httpSrv := newRoutingTestServer(t, ctx, &echoAgent{})
+	lines := make(chan string)
+	srv.StartLineLoop(ctx, lines)
+
+	resp, err := http.Get(httpSrv.URL + "/v1/events?mode=lines")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+	name, _ := nextEvent(t, reader)
+	require.Equal(t, "subscribed", name)
+
+	before := sseDeduplicatedEvents.Value()
+	for range 5 {
+		lines <- "Downloading 42%"
+	}
+	lines <- "Downloading 43%"
+	lines <- "Downloading 43%"
+	lines <- "done"
+	for _, want := range []string{`{"text":"Downloading 42%"}`, `{"text":"Downloading 43%"}`, `{"text":"done"}`} {
+		name, data := nextEvent(t, reader)
+		require.Equal(t, "line", name)
+		assert.JSONEq(t, want, data)
+	}
+	assert.Equal(t, uint64(5), sseDeduplicatedEvents.Value()-before)
+
+	// without deduplication, every line is sent
+	srv.SetSSEDeduplicationTTL(0)
+	lines <- "done"
+	lines <- "done"
+	for range 2 {
+		name, data := nextEvent(t, reader)
+		require.Equal(t, "line", name)
+		assert.JSONEq(t, `{"text":"done"}`, data)
+	}
+}
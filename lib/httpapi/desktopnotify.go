@@ -0,0 +1,23 @@
+package httpapi
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/zohaibahmed/clauder/lib/notify"
+)
+
+// EnableDesktopNotifications shows a desktop notification with notifier
+// when the agent finishes responding to a message.
+func (s *Server) EnableDesktopNotifications(ctx context.Context, notifier notify.Notifier) {
+	go s.watchTaskCompletions(ctx, func(elapsed time.Duration) {
+		body := fmt.Sprintf("The %s agent finished responding after %s.", s.agentType, elapsed.Round(time.Second))
+		// the notification commands can be slow to start
+		go func() {
+			if err := notifier.Notify("Agent finished its task", body); err != nil {
+				s.logger.Error("Failed to show desktop notification", "error", err)
+			}
+		}()
+	})
+}
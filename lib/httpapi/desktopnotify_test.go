@@ -0,0 +1,59 @@
+package httpapi
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/events"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	mf "github.com/zohaibahmed/clauder/lib/msgfmt"
+	st "github.com/zohaibahmed/clauder/lib/screentracker"
+)
+
+type fakeNotifier struct {
+	mu            sync.Mutex
+	notifications [][2]string
+}
+
+func (n *fakeNotifier) Notify(title, body string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.notifications = append(n.notifications, [2]string{title, body})
+	return nil
+}
+
+func (n *fakeNotifier) Notifications() [][2]string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([][2]string(nil), n.notifications...)
+}
+
+func TestServerDesktopNotifications(t *testing.T) {
+	ctx, cancel := context.WithCancel(logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil))))
+	defer cancel()
+	srv := NewServer(ctx, mf.AgentTypeClaude, nil, 0, "/chat")
+	notifier := &fakeNotifier{}
+	srv.EnableDesktopNotifications(ctx, notifier)
+
+	// the agent starting up isn't a task
+	srv.emitter.UpdateStatusAndEmitChanges(st.ConversationStatusStable)
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, notifier.Notifications())
+
+	// wait for the watcher to subscribe to the bus
+	require.Eventually(t, func() bool {
+		srv.bus.Publish(events.TopicMessageSent, st.ConversationMessage{Role: st.ConversationRoleUser, Message: "hi"})
+		srv.emitter.UpdateStatusAndEmitChanges(st.ConversationStatusChanging)
+		srv.emitter.UpdateStatusAndEmitChanges(st.ConversationStatusStable)
+		return len(notifier.Notifications()) > 0
+	}, 5*time.Second, 50*time.Millisecond)
+	notification := notifier.Notifications()[0]
+	assert.Equal(t, "Agent finished its task", notification[0])
+	assert.Contains(t, notification[1], "The claude agent finished responding after")
+}
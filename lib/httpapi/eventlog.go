@@ -0,0 +1,263 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/zohaibahmed/clauder/lib/events"
+	st "github.com/zohaibahmed/clauder/lib/screentracker"
+	"golang.org/x/xerrors"
+)
+
+// eventLogPageSize is the number of events read at once to restore a
+// workspace.
+const eventLogPageSize = 1000
+
+// eventLogStatusInterval is how often the event log checks whether the
+// agent started responding on its own, e.g. after raw keystrokes.
+const eventLogStatusInterval = 500 * time.Millisecond
+
+type GetEventLogRequest struct {
+	Authorization string `header:"Authorization" doc:"Bearer token with the admin token"`
+	ID            string `path:"id" doc:"ID of the workspace"`
+	After         int64  `query:"after" minimum:"0" default:"0" doc:"Only return the events after this sequence number"`
+	Limit         int    `query:"limit" minimum:"1" maximum:"1000" default:"100" doc:"Maximum number of events"`
+}
+
+type EventLogResponse struct {
+	Body struct {
+		Events []StoredEvent `json:"events" nullable:"false" doc:"Events of the workspace's event log, in order"`
+	}
+}
+
+type RestoreWorkspaceRequest struct {
+	Authorization string `header:"Authorization" doc:"Bearer token with the admin token"`
+	ID            string `path:"id" doc:"ID of the workspace"`
+	ToSeq         int64  `query:"to_seq" required:"true" minimum:"1" doc:"Sequence number of the last event of the workspace's event log to restore"`
+	Body          BranchBody
+}
+
+// EnableEventLog appends the events of the server's agent, and of the
+// workspaces created after it's called, to store, so that GET
+// /admin/workspaces/{id}/events returns them and a workspace can be
+// restored to any point of its history. The messages are appended once
+// they're complete, and the agent's screen whenever it finishes
+// responding. A workspace's log is cleared when its agent starts, since
+// its messages are numbered from scratch. The snapshot loop only runs for
+// the log while the agent responds.
+func (s *Server) EnableEventLog(ctx context.Context, store *EventStore) {
+	s.eventStore.Store(store)
+	s.recordEvents(ctx, store, DefaultWorkspaceID)
+}
+
+// recordEvents clears the log of workspace and appends the server's events
+// to it in the background, until ctx is done.
+func (s *Server) recordEvents(ctx context.Context, store *EventStore, workspace string) {
+	if err := store.Clear(ctx, workspace); err != nil {
+		s.logger.Error("Failed to clear the event log", "workspace", workspace, "error", err)
+	}
+	sent := s.bus.Subscribe(events.TopicMessageSent)
+	subscriberId, ch, stateEvents := s.emitter.Subscribe()
+	go func() {
+		defer s.bus.Unsubscribe(events.TopicMessageSent, sent)
+		defer s.emitter.Unsubscribe(subscriberId)
+		s.appendEvents(ctx, store, workspace, ch, stateEvents, sent)
+	}()
+}
+
+// appendEvents appends the events received on ch to the log of workspace
+// until ctx is done. It keeps the snapshot loop running from when a
+// message is sent, or the agent starts responding on its own, until the
+// loop reported that the agent is stable again.
+func (s *Server) appendEvents(ctx context.Context, store *EventStore, workspace string, ch <-chan Event, stateEvents []Event, sent <-chan any) {
+	status := AgentStatusRunning
+	for _, event := range stateEvents {
+		if body, ok := event.Payload.(StatusChangeBody); ok {
+			status = body.Status
+		}
+	}
+	var releaseDemand func()
+	var heldSince time.Time
+	holdDemand := func() {
+		heldSince = time.Now()
+		if releaseDemand == nil {
+			releaseDemand = s.snapshotDemand.acquire()
+		}
+	}
+	dropDemand := func() {
+		if releaseDemand != nil {
+			releaseDemand()
+			releaseDemand = nil
+		}
+	}
+	defer dropDemand()
+	// the agent's initial status is logged
+	holdDemand()
+	ticker := time.NewTicker(eventLogStatusInterval)
+	defer ticker.Stop()
+
+	appendEvent := func(eventType EventType, at time.Time, payload any) {
+		if _, err := store.Append(ctx, workspace, eventType, at, payload); err != nil && ctx.Err() == nil {
+			s.logger.Error("Failed to append to the event log", "workspace", workspace, "type", eventType, "error", err)
+		}
+	}
+	// the agent's message is updated while it responds, so it's only
+	// appended once it's complete: when the agent is done or another
+	// message starts
+	var pending *MessageUpdateBody
+	recorded := map[int]string{}
+	appendMessage := func(message MessageUpdateBody) {
+		if content, ok := recorded[message.Id]; ok && content == message.Message {
+			return
+		}
+		recorded[message.Id] = message.Message
+		appendEvent(EventTypeMessageUpdate, message.Time, message)
+	}
+	flushPending := func() {
+		if pending != nil {
+			appendMessage(*pending)
+			pending = nil
+		}
+	}
+	var screen *ScreenUpdateBody
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sent:
+			holdDemand()
+		case <-ticker.C:
+			switch {
+			case s.agentStatus() == AgentStatusRunning:
+				holdDemand()
+			case status == AgentStatusStable && s.emitter.LastUpdate().After(heldSince):
+				// the loop ran since, so the agent's response, if it was
+				// quick enough to not change the status, was reported
+				dropDemand()
+			}
+		case event, ok := <-ch:
+			if !ok {
+				s.logger.Error("Event log fell behind on events", "workspace", workspace)
+				return
+			}
+			switch body := event.Payload.(type) {
+			case MessageUpdateBody:
+				if pending != nil && pending.Id != body.Id {
+					flushPending()
+				}
+				if body.Role == st.ConversationRoleUser {
+					appendMessage(body)
+				} else {
+					pending = &body
+				}
+			case StatusChangeBody:
+				flushPending()
+				status = body.Status
+				appendEvent(EventTypeStatusChange, time.Now(), body)
+				if body.Status == AgentStatusStable && screen != nil {
+					appendEvent(EventTypeScreenUpdate, time.Now(), *screen)
+				}
+			case ScreenUpdateBody:
+				screen = &body
+			}
+		}
+	}
+}
+
+// loadEventLog returns the workspace and event store after checking the
+// admin token.
+func (s *Server) loadEventLog(authorization string) (*workspaceStore, *EventStore, error) {
+	store, err := s.loadWorkspaces(authorization)
+	if err != nil {
+		return nil, nil, err
+	}
+	events := s.eventStore.Load()
+	if events == nil {
+		return nil, nil, huma.Error503ServiceUnavailable("the event log is not enabled")
+	}
+	return store, events, nil
+}
+
+// getEventLog handles GET /admin/workspaces/{id}/events
+func (s *Server) getEventLog(ctx context.Context, input *GetEventLogRequest) (*EventLogResponse, error) {
+	store, events, err := s.loadEventLog(input.Authorization)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := s.lookupWorkspace(store, input.ID); err != nil {
+		return nil, err
+	}
+	resp := &EventLogResponse{}
+	if resp.Body.Events, err = events.Events(ctx, input.ID, input.After, input.Limit); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// restoredMessages returns the messages of a conversation after the
+// events, sorted by ID.
+func restoredMessages(events []StoredEvent) ([]MessageUpdateBody, error) {
+	byId := map[int]MessageUpdateBody{}
+	for _, event := range events {
+		if event.Type != EventTypeMessageUpdate {
+			continue
+		}
+		var message MessageUpdateBody
+		if err := json.Unmarshal(event.Payload, &message); err != nil {
+			return nil, xerrors.Errorf("failed to decode event %d: %w", event.Seq, err)
+		}
+		byId[message.Id] = message
+	}
+	messages := make([]MessageUpdateBody, 0, len(byId))
+	for _, message := range byId {
+		messages = append(messages, message)
+	}
+	slices.SortFunc(messages, func(a, b MessageUpdateBody) int { return a.Id - b.Id })
+	return messages, nil
+}
+
+// restoreWorkspace handles POST /admin/workspaces/{id}/restore
+func (s *Server) restoreWorkspace(ctx context.Context, input *RestoreWorkspaceRequest) (*WorkspaceResponse, error) {
+	store, events, err := s.loadEventLog(input.Authorization)
+	if err != nil {
+		return nil, err
+	}
+	parent, _, err := s.lookupWorkspace(store, input.ID)
+	if err != nil {
+		return nil, err
+	}
+	var restored []StoredEvent
+	for after := int64(0); after < input.ToSeq; {
+		page, err := events.Events(ctx, input.ID, after, int(min(eventLogPageSize, input.ToSeq-after)))
+		if err != nil {
+			return nil, err
+		}
+		if len(page) == 0 {
+			break
+		}
+		restored = append(restored, page...)
+		after = page[len(page)-1].Seq
+	}
+	if len(restored) == 0 || restored[len(restored)-1].Seq != input.ToSeq {
+		return nil, huma.Error400BadRequest(fmt.Sprintf("the event log of workspace %s has no event %d", input.ID, input.ToSeq))
+	}
+	messages, err := restoredMessages(restored)
+	if err != nil {
+		return nil, err
+	}
+	var userMessages []string
+	for _, message := range messages {
+		if message.Role == st.ConversationRoleUser {
+			userMessages = append(userMessages, message.Message)
+		}
+	}
+	created, err := s.startBranch(store, parent, input.Body, userMessages)
+	if err != nil {
+		return nil, err
+	}
+	return &WorkspaceResponse{Body: created.withMaskedEnv()}, nil
+}
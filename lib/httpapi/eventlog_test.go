@@ -0,0 +1,177 @@
+package httpapi
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	mf "github.com/zohaibahmed/clauder/lib/msgfmt"
+	st "github.com/zohaibahmed/clauder/lib/screentracker"
+)
+
+func TestEventStore(t *testing.T) {
+	ctx := context.Background()
+	store, err := OpenEventStore(filepath.Join(t.TempDir(), "events.db"))
+	if !eventStoreSupported {
+		require.ErrorIs(t, err, ErrEventStoreUnsupported)
+		return
+	}
+	require.NoError(t, err)
+	defer store.Close()
+
+	at := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := range 5 {
+		seq, err := store.Append(ctx, "a", EventTypeStatusChange, at, StatusChangeBody{Status: AgentStatusStable})
+		require.NoError(t, err)
+		assert.Equal(t, int64(i+1), seq)
+	}
+	seq, err := store.Append(ctx, "b", EventTypeMessageUpdate, at, MessageUpdateBody{Id: 1, Message: "hello"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), seq, "every workspace's log is numbered separately")
+
+	events, err := store.Events(ctx, "a", 1, 2)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, int64(2), events[0].Seq)
+	assert.Equal(t, int64(3), events[1].Seq)
+	assert.Equal(t, EventTypeStatusChange, events[0].Type)
+	assert.Equal(t, at, events[0].Time)
+	assert.JSONEq(t, `{"status":"stable"}`, string(events[0].Payload))
+
+	events, err = store.Events(ctx, "a", 5, 100)
+	require.NoError(t, err)
+	assert.Empty(t, events)
+
+	require.NoError(t, store.Clear(ctx, "a"))
+	events, err = store.Events(ctx, "a", 0, 100)
+	require.NoError(t, err)
+	assert.Empty(t, events)
+	events, err = store.Events(ctx, "b", 0, 100)
+	require.NoError(t, err)
+	assert.Len(t, events, 1)
+	seq, err = store.Append(ctx, "a", EventTypeStatusChange, at, StatusChangeBody{Status: AgentStatusRunning})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), seq)
+}
+
+func TestRestoreWorkspace(t *testing.T) {
+	if !eventStoreSupported {
+		t.Skip("the event store needs cgo")
+	}
+	ctx, cancel := context.WithCancel(logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil))))
+	defer cancel()
+	srv := NewServer(ctx, mf.AgentTypeClaude, nil, 0, "/chat")
+	httpSrv := httptest.NewServer(srv.handler())
+	defer httpSrv.Close()
+	srv.EnableAdminShutdown("admin", nil)
+	srv.EnableWorkspaces(ctx, nil)
+	admin := httpSrv.URL + "/v1/admin/workspaces"
+	assert.Equal(t, http.StatusServiceUnavailable, doWorkspaceRequest(t, http.MethodGet, admin+"/default/events", "admin", "", nil).StatusCode)
+
+	store, err := OpenEventStore(filepath.Join(t.TempDir(), "events.db"))
+	require.NoError(t, err)
+	defer store.Close()
+	srv.EnableEventLog(ctx, store)
+	srv.workspaces.Load().startServer = func(ctx context.Context, workspace Workspace, basePath string) (*Server, error) {
+		wsSrv := NewServerWithAuth(ctx, workspace.AgentConfig.Type, nil, 0, basePath+"/chat", workspace.Token)
+		require.NoError(t, wsSrv.SetBasePath(basePath))
+		wsSrv.snapshotPollBase = 10 * time.Millisecond
+		wsSrv.conversation = st.NewConversation(ctx, st.ConversationConfig{
+			AgentIO:               &echoAgent{},
+			GetTime:               time.Now,
+			SnapshotInterval:      time.Millisecond,
+			ScreenStabilityLength: 20 * time.Millisecond,
+		})
+		wsSrv.StartSnapshotLoop(ctx)
+		return wsSrv, nil
+	}
+	get := func(id string) *workspace {
+		ws, ok := srv.workspaces.Load().get(id)
+		require.True(t, ok)
+		return ws
+	}
+	readLog := func(id string) []StoredEvent {
+		var events EventLogResponse
+		require.Equal(t, http.StatusOK, doWorkspaceRequest(t, http.MethodGet, admin+"/"+id+"/events?limit=1000", "admin", "", &events.Body).StatusCode)
+		return events.Body.Events
+	}
+	loggedUserMessages := func(events []StoredEvent) []string {
+		messages, err := restoredMessages(events)
+		require.NoError(t, err)
+		contents := []string{}
+		for _, message := range messages {
+			if message.Role == st.ConversationRoleUser {
+				contents = append(contents, message.Message)
+			}
+		}
+		return contents
+	}
+
+	require.Equal(t, http.StatusCreated, doWorkspaceRequest(t, http.MethodPost, admin, "admin", `{"id":"a","name":"Team A","token":"token-a-0123456789","agent_config":{"program":"agent-a"}}`, nil).StatusCode)
+	sent := []string{"fix the parser", "now add tests", "rename the package", "update the docs"}
+	for _, content := range sent {
+		require.Eventually(t, func() bool {
+			return get("a").server.conversation.Status() == st.ConversationStatusStable
+		}, 5*time.Second, 10*time.Millisecond)
+		resp := doWorkspaceRequest(t, http.MethodPost, httpSrv.URL+"/workspaces/a/v1/message", "token-a-0123456789", `{"type":"user","content":"`+content+`"}`, nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+	var events []StoredEvent
+	require.Eventually(t, func() bool {
+		events = readLog("a")
+		return len(loggedUserMessages(events)) == len(sent)
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, sent, loggedUserMessages(events))
+	for i, event := range events {
+		assert.Equal(t, int64(i+1), event.Seq)
+	}
+	// the snapshot loop pauses once the agent finished responding
+	require.Eventually(t, func() bool {
+		return get("a").server.snapshotDemand.count() == 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the events are paginated
+	var page EventLogResponse
+	require.Equal(t, http.StatusOK, doWorkspaceRequest(t, http.MethodGet, admin+"/a/events?after=2&limit=3", "admin", "", &page.Body).StatusCode)
+	assert.Equal(t, events[2:5], page.Body.Events)
+
+	// restore to the last event before the third message
+	midpoint := 0
+	for i := range events {
+		if len(loggedUserMessages(events[:i+1])) == 3 {
+			midpoint = i
+			break
+		}
+	}
+	expected := loggedUserMessages(events[:midpoint])
+	require.Equal(t, sent[:2], expected)
+	toSeq := strconv.FormatInt(events[midpoint-1].Seq, 10)
+	var restored Workspace
+	require.Equal(t, http.StatusCreated, doWorkspaceRequest(t, http.MethodPost, admin+"/a/restore?to_seq="+toSeq, "admin", `{"id":"a-restored","replay_delay_ms":10}`, &restored).StatusCode)
+	assert.Equal(t, "a", restored.Parent)
+	require.Eventually(t, func() bool {
+		return len(userMessages(get("a-restored").server)) == len(expected)
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, expected, userMessages(get("a-restored").server))
+	assert.Equal(t, sent, userMessages(get("a").server), "the workspace itself is unchanged")
+
+	// the restored workspace has its own log
+	require.Eventually(t, func() bool {
+		return len(loggedUserMessages(readLog("a-restored"))) == len(expected)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	beyond := strconv.FormatInt(events[len(events)-1].Seq+100, 10)
+	assert.Equal(t, http.StatusBadRequest, doWorkspaceRequest(t, http.MethodPost, admin+"/a/restore?to_seq="+beyond, "admin", `{}`, nil).StatusCode)
+	assert.Equal(t, http.StatusNotFound, doWorkspaceRequest(t, http.MethodPost, admin+"/c/restore?to_seq=1", "admin", `{}`, nil).StatusCode)
+	assert.Equal(t, http.StatusNotFound, doWorkspaceRequest(t, http.MethodGet, admin+"/c/events", "admin", "", nil).StatusCode)
+	assert.Equal(t, http.StatusUnauthorized, doWorkspaceRequest(t, http.MethodGet, admin+"/a/events", "wrong", "", nil).StatusCode)
+}
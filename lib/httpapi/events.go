@@ -1,12 +1,15 @@
 package httpapi
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/danielgtaylor/huma/v2"
+	"github.com/zohaibahmed/clauder/lib/events"
 	mf "github.com/zohaibahmed/clauder/lib/msgfmt"
 	st "github.com/zohaibahmed/clauder/lib/screentracker"
 	"github.com/zohaibahmed/clauder/lib/util"
@@ -15,9 +18,23 @@ import (
 type EventType string
 
 const (
-	EventTypeMessageUpdate EventType = "message_update"
-	EventTypeStatusChange  EventType = "status_change"
-	EventTypeScreenUpdate  EventType = "screen_update"
+	EventTypeMessageUpdate         EventType = "message_update"
+	EventTypeStatusChange          EventType = "status_change"
+	EventTypeScreenUpdate          EventType = "screen_update"
+	EventTypeToolUse               EventType = "tool_use"
+	EventTypeWatchdogAlert         EventType = "watchdog_alert"
+	EventTypeContextTrimmed        EventType = "context_trimmed"
+	EventTypeNetworkQuality        EventType = "network_quality"
+	EventTypeTermDiff              EventType = "term_diff"
+	EventTypeAgentOutput           EventType = "agent_output"
+	EventTypeTunnelFailover        EventType = "tunnel_failover"
+	EventTypeLine                  EventType = "line"
+	EventTypePTYResized            EventType = "pty_resized"
+	EventTypeCoordinatorRegistered EventType = "coordinator_registered"
+	EventTypeQualityDegraded       EventType = "quality_degraded"
+	EventTypeReplayProgress        EventType = "replay_progress"
+	EventTypeReplayComplete        EventType = "replay_complete"
+	EventTypeMessageFailed         EventType = "message_failed"
 )
 
 type AgentStatus string
@@ -25,11 +42,15 @@ type AgentStatus string
 const (
 	AgentStatusRunning AgentStatus = "running"
 	AgentStatusStable  AgentStatus = "stable"
+	// AgentStatusNotStarted is the status of an agent that's started by
+	// the first message it's sent, until then.
+	AgentStatusNotStarted AgentStatus = "not_started"
 )
 
 var AgentStatusValues = []AgentStatus{
 	AgentStatusStable,
 	AgentStatusRunning,
+	AgentStatusNotStarted,
 }
 
 func (a AgentStatus) Schema(r huma.Registry) *huma.Schema {
@@ -51,6 +72,76 @@ type ScreenUpdateBody struct {
 	Screen string `json:"screen"`
 }
 
+// TermDiffBody holds the changes to the agent's terminal screen since the
+// previous term_diff event.
+type TermDiffBody struct {
+	Ops []st.DiffOp `json:"ops" nullable:"false" doc:"Line changes to apply to the screen in order. Applying them to the screen built from the previous term_diff events gives the current screen."`
+}
+
+// LineBody is a line the agent printed, sent as soon as it's complete.
+type LineBody struct {
+	Text string `json:"text" doc:"Text of the line, without its newline and ANSI escape sequences"`
+}
+
+type ToolUseBody struct {
+	EventType  string `json:"event_type" doc:"Type of the structured event emitted by the agent, e.g. 'assistant', 'user', 'system' or 'result'"`
+	SubType    string `json:"sub_type,omitempty" doc:"Subtype of the event, e.g. 'init' or 'success'"`
+	Text       string `json:"text,omitempty" doc:"Text content of the event"`
+	ToolName   string `json:"tool_name,omitempty" doc:"Name of the tool invoked by the agent"`
+	ToolInput  string `json:"tool_input,omitempty" doc:"Raw JSON input of the tool invocation"`
+	ToolOutput string `json:"tool_output,omitempty" doc:"Output returned by the tool"`
+}
+
+// AgentOutputBody is a JSON object the agent printed to its standard
+// output.
+type AgentOutputBody struct {
+	Type   string         `json:"type,omitempty" doc:"The object's 'type' field, if it has one"`
+	Object map[string]any `json:"object" doc:"The JSON object, as the agent printed it"`
+}
+
+type WatchdogAlertBody struct {
+	Failures []WatchdogCheck `json:"failures" nullable:"false" doc:"Checks that failed"`
+	Time     time.Time       `json:"time" doc:"Time of the failed check"`
+}
+
+type ContextTrimmedBody struct {
+	Type             string `json:"type" enum:"context_trimmed" doc:"Always 'context_trimmed'"`
+	RemovedMessages  int    `json:"removed_messages" doc:"Number of the oldest messages removed from the conversation history"`
+	CurrentTokensEst int    `json:"current_tokens_est" doc:"Estimated number of tokens in the remaining conversation, including the message being sent"`
+	Annotation       string `json:"annotation" example:"[Context trimmed: 3 messages removed]" doc:"Note for clients to show in place of the removed messages. Only the server's conversation history is trimmed: the agent isn't sent the note, and keeps its own context, which it manages itself."`
+}
+
+// TunnelFailoverBody is sent when the server's tunnel failed and a standby
+// tunnel with another URL took over.
+type TunnelFailoverBody struct {
+	Type   string `json:"type" enum:"tunnel_failover" doc:"Always 'tunnel_failover'"`
+	NewURL string `json:"new_url" doc:"Public URL the server is reachable at now"`
+	OldURL string `json:"old_url" doc:"Public URL of the tunnel that failed"`
+}
+
+// CoordinatorRegisteredBody is sent when the session was registered with
+// the coordinator after the first attempt failed, so that it can now be
+// found with its passcode.
+type CoordinatorRegisteredBody struct {
+	Type     string `json:"type" enum:"coordinator_registered" doc:"Always 'coordinator_registered'"`
+	Passcode string `json:"passcode" doc:"Passcode the session can be looked up with"`
+}
+
+// PTYResizedBody is sent when the agent's terminal was resized to fit its
+// output better.
+type PTYResizedBody struct {
+	Type   string `json:"type" enum:"pty_resized" doc:"Always 'pty_resized'"`
+	Width  int    `json:"width" doc:"Number of columns of the terminal"`
+	Height int    `json:"height" doc:"Number of rows of the terminal"`
+}
+
+type ServerShutdownBody struct {
+	Type   string `json:"type" enum:"server_shutdown" doc:"Always 'server_shutdown'"`
+	Reason string `json:"reason" enum:"graceful" doc:"Why the server is shutting down. The connection is closed right after this event."`
+}
+
+var serverShutdownEvent = ServerShutdownBody{Type: "server_shutdown", Reason: "graceful"}
+
 type Event struct {
 	Type    EventType
 	Payload any
@@ -64,6 +155,12 @@ type EventEmitter struct {
 	chanIdx             int
 	subscriptionBufSize int
 	screen              string
+	screenSeq           int
+	screenModified      time.Time
+	lastUpdate          time.Time
+	// lineDedup suppresses the line events that repeat the previous line,
+	// if set.
+	lineDedup *Deduplicator
 }
 
 func convertStatus(status st.ConversationStatus) AgentStatus {
@@ -118,11 +215,19 @@ func (e *EventEmitter) notifyChannels(eventType EventType, payload any) {
 	}
 }
 
-// Assumes that only the last message can change or new messages can be added.
-// If a new message is injected between existing messages (identified by Id), the behavior is undefined.
+// Assumes that only the last message can change, new messages can be added, or the
+// oldest messages can be trimmed. If a new message is injected between existing
+// messages (identified by Id), the behavior is undefined.
 func (e *EventEmitter) UpdateMessagesAndEmitChanges(newMessages []st.ConversationMessage) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
+	e.lastUpdate = time.Now()
+
+	// trimmed messages are dropped silently, subscribers are told about
+	// them with a context_trimmed event
+	for len(e.messages) > 0 && len(newMessages) > 0 && e.messages[0].Id < newMessages[0].Id {
+		e.messages = e.messages[1:]
+	}
 
 	maxLength := max(len(e.messages), len(newMessages))
 	for i := range maxLength {
@@ -147,11 +252,62 @@ func (e *EventEmitter) UpdateMessagesAndEmitChanges(newMessages []st.Conversatio
 	e.messages = newMessages
 }
 
+// AddMessageAndEmitChanges adds a message that was just sent to the agent, so
+// that subscribers learn about it before the next update with the whole
+// conversation. It's ignored if that update already happened.
+func (e *EventEmitter) AddMessageAndEmitChanges(msg st.ConversationMessage) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if len(e.messages) > 0 && e.messages[len(e.messages)-1].Id >= msg.Id {
+		return
+	}
+	e.notifyChannels(EventTypeMessageUpdate, MessageUpdateBody{
+		Id:      msg.Id,
+		Role:    msg.Role,
+		Message: msg.Message,
+		Time:    msg.Time,
+	})
+	e.messages = append(e.messages, msg)
+}
+
+// ConsumeBus updates the emitter with the screens and the sent messages
+// published on bus until ctx is done.
+func (e *EventEmitter) ConsumeBus(ctx context.Context, bus *events.EventBus) {
+	screens := bus.Subscribe(events.TopicPTYOutput)
+	sent := bus.Subscribe(events.TopicMessageSent)
+	go func() {
+		defer bus.Unsubscribe(events.TopicPTYOutput, screens)
+		defer bus.Unsubscribe(events.TopicMessageSent, sent)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case payload := <-screens:
+				if screen, ok := payload.(string); ok {
+					e.UpdateScreenAndEmitChanges(screen)
+				}
+			case payload := <-sent:
+				if msg, ok := payload.(st.ConversationMessage); ok {
+					e.AddMessageAndEmitChanges(msg)
+				}
+			}
+		}
+	}()
+}
+
 func (e *EventEmitter) UpdateStatusAndEmitChanges(newStatus st.ConversationStatus) {
+	e.UpdateAgentStatusAndEmitChanges(convertStatus(newStatus))
+}
+
+// UpdateAgentStatusAndEmitChanges is UpdateStatusAndEmitChanges for a
+// status that doesn't come from the conversation, like
+// AgentStatusNotStarted.
+func (e *EventEmitter) UpdateAgentStatusAndEmitChanges(newAgentStatus AgentStatus) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
+	e.lastUpdate = time.Now()
 
-	newAgentStatus := convertStatus(newStatus)
 	if e.status == newAgentStatus {
 		return
 	}
@@ -163,13 +319,212 @@ func (e *EventEmitter) UpdateStatusAndEmitChanges(newStatus st.ConversationStatu
 func (e *EventEmitter) UpdateScreenAndEmitChanges(newScreen string) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
+	e.lastUpdate = time.Now()
 
 	if e.screen == newScreen {
 		return
 	}
 
-	e.notifyChannels(EventTypeScreenUpdate, ScreenUpdateBody{Screen: strings.TrimRight(newScreen, mf.WhiteSpaceChars)})
+	oldTrimmed := strings.TrimRight(e.screen, mf.WhiteSpaceChars)
+	newTrimmed := strings.TrimRight(newScreen, mf.WhiteSpaceChars)
+	e.notifyChannels(EventTypeScreenUpdate, ScreenUpdateBody{Screen: newTrimmed})
+	// the diff is computed once here rather than for every subscriber
+	if diff := st.DiffScreens(oldTrimmed, newTrimmed); len(diff.Ops) > 0 {
+		e.notifyChannels(EventTypeTermDiff, TermDiffBody{Ops: diff.Ops})
+	}
 	e.screen = newScreen
+	e.screenSeq++
+	e.screenModified = e.lastUpdate
+}
+
+// Screen returns the current screen, its sequence number, which is
+// incremented every time the screen changes, and when it last changed.
+func (e *EventEmitter) Screen() (string, int, time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return strings.TrimRight(e.screen, mf.WhiteSpaceChars), e.screenSeq, e.screenModified
+}
+
+// EmitClaudeEvent forwards a structured agent event to all subscribers.
+// Unlike messages and status, these events are not part of the state
+// replayed to new subscribers.
+func (e *EventEmitter) EmitClaudeEvent(event st.ClaudeEvent) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.notifyChannels(EventTypeToolUse, ToolUseBody{
+		EventType:  event.EventType,
+		SubType:    event.SubType,
+		Text:       event.Text,
+		ToolName:   event.ToolName,
+		ToolInput:  event.ToolInput,
+		ToolOutput: event.ToolOutput,
+	})
+}
+
+// EmitAgentOutput forwards a JSON object the agent printed to its standard
+// output to all subscribers. Like structured agent events, they aren't
+// replayed to new subscribers.
+func (e *EventEmitter) EmitAgentOutput(event st.StdoutEvent) {
+	var object map[string]any
+	if err := json.Unmarshal(event.Object, &object); err != nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.notifyChannels(EventTypeAgentOutput, AgentOutputBody{Type: event.Type, Object: object})
+}
+
+// EmitWatchdogAlert notifies all subscribers that the watchdog detected
+// a stuck component.
+func (e *EventEmitter) EmitWatchdogAlert(status WatchdogStatus) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.notifyChannels(EventTypeWatchdogAlert, WatchdogAlertBody{
+		Failures: status.Failures,
+		Time:     status.LastCheck,
+	})
+}
+
+// EmitContextTrimmed notifies all subscribers that the oldest messages were
+// removed to keep the conversation within the agent's context window.
+func (e *EventEmitter) EmitContextTrimmed(removed int, tokens int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.notifyChannels(EventTypeContextTrimmed, ContextTrimmedBody{
+		Type:             "context_trimmed",
+		RemovedMessages:  removed,
+		CurrentTokensEst: tokens,
+		Annotation:       mf.ContextTrimmedAnnotation(removed),
+	})
+}
+
+// EmitTunnelFailover notifies all subscribers that the server moved from
+// the tunnel at oldURL to the one at newURL.
+func (e *EventEmitter) EmitTunnelFailover(oldURL, newURL string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.notifyChannels(EventTypeTunnelFailover, TunnelFailoverBody{
+		Type:   "tunnel_failover",
+		NewURL: newURL,
+		OldURL: oldURL,
+	})
+}
+
+// EmitCoordinatorRegistered notifies all subscribers that the session can
+// be looked up with passcode.
+func (e *EventEmitter) EmitCoordinatorRegistered(passcode string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.notifyChannels(EventTypeCoordinatorRegistered, CoordinatorRegisteredBody{
+		Type:     "coordinator_registered",
+		Passcode: passcode,
+	})
+}
+
+// EmitQualityDegraded notifies all subscribers that the conversation is
+// polled for events every interval now.
+func (e *EventEmitter) EmitQualityDegraded(interval time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.notifyChannels(EventTypeQualityDegraded, QualityDegradedBody{
+		Type:          "quality_degraded",
+		NewIntervalMs: interval.Milliseconds(),
+	})
+}
+
+// EmitReplayProgress notifies all subscribers that the agent finished
+// responding to sent of the total messages of a replayed conversation.
+func (e *EventEmitter) EmitReplayProgress(sent, total int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.notifyChannels(EventTypeReplayProgress, ReplayProgressBody{
+		Type:  "replay_progress",
+		Sent:  sent,
+		Total: total,
+	})
+}
+
+// EmitReplayComplete notifies all subscribers that a replay ended.
+func (e *EventEmitter) EmitReplayComplete(body ReplayCompleteBody) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.notifyChannels(EventTypeReplayComplete, body)
+}
+
+// EmitMessageFailed notifies all subscribers that a queued message couldn't
+// be sent to the agent.
+func (e *EventEmitter) EmitMessageFailed(body MessageFailedBody) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.notifyChannels(EventTypeMessageFailed, body)
+}
+
+// EmitPTYResized notifies all subscribers that the agent's terminal is now
+// width columns wide and height rows high.
+func (e *EventEmitter) EmitPTYResized(width, height int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.notifyChannels(EventTypePTYResized, PTYResizedBody{
+		Type:   "pty_resized",
+		Width:  width,
+		Height: height,
+	})
+}
+
+// setLineDeduplicator suppresses the line events that repeat the previous
+// line for ttl. 0 disables it.
+func (e *EventEmitter) setLineDeduplicator(ttl time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.lineDedup = nil
+	if ttl > 0 {
+		e.lineDedup = NewDeduplicator(ttl)
+	}
+}
+
+// EmitLine sends a line the agent printed to all subscribers, unless it
+// repeats the previous line and the deduplicator suppresses it. Lines
+// aren't replayed to new subscribers.
+func (e *EventEmitter) EmitLine(line string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.lineDedup != nil && e.lineDedup.Duplicate([]byte(line)) {
+		sseDeduplicatedEvents.Inc()
+		return
+	}
+	e.notifyChannels(EventTypeLine, LineBody{Text: line})
+}
+
+// LastMessageTime returns the timestamp of the last message in the
+// conversation, or the zero time if there are no messages yet.
+func (e *EventEmitter) LastMessageTime() time.Time {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.messages) == 0 {
+		return time.Time{}
+	}
+	return e.messages[len(e.messages)-1].Time
+}
+
+// LastUpdate returns the last time the emitter was updated with the
+// conversation state, whether or not that produced any events.
+func (e *EventEmitter) LastUpdate() time.Time {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.lastUpdate
 }
 
 // Assumes the caller holds the lock.
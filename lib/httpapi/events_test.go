@@ -1,11 +1,18 @@
 package httpapi
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"log/slog"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/zohaibahmed/clauder/lib/events"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	mf "github.com/zohaibahmed/clauder/lib/msgfmt"
 	st "github.com/zohaibahmed/clauder/lib/screentracker"
 )
 
@@ -98,3 +105,78 @@ func TestEventEmitter(t *testing.T) {
 		}
 	})
 }
+
+func TestEmitClaudeEvent(t *testing.T) {
+	emitter := NewEventEmitter(10)
+	_, ch, stateEvents := emitter.Subscribe()
+	for _, event := range stateEvents {
+		assert.NotEqual(t, EventTypeToolUse, event.Type)
+	}
+
+	emitter.EmitClaudeEvent(st.ClaudeEvent{EventType: "assistant", ToolName: "Bash", ToolInput: `{"command":"ls"}`})
+	assert.Equal(t, Event{
+		Type:    EventTypeToolUse,
+		Payload: ToolUseBody{EventType: "assistant", ToolName: "Bash", ToolInput: `{"command":"ls"}`},
+	}, <-ch)
+}
+
+func TestStartStdoutJSONLoop(t *testing.T) {
+	ctx, cancel := context.WithCancel(logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil))))
+	defer cancel()
+	srv := NewServer(ctx, mf.AgentTypeClaude, nil, 0, "/chat")
+	_, ch, _ := srv.emitter.Subscribe()
+
+	parser := st.NewStdoutJSONParser(strings.NewReader(`{"type":"result","result":"done"} {"tokens":12}`), 4)
+	go func() { _ = parser.Run() }()
+	srv.StartStdoutJSONLoop(ctx, parser.Events())
+
+	assert.Equal(t, Event{
+		Type:    EventTypeAgentOutput,
+		Payload: AgentOutputBody{Type: "result", Object: map[string]any{"type": "result", "result": "done"}},
+	}, <-ch)
+	assert.Equal(t, Event{Type: EventTypeToolUse, Payload: ToolUseBody{EventType: "result", Text: "done"}}, <-ch)
+	assert.Equal(t, Event{Type: EventTypeAgentOutput, Payload: AgentOutputBody{Object: map[string]any{"tokens": 12.0}}}, <-ch)
+}
+
+func TestEventEmitterConsumeBus(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bus := events.NewEventBus(10)
+	emitter := NewEventEmitter(10)
+	emitter.ConsumeBus(ctx, bus)
+	_, ch, _ := emitter.Subscribe()
+
+	bus.Publish(events.TopicPTYOutput, "$ clauder  \n")
+	assert.Equal(t, Event{Type: EventTypeScreenUpdate, Payload: ScreenUpdateBody{Screen: "$ clauder"}}, <-ch)
+	assert.Equal(t, Event{Type: EventTypeTermDiff, Payload: TermDiffBody{Ops: []st.DiffOp{{Op: st.DiffOpSet, Line: 0, Content: "$ clauder"}}}}, <-ch)
+
+	now := time.Now()
+	sent := st.ConversationMessage{Id: 1, Message: "hello", Role: st.ConversationRoleUser, Time: now}
+	bus.Publish(events.TopicMessageSent, sent)
+	assert.Equal(t, Event{
+		Type:    EventTypeMessageUpdate,
+		Payload: MessageUpdateBody{Id: 1, Role: st.ConversationRoleUser, Message: "hello", Time: now},
+	}, <-ch)
+
+	// the whole conversation doesn't repeat the message
+	emitter.UpdateMessagesAndEmitChanges([]st.ConversationMessage{sent})
+	// a message the emitter already knows about is ignored
+	bus.Publish(events.TopicMessageSent, sent)
+	bus.Publish(events.TopicPTYOutput, "$ clauder\n> hello")
+	assert.Equal(t, Event{Type: EventTypeScreenUpdate, Payload: ScreenUpdateBody{Screen: "$ clauder\n> hello"}}, <-ch)
+	assert.Equal(t, Event{Type: EventTypeTermDiff, Payload: TermDiffBody{Ops: []st.DiffOp{{Op: st.DiffOpSet, Line: 1, Content: "> hello"}}}}, <-ch)
+}
+
+func TestFailoverTunnel(t *testing.T) {
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	srv := NewServer(ctx, mf.AgentTypeClaude, nil, 0, "/chat")
+	srv.SetTunnelURL("https://old.example.com")
+	_, ch, _ := srv.emitter.Subscribe()
+
+	srv.FailoverTunnel("https://old.example.com", "https://new.example.com")
+	assert.Equal(t, Event{
+		Type:    EventTypeTunnelFailover,
+		Payload: TunnelFailoverBody{Type: "tunnel_failover", NewURL: "https://new.example.com", OldURL: "https://old.example.com"},
+	}, <-ch)
+	assert.Equal(t, "https://new.example.com", *srv.tunnelURL.Load())
+}
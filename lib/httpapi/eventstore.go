@@ -0,0 +1,128 @@
+package httpapi
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// ErrEventStoreUnsupported is returned by OpenEventStore when clauder was
+// built without cgo, which the SQLite driver needs, like the release
+// builds that are cross-compiled.
+var ErrEventStoreUnsupported = xerrors.New("the event log needs a clauder built with cgo")
+
+// StoredEvent is an event of a workspace's event log.
+type StoredEvent struct {
+	Seq     int64           `json:"seq" doc:"Position of the event in the workspace's event log, starting at 1"`
+	Type    EventType       `json:"type" enum:"message_update,status_change,screen_update" doc:"Type of the event: 'message_update' for a message, once it's complete, 'status_change' for a change of the agent's status, and 'screen_update' for a snapshot of the agent's screen, taken when it finishes responding"`
+	Time    time.Time       `json:"time" doc:"When the event happened"`
+	Payload json.RawMessage `json:"payload" doc:"Body of the event, as in the GET /events event of the same type"`
+}
+
+// EventStore keeps the event logs of workspaces in a SQLite database. Each
+// workspace's events are numbered in the order they're appended.
+type EventStore struct {
+	db *sql.DB
+}
+
+const createEventsTable = `
+CREATE TABLE IF NOT EXISTS events (
+	workspace TEXT NOT NULL,
+	seq       INTEGER NOT NULL,
+	type      TEXT NOT NULL,
+	time      INTEGER NOT NULL,
+	payload   TEXT NOT NULL,
+	PRIMARY KEY (workspace, seq)
+)`
+
+// OpenEventStore opens the SQLite database at path, creating it and the
+// events table if they don't exist.
+func OpenEventStore(path string) (*EventStore, error) {
+	if !eventStoreSupported {
+		return nil, ErrEventStoreUnsupported
+	}
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to open event store: %w", err)
+	}
+	// SQLite only supports a single writer, and appending an event reads
+	// the last sequence number before writing the next one
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(createEventsTable); err != nil {
+		_ = db.Close()
+		return nil, xerrors.Errorf("failed to create events table: %w", err)
+	}
+	return &EventStore{db: db}, nil
+}
+
+// Close closes the underlying database.
+func (s *EventStore) Close() error {
+	return s.db.Close()
+}
+
+// Append adds an event with payload to the end of the workspace's log, and
+// returns its sequence number.
+func (s *EventStore) Append(ctx context.Context, workspace string, eventType EventType, at time.Time, payload any) (int64, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return 0, xerrors.Errorf("failed to encode event: %w", err)
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, xerrors.Errorf("failed to append event: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	var seq int64
+	if err := tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(seq), 0) + 1 FROM events WHERE workspace = ?`, workspace).Scan(&seq); err != nil {
+		return 0, xerrors.Errorf("failed to append event: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO events (workspace, seq, type, time, payload) VALUES (?, ?, ?, ?, ?)`,
+		workspace, seq, string(eventType), at.UnixMilli(), string(data)); err != nil {
+		return 0, xerrors.Errorf("failed to append event: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, xerrors.Errorf("failed to append event: %w", err)
+	}
+	return seq, nil
+}
+
+// Events returns up to limit events of the workspace's log whose sequence
+// number is greater than after, in order.
+func (s *EventStore) Events(ctx context.Context, workspace string, after int64, limit int) ([]StoredEvent, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT seq, type, time, payload FROM events WHERE workspace = ? AND seq > ? ORDER BY seq LIMIT ?`,
+		workspace, after, limit)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to read events: %w", err)
+	}
+	defer rows.Close()
+	events := []StoredEvent{}
+	for rows.Next() {
+		var event StoredEvent
+		var eventType, payload string
+		var at int64
+		if err := rows.Scan(&event.Seq, &eventType, &at, &payload); err != nil {
+			return nil, xerrors.Errorf("failed to read events: %w", err)
+		}
+		event.Type = EventType(eventType)
+		event.Time = time.UnixMilli(at).UTC()
+		event.Payload = json.RawMessage(payload)
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, xerrors.Errorf("failed to read events: %w", err)
+	}
+	return events, nil
+}
+
+// Clear removes the workspace's log.
+func (s *EventStore) Clear(ctx context.Context, workspace string) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM events WHERE workspace = ?`, workspace); err != nil {
+		return xerrors.Errorf("failed to clear events: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,7 @@
+//go:build cgo
+
+package httpapi
+
+import _ "github.com/mattn/go-sqlite3"
+
+const eventStoreSupported = true
@@ -0,0 +1,5 @@
+//go:build !cgo
+
+package httpapi
+
+const eventStoreSupported = false
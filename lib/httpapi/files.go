@@ -0,0 +1,105 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"io/fs"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/danielgtaylor/huma/v2"
+)
+
+// maxListedFiles is the number of files GET /files returns at most.
+const maxListedFiles = 10000
+
+type FilesResponse struct {
+	Body struct {
+		Files     []string `json:"files" nullable:"false" doc:"Paths of the files in the agent's working directory, relative to it and sorted"`
+		Truncated bool     `json:"truncated" doc:"Whether there are more files than the ones listed"`
+	}
+}
+
+// EnableFileListing allows listing the files in dir, the agent's working
+// directory, with GET /files.
+func (s *Server) EnableFileListing(dir string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.filesDir = dir
+}
+
+// listFiles returns the paths of the files in dir, relative to it and
+// sorted, and whether there were more than limit. In a git repository, the
+// files ignored by git are left out. Otherwise, hidden files and
+// directories are.
+func listFiles(ctx context.Context, dir string, limit int) ([]string, bool, error) {
+	var files []string
+	cmd := exec.CommandContext(ctx, "git", "ls-files", "--cached", "--others", "--exclude-standard", "-z")
+	cmd.Dir = dir
+	if out, err := cmd.Output(); err == nil {
+		for _, file := range bytes.Split(out, []byte{0}) {
+			if len(file) > 0 {
+				files = append(files, filepath.ToSlash(string(file)))
+			}
+		}
+	} else {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if path == dir {
+				return nil
+			}
+			if strings.HasPrefix(d.Name(), ".") {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() {
+				return nil
+			}
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			files = append(files, filepath.ToSlash(rel))
+			if len(files) > limit {
+				return filepath.SkipAll
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	slices.Sort(files)
+	files = slices.Compact(files)
+	if len(files) > limit {
+		return files[:limit], true, nil
+	}
+	return files, false, nil
+}
+
+// getFiles handles GET /files
+func (s *Server) getFiles(ctx context.Context, input *struct{}) (*FilesResponse, error) {
+	s.mu.RLock()
+	dir := s.filesDir
+	s.mu.RUnlock()
+	if dir == "" {
+		return nil, huma.Error503ServiceUnavailable("file listing is not enabled")
+	}
+	files, truncated, err := listFiles(ctx, dir, maxListedFiles)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("failed to list files", err)
+	}
+	resp := &FilesResponse{}
+	resp.Body.Files = files
+	if resp.Body.Files == nil {
+		resp.Body.Files = []string{}
+	}
+	resp.Body.Truncated = truncated
+	return resp, nil
+}
@@ -0,0 +1,77 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	mf "github.com/zohaibahmed/clauder/lib/msgfmt"
+)
+
+func writeFiles(t *testing.T, dir string, files ...string) {
+	t.Helper()
+	for _, file := range files {
+		path := filepath.Join(dir, file)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(file), 0o644))
+	}
+}
+
+func TestListFiles(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	writeFiles(t, dir, "b.go", "a/c.go", "a/a.go", ".env", ".cache/x")
+
+	files, truncated, err := listFiles(ctx, dir, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a/a.go", "a/c.go", "b.go"}, files)
+	assert.False(t, truncated)
+
+	files, truncated, err = listFiles(ctx, dir, 2)
+	require.NoError(t, err)
+	assert.Len(t, files, 2)
+	assert.True(t, truncated)
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	require.NoError(t, exec.Command("git", "init", "-q", dir).Run())
+	writeFiles(t, dir, ".gitignore", "ignored/file")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".gitignore"), []byte("ignored/\n"), 0o644))
+	files, _, err = listFiles(ctx, dir, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{".cache/x", ".env", ".gitignore", "a/a.go", "a/c.go", "b.go"}, files)
+}
+
+func TestGetFiles(t *testing.T) {
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	srv := NewServer(ctx, mf.AgentTypeClaude, nil, 0, "/chat")
+	get := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		srv.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/files", nil))
+		return rec
+	}
+	assert.Equal(t, http.StatusServiceUnavailable, get().Code)
+
+	dir := t.TempDir()
+	srv.EnableFileListing(dir)
+	rec := get()
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"files":[]`)
+
+	writeFiles(t, dir, "main.go")
+	var resp FilesResponse
+	require.NoError(t, json.Unmarshal(get().Body.Bytes(), &resp.Body))
+	assert.Equal(t, []string{"main.go"}, resp.Body.Files)
+	assert.False(t, resp.Body.Truncated)
+}
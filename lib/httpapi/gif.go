@@ -0,0 +1,303 @@
+package httpapi
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/gif"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/ActiveState/vt10x"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// gifMaxFrames is the maximum number of frames of a GIF. Longer
+	// recordings are sampled.
+	gifMaxFrames = 50
+	gifMaxWidth  = 800
+	gifMaxHeight = 400
+	// A cell is a 5x7 glyph with a pixel of spacing on the right, one above
+	// and two below.
+	gifCellWidth  = 6
+	gifCellHeight = 10
+	// gifLastFrameDelay is how long the last frame is shown before the GIF
+	// loops, in hundredths of a second.
+	gifLastFrameDelay = 200
+	// gifMaxFrameDelay caps the delay of idle periods in the recording.
+	gifMaxFrameDelay = 300
+)
+
+// castHeader is the first line of an asciinema v2 recording.
+// See https://docs.asciinema.org/manual/asciicast/v2/.
+type castHeader struct {
+	Version int `json:"version"`
+	Width   int `json:"width"`
+	Height  int `json:"height"`
+}
+
+// castEvent is an output event of a recording.
+type castEvent struct {
+	// Time is the number of seconds since the start of the recording.
+	Time float64
+	Data string
+}
+
+// parseCast reads an asciinema v2 recording. Events other than output are
+// skipped.
+func parseCast(r io.Reader) (castHeader, []castEvent, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return castHeader{}, nil, xerrors.Errorf("failed to read recording: %w", err)
+		}
+		return castHeader{}, nil, xerrors.New("recording is empty")
+	}
+	var header castHeader
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		return castHeader{}, nil, xerrors.Errorf("invalid header: %w", err)
+	}
+	if header.Version != 2 {
+		return castHeader{}, nil, xerrors.Errorf("unsupported asciicast version %d, expected 2", header.Version)
+	}
+	if header.Width <= 0 || header.Height <= 0 {
+		return castHeader{}, nil, xerrors.Errorf("invalid terminal size %dx%d", header.Width, header.Height)
+	}
+
+	var events []castEvent
+	for line := 2; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var fields []json.RawMessage
+		if err := json.Unmarshal(scanner.Bytes(), &fields); err != nil || len(fields) != 3 {
+			return castHeader{}, nil, xerrors.Errorf("line %d: invalid event", line)
+		}
+		var event castEvent
+		var code string
+		if err := json.Unmarshal(fields[0], &event.Time); err != nil {
+			return castHeader{}, nil, xerrors.Errorf("line %d: invalid event time: %w", line, err)
+		}
+		if err := json.Unmarshal(fields[1], &code); err != nil {
+			return castHeader{}, nil, xerrors.Errorf("line %d: invalid event code: %w", line, err)
+		}
+		if code != "o" {
+			continue
+		}
+		if err := json.Unmarshal(fields[2], &event.Data); err != nil {
+			return castHeader{}, nil, xerrors.Errorf("line %d: invalid event data: %w", line, err)
+		}
+		events = append(events, event)
+	}
+	if err := scanner.Err(); err != nil {
+		return castHeader{}, nil, xerrors.Errorf("failed to read recording: %w", err)
+	}
+	if len(events) == 0 {
+		return castHeader{}, nil, xerrors.New("recording has no output events")
+	}
+	return header, events, nil
+}
+
+// frameEnds returns the indices of the events after which a frame is
+// captured. If there are more than gifMaxFrames events, they're sampled
+// evenly. The last event always ends a frame.
+func frameEnds(events int) []int {
+	frames := min(events, gifMaxFrames)
+	ends := make([]int, frames)
+	for i := range frames {
+		ends[i] = (i+1)*events/frames - 1
+	}
+	return ends
+}
+
+// renderCastGIF renders an asciinema v2 recording as an animated GIF. The
+// image is cropped to gifMaxWidth x gifMaxHeight pixels.
+func renderCastGIF(r io.Reader, w io.Writer) error {
+	header, events, err := parseCast(r)
+	if err != nil {
+		return err
+	}
+	state := &vt10x.State{}
+	vt, err := vt10x.New(state, strings.NewReader(""), io.Discard)
+	if err != nil {
+		return xerrors.Errorf("failed to create terminal: %w", err)
+	}
+	vt.Resize(header.Width, header.Height)
+
+	bounds := image.Rect(0, 0, min(header.Width*gifCellWidth, gifMaxWidth), min(header.Height*gifCellHeight, gifMaxHeight))
+	anim := &gif.GIF{}
+	next := 0
+	for _, end := range frameEnds(len(events)) {
+		for ; next <= end; next++ {
+			if _, err := vt.Write([]byte(events[next].Data)); err != nil {
+				return xerrors.Errorf("failed to interpret output: %w", err)
+			}
+		}
+		// the frame is shown until the output of the next one starts
+		delay := gifLastFrameDelay
+		if next < len(events) {
+			delay = int(math.Round((events[next].Time - events[end].Time) * 100))
+			delay = max(1, min(delay, gifMaxFrameDelay))
+		}
+		anim.Image = append(anim.Image, renderScreen(state, bounds))
+		anim.Delay = append(anim.Delay, delay)
+	}
+	if err := gif.EncodeAll(w, anim); err != nil {
+		return xerrors.Errorf("failed to encode GIF: %w", err)
+	}
+	return nil
+}
+
+// renderScreen draws the cells of the terminal that fit in bounds.
+func renderScreen(state *vt10x.State, bounds image.Rectangle) *image.Paletted {
+	img := image.NewPaletted(bounds, gifPalette)
+	state.Lock()
+	defer state.Unlock()
+	rows, cols := state.Size()
+	for y := 0; y < rows && y*gifCellHeight < bounds.Max.Y; y++ {
+		for x := 0; x < cols && x*gifCellWidth < bounds.Max.X; x++ {
+			ch, fg, bg := state.Cell(x, y)
+			drawCell(img, x*gifCellWidth, y*gifCellHeight, ch, paletteIndex(fg, true), paletteIndex(bg, false))
+		}
+	}
+	return img
+}
+
+// drawCell draws ch with its top left corner at (x0, y0).
+func drawCell(img *image.Paletted, x0, y0 int, ch rune, fg, bg uint8) {
+	for y := y0; y < y0+gifCellHeight; y++ {
+		for x := x0; x < x0+gifCellWidth; x++ {
+			img.SetColorIndex(x, y, bg)
+		}
+	}
+	if ch == ' ' || ch == 0 {
+		return
+	}
+	if drawBoxDrawing(img, x0, y0, ch, fg) {
+		return
+	}
+	rows, ok := glyphs[ch]
+	if !ok {
+		rows = missingGlyph
+	}
+	for dy, row := range rows {
+		for dx := 0; dx < 5; dx++ {
+			if row&(0x10>>dx) != 0 {
+				img.SetColorIndex(x0+dx, y0+1+dy, fg)
+			}
+		}
+	}
+}
+
+// boxArms maps box drawing characters to the arms drawn from the center of
+// the cell: up, right, down, left.
+var boxArms = map[rune][4]bool{
+	'─': {false, true, false, true}, '━': {false, true, false, true},
+	'│': {true, false, true, false}, '┃': {true, false, true, false},
+	'┌': {false, true, true, false}, '╭': {false, true, true, false}, '┏': {false, true, true, false},
+	'┐': {false, false, true, true}, '╮': {false, false, true, true}, '┓': {false, false, true, true},
+	'└': {true, true, false, false}, '╰': {true, true, false, false}, '┗': {true, true, false, false},
+	'┘': {true, false, false, true}, '╯': {true, false, false, true}, '┛': {true, false, false, true},
+	'├': {true, true, true, false}, '┤': {true, false, true, true},
+	'┬': {false, true, true, true}, '┴': {true, true, false, true},
+	'┼': {true, true, true, true},
+}
+
+// drawBoxDrawing draws the box drawing characters agents use for their
+// interface, which span the whole cell. It returns false for other
+// characters.
+func drawBoxDrawing(img *image.Paletted, x0, y0 int, ch rune, fg uint8) bool {
+	if ch == '█' {
+		for y := y0; y < y0+gifCellHeight; y++ {
+			for x := x0; x < x0+gifCellWidth; x++ {
+				img.SetColorIndex(x, y, fg)
+			}
+		}
+		return true
+	}
+	arms, ok := boxArms[ch]
+	if !ok {
+		return false
+	}
+	cx, cy := x0+2, y0+4
+	if arms[0] {
+		for y := y0; y <= cy; y++ {
+			img.SetColorIndex(cx, y, fg)
+		}
+	}
+	if arms[1] {
+		for x := cx; x < x0+gifCellWidth; x++ {
+			img.SetColorIndex(x, cy, fg)
+		}
+	}
+	if arms[2] {
+		for y := cy; y < y0+gifCellHeight; y++ {
+			img.SetColorIndex(cx, y, fg)
+		}
+	}
+	if arms[3] {
+		for x := x0; x <= cx; x++ {
+			img.SetColorIndex(x, cy, fg)
+		}
+	}
+	return true
+}
+
+const (
+	gifDefaultFG = 16
+	gifDefaultBG = 17
+)
+
+// gifPalette holds the 16 ANSI colors followed by the default foreground and
+// background colors.
+var gifPalette = color.Palette{
+	color.RGBA{0x00, 0x00, 0x00, 0xff}, color.RGBA{0xcd, 0x00, 0x00, 0xff},
+	color.RGBA{0x00, 0xcd, 0x00, 0xff}, color.RGBA{0xcd, 0xcd, 0x00, 0xff},
+	color.RGBA{0x00, 0x00, 0xee, 0xff}, color.RGBA{0xcd, 0x00, 0xcd, 0xff},
+	color.RGBA{0x00, 0xcd, 0xcd, 0xff}, color.RGBA{0xe5, 0xe5, 0xe5, 0xff},
+	color.RGBA{0x7f, 0x7f, 0x7f, 0xff}, color.RGBA{0xff, 0x00, 0x00, 0xff},
+	color.RGBA{0x00, 0xff, 0x00, 0xff}, color.RGBA{0xff, 0xff, 0x00, 0xff},
+	color.RGBA{0x5c, 0x5c, 0xff, 0xff}, color.RGBA{0xff, 0x00, 0xff, 0xff},
+	color.RGBA{0x00, 0xff, 0xff, 0xff}, color.RGBA{0xff, 0xff, 0xff, 0xff},
+	color.RGBA{0xd0, 0xd0, 0xd0, 0xff}, color.RGBA{0x1e, 0x1e, 0x1e, 0xff},
+}
+
+// paletteIndex maps a terminal color to the closest color of gifPalette.
+func paletteIndex(c vt10x.Color, fg bool) uint8 {
+	switch {
+	case c == vt10x.DefaultFG:
+		return gifDefaultFG
+	case c == vt10x.DefaultBG:
+		return gifDefaultBG
+	case c.ANSI():
+		return uint8(c)
+	case c < 256:
+		return uint8(gifPalette.Index(xtermColor(c)))
+	case fg:
+		return gifDefaultFG
+	default:
+		return gifDefaultBG
+	}
+}
+
+// xtermColor returns the RGB value of one of the 240 colors of the xterm
+// 256 color palette that follow the ANSI colors.
+func xtermColor(c vt10x.Color) color.Color {
+	if c >= 232 {
+		gray := uint8(8 + (c-232)*10)
+		return color.RGBA{gray, gray, gray, 0xff}
+	}
+	c -= 16
+	level := func(v vt10x.Color) uint8 {
+		if v == 0 {
+			return 0
+		}
+		return uint8(55 + v*40)
+	}
+	return color.RGBA{level(c / 36), level(c / 6 % 6), level(c % 6), 0xff}
+}
@@ -0,0 +1,212 @@
+package httpapi
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/zohaibahmed/clauder/lib/coordinator"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// handoffCodeTTL is how long a handoff code can be looked up on the
+	// coordinator.
+	handoffCodeTTL = 30 * time.Second
+	// handoffTokenTTL is how long the token of a handoff can be used.
+	handoffTokenTTL   = 24 * time.Hour
+	handoffCodeLength = 8
+	// handoffCodeChars leaves out easily confused characters, like
+	// passcodes.
+	handoffCodeChars = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+)
+
+type HandoffStatus string
+
+const (
+	// HandoffStatusPending means the code can still be used.
+	HandoffStatusPending HandoffStatus = "pending"
+	// HandoffStatusConsumed means another device connected with the code.
+	HandoffStatusConsumed HandoffStatus = "consumed"
+	// HandoffStatusExpired means the code expired before it was used.
+	HandoffStatusExpired HandoffStatus = "expired"
+)
+
+type CreateHandoffResponse struct {
+	Body struct {
+		Code      string    `json:"code" example:"ABCD2345" doc:"Handoff code to enter on the other device with 'clauder connect <code>'"`
+		ExpiresAt time.Time `json:"expires_at" doc:"When the code expires, 30 seconds after it was created"`
+	}
+}
+
+type GetHandoffStatusRequest struct {
+	Code string `path:"code" doc:"Handoff code returned by POST /session/handoff"`
+}
+
+type HandoffStatusResponse struct {
+	Body struct {
+		Code       string        `json:"code" doc:"Handoff code"`
+		Status     HandoffStatus `json:"status" enum:"pending,consumed,expired" doc:"'pending' until another device connects with the code, then 'consumed'. 'expired' if the code expired before that."`
+		ExpiresAt  time.Time     `json:"expires_at" doc:"When the code expires"`
+		ConsumedAt *time.Time    `json:"consumed_at,omitempty" doc:"When another device connected with the code. Only set if the status is 'consumed'."`
+	}
+}
+
+type handoff struct {
+	code       string
+	token      string
+	created    time.Time
+	consumedAt time.Time
+}
+
+// handoffStore holds the handoffs of a server. Each one has a code, which
+// the coordinator maps to the server's public URL and the handoff's token
+// for handoffCodeTTL, and a token, which authenticates requests like the
+// session token for handoffTokenTTL.
+type handoffStore struct {
+	logger *slog.Logger
+	// now, register and deregister are overridden in tests.
+	now        func() time.Time
+	register   func(code, tunnelURL, token string, ttl time.Duration) error
+	deregister func(code string) error
+
+	mu      sync.Mutex
+	byCode  map[string]*handoff
+	byToken map[string]*handoff
+}
+
+func newHandoffStore(logger *slog.Logger) *handoffStore {
+	return &handoffStore{
+		logger:     logger,
+		now:        time.Now,
+		register:   coordinator.RegisterHandoff,
+		deregister: func(code string) error { return coordinator.Deregister(code) },
+		byCode:     make(map[string]*handoff),
+		byToken:    make(map[string]*handoff),
+	}
+}
+
+// create generates a handoff and registers its code with the coordinator.
+func (h *handoffStore) create(tunnelURL string) (handoff, error) {
+	code, err := randomString(handoffCodeChars, handoffCodeLength)
+	if err != nil {
+		return handoff{}, err
+	}
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return handoff{}, xerrors.Errorf("failed to generate token: %w", err)
+	}
+	created := &handoff{code: code, token: hex.EncodeToString(tokenBytes), created: h.now()}
+	if err := h.register(created.code, tunnelURL, created.token, handoffCodeTTL); err != nil {
+		return handoff{}, xerrors.Errorf("failed to register handoff code: %w", err)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for token, other := range h.byToken {
+		if created.created.Sub(other.created) >= handoffTokenTTL {
+			delete(h.byToken, token)
+			delete(h.byCode, other.code)
+		}
+	}
+	h.byCode[created.code] = created
+	h.byToken[created.token] = created
+	return *created, nil
+}
+
+// useToken reports whether token is the token of a handoff that hasn't
+// expired, and marks the handoff as consumed the first time it's used.
+func (h *handoffStore) useToken(token string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	used, ok := h.byToken[token]
+	now := h.now()
+	if !ok || now.Sub(used.created) >= handoffTokenTTL {
+		return false
+	}
+	if used.consumedAt.IsZero() {
+		used.consumedAt = now
+		// the code is single use
+		go func(code string) {
+			if err := h.deregister(code); err != nil {
+				h.logger.Warn("Failed to deregister handoff code", "error", err)
+			}
+		}(used.code)
+	}
+	return true
+}
+
+// status returns the handoff with the given code and its status.
+func (h *handoffStore) status(code string) (handoff, HandoffStatus, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	found, ok := h.byCode[code]
+	if !ok {
+		return handoff{}, "", false
+	}
+	switch {
+	case !found.consumedAt.IsZero():
+		return *found, HandoffStatusConsumed, true
+	case h.now().Sub(found.created) >= handoffCodeTTL:
+		return *found, HandoffStatusExpired, true
+	default:
+		return *found, HandoffStatusPending, true
+	}
+}
+
+// randomString returns n random characters from chars.
+func randomString(chars string, n int) (string, error) {
+	b := make([]byte, n)
+	for i := range b {
+		index, err := rand.Int(rand.Reader, big.NewInt(int64(len(chars))))
+		if err != nil {
+			return "", xerrors.Errorf("failed to generate random string: %w", err)
+		}
+		b[i] = chars[index.Int64()]
+	}
+	return string(b), nil
+}
+
+// createHandoff handles POST /session/handoff
+func (s *Server) createHandoff(ctx context.Context, input *struct{}) (*CreateHandoffResponse, error) {
+	if s.handoffs == nil {
+		return nil, huma.Error503ServiceUnavailable("session handoff requires the server to be started with authentication")
+	}
+	tunnelURL := *s.tunnelURL.Load()
+	if tunnelURL == "" {
+		return nil, huma.Error503ServiceUnavailable("session handoff requires the server to be exposed through a tunnel")
+	}
+	created, err := s.handoffs.create(tunnelURL)
+	if err != nil {
+		return nil, huma.Error502BadGateway("failed to create handoff", err)
+	}
+	resp := &CreateHandoffResponse{}
+	resp.Body.Code = created.code
+	resp.Body.ExpiresAt = created.created.Add(handoffCodeTTL)
+	return resp, nil
+}
+
+// getHandoffStatus handles GET /session/handoff/{code}/status
+func (s *Server) getHandoffStatus(ctx context.Context, input *GetHandoffStatusRequest) (*HandoffStatusResponse, error) {
+	if s.handoffs == nil {
+		return nil, huma.Error503ServiceUnavailable("session handoff requires the server to be started with authentication")
+	}
+	found, status, ok := s.handoffs.status(input.Code)
+	if !ok {
+		return nil, huma.Error404NotFound(fmt.Sprintf("handoff %s not found", input.Code))
+	}
+	resp := &HandoffStatusResponse{}
+	resp.Body.Code = found.code
+	resp.Body.Status = status
+	resp.Body.ExpiresAt = found.created.Add(handoffCodeTTL)
+	if status == HandoffStatusConsumed {
+		resp.Body.ConsumedAt = &found.consumedAt
+	}
+	return resp, nil
+}
@@ -0,0 +1,168 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/coordinator"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	mf "github.com/zohaibahmed/clauder/lib/msgfmt"
+)
+
+// fakeCoordinator implements the parts of the coordinator API used by
+// handoffs, without expiry.
+type fakeCoordinator struct {
+	mu       sync.Mutex
+	sessions map[string]coordinator.RegisterRequest
+}
+
+func newFakeCoordinator(t *testing.T) *fakeCoordinator {
+	c := &fakeCoordinator{sessions: make(map[string]coordinator.RegisterRequest)}
+	router := chi.NewMux()
+	router.Post("/register", func(w http.ResponseWriter, r *http.Request) {
+		var req coordinator.RegisterRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		c.mu.Lock()
+		c.sessions[req.Passcode] = req
+		c.mu.Unlock()
+		_ = json.NewEncoder(w).Encode(coordinator.RegisterResponse{Success: true, Passcode: req.Passcode, ExpiresIn: req.ExpiresIn})
+	})
+	router.Get("/lookup/{code}", func(w http.ResponseWriter, r *http.Request) {
+		session, ok := c.session(chi.URLParam(r, "code"))
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(coordinator.LookupResponse{Error: "Invalid or expired passcode"})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(coordinator.LookupResponse{TunnelURL: session.TunnelURL, Token: session.Token})
+	})
+	router.Delete("/sessions/{code}", func(w http.ResponseWriter, r *http.Request) {
+		c.mu.Lock()
+		delete(c.sessions, chi.URLParam(r, "code"))
+		c.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	})
+	srv := httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+	t.Setenv("COORDINATOR_URL", srv.URL)
+	return c
+}
+
+func (c *fakeCoordinator) session(code string) (coordinator.RegisterRequest, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	session, ok := c.sessions[code]
+	return session, ok
+}
+
+func TestSessionHandoff(t *testing.T) {
+	fake := newFakeCoordinator(t)
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	srv := NewServerWithAuth(ctx, mf.AgentTypeClaude, nil, 0, "/chat", "session-token")
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	var nowMu sync.Mutex
+	srv.handoffs.now = func() time.Time {
+		nowMu.Lock()
+		defer nowMu.Unlock()
+		return now
+	}
+	advance := func(d time.Duration) {
+		nowMu.Lock()
+		defer nowMu.Unlock()
+		now = now.Add(d)
+	}
+	httpSrv := httptest.NewServer(srv.router)
+	defer httpSrv.Close()
+	do := func(method, path, token string) (*http.Response, map[string]any) {
+		req, err := http.NewRequest(method, httpSrv.URL+path, nil)
+		require.NoError(t, err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var body map[string]any
+		_ = json.NewDecoder(resp.Body).Decode(&body)
+		return resp, body
+	}
+
+	resp, _ := do(http.MethodPost, "/v1/session/handoff", "session-token")
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode, "the server has no public URL")
+	srv.SetTunnelURL(httpSrv.URL)
+	resp, _ = do(http.MethodPost, "/v1/session/handoff", "")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	// the phone creates a handoff code
+	resp, body := do(http.MethodPost, "/v1/session/handoff", "session-token")
+	require.Equal(t, http.StatusOK, resp.StatusCode, body)
+	code := body["code"].(string)
+	assert.Regexp(t, `^[ABCDEFGHJKLMNPQRSTUVWXYZ23456789]{8}$`, code)
+	assert.Equal(t, now.Add(30*time.Second).Format(time.RFC3339), body["expires_at"])
+	registered, ok := fake.session(code)
+	require.True(t, ok)
+	assert.Equal(t, 30, registered.ExpiresIn)
+	resp, body = do(http.MethodGet, "/v1/session/handoff/"+code+"/status", "session-token")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "pending", body["status"])
+
+	// the laptop looks it up and connects with the handoff token
+	advance(10 * time.Second)
+	lookup, err := coordinator.Lookup(code)
+	require.NoError(t, err)
+	assert.Equal(t, httpSrv.URL, lookup.TunnelURL)
+	assert.NotEqual(t, "session-token", lookup.Token)
+	resp, _ = do(http.MethodGet, "/v1/status", lookup.Token)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// the phone learns that the handoff was consumed
+	resp, body = do(http.MethodGet, "/v1/session/handoff/"+code+"/status", "session-token")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "consumed", body["status"])
+	assert.Equal(t, now.Format(time.RFC3339), body["consumed_at"])
+	require.Eventually(t, func() bool {
+		_, ok := fake.session(code)
+		return !ok
+	}, 5*time.Second, 10*time.Millisecond, "the code is single use")
+
+	// the token keeps working until it expires
+	advance(time.Hour)
+	resp, _ = do(http.MethodGet, "/v1/status", lookup.Token)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	advance(handoffTokenTTL)
+	resp, _ = do(http.MethodGet, "/v1/status", lookup.Token)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	// unused codes expire
+	resp, body = do(http.MethodPost, "/v1/session/handoff", "session-token")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	unused := body["code"].(string)
+	advance(30 * time.Second)
+	_, body = do(http.MethodGet, "/v1/session/handoff/"+unused+"/status", "session-token")
+	assert.Equal(t, "expired", body["status"])
+	resp, _ = do(http.MethodGet, "/v1/session/handoff/ZZZZZZZZ/status", "session-token")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp, _ = do(http.MethodGet, "/v1/status", "not-a-token")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestSessionHandoffWithoutAuth(t *testing.T) {
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	srv := NewServer(ctx, mf.AgentTypeClaude, nil, 0, "/chat")
+	srv.SetTunnelURL("https://example.com")
+	rec := httptest.NewRecorder()
+	srv.router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/session/handoff", strings.NewReader("")))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Contains(t, rec.Body.String(), "requires the server to be started with authentication")
+}
@@ -0,0 +1,80 @@
+package httpapi
+
+import (
+	"context"
+	"time"
+
+	st "github.com/zohaibahmed/clauder/lib/screentracker"
+	"golang.org/x/xerrors"
+)
+
+// SessionKeepalive sends a message to the agent when no user message was
+// sent for a while, so that its session doesn't expire. The keepalive
+// messages and the agent's responses are hidden from GET /messages and the
+// SSE events, though they're visible on the agent's screen.
+type SessionKeepalive struct {
+	// Interval is how long the agent must go without a user message for a
+	// keepalive to be sent.
+	Interval time.Duration
+	// Message is the keepalive message.
+	Message string
+}
+
+// EnableSessionKeepalive sends keepalive messages to the agent until ctx
+// is done.
+func (s *Server) EnableSessionKeepalive(ctx context.Context, keepalive SessionKeepalive) {
+	go s.runSessionKeepalive(ctx, keepalive)
+}
+
+func (s *Server) runSessionKeepalive(ctx context.Context, keepalive SessionKeepalive) {
+	for {
+		wait := time.Until(s.lastUserMessageTime().Add(keepalive.Interval))
+		if wait <= 0 {
+			sent, err := s.sendKeepalive(keepalive)
+			if err != nil {
+				s.logger.Error("Failed to send keepalive message", "error", err)
+			}
+			if !sent {
+				// the agent is busy, which keeps the session alive too
+				wait = keepalive.Interval
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// sendKeepalive sends the keepalive message if the agent is waiting for
+// input and went without a user message for the interval. It returns
+// whether it was sent.
+func (s *Server) sendKeepalive(keepalive SessionKeepalive) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// a message may have been sent while waiting for the lock
+	if time.Since(s.lastUserMessageTime()) < keepalive.Interval || s.agentStatus() != AgentStatusStable {
+		return false, nil
+	}
+	if err := s.conversation.SendKeepalive(FormatMessage(s.agentType, keepalive.Message)...); err != nil {
+		return false, xerrors.Errorf("failed to send keepalive: %w", err)
+	}
+	return true, nil
+}
+
+// lastUserMessageTime returns when the last user message, keepalives
+// included, was sent to the agent, or when the conversation started if
+// there are none.
+func (s *Server) lastUserMessageTime() time.Time {
+	messages := s.conversation.Messages()
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == st.ConversationRoleUser {
+			return messages[i].Time
+		}
+	}
+	if len(messages) == 0 {
+		return time.Now()
+	}
+	return messages[0].Time
+}
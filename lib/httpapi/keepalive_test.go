@@ -0,0 +1,94 @@
+package httpapi
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	st "github.com/zohaibahmed/clauder/lib/screentracker"
+)
+
+func TestSessionKeepalive(t *testing.T) {
+	ctx, cancel := context.WithCancel(logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil))))
+	defer cancel()
+	srv, httpSrv := newRoutingTestServer(t, ctx, &replyAgent{reply: "ok"})
+	defer srv.snapshotDemand.acquire()()
+
+	// record the messages sent to SSE subscribers
+	var mu sync.Mutex
+	var updates []MessageUpdateBody
+	subscriberId, ch, _ := srv.emitter.Subscribe()
+	defer srv.emitter.Unsubscribe(subscriberId)
+	go func() {
+		for event := range ch {
+			if body, ok := event.Payload.(MessageUpdateBody); ok {
+				mu.Lock()
+				updates = append(updates, body)
+				mu.Unlock()
+			}
+		}
+	}()
+
+	const interval = 500 * time.Millisecond
+	keepaliveCtx, stopKeepalive := context.WithCancel(ctx)
+	srv.EnableSessionKeepalive(keepaliveCtx, SessionKeepalive{Interval: interval, Message: "."})
+	keepalives := func() []st.ConversationMessage {
+		var messages []st.ConversationMessage
+		for _, message := range srv.conversation.Messages() {
+			if message.Keepalive && message.Role == st.ConversationRoleUser {
+				messages = append(messages, message)
+			}
+		}
+		return messages
+	}
+	require.Eventually(t, func() bool { return len(keepalives()) >= 2 }, 10*time.Second, 10*time.Millisecond)
+	stopKeepalive()
+
+	start := srv.conversation.Messages()[0].Time
+	sent := keepalives()
+	assert.GreaterOrEqual(t, sent[0].Time.Sub(start), interval)
+	assert.GreaterOrEqual(t, sent[1].Time.Sub(sent[0].Time), interval)
+	assert.Equal(t, ".", sent[0].Message)
+
+	require.Eventually(t, func() bool {
+		return srv.conversation.Status() == st.ConversationStatusStable
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, http.StatusOK, doJSON(t, http.MethodPost, httpSrv.URL+"/v1/message", `{"type":"user","content":"hello there agent"}`, nil))
+	require.Eventually(t, func() bool {
+		return srv.conversation.Status() == st.ConversationStatusStable && len(srv.messages()) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the keepalives and their responses are hidden from the history
+	var messages MessagesResponse
+	require.Equal(t, http.StatusOK, doJSON(t, http.MethodGet, httpSrv.URL+"/v1/messages", "", &messages.Body))
+	require.Len(t, messages.Body.Messages, 3)
+	assert.Equal(t, st.ConversationRoleUser, messages.Body.Messages[1].Role)
+	assert.Equal(t, "hello there agent", messages.Body.Messages[1].Content)
+	assert.Contains(t, messages.Body.Messages[2].Content, "ok")
+
+	// and from the SSE events
+	hidden := map[int]bool{}
+	for _, message := range srv.conversation.Messages() {
+		if message.Keepalive {
+			hidden[message.Id] = true
+		}
+	}
+	assert.Len(t, hidden, 4, "two keepalives and their responses")
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(updates) > 0 && updates[len(updates)-1].Id == messages.Body.Messages[2].Id
+	}, 5*time.Second, 10*time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	for _, update := range updates {
+		assert.False(t, hidden[update.Id], "message %d was emitted", update.Id)
+	}
+}
@@ -0,0 +1,103 @@
+package httpapi
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/zohaibahmed/clauder/lib/events"
+	st "github.com/zohaibahmed/clauder/lib/screentracker"
+)
+
+// agentResponseLatencyBuckets are the upper bounds of the buckets of
+// agentResponseLatency, in seconds.
+var agentResponseLatencyBuckets = []float64{0.1, 0.5, 1, 2, 5, 10, 30, 60}
+
+// messageLengthBuckets are the upper bounds of the message_length_bytes
+// label of agentResponseLatency. Longer messages are labeled "+Inf".
+var messageLengthBuckets = []int{100, 1000, 10000}
+
+// agentResponseLatency is how long the agent takes to respond to user
+// messages, by the length of the message. It includes the time the screen
+// must stay unchanged for the status to be stable.
+var agentResponseLatency = newHistogramVec(
+	"agent_response_latency_seconds",
+	"Time from when a user message is submitted to the agent until the agent's status is stable again, by the upper bound of the message's length.",
+	agentResponseLatencyBuckets,
+	"message_length_bytes",
+)
+
+// messageLengthLabel returns the message_length_bytes label of a message
+// that's length bytes long.
+func messageLengthLabel(length int) string {
+	for _, bound := range messageLengthBuckets {
+		if length <= bound {
+			return strconv.Itoa(bound)
+		}
+	}
+	return "+Inf"
+}
+
+// responseLatencyTracker measures how long the agent takes to respond to
+// the last user message that was sent.
+type responseLatencyTracker struct {
+	mu      sync.Mutex
+	pending *pendingLatency
+}
+
+type pendingLatency struct {
+	sentAt time.Time
+	length int
+	// sawRunning is set once the agent was seen running after the message
+	// was sent.
+	sawRunning bool
+}
+
+// sent starts measuring the response to a message that's length bytes long
+// and was written to the agent at sentAt. It replaces the message that's
+// being measured, if any.
+func (t *responseLatencyTracker) sent(sentAt time.Time, length int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pending = &pendingLatency{sentAt: sentAt, length: length}
+}
+
+// update records the latency of the pending message once the agent is
+// stable at now.
+func (t *responseLatencyTracker) update(status st.ConversationStatus, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.pending == nil {
+		return
+	}
+	// The screen may still be stable right after the message is sent, so
+	// the response is only complete once the agent was seen running.
+	if status != st.ConversationStatusStable {
+		t.pending.sawRunning = true
+		return
+	}
+	if !t.pending.sawRunning {
+		return
+	}
+	agentResponseLatency.With(messageLengthLabel(t.pending.length)).Observe(now.Sub(t.pending.sentAt).Seconds())
+	t.pending = nil
+}
+
+// startResponseLatencyLoop checks the agent's status every time its screen
+// is read, which happens whether or not clients are subscribed to the
+// events, and records the latency of the pending message once it's stable.
+func (s *Server) startResponseLatencyLoop(ctx context.Context) {
+	screens := s.bus.Subscribe(events.TopicPTYOutput)
+	go func() {
+		defer s.bus.Unsubscribe(events.TopicPTYOutput, screens)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-screens:
+				s.responseLatency.update(s.conversation.Status(), time.Now())
+			}
+		}
+	}()
+}
@@ -0,0 +1,142 @@
+package httpapi
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	mf "github.com/zohaibahmed/clauder/lib/msgfmt"
+	st "github.com/zohaibahmed/clauder/lib/screentracker"
+)
+
+func TestMessageLengthLabel(t *testing.T) {
+	for length, want := range map[int]string{0: "100", 100: "100", 101: "1000", 10000: "10000", 10001: "+Inf"} {
+		assert.Equal(t, want, messageLengthLabel(length), length)
+	}
+}
+
+func TestResponseLatencyTracker(t *testing.T) {
+	// a label no other test records
+	series := agentResponseLatency.With("+Inf")
+	before := series.Count()
+	var tracker responseLatencyTracker
+	sentAt := time.Now()
+
+	// nothing is recorded without a pending message
+	tracker.update(st.ConversationStatusStable, sentAt)
+	tracker.sent(sentAt, 20000)
+	// the screen was still stable right after the message was sent
+	tracker.update(st.ConversationStatusStable, sentAt.Add(time.Millisecond))
+	assert.Equal(t, before, series.Count())
+
+	tracker.update(st.ConversationStatusChanging, sentAt.Add(time.Second))
+	tracker.update(st.ConversationStatusStable, sentAt.Add(3*time.Second))
+	assert.Equal(t, before+1, series.Count())
+	// the response is only recorded once
+	tracker.update(st.ConversationStatusChanging, sentAt.Add(4*time.Second))
+	tracker.update(st.ConversationStatusStable, sentAt.Add(5*time.Second))
+	assert.Equal(t, before+1, series.Count())
+
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	srv := NewServer(ctx, mf.AgentTypeClaude, nil, 0, "/chat")
+	rec := httptest.NewRecorder()
+	srv.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(t, rec.Body.String(), "# TYPE agent_response_latency_seconds histogram\n")
+	assert.Contains(t, rec.Body.String(), `agent_response_latency_seconds_bucket{message_length_bytes="+Inf",le="2"} `)
+	assert.Contains(t, rec.Body.String(), `agent_response_latency_seconds_bucket{message_length_bytes="+Inf",le="5"} `)
+	assert.Contains(t, rec.Body.String(), `agent_response_latency_seconds_count{message_length_bytes="+Inf"} `)
+}
+
+// delayedAgent echoes what's written to it like a terminal. Once a message
+// is submitted with a carriage return, it prints a progress dot every 5ms
+// and its response after delay.
+type delayedAgent struct {
+	delay time.Duration
+
+	mu     sync.Mutex
+	screen strings.Builder
+}
+
+func (a *delayedAgent) Write(data []byte) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.screen.Write(data)
+	if strings.Contains(string(data), "\r") {
+		go a.respond()
+	}
+	return len(data), nil
+}
+
+func (a *delayedAgent) respond() {
+	ticker := time.NewTicker(5 * time.Millisecond)
+	defer ticker.Stop()
+	done := time.After(a.delay)
+	for {
+		select {
+		case <-ticker.C:
+			a.mu.Lock()
+			a.screen.WriteString(".")
+			a.mu.Unlock()
+		case <-done:
+			a.mu.Lock()
+			a.screen.WriteString("\nDone.\n")
+			a.mu.Unlock()
+			return
+		}
+	}
+}
+
+func (a *delayedAgent) ReadScreen() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.screen.String()
+}
+
+// BenchmarkResponseLatency sends messages to an agent that responds after
+// 200ms, and checks that the responses are recorded in the 0.5s bucket.
+func BenchmarkResponseLatency(b *testing.B) {
+	ctx, cancel := context.WithCancel(logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil))))
+	defer cancel()
+	srv := NewServer(ctx, mf.AgentTypeCustom, nil, 0, "/chat")
+	srv.conversation = st.NewConversation(ctx, st.ConversationConfig{
+		AgentIO:                    &delayedAgent{delay: 200 * time.Millisecond},
+		GetTime:                    time.Now,
+		SnapshotInterval:           5 * time.Millisecond,
+		ScreenStabilityLength:      20 * time.Millisecond,
+		SkipSendMessageStatusCheck: true,
+		Bus:                        srv.bus,
+	})
+	srv.StartSnapshotLoop(ctx)
+	// the message is at most 100 bytes long
+	series := agentResponseLatency.With("100")
+	bucket := slices.Index(agentResponseLatencyBuckets, 0.5)
+	before, beforeFaster := series.BucketCount(bucket), series.BucketCount(bucket-1)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		count := series.Count()
+		if _, err := srv.createMessage(ctx, &MessageRequest{Body: MessageRequestBody{Type: MessageTypeUser, Content: "what does main do"}}); err != nil {
+			b.Fatal(err)
+		}
+		for series.Count() == count {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	b.StopTimer()
+
+	if got := series.BucketCount(bucket) - before; got != uint64(b.N) {
+		b.Fatalf("the 0.5s bucket recorded %d responses, want %d", got, b.N)
+	}
+	if got := series.BucketCount(bucket-1) - beforeFaster; got != 0 {
+		b.Fatalf("the 0.1s bucket recorded %d responses, want 0", got)
+	}
+}
@@ -0,0 +1,94 @@
+package httpapi
+
+import (
+	"context"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/zohaibahmed/clauder/lib/termexec"
+)
+
+// lazyAgentIO is the AgentIO of a server whose agent is started by the
+// first message. Until then, the snapshot loop reads an empty screen
+// rather than starting the agent.
+type lazyAgentIO struct {
+	agent *termexec.LazyProcess
+}
+
+func (a lazyAgentIO) Write(data []byte) (int, error) {
+	return a.agent.Write(data)
+}
+
+func (a lazyAgentIO) ReadScreen() string {
+	process := a.agent.Process()
+	if process == nil {
+		return ""
+	}
+	return process.ReadScreen()
+}
+
+// process returns the agent's process, or nil if there's none or it's
+// started lazily and wasn't started yet.
+func (s *Server) process() *termexec.Process {
+	if s.lazyAgent != nil {
+		return s.lazyAgent.Process()
+	}
+	return s.agentio
+}
+
+// agentStatus returns the status of the agent, which is running while
+// queued messages haven't been answered yet, and not_started until a lazily
+// started agent is sent its first message.
+func (s *Server) agentStatus() AgentStatus {
+	if queue := s.messageQueue.Load(); queue != nil && queue.Len() > 0 {
+		return AgentStatusRunning
+	}
+	if s.lazyAgent != nil && !s.lazyAgent.IsStarted() {
+		return AgentStatusNotStarted
+	}
+	return convertStatus(s.conversation.Status())
+}
+
+// startAgent starts the agent if it's started lazily and wasn't started
+// yet. If wait is set and the agent was started recently, it also waits
+// until the agent is ready for a message.
+func (s *Server) startAgent(ctx context.Context, wait bool) error {
+	if s.lazyAgent == nil {
+		return nil
+	}
+	process, err := s.lazyAgent.Start()
+	if err != nil {
+		return huma.Error503ServiceUnavailable("failed to start the agent", err)
+	}
+	if s.lazyAgentStartedAt.CompareAndSwap(0, time.Now().UnixNano()) {
+		s.logger.Info("Started the agent on its first message")
+		process.OnWriteSpan(recordWriteSpan)
+	}
+	if !wait {
+		return nil
+	}
+	// the screens read before the agent started are empty, and look stable
+	// until they're out of the window the stability is checked over
+	startedAt := time.Unix(0, s.lazyAgentStartedAt.Load())
+	remaining := screenStabilityLength + snapshotInterval - time.Since(startedAt)
+	if remaining <= 0 {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(remaining):
+	}
+	return s.waitForStableStatus(ctx)
+}
+
+// closeAgent closes the agent, if it has one that was started.
+func (s *Server) closeAgent(timeout time.Duration) error {
+	if s.lazyAgent != nil {
+		return s.lazyAgent.Close(s.logger, timeout)
+	}
+	if s.agentio == nil {
+		return nil
+	}
+	return s.agentio.Close(s.logger, timeout)
+}
@@ -0,0 +1,74 @@
+package httpapi
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	mf "github.com/zohaibahmed/clauder/lib/msgfmt"
+	"github.com/zohaibahmed/clauder/lib/termexec"
+)
+
+func TestLazyWorkspaceAgent(t *testing.T) {
+	if _, err := exec.LookPath("cat"); err != nil {
+		t.Skip("cat not found")
+	}
+	ctx, cancel := context.WithCancel(logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil))))
+	defer cancel()
+	srv := NewServer(ctx, mf.AgentTypeClaude, nil, 0, "/chat")
+	srv.EnableAdminShutdown("admin", nil)
+	srv.SetLazyWorkspaceAgents(true)
+	var starts atomic.Int32
+	srv.EnableWorkspaces(ctx, func(ctx context.Context, workspace Workspace) (*termexec.Process, error) {
+		starts.Add(1)
+		return termexec.StartProcess(ctx, termexec.StartProcessConfig{
+			Program:        "cat",
+			TerminalWidth:  80,
+			TerminalHeight: 24,
+		})
+	})
+	httpSrv := httptest.NewServer(srv.handler())
+	defer httpSrv.Close()
+	admin := httpSrv.URL + "/v1/admin/workspaces"
+	workspaceURL := httpSrv.URL + "/workspaces/lazy/v1"
+	token := "token-lazy-0123456789"
+
+	require.Equal(t, http.StatusCreated, doWorkspaceRequest(t, http.MethodPost, admin, "admin", `{"id":"lazy","name":"Lazy","token":"`+token+`","agent_config":{"type":"custom","program":"cat"}}`, nil).StatusCode)
+	var status StatusResponse
+	require.Equal(t, http.StatusOK, doWorkspaceRequest(t, http.MethodGet, workspaceURL+"/status", token, "", &status.Body).StatusCode)
+	assert.Equal(t, AgentStatusNotStarted, status.Body.Status)
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, int32(0), starts.Load(), "the snapshot loop must not start the agent")
+
+	// the first message starts the agent, and waits for it to be ready
+	assert.Equal(t, http.StatusUnprocessableEntity, doWorkspaceRequest(t, http.MethodPost, workspaceURL+"/message", token, `{"type":"user","content":"hi"}`, nil).StatusCode)
+	assert.Equal(t, int32(0), starts.Load(), "invalid messages don't start the agent")
+	require.Equal(t, http.StatusOK, doWorkspaceRequest(t, http.MethodPost, workspaceURL+"/message", token, `{"type":"user","content":"hello lazy agent"}`, nil).StatusCode)
+	assert.Equal(t, int32(1), starts.Load())
+	require.Eventually(t, func() bool {
+		doWorkspaceRequest(t, http.MethodGet, workspaceURL+"/status", token, "", &status.Body)
+		return status.Body.Status == AgentStatusStable
+	}, 10*time.Second, 50*time.Millisecond)
+	var messages MessagesResponse
+	require.Equal(t, http.StatusOK, doWorkspaceRequest(t, http.MethodGet, workspaceURL+"/messages", token, "", &messages.Body).StatusCode)
+	require.NotEmpty(t, messages.Body.Messages)
+	assert.Equal(t, "hello lazy agent", messages.Body.Messages[len(messages.Body.Messages)-2].Content)
+
+	require.Equal(t, http.StatusOK, doWorkspaceRequest(t, http.MethodPost, workspaceURL+"/message", token, `{"type":"user","content":"hello lazy agent again"}`, nil).StatusCode)
+	assert.Equal(t, int32(1), starts.Load(), "the agent is only started once")
+
+	// a workspace that's deleted before its first message never starts
+	require.Equal(t, http.StatusCreated, doWorkspaceRequest(t, http.MethodPost, admin, "admin", `{"id":"unused","name":"Unused","agent_config":{"type":"custom","program":"cat"}}`, nil).StatusCode)
+	require.Equal(t, http.StatusNoContent, doWorkspaceRequest(t, http.MethodDelete, admin+"/unused", "admin", "", nil).StatusCode)
+	assert.Equal(t, int32(1), starts.Load())
+	require.Equal(t, http.StatusNoContent, doWorkspaceRequest(t, http.MethodDelete, admin+"/lazy", "admin", "", nil).StatusCode)
+}
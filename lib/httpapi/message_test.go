@@ -0,0 +1,118 @@
+package httpapi
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/events"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	mf "github.com/zohaibahmed/clauder/lib/msgfmt"
+	st "github.com/zohaibahmed/clauder/lib/screentracker"
+)
+
+func TestCreateMessageValidation(t *testing.T) {
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(os.Stdout, nil)))
+	srv := NewServer(ctx, mf.AgentTypeClaude, nil, 0, "/chat")
+
+	_, err := srv.createMessage(ctx, &MessageRequest{Body: MessageRequestBody{Type: MessageTypeUser, Content: "hi\x00"}})
+	var statusErr huma.StatusError
+	require.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, http.StatusUnprocessableEntity, statusErr.GetStatus())
+	var model *huma.ErrorModel
+	require.ErrorAs(t, err, &model)
+	require.Len(t, model.Errors, 1)
+	assert.Equal(t, "body.content", model.Errors[0].Location)
+	assert.Equal(t, mf.ValidationErrorNullByte, model.Errors[0].Value)
+}
+
+func TestCreateMessageContextTrimming(t *testing.T) {
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(os.Stdout, nil)))
+	srv := NewServer(ctx, mf.AgentTypeCustom, nil, 0, "/chat")
+	agent := &echoAgent{}
+	srv.conversation = st.NewConversation(ctx, st.ConversationConfig{
+		AgentIO:                    agent,
+		GetTime:                    time.Now,
+		SnapshotInterval:           time.Millisecond,
+		ScreenStabilityLength:      2 * time.Millisecond,
+		SkipSendMessageStatusCheck: true,
+	})
+	srv.EnableContextTrimming(200)
+	_, events, _ := srv.emitter.Subscribe()
+
+	// every message is about 25 tokens, so the conversation is trimmed
+	// after a few rounds
+	var trimmed *ContextTrimmedBody
+	for i := 0; trimmed == nil; i++ {
+		require.Less(t, i, 10, "the conversation was never trimmed")
+		content := fmt.Sprintf("message number %d %s", i, strings.Repeat("x", 80))
+		_, err := srv.createMessage(ctx, &MessageRequest{Body: MessageRequestBody{Type: MessageTypeUser, Content: content}})
+		require.NoError(t, err)
+		agent.mu.Lock()
+		agent.screen.WriteString(fmt.Sprintf("\nresponse number %d %s", i, strings.Repeat("y", 80)))
+		agent.mu.Unlock()
+		srv.conversation.AddSnapshot(agent.ReadScreen())
+		srv.emitter.UpdateMessagesAndEmitChanges(srv.conversation.Messages())
+
+	drain:
+		for {
+			select {
+			case event := <-events:
+				if event.Type == EventTypeContextTrimmed {
+					body := event.Payload.(ContextTrimmedBody)
+					trimmed = &body
+				}
+			default:
+				break drain
+			}
+		}
+	}
+
+	assert.Equal(t, "context_trimmed", trimmed.Type)
+	assert.Greater(t, trimmed.RemovedMessages, 0)
+	assert.LessOrEqual(t, trimmed.CurrentTokensEst, 160)
+	assert.Equal(t, mf.ContextTrimmedAnnotation(trimmed.RemovedMessages), trimmed.Annotation)
+	assert.NotContains(t, agent.ReadScreen(), "Context trimmed", "the user's messages are sent as they are")
+
+	messages := srv.conversation.Messages()
+	assert.Greater(t, messages[0].Id, 0)
+	for i, msg := range messages[1:] {
+		assert.Equal(t, messages[i].Id+1, msg.Id)
+	}
+
+	srv.EnableContextTrimming(100000)
+	_, err := srv.createMessage(ctx, &MessageRequest{Body: MessageRequestBody{Type: MessageTypeUser, Content: "one more short message"}})
+	require.NoError(t, err)
+	messages = srv.conversation.Messages()
+	last := messages[len(messages)-1]
+	assert.Equal(t, st.ConversationRoleUser, last.Role)
+	assert.Equal(t, "one more short message", last.Message)
+}
+
+func TestCreateMessagePublishesMessageSent(t *testing.T) {
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(os.Stdout, nil)))
+	srv := NewServer(ctx, mf.AgentTypeCustom, nil, 0, "/chat")
+	srv.conversation = st.NewConversation(ctx, st.ConversationConfig{
+		AgentIO:                    &echoAgent{},
+		GetTime:                    time.Now,
+		SnapshotInterval:           time.Millisecond,
+		ScreenStabilityLength:      2 * time.Millisecond,
+		SkipSendMessageStatusCheck: true,
+	})
+	srv.bus = events.NewEventBus(10)
+	sent := srv.bus.Subscribe(events.TopicMessageSent)
+
+	_, err := srv.createMessage(ctx, &MessageRequest{Body: MessageRequestBody{Type: MessageTypeUser, Content: "what does main do"}})
+	require.NoError(t, err)
+	msg := (<-sent).(st.ConversationMessage)
+	assert.Equal(t, st.ConversationRoleUser, msg.Role)
+	assert.Equal(t, "what does main do", msg.Message)
+}
@@ -0,0 +1,242 @@
+package httpapi
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// metric is a metric that can be exported in the Prometheus text format.
+type metric interface {
+	writeTo(w io.Writer)
+}
+
+type metricsRegistry struct {
+	mu      sync.Mutex
+	metrics []metric
+}
+
+// metrics holds all metrics exported on GET /metrics.
+var metrics = &metricsRegistry{}
+
+func (r *metricsRegistry) register(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics = append(r.metrics, m)
+}
+
+func (r *metricsRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	for _, m := range r.metrics {
+		m.writeTo(w)
+	}
+}
+
+// counterVec is a counter partitioned by labels. A counterVec without label
+// names is a plain counter.
+type counterVec struct {
+	name       string
+	help       string
+	labelNames []string
+
+	mu     sync.Mutex
+	values map[string]uint64
+}
+
+func newCounterVec(name, help string, labelNames ...string) *counterVec {
+	c := &counterVec{
+		name:       name,
+		help:       help,
+		labelNames: labelNames,
+		values:     make(map[string]uint64),
+	}
+	metrics.register(c)
+	return c
+}
+
+func (c *counterVec) labels(labelValues []string) string {
+	pairs := labelPairs(c.name, c.labelNames, labelValues)
+	if pairs == "" {
+		return ""
+	}
+	return "{" + pairs + "}"
+}
+
+// labelPairs returns the labels of a metric's series in the Prometheus text
+// format, without braces, e.g. `method="GET",code="200"`.
+func labelPairs(name string, labelNames, labelValues []string) string {
+	if len(labelValues) != len(labelNames) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", name, len(labelNames), len(labelValues)))
+	}
+	pairs := make([]string, len(labelValues))
+	for i, value := range labelValues {
+		value = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+		pairs[i] = fmt.Sprintf(`%s="%s"`, labelNames[i], value)
+	}
+	return strings.Join(pairs, ",")
+}
+
+// Inc increments the counter for the given label values.
+func (c *counterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds n to the counter for the given label values.
+func (c *counterVec) Add(n uint64, labelValues ...string) {
+	key := c.labels(labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[key] += n
+}
+
+// Value returns the current value of the counter for the given label values.
+func (c *counterVec) Value(labelValues ...string) uint64 {
+	key := c.labels(labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[key]
+}
+
+func (c *counterVec) writeTo(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	keys := make([]string, 0, len(c.values))
+	for key := range c.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s%s %d\n", c.name, key, c.values[key])
+	}
+}
+
+// histogram counts observations in cumulative buckets.
+type histogram struct {
+	name string
+	help string
+	// buckets are the upper bounds of the buckets, in increasing order.
+	buckets []float64
+
+	mu     sync.Mutex
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(name, help string, buckets []float64) *histogram {
+	h := &histogram{
+		name:    name,
+		help:    help,
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+	metrics.register(h)
+	return h
+}
+
+// Observe records a value.
+func (h *histogram) Observe(value float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, bound := range h.buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += value
+	h.count++
+}
+
+// Count returns the number of recorded values.
+func (h *histogram) Count() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.count
+}
+
+func (h *histogram) writeTo(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	h.writeSeries(w, "")
+}
+
+// writeSeries writes the buckets, sum and count of the histogram with the
+// given label pairs.
+func (h *histogram) writeSeries(w io.Writer, pairs string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	labels, bucketLabels := "", ""
+	if pairs != "" {
+		labels, bucketLabels = "{"+pairs+"}", pairs+","
+	}
+	for i, bound := range h.buckets {
+		fmt.Fprintf(w, "%s_bucket{%sle=\"%s\"} %d\n", h.name, bucketLabels, strconv.FormatFloat(bound, 'g', -1, 64), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{%sle=\"+Inf\"} %d\n", h.name, bucketLabels, h.count)
+	fmt.Fprintf(w, "%s_sum%s %s\n", h.name, labels, strconv.FormatFloat(h.sum, 'g', -1, 64))
+	fmt.Fprintf(w, "%s_count%s %d\n", h.name, labels, h.count)
+}
+
+// BucketCount returns the number of recorded values that are at most the
+// upper bound of the bucket with index i.
+func (h *histogram) BucketCount(i int) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.counts[i]
+}
+
+// histogramVec is a histogram partitioned by labels.
+type histogramVec struct {
+	name       string
+	help       string
+	buckets    []float64
+	labelNames []string
+
+	mu     sync.Mutex
+	series map[string]*histogram
+}
+
+func newHistogramVec(name, help string, buckets []float64, labelNames ...string) *histogramVec {
+	h := &histogramVec{
+		name:       name,
+		help:       help,
+		buckets:    buckets,
+		labelNames: labelNames,
+		series:     make(map[string]*histogram),
+	}
+	metrics.register(h)
+	return h
+}
+
+// With returns the histogram for the given label values.
+func (h *histogramVec) With(labelValues ...string) *histogram {
+	pairs := labelPairs(h.name, h.labelNames, labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	series, ok := h.series[pairs]
+	if !ok {
+		series = &histogram{name: h.name, help: h.help, buckets: h.buckets, counts: make([]uint64, len(h.buckets))}
+		h.series[pairs] = series
+	}
+	return series
+}
+
+func (h *histogramVec) writeTo(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		h.series[key].writeSeries(w, key)
+	}
+}
@@ -32,6 +32,20 @@ type Message struct {
 	Time    time.Time           `json:"time" doc:"Timestamp of the message"`
 }
 
+type HealthBody struct {
+	Status          string    `json:"status" doc:"Always 'ok'"`
+	AgentType       string    `json:"agent_type" doc:"Type of the agent the server controls"`
+	UptimeSeconds   int64     `json:"uptime_seconds" doc:"How long the server has been running, in seconds"`
+	TunnelURL       string    `json:"tunnel_url,omitempty" doc:"Public URL of the server, if it's exposed through a tunnel"`
+	SSEClients      int       `json:"sse_clients" doc:"Number of connected SSE clients"`
+	LastMessageTime time.Time `json:"last_message_time" doc:"Timestamp of the last message in the conversation"`
+}
+
+// HealthResponse represents the health of the server
+type HealthResponse struct {
+	Body HealthBody
+}
+
 // StatusResponse represents the server status
 type StatusResponse struct {
 	Body struct {
@@ -39,6 +53,12 @@ type StatusResponse struct {
 	}
 }
 
+// LivezResponse represents the result of the last watchdog check
+type LivezResponse struct {
+	Status int
+	Body   WatchdogStatus
+}
+
 // MessagesResponse represents the list of messages
 type MessagesResponse struct {
 	Body struct {
@@ -53,12 +73,29 @@ type MessageRequestBody struct {
 
 // MessageRequest represents a request to create a new message
 type MessageRequest struct {
-	Body MessageRequestBody `json:"body" doc:"Message content and type"`
+	Template string             `query:"template" doc:"Name of a template to wrap the message content with. Only allowed for messages of type 'user'."`
+	Body     MessageRequestBody `json:"body" doc:"Message content and type"`
 }
 
 // MessageResponse represents a newly created message
 type MessageResponse struct {
-	Body struct {
-		Ok bool `json:"ok" doc:"Indicates whether the message was sent successfully. For messages of type 'user', success means detecting that the agent began executing the task described. For messages of type 'raw', success means the keystrokes were sent to the terminal."`
+	CacheControl string `header:"Cache-Control" doc:"Set to 'max-age=<ttl>' when the response cache is enabled"`
+	Cache        string `header:"X-Cache" enum:"HIT,MISS" doc:"Whether the agent's response was served from the response cache. Only set when the response cache is enabled."`
+	Body         struct {
+		Ok              bool   `json:"ok" doc:"Indicates whether the message was sent successfully. For messages of type 'user', success means detecting that the agent began executing the task described. For messages of type 'raw', success means the keystrokes were sent to the terminal."`
+		CachedResponse  string `json:"cached_response,omitempty" doc:"The agent's cached response to an identical earlier message. Only set on a cache hit, in which case the message is not sent to the agent."`
+		Queued          bool   `json:"queued,omitempty" doc:"Whether the message was added to the message queue instead of being sent right away. Only set when the message queue is enabled."`
+		Position        int    `json:"position,omitempty" doc:"Position of the message in the queue, where 1 means it's sent next. Only set if the message was queued."`
+		CommandResponse string `json:"command_response,omitempty" doc:"The server's confirmation that it ran the slash command in the message, like 'Command executed: /restart', followed by its output. Only set when slash commands are enabled and the message is one, in which case it's not sent to the agent."`
 	}
 }
+
+// CodeBlocksRequest represents a request for the code blocks of a message
+type CodeBlocksRequest struct {
+	Seq int `path:"seq" doc:"Id of the message to extract code blocks from"`
+}
+
+// CodeBlocksResponse represents the code blocks extracted from a message
+type CodeBlocksResponse struct {
+	Body []CodeBlock `nullable:"false" doc:"Code blocks in the order they appear in the message"`
+}
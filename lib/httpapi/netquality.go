@@ -0,0 +1,101 @@
+package httpapi
+
+import (
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/zohaibahmed/clauder/lib/util"
+	"golang.org/x/xerrors"
+)
+
+type NetworkQuality string
+
+const (
+	NetworkQualityGood     NetworkQuality = "good"
+	NetworkQualityDegraded NetworkQuality = "degraded"
+	NetworkQualityPoor     NetworkQuality = "poor"
+)
+
+var NetworkQualityValues = []NetworkQuality{
+	NetworkQualityGood,
+	NetworkQualityDegraded,
+	NetworkQualityPoor,
+}
+
+func (q NetworkQuality) Schema(r huma.Registry) *huma.Schema {
+	return util.OpenAPISchema(r, "NetworkQuality", NetworkQualityValues)
+}
+
+type NetworkQualityBody struct {
+	Type    string         `json:"type" enum:"network_quality" doc:"Always 'network_quality'"`
+	Quality NetworkQuality `json:"quality" doc:"'degraded' means events are delivered late, 'good' means delivery recovered, and 'poor' means the connection is about to be closed because the events were delayed for too long."`
+	GapMs   int64          `json:"gap_ms,omitempty" doc:"Time between two consecutive event writes while events were waiting, in milliseconds"`
+}
+
+var errSSEWriteTimeout = xerrors.New("event write timed out")
+
+var sseNetworkQualityEvents = newCounterVec(
+	"sse_network_quality_events_total",
+	"Number of network_quality events sent to SSE subscribers.",
+	"quality",
+)
+
+// networkQualityMonitor passively measures the gaps between the event writes
+// to an SSE subscriber. Writes block once the connection's buffers are full,
+// so on a slow connection the events queued behind a slow write arrive with
+// a gap. A gap is only measured while events are waiting: once the
+// subscriber caught up, the time until the next event is produced isn't
+// the connection's fault.
+type networkQualityMonitor struct {
+	// A gap longer than this degrades the quality. It's three times the
+	// snapshot interval, the rate at which updates are produced.
+	degradedThreshold time.Duration
+	// writeTimeout is the gap that closes the connection, or 0 if gaps
+	// never close it.
+	writeTimeout time.Duration
+	degraded     bool
+	// lastWrite is when the last write completed, or zero if no event was
+	// waiting then.
+	lastWrite time.Time
+}
+
+func newNetworkQualityMonitor(writeTimeout time.Duration) *networkQualityMonitor {
+	return &networkQualityMonitor{
+		degradedThreshold: 3 * snapshotInterval,
+		writeTimeout:      writeTimeout,
+	}
+}
+
+// observe records an event write that started at start and completed at
+// end, and whether other events were waiting to be written once it
+// completed. The gap is measured from the previous write if events were
+// waiting then, and from start otherwise. It returns the event to notify the
+// subscriber with, if the quality changed, and whether the connection should
+// be closed.
+func (m *networkQualityMonitor) observe(start, end time.Time, waiting bool) (*NetworkQualityBody, bool) {
+	since := start
+	if !m.lastWrite.IsZero() {
+		since = m.lastWrite
+	}
+	m.lastWrite = time.Time{}
+	if waiting {
+		m.lastWrite = end
+	}
+	gap := end.Sub(since)
+	switch {
+	case m.writeTimeout > 0 && gap > m.writeTimeout:
+		return &NetworkQualityBody{Type: "network_quality", Quality: NetworkQualityPoor}, true
+	case gap > m.degradedThreshold:
+		if m.degraded {
+			return nil, false
+		}
+		m.degraded = true
+		return &NetworkQualityBody{Type: "network_quality", Quality: NetworkQualityDegraded, GapMs: gap.Milliseconds()}, false
+	default:
+		if !m.degraded {
+			return nil, false
+		}
+		m.degraded = false
+		return &NetworkQualityBody{Type: "network_quality", Quality: NetworkQualityGood}, false
+	}
+}
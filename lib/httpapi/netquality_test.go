@@ -0,0 +1,136 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	mf "github.com/zohaibahmed/clauder/lib/msgfmt"
+	st "github.com/zohaibahmed/clauder/lib/screentracker"
+)
+
+// slowResponseWriter simulates a slow connection by delaying every flush.
+type slowResponseWriter struct {
+	mu     sync.Mutex
+	header http.Header
+	body   bytes.Buffer
+	delay  time.Duration
+}
+
+func (w *slowResponseWriter) Header() http.Header              { return w.header }
+func (w *slowResponseWriter) WriteHeader(int)                  {}
+func (w *slowResponseWriter) SetWriteDeadline(time.Time) error { return nil }
+
+func (w *slowResponseWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.body.Write(data)
+}
+
+func (w *slowResponseWriter) Flush() {
+	w.mu.Lock()
+	delay := w.delay
+	w.mu.Unlock()
+	time.Sleep(delay)
+}
+
+func (w *slowResponseWriter) SetDelay(delay time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.delay = delay
+}
+
+func (w *slowResponseWriter) Body() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.body.String()
+}
+
+func TestNetworkQualityMonitor(t *testing.T) {
+	m := newNetworkQualityMonitor(time.Second)
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(ms int) time.Time { return now.Add(time.Duration(ms) * time.Millisecond) }
+
+	event, closeConn := m.observe(at(0), at(75), false)
+	assert.Nil(t, event)
+	assert.False(t, closeConn)
+
+	// a single write that takes longer than 3x the snapshot interval
+	event, closeConn = m.observe(at(1000), at(1076), false)
+	assert.Equal(t, &NetworkQualityBody{Type: "network_quality", Quality: NetworkQualityDegraded, GapMs: 76}, event)
+	assert.False(t, closeConn)
+
+	// Only the transition is reported.
+	event, _ = m.observe(at(2000), at(2125), false)
+	assert.Nil(t, event)
+
+	event, _ = m.observe(at(3000), at(3001), true)
+	assert.Equal(t, &NetworkQualityBody{Type: "network_quality", Quality: NetworkQualityGood}, event)
+
+	// the writes are fast, but the events waiting for them are written
+	// 80ms apart
+	event, _ = m.observe(at(3060), at(3081), true)
+	assert.Equal(t, &NetworkQualityBody{Type: "network_quality", Quality: NetworkQualityDegraded, GapMs: 80}, event)
+	event, _ = m.observe(at(3090), at(3100), false)
+	assert.Equal(t, &NetworkQualityBody{Type: "network_quality", Quality: NetworkQualityGood}, event)
+
+	// the subscriber caught up, so the time until the next event isn't a gap
+	event, _ = m.observe(at(9000), at(9001), true)
+	assert.Nil(t, event)
+
+	event, closeConn = m.observe(at(9500), at(10002), true)
+	assert.Equal(t, &NetworkQualityBody{Type: "network_quality", Quality: NetworkQualityPoor}, event)
+	assert.True(t, closeConn)
+}
+
+func TestSubscribeEventsNetworkQuality(t *testing.T) {
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(os.Stdout, nil)))
+	srv := NewServer(ctx, mf.AgentTypeClaude, nil, 0, "/chat")
+	srv.SetSSEWriteTimeout(600 * time.Millisecond)
+	degradedBefore := sseNetworkQualityEvents.Value(string(NetworkQualityDegraded))
+	poorBefore := sseNetworkQualityEvents.Value(string(NetworkQualityPoor))
+
+	w := &slowResponseWriter{header: http.Header{}}
+	reqCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	req := httptest.NewRequest(http.MethodGet, "/v1/events", nil).WithContext(reqCtx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		srv.router.ServeHTTP(w, req)
+	}()
+
+	require.Eventually(t, func() bool { return strings.Contains(w.Body(), "event: status_change") }, 5*time.Second, 10*time.Millisecond)
+	assert.NotContains(t, w.Body(), "event: network_quality")
+
+	w.SetDelay(3*snapshotInterval + 25*time.Millisecond)
+	srv.emitter.UpdateStatusAndEmitChanges(st.ConversationStatusStable)
+	require.Eventually(t, func() bool { return strings.Contains(w.Body(), `"quality":"degraded"`) }, 5*time.Second, 10*time.Millisecond)
+	assert.Contains(t, w.Body(), "event: network_quality")
+	assert.Equal(t, degradedBefore+1, sseNetworkQualityEvents.Value(string(NetworkQualityDegraded)))
+
+	// slower than half the write timeout
+	w.SetDelay(400 * time.Millisecond)
+	srv.emitter.UpdateStatusAndEmitChanges(st.ConversationStatusChanging)
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("connection was not closed after a write timeout")
+	}
+	assert.Contains(t, w.Body(), `"quality":"poor"`)
+	assert.Equal(t, poorBefore+1, sseNetworkQualityEvents.Value(string(NetworkQualityPoor)))
+
+	rec := httptest.NewRecorder()
+	srv.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(t, rec.Body.String(), "\nsse_network_quality_events_total{quality=\"poor\"}")
+}
@@ -0,0 +1,50 @@
+package httpapi
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// DefaultPIDFilePath returns the path of the file the server writes its
+// PID to, ~/.clauder/server.pid.
+func DefaultPIDFilePath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", xerrors.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".clauder", "server.pid"), nil
+}
+
+// WritePIDFile writes the PID of the current process to path. The returned
+// function removes the file.
+func WritePIDFile(path string) (func() error, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, xerrors.Errorf("failed to create PID file directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o600); err != nil {
+		return nil, xerrors.Errorf("failed to write PID file: %w", err)
+	}
+	return func() error {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return xerrors.Errorf("failed to remove PID file: %w", err)
+		}
+		return nil
+	}, nil
+}
+
+// ReadPIDFile returns the PID written to path by WritePIDFile.
+func ReadPIDFile(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, xerrors.Errorf("failed to read PID file: %w", err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, xerrors.Errorf("invalid PID file %s: %w", path, err)
+	}
+	return pid, nil
+}
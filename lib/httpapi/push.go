@@ -0,0 +1,97 @@
+package httpapi
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/danielgtaylor/huma/v2/adapters/humachi"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// SnapshotBody is sent to the subscribers of GET /events that can't
+// receive the snapshot by HTTP/2 server push.
+type SnapshotBody struct {
+	Type   string `json:"type" enum:"snapshot" doc:"Always 'snapshot'"`
+	Screen string `json:"screen" doc:"Contents of the agent's terminal screen, as returned by GET /snapshot"`
+	Seq    int    `json:"seq" doc:"Sequence number of the snapshot"`
+}
+
+var snapshotPushes = newCounterVec(
+	"snapshot_pushes_total",
+	"Number of snapshots sent to new subscribers of GET /events, by HTTP/2 server push or as a snapshot event.",
+	"method",
+)
+
+// EnablePushSnapshot sends new subscribers of GET /events the agent's
+// screen right away, instead of leaving them to fetch GET /snapshot after
+// connecting. HTTP/2 clients get it by server push, and the others, or
+// HTTP/2 clients that disabled push, as a snapshot event after the
+// subscribed event. The server accepts HTTP/2 without TLS (h2c) from then
+// on, since TLS is terminated by the proxy or tunnel in front of it. It
+// must be called before Start.
+func (s *Server) EnablePushSnapshot() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snapshotPush = true
+}
+
+// h2cHandler serves HTTP/2 without TLS with handler, if EnablePushSnapshot
+// was called.
+func (s *Server) h2cHandler(handler http.Handler) http.Handler {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if !s.snapshotPush {
+		return handler
+	}
+	return h2c.NewHandler(handler, &http2.Server{})
+}
+
+// resolvePush records how to push the snapshot to the client of an HTTP/2
+// request.
+func (r *SubscribeEventsRequest) resolvePush(ctx huma.Context) {
+	if ctx.Version().ProtoMajor != 2 {
+		return
+	}
+	req, w := humachi.Unwrap(ctx)
+	for {
+		if pusher, ok := w.(http.Pusher); ok {
+			r.pusher = pusher
+			break
+		}
+		unwrapper, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return
+		}
+		w = unwrapper.Unwrap()
+	}
+	// the snapshot is next to the events, in the same API version
+	r.snapshotPath = strings.TrimSuffix(req.URL.Path, "/events") + "/snapshot"
+	r.pushHeader = http.Header{}
+	if auth := req.Header.Get("Authorization"); auth != "" {
+		r.pushHeader.Set("Authorization", auth)
+	}
+}
+
+// sendSnapshot pushes the snapshot to a new subscriber if EnablePushSnapshot
+// was called, or returns the event to send it with if it can't be pushed.
+func (s *Server) sendSnapshot(input *SubscribeEventsRequest) *SnapshotBody {
+	s.mu.RLock()
+	snapshotPush := s.snapshotPush
+	s.mu.RUnlock()
+	if !snapshotPush || input.Mode != eventsModeFull {
+		return nil
+	}
+	if input.pusher != nil {
+		err := input.pusher.Push(s.basePath+input.snapshotPath, &http.PushOptions{Method: http.MethodGet, Header: input.pushHeader})
+		if err == nil {
+			snapshotPushes.Inc("push")
+			return nil
+		}
+		s.logger.Debug("Failed to push the snapshot, sending it as an event", "error", err)
+	}
+	snapshotPushes.Inc("event")
+	screen, seq, _ := s.emitter.Screen()
+	return &SnapshotBody{Type: "snapshot", Screen: screen, Seq: seq}
+}
@@ -0,0 +1,131 @@
+package httpapi
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// newPushTestServer returns a server that pushes the snapshot of a screen
+// showing "hello", served with HTTP/2 without TLS.
+func newPushTestServer(t *testing.T) *httptest.Server {
+	ctx, cancel := context.WithCancel(logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil))))
+	t.Cleanup(cancel)
+	srv, _ := newRoutingTestServer(t, ctx, &echoAgent{})
+	srv.EnablePushSnapshot()
+	srv.emitter.UpdateScreenAndEmitChanges("hello")
+	httpSrv := httptest.NewServer(srv.h2cHandler(srv.handler()))
+	t.Cleanup(httpSrv.Close)
+	return httpSrv
+}
+
+func TestPushSnapshotHTTP2(t *testing.T) {
+	httpSrv := newPushTestServer(t)
+
+	// Go's HTTP/2 client doesn't support server push, so the frames are
+	// read directly
+	conn, err := net.Dial("tcp", httpSrv.Listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SetDeadline(time.Now().Add(10*time.Second)))
+	_, err = io.WriteString(conn, http2.ClientPreface)
+	require.NoError(t, err)
+	framer := http2.NewFramer(conn, conn)
+	require.NoError(t, framer.WriteSettings(http2.Setting{ID: http2.SettingEnablePush, Val: 1}))
+	var headers bytes.Buffer
+	encoder := hpack.NewEncoder(&headers)
+	for _, field := range []hpack.HeaderField{
+		{Name: ":method", Value: http.MethodGet},
+		{Name: ":scheme", Value: "http"},
+		{Name: ":authority", Value: httpSrv.Listener.Addr().String()},
+		{Name: ":path", Value: "/v1/events"},
+	} {
+		require.NoError(t, encoder.WriteField(field))
+	}
+	require.NoError(t, framer.WriteHeaders(http2.HeadersFrameParam{StreamID: 1, BlockFragment: headers.Bytes(), EndStream: true, EndHeaders: true}))
+
+	decoder := hpack.NewDecoder(4096, nil)
+	var pushedPath string
+	var pushedStream uint32
+	var pushed, events bytes.Buffer
+	for pushed.Len() == 0 || !strings.Contains(events.String(), "event: subscribed") {
+		frame, err := framer.ReadFrame()
+		require.NoError(t, err)
+		switch frame := frame.(type) {
+		case *http2.SettingsFrame:
+			if !frame.IsAck() {
+				require.NoError(t, framer.WriteSettingsAck())
+			}
+		case *http2.PushPromiseFrame:
+			require.Zero(t, events.Len(), "the snapshot must be pushed before the first event")
+			fields, err := decoder.DecodeFull(frame.HeaderBlockFragment())
+			require.NoError(t, err)
+			for _, field := range fields {
+				if field.Name == ":path" {
+					pushedPath = field.Value
+				}
+			}
+			pushedStream = frame.PromiseID
+		case *http2.DataFrame:
+			switch frame.StreamID {
+			case 1:
+				require.NotZero(t, pushedStream, "the snapshot must be pushed before the first event")
+				events.Write(frame.Data())
+			case pushedStream:
+				pushed.Write(frame.Data())
+			}
+		}
+	}
+	assert.Equal(t, "/v1/snapshot", pushedPath)
+	var snapshot SnapshotResponse
+	require.NoError(t, json.Unmarshal(pushed.Bytes(), &snapshot.Body))
+	assert.Equal(t, "hello", snapshot.Body.Screen)
+	assert.NotContains(t, events.String(), "event: snapshot", "the pushed snapshot isn't sent again")
+}
+
+func TestPushSnapshotFallback(t *testing.T) {
+	httpSrv := newPushTestServer(t)
+	h2Client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}}
+
+	for name, client := range map[string]*http.Client{
+		"HTTP/1.1": http.DefaultClient,
+		// Go's HTTP/2 client disables server push
+		"HTTP/2 without push": h2Client,
+	} {
+		t.Run(name, func(t *testing.T) {
+			resp, err := client.Get(httpSrv.URL + "/v1/events")
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			if client == h2Client {
+				require.Equal(t, 2, resp.ProtoMajor)
+			}
+			reader := bufio.NewReader(resp.Body)
+			event, _ := nextEvent(t, reader)
+			require.Equal(t, "subscribed", event)
+			event, data := nextEvent(t, reader)
+			require.Equal(t, "snapshot", event)
+			assert.JSONEq(t, `{"type":"snapshot","screen":"hello","seq":1}`, data)
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// maxPushTargets is the number of push targets that can be active at
+	// once.
+	maxPushTargets = 5
+	// pushTargetTimeout is how long delivering a snapshot to a push target
+	// may take.
+	pushTargetTimeout = 30 * time.Second
+)
+
+// PushTarget is a URL the agent's screen is sent to periodically.
+type PushTarget struct {
+	ID           string     `json:"id" doc:"ID of the push target"`
+	URL          string     `json:"url" doc:"URL the snapshots are POSTed to"`
+	IntervalS    int        `json:"interval_s" doc:"Seconds between snapshots"`
+	CreatedAt    time.Time  `json:"created_at" doc:"When the push target was created"`
+	PushedCount  int        `json:"pushed_count" doc:"Number of snapshots delivered"`
+	LastPushedAt *time.Time `json:"last_pushed_at,omitempty" doc:"When the last snapshot was delivered"`
+	LastError    string     `json:"last_error,omitempty" doc:"Why the last snapshot wasn't delivered, if it wasn't"`
+}
+
+type CreatePushTargetRequest struct {
+	Body struct {
+		URL        string `json:"url" minLength:"1" example:"https://dashboard.example.com/api/snapshot" doc:"HTTP or HTTPS URL to POST the snapshots to"`
+		IntervalS  int    `json:"interval_s" minimum:"1" maximum:"86400" example:"10" doc:"Seconds between snapshots"`
+		AuthHeader string `json:"auth_header,omitempty" required:"false" example:"Bearer xyz" doc:"Authorization header sent with the snapshots. It isn't returned by GET /push-targets."`
+	}
+}
+
+type PushTargetResponse struct {
+	Body PushTarget
+}
+
+type PushTargetsResponse struct {
+	Body struct {
+		PushTargets []PushTarget `json:"push_targets" nullable:"false" doc:"Active push targets, oldest first"`
+	}
+}
+
+type DeletePushTargetRequest struct {
+	ID string `path:"id" doc:"ID of the push target"`
+}
+
+type pushTarget struct {
+	PushTarget
+	authHeader string
+	// stop stops pushing snapshots to the target.
+	stop context.CancelFunc
+}
+
+// pushTargetStore holds the push targets, which each push snapshots from
+// their own goroutine.
+type pushTargetStore struct {
+	ctx    context.Context
+	client *http.Client
+
+	mu      sync.Mutex
+	targets []*pushTarget
+}
+
+// EnablePushTargets allows pushing the agent's screen to other services
+// with POST /push-targets, so that they don't have to poll GET /snapshot.
+// The snapshots are sent with client until ctx is done.
+func (s *Server) EnablePushTargets(ctx context.Context, client *http.Client) {
+	s.pushTargets.Store(&pushTargetStore{ctx: ctx, client: client})
+}
+
+func (s *Server) loadPushTargets() (*pushTargetStore, error) {
+	store := s.pushTargets.Load()
+	if store == nil {
+		return nil, huma.Error503ServiceUnavailable("push targets are not enabled")
+	}
+	return store, nil
+}
+
+// createPushTarget handles POST /push-targets
+func (s *Server) createPushTarget(ctx context.Context, input *CreatePushTargetRequest) (*PushTargetResponse, error) {
+	store, err := s.loadPushTargets()
+	if err != nil {
+		return nil, err
+	}
+	body := input.Body
+	u, err := url.Parse(body.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, huma.Error422UnprocessableEntity("url must be an absolute http or https URL")
+	}
+
+	pushCtx, stop := context.WithCancel(store.ctx)
+	target := &pushTarget{
+		PushTarget: PushTarget{
+			ID:        uuid.NewString(),
+			URL:       body.URL,
+			IntervalS: body.IntervalS,
+			CreatedAt: time.Now(),
+		},
+		authHeader: body.AuthHeader,
+		stop:       stop,
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if len(store.targets) >= maxPushTargets {
+		stop()
+		return nil, huma.Error409Conflict(fmt.Sprintf("at most %d push targets can be active", maxPushTargets))
+	}
+	store.targets = append(store.targets, target)
+	go s.runPushTarget(pushCtx, store, target)
+	return &PushTargetResponse{Body: target.PushTarget}, nil
+}
+
+// getPushTargets handles GET /push-targets
+func (s *Server) getPushTargets(ctx context.Context, input *struct{}) (*PushTargetsResponse, error) {
+	store, err := s.loadPushTargets()
+	if err != nil {
+		return nil, err
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	resp := &PushTargetsResponse{}
+	resp.Body.PushTargets = make([]PushTarget, 0, len(store.targets))
+	for _, target := range store.targets {
+		resp.Body.PushTargets = append(resp.Body.PushTargets, target.PushTarget)
+	}
+	return resp, nil
+}
+
+// deletePushTarget handles DELETE /push-targets/{id}
+func (s *Server) deletePushTarget(ctx context.Context, input *DeletePushTargetRequest) (*struct{}, error) {
+	store, err := s.loadPushTargets()
+	if err != nil {
+		return nil, err
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	i := slices.IndexFunc(store.targets, func(target *pushTarget) bool { return target.ID == input.ID })
+	if i < 0 {
+		return nil, huma.Error404NotFound(fmt.Sprintf("push target %s not found", input.ID))
+	}
+	store.targets[i].stop()
+	store.targets = slices.Delete(store.targets, i, i+1)
+	return nil, nil
+}
+
+// runPushTarget pushes a snapshot to the target right away and then every
+// interval, until ctx is done. A snapshot that takes longer than the
+// interval to deliver delays the next one rather than overlapping it.
+func (s *Server) runPushTarget(ctx context.Context, store *pushTargetStore, target *pushTarget) {
+	ticker := time.NewTicker(time.Duration(target.IntervalS) * time.Second)
+	defer ticker.Stop()
+	for {
+		err := s.pushSnapshot(ctx, store.client, target)
+		if ctx.Err() != nil {
+			return
+		}
+		store.mu.Lock()
+		if err != nil {
+			target.LastError = err.Error()
+		} else {
+			now := time.Now()
+			target.PushedCount++
+			target.LastPushedAt = &now
+			target.LastError = ""
+		}
+		store.mu.Unlock()
+		if err != nil {
+			s.logger.Warn("Failed to push snapshot", "push_target", target.ID, "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// pushSnapshot POSTs the body GET /snapshot would return to the target.
+func (s *Server) pushSnapshot(ctx context.Context, client *http.Client, target *pushTarget) error {
+	ctx, cancel := context.WithTimeout(ctx, pushTargetTimeout)
+	defer cancel()
+
+	screen, seq, _ := s.emitter.Screen()
+	var snapshot SnapshotResponse
+	snapshot.Body.Screen = screen
+	snapshot.Body.Seq = seq
+	data, err := json.Marshal(snapshot.Body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target.URL, bytes.NewReader(data))
+	if err != nil {
+		return xerrors.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if target.authHeader != "" {
+		req.Header.Set("Authorization", target.authHeader)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return xerrors.Errorf("failed to push snapshot: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return xerrors.Errorf("push target returned %d: %s", resp.StatusCode, body)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+)
+
+type pushedSnapshot struct {
+	auth string
+	body []byte
+}
+
+func TestPushTargets(t *testing.T) {
+	ctx, cancel := context.WithCancel(logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil))))
+	defer cancel()
+	srv, httpSrv := newRoutingTestServer(t, ctx, &echoAgent{})
+
+	pushed := make(chan pushedSnapshot, 10)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		pushed <- pushedSnapshot{auth: r.Header.Get("Authorization"), body: body}
+	}))
+	defer target.Close()
+	createBody := fmt.Sprintf(`{"url":%q,"interval_s":1,"auth_header":"Bearer xyz"}`, target.URL+"/api/snapshot")
+
+	assert.Equal(t, http.StatusServiceUnavailable, doJSON(t, http.MethodPost, httpSrv.URL+"/v1/push-targets", createBody, nil))
+	srv.EnablePushTargets(ctx, http.DefaultClient)
+
+	srv.emitter.UpdateScreenAndEmitChanges("hello from the agent")
+	var snapshot map[string]any
+	require.Equal(t, http.StatusOK, doJSON(t, http.MethodGet, httpSrv.URL+"/v1/snapshot", "", &snapshot))
+	assert.Equal(t, "hello from the agent", snapshot["screen"])
+	// only huma's responses link to their schema
+	delete(snapshot, "$schema")
+
+	var created PushTarget
+	require.Equal(t, http.StatusCreated, doJSON(t, http.MethodPost, httpSrv.URL+"/v1/push-targets", createBody, &created))
+	assert.Equal(t, target.URL+"/api/snapshot", created.URL)
+	assert.Equal(t, 1, created.IntervalS)
+
+	// the snapshot is pushed right away, and then every interval
+	for range 2 {
+		select {
+		case p := <-pushed:
+			assert.Equal(t, "Bearer xyz", p.auth)
+			var body map[string]any
+			require.NoError(t, json.Unmarshal(p.body, &body))
+			assert.Equal(t, snapshot, body, "the payload matches GET /snapshot")
+		case <-time.After(5 * time.Second):
+			t.Fatal("no snapshot was pushed")
+		}
+	}
+
+	var list PushTargetsResponse
+	require.Equal(t, http.StatusOK, doJSON(t, http.MethodGet, httpSrv.URL+"/v1/push-targets", "", &list.Body))
+	require.Len(t, list.Body.PushTargets, 1)
+	assert.Equal(t, created.ID, list.Body.PushTargets[0].ID)
+	assert.GreaterOrEqual(t, list.Body.PushTargets[0].PushedCount, 1)
+	assert.NotNil(t, list.Body.PushTargets[0].LastPushedAt)
+
+	// the auth header isn't returned
+	data, err := json.Marshal(list.Body)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "xyz")
+
+	assert.Equal(t, http.StatusNoContent, doJSON(t, http.MethodDelete, httpSrv.URL+"/v1/push-targets/"+created.ID, "", nil))
+	assert.Equal(t, http.StatusNotFound, doJSON(t, http.MethodDelete, httpSrv.URL+"/v1/push-targets/"+created.ID, "", nil))
+	// a push may have been in flight
+	time.Sleep(100 * time.Millisecond)
+	for len(pushed) > 0 {
+		<-pushed
+	}
+	time.Sleep(1500 * time.Millisecond)
+	assert.Empty(t, pushed, "snapshots aren't pushed after the push target is deleted")
+}
+
+func TestPushTargetErrors(t *testing.T) {
+	ctx, cancel := context.WithCancel(logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil))))
+	defer cancel()
+	srv, httpSrv := newRoutingTestServer(t, ctx, &echoAgent{})
+	srv.EnablePushTargets(ctx, http.DefaultClient)
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "dashboard is down", http.StatusBadGateway)
+	}))
+	defer failing.Close()
+
+	for _, body := range []string{
+		`{"url":"ftp://dashboard/snapshot","interval_s":10}`,
+		`{"url":"/api/snapshot","interval_s":10}`,
+		fmt.Sprintf(`{"url":%q,"interval_s":0}`, failing.URL),
+	} {
+		assert.Equal(t, http.StatusUnprocessableEntity, doJSON(t, http.MethodPost, httpSrv.URL+"/v1/push-targets", body, nil), body)
+	}
+
+	var created PushTarget
+	for range maxPushTargets {
+		require.Equal(t, http.StatusCreated, doJSON(t, http.MethodPost, httpSrv.URL+"/v1/push-targets", fmt.Sprintf(`{"url":%q,"interval_s":60}`, failing.URL), &created))
+	}
+	assert.Equal(t, http.StatusConflict, doJSON(t, http.MethodPost, httpSrv.URL+"/v1/push-targets", fmt.Sprintf(`{"url":%q,"interval_s":60}`, failing.URL), nil))
+
+	// failed deliveries are reported
+	require.Eventually(t, func() bool {
+		var list PushTargetsResponse
+		doJSON(t, http.MethodGet, httpSrv.URL+"/v1/push-targets", "", &list.Body)
+		return len(list.Body.PushTargets) == maxPushTargets &&
+			list.Body.PushTargets[0].LastError == "push target returned 502: dashboard is down\n" &&
+			list.Body.PushTargets[0].PushedCount == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,73 @@
+package httpapi
+
+import (
+	"context"
+	"sync"
+
+	"golang.org/x/xerrors"
+)
+
+var ErrMessageQueueFull = xerrors.New("message queue is full")
+
+// MessageFailedBody is sent when a queued message couldn't be sent to the
+// agent. POST /message already returned when it was queued.
+type MessageFailedBody struct {
+	Type    string `json:"type" enum:"message_failed" doc:"Always 'message_failed'"`
+	Content string `json:"content" doc:"Content of the message that wasn't sent"`
+	Error   string `json:"error" doc:"Why the message wasn't sent"`
+}
+
+// MessageQueue serializes user messages sent to the agent, so that the input
+// of concurrent requests isn't interleaved in the terminal, and a message sent
+// while the agent is busy waits instead of failing.
+type MessageQueue struct {
+	mu       sync.Mutex
+	messages chan MessageRequestBody
+	// pending is the number of messages that were enqueued but haven't been
+	// fully handled yet, including the one being handled.
+	pending int
+}
+
+// NewMessageQueue creates a queue that holds up to depth messages waiting to
+// be handled.
+func NewMessageQueue(depth int) *MessageQueue {
+	return &MessageQueue{
+		messages: make(chan MessageRequestBody, depth),
+	}
+}
+
+// Enqueue adds a message to the queue and returns its position, where 1
+// means it's handled next. It returns ErrMessageQueueFull if the queue is full.
+func (q *MessageQueue) Enqueue(message MessageRequestBody) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	select {
+	case q.messages <- message:
+		q.pending++
+		return q.pending, nil
+	default:
+		return 0, ErrMessageQueueFull
+	}
+}
+
+// Len returns the number of messages that haven't been fully handled yet.
+func (q *MessageQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.pending
+}
+
+// Run handles the queued messages one at a time until the context is done.
+func (q *MessageQueue) Run(ctx context.Context, handle func(ctx context.Context, message MessageRequestBody)) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case message := <-q.messages:
+			handle(ctx, message)
+			q.mu.Lock()
+			q.pending--
+			q.mu.Unlock()
+		}
+	}
+}
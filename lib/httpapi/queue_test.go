@@ -0,0 +1,168 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	mf "github.com/zohaibahmed/clauder/lib/msgfmt"
+	st "github.com/zohaibahmed/clauder/lib/screentracker"
+)
+
+func TestMessageQueueOrdering(t *testing.T) {
+	ctx, cancel := context.WithCancel(logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(os.Stdout, nil))))
+	defer cancel()
+	srv := NewServer(ctx, mf.AgentTypeCustom, nil, 0, "/chat")
+	agent := &echoAgent{}
+	srv.conversation = st.NewConversation(ctx, st.ConversationConfig{
+		AgentIO:               agent,
+		GetTime:               time.Now,
+		SnapshotInterval:      time.Millisecond,
+		ScreenStabilityLength: 2 * time.Millisecond,
+	})
+	srv.conversation.StartSnapshotLoop(ctx)
+	srv.EnableMessageQueue(ctx, 10)
+
+	const count = 3
+	positions := make([]int, count)
+	var wg sync.WaitGroup
+	for i := range count {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := srv.createMessage(ctx, &MessageRequest{Body: MessageRequestBody{
+				Type:    MessageTypeUser,
+				Content: fmt.Sprintf("queued message %d", i),
+			}})
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.True(t, resp.Body.Ok)
+			assert.True(t, resp.Body.Queued)
+			positions[i] = resp.Body.Position
+		}()
+	}
+	wg.Wait()
+	assert.ElementsMatch(t, []int{1, 2, 3}, positions)
+
+	// the agent is running until the queued messages were answered, so
+	// that clients polling GET /status wait for the responses
+	status, err := srv.getStatus(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, AgentStatusRunning, status.Body.Status)
+	require.Eventually(t, func() bool {
+		return srv.messageQueue.Load().Len() == 0
+	}, 20*time.Second, 50*time.Millisecond)
+	require.Eventually(t, func() bool {
+		status, err := srv.getStatus(ctx, nil)
+		return err == nil && status.Body.Status == AgentStatusStable
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// messages are sent in the order of their positions, without interleaving
+	var expected []string
+	for position := 1; position <= count; position++ {
+		for i, p := range positions {
+			if p == position {
+				expected = append(expected, fmt.Sprintf("queued message %d", i))
+			}
+		}
+	}
+	var sent []string
+	for _, msg := range srv.conversation.Messages() {
+		if msg.Role == st.ConversationRoleUser {
+			sent = append(sent, msg.Message)
+		}
+	}
+	assert.Equal(t, expected, sent)
+	screen := agent.ReadScreen()
+	for i := 1; i < count; i++ {
+		assert.Less(t, strings.Index(screen, expected[i-1]), strings.Index(screen, expected[i]))
+	}
+}
+
+func TestMessageQueueFull(t *testing.T) {
+	ctx, cancel := context.WithCancel(logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(os.Stdout, nil))))
+	defer cancel()
+	// The conversation never becomes stable without snapshots, so the
+	// dispatcher is stuck waiting to send the first message.
+	srv := NewServer(ctx, mf.AgentTypeCustom, nil, 0, "/chat")
+	srv.EnableMessageQueue(ctx, 1)
+
+	send := func(content string) (*MessageResponse, error) {
+		return srv.createMessage(ctx, &MessageRequest{Body: MessageRequestBody{Type: MessageTypeUser, Content: content}})
+	}
+
+	resp, err := send("the first message")
+	require.NoError(t, err)
+	assert.Equal(t, 1, resp.Body.Position)
+	require.Eventually(t, func() bool {
+		return len(srv.messageQueue.Load().messages) == 0
+	}, 5*time.Second, 10*time.Millisecond, "the dispatcher should dequeue the first message")
+
+	resp, err = send("the second message")
+	require.NoError(t, err)
+	assert.Equal(t, 2, resp.Body.Position)
+
+	_, err = send("the third message")
+	var statusErr huma.StatusError
+	require.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, http.StatusServiceUnavailable, statusErr.GetStatus())
+
+	// invalid messages are still rejected right away
+	_, err = send("hi")
+	require.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, http.StatusUnprocessableEntity, statusErr.GetStatus())
+}
+
+// brokenAgent is an agent whose terminal can't be written to.
+type brokenAgent struct{}
+
+func (brokenAgent) Write([]byte) (int, error) { return 0, errors.New("terminal closed") }
+func (brokenAgent) ReadScreen() string        { return "> " }
+
+func TestMessageQueueDispatchFailure(t *testing.T) {
+	ctx, cancel := context.WithCancel(logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil))))
+	defer cancel()
+	srv := NewServer(ctx, mf.AgentTypeCustom, nil, 0, "/chat")
+	srv.conversation = st.NewConversation(ctx, st.ConversationConfig{
+		AgentIO:               brokenAgent{},
+		GetTime:               time.Now,
+		SnapshotInterval:      time.Millisecond,
+		ScreenStabilityLength: 2 * time.Millisecond,
+	})
+	srv.conversation.StartSnapshotLoop(ctx)
+	_, ch, _ := srv.emitter.Subscribe()
+	srv.EnableMessageQueue(ctx, 10)
+
+	resp, err := srv.createMessage(ctx, &MessageRequest{Body: MessageRequestBody{Type: MessageTypeUser, Content: "a queued message"}})
+	require.NoError(t, err)
+	assert.True(t, resp.Body.Queued)
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event := <-ch:
+			if event.Type != EventTypeMessageFailed {
+				continue
+			}
+			body := event.Payload.(MessageFailedBody)
+			assert.Equal(t, "message_failed", body.Type)
+			assert.Equal(t, "a queued message", body.Content)
+			assert.Contains(t, body.Error, "terminal closed")
+			return
+		case <-timeout:
+			t.Fatal("no message_failed event")
+		}
+	}
+}
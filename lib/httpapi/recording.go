@@ -0,0 +1,191 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
+)
+
+// maxCastFileSize is the size of the largest recording that can be
+// converted.
+const maxCastFileSize = 10 << 20
+
+// maxGIFJobs is how many recordings are converted at once. Each
+// conversion reads the whole recording, so more jobs are rejected rather
+// than queued.
+const maxGIFJobs = 2
+
+// gifJobTTL is how long the result of a conversion is kept once it's done.
+const gifJobTTL = 15 * time.Minute
+
+type CreateGIFRequest struct {
+	Body struct {
+		File string `json:"file" doc:"Name of an asciinema v2 recording (.cast file) in the server's recordings directory"`
+	}
+}
+
+type CreateGIFResponse struct {
+	Body struct {
+		JobID string `json:"job_id" doc:"ID of the conversion job. Poll GET /recording/gif/{job_id} for the result."`
+	}
+}
+
+type GetGIFRequest struct {
+	JobID string `path:"job_id" doc:"ID of the conversion job"`
+}
+
+type GetGIFResponse struct {
+	Status      int
+	ContentType string `header:"Content-Type"`
+	Body        []byte
+}
+
+type gifJobStatus string
+
+const (
+	gifJobProcessing gifJobStatus = "processing"
+	gifJobDone       gifJobStatus = "done"
+	gifJobFailed     gifJobStatus = "failed"
+)
+
+type gifJob struct {
+	status   gifJobStatus
+	gif      []byte
+	err      error
+	finished time.Time
+}
+
+// gifJobs holds the conversion jobs. Finished jobs are removed after
+// gifJobTTL.
+type gifJobs struct {
+	mu   sync.Mutex
+	jobs map[string]*gifJob
+	// slots holds a value for each job that's processing.
+	slots chan struct{}
+}
+
+// EnableRecordingExport allows converting the asciinema recordings in dir to
+// animated GIFs with POST /recording/gif.
+func (s *Server) EnableRecordingExport(dir string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recordingsDir = dir
+	s.gifJobs = &gifJobs{jobs: make(map[string]*gifJob), slots: make(chan struct{}, maxGIFJobs)}
+}
+
+// start converts the recording at path in the background, and returns the
+// job's ID. It returns false if maxGIFJobs jobs are already processing.
+func (j *gifJobs) start(path string) (string, bool) {
+	select {
+	case j.slots <- struct{}{}:
+	default:
+		return "", false
+	}
+	id := uuid.NewString()
+	job := &gifJob{status: gifJobProcessing}
+	j.mu.Lock()
+	for jobId, other := range j.jobs {
+		if other.status != gifJobProcessing && time.Since(other.finished) > gifJobTTL {
+			delete(j.jobs, jobId)
+		}
+	}
+	j.jobs[id] = job
+	j.mu.Unlock()
+
+	go func() {
+		defer func() { <-j.slots }()
+		var out bytes.Buffer
+		err := func() error {
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			return renderCastGIF(f, &out)
+		}()
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		job.finished = time.Now()
+		if err != nil {
+			job.status, job.err = gifJobFailed, err
+			return
+		}
+		job.status, job.gif = gifJobDone, out.Bytes()
+	}()
+	return id, true
+}
+
+// get returns a copy of the job with the given ID.
+func (j *gifJobs) get(id string) (gifJob, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	job, ok := j.jobs[id]
+	if !ok {
+		return gifJob{}, false
+	}
+	return *job, true
+}
+
+// createGIF handles POST /recording/gif
+func (s *Server) createGIF(ctx context.Context, input *CreateGIFRequest) (*CreateGIFResponse, error) {
+	s.mu.RLock()
+	dir, jobs := s.recordingsDir, s.gifJobs
+	s.mu.RUnlock()
+	if jobs == nil {
+		return nil, huma.Error503ServiceUnavailable("recording export is not enabled")
+	}
+	name := input.Body.File
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") || filepath.Ext(name) != ".cast" {
+		return nil, huma.Error400BadRequest(fmt.Sprintf("invalid recording %q, expected the name of a .cast file", name))
+	}
+	path := filepath.Join(dir, name)
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return nil, huma.Error404NotFound(fmt.Sprintf("recording %s not found", name))
+	}
+	if info.Size() > maxCastFileSize {
+		return nil, huma.Error422UnprocessableEntity(fmt.Sprintf("recording %s is larger than %d MB", name, maxCastFileSize>>20))
+	}
+	id, ok := jobs.start(path)
+	if !ok {
+		return nil, huma.Error429TooManyRequests(fmt.Sprintf("%d recordings are already being converted, try again later", maxGIFJobs))
+	}
+	resp := &CreateGIFResponse{}
+	resp.Body.JobID = id
+	return resp, nil
+}
+
+// getGIF handles GET /recording/gif/{job_id}
+func (s *Server) getGIF(ctx context.Context, input *GetGIFRequest) (*GetGIFResponse, error) {
+	s.mu.RLock()
+	jobs := s.gifJobs
+	s.mu.RUnlock()
+	if jobs == nil {
+		return nil, huma.Error503ServiceUnavailable("recording export is not enabled")
+	}
+	job, ok := jobs.get(input.JobID)
+	if !ok {
+		return nil, huma.Error404NotFound(fmt.Sprintf("job %s not found", input.JobID))
+	}
+	switch job.status {
+	case gifJobFailed:
+		return nil, huma.Error422UnprocessableEntity("failed to convert recording", job.err)
+	case gifJobProcessing:
+		body, err := json.Marshal(map[string]string{"job_id": input.JobID, "status": string(job.status)})
+		if err != nil {
+			return nil, err
+		}
+		return &GetGIFResponse{Status: http.StatusAccepted, ContentType: "application/json", Body: body}, nil
+	}
+	return &GetGIFResponse{Status: http.StatusOK, ContentType: "image/gif", Body: job.gif}, nil
+}
@@ -0,0 +1,194 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image/gif"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	mf "github.com/zohaibahmed/clauder/lib/msgfmt"
+)
+
+func TestRenderCastGIF(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "two-frames.cast"))
+	require.NoError(t, err)
+	defer f.Close()
+	var out bytes.Buffer
+	require.NoError(t, renderCastGIF(f, &out))
+
+	assert.Contains(t, []string{"GIF87a", "GIF89a"}, out.String()[:6])
+	anim, err := gif.DecodeAll(bytes.NewReader(out.Bytes()))
+	require.NoError(t, err)
+	require.Len(t, anim.Image, 2, "the input event isn't a frame")
+	assert.Equal(t, []int{100, gifLastFrameDelay}, anim.Delay, "the first frame lasts until the second event")
+	assert.Equal(t, 20*gifCellWidth, anim.Config.Width)
+	assert.Equal(t, 4*gifCellHeight, anim.Config.Height)
+
+	// the first frame has the prompt on the first line only
+	first, second := anim.Image[0], anim.Image[1]
+	assert.Equal(t, uint8(gifDefaultBG), first.ColorIndexAt(0, 0))
+	assert.True(t, cellHasColor(first, 0, 0, gifDefaultFG), "$ is drawn")
+	assert.False(t, cellHasColor(first, 0, 1, gifDefaultFG))
+	// the second frame has hi in green and a box drawing on the second line
+	assert.True(t, cellHasColor(second, 0, 1, 2))
+	assert.True(t, cellHasColor(second, 4, 1, gifDefaultFG), "─ is drawn")
+}
+
+// cellHasColor reports whether any pixel of the cell at column x and row y
+// has the palette color index.
+func cellHasColor(img interface{ ColorIndexAt(x, y int) uint8 }, x, y int, index uint8) bool {
+	for py := y * gifCellHeight; py < (y+1)*gifCellHeight; py++ {
+		for px := x * gifCellWidth; px < (x+1)*gifCellWidth; px++ {
+			if img.ColorIndexAt(px, py) == index {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func TestRenderCastGIFLimits(t *testing.T) {
+	var cast strings.Builder
+	cast.WriteString(`{"version": 2, "width": 200, "height": 60}` + "\n")
+	for i := range 120 {
+		fmt.Fprintf(&cast, "[%d.0, \"o\", \"line %d\\r\\n\"]\n", i, i)
+	}
+	var out bytes.Buffer
+	require.NoError(t, renderCastGIF(strings.NewReader(cast.String()), &out))
+	anim, err := gif.DecodeAll(&out)
+	require.NoError(t, err)
+	assert.Len(t, anim.Image, gifMaxFrames)
+	assert.Equal(t, gifMaxWidth, anim.Config.Width)
+	assert.Equal(t, gifMaxHeight, anim.Config.Height)
+}
+
+func TestParseCastErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		cast string
+		want string
+	}{
+		{"empty", "", "recording is empty"},
+		{"version 1", `{"version": 1, "width": 80, "height": 24}`, "unsupported asciicast version 1"},
+		{"no size", `{"version": 2}`, "invalid terminal size 0x0"},
+		{"invalid event", `{"version": 2, "width": 80, "height": 24}` + "\n[1.0, \"o\"]", "line 2: invalid event"},
+		{"no output", `{"version": 2, "width": 80, "height": 24}` + "\n[1.0, \"i\", \"q\"]", "recording has no output events"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := parseCast(strings.NewReader(tc.cast))
+			assert.ErrorContains(t, err, tc.want)
+		})
+	}
+}
+
+func TestRecordingGIFJobs(t *testing.T) {
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	srv := NewServer(ctx, mf.AgentTypeClaude, nil, 0, "/chat")
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		srv.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodPost, "/v1/recording/gif", `{"file": "two-frames.cast"}`)
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	srv.EnableRecordingExport("testdata")
+	for _, file := range []string{"../server.go", "two-frames.txt", ".cast"} {
+		rec = do(http.MethodPost, "/v1/recording/gif", fmt.Sprintf(`{"file": %q}`, file))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, file)
+	}
+	rec = do(http.MethodPost, "/v1/recording/gif", `{"file": "missing.cast"}`)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = do(http.MethodGet, "/v1/recording/gif/unknown", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = do(http.MethodPost, "/v1/recording/gif", `{"file": "two-frames.cast"}`)
+	require.Equal(t, http.StatusAccepted, rec.Code, rec.Body.String())
+	var created struct {
+		JobID string `json:"job_id"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	require.NotEmpty(t, created.JobID)
+
+	require.Eventually(t, func() bool {
+		rec = do(http.MethodGet, "/v1/recording/gif/"+created.JobID, "")
+		if rec.Code == http.StatusAccepted {
+			assert.Contains(t, rec.Body.String(), `"status":"processing"`)
+		}
+		return rec.Code != http.StatusAccepted
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, "image/gif", rec.Header().Get("Content-Type"))
+	assert.True(t, bytes.HasPrefix(rec.Body.Bytes(), []byte("GIF89a")))
+	_, err := gif.DecodeAll(rec.Body)
+	require.NoError(t, err)
+}
+
+func TestRecordingGIFJobFailure(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bad.cast"), []byte(`{"version": 1}`), 0o600))
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	srv := NewServer(ctx, mf.AgentTypeClaude, nil, 0, "/chat")
+	srv.EnableRecordingExport(dir)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/recording/gif", strings.NewReader(`{"file": "bad.cast"}`))
+	req.Header.Set("Content-Type", "application/json")
+	srv.router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	var created struct {
+		JobID string `json:"job_id"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+
+	require.Eventually(t, func() bool {
+		rec = httptest.NewRecorder()
+		srv.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/recording/gif/"+created.JobID, nil))
+		return rec.Code != http.StatusAccepted
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Contains(t, rec.Body.String(), "unsupported asciicast version 1")
+}
+
+func TestRecordingGIFJobLimit(t *testing.T) {
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	srv := NewServer(ctx, mf.AgentTypeClaude, nil, 0, "/chat")
+	srv.EnableRecordingExport("testdata")
+	do := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/v1/recording/gif", strings.NewReader(`{"file": "two-frames.cast"}`))
+		req.Header.Set("Content-Type", "application/json")
+		srv.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// the jobs that are processing hold all the slots
+	for range maxGIFJobs {
+		srv.gifJobs.slots <- struct{}{}
+	}
+	rec := do()
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Empty(t, srv.gifJobs.jobs)
+
+	<-srv.gifJobs.slots
+	rec = do()
+	require.Equal(t, http.StatusAccepted, rec.Code, rec.Body.String())
+	// the slot is released once the job is done
+	require.Eventually(t, func() bool { return len(srv.gifJobs.slots) == maxGIFJobs-1 }, 5*time.Second, 10*time.Millisecond)
+}
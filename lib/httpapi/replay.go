@@ -0,0 +1,153 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	mf "github.com/zohaibahmed/clauder/lib/msgfmt"
+	st "github.com/zohaibahmed/clauder/lib/screentracker"
+	"golang.org/x/xerrors"
+)
+
+// ReplayMessage is a message of a saved conversation.
+type ReplayMessage struct {
+	Role    st.ConversationRole `json:"role" enum:"user,agent" doc:"'user' messages are sent to the agent, 'agent' messages are skipped"`
+	Content string              `json:"content" doc:"Content of the message"`
+	Ts      *time.Time          `json:"ts,omitempty" required:"false" doc:"When the message was sent. It's ignored."`
+}
+
+type ReplayRequest struct {
+	DryRun  bool  `query:"dry_run" doc:"Only validate the conversation, without sending it"`
+	DelayMs int64 `query:"delay_ms" minimum:"0" maximum:"60000" default:"1000" doc:"Milliseconds to wait between the replayed messages once the agent finished responding to the previous one"`
+	Body    []ReplayMessage
+}
+
+type ReplayResponse struct {
+	Status int
+	Body   struct {
+		Messages int  `json:"messages" doc:"Number of user messages that are replayed"`
+		DryRun   bool `json:"dry_run" doc:"Whether the conversation was only validated"`
+	}
+}
+
+// ReplayProgressBody is sent once the agent finished responding to a
+// replayed message.
+type ReplayProgressBody struct {
+	Type  string `json:"type" enum:"replay_progress" doc:"Always 'replay_progress'"`
+	Sent  int    `json:"sent" doc:"Number of user messages that were replayed so far"`
+	Total int    `json:"total" doc:"Number of user messages to replay"`
+}
+
+// ReplayCompleteBody is sent when a replay ends.
+type ReplayCompleteBody struct {
+	Type  string `json:"type" enum:"replay_complete" doc:"Always 'replay_complete'"`
+	Sent  int    `json:"sent" doc:"Number of user messages that were replayed"`
+	Total int    `json:"total" doc:"Number of user messages to replay"`
+	Error string `json:"error,omitempty" doc:"Why the replay stopped before all the messages were sent"`
+}
+
+// replayer replays saved conversations to the agent, one at a time.
+type replayer struct {
+	ctx     context.Context
+	running atomic.Bool
+}
+
+// EnableReplay allows replaying saved conversations to the agent with
+// POST /replay, e.g. to check how it responds after a fix. Replays stop
+// when ctx is done.
+func (s *Server) EnableReplay(ctx context.Context) {
+	s.replayer.Store(&replayer{ctx: ctx})
+}
+
+// validateReplay returns the user messages of a saved conversation, or a
+// 422 error if one of them can't be sent to the agent.
+func (s *Server) validateReplay(conversation []ReplayMessage) ([]string, error) {
+	var messages []string
+	for i, message := range conversation {
+		if message.Role != st.ConversationRoleUser {
+			continue
+		}
+		if err := mf.Validate(s.agentType, message.Content); err != nil {
+			var validationErr *mf.ValidationError
+			if errors.As(err, &validationErr) {
+				return nil, huma.Error422UnprocessableEntity(fmt.Sprintf("message %d: %s", i+1, validationErr.Error()), &huma.ErrorDetail{
+					Location: fmt.Sprintf("body[%d].content", i),
+					Message:  validationErr.Detail,
+					Value:    validationErr.Kind,
+				})
+			}
+			return nil, xerrors.Errorf("failed to validate message %d: %w", i+1, err)
+		}
+		messages = append(messages, message.Content)
+	}
+	if len(messages) == 0 {
+		return nil, huma.Error422UnprocessableEntity("the conversation has no user messages")
+	}
+	return messages, nil
+}
+
+// replayConversation handles POST /replay
+func (s *Server) replayConversation(ctx context.Context, input *ReplayRequest) (*ReplayResponse, error) {
+	r := s.replayer.Load()
+	if r == nil {
+		return nil, huma.Error503ServiceUnavailable("replay is not enabled")
+	}
+	messages, err := s.validateReplay(input.Body)
+	if err != nil {
+		return nil, err
+	}
+	resp := &ReplayResponse{Status: http.StatusOK}
+	resp.Body.Messages = len(messages)
+	resp.Body.DryRun = input.DryRun
+	if input.DryRun {
+		return resp, nil
+	}
+	if !r.running.CompareAndSwap(false, true) {
+		return nil, huma.Error409Conflict("a conversation is already being replayed")
+	}
+	go func() {
+		defer r.running.Store(false)
+		s.replayMessagesToAgent(r.ctx, messages, time.Duration(input.DelayMs)*time.Millisecond)
+	}()
+	resp.Status = http.StatusAccepted
+	return resp, nil
+}
+
+// replayMessagesToAgent sends messages to the agent one at a time, each
+// once it finished responding to the previous one and delay passed, and
+// reports the progress to the subscribers of the events.
+func (s *Server) replayMessagesToAgent(ctx context.Context, messages []string, delay time.Duration) {
+	complete := ReplayCompleteBody{Type: "replay_complete", Total: len(messages)}
+	defer func() { s.emitter.EmitReplayComplete(complete) }()
+	for i, message := range messages {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				complete.Error = "the server is shutting down"
+				return
+			case <-time.After(delay):
+			}
+		}
+		if err := s.waitForStableStatus(ctx); err != nil {
+			complete.Error = "the server is shutting down"
+			return
+		}
+		if _, err := s.sendMessage(ctx, &MessageRequest{Body: MessageRequestBody{Type: MessageTypeUser, Content: message}}); err != nil {
+			s.logger.Error("Failed to replay message", "message", i+1, "error", err)
+			complete.Error = fmt.Sprintf("failed to send message %d: %s", i+1, err)
+			return
+		}
+		if err := s.waitForStableStatus(ctx); err != nil {
+			complete.Error = "the server is shutting down"
+			return
+		}
+		complete.Sent++
+		s.emitter.EmitReplayProgress(complete.Sent, complete.Total)
+	}
+	s.logger.Info("Replayed the conversation", "messages", len(messages))
+}
@@ -0,0 +1,66 @@
+package httpapi
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+)
+
+func TestReplay(t *testing.T) {
+	ctx, cancel := context.WithCancel(logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil))))
+	defer cancel()
+	srv, httpSrv := newRoutingTestServer(t, ctx, &echoAgent{})
+	conversation, err := os.ReadFile("testdata/conversation.json")
+	require.NoError(t, err)
+
+	var disabled ReplayResponse
+	assert.Equal(t, http.StatusServiceUnavailable, doJSON(t, http.MethodPost, httpSrv.URL+"/v1/replay", string(conversation), &disabled.Body))
+	srv.EnableReplay(ctx)
+
+	for name, body := range map[string]string{
+		"invalid message": `[{"role":"user","content":"hi"}]`,
+		"invalid role":    `[{"role":"system","content":"You are a helpful assistant"}]`,
+		"no user message": `[{"role":"agent","content":"Nothing to see here"}]`,
+	} {
+		assert.Equal(t, http.StatusUnprocessableEntity, doJSON(t, http.MethodPost, httpSrv.URL+"/v1/replay", body, nil), name)
+	}
+
+	var dryRun ReplayResponse
+	require.Equal(t, http.StatusOK, doJSON(t, http.MethodPost, httpSrv.URL+"/v1/replay?dry_run=true", string(conversation), &dryRun.Body))
+	assert.Equal(t, 2, dryRun.Body.Messages)
+	assert.True(t, dryRun.Body.DryRun)
+	assert.Empty(t, userMessages(srv), "a dry run doesn't send anything")
+
+	resp, err := http.Get(httpSrv.URL + "/v1/events?topics=replay_progress,replay_complete")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+	name, _ := nextEvent(t, reader)
+	require.Equal(t, "subscribed", name)
+
+	var replay ReplayResponse
+	require.Equal(t, http.StatusAccepted, doJSON(t, http.MethodPost, httpSrv.URL+"/v1/replay?delay_ms=0", string(conversation), &replay.Body))
+	assert.Equal(t, 2, replay.Body.Messages)
+	assert.Equal(t, http.StatusConflict, doJSON(t, http.MethodPost, httpSrv.URL+"/v1/replay", string(conversation), nil), "one conversation is replayed at a time")
+
+	for _, expected := range []struct{ name, data string }{
+		{"replay_progress", `{"type":"replay_progress","sent":1,"total":2}`},
+		{"replay_progress", `{"type":"replay_progress","sent":2,"total":2}`},
+		{"replay_complete", `{"type":"replay_complete","sent":2,"total":2}`},
+	} {
+		name, data := nextEvent(t, reader)
+		require.Equal(t, expected.name, name)
+		assert.JSONEq(t, expected.data, data)
+	}
+	assert.Equal(t, []string{"List the files in this directory", "Now explain what main.go does"}, userMessages(srv))
+	assert.True(t, strings.Contains(srv.conversation.Screen(), "Now explain what main.go does"), "the agent echoed the messages")
+}
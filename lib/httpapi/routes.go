@@ -0,0 +1,301 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
+	st "github.com/zohaibahmed/clauder/lib/screentracker"
+	"golang.org/x/xerrors"
+)
+
+// maxRoutes is the number of routes that can be active at once. Routes
+// between sessions can form cycles, which this bounds.
+const maxRoutes = 5
+
+// RouteSession is a clauder server messages are routed to.
+type RouteSession struct {
+	URL   string
+	Token string
+}
+
+// RouteSessionResolver returns the server of a session ID.
+type RouteSessionResolver func(ctx context.Context, sessionID string) (RouteSession, error)
+
+// Route sends the output of the agent to another session.
+type Route struct {
+	ID             string    `json:"id" doc:"ID of the route"`
+	SrcSessionID   string    `json:"src_session_id,omitempty" doc:"Empty, the agent of this server is the source"`
+	DstSessionID   string    `json:"dst_session_id" doc:"Session the output is sent to"`
+	TriggerPattern string    `json:"trigger_pattern" doc:"Regular expression the agent's response must match to be routed"`
+	ExtractRegex   string    `json:"extract_regex,omitempty" doc:"Regular expression extracting the part of the response that's sent. Its first group is sent if it has one, and the whole match otherwise."`
+	Template       string    `json:"template,omitempty" doc:"Template of the destination server the output is wrapped in"`
+	CreatedAt      time.Time `json:"created_at" doc:"When the route was created"`
+	RoutedCount    int       `json:"routed_count" doc:"Number of messages sent to the destination"`
+	LastError      string    `json:"last_error,omitempty" doc:"Why the last response that matched the trigger wasn't sent, if it wasn't"`
+}
+
+type CreateRouteRequest struct {
+	Body struct {
+		SrcSessionID   string `json:"src_session_id,omitempty" required:"false" doc:"Must be empty: routes watch the agent of the server they're created on, so create the route on the source session's server"`
+		DstSessionID   string `json:"dst_session_id" minLength:"1" example:"https://abcd.trycloudflare.com" doc:"Session to send the output to: the URL of a clauder server, or the passcode of a session registered with the coordinator"`
+		TriggerPattern string `json:"trigger_pattern" minLength:"1" example:"Done: .*" doc:"Regular expression (RE2 syntax) the agent's response must match to be routed"`
+		ExtractRegex   string `json:"extract_regex,omitempty" required:"false" doc:"Regular expression extracting the part of the response to send. Its first group is sent if it has one, and the whole match otherwise. Defaults to the whole response."`
+		Template       string `json:"template,omitempty" required:"false" pattern:"^[A-Za-z0-9_]*$" maxLength:"64" doc:"Name of a template of the destination server to wrap the output in, see POST /templates"`
+	}
+}
+
+type RouteResponse struct {
+	Body Route
+}
+
+type RoutesResponse struct {
+	Body struct {
+		Routes []Route `json:"routes" nullable:"false" doc:"Active routes, oldest first"`
+	}
+}
+
+type DeleteRouteRequest struct {
+	ID string `path:"id" doc:"ID of the route"`
+}
+
+type messageRoute struct {
+	Route
+	trigger *regexp.Regexp
+	extract *regexp.Regexp
+	// afterMessageId is the ID of the last message when the route was
+	// created. Only later responses are routed.
+	afterMessageId int
+}
+
+// messageRouter holds the routes, and watches the agent's responses while
+// there are any.
+type messageRouter struct {
+	ctx     context.Context
+	resolve RouteSessionResolver
+	client  *http.Client
+
+	mu     sync.Mutex
+	routes []*messageRoute
+	// stopWatching stops watching the responses. It's nil while there are
+	// no routes.
+	stopWatching context.CancelFunc
+	// lastMessageId is the ID of the last response that was checked.
+	lastMessageId int
+}
+
+// EnableMessageRouting allows routing the agent's responses to other
+// sessions with POST /routes. Destination session IDs are resolved with
+// resolve, and the messages are sent with client.
+func (s *Server) EnableMessageRouting(ctx context.Context, resolve RouteSessionResolver, client *http.Client) {
+	s.messageRoutes.Store(&messageRouter{ctx: ctx, resolve: resolve, client: client, lastMessageId: -1})
+}
+
+func (s *Server) loadMessageRouter() (*messageRouter, error) {
+	router := s.messageRoutes.Load()
+	if router == nil {
+		return nil, huma.Error503ServiceUnavailable("message routing is not enabled")
+	}
+	return router, nil
+}
+
+// lastMessageId returns the ID of the last message in the conversation, or
+// -1 if there are none.
+func lastMessageId(messages []st.ConversationMessage) int {
+	if len(messages) == 0 {
+		return -1
+	}
+	return messages[len(messages)-1].Id
+}
+
+// createRoute handles POST /routes
+func (s *Server) createRoute(ctx context.Context, input *CreateRouteRequest) (*RouteResponse, error) {
+	router, err := s.loadMessageRouter()
+	if err != nil {
+		return nil, err
+	}
+	body := input.Body
+	if body.SrcSessionID != "" {
+		return nil, huma.Error422UnprocessableEntity("src_session_id must be empty: routes watch the agent of the server they're created on")
+	}
+	trigger, err := regexp.Compile(body.TriggerPattern)
+	if err != nil {
+		return nil, huma.Error422UnprocessableEntity(fmt.Sprintf("invalid trigger_pattern: %v", err))
+	}
+	var extract *regexp.Regexp
+	if body.ExtractRegex != "" {
+		if extract, err = regexp.Compile(body.ExtractRegex); err != nil {
+			return nil, huma.Error422UnprocessableEntity(fmt.Sprintf("invalid extract_regex: %v", err))
+		}
+	}
+	if _, err := router.resolve(ctx, body.DstSessionID); err != nil {
+		return nil, huma.Error422UnprocessableEntity(fmt.Sprintf("invalid dst_session_id: %v", err))
+	}
+
+	route := &messageRoute{
+		Route: Route{
+			ID:             uuid.NewString(),
+			DstSessionID:   body.DstSessionID,
+			TriggerPattern: body.TriggerPattern,
+			ExtractRegex:   body.ExtractRegex,
+			Template:       body.Template,
+			CreatedAt:      time.Now(),
+		},
+		trigger:        trigger,
+		extract:        extract,
+		afterMessageId: lastMessageId(s.messages()),
+	}
+	router.mu.Lock()
+	defer router.mu.Unlock()
+	if len(router.routes) >= maxRoutes {
+		return nil, huma.Error409Conflict(fmt.Sprintf("at most %d routes can be active", maxRoutes))
+	}
+	router.routes = append(router.routes, route)
+	if router.stopWatching == nil {
+		watchCtx, cancel := context.WithCancel(router.ctx)
+		router.stopWatching = cancel
+		go s.watchTaskCompletions(watchCtx, func(time.Duration) {
+			// sending waits for the destination agent, which must not hold
+			// up the events
+			go s.routeResponse(watchCtx, router)
+		})
+	}
+	return &RouteResponse{Body: route.Route}, nil
+}
+
+// getRoutes handles GET /routes
+func (s *Server) getRoutes(ctx context.Context, input *struct{}) (*RoutesResponse, error) {
+	router, err := s.loadMessageRouter()
+	if err != nil {
+		return nil, err
+	}
+	router.mu.Lock()
+	defer router.mu.Unlock()
+	resp := &RoutesResponse{}
+	resp.Body.Routes = make([]Route, 0, len(router.routes))
+	for _, route := range router.routes {
+		resp.Body.Routes = append(resp.Body.Routes, route.Route)
+	}
+	return resp, nil
+}
+
+// deleteRoute handles DELETE /routes/{id}
+func (s *Server) deleteRoute(ctx context.Context, input *DeleteRouteRequest) (*struct{}, error) {
+	router, err := s.loadMessageRouter()
+	if err != nil {
+		return nil, err
+	}
+	router.mu.Lock()
+	defer router.mu.Unlock()
+	i := slices.IndexFunc(router.routes, func(route *messageRoute) bool { return route.ID == input.ID })
+	if i < 0 {
+		return nil, huma.Error404NotFound(fmt.Sprintf("route %s not found", input.ID))
+	}
+	router.routes = slices.Delete(router.routes, i, i+1)
+	if len(router.routes) == 0 {
+		router.stopWatching()
+		router.stopWatching = nil
+	}
+	return nil, nil
+}
+
+// routeResponse sends the agent's last response through the routes whose
+// trigger it matches, once the agent finished it.
+func (s *Server) routeResponse(ctx context.Context, router *messageRouter) {
+	messages := s.messages()
+	if len(messages) == 0 {
+		return
+	}
+	response := messages[len(messages)-1]
+	router.mu.Lock()
+	if response.Role != st.ConversationRoleAgent || response.Id <= router.lastMessageId {
+		router.mu.Unlock()
+		return
+	}
+	router.lastMessageId = response.Id
+	var matched []*messageRoute
+	for _, route := range router.routes {
+		if response.Id > route.afterMessageId && route.trigger.MatchString(response.Message) {
+			matched = append(matched, route)
+		}
+	}
+	router.mu.Unlock()
+
+	for _, route := range matched {
+		err := router.send(ctx, route, response.Message)
+		if err != nil {
+			s.logger.Error("Failed to route message", "route", route.ID, "error", err)
+		}
+		router.mu.Lock()
+		if err != nil {
+			route.LastError = err.Error()
+		} else {
+			route.RoutedCount++
+			route.LastError = ""
+		}
+		router.mu.Unlock()
+	}
+}
+
+// send extracts the output of a response and sends it to the route's
+// destination.
+func (r *messageRouter) send(ctx context.Context, route *messageRoute, response string) error {
+	output := response
+	if route.extract != nil {
+		match := route.extract.FindStringSubmatch(response)
+		switch {
+		case match == nil:
+			return xerrors.New("extract_regex didn't match the response")
+		case len(match) > 1:
+			output = match[1]
+		default:
+			output = match[0]
+		}
+	}
+	output = strings.TrimSpace(output)
+	if output == "" {
+		return xerrors.New("the extracted output is empty")
+	}
+
+	dst, err := r.resolve(ctx, route.DstSessionID)
+	if err != nil {
+		return xerrors.Errorf("failed to resolve session %s: %w", route.DstSessionID, err)
+	}
+	data, err := json.Marshal(map[string]string{"content": output, "type": string(MessageTypeUser)})
+	if err != nil {
+		return err
+	}
+	endpoint := VersionedURL(dst.URL) + "/message"
+	if route.Template != "" {
+		endpoint += "?template=" + url.QueryEscape(route.Template)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return xerrors.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if dst.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+dst.Token)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return xerrors.Errorf("failed to send message to %s: %w", route.DstSessionID, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return xerrors.Errorf("session %s returned %d: %s", route.DstSessionID, resp.StatusCode, body)
+	}
+	return nil
+}
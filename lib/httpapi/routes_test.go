@@ -0,0 +1,199 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	mf "github.com/zohaibahmed/clauder/lib/msgfmt"
+	st "github.com/zohaibahmed/clauder/lib/screentracker"
+	"golang.org/x/xerrors"
+)
+
+// replyAgent prints its reply after every message it's sent.
+type replyAgent struct {
+	echoAgent
+	reply string
+}
+
+func (a *replyAgent) Write(data []byte) (int, error) {
+	n, err := a.echoAgent.Write(data)
+	if strings.Contains(string(data), "\x1b[201~") {
+		a.mu.Lock()
+		a.screen.WriteString("\n" + a.reply)
+		a.mu.Unlock()
+	}
+	return n, err
+}
+
+// newRoutingTestServer returns a server whose agent is agent, and an HTTP
+// server serving it.
+func newRoutingTestServer(t *testing.T, ctx context.Context, agent st.AgentIO) (*Server, *httptest.Server) {
+	srv := NewServer(ctx, mf.AgentTypeCustom, nil, 0, "/chat")
+	srv.conversation = st.NewConversation(ctx, st.ConversationConfig{
+		AgentIO:               agent,
+		GetTime:               time.Now,
+		SnapshotInterval:      time.Millisecond,
+		ScreenStabilityLength: 20 * time.Millisecond,
+	})
+	srv.StartSnapshotLoop(ctx)
+	httpSrv := httptest.NewServer(srv.router)
+	t.Cleanup(httpSrv.Close)
+	return srv, httpSrv
+}
+
+func doJSON(t *testing.T, method, url, body string, out any) int {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	if out != nil && resp.StatusCode < 300 {
+		require.NoError(t, json.Unmarshal(data, out), string(data))
+	}
+	return resp.StatusCode
+}
+
+func TestMessageRouting(t *testing.T) {
+	ctx, cancel := context.WithCancel(logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil))))
+	defer cancel()
+	// the coder's output is routed to the reviewer
+	coder, coderSrv := newRoutingTestServer(t, ctx, &replyAgent{reply: "Done: wrote it\n```go\nfunc Add(a, b int) int { return a + b }\n```"})
+	reviewer, reviewerSrv := newRoutingTestServer(t, ctx, &echoAgent{})
+	reviewer.templates.put(Template{Name: "review", Prefix: "Review this code:\n"})
+
+	assert.Equal(t, http.StatusServiceUnavailable, doJSON(t, http.MethodGet, coderSrv.URL+"/v1/routes", "", nil))
+	coder.EnableMessageRouting(ctx, func(ctx context.Context, sessionID string) (RouteSession, error) {
+		if sessionID != "reviewer" {
+			return RouteSession{}, xerrors.Errorf("unknown session %q", sessionID)
+		}
+		return RouteSession{URL: reviewerSrv.URL}, nil
+	}, reviewerSrv.Client())
+
+	for body, status := range map[string]int{
+		`{"dst_session_id":"other","trigger_pattern":"Done"}`:                                http.StatusUnprocessableEntity,
+		`{"dst_session_id":"reviewer","trigger_pattern":"("}`:                                http.StatusUnprocessableEntity,
+		`{"dst_session_id":"reviewer","trigger_pattern":"Done","extract_regex":"["}`:         http.StatusUnprocessableEntity,
+		`{"src_session_id":"a","dst_session_id":"reviewer","trigger_pattern":"Done"}`:        http.StatusUnprocessableEntity,
+		`{"dst_session_id":"reviewer","trigger_pattern":"Done","template":"not a template"}`: http.StatusUnprocessableEntity,
+	} {
+		assert.Equal(t, status, doJSON(t, http.MethodPost, coderSrv.URL+"/v1/routes", body, nil), body)
+	}
+
+	var route Route
+	require.Equal(t, http.StatusCreated, doJSON(t, http.MethodPost, coderSrv.URL+"/v1/routes",
+		`{"dst_session_id":"reviewer","trigger_pattern":"Done: .*","extract_regex":"`+"```go\\\\n([\\\\s\\\\S]+?)```"+`","template":"review"}`, &route))
+	assert.NotEmpty(t, route.ID)
+	// a route that never triggers
+	var unused Route
+	require.Equal(t, http.StatusCreated, doJSON(t, http.MethodPost, coderSrv.URL+"/v1/routes", `{"dst_session_id":"reviewer","trigger_pattern":"^Failed"}`, &unused))
+
+	require.Eventually(t, func() bool {
+		return coder.conversation.Status() == st.ConversationStatusStable && reviewer.conversation.Status() == st.ConversationStatusStable
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, http.StatusOK, doJSON(t, http.MethodPost, coderSrv.URL+"/v1/message", `{"type":"user","content":"Write an Add function please"}`, nil))
+
+	require.Eventually(t, func() bool {
+		for _, message := range reviewer.conversation.Messages() {
+			if message.Role == st.ConversationRoleUser {
+				return true
+			}
+		}
+		return false
+	}, 10*time.Second, 20*time.Millisecond)
+	var userMessages []string
+	for _, message := range reviewer.conversation.Messages() {
+		if message.Role == st.ConversationRoleUser {
+			userMessages = append(userMessages, message.Message)
+		}
+	}
+	assert.Equal(t, []string{"Review this code:\nfunc Add(a, b int) int { return a + b }"}, userMessages)
+
+	// the count is updated once the reviewer answered
+	var routes RoutesResponse
+	require.Eventually(t, func() bool {
+		require.Equal(t, http.StatusOK, doJSON(t, http.MethodGet, coderSrv.URL+"/v1/routes", "", &routes.Body))
+		require.Len(t, routes.Body.Routes, 2)
+		return routes.Body.Routes[0].RoutedCount == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, route.ID, routes.Body.Routes[0].ID)
+	assert.Empty(t, routes.Body.Routes[0].LastError)
+	assert.Zero(t, routes.Body.Routes[1].RoutedCount)
+
+	// deleting the routes stops routing
+	assert.Equal(t, http.StatusNoContent, doJSON(t, http.MethodDelete, coderSrv.URL+"/v1/routes/"+route.ID, "", nil))
+	assert.Equal(t, http.StatusNotFound, doJSON(t, http.MethodDelete, coderSrv.URL+"/v1/routes/"+route.ID, "", nil))
+	assert.Equal(t, http.StatusNoContent, doJSON(t, http.MethodDelete, coderSrv.URL+"/v1/routes/"+unused.ID, "", nil))
+	router := coder.messageRoutes.Load()
+	router.mu.Lock()
+	assert.Nil(t, router.stopWatching)
+	router.mu.Unlock()
+}
+
+func TestMessageRoutingLimit(t *testing.T) {
+	ctx, cancel := context.WithCancel(logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil))))
+	defer cancel()
+	srv, httpSrv := newRoutingTestServer(t, ctx, &echoAgent{})
+	srv.EnableMessageRouting(ctx, func(ctx context.Context, sessionID string) (RouteSession, error) {
+		return RouteSession{URL: "http://127.0.0.1:1"}, nil
+	}, http.DefaultClient)
+	body := `{"dst_session_id":"next","trigger_pattern":"Done"}`
+	for range maxRoutes {
+		require.Equal(t, http.StatusCreated, doJSON(t, http.MethodPost, httpSrv.URL+"/v1/routes", body, nil))
+	}
+	assert.Equal(t, http.StatusConflict, doJSON(t, http.MethodPost, httpSrv.URL+"/v1/routes", body, nil))
+}
+
+func TestRouteSend(t *testing.T) {
+	var received []string
+	dst := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var body MessageRequestBody
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		received = append(received, body.Content)
+		_, _ = io.WriteString(w, `{"ok":true}`)
+	}))
+	defer dst.Close()
+	router := &messageRouter{
+		resolve: func(ctx context.Context, sessionID string) (RouteSession, error) {
+			return RouteSession{URL: dst.URL + "/", Token: sessionID}, nil
+		},
+		client: dst.Client(),
+	}
+	route := func(extract string) *messageRoute {
+		r := &messageRoute{Route: Route{DstSessionID: "secret"}}
+		if extract != "" {
+			r.extract = regexp.MustCompile(extract)
+		}
+		return r
+	}
+	ctx := context.Background()
+
+	require.NoError(t, router.send(ctx, route(""), "  the whole response \n"))
+	require.NoError(t, router.send(ctx, route(`Result: \w+`), "Done. Result: ok, bye"))
+	require.NoError(t, router.send(ctx, route(`Result: (\w+)`), "Done. Result: ok, bye"))
+	assert.Equal(t, []string{"the whole response", "Result: ok", "ok"}, received)
+
+	assert.ErrorContains(t, router.send(ctx, route(`Result: (\w+)`), "Done."), "didn't match")
+	assert.ErrorContains(t, router.send(ctx, route(`Result: (\w*)`), "Result: "), "empty")
+	unauthorized := route("")
+	unauthorized.DstSessionID = "wrong"
+	assert.ErrorContains(t, router.send(ctx, unauthorized, "hi"), "returned 401")
+}
@@ -0,0 +1,122 @@
+package httpapi
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/danielgtaylor/huma/v2"
+	st "github.com/zohaibahmed/clauder/lib/screentracker"
+)
+
+// searchExcerptContext is the number of characters of a message shown
+// before and after a match in its search excerpt.
+const searchExcerptContext = 40
+
+type SearchMessagesRequest struct {
+	Query string `query:"q" required:"true" minLength:"1" example:"parseConfig" doc:"Text to search the messages for. Prefix it with 're:' to search with a regular expression in Go's syntax instead, e.g. 're:func \\w+Config'."`
+	Limit int    `query:"limit" minimum:"1" maximum:"100" default:"20" doc:"Maximum number of results"`
+	Case  string `query:"case" enum:"insensitive,sensitive" default:"insensitive" doc:"Whether the case of letters must match"`
+}
+
+// SearchResult is a message that matches a search.
+type SearchResult struct {
+	Seq        int                 `json:"seq" doc:"Id of the message, as in GET /messages"`
+	Time       time.Time           `json:"ts" doc:"Timestamp of the message"`
+	Direction  st.ConversationRole `json:"direction" doc:"'user' for messages sent to the agent, 'agent' for its responses"`
+	Excerpt    string              `json:"excerpt" doc:"The first match in the message, with up to 40 characters of the message before and after it"`
+	MatchStart int                 `json:"match_start" doc:"Offset of the match in the excerpt, in Unicode characters"`
+	MatchEnd   int                 `json:"match_end" doc:"Offset of the end of the match in the excerpt, in Unicode characters"`
+}
+
+type SearchMessagesResponse struct {
+	Body []SearchResult `nullable:"false" doc:"Matching messages, oldest first"`
+}
+
+// messageMatcher returns the byte offsets of the first match in content,
+// or -1 if there's none.
+type messageMatcher func(content string) (start, end int)
+
+// newMessageMatcher returns the matcher of a search for query, which is a
+// regular expression if it starts with "re:".
+func newMessageMatcher(query string, caseSensitive bool) (messageMatcher, error) {
+	pattern, isRegexp := strings.CutPrefix(query, "re:")
+	if !isRegexp && caseSensitive {
+		return func(content string) (int, int) {
+			start := strings.Index(content, query)
+			if start < 0 {
+				return -1, -1
+			}
+			return start, start + len(query)
+		}, nil
+	}
+	if !isRegexp {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if !caseSensitive {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return func(content string) (int, int) {
+		loc := re.FindStringIndex(content)
+		if loc == nil {
+			return -1, -1
+		}
+		return loc[0], loc[1]
+	}, nil
+}
+
+// findMessages returns the first limit messages that match.
+func findMessages(messages []st.ConversationMessage, match messageMatcher, limit int) []SearchResult {
+	results := []SearchResult{}
+	for _, msg := range messages {
+		if len(results) == limit {
+			break
+		}
+		start, end := match(msg.Message)
+		if start < 0 {
+			continue
+		}
+		result := SearchResult{Seq: msg.Id, Time: msg.Time, Direction: msg.Role}
+		result.Excerpt, result.MatchStart, result.MatchEnd = searchExcerpt(msg.Message, start, end)
+		results = append(results, result)
+	}
+	return results
+}
+
+// searchExcerpt returns the part of content around the match between the
+// byte offsets start and end, and the match's offsets in it, in runes.
+func searchExcerpt(content string, start, end int) (string, int, int) {
+	from := start
+	for i := 0; i < searchExcerptContext && from > 0; i++ {
+		_, size := utf8.DecodeLastRuneInString(content[:from])
+		from -= size
+	}
+	to := end
+	for i := 0; i < searchExcerptContext && to < len(content); i++ {
+		_, size := utf8.DecodeRuneInString(content[to:])
+		to += size
+	}
+	matchStart := utf8.RuneCountInString(content[from:start])
+	return content[from:to], matchStart, matchStart + utf8.RuneCountInString(content[start:end])
+}
+
+// searchMessages handles GET /messages/search
+func (s *Server) searchMessages(ctx context.Context, input *SearchMessagesRequest) (*SearchMessagesResponse, error) {
+	match, err := newMessageMatcher(input.Query, input.Case == "sensitive")
+	if err != nil {
+		return nil, huma.Error400BadRequest("invalid regular expression: " + err.Error())
+	}
+	s.mu.RLock()
+	messages := s.messages()
+	s.mu.RUnlock()
+
+	resp := &SearchMessagesResponse{}
+	resp.Body = findMessages(messages, match, input.Limit)
+	return resp, nil
+}
@@ -0,0 +1,128 @@
+package httpapi
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	st "github.com/zohaibahmed/clauder/lib/screentracker"
+)
+
+// searchTestMessages returns 500 messages. ParseConfig is mentioned in the
+// ones whose id ends with 3, and parseconfig in those whose id is 7 more
+// than a multiple of 20.
+func searchTestMessages() []st.ConversationMessage {
+	start := time.Date(2025, 1, 2, 15, 4, 5, 0, time.UTC)
+	messages := make([]st.ConversationMessage, 500)
+	for i := range messages {
+		role := st.ConversationRoleUser
+		content := fmt.Sprintf("Message %d asks about the code", i)
+		if i%2 == 1 {
+			role = st.ConversationRoleAgent
+			content = fmt.Sprintf("Response %d explains the code", i)
+		}
+		switch {
+		case i%10 == 3:
+			content += " in ParseConfig, which reads the file"
+		case i%20 == 7:
+			content += " in parseconfig"
+		}
+		messages[i] = st.ConversationMessage{Id: i, Message: content, Role: role, Time: start.Add(time.Duration(i) * time.Second)}
+	}
+	return messages
+}
+
+func TestFindMessages(t *testing.T) {
+	messages := searchTestMessages()
+	find := func(query string, caseSensitive bool, limit int) []SearchResult {
+		t.Helper()
+		match, err := newMessageMatcher(query, caseSensitive)
+		require.NoError(t, err)
+		return findMessages(messages, match, limit)
+	}
+
+	assert.Len(t, find("parseconfig", false, 100), 75)
+	assert.Len(t, find("ParseConfig", true, 100), 50)
+	assert.Len(t, find("parseconfig", true, 100), 25)
+	assert.Len(t, find("PARSECONFIG", true, 100), 0)
+	assert.Len(t, find(`re:^Message \d+ asks`, true, 100), 100, "capped by the limit")
+	assert.Len(t, find(`re:config,`, false, 100), 50)
+	assert.Len(t, find("code re:a(", false, 100), 0, "the prefix is only special at the start")
+
+	results := find("parseconfig", false, 20)
+	require.Len(t, results, 20)
+	assert.Equal(t, SearchResult{
+		Seq:        3,
+		Time:       time.Date(2025, 1, 2, 15, 4, 8, 0, time.UTC),
+		Direction:  st.ConversationRoleAgent,
+		Excerpt:    "Response 3 explains the code in ParseConfig, which reads the file",
+		MatchStart: 32,
+		MatchEnd:   43,
+	}, results[0])
+	assert.Equal(t, 7, results[1].Seq)
+	assert.Equal(t, 13, results[2].Seq)
+	for _, result := range results {
+		assert.Equal(t, "parseconfig", strings.ToLower(string([]rune(result.Excerpt)[result.MatchStart:result.MatchEnd])), result.Excerpt)
+	}
+
+	_, err := newMessageMatcher("re:a(", false)
+	assert.ErrorContains(t, err, "missing closing )")
+}
+
+func TestSearchExcerpt(t *testing.T) {
+	// the match is at character 60 and byte 120
+	content := strings.Repeat("é", 60) + "needle" + strings.Repeat("ü", 50)
+	start := strings.Index(content, "needle")
+	excerpt, matchStart, matchEnd := searchExcerpt(content, start, start+len("needle"))
+	assert.Equal(t, strings.Repeat("é", 40)+"needle"+strings.Repeat("ü", 40), excerpt)
+	assert.Equal(t, 40, matchStart)
+	assert.Equal(t, 46, matchEnd)
+
+	excerpt, matchStart, matchEnd = searchExcerpt("a needle", 2, 8)
+	assert.Equal(t, "a needle", excerpt)
+	assert.Equal(t, 2, matchStart)
+	assert.Equal(t, 8, matchEnd)
+}
+
+func TestSearchMessagesEndpoint(t *testing.T) {
+	ctx, cancel := context.WithCancel(logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil))))
+	defer cancel()
+	srv, httpSrv := newRoutingTestServer(t, ctx, &replyAgent{reply: "Done: ParseConfig now reads the file"})
+	require.Eventually(t, func() bool {
+		return srv.conversation.Status() == st.ConversationStatusStable
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, http.StatusOK, doJSON(t, http.MethodPost, httpSrv.URL+"/v1/message", `{"type":"user","content":"Please fix parseConfig for me"}`, nil))
+
+	search := func(query string, out *[]SearchResult) int {
+		return doJSON(t, http.MethodGet, httpSrv.URL+"/v1/messages/search?"+query, "", out)
+	}
+	var results []SearchResult
+	require.Eventually(t, func() bool {
+		require.Equal(t, http.StatusOK, search("q=parseconfig", &results))
+		return len(results) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, st.ConversationRoleUser, results[0].Direction)
+	assert.Equal(t, st.ConversationRoleAgent, results[1].Direction)
+	assert.Greater(t, results[1].Seq, results[0].Seq)
+
+	require.Equal(t, http.StatusOK, search("q=ParseConfig&case=sensitive", &results))
+	require.Len(t, results, 1)
+	assert.Equal(t, st.ConversationRoleAgent, results[0].Direction)
+	require.Equal(t, http.StatusOK, search("q="+url.QueryEscape(`re:(?i)parse\w+ for`)+"&limit=1", &results))
+	require.Len(t, results, 1)
+	assert.Equal(t, "parseConfig for", string([]rune(results[0].Excerpt)[results[0].MatchStart:results[0].MatchEnd]))
+
+	assert.Equal(t, http.StatusBadRequest, search("q="+url.QueryEscape("re:a("), nil))
+	assert.Equal(t, http.StatusUnprocessableEntity, search("q=config&limit=101", nil))
+	assert.Equal(t, http.StatusUnprocessableEntity, search("q=config&case=upper", nil))
+	assert.Equal(t, http.StatusUnprocessableEntity, search("q=", nil))
+}
@@ -0,0 +1,70 @@
+package httpapi
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	mf "github.com/zohaibahmed/clauder/lib/msgfmt"
+)
+
+func TestSecurityHeadersMiddleware(t *testing.T) {
+	for _, tlsEnabled := range []bool{false, true} {
+		rec := httptest.NewRecorder()
+		rec.Header().Set("Server", "proxy")
+		SecurityHeadersMiddleware(tlsEnabled)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Empty(t, w.Header().Get("Server"))
+			_, _ = w.Write([]byte("ok"))
+		})).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		header := rec.Header()
+		assert.Equal(t, "nosniff", header.Get("X-Content-Type-Options"))
+		assert.Equal(t, "DENY", header.Get("X-Frame-Options"))
+		assert.Equal(t, "no-referrer", header.Get("Referrer-Policy"))
+		assert.Equal(t, contentSecurityPolicy, header.Get("Content-Security-Policy"))
+		assert.Contains(t, header.Get("Content-Security-Policy"), "frame-ancestors 'none'")
+		assert.Empty(t, header.Get("Server"))
+		if tlsEnabled {
+			assert.Equal(t, "max-age=31536000", header.Get("Strict-Transport-Security"))
+		} else {
+			assert.Empty(t, header.Values("Strict-Transport-Security"))
+		}
+	}
+}
+
+func TestEnableSecurityHeaders(t *testing.T) {
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	get := func(srv *Server, path string) *http.Response {
+		httpSrv := httptest.NewServer(srv.handler())
+		defer httpSrv.Close()
+		resp, err := http.Get(httpSrv.URL + path)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		return resp
+	}
+
+	srv := NewServer(ctx, mf.AgentTypeClaude, nil, 0, "/chat")
+	resp := get(srv, "/v1/status")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Empty(t, resp.Header.Get("X-Frame-Options"), "disabled by default")
+
+	srv = NewServer(ctx, mf.AgentTypeClaude, nil, 0, "/clauder/chat")
+	require.NoError(t, srv.SetBasePath("/clauder"))
+	srv.EnableSecurityHeaders(true)
+	for path, status := range map[string]int{
+		"/clauder/v1/status": http.StatusOK,
+		"/clauder/chat/":     http.StatusNotFound,
+		"/other":             http.StatusNotFound,
+	} {
+		resp := get(srv, path)
+		assert.Equal(t, status, resp.StatusCode, path)
+		assert.Equal(t, "DENY", resp.Header.Get("X-Frame-Options"), path)
+		assert.Equal(t, "max-age=31536000", resp.Header.Get("Strict-Transport-Security"), path)
+	}
+}
@@ -3,10 +3,14 @@ package httpapi
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/danielgtaylor/huma/v2"
@@ -14,6 +18,7 @@ import (
 	"github.com/danielgtaylor/huma/v2/sse"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/cors"
+	"github.com/zohaibahmed/clauder/lib/events"
 	"github.com/zohaibahmed/clauder/lib/logctx"
 	mf "github.com/zohaibahmed/clauder/lib/msgfmt"
 	st "github.com/zohaibahmed/clauder/lib/screentracker"
@@ -31,8 +36,158 @@ type Server struct {
 	logger       *slog.Logger
 	conversation *st.Conversation
 	agentio      *termexec.Process
-	agentType    mf.AgentType
-	emitter      *EventEmitter
+	// lazyAgent is set instead of agentio if the agent is started by the
+	// first message. See startAgent.
+	lazyAgent *termexec.LazyProcess
+	// lazyAgentStartedAt is when the lazy agent was started, in Unix
+	// nanoseconds, or 0 if it wasn't yet.
+	lazyAgentStartedAt atomic.Int64
+	agentType          mf.AgentType
+	emitter            *EventEmitter
+	bus                *events.EventBus
+	watchdog           *Watchdog
+	// webrtc is nil unless EnableWebRTC was called.
+	webrtc *webRTCServer
+	// sseWriteGuard closes the connections of slow SSE subscribers.
+	sseWriteGuard *sseWriteGuard
+	// sseMaxEventsPerSecond is the rate limit of the line events sent to
+	// each SSE subscriber, or 0 if they aren't limited. It's only set by
+	// SetSSEMaxEventsPerSecond before the server starts, so it isn't
+	// locked.
+	sseMaxEventsPerSecond float64
+	// sseConns holds a channel for each active SSE connection, keyed by a
+	// connection UUID. The channel is closed once the connection is closed.
+	sseConns sync.Map
+	// shutdown is closed when the server starts shutting down.
+	shutdown     chan struct{}
+	shutdownOnce sync.Once
+	// sseDrainTimeout is how long Stop waits for SSE connections to receive
+	// the server_shutdown event. It's overridden in tests.
+	sseDrainTimeout time.Duration
+	// snapshotDemand counts the clients of the snapshot loop, which polls
+	// every snapshotPollBase with one client.
+	snapshotDemand   *snapshotDemand
+	snapshotPollBase time.Duration
+
+	// responseCache is nil unless EnableResponseCache was called.
+	responseCache *ContentAddressedCache
+	cacheMu       sync.Mutex
+	// pendingResponse is the last user message whose response hasn't been
+	// cached yet.
+	pendingResponse *pendingResponse
+	// responseLatency measures the agent's responses for the
+	// agent_response_latency_seconds metric.
+	responseLatency responseLatencyTracker
+
+	// unixSocket is the path of the Unix domain socket to listen on, if
+	// EnableUnixSocket was called.
+	unixSocket     string
+	unixSocketOnly bool
+	// onListening is called by Start once it listens.
+	onListening func()
+	// bodyLogging is nil unless EnableBodyLogging was called.
+	bodyLogging func(http.Handler) http.Handler
+	// securityHeaders is nil unless EnableSecurityHeaders was called.
+	securityHeaders func(http.Handler) http.Handler
+
+	// messageQueue is nil unless EnableMessageQueue was called.
+	messageQueue atomic.Pointer[MessageQueue]
+
+	// contextManager is nil unless EnableContextTrimming was called.
+	contextManager *mf.ContextManager
+
+	startTime time.Time
+	// corsMiddleware handles the CORS headers of every request.
+	corsMiddleware *atomic.Pointer[cors.Cors]
+	// tunnelURL is the public URL of the server, if SetTunnelURL was called.
+	tunnelURL atomic.Pointer[string]
+	// tunnelInfo is nil unless SetTunnelInfo was called.
+	tunnelInfo atomic.Pointer[func() TunnelInfo]
+
+	// adminToken is empty unless EnableAdminShutdown was called.
+	adminToken      string
+	onAdminShutdown func(ctx context.Context)
+
+	ttfb *ttfbMonitor
+
+	// slack is nil unless EnableSlackNotifications was called.
+	slack atomic.Pointer[SlackNotifier]
+	// messageRoutes is nil unless EnableMessageRouting was called.
+	messageRoutes atomic.Pointer[messageRouter]
+	// pushTargets is nil unless EnablePushTargets was called.
+	pushTargets atomic.Pointer[pushTargetStore]
+	// replayer is nil unless EnableReplay was called.
+	replayer atomic.Pointer[replayer]
+	// slashCommands is nil unless EnableSlashCommands was called.
+	slashCommands atomic.Pointer[SlashCommandParser]
+	// webPush is nil unless EnableWebPush was called.
+	webPush atomic.Pointer[WebPushNotifier]
+	// slo is nil unless EnableSLOMonitor was called.
+	slo atomic.Pointer[SLOMonitor]
+	// snapshotScheduler is nil unless EnableAdaptiveSnapshots was called.
+	snapshotScheduler atomic.Pointer[AdaptiveSnapshotScheduler]
+	// workspaces is nil unless EnableWorkspaces was called.
+	workspaces atomic.Pointer[workspaceStore]
+	// eventStore is nil unless EnableEventLog was called.
+	eventStore atomic.Pointer[EventStore]
+	// defaultWorkspaceAgent is only set by SetDefaultWorkspaceAgent before
+	// the server starts, so it isn't locked.
+	defaultWorkspaceAgent WorkspaceAgentConfig
+	// lazyWorkspaceAgents is only set by SetLazyWorkspaceAgents before the
+	// server starts, so it isn't locked.
+	lazyWorkspaceAgents bool
+
+	// gifJobs is nil unless EnableRecordingExport was called, which sets
+	// recordingsDir too.
+	recordingsDir string
+	gifJobs       *gifJobs
+
+	// filesDir is empty unless EnableFileListing was called.
+	filesDir string
+
+	templates *templateStore
+
+	// handoffs is nil unless the server requires authentication.
+	handoffs *handoffStore
+
+	// basePath is the path every endpoint is served under. It's only set
+	// by SetBasePath before the server starts, so it isn't locked.
+	basePath string
+	// snapshotPush is set by EnablePushSnapshot.
+	snapshotPush bool
+}
+
+type pendingResponse struct {
+	message       string
+	userMessageId int
+	sawRunning    bool
+}
+
+// DefaultCORSOrigins are the origins that can make cross-origin requests
+// unless SetCORSOrigins was called: any origin.
+var DefaultCORSOrigins = []string{"*"}
+
+func newCORS(origins []string) *cors.Cors {
+	return cors.New(cors.Options{
+		AllowedOrigins:   origins,
+		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "If-None-Match", "If-Modified-Since"},
+		ExposedHeaders:   []string{"Link", "ETag", "Last-Modified", "X-Snapshot-Seq"},
+		AllowCredentials: true,
+		MaxAge:           300, // Maximum value not ignored by any of major browsers
+	})
+}
+
+// SetCORSOrigins sets the origins that can make cross-origin requests, e.g.
+// https://app.example.com. "*" allows any origin, and a "*" in an origin
+// matches any part of it, like https://*.example.com. It takes effect for
+// the requests that start after it returns, so it can be called while the
+// server is running.
+func (s *Server) SetCORSOrigins(origins []string) {
+	if len(origins) == 0 {
+		origins = DefaultCORSOrigins
+	}
+	s.corsMiddleware.Store(newCORS(origins))
 }
 
 func (s *Server) GetOpenAPI() string {
@@ -56,33 +211,46 @@ func (s *Server) GetOpenAPI() string {
 // because the action of taking a snapshot takes time too.
 const snapshotInterval = 25 * time.Millisecond
 
+// screenStabilityLength is how long the agent's screen must not change for
+// the agent to be considered waiting for input.
+const screenStabilityLength = 2 * time.Second
+
 // NewServer creates a new server instance
 func NewServer(ctx context.Context, agentType mf.AgentType, process *termexec.Process, port int, chatBasePath string) *Server {
-	return newServer(ctx, agentType, process, port, chatBasePath, "")
+	return newServer(ctx, agentType, process, nil, port, chatBasePath, "")
 }
 
 // NewServerWithAuth creates a new server instance with Bearer token authentication
 func NewServerWithAuth(ctx context.Context, agentType mf.AgentType, process *termexec.Process, port int, chatBasePath string, token string) *Server {
-	return newServer(ctx, agentType, process, port, chatBasePath, token)
+	return newServer(ctx, agentType, process, nil, port, chatBasePath, token)
 }
 
-// newServer creates a new server instance with optional authentication
-func newServer(ctx context.Context, agentType mf.AgentType, process *termexec.Process, port int, chatBasePath string, token string) *Server {
+// newServer creates a new server instance with optional authentication. If
+// lazyAgent is set, it's the agent rather than process.
+func newServer(ctx context.Context, agentType mf.AgentType, process *termexec.Process, lazyAgent *termexec.LazyProcess, port int, chatBasePath string, token string) *Server {
 	router := chi.NewMux()
+	ttfb := newTTFBMonitor(logctx.From(ctx))
+	router.Use(ttfb.middleware)
+	sseWriteGuard := newSSEWriteGuard(logctx.From(ctx))
+	router.Use(sseWriteGuard.middleware)
 
-	corsMiddleware := cors.New(cors.Options{
-		AllowedOrigins:   []string{"*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
-		AllowCredentials: true,
-		MaxAge:           300, // Maximum value not ignored by any of major browsers
+	// the CORS middleware is replaced by SetCORSOrigins
+	var corsMiddleware atomic.Pointer[cors.Cors]
+	corsMiddleware.Store(newCORS(DefaultCORSOrigins))
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			corsMiddleware.Load().Handler(next).ServeHTTP(w, r)
+		})
 	})
-	router.Use(corsMiddleware.Handler)
 
-	// Add authentication middleware if token is provided
+	// Add authentication middleware if token is provided. The tokens of
+	// session handoffs are accepted too.
+	var handoffs *handoffStore
 	if token != "" {
-		router.Use(AuthMiddleware(token))
+		handoffs = newHandoffStore(logctx.From(ctx))
+		router.Use(authMiddleware(func(provided string) bool {
+			return provided == token || handoffs.useToken(provided)
+		}))
 	}
 
 	humaConfig := huma.DefaultConfig("Clauder", "0.2.3")
@@ -91,16 +259,24 @@ func newServer(ctx context.Context, agentType mf.AgentType, process *termexec.Pr
 	formatMessage := func(message string, userInput string) string {
 		return mf.FormatAgentMessage(agentType, message, userInput)
 	}
+	bus := events.NewEventBus(1024)
+	var agentIO st.AgentIO = process
+	if lazyAgent != nil {
+		agentIO = lazyAgentIO{agent: lazyAgent}
+	}
 	conversation := st.NewConversation(ctx, st.ConversationConfig{
-		AgentIO: process,
+		AgentIO: agentIO,
 		GetTime: func() time.Time {
 			return time.Now()
 		},
 		SnapshotInterval:      snapshotInterval,
-		ScreenStabilityLength: 2 * time.Second,
+		ScreenStabilityLength: screenStabilityLength,
 		FormatMessage:         formatMessage,
+		ReadyPrompt:           mf.ReadyPrompt(agentType),
+		Bus:                   bus,
 	})
 	emitter := NewEventEmitter(1024)
+	emitter.setLineDeduplicator(DefaultSSEDeduplicationTTL)
 	s := &Server{
 		router:       router,
 		api:          api,
@@ -108,8 +284,29 @@ func newServer(ctx context.Context, agentType mf.AgentType, process *termexec.Pr
 		conversation: conversation,
 		logger:       logctx.From(ctx),
 		agentio:      process,
+		lazyAgent:    lazyAgent,
 		agentType:    agentType,
 		emitter:      emitter,
+		bus:          bus,
+
+		sseWriteGuard:    sseWriteGuard,
+		shutdown:         make(chan struct{}),
+		sseDrainTimeout:  3 * time.Second,
+		snapshotDemand:   newSnapshotDemand(),
+		snapshotPollBase: snapshotInterval,
+		startTime:        time.Now(),
+		ttfb:             ttfb,
+		templates:        newTemplateStore(),
+		handoffs:         handoffs,
+		corsMiddleware:   &corsMiddleware,
+	}
+	s.tunnelURL.Store(new(string))
+	s.sseMaxEventsPerSecond = DefaultSSEMaxEventsPerSecond
+	if process != nil {
+		process.OnWriteSpan(recordWriteSpan)
+	}
+	if lazyAgent != nil {
+		emitter.UpdateAgentStatusAndEmitChanges(AgentStatusNotStarted)
 	}
 
 	// Register API routes
@@ -119,62 +316,487 @@ func newServer(ctx context.Context, agentType mf.AgentType, process *termexec.Pr
 }
 
 func (s *Server) StartSnapshotLoop(ctx context.Context) {
+	s.emitter.ConsumeBus(ctx, s.bus)
+	s.startResponseLatencyLoop(ctx)
 	s.conversation.StartSnapshotLoop(ctx)
+	go func() {
+		// paused while nobody listens to the events
+		for s.snapshotDemand.wait(ctx) {
+			s.emitter.UpdateAgentStatusAndEmitChanges(s.agentStatus())
+			s.emitter.UpdateMessagesAndEmitChanges(s.messages())
+			s.updateResponseCache()
+			time.Sleep(snapshotPollInterval(s.snapshotPollBaseInterval(), s.snapshotDemand.count()))
+		}
+	}()
+}
+
+// StartJSONEventLoop forwards structured events parsed from the agent's
+// JSON output to SSE subscribers until the channel is closed.
+func (s *Server) StartJSONEventLoop(ctx context.Context, events <-chan st.ClaudeEvent) {
 	go func() {
 		for {
-			s.emitter.UpdateStatusAndEmitChanges(s.conversation.Status())
-			s.emitter.UpdateMessagesAndEmitChanges(s.conversation.Messages())
-			s.emitter.UpdateScreenAndEmitChanges(s.conversation.Screen())
-			time.Sleep(snapshotInterval)
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				s.emitter.EmitClaudeEvent(event)
+			}
+		}
+	}()
+}
+
+var suppressedLines = newCounterVec(
+	"suppressed_lines_total",
+	"Number of lines of the agent's output dropped by the output filter.",
+)
+
+// CountSuppressedLines exports the number of lines filter drops as the
+// suppressed_lines_total metric.
+func CountSuppressedLines(filter *st.OutputFilter) {
+	filter.OnSuppress(func() { suppressedLines.Inc() })
+}
+
+// StartLineLoop forwards the lines the agent prints as line events until
+// the channel is closed.
+func (s *Server) StartLineLoop(ctx context.Context, lines <-chan string) {
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case line, ok := <-lines:
+				if !ok {
+					return
+				}
+				s.emitter.EmitLine(line)
+			}
+		}
+	}()
+}
+
+// StartStdoutJSONLoop forwards the JSON objects the agent prints to its
+// standard output as agent_output events. The objects that are Claude Code
+// events are forwarded as tool_use events too, if the agent is Claude Code.
+func (s *Server) StartStdoutJSONLoop(ctx context.Context, events <-chan st.StdoutEvent) {
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				s.emitter.EmitAgentOutput(event)
+				if event.IsClaude && s.agentType == mf.AgentTypeClaude {
+					s.emitter.EmitClaudeEvent(event.Claude)
+				}
+			}
 		}
 	}()
 }
 
+// EnableResponseCache makes the server cache the agent's response to each
+// user message for ttl. While cached, sending the same message again returns
+// the cached response without forwarding the message to the agent.
+func (s *Server) EnableResponseCache(ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responseCache = NewContentAddressedCache(ttl)
+	// the responses are picked up by the snapshot loop
+	s.snapshotDemand.acquire()
+}
+
+// EnableMessageQueue makes POST /message enqueue messages and return right
+// away. The queue holds up to depth messages, which are sent to the agent one
+// at a time until the context is done. The agent's status is running until
+// the queued messages were answered, so that clients that poll GET /status
+// after sending a message wait for the response.
+func (s *Server) EnableMessageQueue(ctx context.Context, depth int) {
+	queue := NewMessageQueue(depth)
+	s.messageQueue.Store(queue)
+	go queue.Run(ctx, s.dispatchMessage)
+}
+
+// EnableContextTrimming makes the server remove the oldest messages from the
+// conversation history once its estimated size exceeds 80% of the agent's
+// context window of window tokens. Subscribers are told about it with a
+// context_trimmed event. Only the server's history, returned by GET
+// /messages, is trimmed: the agent keeps its own context, which clauder
+// can't change, and manages it itself.
+func (s *Server) EnableContextTrimming(window int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.contextManager = mf.NewContextManager(window)
+}
+
+// trimContext trims the conversation history before content is sent.
+func (s *Server) trimContext(content string) {
+	if s.contextManager == nil {
+		return
+	}
+	removed, tokens := s.conversation.TrimContext(s.contextManager, content)
+	if removed > 0 {
+		s.logger.Info("Trimmed conversation context", "removed", removed, "tokens", tokens)
+		s.emitter.EmitContextTrimmed(removed, tokens)
+	}
+}
+
+// trackPendingResponse remembers the user message that was just sent so that
+// the agent's response can be cached once it's complete.
+func (s *Server) trackPendingResponse(message string) {
+	messages := s.messages()
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == st.ConversationRoleUser {
+			s.pendingResponse = &pendingResponse{message: message, userMessageId: messages[i].Id}
+			return
+		}
+	}
+}
+
+// updateResponseCache caches the response to the pending user message once
+// the agent has finished working on it.
+func (s *Server) updateResponseCache() {
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+	if s.pendingResponse == nil {
+		return
+	}
+	// The screen may still be stable right after the message is sent, so
+	// the response is only complete once the agent was seen running.
+	if s.conversation.Status() != st.ConversationStatusStable {
+		s.pendingResponse.sawRunning = true
+		return
+	}
+	if !s.pendingResponse.sawRunning {
+		return
+	}
+	responseId := s.pendingResponse.userMessageId + 1
+	for _, message := range s.messages() {
+		if message.Id == responseId && message.Role == st.ConversationRoleAgent {
+			s.responseCache.Put(s.agentType, s.pendingResponse.message, message.Message)
+		}
+	}
+	s.pendingResponse = nil
+}
+
+// SetTunnelURL sets the public URL of the server, which is reported
+// on GET /health. Changing it notifies Slack that the tunnel reconnected.
+func (s *Server) SetTunnelURL(url string) {
+	previous := s.tunnelURL.Swap(&url)
+	if *previous != "" && *previous != url {
+		s.notifySlack(context.Background(), SlackEventTunnelReconnected, fmt.Sprintf("The server is now reachable at %s.", url))
+	}
+}
+
+// FailoverTunnel sets the public URL of the server to the URL of the
+// standby tunnel that replaced the tunnel at oldURL, and sends a
+// tunnel_failover event so that clients switch to it.
+func (s *Server) FailoverTunnel(oldURL, newURL string) {
+	s.SetTunnelURL(newURL)
+	s.emitter.EmitTunnelFailover(oldURL, newURL)
+}
+
+// TunnelURL returns the public URL of the server set with SetTunnelURL.
+func (s *Server) TunnelURL() string {
+	return *s.tunnelURL.Load()
+}
+
+// CoordinatorRegistered sends a coordinator_registered event once the
+// session was registered with the coordinator after all.
+func (s *Server) CoordinatorRegistered(passcode string) {
+	s.emitter.EmitCoordinatorRegistered(passcode)
+}
+
+// StartWatchdog starts monitoring the agent process and the event loop.
+// onFailure is called whenever a check fails.
+func (s *Server) StartWatchdog(ctx context.Context, onFailure func(status WatchdogStatus)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	maxEventAge := 2 * s.snapshotPollBase
+	if s.snapshotScheduler.Load() != nil {
+		// the loop may be degraded to poll that rarely
+		maxEventAge = max(maxEventAge, 2*MaxAdaptiveSnapshotInterval)
+	}
+	s.watchdog = NewWatchdog(s.emitter, WatchdogConfig{
+		Process:     s.agentio,
+		LastEvent:   s.lastSnapshot,
+		MaxEventAge: maxEventAge,
+		OnFailure:   onFailure,
+	})
+	s.watchdog.Start(ctx)
+}
+
 // registerRoutes sets up all API endpoints
 func (s *Server) registerRoutes(chatBasePath string) {
+	// The API is served under /v1. The unversioned paths it used to be
+	// served at redirect to it.
+	v1 := huma.NewGroup(s.api, APIVersionPrefix)
+	unversioned := map[string]bool{}
+	v1.UseSimpleModifier(func(op *huma.Operation) {
+		unversioned[unversionedPath(op.Path)] = true
+	})
+
 	// GET /health endpoint (no auth required)
-	huma.Get(s.api, "/health", s.getHealth, func(o *huma.Operation) {
-		o.Description = "Health check endpoint."
+	huma.Get(v1, "/health", s.getHealth, func(o *huma.Operation) {
+		o.Description = "Health check endpoint. Also returns information about the session, which is used by 'clauder status'."
+	})
+
+	// GET /livez endpoint
+	huma.Get(v1, "/livez", s.getLivez, func(o *huma.Operation) {
+		o.Description = "Returns the result of the last watchdog check. Responds with 503 if a component that delivers events is stuck."
+	})
+
+	huma.Get(v1, "/tunnel/info", s.getTunnelInfo, func(o *huma.Operation) {
+		o.Description = "Returns the provider of the tunnel the server is exposed through, and the state of the attempts to reconnect it, which are retried with an exponential backoff. Responds with 404 if the server isn't exposed through a tunnel."
 	})
 
 	// GET /status endpoint
-	huma.Get(s.api, "/status", s.getStatus, func(o *huma.Operation) {
+	huma.Get(v1, "/status", s.getStatus, func(o *huma.Operation) {
 		o.Description = "Returns the current status of the agent."
 	})
 
+	// GET /agent/last_span endpoint
+	huma.Get(v1, "/agent/last_span", s.getLastSpan, func(o *huma.Operation) {
+		o.Description = "Returns the span of the last write to the agent's terminal, i.e. of the last message: when it was written, when the agent first printed something after it, and when the agent was idle again. Returns 404 if nothing was written to the agent yet."
+	})
+
+	// GET /debug/memory endpoint
+	huma.Get(v1, "/debug/memory", s.getDebugMemory, func(o *huma.Operation) {
+		o.Description = "Returns the memory used by the snapshots of the agent's screen that are kept to check whether it's stable, with and without compression, and the size of the server's heap. The snapshots older than the 50 most recent ones are compressed by default."
+	})
+
+	// GET /snapshot endpoint
+	huma.Get(v1, "/snapshot", s.getSnapshot, func(o *huma.Operation) {
+		o.Description = "Returns the current contents of the agent's terminal screen. The response has an ETag and a Last-Modified header. If the screen hasn't changed, requests with a matching If-None-Match header, or without one and with an If-Modified-Since header, receive a 304 response with an empty body. The X-Snapshot-Seq header holds the snapshot's sequence number, which is incremented every time the screen changes."
+	})
+
 	// GET /messages endpoint
-	huma.Get(s.api, "/messages", s.getMessages, func(o *huma.Operation) {
+	huma.Get(v1, "/messages", s.getMessages, func(o *huma.Operation) {
 		o.Description = "Returns a list of messages representing the conversation history with the agent."
 	})
 
+	// GET /messages/search endpoint
+	huma.Get(v1, "/messages/search", s.searchMessages, func(o *huma.Operation) {
+		o.Description = "Searches the content of the messages for 'q', and returns the matching messages, each with an excerpt around its first match. Searches are case-insensitive unless 'case' is 'sensitive'. A 'q' starting with 're:' is a regular expression, and an invalid one is rejected with a 400 error."
+	})
+
+	// GET /messages/{seq}/code-blocks endpoint
+	huma.Get(v1, "/messages/{seq}/code-blocks", s.getMessageCodeBlocks, func(o *huma.Operation) {
+		o.Description = "Returns the fenced and indented code blocks contained in the message with the given id. If the message has no code blocks, an empty list is returned."
+	})
+
+	// GET /files endpoint
+	huma.Get(v1, "/files", s.getFiles, func(o *huma.Operation) {
+		o.Description = "Returns the files in the agent's working directory. In a git repository, files ignored by git are left out, otherwise hidden files are. At most 10000 files are listed. Returns 503 if file listing isn't enabled."
+	})
+
 	// POST /message endpoint
-	huma.Post(s.api, "/message", s.createMessage, func(o *huma.Operation) {
-		o.Description = "Send a message to the agent. For messages of type 'user', the agent's status must be 'stable' for the operation to complete successfully. Otherwise, this endpoint will return an error."
+	huma.Post(v1, "/message", s.createMessage, func(o *huma.Operation) {
+		o.Description = "Send a message to the agent. For messages of type 'user', the agent's status must be 'stable' for the operation to complete successfully. Otherwise, this endpoint will return an error. Messages of type 'user' that are not valid UTF-8, contain null bytes, are too long, or have fewer than three words and no code block are rejected with a 422 error.\n\nWhen the message queue is enabled, messages of type 'user' are queued and the endpoint returns right away with the message's position in the queue. Queued messages are sent one at a time, each once the agent finished responding to the previous one. If the queue is full, the endpoint returns a 503 error. A queued message that can't be sent is reported with a 'message_failed' event. Messages of type 'raw' are never queued.\n\nThe 'template' query parameter wraps the content of a 'user' message with the prefix and suffix of a template created with POST /templates. Unknown templates are rejected with a 404 error."
+	})
+
+	// POST /replay endpoint
+	huma.Post(v1, "/replay", s.replayConversation, func(o *huma.Operation) {
+		o.Description = "Replays a saved conversation to the agent, e.g. to check how it responds after a fix. The 'user' messages are sent one at a time, each once the agent finished responding to the previous one and 'delay_ms' passed, and 'agent' messages are skipped. The endpoint returns with a 202 status once the conversation was validated, and the progress is reported with 'replay_progress' events, until a 'replay_complete' event. With 'dry_run', the conversation is only validated, and the endpoint returns with a 200 status.\n\nConversations with user messages that POST /message would reject, or without user messages, are rejected with a 422 error. Returns 409 if another conversation is being replayed, and 503 if replay isn't enabled."
 	})
 
 	// GET /events endpoint
-	sse.Register(s.api, huma.Operation{
+	sse.Register(v1, huma.Operation{
 		OperationID: "subscribeEvents",
 		Method:      http.MethodGet,
 		Path:        "/events",
 		Summary:     "Subscribe to events",
-		Description: "The events are sent as Server-Sent Events (SSE). Initially, the endpoint returns a list of events needed to reconstruct the current state of the conversation and the agent's status. After that, it only returns events that have occurred since the last event was sent.\n\nNote: When an agent is running, the last message in the conversation history is updated frequently, and the endpoint sends a new message update event each time.",
+		Description: "The events are sent as Server-Sent Events (SSE). Initially, the endpoint returns a list of events needed to reconstruct the current state of the conversation and the agent's status. After that, it only returns events that have occurred since the last event was sent.\n\nThe 'topics' query parameter limits the events to the given types. The first event is always a 'subscribed' event that lists them.\n\nWith 'mode=diff', the endpoint only sends 'term_diff' events with the lines of the agent's terminal screen that changed, instead of the conversation. The first one builds the current screen from an empty one.\n\nWith 'mode=lines', the endpoint only sends a 'line' event for each line the agent prints, as soon as its newline arrives, rather than when the screen is next checked. If the agent prints lines faster than the server's limit, 50 per second by default, the lines beyond it are dropped, and a 'throttled' event with the number of dropped lines is sent once lines can be sent again. A line that repeats the previous one, e.g. a spinner redrawing the same line, is only sent again once 2 seconds passed by default.\n\nIf the server pushes snapshots, HTTP/2 clients are pushed the GET /snapshot response before the first event, and the other clients get a 'snapshot' event with the agent's screen after the 'subscribed' event.\n\nNote: When an agent is running, the last message in the conversation history is updated frequently, and the endpoint sends a new message update event each time.",
 	}, map[string]any{
 		// Mapping of event type name to Go struct for that event.
-		"message_update": MessageUpdateBody{},
-		"status_change":  StatusChangeBody{},
+		"message_update":         MessageUpdateBody{},
+		"status_change":          StatusChangeBody{},
+		"tool_use":               ToolUseBody{},
+		"agent_output":           AgentOutputBody{},
+		"watchdog_alert":         WatchdogAlertBody{},
+		"network_quality":        NetworkQualityBody{},
+		"context_trimmed":        ContextTrimmedBody{},
+		"tunnel_failover":        TunnelFailoverBody{},
+		"pty_resized":            PTYResizedBody{},
+		"coordinator_registered": CoordinatorRegisteredBody{},
+		"quality_degraded":       QualityDegradedBody{},
+		"replay_progress":        ReplayProgressBody{},
+		"replay_complete":        ReplayCompleteBody{},
+		"message_failed":         MessageFailedBody{},
+		"term_diff":              TermDiffBody{},
+		"line":                   LineBody{},
+		"throttled":              ThrottledBody{},
+		"server_shutdown":        ServerShutdownBody{},
+		"subscribed":             SubscribedBody{},
+		"snapshot":               SnapshotBody{},
 	}, s.subscribeEvents)
 
-	sse.Register(s.api, huma.Operation{
+	sse.Register(v1, huma.Operation{
 		OperationID: "subscribeScreen",
 		Method:      http.MethodGet,
 		Path:        "/internal/screen",
 		Summary:     "Subscribe to screen",
 		Hidden:      true,
 	}, map[string]any{
-		"screen": ScreenUpdateBody{},
+		"screen":          ScreenUpdateBody{},
+		"server_shutdown": ServerShutdownBody{},
 	}, s.subscribeScreen)
 
+	// GET /webrtc/ice endpoint
+	huma.Get(v1, "/webrtc/ice", s.getWebRTCICE, func(o *huma.Operation) {
+		o.Description = "Returns the ICE servers to use when connecting with WebRTC."
+	})
+
+	// POST /webrtc/offer endpoint
+	huma.Post(v1, "/webrtc/offer", s.createWebRTCOffer, func(o *huma.Operation) {
+		o.Description = "Accepts a WebRTC SDP offer and returns the answer. The client must create a data channel named 'pty'. The agent's terminal output is streamed over it as binary frames, and frames sent by the client are written to the terminal as keystrokes, like 'raw' messages. The server closes the data channel when the client falls too far behind the output, rather than skipping output; the client should then reset its terminal and reconnect. This is a lower latency alternative to the SSE endpoints, which remain available."
+	})
+
+	// POST /admin/shutdown endpoint
+	huma.Post(v1, "/admin/shutdown", s.shutdownServer, func(o *huma.Operation) {
+		o.Description = "Gracefully stops the server, like 'clauder stop'. Requires the admin token as a Bearer token in the Authorization header. Returns 202 once the shutdown started. SSE subscribers receive a server_shutdown event before their connections are closed. Returns 503 if the server wasn't started with an admin token."
+		o.DefaultStatus = http.StatusAccepted
+	})
+
+	// POST /recording/gif endpoint
+	huma.Post(v1, "/recording/gif", s.createGIF, func(o *huma.Operation) {
+		o.Description = "Starts converting an asciinema v2 recording from the server's recordings directory to an animated GIF, and returns the ID of the conversion job with a 202 status. The GIF has at most 50 frames and is cropped to 800x400 pixels. Returns 429 if 2 recordings are already being converted, and 503 if recording export isn't enabled."
+		o.DefaultStatus = http.StatusAccepted
+	})
+
+	// GET /recording/gif/{job_id} endpoint
+	huma.Get(v1, "/recording/gif/{job_id}", s.getGIF, func(o *huma.Operation) {
+		o.Description = "Returns the result of a conversion job started with POST /recording/gif. Responds with 202 and the job's status while it's processing, and with 200 and the GIF once it's done. Responds with 422 if the recording couldn't be converted. Finished jobs are kept for 15 minutes."
+	})
+
+	// POST /templates endpoint
+	huma.Post(v1, "/templates", s.createTemplate, func(o *huma.Operation) {
+		o.Description = "Creates a message template, or replaces the template with the same name. Messages of type 'user' sent with POST /message?template=<name> are wrapped with the template's prefix and suffix before they're sent to the agent. Templates are kept in memory until the server stops."
+		o.DefaultStatus = http.StatusCreated
+	})
+
+	// GET /templates endpoint
+	huma.Get(v1, "/templates", s.getTemplates, func(o *huma.Operation) {
+		o.Description = "Returns the message templates, sorted by name."
+	})
+
+	// DELETE /templates/{name} endpoint
+	huma.Delete(v1, "/templates/{name}", s.deleteTemplate, func(o *huma.Operation) {
+		o.Description = "Deletes a message template. Returns 404 if there's no template with the given name."
+	})
+
+	// POST /session/handoff endpoint
+	huma.Post(v1, "/session/handoff", s.createHandoff, func(o *huma.Operation) {
+		o.Description = "Creates an 8-character handoff code to continue the session on another device with 'clauder connect <code>'. The code is registered with the coordinator along with the server's public URL and a new token, which authenticates requests like the session token for 24 hours. The code expires after 30 seconds and can only be used once. Returns 503 if the server doesn't require authentication or isn't exposed through a tunnel."
+	})
+
+	// GET /session/handoff/{code}/status endpoint
+	huma.Get(v1, "/session/handoff/{code}/status", s.getHandoffStatus, func(o *huma.Operation) {
+		o.Description = "Returns whether another device connected with a handoff code. The status is 'consumed' once a request is authenticated with the handoff's token."
+	})
+
+	// POST /routes endpoint
+	huma.Post(v1, "/routes", s.createRoute, func(o *huma.Operation) {
+		o.Description = "Creates a route that sends the agent's output to another session, to chain agents. Whenever the agent finishes responding to a message and its response matches 'trigger_pattern', the part of it extracted with 'extract_regex' is sent to the destination session as a 'user' message, wrapped in the destination's 'template' if one is given. At most 5 routes can be active; creating more returns 409. Returns 503 if message routing isn't enabled."
+		o.DefaultStatus = http.StatusCreated
+	})
+
+	// GET /routes endpoint
+	huma.Get(v1, "/routes", s.getRoutes, func(o *huma.Operation) {
+		o.Description = "Returns the active routes, with the number of messages each sent and why the last one failed, if it did."
+	})
+
+	// DELETE /routes/{id} endpoint
+	huma.Delete(v1, "/routes/{id}", s.deleteRoute, func(o *huma.Operation) {
+		o.Description = "Deletes a route. Returns 404 if there's no route with the given ID."
+	})
+
+	// POST /push-targets endpoint
+	huma.Post(v1, "/push-targets", s.createPushTarget, func(o *huma.Operation) {
+		o.Description = "Creates a push target: the agent's screen is POSTed to 'url' right away and then every 'interval_s' seconds, as the JSON object GET /snapshot returns, with 'auth_header' as the Authorization header. A delivery that takes longer than 30 seconds fails. At most 5 push targets can be active; creating more returns 409. Returns 503 if push targets aren't enabled."
+		o.DefaultStatus = http.StatusCreated
+	})
+
+	// GET /push-targets endpoint
+	huma.Get(v1, "/push-targets", s.getPushTargets, func(o *huma.Operation) {
+		o.Description = "Returns the active push targets, with the number of snapshots each delivered and why the last one failed, if it did."
+	})
+
+	// DELETE /push-targets/{id} endpoint
+	huma.Delete(v1, "/push-targets/{id}", s.deletePushTarget, func(o *huma.Operation) {
+		o.Description = "Deletes a push target, which stops pushing snapshots. Returns 404 if there's no push target with the given ID."
+	})
+
+	// GET /push/vapid-public-key endpoint
+	huma.Get(v1, "/push/vapid-public-key", s.getVAPIDPublicKey, func(o *huma.Operation) {
+		o.Description = "Returns the server's VAPID public key, to subscribe to push notifications with. It changes when the server restarts. Returns 503 if push notifications aren't enabled."
+	})
+
+	// POST /push/subscribe endpoint
+	huma.Post(v1, "/push/subscribe", s.subscribePush, func(o *huma.Operation) {
+		o.Description = "Registers a Web Push subscription, as returned by PushSubscription.toJSON() in the browser, to receive a push notification when the agent finishes responding to a message. The notifications are encrypted JSON objects with a 'title' and a 'body'. Subscriptions the push service reports as expired are removed. Returns 422 if the subscription is invalid, and 503 if push notifications aren't enabled."
+	})
+
+	// POST /admin/workspaces endpoint
+	huma.Post(v1, "/admin/workspaces", s.createWorkspace, func(o *huma.Operation) {
+		o.Description = "Creates a workspace, which runs its own agent with its own conversation and event stream, so that teams can share a server. The workspace's endpoints are served under /workspaces/{id}, e.g. POST /workspaces/{id}/v1/message, and require the returned token as a Bearer token; the token isn't returned again. The server's own agent is the 'default' workspace, whose endpoints are also served at their usual paths. Requires the admin token. Returns 409 if a workspace with the same ID exists, and 503 if workspaces aren't enabled."
+		o.DefaultStatus = http.StatusCreated
+	})
+
+	// GET /admin/workspaces endpoint
+	huma.Get(v1, "/admin/workspaces", s.listWorkspaces, func(o *huma.Operation) {
+		o.Description = "Returns the workspaces, starting with the default workspace, without their tokens. Requires the admin token."
+	})
+
+	// GET /admin/workspaces/{id}/config endpoint
+	huma.Get(v1, "/admin/workspaces/{id}/config", s.getWorkspaceConfig, func(o *huma.Operation) {
+		o.Description = "Returns the config the agent of a workspace is started with, including the working directory and environment variables of the server's agent it inherits. The values of the environment variables are masked as '***'. Requires the admin token. Returns 404 if there's no workspace with the given ID."
+	})
+
+	// DELETE /admin/workspaces/{id} endpoint
+	huma.Delete(v1, "/admin/workspaces/{id}", s.deleteWorkspace, func(o *huma.Operation) {
+		o.Description = "Deletes a workspace: its event streams are closed and its agent is stopped. Requires the admin token. Returns 404 if there's no workspace with the given ID, and 400 for the default workspace."
+	})
+
+	// POST /admin/workspaces/{id}/branch endpoint
+	huma.Post(v1, "/admin/workspaces/{id}/branch", s.branchWorkspace, func(o *huma.Operation) {
+		o.Description = "Branches a workspace, to explore how the agent responds when it's asked differently without losing the original conversation. The branch is a workspace running a new agent with the same config, with its own conversation and event stream, which is sent the workspace's user messages again, one at a time, in the background. Returns the branch's ID and token. Requires the admin token. Returns 404 if there's no workspace with the given ID, and 409 if it already has 3 branches."
+		o.DefaultStatus = http.StatusCreated
+	})
+
+	// GET /admin/workspaces/{id}/branches endpoint
+	huma.Get(v1, "/admin/workspaces/{id}/branches", s.listBranches, func(o *huma.Operation) {
+		o.Description = "Returns the branches of a workspace created with POST /admin/workspaces/{id}/branch, without their tokens. Requires the admin token."
+	})
+
+	// GET /admin/workspaces/{id}/events endpoint
+	huma.Get(v1, "/admin/workspaces/{id}/events", s.getEventLog, func(o *huma.Operation) {
+		o.Description = "Returns the events of a workspace's event log: its messages, once they're complete, the changes of the agent's status, and the agent's screen whenever it finishes responding, in order. Page through the log by passing the sequence number of the last event returned as 'after'. The log starts when the workspace's agent starts. Requires the admin token. Returns 404 if there's no workspace with the given ID, and 503 if the event log isn't enabled."
+	})
+
+	// POST /admin/workspaces/{id}/restore endpoint
+	huma.Post(v1, "/admin/workspaces/{id}/restore", s.restoreWorkspace, func(o *huma.Operation) {
+		o.Description = "Restores a workspace to an earlier point of its history, given by the sequence number of an event of its event log. Like POST /admin/workspaces/{id}/branch, it creates a branch of the workspace running a new agent, which is sent the user messages of the event log up to that event, one at a time, in the background. Returns the branch's ID and token. Requires the admin token. Returns 400 if the event log has no such event, 404 if there's no workspace with the given ID, 409 if it already has 3 branches, and 503 if the event log isn't enabled."
+		o.DefaultStatus = http.StatusCreated
+	})
+
+	for path := range unversioned {
+		s.router.Handle(path, http.HandlerFunc(s.redirectToVersion))
+	}
+
+	// Endpoints of the workspaces created with POST /admin/workspaces
+	s.router.Handle("/workspaces/{workspace_id}", http.HandlerFunc(s.serveWorkspace))
+	s.router.Handle("/workspaces/{workspace_id}/*", http.HandlerFunc(s.serveWorkspace))
+
+	// GET /metrics endpoint, in the Prometheus text format
+	s.router.Handle("/metrics", metrics)
+
 	s.router.Handle("/", http.HandlerFunc(s.redirectToChat))
 
 	// Serve static files for the chat interface under /chat
@@ -182,17 +804,55 @@ func (s *Server) registerRoutes(chatBasePath string) {
 }
 
 // getHealth handles GET /health
-func (s *Server) getHealth(ctx context.Context, input *struct{}) (*struct {
-	Body struct {
-		Status string `json:"status"`
+func (s *Server) getHealth(ctx context.Context, input *struct{}) (*HealthResponse, error) {
+	// s.mu isn't locked since it's held while a message is sent, and health
+	// checks must not wait for that
+	resp := &HealthResponse{}
+	resp.Body = HealthBody{
+		Status:          "ok",
+		AgentType:       string(s.agentType),
+		UptimeSeconds:   int64(time.Since(s.startTime).Seconds()),
+		TunnelURL:       *s.tunnelURL.Load(),
+		SSEClients:      s.sseConnectionCount(),
+		LastMessageTime: s.lastMessageTime(),
+	}
+	return resp, nil
+}
+
+// messages returns the conversation without the keepalive messages, which
+// are hidden from clients.
+func (s *Server) messages() []st.ConversationMessage {
+	messages := s.conversation.Messages()
+	return slices.DeleteFunc(messages, func(message st.ConversationMessage) bool {
+		return message.Keepalive
+	})
+}
+
+// lastMessageTime returns the time of the last message in the
+// conversation. It's read from the conversation rather than the emitter,
+// which isn't updated while nobody listens to the events.
+func (s *Server) lastMessageTime() time.Time {
+	messages := s.messages()
+	if len(messages) == 0 {
+		return time.Time{}
+	}
+	return messages[len(messages)-1].Time
+}
+
+// getLivez handles GET /livez
+func (s *Server) getLivez(ctx context.Context, input *struct{}) (*LivezResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	resp := &LivezResponse{Status: http.StatusOK}
+	if s.watchdog == nil {
+		resp.Body = WatchdogStatus{Healthy: true, Failures: []WatchdogCheck{}}
+		return resp, nil
+	}
+	resp.Body = s.watchdog.Status()
+	if !resp.Body.Healthy {
+		resp.Status = http.StatusServiceUnavailable
 	}
-}, error) {
-	resp := &struct {
-		Body struct {
-			Status string `json:"status"`
-		}
-	}{}
-	resp.Body.Status = "ok"
 	return resp, nil
 }
 
@@ -201,11 +861,8 @@ func (s *Server) getStatus(ctx context.Context, input *struct{}) (*StatusRespons
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	status := s.conversation.Status()
-	agentStatus := convertStatus(status)
-
 	resp := &StatusResponse{}
-	resp.Body.Status = agentStatus
+	resp.Body.Status = s.agentStatus()
 
 	return resp, nil
 }
@@ -216,8 +873,9 @@ func (s *Server) getMessages(ctx context.Context, input *struct{}) (*MessagesRes
 	defer s.mu.RUnlock()
 
 	resp := &MessagesResponse{}
-	resp.Body.Messages = make([]Message, len(s.conversation.Messages()))
-	for i, msg := range s.conversation.Messages() {
+	messages := s.messages()
+	resp.Body.Messages = make([]Message, len(messages))
+	for i, msg := range messages {
 		resp.Body.Messages[i] = Message{
 			Id:      msg.Id,
 			Role:    msg.Role,
@@ -229,42 +887,275 @@ func (s *Server) getMessages(ctx context.Context, input *struct{}) (*MessagesRes
 	return resp, nil
 }
 
+// getMessageCodeBlocks handles GET /messages/{seq}/code-blocks
+func (s *Server) getMessageCodeBlocks(ctx context.Context, input *CodeBlocksRequest) (*CodeBlocksResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, msg := range s.messages() {
+		if msg.Id == input.Seq {
+			resp := &CodeBlocksResponse{}
+			resp.Body = ExtractCodeBlocks(msg.Message)
+			return resp, nil
+		}
+	}
+
+	return nil, huma.Error404NotFound(fmt.Sprintf("message %d not found", input.Seq))
+}
+
+// validateUserMessage returns a 422 error if the message can't be sent to the agent.
+func (s *Server) validateUserMessage(content string) error {
+	if err := mf.Validate(s.agentType, content); err != nil {
+		var validationErr *mf.ValidationError
+		if errors.As(err, &validationErr) {
+			return huma.Error422UnprocessableEntity(validationErr.Error(), &huma.ErrorDetail{
+				Location: "body.content",
+				Message:  validationErr.Detail,
+				Value:    validationErr.Kind,
+			})
+		}
+		return xerrors.Errorf("failed to validate message: %w", err)
+	}
+	return nil
+}
+
+// cachedResponse sets the cache headers of resp if the response cache is
+// enabled, and reports whether the response to content was served from it.
+func (s *Server) cachedResponse(resp *MessageResponse, content string) bool {
+	if s.responseCache == nil {
+		return false
+	}
+	resp.CacheControl = fmt.Sprintf("max-age=%d", int(s.responseCache.TTL().Seconds()))
+	if cached, ok := s.responseCache.Get(s.agentType, content); ok {
+		resp.Cache = "HIT"
+		resp.Body.CachedResponse = cached
+		return true
+	}
+	resp.Cache = "MISS"
+	return false
+}
+
 // createMessage handles POST /message
 func (s *Server) createMessage(ctx context.Context, input *MessageRequest) (*MessageResponse, error) {
+	start := time.Now()
+	resp, err := s.createOrQueueMessage(ctx, input)
+	s.recordSLO(start, err)
+	return resp, err
+}
+
+// createOrQueueMessage sends the message, or adds it to the message queue
+// if it's enabled.
+func (s *Server) createOrQueueMessage(ctx context.Context, input *MessageRequest) (*MessageResponse, error) {
+	if err := s.applyTemplate(input); err != nil {
+		return nil, err
+	}
+	resp := &MessageResponse{}
+	ran, err := s.runSlashCommand(ctx, input, resp)
+	if err != nil {
+		return nil, err
+	}
+	if ran {
+		return resp, nil
+	}
+	// invalid messages are answered right away rather than once the
+	// agent started or the message is dequeued
+	if input.Body.Type == MessageTypeUser {
+		if err := s.validateUserMessage(input.Body.Content); err != nil {
+			return nil, err
+		}
+	}
+	// raw messages may have to answer a prompt the agent shows while it
+	// starts, so they don't wait for it to be ready
+	if err := s.startAgent(ctx, input.Body.Type == MessageTypeUser); err != nil {
+		return nil, err
+	}
+	queue := s.messageQueue.Load()
+	// raw messages are keystrokes like Ctrl+C that must reach the agent
+	// while it's running, so they're never queued
+	if queue == nil || input.Body.Type != MessageTypeUser {
+		return s.sendMessage(ctx, input)
+	}
+
+	resp.Body.Ok = true
+	// cache hits are answered right away rather than once the message is
+	// dequeued
+	if s.cachedResponse(resp, input.Body.Content) {
+		return resp, nil
+	}
+	position, err := queue.Enqueue(input.Body)
+	if err != nil {
+		return nil, huma.Error503ServiceUnavailable("too many messages are waiting to be sent, try again later", err)
+	}
+	resp.Body.Queued = true
+	resp.Body.Position = position
+	return resp, nil
+}
+
+// sendMessage sends the message to the agent right away.
+func (s *Server) sendMessage(ctx context.Context, input *MessageRequest) (*MessageResponse, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	resp := &MessageResponse{}
+	resp.Body.Ok = true
+
 	switch input.Body.Type {
 	case MessageTypeUser:
+		if err := s.validateUserMessage(input.Body.Content); err != nil {
+			return nil, err
+		}
+		if s.cachedResponse(resp, input.Body.Content) {
+			return resp, nil
+		}
+		s.trimContext(input.Body.Content)
 		if err := s.conversation.SendMessage(FormatMessage(s.agentType, input.Body.Content)...); err != nil {
 			return nil, xerrors.Errorf("failed to send message: %w", err)
 		}
+		// SendMessage returns once the agent started processing the message
+		s.responseLatency.sent(time.Now(), len(input.Body.Content))
+		s.publishMessageSent()
+		if s.responseCache != nil {
+			s.trackPendingResponse(input.Body.Content)
+		}
 	case MessageTypeRaw:
-		if _, err := s.agentio.Write([]byte(input.Body.Content)); err != nil {
+		if _, err := s.process().Write([]byte(input.Body.Content)); err != nil {
 			return nil, xerrors.Errorf("failed to send message: %w", err)
 		}
+		// keystrokes may change the agent's response, e.g. by answering
+		// a prompt, so it's no longer safe to cache it
+		s.cacheMu.Lock()
+		s.pendingResponse = nil
+		s.cacheMu.Unlock()
 	}
 
-	resp := &MessageResponse{}
-	resp.Body.Ok = true
-
 	return resp, nil
 }
 
+// publishMessageSent publishes the user message that was just sent to
+// the agent on the server's bus.
+func (s *Server) publishMessageSent() {
+	messages := s.messages()
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == st.ConversationRoleUser {
+			s.bus.Publish(events.TopicMessageSent, messages[i])
+			return
+		}
+	}
+}
+
+// dispatchMessage sends a queued user message once the agent is waiting for
+// input, and waits for the agent to finish responding to it. The client
+// that queued the message has already been answered, so failures are
+// reported with a message_failed event.
+func (s *Server) dispatchMessage(ctx context.Context, message MessageRequestBody) {
+	fail := func(msg string, err error) {
+		s.logger.Error(msg, "error", err)
+		// the queue is discarded when the server stops
+		if ctx.Err() != nil {
+			return
+		}
+		s.emitter.EmitMessageFailed(MessageFailedBody{
+			Type:    "message_failed",
+			Content: message.Content,
+			Error:   err.Error(),
+		})
+	}
+	if err := s.startAgent(ctx, true); err != nil {
+		fail("Failed to start the agent before sending queued message", err)
+		return
+	}
+	if err := s.waitForStableStatus(ctx); err != nil {
+		fail("Failed to wait for the agent before sending queued message", err)
+		return
+	}
+	if _, err := s.sendMessage(ctx, &MessageRequest{Body: message}); err != nil {
+		fail("Failed to send queued message", err)
+		return
+	}
+	if err := s.waitForStableStatus(ctx); err != nil {
+		s.logger.Error("Failed to wait for the agent to respond to queued message", "error", err)
+	}
+}
+
+func (s *Server) waitForStableStatus(ctx context.Context) error {
+	for s.conversation.Status() != st.ConversationStatusStable {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(snapshotInterval):
+		}
+	}
+	return nil
+}
+
 // subscribeEvents is an SSE endpoint that sends events to the client
-func (s *Server) subscribeEvents(ctx context.Context, input *struct{}, send sse.Sender) {
+func (s *Server) subscribeEvents(ctx context.Context, input *SubscribeEventsRequest, send sse.Sender) {
 	subscriberId, ch, stateEvents := s.emitter.Subscribe()
 	defer s.emitter.Unsubscribe(subscriberId)
-	s.logger.Info("New subscriber", "subscriberId", subscriberId)
+	connectionId, closeConnection := s.trackSSEConnection()
+	defer closeConnection()
+	defer s.snapshotDemand.acquire()()
+	s.logger.Info("New subscriber", "subscriberId", subscriberId, "connectionId", connectionId)
+	// a gap of half the write timeout closes the connection already, so
+	// that the poor quality event can still be delivered
+	quality := newNetworkQualityMonitor(s.sseWriteGuard.Timeout() / 2)
+	sendData := func(payload any) error {
+		start := time.Now()
+		if err := send.Data(payload); err != nil {
+			return err
+		}
+		qualityEvent, timedOut := quality.observe(start, time.Now(), len(ch) > 0)
+		if qualityEvent != nil && input.subscribed(qualityEvent.Type) {
+			sseNetworkQualityEvents.Inc(string(qualityEvent.Quality))
+			if err := send.Data(*qualityEvent); err != nil {
+				return err
+			}
+		}
+		if timedOut {
+			return errSSEWriteTimeout
+		}
+		return nil
+	}
+	snapshot := s.sendSnapshot(input)
+	if err := send.Data(input.subscribedEvent()); err != nil {
+		s.logger.Error("Failed to send event", "subscriberId", subscriberId, "error", err)
+		return
+	}
+	if snapshot != nil {
+		if err := sendData(*snapshot); err != nil {
+			s.logger.Error("Failed to send event", "subscriberId", subscriberId, "error", err)
+			return
+		}
+	}
 	for _, event := range stateEvents {
-		if event.Type == EventTypeScreenUpdate {
+		// in diff mode, the first diff builds the current screen from an
+		// empty one
+		if event.Type == EventTypeScreenUpdate && input.Mode == eventsModeDiff {
+			diff := st.DiffScreens("", event.Payload.(ScreenUpdateBody).Screen)
+			event = Event{Type: EventTypeTermDiff, Payload: TermDiffBody{Ops: diff.Ops}}
+		}
+		if !input.sends(event.Type) {
 			continue
 		}
-		if err := send.Data(event.Payload); err != nil {
+		if err := sendData(event.Payload); err != nil {
 			s.logger.Error("Failed to send event", "subscriberId", subscriberId, "error", err)
 			return
 		}
 	}
+	// throttle limits the line events. throttled fires once lines can be
+	// sent again after some were dropped.
+	var throttle *ProductionRateLimiter
+	if s.sseMaxEventsPerSecond > 0 {
+		throttle = NewProductionRateLimiter(s.sseMaxEventsPerSecond)
+	}
+	var throttled <-chan time.Time
+	sendThrottled := func() error {
+		throttled = nil
+		if dropped := throttle.TakeDropped(); dropped > 0 {
+			return sendData(ThrottledBody{Type: "throttled", Dropped: dropped})
+		}
+		return nil
+	}
 	for {
 		select {
 		case event, ok := <-ch:
@@ -272,13 +1163,36 @@ func (s *Server) subscribeEvents(ctx context.Context, input *struct{}, send sse.
 				s.logger.Info("Channel closed", "subscriberId", subscriberId)
 				return
 			}
-			if event.Type == EventTypeScreenUpdate {
+			if !input.sends(event.Type) {
 				continue
 			}
-			if err := send.Data(event.Payload); err != nil {
+			if event.Type == EventTypeLine && throttle != nil {
+				if !throttle.Allow() {
+					sseThrottledEvents.Inc()
+					if throttled == nil {
+						throttled = time.After(throttle.Wait())
+					}
+					continue
+				}
+				if err := sendThrottled(); err != nil {
+					s.logger.Error("Failed to send event", "subscriberId", subscriberId, "error", err)
+					return
+				}
+			}
+			if err := sendData(event.Payload); err != nil {
 				s.logger.Error("Failed to send event", "subscriberId", subscriberId, "error", err)
 				return
 			}
+		case <-throttled:
+			if err := sendThrottled(); err != nil {
+				s.logger.Error("Failed to send event", "subscriberId", subscriberId, "error", err)
+				return
+			}
+		case <-s.shutdown:
+			if err := send.Data(serverShutdownEvent); err != nil {
+				s.logger.Error("Failed to send shutdown event", "subscriberId", subscriberId, "error", err)
+			}
+			return
 		case <-ctx.Done():
 			s.logger.Info("Context done", "subscriberId", subscriberId)
 			return
@@ -289,7 +1203,10 @@ func (s *Server) subscribeEvents(ctx context.Context, input *struct{}, send sse.
 func (s *Server) subscribeScreen(ctx context.Context, input *struct{}, send sse.Sender) {
 	subscriberId, ch, stateEvents := s.emitter.Subscribe()
 	defer s.emitter.Unsubscribe(subscriberId)
-	s.logger.Info("New screen subscriber", "subscriberId", subscriberId)
+	connectionId, closeConnection := s.trackSSEConnection()
+	defer closeConnection()
+	defer s.snapshotDemand.acquire()()
+	s.logger.Info("New screen subscriber", "subscriberId", subscriberId, "connectionId", connectionId)
 	for _, event := range stateEvents {
 		if event.Type != EventTypeScreenUpdate {
 			continue
@@ -313,6 +1230,11 @@ func (s *Server) subscribeScreen(ctx context.Context, input *struct{}, send sse.
 				s.logger.Error("Failed to send screen event", "subscriberId", subscriberId, "error", err)
 				return
 			}
+		case <-s.shutdown:
+			if err := send.Data(serverShutdownEvent); err != nil {
+				s.logger.Error("Failed to send shutdown event", "subscriberId", subscriberId, "error", err)
+			}
+			return
 		case <-ctx.Done():
 			s.logger.Info("Screen context done", "subscriberId", subscriberId)
 			return
@@ -320,19 +1242,82 @@ func (s *Server) subscribeScreen(ctx context.Context, input *struct{}, send sse.
 	}
 }
 
+// EnableUnixSocket makes Start listen on a Unix domain socket at path,
+// which only the current user can connect to. If tcp is false, the server
+// doesn't listen on its TCP port.
+func (s *Server) EnableUnixSocket(path string, tcp bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.unixSocket = path
+	s.unixSocketOnly = !tcp
+}
+
+// OnListening sets a function that Start calls once the server listens,
+// before it serves any request.
+func (s *Server) OnListening(fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onListening = fn
+}
+
 // Start starts the HTTP server
 func (s *Server) Start() error {
 	addr := fmt.Sprintf(":%d", s.port)
 	s.srv = &http.Server{
-		Addr:    addr,
-		Handler: s.router,
+		Addr:        addr,
+		Handler:     s.h2cHandler(s.handler()),
+		ConnContext: connContext,
 	}
 
-	return s.srv.ListenAndServe()
+	s.mu.RLock()
+	unixSocket, unixSocketOnly, onListening := s.unixSocket, s.unixSocketOnly, s.onListening
+	s.mu.RUnlock()
+
+	listeners := []net.Listener{}
+	if unixSocket != "" {
+		unixListener, err := listenUnix(unixSocket)
+		if err != nil {
+			return xerrors.Errorf("failed to listen on unix socket: %w", err)
+		}
+		listeners = append(listeners, unixListener)
+	}
+	if unixSocket == "" || !unixSocketOnly {
+		tcpListener, err := net.Listen("tcp", addr)
+		if err != nil {
+			for _, listener := range listeners {
+				_ = listener.Close()
+			}
+			return xerrors.Errorf("failed to listen on port %d: %w", s.port, err)
+		}
+		listeners = append(listeners, tcpListener)
+	}
+	if onListening != nil {
+		onListening()
+	}
+	errCh := make(chan error, len(listeners))
+	for _, listener := range listeners {
+		go func() {
+			errCh <- s.srv.Serve(listener)
+		}()
+	}
+	// Both listeners are closed on shutdown, so the first error is the
+	// reason the server stopped.
+	err := <-errCh
+	if err != http.ErrServerClosed {
+		_ = s.srv.Close()
+	}
+	return err
 }
 
-// Stop gracefully stops the HTTP server
+// Stop gracefully stops the HTTP server. SSE subscribers are notified with
+// a server_shutdown event before their connections are closed.
 func (s *Server) Stop(ctx context.Context) error {
+	s.mu.RLock()
+	if s.webrtc != nil {
+		s.webrtc.Close()
+	}
+	s.mu.RUnlock()
+	s.drainSSEConnections(ctx)
 	if s.srv != nil {
 		return s.srv.Shutdown(ctx)
 	}
@@ -349,5 +1334,5 @@ func (s *Server) registerStaticFileRoutes(chatBasePath string) {
 }
 
 func (s *Server) redirectToChat(w http.ResponseWriter, r *http.Request) {
-	http.Redirect(w, r, "/chat/embed", http.StatusTemporaryRedirect)
+	http.Redirect(w, r, s.basePath+"/chat/embed", http.StatusTemporaryRedirect)
 }
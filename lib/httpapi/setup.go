@@ -3,6 +3,7 @@ package httpapi
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
 	"strings"
@@ -14,10 +15,50 @@ import (
 )
 
 type SetupProcessConfig struct {
-	Program        string
-	ProgramArgs    []string
-	TerminalWidth  uint16
-	TerminalHeight uint16
+	Program     string
+	ProgramArgs []string
+	// BinarySearchPaths are directories Program is looked up in before
+	// PATH. See termexec.StartProcessConfig.
+	BinarySearchPaths []string
+	Dir               string
+	TerminalWidth     uint16
+	TerminalHeight    uint16
+	Output            io.Writer
+	// Stdout receives the agent's standard output separately from its
+	// terminal, if set. See termexec.StartProcessConfig.
+	Stdout io.Writer
+	// WriteRateLimiter limits how fast input is written to the agent.
+	WriteRateLimiter termexec.WriteRateLimiter
+	// BatchWrites sends the input written within a few milliseconds to
+	// the agent at once. See termexec.StartProcessConfig.
+	BatchWrites bool
+	// NicePriority and IOPriorityClass set the agent's CPU and IO
+	// priority. See termexec.StartProcessConfig.
+	NicePriority    int
+	IOPriorityClass string
+	// Sandbox and SandboxExecAllowlist isolate the agent from the rest of
+	// the machine. See termexec.StartProcessConfig.
+	Sandbox              termexec.SandboxLevel
+	SandboxExecAllowlist []string
+	// PreinjectLines are written to the agent once it's ready, before
+	// SetupProcess returns. See termexec.StartProcessConfig.
+	PreinjectLines []string
+	PreinjectDelay time.Duration
+	// Env holds environment variables set for the agent only. See
+	// termexec.StartProcessConfig.
+	Env map[string]string
+	// TermType and ColorProfile set the agent's TERM and COLORTERM
+	// environment variables. See termexec.StartProcessConfig.
+	TermType     string
+	ColorProfile string
+	// LogFile is a file the agent's terminal output is appended to, if
+	// set. See termexec.StartProcessConfig.
+	LogFile string
+	// HealthCheck is the agent's HTTP health endpoint, which must pass
+	// within StartupTimeout before SetupProcess returns, if set. See
+	// termexec.StartProcessConfig.
+	HealthCheck    *termexec.HealthCheckConfig
+	StartupTimeout time.Duration
 }
 
 func SetupProcess(ctx context.Context, config SetupProcessConfig) (*termexec.Process, error) {
@@ -26,10 +67,28 @@ func SetupProcess(ctx context.Context, config SetupProcessConfig) (*termexec.Pro
 	logger.Info(fmt.Sprintf("Running: %s %s", config.Program, strings.Join(config.ProgramArgs, " ")))
 
 	process, err := termexec.StartProcess(ctx, termexec.StartProcessConfig{
-		Program:        config.Program,
-		Args:           config.ProgramArgs,
-		TerminalWidth:  config.TerminalWidth,
-		TerminalHeight: config.TerminalHeight,
+		Program:              config.Program,
+		Args:                 config.ProgramArgs,
+		BinarySearchPaths:    config.BinarySearchPaths,
+		Dir:                  config.Dir,
+		TerminalWidth:        config.TerminalWidth,
+		TerminalHeight:       config.TerminalHeight,
+		Output:               config.Output,
+		Stdout:               config.Stdout,
+		WriteRateLimiter:     config.WriteRateLimiter,
+		BatchWrites:          config.BatchWrites,
+		NicePriority:         config.NicePriority,
+		IOPriorityClass:      config.IOPriorityClass,
+		Sandbox:              config.Sandbox,
+		SandboxExecAllowlist: config.SandboxExecAllowlist,
+		PreinjectLines:       config.PreinjectLines,
+		PreinjectDelay:       config.PreinjectDelay,
+		Env:                  config.Env,
+		TermType:             config.TermType,
+		ColorProfile:         config.ColorProfile,
+		LogFile:              config.LogFile,
+		HealthCheck:          config.HealthCheck,
+		StartupTimeout:       config.StartupTimeout,
 	})
 	if err != nil {
 		logger.Error(fmt.Sprintf("Error starting process: %v", err))
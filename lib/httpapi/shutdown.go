@@ -0,0 +1,48 @@
+package httpapi
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// trackSSEConnection registers an SSE connection. The returned function
+// must be called once the connection is closed.
+func (s *Server) trackSSEConnection() (string, func()) {
+	id := uuid.NewString()
+	closed := make(chan struct{})
+	s.sseConns.Store(id, closed)
+	return id, func() {
+		s.sseConns.Delete(id)
+		close(closed)
+	}
+}
+
+// drainSSEConnections sends a server_shutdown event to all SSE subscribers
+// and waits up to sseDrainTimeout for their connections to close.
+func (s *Server) drainSSEConnections(ctx context.Context) {
+	s.shutdownOnce.Do(func() { close(s.shutdown) })
+	timeout := time.After(s.sseDrainTimeout)
+	s.sseConns.Range(func(key, value any) bool {
+		select {
+		case <-value.(chan struct{}):
+			return true
+		case <-timeout:
+			s.logger.Warn("Timed out waiting for SSE connections to drain")
+			return false
+		case <-ctx.Done():
+			return false
+		}
+	})
+}
+
+// sseConnectionCount returns the number of active SSE connections.
+func (s *Server) sseConnectionCount() int {
+	count := 0
+	s.sseConns.Range(func(key, value any) bool {
+		count++
+		return true
+	})
+	return count
+}
@@ -0,0 +1,59 @@
+package httpapi
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	mf "github.com/zohaibahmed/clauder/lib/msgfmt"
+)
+
+func TestStopDrainsSSEConnections(t *testing.T) {
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(os.Stdout, nil)))
+	srv := NewServer(ctx, mf.AgentTypeClaude, nil, 0, "/chat")
+	httpSrv := httptest.NewServer(srv.router)
+	defer httpSrv.Close()
+
+	resp, err := http.Get(httpSrv.URL + "/v1/events")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+	// wait for the initial state so that the connection is registered
+	_, err = reader.ReadString('\n')
+	require.NoError(t, err)
+
+	stopped := make(chan time.Duration)
+	go func() {
+		start := time.Now()
+		assert.NoError(t, srv.Stop(ctx))
+		stopped <- time.Since(start)
+	}()
+
+	rest, err := io.ReadAll(reader)
+	require.NoError(t, err, "the connection must be closed cleanly")
+	assert.Contains(t, string(rest), "event: server_shutdown\ndata: {\"type\":\"server_shutdown\",\"reason\":\"graceful\"}")
+	assert.Less(t, <-stopped, srv.sseDrainTimeout, "stop must not wait for the timeout once connections are drained")
+}
+
+func TestStopSSEDrainTimeout(t *testing.T) {
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(os.Stdout, nil)))
+	srv := NewServer(ctx, mf.AgentTypeClaude, nil, 0, "/chat")
+	srv.sseDrainTimeout = 200 * time.Millisecond
+	// a connection that never closes
+	_, _ = srv.trackSSEConnection()
+
+	start := time.Now()
+	require.NoError(t, srv.Stop(ctx))
+	elapsed := time.Since(start)
+	assert.GreaterOrEqual(t, elapsed, srv.sseDrainTimeout)
+	assert.Less(t, elapsed, srv.sseDrainTimeout+time.Second)
+}
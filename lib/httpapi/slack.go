@@ -0,0 +1,191 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/zohaibahmed/clauder/lib/events"
+	"golang.org/x/xerrors"
+)
+
+type SlackEvent string
+
+const (
+	// SlackEventTaskCompleted is sent when the agent finished responding to
+	// a message.
+	SlackEventTaskCompleted SlackEvent = "task_completed"
+	// SlackEventAgentExited is sent when the agent process exits
+	// unexpectedly.
+	SlackEventAgentExited SlackEvent = "agent_exited"
+	// SlackEventTunnelReconnected is sent when the server's public URL
+	// changes.
+	SlackEventTunnelReconnected SlackEvent = "tunnel_reconnected"
+)
+
+// slackDedupWindow is how long notifications of an event are suppressed
+// after one was sent.
+const slackDedupWindow = 60 * time.Second
+
+var slackEventTitles = map[SlackEvent]string{
+	SlackEventTaskCompleted:     ":white_check_mark: Agent finished its task",
+	SlackEventAgentExited:       ":x: Agent exited unexpectedly",
+	SlackEventTunnelReconnected: ":link: Tunnel reconnected",
+}
+
+// slackMessage is the payload of a Slack incoming webhook.
+// See https://api.slack.com/messaging/webhooks.
+type slackMessage struct {
+	// Text is shown in notifications and by clients that can't render
+	// blocks.
+	Text   string       `json:"text"`
+	Blocks []slackBlock `json:"blocks"`
+}
+
+type slackBlock struct {
+	Type     string      `json:"type"`
+	Text     *slackText  `json:"text,omitempty"`
+	Elements []slackText `json:"elements,omitempty"`
+}
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// SlackNotifier posts messages about the agent to a Slack incoming webhook.
+// An event isn't posted again within 60 seconds of the last time it was.
+type SlackNotifier struct {
+	webhookURL string
+	client     *http.Client
+	getTime    func() time.Time
+
+	mu       sync.Mutex
+	lastSent map[SlackEvent]time.Time
+}
+
+func NewSlackNotifier(webhookURL string) *SlackNotifier {
+	return &SlackNotifier{
+		webhookURL: webhookURL,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		getTime:    time.Now,
+		lastSent:   make(map[SlackEvent]time.Time),
+	}
+}
+
+// Notify posts a message about event with the given details. It returns
+// false without posting if the event was posted less than 60 seconds ago.
+func (n *SlackNotifier) Notify(ctx context.Context, event SlackEvent, details string) (bool, error) {
+	n.mu.Lock()
+	now := n.getTime()
+	if last, ok := n.lastSent[event]; ok && now.Sub(last) < slackDedupWindow {
+		n.mu.Unlock()
+		return false, nil
+	}
+	// recorded before posting, so that concurrent notifications of the
+	// same event are deduplicated too
+	n.lastSent[event] = now
+	n.mu.Unlock()
+
+	data, err := json.Marshal(newSlackMessage(event, details))
+	if err != nil {
+		return false, xerrors.Errorf("failed to marshal slack message: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.webhookURL, bytes.NewReader(data))
+	if err != nil {
+		return false, xerrors.Errorf("failed to create slack request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return false, xerrors.Errorf("failed to post slack message: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return false, xerrors.Errorf("slack webhook returned %d: %s", resp.StatusCode, body)
+	}
+	return true, nil
+}
+
+func newSlackMessage(event SlackEvent, details string) slackMessage {
+	title := slackEventTitles[event]
+	host, _ := os.Hostname()
+	return slackMessage{
+		Text: fmt.Sprintf("%s: %s", title, details),
+		Blocks: []slackBlock{
+			{Type: "section", Text: &slackText{Type: "mrkdwn", Text: fmt.Sprintf("*%s*\n%s", title, details)}},
+			{Type: "context", Elements: []slackText{{Type: "mrkdwn", Text: fmt.Sprintf("clauder on `%s`", host)}}},
+		},
+	}
+}
+
+// EnableSlackNotifications makes the server post to Slack when the agent
+// finishes responding to a message and when its public URL changes.
+func (s *Server) EnableSlackNotifications(ctx context.Context, notifier *SlackNotifier) {
+	s.slack.Store(notifier)
+	go s.notifyTaskCompletions(ctx)
+}
+
+// notifySlack posts a notification in the background, if Slack
+// notifications are enabled.
+func (s *Server) notifySlack(ctx context.Context, event SlackEvent, details string) {
+	notifier := s.slack.Load()
+	if notifier == nil {
+		return
+	}
+	go func() {
+		if _, err := notifier.Notify(ctx, event, details); err != nil {
+			s.logger.Error("Failed to send Slack notification", "event", event, "error", err)
+		}
+	}()
+}
+
+// notifyTaskCompletions notifies Slack when the agent finishes responding
+// to a message.
+func (s *Server) notifyTaskCompletions(ctx context.Context) {
+	s.watchTaskCompletions(ctx, func(elapsed time.Duration) {
+		details := fmt.Sprintf("The %s agent finished responding after %s.", s.agentType, elapsed.Round(time.Second))
+		s.notifySlack(ctx, SlackEventTaskCompleted, details)
+	})
+}
+
+// watchTaskCompletions calls onCompleted with how long the agent took when
+// it becomes stable after a user message was sent to it, until ctx is
+// done. Status changes that aren't caused by a message, like the agent
+// starting up, are ignored.
+func (s *Server) watchTaskCompletions(ctx context.Context, onCompleted func(elapsed time.Duration)) {
+	messages := s.bus.Subscribe(events.TopicMessageSent)
+	defer s.bus.Unsubscribe(events.TopicMessageSent, messages)
+	subscriberId, ch, _ := s.emitter.Subscribe()
+	defer s.emitter.Unsubscribe(subscriberId)
+	defer s.snapshotDemand.acquire()()
+
+	var sentAt time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-messages:
+			sentAt = time.Now()
+		case event, ok := <-ch:
+			if !ok {
+				s.logger.Error("Task completion watcher fell behind on events")
+				return
+			}
+			body, isStatus := event.Payload.(StatusChangeBody)
+			if !isStatus || body.Status != AgentStatusStable || sentAt.IsZero() {
+				continue
+			}
+			elapsed := time.Since(sentAt)
+			sentAt = time.Time{}
+			onCompleted(elapsed)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/events"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	mf "github.com/zohaibahmed/clauder/lib/msgfmt"
+	st "github.com/zohaibahmed/clauder/lib/screentracker"
+)
+
+// mockSlack records the payloads posted to it.
+type mockSlack struct {
+	mu       sync.Mutex
+	payloads []map[string]any
+	status   int
+}
+
+func newMockSlack(t *testing.T) (*mockSlack, *httptest.Server) {
+	m := &mockSlack{status: http.StatusOK}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		var payload map[string]any
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.payloads = append(m.payloads, payload)
+		w.WriteHeader(m.status)
+		_, _ = io.WriteString(w, "ok")
+	}))
+	t.Cleanup(srv.Close)
+	return m, srv
+}
+
+func (m *mockSlack) Payloads() []map[string]any {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]map[string]any(nil), m.payloads...)
+}
+
+func TestSlackNotifierPayload(t *testing.T) {
+	slack, slackSrv := newMockSlack(t)
+	notifier := NewSlackNotifier(slackSrv.URL)
+
+	sent, err := notifier.Notify(context.Background(), SlackEventAgentExited, "The claude agent exited: exit status 1")
+	require.NoError(t, err)
+	assert.True(t, sent)
+
+	payloads := slack.Payloads()
+	require.Len(t, payloads, 1)
+	payload := payloads[0]
+	assert.Equal(t, ":x: Agent exited unexpectedly: The claude agent exited: exit status 1", payload["text"])
+	blocks, ok := payload["blocks"].([]any)
+	require.True(t, ok)
+	require.Len(t, blocks, 2)
+	section := blocks[0].(map[string]any)
+	assert.Equal(t, "section", section["type"])
+	assert.Equal(t, map[string]any{"type": "mrkdwn", "text": "*:x: Agent exited unexpectedly*\nThe claude agent exited: exit status 1"}, section["text"])
+	contextBlock := blocks[1].(map[string]any)
+	assert.Equal(t, "context", contextBlock["type"])
+	elements := contextBlock["elements"].([]any)
+	require.Len(t, elements, 1)
+	assert.Contains(t, elements[0].(map[string]any)["text"], "clauder on ")
+}
+
+func TestSlackNotifierDeduplication(t *testing.T) {
+	slack, slackSrv := newMockSlack(t)
+	notifier := NewSlackNotifier(slackSrv.URL)
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	notifier.getTime = func() time.Time { return now }
+	ctx := context.Background()
+
+	sent, err := notifier.Notify(ctx, SlackEventTaskCompleted, "first")
+	require.NoError(t, err)
+	assert.True(t, sent)
+
+	now = now.Add(30 * time.Second)
+	sent, err = notifier.Notify(ctx, SlackEventTaskCompleted, "second")
+	require.NoError(t, err)
+	assert.False(t, sent, "the same event is deduplicated for 60 seconds")
+	sent, err = notifier.Notify(ctx, SlackEventTunnelReconnected, "other")
+	require.NoError(t, err)
+	assert.True(t, sent, "other events aren't")
+
+	now = now.Add(31 * time.Second)
+	sent, err = notifier.Notify(ctx, SlackEventTaskCompleted, "third")
+	require.NoError(t, err)
+	assert.True(t, sent)
+
+	var texts []string
+	for _, payload := range slack.Payloads() {
+		texts = append(texts, payload["text"].(string))
+	}
+	assert.Equal(t, []string{
+		":white_check_mark: Agent finished its task: first",
+		":link: Tunnel reconnected: other",
+		":white_check_mark: Agent finished its task: third",
+	}, texts)
+}
+
+func TestSlackNotifierError(t *testing.T) {
+	slack, slackSrv := newMockSlack(t)
+	slack.status = http.StatusNotFound
+	notifier := NewSlackNotifier(slackSrv.URL)
+	sent, err := notifier.Notify(context.Background(), SlackEventTaskCompleted, "done")
+	assert.ErrorContains(t, err, "slack webhook returned 404: ok")
+	assert.False(t, sent)
+}
+
+func TestServerSlackNotifications(t *testing.T) {
+	slack, slackSrv := newMockSlack(t)
+	ctx, cancel := context.WithCancel(logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil))))
+	defer cancel()
+	srv := NewServer(ctx, mf.AgentTypeClaude, nil, 0, "/chat")
+	srv.SetTunnelURL("https://first.example.com")
+	srv.EnableSlackNotifications(ctx, NewSlackNotifier(slackSrv.URL))
+
+	// the agent starting up isn't a task
+	srv.emitter.UpdateStatusAndEmitChanges(st.ConversationStatusStable)
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, slack.Payloads())
+
+	// wait for the notifier to subscribe to the bus
+	require.Eventually(t, func() bool {
+		srv.bus.Publish(events.TopicMessageSent, st.ConversationMessage{Role: st.ConversationRoleUser, Message: "hi"})
+		srv.emitter.UpdateStatusAndEmitChanges(st.ConversationStatusChanging)
+		srv.emitter.UpdateStatusAndEmitChanges(st.ConversationStatusStable)
+		return len(slack.Payloads()) == 1
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.Contains(t, slack.Payloads()[0]["text"], "The claude agent finished responding after")
+
+	srv.SetTunnelURL("https://first.example.com")
+	time.Sleep(50 * time.Millisecond)
+	assert.Len(t, slack.Payloads(), 1, "the URL didn't change")
+	srv.SetTunnelURL("https://second.example.com")
+	require.Eventually(t, func() bool { return len(slack.Payloads()) == 2 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, ":link: Tunnel reconnected: The server is now reachable at https://second.example.com.", slack.Payloads()[1]["text"])
+}
@@ -0,0 +1,168 @@
+package httpapi
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/danielgtaylor/huma/v2"
+	st "github.com/zohaibahmed/clauder/lib/screentracker"
+	"golang.org/x/xerrors"
+)
+
+// SlashCommandHandler runs a slash command with its arguments, and returns
+// the details shown below the confirmation, if any.
+type SlashCommandHandler func(ctx context.Context, args []string) (string, error)
+
+type slashCommand struct {
+	// args is the number of arguments the command takes.
+	args    int
+	usage   string
+	handler SlashCommandHandler
+}
+
+// SlashCommandParser recognises the messages that are slash commands, like
+// "/resize 200 50", so that clients can control the agent by sending a
+// message instead of calling another endpoint. Messages starting with an
+// unknown command, like the agent's own slash commands or a path, aren't
+// slash commands. Commands must be registered before the parser is used.
+type SlashCommandParser struct {
+	commands map[string]slashCommand
+}
+
+func NewSlashCommandParser() *SlashCommandParser {
+	return &SlashCommandParser{commands: make(map[string]slashCommand)}
+}
+
+// Register adds the command /name, which takes args arguments, described
+// by usage, e.g. "/resize <cols> <rows>".
+func (p *SlashCommandParser) Register(name string, args int, usage string, handler SlashCommandHandler) {
+	p.commands[name] = slashCommand{args: args, usage: usage, handler: handler}
+}
+
+// Parse returns the name and arguments of the slash command in message,
+// and false if it isn't one. A registered command with the wrong number of
+// arguments is a 422 error.
+func (p *SlashCommandParser) Parse(message string) (string, []string, bool, error) {
+	fields := strings.Fields(message)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+		return "", nil, false, nil
+	}
+	name := strings.TrimPrefix(fields[0], "/")
+	command, ok := p.commands[name]
+	if !ok {
+		return "", nil, false, nil
+	}
+	args := fields[1:]
+	if len(args) != command.args {
+		return "", nil, false, huma.Error422UnprocessableEntity("usage: " + command.usage)
+	}
+	return name, args, true, nil
+}
+
+// Run runs the slash command name, returned by Parse, and returns the
+// message that confirms it ran.
+func (p *SlashCommandParser) Run(ctx context.Context, name string, args []string) (string, error) {
+	details, err := p.commands[name].handler(ctx, args)
+	if err != nil {
+		return "", err
+	}
+	response := "Command executed: /" + strings.Join(append([]string{name}, args...), " ")
+	if details != "" {
+		response += "\n\n" + details
+	}
+	return response, nil
+}
+
+// EnableSlashCommands makes POST /message run the user messages that are
+// slash commands instead of sending them to the agent, and answer them
+// with a confirmation in command_response:
+//
+//   - /resize <cols> <rows> resizes the agent's terminal
+//   - /status returns the agent's status
+//   - /export returns the conversation as Markdown
+//   - /restart calls restart, e.g. to stop the agent so that a supervisor
+//     starts it again. It's passed on to the agent if restart is nil.
+//
+// The agent's own slash commands with the same names are shadowed.
+func (s *Server) EnableSlashCommands(restart func() error) {
+	parser := NewSlashCommandParser()
+	parser.Register("resize", 2, "/resize <cols> <rows>", s.resizeCommand)
+	parser.Register("status", 0, "/status", s.statusCommand)
+	parser.Register("export", 0, "/export", s.exportCommand)
+	if restart != nil {
+		parser.Register("restart", 0, "/restart", func(ctx context.Context, args []string) (string, error) {
+			s.logger.Info("Restarting the agent on a slash command")
+			if err := restart(); err != nil {
+				return "", xerrors.Errorf("failed to restart the agent: %w", err)
+			}
+			return "", nil
+		})
+	}
+	s.slashCommands.Store(parser)
+}
+
+// runSlashCommand runs the slash command in the message, and returns false
+// if it isn't one.
+func (s *Server) runSlashCommand(ctx context.Context, input *MessageRequest, resp *MessageResponse) (bool, error) {
+	parser := s.slashCommands.Load()
+	if parser == nil || input.Body.Type != MessageTypeUser {
+		return false, nil
+	}
+	name, args, ok, err := parser.Parse(input.Body.Content)
+	if !ok || err != nil {
+		return false, err
+	}
+	response, err := parser.Run(ctx, name, args)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Ok = true
+	resp.Body.CommandResponse = response
+	return true, nil
+}
+
+func (s *Server) resizeCommand(ctx context.Context, args []string) (string, error) {
+	process := s.process()
+	if process == nil {
+		return "", huma.Error503ServiceUnavailable("the agent's terminal can't be resized")
+	}
+	var size [2]uint16
+	for i, arg := range args {
+		n, err := strconv.ParseUint(arg, 10, 16)
+		if err != nil || n < 10 {
+			return "", huma.Error422UnprocessableEntity(fmt.Sprintf("invalid size %q, must be a number of at least 10", arg))
+		}
+		size[i] = uint16(n)
+	}
+	if err := process.Resize(size[0], size[1]); err != nil {
+		return "", xerrors.Errorf("failed to resize the agent's terminal: %w", err)
+	}
+	s.logger.Info("Resized the agent's terminal", "width", size[0], "height", size[1])
+	s.emitter.EmitPTYResized(int(size[0]), int(size[1]))
+	return "", nil
+}
+
+func (s *Server) statusCommand(ctx context.Context, args []string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return fmt.Sprintf("The agent is %s.", s.agentStatus()), nil
+}
+
+func (s *Server) exportCommand(ctx context.Context, args []string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var export strings.Builder
+	for i, message := range s.messages() {
+		if i > 0 {
+			export.WriteString("\n\n")
+		}
+		role := "Agent"
+		if message.Role == st.ConversationRoleUser {
+			role = "User"
+		}
+		fmt.Fprintf(&export, "## %s\n\n%s", role, message.Message)
+	}
+	return export.String(), nil
+}
@@ -0,0 +1,156 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"os/exec"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	st "github.com/zohaibahmed/clauder/lib/screentracker"
+	"github.com/zohaibahmed/clauder/lib/termexec"
+)
+
+func TestSlashCommandParser(t *testing.T) {
+	p := NewSlashCommandParser()
+	p.Register("resize", 2, "/resize <cols> <rows>", func(ctx context.Context, args []string) (string, error) {
+		return "", nil
+	})
+
+	name, args, ok, err := p.Parse("  /resize 200\t50\n")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "resize", name)
+	assert.Equal(t, []string{"200", "50"}, args)
+	response, err := p.Run(context.Background(), name, args)
+	require.NoError(t, err)
+	assert.Equal(t, "Command executed: /resize 200 50", response)
+
+	for _, message := range []string{"", "resize 200 50", "/compact", "/usr/bin/env fails", "please /resize 200 50"} {
+		_, _, ok, err := p.Parse(message)
+		assert.NoError(t, err, message)
+		assert.False(t, ok, message)
+	}
+	_, _, _, err = p.Parse("/resize 200")
+	assert.ErrorContains(t, err, "usage: /resize <cols> <rows>")
+}
+
+func TestSlashCommands(t *testing.T) {
+	ctx, cancel := context.WithCancel(logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil))))
+	defer cancel()
+	agent := &echoAgent{}
+	srv, httpSrv := newRoutingTestServer(t, ctx, agent)
+	restarts := 0
+	srv.EnableSlashCommands(func() error {
+		restarts++
+		return nil
+	})
+	require.Eventually(t, func() bool {
+		return srv.conversation.Status() == st.ConversationStatusStable
+	}, 5*time.Second, 10*time.Millisecond)
+	send := func(content string) (int, MessageResponse) {
+		var resp MessageResponse
+		status := doJSON(t, http.MethodPost, httpSrv.URL+"/v1/message", `{"type":"user","content":"`+content+`"}`, &resp.Body)
+		return status, resp
+	}
+
+	// normal messages and unknown slash commands go to the agent
+	status, resp := send("hello there agent")
+	require.Equal(t, http.StatusOK, status)
+	assert.Empty(t, resp.Body.CommandResponse)
+	require.Eventually(t, func() bool {
+		return srv.conversation.Status() == st.ConversationStatusStable
+	}, 5*time.Second, 10*time.Millisecond)
+	status, resp = send("/usr/bin/env fails here")
+	require.Equal(t, http.StatusOK, status)
+	assert.Empty(t, resp.Body.CommandResponse)
+	require.Eventually(t, func() bool {
+		return srv.conversation.Status() == st.ConversationStatusStable
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"hello there agent", "/usr/bin/env fails here"}, userMessages(srv))
+	writes := agent.Writes()
+
+	status, resp = send("/status")
+	require.Equal(t, http.StatusOK, status)
+	assert.True(t, resp.Body.Ok)
+	assert.Equal(t, "Command executed: /status\n\nThe agent is stable.", resp.Body.CommandResponse)
+
+	status, resp = send("/export")
+	require.Equal(t, http.StatusOK, status)
+	assert.Contains(t, resp.Body.CommandResponse, "Command executed: /export\n\n")
+	assert.Contains(t, resp.Body.CommandResponse, "## User\n\nhello there agent\n\n## Agent\n\n")
+	assert.Contains(t, resp.Body.CommandResponse, "## User\n\n/usr/bin/env fails here")
+
+	status, resp = send("/restart")
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "Command executed: /restart", resp.Body.CommandResponse)
+	assert.Equal(t, 1, restarts)
+
+	// there's no terminal to resize
+	status, _ = send("/resize 200 50")
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	status, _ = send("/resize 200")
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+
+	// the commands never reach the agent
+	assert.Equal(t, writes, agent.Writes())
+	assert.Equal(t, []string{"hello there agent", "/usr/bin/env fails here"}, userMessages(srv))
+
+	// errors are returned, and /restart is passed on without a callback
+	srv.EnableSlashCommands(func() error { return errors.New("no supervisor") })
+	status, _ = send("/restart")
+	assert.Equal(t, http.StatusInternalServerError, status)
+	srv.EnableSlashCommands(nil)
+	status, _ = send("/restart")
+	assert.Equal(t, http.StatusUnprocessableEntity, status, "a single word is too short for the custom agent")
+}
+
+func TestResizeSlashCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sleep isn't available on Windows")
+	}
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("sleep not found")
+	}
+	ctx, cancel := context.WithCancel(logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil))))
+	defer cancel()
+	process, err := termexec.StartProcess(ctx, termexec.StartProcessConfig{
+		Program:        "sleep",
+		Args:           []string{"5"},
+		TerminalWidth:  80,
+		TerminalHeight: 24,
+	})
+	require.NoError(t, err)
+	defer process.Close(slog.New(slog.NewTextHandler(io.Discard, nil)), time.Second)
+	srv, httpSrv := newRoutingTestServer(t, ctx, &echoAgent{})
+	srv.agentio = process
+	srv.EnableSlashCommands(nil)
+	_, ch, _ := srv.emitter.Subscribe()
+
+	var resp MessageResponse
+	require.Equal(t, http.StatusOK, doJSON(t, http.MethodPost, httpSrv.URL+"/v1/message", `{"type":"user","content":"/resize 200 50"}`, &resp.Body))
+	assert.Equal(t, "Command executed: /resize 200 50", resp.Body.CommandResponse)
+	timeout := time.After(5 * time.Second)
+	for resized := false; !resized; {
+		select {
+		case event := <-ch:
+			if event.Type == EventTypePTYResized {
+				assert.Equal(t, PTYResizedBody{Type: "pty_resized", Width: 200, Height: 50}, event.Payload)
+				resized = true
+			}
+		case <-timeout:
+			t.Fatal("no pty_resized event")
+		}
+	}
+
+	for _, size := range []string{"9 50", "200 x", "70000 50"} {
+		assert.Equal(t, http.StatusUnprocessableEntity, doJSON(t, http.MethodPost, httpSrv.URL+"/v1/message", `{"type":"user","content":"/resize `+size+`"}`, nil), size)
+	}
+}
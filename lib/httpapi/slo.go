@@ -0,0 +1,253 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// DefaultSLOWindow is how far back the SLO monitor looks.
+	DefaultSLOWindow = 5 * time.Minute
+	// DefaultSLOCapacity is the number of requests the SLO monitor keeps at
+	// most. The oldest are dropped first if there are more in the window.
+	DefaultSLOCapacity = 10000
+)
+
+// SLO metrics, used as the metric of an SLOAlert.
+const (
+	SLOMetricP95Latency = "p95_latency_ms"
+	SLOMetricErrorRate  = "error_rate"
+)
+
+// SLOAlert is posted to the alert webhooks when a metric exceeds its
+// threshold.
+type SLOAlert struct {
+	Type      string  `json:"type"`
+	Metric    string  `json:"metric"`
+	Value     float64 `json:"value"`
+	Threshold float64 `json:"threshold"`
+}
+
+type SLOConfig struct {
+	// P95Threshold is the latency that at most 5% of the requests may
+	// exceed. Disabled if 0.
+	P95Threshold time.Duration
+	// ErrorRateThreshold is the share of requests that may fail, from 0 to
+	// 1. Disabled if 0.
+	ErrorRateThreshold float64
+	// Window defaults to DefaultSLOWindow, and Capacity to
+	// DefaultSLOCapacity.
+	Window   time.Duration
+	Capacity int
+}
+
+type sloSample struct {
+	at       time.Time
+	duration time.Duration
+	failed   bool
+}
+
+// SLOMonitor tracks the latency and the error rate of the requests in a
+// sliding window, and alerts when they exceed their thresholds. An alert
+// fires when a metric starts exceeding its threshold, and not again until
+// it went back below it.
+type SLOMonitor struct {
+	config   SLOConfig
+	logger   *slog.Logger
+	client   *http.Client
+	getTime  func() time.Time
+	webhooks []string
+	// alert is called with each alert, in addition to posting it to the
+	// webhooks.
+	alert func(SLOAlert)
+
+	mu sync.Mutex
+	// samples is a circular buffer of the requests in the window, oldest
+	// first from start.
+	samples []sloSample
+	start   int
+	count   int
+	// sorted holds the durations of the samples in ascending order.
+	sorted   []time.Duration
+	failures int
+	// breached holds the metrics that exceed their threshold.
+	breached map[string]bool
+}
+
+func NewSLOMonitor(logger *slog.Logger, config SLOConfig) *SLOMonitor {
+	if config.Window <= 0 {
+		config.Window = DefaultSLOWindow
+	}
+	if config.Capacity <= 0 {
+		config.Capacity = DefaultSLOCapacity
+	}
+	return &SLOMonitor{
+		config:   config,
+		logger:   logger,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		getTime:  time.Now,
+		samples:  make([]sloSample, config.Capacity),
+		sorted:   make([]time.Duration, 0, config.Capacity),
+		breached: make(map[string]bool),
+	}
+}
+
+// AddAlertWebhook makes the monitor post its alerts to url as JSON. It must
+// be called before requests are recorded.
+func (m *SLOMonitor) AddAlertWebhook(url string) {
+	m.webhooks = append(m.webhooks, url)
+}
+
+// Record adds a request that took duration, and alerts if the SLO is
+// breached because of it.
+func (m *SLOMonitor) Record(duration time.Duration, failed bool) {
+	m.mu.Lock()
+	now := m.getTime()
+	m.evict(now)
+	if m.count == len(m.samples) {
+		m.removeOldest()
+	}
+	m.samples[(m.start+m.count)%len(m.samples)] = sloSample{at: now, duration: duration, failed: failed}
+	m.count++
+	i, _ := slices.BinarySearch(m.sorted, duration)
+	m.sorted = slices.Insert(m.sorted, i, duration)
+	if failed {
+		m.failures++
+	}
+	alerts := m.check()
+	m.mu.Unlock()
+
+	for _, alert := range alerts {
+		m.logger.Warn("SLO breached", "metric", alert.Metric, "value", alert.Value, "threshold", alert.Threshold)
+		if m.alert != nil {
+			m.alert(alert)
+		}
+		for _, url := range m.webhooks {
+			go func() {
+				if err := m.post(url, alert); err != nil {
+					m.logger.Error("Failed to post SLO alert", "error", err)
+				}
+			}()
+		}
+	}
+}
+
+// evict removes the samples that are older than the window.
+func (m *SLOMonitor) evict(now time.Time) {
+	for m.count > 0 && now.Sub(m.samples[m.start].at) > m.config.Window {
+		m.removeOldest()
+	}
+}
+
+func (m *SLOMonitor) removeOldest() {
+	oldest := m.samples[m.start]
+	m.start = (m.start + 1) % len(m.samples)
+	m.count--
+	if i, found := slices.BinarySearch(m.sorted, oldest.duration); found {
+		m.sorted = slices.Delete(m.sorted, i, i+1)
+	}
+	if oldest.failed {
+		m.failures--
+	}
+}
+
+// percentile returns the p-th percentile of the durations, with the
+// nearest-rank method. It must be called with mu held.
+func (m *SLOMonitor) percentile(p float64) time.Duration {
+	if len(m.sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(m.sorted))))
+	return m.sorted[max(rank-1, 0)]
+}
+
+// Percentiles returns the 50th, 95th and 99th percentile of the latency of
+// the requests in the window.
+func (m *SLOMonitor) Percentiles() (p50, p95, p99 time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.evict(m.getTime())
+	return m.percentile(50), m.percentile(95), m.percentile(99)
+}
+
+// ErrorRate returns the share of the requests in the window that failed.
+func (m *SLOMonitor) ErrorRate() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.evict(m.getTime())
+	if m.count == 0 {
+		return 0
+	}
+	return float64(m.failures) / float64(m.count)
+}
+
+// check returns the alerts of the metrics that started exceeding their
+// thresholds. It must be called with mu held.
+func (m *SLOMonitor) check() []SLOAlert {
+	var alerts []SLOAlert
+	update := func(metric string, value, threshold float64) {
+		exceeded := value > threshold
+		if exceeded && !m.breached[metric] {
+			alerts = append(alerts, SLOAlert{Type: "slo_breach", Metric: metric, Value: value, Threshold: threshold})
+		}
+		m.breached[metric] = exceeded
+	}
+	if m.config.P95Threshold > 0 {
+		update(SLOMetricP95Latency, milliseconds(m.percentile(95)), milliseconds(m.config.P95Threshold))
+	}
+	if m.config.ErrorRateThreshold > 0 {
+		update(SLOMetricErrorRate, float64(m.failures)/float64(m.count), m.config.ErrorRateThreshold)
+	}
+	return alerts
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func (m *SLOMonitor) post(url string, alert SLOAlert) error {
+	data, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	resp, err := m.client.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return xerrors.Errorf("failed to post to %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return xerrors.Errorf("alert webhook %s returned %d: %s", url, resp.StatusCode, body)
+	}
+	return nil
+}
+
+// EnableSLOMonitor makes the server record the duration of every POST
+// /message request with monitor. Requests that fail with a 5xx error count
+// as errors.
+func (s *Server) EnableSLOMonitor(monitor *SLOMonitor) {
+	s.slo.Store(monitor)
+}
+
+// recordSLO records a request that started at start and returned err, if
+// the SLO monitor is enabled.
+func (s *Server) recordSLO(start time.Time, err error) {
+	monitor := s.slo.Load()
+	if monitor == nil {
+		return
+	}
+	var statusErr huma.StatusError
+	failed := err != nil && (!errors.As(err, &statusErr) || statusErr.GetStatus() >= 500)
+	monitor.Record(time.Since(start), failed)
+}
@@ -0,0 +1,152 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	mf "github.com/zohaibahmed/clauder/lib/msgfmt"
+)
+
+// newTestSLOMonitor returns a monitor whose clock is advanced with the
+// returned function, and the alerts it fired.
+func newTestSLOMonitor(config SLOConfig) (*SLOMonitor, func(time.Duration), *[]SLOAlert) {
+	m := NewSLOMonitor(slog.New(slog.NewTextHandler(io.Discard, nil)), config)
+	now := time.Unix(1_700_000_000, 0)
+	m.getTime = func() time.Time { return now }
+	alerts := &[]SLOAlert{}
+	m.alert = func(alert SLOAlert) { *alerts = append(*alerts, alert) }
+	return m, func(d time.Duration) { now = now.Add(d) }, alerts
+}
+
+func TestSLOMonitorPercentiles(t *testing.T) {
+	m, advance, _ := newTestSLOMonitor(SLOConfig{})
+	p50, p95, p99 := m.Percentiles()
+	assert.Zero(t, p50+p95+p99)
+
+	// recorded out of order, 1ms to 100ms
+	for i := range 100 {
+		m.Record(time.Duration((i*37)%100+1)*time.Millisecond, false)
+	}
+	p50, p95, p99 = m.Percentiles()
+	assert.Equal(t, 50*time.Millisecond, p50)
+	assert.Equal(t, 95*time.Millisecond, p95)
+	assert.Equal(t, 99*time.Millisecond, p99)
+
+	// the requests expire once they're older than the window
+	advance(4 * time.Minute)
+	m.Record(time.Second, true)
+	assert.InDelta(t, 1.0/101, m.ErrorRate(), 1e-9)
+	advance(time.Minute + time.Second)
+	p50, p95, p99 = m.Percentiles()
+	assert.Equal(t, []time.Duration{time.Second, time.Second, time.Second}, []time.Duration{p50, p95, p99})
+	assert.Equal(t, 1.0, m.ErrorRate())
+	advance(5 * time.Minute)
+	assert.Zero(t, m.ErrorRate())
+}
+
+func TestSLOMonitorCapacity(t *testing.T) {
+	m, _, _ := newTestSLOMonitor(SLOConfig{Capacity: 10})
+	for i := range 25 {
+		m.Record(time.Duration(i)*time.Millisecond, i < 15)
+	}
+	// only the last 10 requests are kept
+	p50, _, p99 := m.Percentiles()
+	assert.Equal(t, 19*time.Millisecond, p50)
+	assert.Equal(t, 24*time.Millisecond, p99)
+	assert.Zero(t, m.ErrorRate())
+	assert.Len(t, m.sorted, 10)
+}
+
+func TestSLOMonitorLatencyAlert(t *testing.T) {
+	m, advance, alerts := newTestSLOMonitor(SLOConfig{P95Threshold: 2 * time.Second})
+	for range 19 {
+		m.Record(100*time.Millisecond, false)
+	}
+	// with 20 requests, the p95 is the 19th slowest
+	m.Record(5*time.Second, false)
+	assert.Empty(t, *alerts)
+	m.Record(2*time.Second, false)
+	assert.Empty(t, *alerts, "p95 at the threshold")
+	m.Record(2500*time.Millisecond, false)
+	require.Len(t, *alerts, 1)
+	assert.Equal(t, SLOAlert{Type: "slo_breach", Metric: SLOMetricP95Latency, Value: 2500, Threshold: 2000}, (*alerts)[0])
+
+	// it doesn't fire again until the p95 recovered
+	m.Record(3*time.Second, false)
+	assert.Len(t, *alerts, 1)
+	advance(6 * time.Minute)
+	m.Record(100*time.Millisecond, false)
+	m.Record(2001*time.Millisecond, false)
+	require.Len(t, *alerts, 2)
+	assert.Equal(t, 2001.0, (*alerts)[1].Value)
+}
+
+func TestSLOMonitorErrorRateAlert(t *testing.T) {
+	m, _, alerts := newTestSLOMonitor(SLOConfig{ErrorRateThreshold: 0.01})
+	for range 99 {
+		m.Record(time.Millisecond, false)
+	}
+	m.Record(time.Millisecond, true)
+	assert.Empty(t, *alerts, "error rate at the threshold")
+	m.Record(time.Millisecond, true)
+	require.Len(t, *alerts, 1)
+	assert.Equal(t, SLOMetricErrorRate, (*alerts)[0].Metric)
+	assert.InDelta(t, 2.0/101, (*alerts)[0].Value, 1e-9)
+	assert.Equal(t, 0.01, (*alerts)[0].Threshold)
+}
+
+func TestSLOMonitorWebhook(t *testing.T) {
+	received := make(chan string, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- string(body)
+	}))
+	defer webhook.Close()
+
+	m, _, _ := newTestSLOMonitor(SLOConfig{P95Threshold: 2 * time.Second})
+	m.AddAlertWebhook(webhook.URL)
+	m.Record(2500*time.Millisecond, false)
+	select {
+	case body := <-received:
+		assert.JSONEq(t, `{"type":"slo_breach","metric":"p95_latency_ms","value":2500,"threshold":2000}`, body)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the webhook wasn't called")
+	}
+}
+
+func TestRecordSLO(t *testing.T) {
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	srv := NewServer(ctx, mf.AgentTypeClaude, nil, 0, "/chat")
+	// no monitor
+	srv.recordSLO(time.Now(), nil)
+
+	m, _, _ := newTestSLOMonitor(SLOConfig{})
+	srv.EnableSLOMonitor(m)
+	srv.recordSLO(time.Now(), nil)
+	srv.recordSLO(time.Now(), huma.Error422UnprocessableEntity("invalid message"))
+	srv.recordSLO(time.Now(), huma.Error500InternalServerError("failed"))
+	assert.Equal(t, 1.0/3, m.ErrorRate())
+
+	// a POST /message request is recorded
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/message", strings.NewReader(`{"content": "hi", "type": "user"}`))
+	req.Header.Set("Content-Type", "application/json")
+	srv.router.ServeHTTP(rec, req)
+	var problem struct {
+		Status int `json:"status"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &problem))
+	assert.Equal(t, rec.Code, problem.Status)
+	assert.Equal(t, 4, m.count)
+}
@@ -0,0 +1,142 @@
+package httpapi
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultSSEWriteTimeout is how long a write to an SSE subscriber may block
+// before the connection is closed, unless SetSSEWriteTimeout was called.
+const DefaultSSEWriteTimeout = 5 * time.Second
+
+var sseSlowConsumerDrops = newCounterVec(
+	"connection_dropped_slow_consumer_total",
+	"Number of SSE connections closed because a write didn't complete within the write timeout.",
+)
+
+// sseWriteGuard closes the SSE connections of slow consumers. Writes to a
+// connection block once its buffers are full, e.g. when a mobile client on
+// a bad network can't keep up, and a blocked write would hold the
+// subscriber's goroutine and its queued events until the client goes away.
+type sseWriteGuard struct {
+	logger *slog.Logger
+	// timeout is a time.Duration.
+	timeout atomic.Int64
+}
+
+func newSSEWriteGuard(logger *slog.Logger) *sseWriteGuard {
+	g := &sseWriteGuard{logger: logger}
+	g.timeout.Store(int64(DefaultSSEWriteTimeout))
+	return g
+}
+
+// SetSSEWriteTimeout closes the connection of an SSE subscriber when a
+// write to it doesn't complete within timeout, DefaultSSEWriteTimeout by
+// default. The client is expected to reconnect. It applies to the
+// connections opened afterwards.
+func (s *Server) SetSSEWriteTimeout(timeout time.Duration) {
+	s.sseWriteGuard.timeout.Store(int64(timeout))
+}
+
+// Timeout returns the write timeout of new connections.
+func (g *sseWriteGuard) Timeout() time.Duration {
+	return time.Duration(g.timeout.Load())
+}
+
+func (g *sseWriteGuard) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		timeout := g.Timeout()
+		gw := &sseWriteGuardWriter{ResponseWriter: w, timeout: timeout}
+		gw.drop = func() {
+			gw.dropped.Store(true)
+			sseSlowConsumerDrops.Inc()
+			g.logger.Warn("Closing the connection of a slow SSE consumer", "path", r.URL.Path, "timeoutMs", timeout.Milliseconds())
+			// the handler stops waiting for events, and the deadline in the
+			// past fails the blocked write
+			cancel()
+			if err := http.NewResponseController(w).SetWriteDeadline(time.Now()); err != nil {
+				g.logger.Error("Failed to interrupt the blocked SSE write", "path", r.URL.Path, "error", err)
+			}
+		}
+		defer gw.stop()
+		next.ServeHTTP(gw, r.WithContext(ctx))
+	})
+}
+
+// sseWriteGuardWriter calls drop when a write or flush of an SSE response
+// blocks for longer than timeout. Once dropped, writes fail with
+// errSSEWriteTimeout. Other responses are passed through.
+type sseWriteGuardWriter struct {
+	http.ResponseWriter
+	timeout time.Duration
+	drop    func()
+	// timer is started by the first write of an SSE response.
+	timer   *time.Timer
+	dropped atomic.Bool
+}
+
+func (w *sseWriteGuardWriter) sse() bool {
+	return strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream")
+}
+
+// guard runs write, which drop interrupts if it takes longer than the
+// timeout.
+func (w *sseWriteGuardWriter) guard(write func()) error {
+	if w.timeout <= 0 || !w.sse() {
+		write()
+		return nil
+	}
+	if w.dropped.Load() {
+		return errSSEWriteTimeout
+	}
+	if w.timer == nil {
+		w.timer = time.AfterFunc(w.timeout, w.drop)
+	} else {
+		w.timer.Reset(w.timeout)
+	}
+	write()
+	if !w.timer.Stop() {
+		return errSSEWriteTimeout
+	}
+	return nil
+}
+
+func (w *sseWriteGuardWriter) stop() {
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+}
+
+func (w *sseWriteGuardWriter) Write(data []byte) (int, error) {
+	var n int
+	var err error
+	if guardErr := w.guard(func() { n, err = w.ResponseWriter.Write(data) }); guardErr != nil {
+		return n, guardErr
+	}
+	return n, err
+}
+
+func (w *sseWriteGuardWriter) Flush() {
+	flusher, ok := w.ResponseWriter.(http.Flusher)
+	if !ok {
+		return
+	}
+	_ = w.guard(flusher.Flush)
+}
+
+// SetWriteDeadline ignores the deadline the sse package sets before each
+// event, since the write timeout replaces it.
+func (w *sseWriteGuardWriter) SetWriteDeadline(time.Time) error {
+	return nil
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *sseWriteGuardWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
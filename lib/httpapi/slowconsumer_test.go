@@ -0,0 +1,124 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	mf "github.com/zohaibahmed/clauder/lib/msgfmt"
+	st "github.com/zohaibahmed/clauder/lib/screentracker"
+)
+
+// stalledResponseWriter simulates a client that stopped reading: once
+// stalled, flushes block until the write deadline passes, like writes to a
+// connection whose buffers are full.
+type stalledResponseWriter struct {
+	mu       sync.Mutex
+	header   http.Header
+	body     bytes.Buffer
+	stalled  bool
+	deadline chan struct{}
+	once     sync.Once
+}
+
+func newStalledResponseWriter() *stalledResponseWriter {
+	return &stalledResponseWriter{header: http.Header{}, deadline: make(chan struct{})}
+}
+
+func (w *stalledResponseWriter) Header() http.Header { return w.header }
+func (w *stalledResponseWriter) WriteHeader(int)     {}
+
+func (w *stalledResponseWriter) SetWriteDeadline(deadline time.Time) error {
+	if !deadline.After(time.Now()) {
+		w.once.Do(func() { close(w.deadline) })
+	}
+	return nil
+}
+
+func (w *stalledResponseWriter) Write(data []byte) (int, error) {
+	select {
+	case <-w.deadline:
+		return 0, os.ErrDeadlineExceeded
+	default:
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.body.Write(data)
+}
+
+func (w *stalledResponseWriter) Flush() {
+	w.mu.Lock()
+	stalled := w.stalled
+	w.mu.Unlock()
+	if stalled {
+		<-w.deadline
+	}
+}
+
+func (w *stalledResponseWriter) Stall() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stalled = true
+}
+
+func (w *stalledResponseWriter) Body() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.body.String()
+}
+
+func TestSSEWriteTimeout(t *testing.T) {
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	srv := NewServer(ctx, mf.AgentTypeClaude, nil, 0, "/chat")
+	const timeout = 200 * time.Millisecond
+	srv.SetSSEWriteTimeout(timeout)
+	dropsBefore := sseSlowConsumerDrops.Value()
+
+	w := newStalledResponseWriter()
+	reqCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	req := httptest.NewRequest(http.MethodGet, "/v1/events", nil).WithContext(reqCtx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		srv.router.ServeHTTP(w, req)
+	}()
+	require.Eventually(t, func() bool { return strings.Contains(w.Body(), "event: status_change") }, 5*time.Second, 10*time.Millisecond)
+
+	// writes that complete in time don't close the connection
+	time.Sleep(2 * timeout)
+	select {
+	case <-done:
+		t.Fatal("connection was closed without a slow write")
+	default:
+	}
+	assert.Equal(t, dropsBefore, sseSlowConsumerDrops.Value())
+
+	w.Stall()
+	stalled := time.Now()
+	srv.emitter.UpdateStatusAndEmitChanges(st.ConversationStatusStable)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection was not closed after the write timeout")
+	}
+	elapsed := time.Since(stalled)
+	assert.GreaterOrEqual(t, elapsed, timeout)
+	assert.Less(t, elapsed, timeout+time.Second)
+	assert.Equal(t, dropsBefore+1, sseSlowConsumerDrops.Value())
+
+	rec := httptest.NewRecorder()
+	srv.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(t, rec.Body.String(), "connection_dropped_slow_consumer_total")
+}
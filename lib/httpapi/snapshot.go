@@ -0,0 +1,67 @@
+package httpapi
+
+import (
+	"context"
+	"fmt"
+	"hash/crc32"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type SnapshotRequest struct {
+	IfNoneMatch     []string  `header:"If-None-Match" doc:"ETags of snapshots the client already has"`
+	IfModifiedSince time.Time `header:"If-Modified-Since" doc:"Only return the snapshot if the screen changed after this time. Ignored if If-None-Match is set."`
+}
+
+type SnapshotResponse struct {
+	Status       int
+	ETag         string    `header:"ETag" doc:"Checksum of the screen"`
+	LastModified time.Time `header:"Last-Modified" doc:"When the screen last changed"`
+	Seq          int       `header:"X-Snapshot-Seq" doc:"Sequence number of the snapshot"`
+	Body         struct {
+		Screen string `json:"screen" doc:"Contents of the agent's terminal screen"`
+		Seq    int    `json:"seq" doc:"Sequence number of the snapshot. It's incremented every time the screen changes."`
+	}
+}
+
+// snapshotETag returns the ETag of a snapshot of the screen.
+func snapshotETag(screen string) string {
+	return fmt.Sprintf(`"%x"`, crc32.ChecksumIEEE([]byte(screen)))
+}
+
+// notModified reports whether a client that sent the conditional headers in
+// input already has the snapshot. Like RFC 9110 requires, If-Modified-Since
+// is only evaluated when If-None-Match isn't set.
+func (input *SnapshotRequest) notModified(etag string, modified time.Time) bool {
+	if len(input.IfNoneMatch) > 0 {
+		for _, match := range input.IfNoneMatch {
+			match = strings.TrimPrefix(strings.TrimSpace(match), "W/")
+			if match == etag || match == "*" {
+				return true
+			}
+		}
+		return false
+	}
+	// HTTP dates have a resolution of one second.
+	return !input.IfModifiedSince.IsZero() && !modified.Truncate(time.Second).After(input.IfModifiedSince)
+}
+
+// getSnapshot handles GET /snapshot
+func (s *Server) getSnapshot(ctx context.Context, input *SnapshotRequest) (*SnapshotResponse, error) {
+	screen, seq, modified := s.emitter.Screen()
+
+	resp := &SnapshotResponse{
+		Status:       http.StatusOK,
+		ETag:         snapshotETag(screen),
+		LastModified: modified.UTC(),
+		Seq:          seq,
+	}
+	if input.notModified(resp.ETag, modified) {
+		resp.Status = http.StatusNotModified
+		return resp, nil
+	}
+	resp.Body.Screen = screen
+	resp.Body.Seq = seq
+	return resp, nil
+}
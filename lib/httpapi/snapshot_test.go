@@ -0,0 +1,76 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	mf "github.com/zohaibahmed/clauder/lib/msgfmt"
+)
+
+func TestGetSnapshot(t *testing.T) {
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(os.Stdout, nil)))
+	srv := NewServer(ctx, mf.AgentTypeClaude, nil, 0, "/chat")
+
+	get := func(header http.Header) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/v1/snapshot", nil)
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		rec := httptest.NewRecorder()
+		srv.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	srv.emitter.UpdateScreenAndEmitChanges("$ clauder\n")
+	first := get(nil)
+	require.Equal(t, http.StatusOK, first.Code)
+	etag := first.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+	assert.Equal(t, "1", first.Header().Get("X-Snapshot-Seq"))
+	var body struct {
+		Screen string `json:"screen"`
+		Seq    int    `json:"seq"`
+	}
+	require.NoError(t, json.Unmarshal(first.Body.Bytes(), &body))
+	assert.Equal(t, "$ clauder", body.Screen)
+	assert.Equal(t, 1, body.Seq)
+	lastModified := first.Header().Get("Last-Modified")
+	_, err := http.ParseTime(lastModified)
+	require.NoError(t, err)
+
+	// Identical snapshots have identical ETags.
+	assert.Equal(t, etag, get(nil).Header().Get("ETag"))
+
+	notModified := get(http.Header{"If-None-Match": {etag}})
+	assert.Equal(t, http.StatusNotModified, notModified.Code)
+	assert.Empty(t, notModified.Body.String())
+	assert.Equal(t, etag, notModified.Header().Get("ETag"))
+
+	notModified = get(http.Header{"If-Modified-Since": {lastModified}})
+	assert.Equal(t, http.StatusNotModified, notModified.Code)
+	assert.Empty(t, notModified.Body.String())
+
+	// The screen changes within the same second, so only the ETag tells
+	// the snapshots apart.
+	srv.emitter.UpdateScreenAndEmitChanges("$ clauder\n> hello\n")
+	changed := get(http.Header{"If-None-Match": {etag}, "If-Modified-Since": {lastModified}})
+	require.Equal(t, http.StatusOK, changed.Code)
+	assert.NotEqual(t, etag, changed.Header().Get("ETag"))
+	assert.Equal(t, "2", changed.Header().Get("X-Snapshot-Seq"))
+	assert.Contains(t, changed.Body.String(), "> hello")
+
+	future := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	assert.Equal(t, http.StatusNotModified, get(http.Header{"If-Modified-Since": {future}}).Code)
+	past := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+	assert.Equal(t, http.StatusOK, get(http.Header{"If-Modified-Since": {past}}).Code)
+}
@@ -0,0 +1,107 @@
+package httpapi
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// minSnapshotPollInterval is the shortest interval the snapshot loop polls
+// at, however many clients are connected.
+const minSnapshotPollInterval = 100 * time.Millisecond
+
+// snapshotPollInterval returns the interval the snapshot loop polls the
+// conversation at with the given number of clients: base divided by the
+// number of clients, but at least minSnapshotPollInterval and at most base.
+func snapshotPollInterval(base time.Duration, clients int64) time.Duration {
+	return min(base, max(minSnapshotPollInterval, base/time.Duration(max(1, clients))))
+}
+
+// snapshotDemand counts the clients of the snapshot loop: the SSE
+// subscribers, and the server's own consumers of the events. The loop
+// pauses while there are none.
+type snapshotDemand struct {
+	clients atomic.Int64
+
+	mu   sync.Mutex
+	cond *sync.Cond
+	// paused is true while the loop waits for a client, and resumedAt is
+	// when it stopped waiting last.
+	paused    bool
+	resumedAt time.Time
+}
+
+func newSnapshotDemand() *snapshotDemand {
+	d := &snapshotDemand{}
+	d.cond = sync.NewCond(&d.mu)
+	return d
+}
+
+// acquire registers a client. The returned function unregisters it.
+func (d *snapshotDemand) acquire() func() {
+	d.mu.Lock()
+	d.clients.Add(1)
+	d.cond.Broadcast()
+	d.mu.Unlock()
+	var once sync.Once
+	return func() {
+		once.Do(func() { d.clients.Add(-1) })
+	}
+}
+
+func (d *snapshotDemand) count() int64 {
+	return d.clients.Load()
+}
+
+// wait blocks while there are no clients. It returns false once ctx is
+// done.
+func (d *snapshotDemand) wait(ctx context.Context) bool {
+	if d.clients.Load() > 0 {
+		return ctx.Err() == nil
+	}
+	stop := context.AfterFunc(ctx, func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.cond.Broadcast()
+	})
+	defer stop()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.paused = true
+	for d.clients.Load() == 0 && ctx.Err() == nil {
+		d.cond.Wait()
+	}
+	d.paused = false
+	d.resumedAt = time.Now()
+	return ctx.Err() == nil
+}
+
+// lastActive returns the current time while the loop is paused, and when
+// it last resumed otherwise. The loop isn't stuck before then.
+func (d *snapshotDemand) lastActive() time.Time {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.paused {
+		return time.Now()
+	}
+	return d.resumedAt
+}
+
+// SetSnapshotPollInterval sets the interval the snapshot loop polls the
+// conversation at with a single client. With more clients, it polls
+// proportionally more often, down to every 100ms. It must be called before
+// StartSnapshotLoop.
+func (s *Server) SetSnapshotPollInterval(base time.Duration) {
+	s.snapshotPollBase = base
+}
+
+// lastSnapshot returns the last time the snapshot loop ran, or the current
+// time if it's paused because nobody is listening.
+func (s *Server) lastSnapshot() time.Time {
+	lastUpdate := s.emitter.LastUpdate()
+	if active := s.snapshotDemand.lastActive(); active.After(lastUpdate) {
+		return active
+	}
+	return lastUpdate
+}
@@ -0,0 +1,125 @@
+package httpapi
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2/sse"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	mf "github.com/zohaibahmed/clauder/lib/msgfmt"
+	st "github.com/zohaibahmed/clauder/lib/screentracker"
+)
+
+func TestSnapshotPollInterval(t *testing.T) {
+	for _, tc := range []struct {
+		base     time.Duration
+		clients  int64
+		expected time.Duration
+	}{
+		{time.Second, 0, time.Second},
+		{time.Second, 1, time.Second},
+		{time.Second, 2, 500 * time.Millisecond},
+		{time.Second, 4, 250 * time.Millisecond},
+		{time.Second, 50, 100 * time.Millisecond},
+		// the base is never exceeded
+		{snapshotInterval, 1, snapshotInterval},
+		{snapshotInterval, 10, snapshotInterval},
+	} {
+		assert.Equal(t, tc.expected, snapshotPollInterval(tc.base, tc.clients), "base %s, %d clients", tc.base, tc.clients)
+	}
+}
+
+// newSnapshotLoopServer returns a server whose snapshot loop polls every
+// base with one client.
+func newSnapshotLoopServer(t *testing.T, base time.Duration) *Server {
+	ctx, cancel := context.WithCancel(logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil))))
+	t.Cleanup(cancel)
+	srv := NewServer(ctx, mf.AgentTypeCustom, nil, 0, "/chat")
+	srv.conversation = st.NewConversation(ctx, st.ConversationConfig{
+		AgentIO:               &echoAgent{},
+		GetTime:               time.Now,
+		SnapshotInterval:      time.Millisecond,
+		ScreenStabilityLength: 2 * time.Millisecond,
+	})
+	srv.SetSnapshotPollInterval(base)
+	srv.StartSnapshotLoop(ctx)
+	return srv
+}
+
+// countSnapshots returns how many times the snapshot loop ran during d.
+func countSnapshots(srv *Server, d time.Duration) int {
+	count := 0
+	last := srv.emitter.LastUpdate()
+	for deadline := time.Now().Add(d); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if update := srv.emitter.LastUpdate(); !update.Equal(last) {
+			count++
+			last = update
+		}
+	}
+	return count
+}
+
+func TestSnapshotLoopInterval(t *testing.T) {
+	srv := newSnapshotLoopServer(t, 400*time.Millisecond)
+	release := srv.snapshotDemand.acquire()
+	defer release()
+	oneClient := countSnapshots(srv, time.Second)
+	assert.LessOrEqual(t, oneClient, 4)
+
+	for range 3 {
+		defer srv.snapshotDemand.acquire()()
+	}
+	// wait for the current sleep to end
+	time.Sleep(400 * time.Millisecond)
+	fourClients := countSnapshots(srv, time.Second)
+	assert.GreaterOrEqual(t, fourClients, 6)
+	assert.Greater(t, fourClients, oneClient)
+}
+
+func TestSnapshotLoopPause(t *testing.T) {
+	srv := newSnapshotLoopServer(t, 10*time.Millisecond)
+	// nobody listens yet
+	assert.Zero(t, countSnapshots(srv, 100*time.Millisecond))
+	assert.WithinDuration(t, time.Now(), srv.lastSnapshot(), time.Second, "a paused loop isn't stuck")
+
+	release := srv.snapshotDemand.acquire()
+	require.Eventually(t, func() bool {
+		return !srv.emitter.LastUpdate().IsZero()
+	}, time.Second, 5*time.Millisecond)
+	assert.Positive(t, countSnapshots(srv, 100*time.Millisecond))
+
+	release()
+	// releasing twice doesn't unregister another client
+	release()
+	assert.Zero(t, srv.snapshotDemand.count())
+	time.Sleep(50 * time.Millisecond)
+	assert.Zero(t, countSnapshots(srv, 100*time.Millisecond))
+
+	// a client that reconnects resumes the loop
+	release = srv.snapshotDemand.acquire()
+	defer release()
+	assert.Positive(t, countSnapshots(srv, 100*time.Millisecond))
+}
+
+func TestSnapshotLoopSSEClients(t *testing.T) {
+	srv := newSnapshotLoopServer(t, 10*time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		srv.subscribeScreen(ctx, &struct{}{}, sse.Sender(func(sse.Message) error { return nil }))
+	}()
+	require.Eventually(t, func() bool {
+		return srv.snapshotDemand.count() == 1
+	}, time.Second, 5*time.Millisecond)
+	assert.Positive(t, countSnapshots(srv, 100*time.Millisecond))
+
+	cancel()
+	<-done
+	assert.Zero(t, srv.snapshotDemand.count())
+}
@@ -0,0 +1,121 @@
+package httpapi
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/danielgtaylor/huma/v2"
+)
+
+// Template wraps the content of user messages sent with
+// POST /message?template=<name>.
+type Template struct {
+	Name   string `json:"name" pattern:"^[A-Za-z0-9_]+$" minLength:"1" maxLength:"64" example:"go_expert" doc:"Name of the template. Letters, digits and underscores only."`
+	Prefix string `json:"prefix,omitempty" example:"You are an expert Go developer.\n" doc:"Text added before the message content"`
+	Suffix string `json:"suffix,omitempty" example:"\nBe concise." doc:"Text added after the message content"`
+}
+
+// apply wraps content with the template's prefix and suffix.
+func (t Template) apply(content string) string {
+	return t.Prefix + content + t.Suffix
+}
+
+type CreateTemplateRequest struct {
+	Body Template
+}
+
+type TemplateResponse struct {
+	Body Template
+}
+
+type TemplatesResponse struct {
+	Body struct {
+		Templates []Template `json:"templates" nullable:"false" doc:"Templates sorted by name"`
+	}
+}
+
+type DeleteTemplateRequest struct {
+	Name string `path:"name" pattern:"^[A-Za-z0-9_]+$" maxLength:"64" doc:"Name of the template"`
+}
+
+// templateStore holds the message templates in memory.
+type templateStore struct {
+	mu        sync.RWMutex
+	templates map[string]Template
+}
+
+func newTemplateStore() *templateStore {
+	return &templateStore{templates: make(map[string]Template)}
+}
+
+func (t *templateStore) get(name string) (Template, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	template, ok := t.templates[name]
+	return template, ok
+}
+
+func (t *templateStore) put(template Template) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.templates[template.Name] = template
+}
+
+func (t *templateStore) delete(name string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, ok := t.templates[name]
+	delete(t.templates, name)
+	return ok
+}
+
+func (t *templateStore) list() []Template {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	templates := make([]Template, 0, len(t.templates))
+	for _, template := range t.templates {
+		templates = append(templates, template)
+	}
+	slices.SortFunc(templates, func(a, b Template) int { return strings.Compare(a.Name, b.Name) })
+	return templates
+}
+
+// applyTemplate wraps the content of a message sent with a template.
+func (s *Server) applyTemplate(input *MessageRequest) error {
+	if input.Template == "" {
+		return nil
+	}
+	if input.Body.Type != MessageTypeUser {
+		return huma.Error400BadRequest("templates can only be applied to messages of type 'user'")
+	}
+	template, ok := s.templates.get(input.Template)
+	if !ok {
+		return huma.Error404NotFound(fmt.Sprintf("template %s not found", input.Template))
+	}
+	input.Body.Content = template.apply(input.Body.Content)
+	return nil
+}
+
+// createTemplate handles POST /templates
+func (s *Server) createTemplate(ctx context.Context, input *CreateTemplateRequest) (*TemplateResponse, error) {
+	s.templates.put(input.Body)
+	return &TemplateResponse{Body: input.Body}, nil
+}
+
+// getTemplates handles GET /templates
+func (s *Server) getTemplates(ctx context.Context, input *struct{}) (*TemplatesResponse, error) {
+	resp := &TemplatesResponse{}
+	resp.Body.Templates = s.templates.list()
+	return resp, nil
+}
+
+// deleteTemplate handles DELETE /templates/{name}
+func (s *Server) deleteTemplate(ctx context.Context, input *DeleteTemplateRequest) (*struct{}, error) {
+	if !s.templates.delete(input.Name) {
+		return nil, huma.Error404NotFound(fmt.Sprintf("template %s not found", input.Name))
+	}
+	return nil, nil
+}
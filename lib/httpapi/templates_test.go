@@ -0,0 +1,97 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/events"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	mf "github.com/zohaibahmed/clauder/lib/msgfmt"
+	st "github.com/zohaibahmed/clauder/lib/screentracker"
+)
+
+func TestTemplates(t *testing.T) {
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	srv := NewServer(ctx, mf.AgentTypeClaude, nil, 0, "/chat")
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		srv.router.ServeHTTP(rec, req)
+		return rec
+	}
+	list := func() []Template {
+		rec := do(http.MethodGet, "/v1/templates", "")
+		require.Equal(t, http.StatusOK, rec.Code)
+		var resp TemplatesResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp.Body))
+		return resp.Body.Templates
+	}
+
+	assert.Empty(t, list())
+	rec := do(http.MethodPost, "/v1/templates", `{"name": "go_expert", "prefix": "You are an expert Go developer.\n", "suffix": "\nBe concise."}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	rec = do(http.MethodPost, "/v1/templates", `{"name": "Reviewer2", "prefix": "Review this: "}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	assert.Equal(t, []Template{
+		{Name: "Reviewer2", Prefix: "Review this: "},
+		{Name: "go_expert", Prefix: "You are an expert Go developer.\n", Suffix: "\nBe concise."},
+	}, list())
+
+	// posting a template with the same name replaces it
+	rec = do(http.MethodPost, "/v1/templates", `{"name": "Reviewer2", "suffix": " Thanks!"}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	assert.Equal(t, Template{Name: "Reviewer2", Suffix: " Thanks!"}, list()[0])
+
+	for _, name := range []string{"", "go-expert", "go expert", "über", strings.Repeat("a", 65)} {
+		rec = do(http.MethodPost, "/v1/templates", `{"name": "`+name+`", "prefix": "x"}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code, name)
+	}
+	rec = do(http.MethodPost, "/v1/templates", `{"name": "`+strings.Repeat("a", 64)+`"}`)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	rec = do(http.MethodDelete, "/v1/templates/Reviewer2", "")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	rec = do(http.MethodDelete, "/v1/templates/Reviewer2", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Len(t, list(), 2)
+}
+
+func TestCreateMessageTemplate(t *testing.T) {
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	srv := NewServer(ctx, mf.AgentTypeCustom, nil, 0, "/chat")
+	srv.conversation = st.NewConversation(ctx, st.ConversationConfig{
+		AgentIO:                    &echoAgent{},
+		GetTime:                    time.Now,
+		SnapshotInterval:           time.Millisecond,
+		ScreenStabilityLength:      2 * time.Millisecond,
+		SkipSendMessageStatusCheck: true,
+	})
+	srv.bus = events.NewEventBus(10)
+	sent := srv.bus.Subscribe(events.TopicMessageSent)
+	srv.templates.put(Template{Name: "go_expert", Prefix: "You are an expert Go developer.\n", Suffix: "\nBe concise."})
+
+	_, err := srv.createMessage(ctx, &MessageRequest{Template: "go_expert", Body: MessageRequestBody{Type: MessageTypeUser, Content: "what does main do"}})
+	require.NoError(t, err)
+	msg := (<-sent).(st.ConversationMessage)
+	assert.Equal(t, "You are an expert Go developer.\nwhat does main do\nBe concise.", msg.Message)
+
+	var statusErr huma.StatusError
+	_, err = srv.createMessage(ctx, &MessageRequest{Template: "unknown", Body: MessageRequestBody{Type: MessageTypeUser, Content: "what does main do"}})
+	require.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, http.StatusNotFound, statusErr.GetStatus())
+
+	_, err = srv.createMessage(ctx, &MessageRequest{Template: "go_expert", Body: MessageRequestBody{Type: MessageTypeRaw, Content: "\x03"}})
+	require.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, http.StatusBadRequest, statusErr.GetStatus())
+}
@@ -0,0 +1,92 @@
+package httpapi
+
+import (
+	"math"
+	"time"
+)
+
+// DefaultSSEMaxEventsPerSecond is the number of line events sent to an SSE
+// subscriber per second unless SetSSEMaxEventsPerSecond was called.
+const DefaultSSEMaxEventsPerSecond = 50
+
+var sseThrottledEvents = newCounterVec(
+	"sse_throttled_events_total",
+	"Number of line events dropped because they were produced faster than an SSE subscriber's rate limit.",
+)
+
+type ThrottledBody struct {
+	Type    string `json:"type" enum:"throttled" doc:"Always 'throttled'"`
+	Dropped int    `json:"dropped" doc:"Number of 'line' events that were dropped since the previous 'throttled' event, because the agent printed lines faster than they're sent"`
+}
+
+// ProductionRateLimiter limits the rate of the line events sent to an SSE
+// subscriber with a token bucket, which holds up to a second's worth of
+// events. An agent streaming a large file can print thousands of lines per
+// second, more than mobile clients can render. It isn't safe for
+// concurrent use, since every connection has its own.
+type ProductionRateLimiter struct {
+	rate    float64
+	burst   float64
+	getTime func() time.Time
+
+	tokens  float64
+	last    time.Time
+	dropped int
+}
+
+// NewProductionRateLimiter returns a limiter that allows eventsPerSecond
+// events per second, which must be positive.
+func NewProductionRateLimiter(eventsPerSecond float64) *ProductionRateLimiter {
+	burst := math.Max(1, eventsPerSecond)
+	return &ProductionRateLimiter{
+		rate:    eventsPerSecond,
+		burst:   burst,
+		getTime: time.Now,
+		tokens:  burst,
+	}
+}
+
+func (l *ProductionRateLimiter) refill() {
+	now := l.getTime()
+	if !l.last.IsZero() {
+		l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	}
+	l.last = now
+}
+
+// Allow reports whether an event can be sent now. If it can't, the event
+// is counted as dropped.
+func (l *ProductionRateLimiter) Allow() bool {
+	l.refill()
+	if l.tokens >= 1 {
+		l.tokens--
+		return true
+	}
+	l.dropped++
+	return false
+}
+
+// Wait returns how long it takes until an event can be sent.
+func (l *ProductionRateLimiter) Wait() time.Duration {
+	l.refill()
+	if l.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
+
+// TakeDropped returns the number of events dropped since it was last
+// called.
+func (l *ProductionRateLimiter) TakeDropped() int {
+	dropped := l.dropped
+	l.dropped = 0
+	return dropped
+}
+
+// SetSSEMaxEventsPerSecond limits the line events sent to each subscriber
+// of GET /events to n per second. The lines beyond the limit are dropped,
+// and the subscriber is told how many with a throttled event. 0 disables
+// the limit. It must be called before the server starts.
+func (s *Server) SetSSEMaxEventsPerSecond(n float64) {
+	s.sseMaxEventsPerSecond = n
+}
@@ -0,0 +1,98 @@
+package httpapi
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+)
+
+func TestProductionRateLimiter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewProductionRateLimiter(10)
+	l.getTime = func() time.Time { return now }
+
+	// a second's worth of events can be sent at once
+	for range 10 {
+		assert.True(t, l.Allow())
+	}
+	assert.False(t, l.Allow())
+	assert.False(t, l.Allow())
+	assert.Equal(t, 100*time.Millisecond, l.Wait())
+	assert.Equal(t, 2, l.TakeDropped())
+	assert.Equal(t, 0, l.TakeDropped())
+
+	now = now.Add(250 * time.Millisecond)
+	assert.Equal(t, time.Duration(0), l.Wait())
+	assert.True(t, l.Allow())
+	assert.True(t, l.Allow())
+	assert.False(t, l.Allow())
+	assert.Equal(t, 50*time.Millisecond, l.Wait())
+
+	// the bucket doesn't fill up beyond a second's worth
+	now = now.Add(time.Hour)
+	for range 10 {
+		assert.True(t, l.Allow())
+	}
+	assert.False(t, l.Allow())
+}
+
+func TestSSELineThrottling(t *testing.T) {
+	ctx, cancel := context.WithCancel(logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil))))
+	defer cancel()
+	srv, httpSrv := newRoutingTestServer(t, ctx, &echoAgent{})
+	srv.SetSSEMaxEventsPerSecond(20)
+	lines := make(chan string)
+	srv.StartLineLoop(ctx, lines)
+
+	resp, err := http.Get(httpSrv.URL + "/v1/events?mode=lines")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+	name, _ := nextEvent(t, reader)
+	require.Equal(t, "subscribed", name)
+
+	// the agent prints 500 lines within a few milliseconds
+	before := sseThrottledEvents.Value()
+	for i := range 500 {
+		lines <- fmt.Sprintf("line %d", i)
+	}
+	start := time.Now()
+	received, dropped := 0, 0
+	for received+dropped < 500 {
+		name, data := nextEvent(t, reader)
+		switch name {
+		case "line":
+			received++
+		case "throttled":
+			var throttled ThrottledBody
+			require.NoError(t, json.Unmarshal([]byte(data), &throttled))
+			assert.Equal(t, "throttled", throttled.Type)
+			assert.Positive(t, throttled.Dropped)
+			dropped += throttled.Dropped
+		default:
+			t.Fatalf("unexpected %s event", name)
+		}
+	}
+	// the burst of 20 lines, and at most one more every 50ms
+	maxReceived := 20 + int(time.Since(start)/(50*time.Millisecond)) + 1
+	assert.LessOrEqual(t, received, maxReceived)
+	assert.GreaterOrEqual(t, received, 20)
+	assert.Equal(t, uint64(dropped), sseThrottledEvents.Value()-before)
+
+	// lines are sent again once the limit allows it
+	time.Sleep(100 * time.Millisecond)
+	lines <- "after the burst"
+	name, data := nextEvent(t, reader)
+	require.Equal(t, "line", name)
+	assert.JSONEq(t, `{"text":"after the burst"}`, data)
+}
@@ -0,0 +1,126 @@
+package httpapi
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/danielgtaylor/huma/v2"
+)
+
+// eventTopics are the types of events that clients of GET /events can
+// subscribe to. subscribed and server_shutdown events are always sent.
+var eventTopics = []string{
+	string(EventTypeMessageUpdate),
+	string(EventTypeStatusChange),
+	string(EventTypeToolUse),
+	string(EventTypeWatchdogAlert),
+	string(EventTypeContextTrimmed),
+	string(EventTypeNetworkQuality),
+	string(EventTypeAgentOutput),
+	string(EventTypeTunnelFailover),
+	string(EventTypePTYResized),
+	string(EventTypeCoordinatorRegistered),
+	string(EventTypeQualityDegraded),
+	string(EventTypeReplayProgress),
+	string(EventTypeReplayComplete),
+	string(EventTypeMessageFailed),
+}
+
+type SubscribedBody struct {
+	Type   string   `json:"type" enum:"subscribed" doc:"Always 'subscribed'"`
+	Topics []string `json:"topics" nullable:"false" doc:"Types of the events sent on this connection, besides 'subscribed' and 'server_shutdown'"`
+}
+
+const (
+	// eventsModeFull sends the events of the subscribed topics.
+	eventsModeFull = "full"
+	// eventsModeDiff only sends term_diff events.
+	eventsModeDiff = "diff"
+	// eventsModeLines only sends line events.
+	eventsModeLines = "lines"
+)
+
+// modeEventTypes are the only event types sent in the modes other than
+// full, which can't be subscribed to in full mode.
+var modeEventTypes = map[string]EventType{
+	eventsModeDiff:  EventTypeTermDiff,
+	eventsModeLines: EventTypeLine,
+}
+
+// SubscribeEventsRequest represents a request to subscribe to events
+type SubscribeEventsRequest struct {
+	Topics []string `query:"topics" doc:"Comma-separated list of the event types to receive, e.g. 'message_update,status_change'. '*', the default, subscribes to all of them."`
+	Mode   string   `query:"mode" enum:"full,diff,lines" default:"full" doc:"'diff' only sends 'term_diff' events, which hold the line changes of the agent's terminal screen. The first one turns an empty screen into the current screen. 'lines' only sends 'line' events, with each line the agent prints as soon as it's complete, and 'throttled' events when lines are dropped because they're printed too fast. Neither can be combined with 'topics'."`
+	// topics is nil if the client subscribed to all topics.
+	topics map[string]bool
+	// pusher is nil unless the client connected with HTTP/2. The snapshot
+	// is pushed to snapshotPath with pushHeader.
+	pusher       http.Pusher
+	snapshotPath string
+	pushHeader   http.Header
+}
+
+func (r *SubscribeEventsRequest) Resolve(ctx huma.Context) []error {
+	r.resolvePush(ctx)
+	if eventType, ok := modeEventTypes[r.Mode]; ok {
+		if len(r.Topics) > 0 {
+			return []error{huma.Error400BadRequest(fmt.Sprintf("topics can't be combined with mode=%s", r.Mode))}
+		}
+		r.topics = map[string]bool{string(eventType): true}
+		return nil
+	}
+	r.topics = make(map[string]bool)
+	for _, topic := range r.Topics {
+		topic = strings.TrimSpace(topic)
+		if topic == "*" {
+			r.topics = nil
+			return nil
+		}
+		if !slices.Contains(eventTopics, topic) {
+			return []error{huma.Error400BadRequest(fmt.Sprintf("unknown topic %q, expected '*' or one of: %s", topic, strings.Join(eventTopics, ", ")))}
+		}
+		r.topics[topic] = true
+	}
+	if len(r.topics) == 0 {
+		r.topics = nil
+	}
+	return nil
+}
+
+// subscribed reports whether events of the given type should be sent.
+func (r *SubscribeEventsRequest) subscribed(topic string) bool {
+	return r.topics == nil || r.topics[topic]
+}
+
+// sends reports whether events of the given type are sent to the client.
+// Screens are only sent as term_diff events, and only in diff mode. Lines
+// are only sent in lines mode.
+func (r *SubscribeEventsRequest) sends(eventType EventType) bool {
+	switch eventType {
+	case EventTypeScreenUpdate:
+		return false
+	case EventTypeTermDiff, EventTypeLine:
+		return modeEventTypes[r.Mode] == eventType
+	}
+	if _, ok := modeEventTypes[r.Mode]; ok {
+		return false
+	}
+	return r.subscribed(string(eventType))
+}
+
+// subscribedEvent lists the topics the client subscribed to.
+func (r *SubscribeEventsRequest) subscribedEvent() SubscribedBody {
+	body := SubscribedBody{Type: "subscribed", Topics: []string{}}
+	if eventType, ok := modeEventTypes[r.Mode]; ok {
+		body.Topics = append(body.Topics, string(eventType))
+		return body
+	}
+	for _, topic := range eventTopics {
+		if r.subscribed(topic) {
+			body.Topics = append(body.Topics, topic)
+		}
+	}
+	return body
+}
@@ -0,0 +1,198 @@
+package httpapi
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	mf "github.com/zohaibahmed/clauder/lib/msgfmt"
+	st "github.com/zohaibahmed/clauder/lib/screentracker"
+	"github.com/zohaibahmed/clauder/lib/termexec"
+)
+
+// nextEvent reads the next SSE event and returns its name and data.
+func nextEvent(t *testing.T, reader *bufio.Reader) (string, string) {
+	t.Helper()
+	var name, data string
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && name != "":
+			return name, data
+		case strings.HasPrefix(line, "event: "):
+			name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func subscribeTopics(t *testing.T, url string, topics string) *bufio.Reader {
+	t.Helper()
+	resp, err := http.Get(url + "/v1/events?topics=" + topics)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	return bufio.NewReader(resp.Body)
+}
+
+func TestSubscribeEventsTopics(t *testing.T) {
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(os.Stdout, nil)))
+	srv := NewServer(ctx, mf.AgentTypeClaude, nil, 0, "/chat")
+	httpSrv := httptest.NewServer(srv.router)
+	defer httpSrv.Close()
+
+	t.Run("filtered", func(t *testing.T) {
+		reader := subscribeTopics(t, httpSrv.URL, "status_change")
+		name, data := nextEvent(t, reader)
+		assert.Equal(t, "subscribed", name)
+		assert.JSONEq(t, `{"type":"subscribed","topics":["status_change"]}`, data)
+		name, _ = nextEvent(t, reader)
+		assert.Equal(t, "status_change", name, "the initial message must be skipped")
+
+		srv.emitter.UpdateMessagesAndEmitChanges([]st.ConversationMessage{{Id: 0, Role: st.ConversationRoleAgent, Message: "hello"}})
+		srv.emitter.UpdateStatusAndEmitChanges(st.ConversationStatusStable)
+		name, data = nextEvent(t, reader)
+		assert.Equal(t, "status_change", name)
+		assert.JSONEq(t, `{"status":"stable"}`, data)
+	})
+
+	t.Run("wildcard", func(t *testing.T) {
+		reader := subscribeTopics(t, httpSrv.URL, "*")
+		name, data := nextEvent(t, reader)
+		assert.Equal(t, "subscribed", name)
+		assert.JSONEq(t, `{"type":"subscribed","topics":["message_update","status_change","tool_use","watchdog_alert","context_trimmed","network_quality","agent_output","tunnel_failover","pty_resized","coordinator_registered","quality_degraded","replay_progress","replay_complete","message_failed"]}`, data)
+		name, _ = nextEvent(t, reader)
+		assert.Equal(t, "message_update", name)
+		name, _ = nextEvent(t, reader)
+		assert.Equal(t, "status_change", name)
+	})
+
+	t.Run("diff", func(t *testing.T) {
+		srv.emitter.UpdateScreenAndEmitChanges("╭───╮\n│ > │\n╰───╯\n\n")
+		resp, err := http.Get(httpSrv.URL + "/v1/events?mode=diff")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		reader := bufio.NewReader(resp.Body)
+		name, data := nextEvent(t, reader)
+		assert.Equal(t, "subscribed", name)
+		assert.JSONEq(t, `{"type":"subscribed","topics":["term_diff"]}`, data)
+
+		screen := ""
+		applyNext := func() {
+			name, data := nextEvent(t, reader)
+			require.Equal(t, "term_diff", name, "only diffs are sent")
+			var diff st.TerminalDiff
+			require.NoError(t, json.Unmarshal([]byte(data), &diff))
+			screen, err = st.ApplyDiff(screen, diff)
+			require.NoError(t, err)
+		}
+		applyNext()
+		assert.Equal(t, "╭───╮\n│ > │\n╰───╯", screen)
+
+		srv.emitter.UpdateStatusAndEmitChanges(st.ConversationStatusChanging)
+		srv.emitter.UpdateScreenAndEmitChanges("╭───╮\n│ > hi │\n╰───╯\n\n")
+		srv.emitter.UpdateScreenAndEmitChanges("╭───╮\n│ > hi │\n╰───╯\n\n   ")
+		srv.emitter.UpdateScreenAndEmitChanges("working")
+		applyNext()
+		assert.Equal(t, "╭───╮\n│ > hi │\n╰───╯", screen)
+		applyNext()
+		last, _, _ := srv.emitter.Screen()
+		assert.Equal(t, last, screen)
+	})
+
+	t.Run("diff with topics", func(t *testing.T) {
+		resp, err := http.Get(httpSrv.URL + "/v1/events?mode=diff&topics=status_change")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		resp, err := http.Get(httpSrv.URL + "/v1/events?topics=status_change,output")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+}
+
+func TestSubscribeEventsLines(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+	ctx, cancel := context.WithCancel(logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil))))
+	defer cancel()
+	// the agent prints a line every 100ms once it reads a line
+	lineEmitter := st.NewLineEmitter(1024)
+	process, err := termexec.StartProcess(ctx, termexec.StartProcessConfig{
+		Program:        "sh",
+		Args:           []string{"-c", `read start; for i in 1 2 3 4 5; do echo "line $i"; sleep 0.1; done; sleep 5`},
+		TerminalWidth:  80,
+		TerminalHeight: 24,
+		Output:         lineEmitter,
+	})
+	require.NoError(t, err)
+	defer process.Close(slog.New(slog.NewTextHandler(io.Discard, nil)), time.Second)
+
+	const snapshotEvery = 2 * time.Second
+	srv := NewServer(ctx, mf.AgentTypeClaude, process, 0, "/chat")
+	srv.snapshotPollBase = snapshotEvery
+	srv.StartSnapshotLoop(ctx)
+	srv.StartLineLoop(ctx, lineEmitter.Lines())
+	httpSrv := httptest.NewServer(srv.router)
+	defer httpSrv.Close()
+
+	resp, err := http.Get(httpSrv.URL + "/v1/events?mode=lines")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+	name, data := nextEvent(t, reader)
+	assert.Equal(t, "subscribed", name)
+	assert.JSONEq(t, `{"type":"subscribed","topics":["line"]}`, data)
+
+	_, err = process.Write([]byte("go\r"))
+	require.NoError(t, err)
+	start := time.Now()
+	received := []string{}
+	for len(received) < 5 {
+		name, data := nextEvent(t, reader)
+		require.Equal(t, "line", name, "only lines are sent")
+		var line LineBody
+		require.NoError(t, json.Unmarshal([]byte(data), &line))
+		if strings.HasPrefix(line.Text, "line ") {
+			received = append(received, line.Text)
+		}
+	}
+	assert.Equal(t, []string{"line 1", "line 2", "line 3", "line 4", "line 5"}, received)
+	assert.Less(t, time.Since(start), snapshotEvery, "the lines must arrive before the next snapshot")
+
+	resp, err = http.Get(httpSrv.URL + "/v1/events?mode=lines&topics=status_change")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestCountSuppressedLines(t *testing.T) {
+	filter := st.NewOutputFilter(st.DefaultSuppressPatterns)
+	CountSuppressedLines(filter)
+	before := suppressedLines.Value()
+	e := st.NewLineEmitter(16)
+	e.SetFilter(filter)
+	_, _ = e.Write([]byte("⠋ working\n\nresult\n"))
+	assert.Equal(t, before+2, suppressedLines.Value())
+	assert.Equal(t, "result", <-e.Lines())
+}
@@ -0,0 +1,141 @@
+package httpapi
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// sseConnectionTTFB is how long SSE clients wait for their first event. It
+// dominates the perceived startup time of the mobile app.
+var sseConnectionTTFB = newHistogram(
+	"sse_connection_ttfb_ms",
+	"Time from accepting the connection to writing the first SSE event, in milliseconds.",
+	[]float64{10, 50, 100, 250, 500, 1000, 2000},
+)
+
+// ttfbTrailer is the response trailer that holds the time to the first
+// event of an SSE response, in milliseconds.
+const ttfbTrailer = "X-Time-To-First-Event-Ms"
+
+const defaultTTFBWarningThreshold = time.Second
+
+type connAcceptedKey struct{}
+
+// connAccepted is when a connection was accepted.
+type connAccepted struct {
+	at time.Time
+	// used is set once a request started on the connection. Later requests
+	// on the same connection didn't wait for it to be accepted.
+	used atomic.Bool
+}
+
+// connContext is used as the http.Server's ConnContext, to record when each
+// connection is accepted.
+func connContext(ctx context.Context, _ net.Conn) context.Context {
+	return context.WithValue(ctx, connAcceptedKey{}, &connAccepted{at: time.Now()})
+}
+
+// requestStart returns when the request's connection was accepted if it's
+// the first request on it, and the current time otherwise.
+func requestStart(r *http.Request) time.Time {
+	accepted, ok := r.Context().Value(connAcceptedKey{}).(*connAccepted)
+	if !ok || !accepted.used.CompareAndSwap(false, true) {
+		return time.Now()
+	}
+	return accepted.at
+}
+
+// ttfbMonitor measures the time to the first event of SSE responses. It
+// records it in the sse_connection_ttfb_ms histogram and in the
+// X-Time-To-First-Event-Ms trailer.
+type ttfbMonitor struct {
+	logger *slog.Logger
+	// warningThreshold is a time.Duration.
+	warningThreshold atomic.Int64
+}
+
+func newTTFBMonitor(logger *slog.Logger) *ttfbMonitor {
+	m := &ttfbMonitor{logger: logger}
+	m.warningThreshold.Store(int64(defaultTTFBWarningThreshold))
+	return m
+}
+
+// SetTTFBWarningThreshold makes the server log a warning when an SSE client
+// waits longer than threshold for its first event. It's 1 second by default.
+func (s *Server) SetTTFBWarningThreshold(threshold time.Duration) {
+	s.ttfb.warningThreshold.Store(int64(threshold))
+}
+
+func (m *ttfbMonitor) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tw := &ttfbResponseWriter{ResponseWriter: w, start: requestStart(r)}
+		tw.onFirstEvent = func(ttfb time.Duration) {
+			sseConnectionTTFB.Observe(float64(ttfb) / float64(time.Millisecond))
+			if threshold := time.Duration(m.warningThreshold.Load()); ttfb > threshold {
+				m.logger.Warn("Slow first SSE event", "path", r.URL.Path, "ttfbMs", ttfb.Milliseconds(), "thresholdMs", threshold.Milliseconds())
+			}
+		}
+		next.ServeHTTP(tw, r)
+		if tw.firstEventWritten {
+			w.Header().Set(ttfbTrailer, strconv.FormatInt(tw.ttfb.Milliseconds(), 10))
+		}
+	})
+}
+
+// ttfbResponseWriter calls onFirstEvent before the first byte of an SSE
+// response is written. Other responses are passed through.
+type ttfbResponseWriter struct {
+	http.ResponseWriter
+	start        time.Time
+	onFirstEvent func(ttfb time.Duration)
+
+	wroteHeader       bool
+	sse               bool
+	firstEventWritten bool
+	ttfb              time.Duration
+}
+
+func (w *ttfbResponseWriter) WriteHeader(statusCode int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream") {
+			w.sse = true
+			// trailers must be declared before the header is written
+			w.Header().Add("Trailer", ttfbTrailer)
+		}
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *ttfbResponseWriter) Write(data []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.sse && !w.firstEventWritten {
+		w.firstEventWritten = true
+		w.ttfb = time.Since(w.start)
+		w.onFirstEvent(w.ttfb)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *ttfbResponseWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController and the sse package reach the
+// underlying writer.
+func (w *ttfbResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
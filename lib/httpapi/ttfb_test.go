@@ -0,0 +1,169 @@
+package httpapi
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	mf "github.com/zohaibahmed/clauder/lib/msgfmt"
+	st "github.com/zohaibahmed/clauder/lib/screentracker"
+)
+
+// syncBuffer is a bytes.Buffer that can be written to concurrently.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// newTTFBServer returns a server whose connections record when they were
+// accepted, like the ones started with Start.
+func newTTFBServer(srv *Server) *httptest.Server {
+	httpSrv := httptest.NewUnstartedServer(srv.router)
+	httpSrv.Config.ConnContext = connContext
+	httpSrv.Start()
+	return httpSrv
+}
+
+func TestSSETTFB(t *testing.T) {
+	var logs syncBuffer
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(&logs, nil)))
+	srv := NewServer(ctx, mf.AgentTypeClaude, nil, 0, "/chat")
+	httpSrv := newTTFBServer(srv)
+	defer httpSrv.Close()
+	before := sseConnectionTTFB.Count()
+
+	resp, err := http.Get(httpSrv.URL + "/v1/events")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	go func() { assert.NoError(t, srv.Stop(ctx)) }()
+	_, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	ttfb, err := strconv.Atoi(resp.Trailer.Get(ttfbTrailer))
+	require.NoError(t, err, "the trailer is set once the stream ends")
+	assert.GreaterOrEqual(t, ttfb, 0)
+	assert.Less(t, ttfb, 1000)
+	assert.Equal(t, before+1, sseConnectionTTFB.Count())
+	assert.NotContains(t, logs.String(), "Slow first SSE event")
+
+	rec := httptest.NewRecorder()
+	srv.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(t, rec.Body.String(), "# TYPE sse_connection_ttfb_ms histogram\n")
+	assert.Contains(t, rec.Body.String(), `sse_connection_ttfb_ms_bucket{le="2000"}`)
+	assert.Contains(t, rec.Body.String(), `sse_connection_ttfb_ms_bucket{le="+Inf"}`)
+	assert.Contains(t, rec.Body.String(), "sse_connection_ttfb_ms_count ")
+	assert.Empty(t, rec.Result().Trailer.Get(ttfbTrailer), "only SSE responses have the trailer")
+}
+
+func TestSSETTFBWarning(t *testing.T) {
+	var logs syncBuffer
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(&logs, nil)))
+	srv := NewServer(ctx, mf.AgentTypeClaude, nil, 0, "/chat")
+	srv.SetTTFBWarningThreshold(0)
+	httpSrv := newTTFBServer(srv)
+	defer httpSrv.Close()
+
+	resp, err := http.Get(httpSrv.URL + "/v1/events")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	_, err = bufio.NewReader(resp.Body).ReadString('\n')
+	require.NoError(t, err)
+	assert.Contains(t, logs.String(), "Slow first SSE event")
+	assert.Contains(t, logs.String(), "path=/v1/events")
+}
+
+func TestHistogram(t *testing.T) {
+	h := &histogram{name: "test_ms", help: "Test.", buckets: []float64{10, 100}, counts: make([]uint64, 2)}
+	h.Observe(5)
+	h.Observe(10)
+	h.Observe(50)
+	h.Observe(500)
+	var out bytes.Buffer
+	h.writeTo(&out)
+	assert.Equal(t, `# HELP test_ms Test.
+# TYPE test_ms histogram
+test_ms_bucket{le="10"} 2
+test_ms_bucket{le="100"} 3
+test_ms_bucket{le="+Inf"} 4
+test_ms_sum 565
+test_ms_count 4
+`, out.String())
+}
+
+// BenchmarkSSETTFB measures the time to the first event of new /events
+// connections while the conversation is updated at various snapshot
+// intervals.
+func BenchmarkSSETTFB(b *testing.B) {
+	for _, interval := range []time.Duration{5 * time.Millisecond, snapshotInterval, 100 * time.Millisecond} {
+		b.Run(fmt.Sprintf("interval=%s", interval), func(b *testing.B) {
+			ctx, cancel := context.WithCancel(logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil))))
+			defer cancel()
+			srv := NewServer(ctx, mf.AgentTypeClaude, nil, 0, "/chat")
+			httpSrv := newTTFBServer(srv)
+			defer httpSrv.Close()
+			// stand in for the snapshot loop
+			go func() {
+				statuses := []st.ConversationStatus{st.ConversationStatusChanging, st.ConversationStatusStable}
+				for i := 0; ; i++ {
+					select {
+					case <-ctx.Done():
+						return
+					case <-time.After(interval):
+						srv.emitter.UpdateStatusAndEmitChanges(statuses[i%2])
+					}
+				}
+			}()
+			client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+			before := sseConnectionTTFB.Count()
+
+			var total time.Duration
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				start := time.Now()
+				resp, err := client.Get(httpSrv.URL + "/v1/events")
+				if err != nil {
+					b.Fatal(err)
+				}
+				line, err := bufio.NewReader(resp.Body).ReadString('\n')
+				total += time.Since(start)
+				_ = resp.Body.Close()
+				if err != nil || !strings.HasPrefix(line, "event: ") {
+					b.Fatalf("unexpected first line %q: %v", line, err)
+				}
+			}
+			b.StopTimer()
+			b.ReportMetric(float64(total)/float64(time.Millisecond)/float64(b.N), "ttfb-ms/op")
+
+			// the TTFB is recorded before the first event is written
+			if got := sseConnectionTTFB.Count() - before; got != uint64(b.N) {
+				b.Fatalf("histogram recorded %d connections, want %d", got, b.N)
+			}
+		})
+	}
+}
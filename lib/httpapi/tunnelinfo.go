@@ -0,0 +1,39 @@
+package httpapi
+
+import (
+	"context"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+)
+
+// TunnelInfo is the state of the tunnel the server is exposed through.
+type TunnelInfo struct {
+	URL              string     `json:"url" doc:"Public URL of the server"`
+	Provider         string     `json:"provider" doc:"Provider of the current tunnel, e.g. localhost.run"`
+	ReconnectAttempt int        `json:"reconnect_attempt" doc:"Number of attempts to reconnect the tunnel that failed in a row. 0 if none failed since the last one that succeeded."`
+	ReconnectDelayMs int64      `json:"reconnect_delay_ms" doc:"How long is waited before the next attempt, in milliseconds. 0 if no attempt is pending."`
+	NextRetryAt      *time.Time `json:"next_retry_at,omitempty" doc:"When the next attempt is made, if one is pending"`
+	ReconnectCount   int        `json:"reconnect_count" doc:"Number of times the tunnel was reconnected since the server started"`
+}
+
+type TunnelInfoResponse struct {
+	Body TunnelInfo
+}
+
+// SetTunnelInfo makes GET /tunnel/info report the state info returns. Its
+// URL is the one set with SetTunnelURL.
+func (s *Server) SetTunnelInfo(info func() TunnelInfo) {
+	s.tunnelInfo.Store(&info)
+}
+
+// getTunnelInfo handles GET /tunnel/info
+func (s *Server) getTunnelInfo(ctx context.Context, input *struct{}) (*TunnelInfoResponse, error) {
+	info := s.tunnelInfo.Load()
+	if info == nil {
+		return nil, huma.Error404NotFound("the server isn't exposed through a tunnel")
+	}
+	resp := &TunnelInfoResponse{Body: (*info)()}
+	resp.Body.URL = s.TunnelURL()
+	return resp, nil
+}
@@ -0,0 +1,34 @@
+package httpapi
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	mf "github.com/zohaibahmed/clauder/lib/msgfmt"
+)
+
+func TestGetTunnelInfo(t *testing.T) {
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	srv := NewServer(ctx, mf.AgentTypeClaude, nil, 0, "/chat")
+	httpSrv := httptest.NewServer(srv.router)
+	defer httpSrv.Close()
+
+	assert.Equal(t, http.StatusNotFound, doJSON(t, http.MethodGet, httpSrv.URL+"/v1/tunnel/info", "", nil))
+
+	nextRetryAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	info := TunnelInfo{Provider: "bore", ReconnectAttempt: 2, ReconnectDelayMs: 4000, NextRetryAt: &nextRetryAt, ReconnectCount: 1}
+	srv.SetTunnelURL("https://bore-1.example.com")
+	srv.SetTunnelInfo(func() TunnelInfo { return info })
+	var resp TunnelInfoResponse
+	require.Equal(t, http.StatusOK, doJSON(t, http.MethodGet, httpSrv.URL+"/v1/tunnel/info", "", &resp.Body))
+	info.URL = "https://bore-1.example.com"
+	assert.Equal(t, info, resp.Body)
+}
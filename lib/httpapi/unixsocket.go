@@ -0,0 +1,65 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/xerrors"
+)
+
+// DefaultUnixSocketPath returns the path of the Unix domain socket the server
+// listens on by default, ~/.clauder/clauder.sock.
+func DefaultUnixSocketPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", xerrors.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".clauder", "clauder.sock"), nil
+}
+
+// listenUnix listens on a Unix domain socket that only the current user can
+// connect to. A stale socket left behind by a server that didn't shut down
+// cleanly is replaced, but a socket that's in use is not.
+func listenUnix(path string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, xerrors.Errorf("failed to create socket directory: %w", err)
+	}
+	if _, err := os.Stat(path); err == nil {
+		if conn, err := net.Dial("unix", path); err == nil {
+			_ = conn.Close()
+			return nil, xerrors.Errorf("socket %s is already in use", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, xerrors.Errorf("failed to remove stale socket: %w", err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, xerrors.Errorf("failed to stat socket: %w", err)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to listen on socket: %w", err)
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		_ = listener.Close()
+		return nil, xerrors.Errorf("failed to restrict socket permissions: %w", err)
+	}
+	return listener, nil
+}
+
+// UnixSocketClient returns an HTTP client that sends all requests to the
+// server listening on the Unix domain socket at path, regardless of the
+// host in the request URL.
+func UnixSocketClient(path string) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", path)
+			},
+		},
+	}
+}
@@ -0,0 +1,148 @@
+//go:build !windows
+
+package httpapi
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	mf "github.com/zohaibahmed/clauder/lib/msgfmt"
+)
+
+// socketPath returns a path short enough for a Unix domain socket.
+func socketPath(t *testing.T) string {
+	dir, err := os.MkdirTemp("", "clauder")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	return filepath.Join(dir, "sock", "clauder.sock")
+}
+
+func freePort(t *testing.T) int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func startServer(t *testing.T, srv *Server) {
+	errCh := make(chan error, 1)
+	go func() { errCh <- srv.Start() }()
+	t.Cleanup(func() {
+		require.NoError(t, srv.Stop(context.Background()))
+		assert.ErrorIs(t, <-errCh, http.ErrServerClosed)
+	})
+}
+
+// getOverSocket sends a request with net.Dial as the client.
+func getOverSocket(t *testing.T, path string, token string) int {
+	t.Helper()
+	var conn net.Conn
+	require.Eventually(t, func() bool {
+		var err error
+		conn, err = net.Dial("unix", path)
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	defer conn.Close()
+	request := "GET /v1/status HTTP/1.1\r\nHost: unix\r\n"
+	if token != "" {
+		request += fmt.Sprintf("Authorization: Bearer %s\r\n", token)
+	}
+	_, err := conn.Write([]byte(request + "Connection: close\r\n\r\n"))
+	require.NoError(t, err)
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestUnixSocket(t *testing.T) {
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(os.Stdout, nil)))
+	port := freePort(t)
+	srv := NewServerWithAuth(ctx, mf.AgentTypeClaude, nil, port, "/chat", "secret")
+	path := socketPath(t)
+	srv.EnableUnixSocket(path, false)
+	startServer(t, srv)
+
+	assert.Equal(t, http.StatusUnauthorized, getOverSocket(t, path, ""), "auth applies to the socket")
+	assert.Equal(t, http.StatusOK, getOverSocket(t, path, "secret"))
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	info, err = os.Stat(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o700), info.Mode().Perm())
+
+	_, err = net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	assert.Error(t, err, "TCP must be disabled")
+}
+
+func TestUnixSocketAndTCP(t *testing.T) {
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(os.Stdout, nil)))
+	port := freePort(t)
+	srv := NewServer(ctx, mf.AgentTypeClaude, nil, port, "/chat")
+	path := socketPath(t)
+	// a stale socket left behind by a crashed server is replaced
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o700))
+	stale, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	require.NoError(t, stale.Close())
+
+	srv.EnableUnixSocket(path, true)
+	startServer(t, srv)
+
+	assert.Equal(t, http.StatusOK, getOverSocket(t, path, ""))
+	resp, err := UnixSocketClient(path).Get("http://unix/v1/status")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, err = http.Get(fmt.Sprintf("http://127.0.0.1:%d/status", port))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestUnixSocketInUse(t *testing.T) {
+	path := socketPath(t)
+	listener, err := listenUnix(path)
+	require.NoError(t, err)
+	defer listener.Close()
+
+	_, err = listenUnix(path)
+	assert.ErrorContains(t, err, "already in use")
+}
+
+func TestOnListening(t *testing.T) {
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(os.Stdout, nil)))
+	port := freePort(t)
+	srv := NewServer(ctx, mf.AgentTypeClaude, nil, port, "/chat")
+	listening := make(chan struct{})
+	srv.OnListening(func() { close(listening) })
+	startServer(t, srv)
+	select {
+	case <-listening:
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnListening wasn't called")
+	}
+	resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/status", port))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// it isn't called if the server can't listen
+	other := NewServer(ctx, mf.AgentTypeClaude, nil, port, "/chat")
+	other.OnListening(func() { t.Error("OnListening was called although the port is in use") })
+	assert.ErrorContains(t, other.Start(), "address already in use")
+}
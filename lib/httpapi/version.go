@@ -0,0 +1,43 @@
+package httpapi
+
+import (
+	"net/http"
+	"strings"
+)
+
+// APIVersionPrefix is the path prefix of the current version of the API.
+// Breaking changes go into the next version, under /v2.
+const APIVersionPrefix = "/v1"
+
+// deprecationHeader is set on the responses of the unversioned routes.
+const deprecationHeader = "X-Deprecation"
+
+// VersionedURL returns the URL of the current version of the API of the
+// server at baseURL. baseURL may already be the URL of the API.
+func VersionedURL(baseURL string) string {
+	baseURL = strings.TrimRight(baseURL, "/")
+	if strings.HasSuffix(baseURL, APIVersionPrefix) {
+		return baseURL
+	}
+	return baseURL + APIVersionPrefix
+}
+
+// unversionedPath returns path without the API version prefix.
+func unversionedPath(path string) string {
+	if rest, ok := strings.CutPrefix(path, APIVersionPrefix); ok && (rest == "" || rest[0] == '/') {
+		return rest
+	}
+	return path
+}
+
+// redirectToVersion permanently redirects the requests of an unversioned
+// route to the current version. 308 is used rather than 301 so that
+// clients repeat the request with the same method and body.
+func (s *Server) redirectToVersion(w http.ResponseWriter, r *http.Request) {
+	location := s.basePath + APIVersionPrefix + r.URL.EscapedPath()
+	if r.URL.RawQuery != "" {
+		location += "?" + r.URL.RawQuery
+	}
+	w.Header().Set(deprecationHeader, "use "+APIVersionPrefix+"/")
+	http.Redirect(w, r, location, http.StatusPermanentRedirect)
+}
@@ -0,0 +1,115 @@
+package httpapi
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/coordinator"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	mf "github.com/zohaibahmed/clauder/lib/msgfmt"
+	st "github.com/zohaibahmed/clauder/lib/screentracker"
+)
+
+func TestVersionedURL(t *testing.T) {
+	for input, expected := range map[string]string{
+		"http://localhost:3284":            "http://localhost:3284/v1",
+		"http://localhost:3284/":           "http://localhost:3284/v1",
+		"https://example.com/clauder":      "https://example.com/clauder/v1",
+		"https://example.com/clauder/v1":   "https://example.com/clauder/v1",
+		"https://example.com/clauder/v1/":  "https://example.com/clauder/v1",
+		"https://example.com/clauder/v10":  "https://example.com/clauder/v10/v1",
+		"https://example.com/clauder/xv1/": "https://example.com/clauder/xv1/v1",
+	} {
+		assert.Equal(t, expected, VersionedURL(input), input)
+	}
+	// the API URL registered with the coordinator
+	assert.Equal(t, APIVersionPrefix, coordinator.APIPath)
+	assert.Equal(t, VersionedURL("https://abc.lhr.life/"), coordinator.APIURL("https://abc.lhr.life/"))
+}
+
+func TestUnversionedPath(t *testing.T) {
+	for input, expected := range map[string]string{
+		"/v1/health":           "/health",
+		"/v1/internal/screen":  "/internal/screen",
+		"/v1":                  "",
+		"/health":              "/health",
+		"/v10/health":          "/v10/health",
+		"/internal/v1/message": "/internal/v1/message",
+	} {
+		assert.Equal(t, expected, unversionedPath(input), input)
+	}
+}
+
+func TestAPIVersionRedirect(t *testing.T) {
+	ctx, cancel := context.WithCancel(logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil))))
+	defer cancel()
+	srv, httpSrv := newRoutingTestServer(t, ctx, &echoAgent{})
+	defer srv.snapshotDemand.acquire()()
+	require.Eventually(t, func() bool {
+		return srv.conversation.Status() == st.ConversationStatusStable
+	}, 5*time.Second, 10*time.Millisecond)
+
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := noRedirect.Post(httpSrv.URL+"/message?template=review", "application/json", strings.NewReader(`{"type":"user","content":"hello there agent"}`))
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusPermanentRedirect, resp.StatusCode)
+	assert.Equal(t, "/v1/message?template=review", resp.Header.Get("Location"))
+	assert.Equal(t, "use /v1/", resp.Header.Get(deprecationHeader))
+
+	// clients that follow the redirect send the message with the same
+	// method and body
+	require.Equal(t, http.StatusOK, doJSON(t, http.MethodPost, httpSrv.URL+"/message", `{"type":"user","content":"hello there agent"}`, nil))
+	require.Eventually(t, func() bool {
+		return srv.conversation.Status() == st.ConversationStatusStable && len(srv.messages()) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, http.StatusOK, doJSON(t, http.MethodPost, httpSrv.URL+"/v1/message", `{"type":"user","content":"hello again agent"}`, nil))
+	require.Eventually(t, func() bool {
+		return srv.conversation.Status() == st.ConversationStatusStable && len(srv.messages()) == 5
+	}, 5*time.Second, 10*time.Millisecond)
+
+	var messages MessagesResponse
+	require.Equal(t, http.StatusOK, doJSON(t, http.MethodGet, httpSrv.URL+"/messages", "", &messages.Body))
+	require.Len(t, messages.Body.Messages, 5)
+	assert.Equal(t, "hello there agent", messages.Body.Messages[1].Content)
+	assert.Equal(t, "hello again agent", messages.Body.Messages[3].Content)
+
+	// the routes that aren't part of the API aren't versioned
+	resp, err = noRedirect.Get(httpSrv.URL + "/metrics")
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Empty(t, resp.Header.Get(deprecationHeader))
+}
+
+func TestAPIVersionRedirectBasePath(t *testing.T) {
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	srv := NewServer(ctx, mf.AgentTypeClaude, nil, 0, "/clauder/chat")
+	require.NoError(t, srv.SetBasePath("/clauder"))
+	httpSrv := httptest.NewServer(srv.handler())
+	defer httpSrv.Close()
+
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := noRedirect.Get(httpSrv.URL + "/clauder/status")
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusPermanentRedirect, resp.StatusCode)
+	assert.Equal(t, "/clauder/v1/status", resp.Header.Get("Location"))
+
+	resp, err = http.Get(httpSrv.URL + "/clauder/status")
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
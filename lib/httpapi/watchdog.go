@@ -0,0 +1,161 @@
+package httpapi
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/zohaibahmed/clauder/lib/util"
+)
+
+type WatchdogCheck string
+
+const (
+	// WatchdogCheckPTYReader fails once the pseudo terminal reader stopped.
+	WatchdogCheckPTYReader WatchdogCheck = "pty_reader"
+	// WatchdogCheckProcess fails once the agent process exited.
+	WatchdogCheckProcess WatchdogCheck = "process"
+	// WatchdogCheckEventLoop fails if the loop that feeds the event emitter
+	// hasn't run recently.
+	WatchdogCheckEventLoop WatchdogCheck = "event_loop"
+)
+
+var WatchdogCheckValues = []WatchdogCheck{
+	WatchdogCheckPTYReader,
+	WatchdogCheckProcess,
+	WatchdogCheckEventLoop,
+}
+
+func (c WatchdogCheck) Schema(r huma.Registry) *huma.Schema {
+	return util.OpenAPISchema(r, "WatchdogCheck", WatchdogCheckValues)
+}
+
+const defaultWatchdogInterval = 30 * time.Second
+
+// WatchdogProcess is the part of the agent process monitored by the watchdog.
+type WatchdogProcess interface {
+	IsAlive() bool
+	Heartbeat() <-chan struct{}
+}
+
+type WatchdogConfig struct {
+	Process WatchdogProcess
+	// LastEvent returns the last time the event loop ran.
+	LastEvent func() time.Time
+	// Interval between checks. Defaults to 30 seconds.
+	Interval time.Duration
+	// MaxEventAge is how long the event loop may go without running before
+	// it's considered stuck. Defaults to twice the snapshot interval.
+	MaxEventAge time.Duration
+	// OnFailure is called after every check that fails. It's the place to
+	// apply a restart policy.
+	OnFailure func(status WatchdogStatus)
+	GetTime   func() time.Time
+}
+
+type WatchdogStatus struct {
+	Healthy       bool            `json:"healthy" doc:"Whether all checks passed"`
+	Failures      []WatchdogCheck `json:"failures" nullable:"false" doc:"Checks that failed during the last run"`
+	LastCheck     time.Time       `json:"last_check" doc:"Time of the last run. Zero if the watchdog hasn't run yet."`
+	LastHeartbeat time.Time       `json:"last_heartbeat" doc:"Last time the pseudo terminal reader processed output"`
+}
+
+// Watchdog periodically checks that the components delivering events are
+// still working. The HTTP server can stay up after they stop, in which case
+// clients silently stop receiving updates.
+type Watchdog struct {
+	mu          sync.Mutex
+	cfg         WatchdogConfig
+	emitter     *EventEmitter
+	status      WatchdogStatus
+	readerAlive bool
+}
+
+func NewWatchdog(emitter *EventEmitter, cfg WatchdogConfig) *Watchdog {
+	if cfg.Interval == 0 {
+		cfg.Interval = defaultWatchdogInterval
+	}
+	if cfg.MaxEventAge == 0 {
+		cfg.MaxEventAge = 2 * snapshotInterval
+	}
+	if cfg.GetTime == nil {
+		cfg.GetTime = time.Now
+	}
+	return &Watchdog{
+		cfg:         cfg,
+		emitter:     emitter,
+		status:      WatchdogStatus{Healthy: true, Failures: []WatchdogCheck{}},
+		readerAlive: true,
+	}
+}
+
+// Assumes the caller holds the lock.
+func (w *Watchdog) drainHeartbeat() {
+	for w.readerAlive {
+		select {
+		case _, ok := <-w.cfg.Process.Heartbeat():
+			if !ok {
+				w.readerAlive = false
+				return
+			}
+			w.status.LastHeartbeat = w.cfg.GetTime()
+		default:
+			return
+		}
+	}
+}
+
+// Check runs all checks once. If any fails, it emits a watchdog_alert event
+// and calls OnFailure.
+func (w *Watchdog) Check() WatchdogStatus {
+	w.mu.Lock()
+	w.drainHeartbeat()
+	now := w.cfg.GetTime()
+	failures := []WatchdogCheck{}
+	if !w.readerAlive {
+		failures = append(failures, WatchdogCheckPTYReader)
+	}
+	if !w.cfg.Process.IsAlive() {
+		failures = append(failures, WatchdogCheckProcess)
+	}
+	if now.Sub(w.cfg.LastEvent()) > w.cfg.MaxEventAge {
+		failures = append(failures, WatchdogCheckEventLoop)
+	}
+	w.status.Healthy = len(failures) == 0
+	w.status.Failures = failures
+	w.status.LastCheck = now
+	status := w.status
+	w.mu.Unlock()
+
+	if !status.Healthy {
+		w.emitter.EmitWatchdogAlert(status)
+		if w.cfg.OnFailure != nil {
+			w.cfg.OnFailure(status)
+		}
+	}
+	return status
+}
+
+// Status returns the result of the last check.
+func (w *Watchdog) Status() WatchdogStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.status
+}
+
+// Start runs the checks every interval until ctx is done.
+func (w *Watchdog) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(w.cfg.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				w.Check()
+			}
+		}
+	}()
+}
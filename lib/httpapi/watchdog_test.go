@@ -0,0 +1,172 @@
+package httpapi
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	mf "github.com/zohaibahmed/clauder/lib/msgfmt"
+)
+
+type mockProcess struct {
+	alive     atomic.Bool
+	heartbeat chan struct{}
+}
+
+func newMockProcess() *mockProcess {
+	p := &mockProcess{heartbeat: make(chan struct{}, 1)}
+	p.alive.Store(true)
+	return p
+}
+
+func (p *mockProcess) IsAlive() bool              { return p.alive.Load() }
+func (p *mockProcess) Heartbeat() <-chan struct{} { return p.heartbeat }
+
+type watchdogTest struct {
+	process   *mockProcess
+	now       time.Time
+	lastEvent time.Time
+	failures  []WatchdogStatus
+	watchdog  *Watchdog
+	events    <-chan Event
+}
+
+func newWatchdogTest(t *testing.T) *watchdogTest {
+	t.Helper()
+	wt := &watchdogTest{
+		process:   newMockProcess(),
+		now:       time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		lastEvent: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	emitter := NewEventEmitter(10)
+	_, wt.events, _ = emitter.Subscribe()
+	wt.watchdog = NewWatchdog(emitter, WatchdogConfig{
+		Process:   wt.process,
+		LastEvent: func() time.Time { return wt.lastEvent },
+		OnFailure: func(status WatchdogStatus) { wt.failures = append(wt.failures, status) },
+		GetTime:   func() time.Time { return wt.now },
+	})
+	return wt
+}
+
+func (wt *watchdogTest) requireAlert(t *testing.T, expected ...WatchdogCheck) {
+	t.Helper()
+	select {
+	case event := <-wt.events:
+		assert.Equal(t, Event{
+			Type:    EventTypeWatchdogAlert,
+			Payload: WatchdogAlertBody{Failures: expected, Time: wt.now},
+		}, event)
+	default:
+		t.Fatal("expected a watchdog alert")
+	}
+}
+
+func TestWatchdog(t *testing.T) {
+	t.Run("healthy", func(t *testing.T) {
+		wt := newWatchdogTest(t)
+		wt.process.heartbeat <- struct{}{}
+		status := wt.watchdog.Check()
+		assert.Equal(t, WatchdogStatus{Healthy: true, Failures: []WatchdogCheck{}, LastCheck: wt.now, LastHeartbeat: wt.now}, status)
+		assert.Equal(t, status, wt.watchdog.Status())
+		assert.Empty(t, wt.failures)
+		assert.Empty(t, wt.events)
+	})
+
+	t.Run("pty-reader-stopped", func(t *testing.T) {
+		wt := newWatchdogTest(t)
+		close(wt.process.heartbeat)
+		status := wt.watchdog.Check()
+		assert.False(t, status.Healthy)
+		assert.Equal(t, []WatchdogCheck{WatchdogCheckPTYReader}, status.Failures)
+		assert.Equal(t, []WatchdogStatus{status}, wt.failures)
+		wt.requireAlert(t, WatchdogCheckPTYReader)
+
+		// The reader doesn't come back.
+		wt.watchdog.Check()
+		wt.requireAlert(t, WatchdogCheckPTYReader)
+	})
+
+	t.Run("process-exited", func(t *testing.T) {
+		wt := newWatchdogTest(t)
+		wt.process.alive.Store(false)
+		status := wt.watchdog.Check()
+		assert.Equal(t, []WatchdogCheck{WatchdogCheckProcess}, status.Failures)
+		assert.Len(t, wt.failures, 1)
+		wt.requireAlert(t, WatchdogCheckProcess)
+	})
+
+	t.Run("event-loop-stuck", func(t *testing.T) {
+		wt := newWatchdogTest(t)
+		wt.now = wt.lastEvent.Add(2 * snapshotInterval)
+		assert.True(t, wt.watchdog.Check().Healthy)
+
+		wt.now = wt.lastEvent.Add(2*snapshotInterval + time.Millisecond)
+		status := wt.watchdog.Check()
+		assert.Equal(t, []WatchdogCheck{WatchdogCheckEventLoop}, status.Failures)
+		wt.requireAlert(t, WatchdogCheckEventLoop)
+
+		// Recovers once the loop runs again.
+		wt.lastEvent = wt.now
+		assert.True(t, wt.watchdog.Check().Healthy)
+		assert.Len(t, wt.failures, 1)
+	})
+
+	t.Run("multiple-failures", func(t *testing.T) {
+		wt := newWatchdogTest(t)
+		close(wt.process.heartbeat)
+		wt.process.alive.Store(false)
+		wt.now = wt.now.Add(time.Minute)
+		wt.watchdog.Check()
+		wt.requireAlert(t, WatchdogCheckPTYReader, WatchdogCheckProcess, WatchdogCheckEventLoop)
+	})
+}
+
+func TestWatchdogStart(t *testing.T) {
+	process := newMockProcess()
+	process.alive.Store(false)
+	emitter := NewEventEmitter(10)
+	_, events, _ := emitter.Subscribe()
+	w := NewWatchdog(emitter, WatchdogConfig{
+		Process:   process,
+		LastEvent: time.Now,
+		Interval:  10 * time.Millisecond,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w.Start(ctx)
+
+	select {
+	case event := <-events:
+		assert.Equal(t, EventTypeWatchdogAlert, event.Type)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a watchdog alert")
+	}
+}
+
+func TestGetLivez(t *testing.T) {
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(os.Stdout, nil)))
+	srv := NewServer(ctx, mf.AgentTypeClaude, nil, 0, "/chat")
+
+	resp, err := srv.getLivez(ctx, &struct{}{})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.Status)
+	assert.True(t, resp.Body.Healthy)
+
+	process := newMockProcess()
+	process.alive.Store(false)
+	srv.watchdog = NewWatchdog(srv.emitter, WatchdogConfig{Process: process, LastEvent: time.Now})
+	srv.watchdog.Check()
+
+	resp, err = srv.getLivez(ctx, &struct{}{})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.Status)
+	assert.Equal(t, []WatchdogCheck{WatchdogCheckProcess}, resp.Body.Failures)
+}
@@ -0,0 +1,377 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// maxPushSubscriptions is the number of push subscriptions the server
+	// keeps at most.
+	maxPushSubscriptions = 100
+	// pushTTL is how long push services keep a notification for a browser
+	// that isn't connected, in seconds.
+	pushTTL = 24 * 60 * 60
+	// vapidTokenLifetime is how long the VAPID tokens are valid. RFC 8292
+	// allows at most 24 hours.
+	vapidTokenLifetime = 12 * time.Hour
+	// pushRecordSize is the record size of the encrypted payloads. The
+	// payload is always sent as a single record.
+	pushRecordSize = 4096
+)
+
+// PushSubscription is a browser's Web Push subscription, as returned by
+// PushSubscription.toJSON().
+type PushSubscription struct {
+	Endpoint       string   `json:"endpoint" format:"uri" maxLength:"2048" doc:"URL of the push service to send the notifications to. Must be https."`
+	ExpirationTime *float64 `json:"expirationTime,omitempty" required:"false" doc:"Ignored"`
+	Keys           struct {
+		P256dh string `json:"p256dh" doc:"The browser's P-256 ECDH public key, base64url encoded"`
+		Auth   string `json:"auth" doc:"The browser's 16-byte authentication secret, base64url encoded"`
+	} `json:"keys"`
+}
+
+type PushSubscribeRequest struct {
+	Body PushSubscription
+}
+
+type VAPIDPublicKeyResponse struct {
+	Body struct {
+		PublicKey string `json:"public_key" doc:"The server's VAPID public key, base64url encoded, to pass as the applicationServerKey when subscribing to push notifications"`
+	}
+}
+
+// PushNotification is the payload of the push notifications, for the
+// service worker to show.
+type PushNotification struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+// pushSubscriber is a validated subscription.
+type pushSubscriber struct {
+	endpoint string
+	// publicKey is the browser's ECDH public key, and auth its
+	// authentication secret.
+	publicKey *ecdh.PublicKey
+	auth      []byte
+}
+
+// WebPushNotifier sends push notifications to browsers with the Web Push
+// protocol (RFC 8030). The notifications are authenticated with VAPID
+// (RFC 8292) and encrypted with aes128gcm (RFC 8291).
+type WebPushNotifier struct {
+	// subject is the VAPID contact of the server, a mailto: or https: URL.
+	subject  string
+	vapidKey *ecdsa.PrivateKey
+	client   *http.Client
+	getTime  func() time.Time
+
+	mu            sync.Mutex
+	subscriptions map[string]pushSubscriber
+}
+
+// NewWebPushNotifier generates a new VAPID key pair. The subscriptions are
+// tied to it, so browsers must subscribe again after the server restarts.
+func NewWebPushNotifier(subject string) (*WebPushNotifier, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to generate VAPID key: %w", err)
+	}
+	return &WebPushNotifier{
+		subject:       subject,
+		vapidKey:      key,
+		client:        &http.Client{Timeout: 10 * time.Second},
+		getTime:       time.Now,
+		subscriptions: make(map[string]pushSubscriber),
+	}, nil
+}
+
+// PublicKey returns the VAPID public key as an uncompressed P-256 point,
+// base64url encoded.
+func (n *WebPushNotifier) PublicKey() string {
+	return base64.RawURLEncoding.EncodeToString(n.publicKeyBytes())
+}
+
+func (n *WebPushNotifier) publicKeyBytes() []byte {
+	key, err := n.vapidKey.PublicKey.ECDH()
+	if err != nil {
+		// the key was generated on P-256
+		panic(fmt.Sprintf("invalid VAPID key: %v", err))
+	}
+	return key.Bytes()
+}
+
+// decodeBase64URL decodes base64url with or without padding, as browsers
+// don't agree on it.
+func decodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// Subscribe adds a subscription, or replaces the one with the same
+// endpoint.
+func (n *WebPushNotifier) Subscribe(sub PushSubscription) error {
+	endpoint, err := url.Parse(sub.Endpoint)
+	if err != nil || endpoint.Scheme != "https" || endpoint.Host == "" {
+		return xerrors.Errorf("invalid endpoint %q: must be an https URL", sub.Endpoint)
+	}
+	p256dh, err := decodeBase64URL(sub.Keys.P256dh)
+	if err != nil {
+		return xerrors.Errorf("invalid p256dh key: %w", err)
+	}
+	publicKey, err := ecdh.P256().NewPublicKey(p256dh)
+	if err != nil {
+		return xerrors.Errorf("invalid p256dh key: %w", err)
+	}
+	auth, err := decodeBase64URL(sub.Keys.Auth)
+	if err != nil || len(auth) != 16 {
+		return xerrors.Errorf("invalid auth secret: must be 16 bytes")
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if _, ok := n.subscriptions[sub.Endpoint]; !ok && len(n.subscriptions) >= maxPushSubscriptions {
+		return xerrors.Errorf("too many push subscriptions")
+	}
+	n.subscriptions[sub.Endpoint] = pushSubscriber{endpoint: sub.Endpoint, publicKey: publicKey, auth: auth}
+	return nil
+}
+
+// SubscriptionCount returns the number of subscriptions.
+func (n *WebPushNotifier) SubscriptionCount() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.subscriptions)
+}
+
+// Notify sends notification to every subscription, and returns once they
+// were all sent. Subscriptions the push service reports as expired, with a
+// 404 or a 410 response, are removed. The errors of the other failures are
+// joined.
+func (n *WebPushNotifier) Notify(ctx context.Context, notification PushNotification) error {
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		return xerrors.Errorf("failed to marshal notification: %w", err)
+	}
+	n.mu.Lock()
+	subscribers := make([]pushSubscriber, 0, len(n.subscriptions))
+	for _, sub := range n.subscriptions {
+		subscribers = append(subscribers, sub)
+	}
+	n.mu.Unlock()
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(subscribers))
+	for i, sub := range subscribers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			gone, err := n.send(ctx, sub, payload)
+			if gone {
+				n.mu.Lock()
+				delete(n.subscriptions, sub.endpoint)
+				n.mu.Unlock()
+			}
+			errs[i] = err
+		}()
+	}
+	wg.Wait()
+	var messages []string
+	for _, err := range errs {
+		if err != nil {
+			messages = append(messages, err.Error())
+		}
+	}
+	if len(messages) > 0 {
+		return xerrors.New(strings.Join(messages, "; "))
+	}
+	return nil
+}
+
+// send posts an encrypted payload to a subscription, and returns whether
+// the subscription expired.
+func (n *WebPushNotifier) send(ctx context.Context, sub pushSubscriber, payload []byte) (bool, error) {
+	body, err := encryptPushPayload(sub, payload)
+	if err != nil {
+		return false, xerrors.Errorf("failed to encrypt push payload: %w", err)
+	}
+	authorization, err := n.vapidAuthorization(sub.endpoint)
+	if err != nil {
+		return false, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return false, xerrors.Errorf("failed to create push request: %w", err)
+	}
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", fmt.Sprint(pushTTL))
+	req.Header.Set("Urgency", "normal")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return false, xerrors.Errorf("failed to send push notification: %w", err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return true, nil
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return false, xerrors.Errorf("push service %s returned %d: %s", req.URL.Host, resp.StatusCode, respBody)
+	}
+	return false, nil
+}
+
+// vapidAuthorization returns the Authorization header of a push request to
+// endpoint: a JWT signed with the VAPID key, whose audience is the push
+// service's origin, and the public key.
+func (n *WebPushNotifier) vapidAuthorization(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", xerrors.Errorf("invalid endpoint: %w", err)
+	}
+	header, err := json.Marshal(map[string]string{"typ": "JWT", "alg": "ES256"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]any{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": n.getTime().Add(vapidTokenLifetime).Unix(),
+		"sub": n.subject,
+	})
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	r, s, err := ecdsa.Sign(rand.Reader, n.vapidKey, digest[:])
+	if err != nil {
+		return "", xerrors.Errorf("failed to sign VAPID token: %w", err)
+	}
+	// ES256 signatures are r and s as 32-byte big-endian integers
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+	token := signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+	return fmt.Sprintf("vapid t=%s, k=%s", token, n.PublicKey()), nil
+}
+
+// encryptPushPayload encrypts payload for a subscription with the
+// aes128gcm content encoding, as specified by RFC 8291.
+func encryptPushPayload(sub pushSubscriber, payload []byte) ([]byte, error) {
+	// the payload, its delimiter and the tag must fit in a record
+	if len(payload)+1+16 > pushRecordSize {
+		return nil, xerrors.Errorf("payload too large")
+	}
+	serverKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	sharedSecret, err := serverKey.ECDH(sub.publicKey)
+	if err != nil {
+		return nil, err
+	}
+	serverPublicKey := serverKey.PublicKey().Bytes()
+
+	keyInfo := append([]byte("WebPush: info\x00"), sub.publicKey.Bytes()...)
+	keyInfo = append(keyInfo, serverPublicKey...)
+	ikm := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, sharedSecret, sub.auth, keyInfo), ikm); err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	prk := hkdf.Extract(sha256.New, ikm, salt)
+	cek := make([]byte, 16)
+	if _, err := io.ReadFull(hkdf.Expand(sha256.New, prk, []byte("Content-Encoding: aes128gcm\x00")), cek); err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, 12)
+	if _, err := io.ReadFull(hkdf.Expand(sha256.New, prk, []byte("Content-Encoding: nonce\x00")), nonce); err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	// the header holds the salt, the record size and the server's public
+	// key, which the browser needs to derive the same keys
+	body := make([]byte, 0, 16+4+1+len(serverPublicKey)+len(payload)+1+gcm.Overhead())
+	body = append(body, salt...)
+	body = binary.BigEndian.AppendUint32(body, pushRecordSize)
+	body = append(body, byte(len(serverPublicKey)))
+	body = append(body, serverPublicKey...)
+	// 2 delimits the last record, with no padding
+	plaintext := append(append([]byte(nil), payload...), 2)
+	return gcm.Seal(body, nonce, plaintext, nil), nil
+}
+
+// EnableWebPush allows browsers to subscribe to push notifications with
+// POST /push/subscribe, and notifies them when the agent finishes
+// responding to a message.
+func (s *Server) EnableWebPush(ctx context.Context, notifier *WebPushNotifier) {
+	s.webPush.Store(notifier)
+	go s.watchTaskCompletions(ctx, func(elapsed time.Duration) {
+		notification := PushNotification{
+			Title: "Agent finished its task",
+			Body:  fmt.Sprintf("The %s agent finished responding after %s.", s.agentType, elapsed.Round(time.Second)),
+		}
+		go func() {
+			if err := notifier.Notify(ctx, notification); err != nil {
+				s.logger.Error("Failed to send push notification", "error", err)
+			}
+		}()
+	})
+}
+
+// getVAPIDPublicKey handles GET /push/vapid-public-key
+func (s *Server) getVAPIDPublicKey(ctx context.Context, input *struct{}) (*VAPIDPublicKeyResponse, error) {
+	notifier := s.webPush.Load()
+	if notifier == nil {
+		return nil, huma.Error503ServiceUnavailable("push notifications are not enabled")
+	}
+	resp := &VAPIDPublicKeyResponse{}
+	resp.Body.PublicKey = notifier.PublicKey()
+	return resp, nil
+}
+
+// subscribePush handles POST /push/subscribe
+func (s *Server) subscribePush(ctx context.Context, input *PushSubscribeRequest) (*struct{}, error) {
+	notifier := s.webPush.Load()
+	if notifier == nil {
+		return nil, huma.Error503ServiceUnavailable("push notifications are not enabled")
+	}
+	if err := notifier.Subscribe(input.Body); err != nil {
+		return nil, huma.Error422UnprocessableEntity(err.Error())
+	}
+	return nil, nil
+}
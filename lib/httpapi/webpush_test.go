@@ -0,0 +1,350 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/events"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	mf "github.com/zohaibahmed/clauder/lib/msgfmt"
+	st "github.com/zohaibahmed/clauder/lib/screentracker"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/xerrors"
+)
+
+// testBrowser is a browser subscribed to push notifications, whose keys
+// decrypt them.
+type testBrowser struct {
+	key  *ecdh.PrivateKey
+	auth []byte
+}
+
+func newTestBrowser(t *testing.T) *testBrowser {
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	auth := make([]byte, 16)
+	_, err = rand.Read(auth)
+	require.NoError(t, err)
+	return &testBrowser{key: key, auth: auth}
+}
+
+func (b *testBrowser) subscription(endpoint string) PushSubscription {
+	sub := PushSubscription{Endpoint: endpoint}
+	sub.Keys.P256dh = base64.RawURLEncoding.EncodeToString(b.key.PublicKey().Bytes())
+	sub.Keys.Auth = base64.RawURLEncoding.EncodeToString(b.auth)
+	return sub
+}
+
+// open decrypts an aes128gcm push payload, as specified by RFC 8291.
+func (b *testBrowser) open(body []byte) ([]byte, error) {
+	if len(body) < 21 || len(body) < 21+int(body[20]) {
+		return nil, xerrors.New("payload too short")
+	}
+	salt := body[:16]
+	if binary.BigEndian.Uint32(body[16:20]) != pushRecordSize {
+		return nil, xerrors.New("unexpected record size")
+	}
+	idLen := int(body[20])
+	serverPublicKey, err := ecdh.P256().NewPublicKey(body[21 : 21+idLen])
+	if err != nil {
+		return nil, err
+	}
+	ciphertext := body[21+idLen:]
+
+	sharedSecret, err := b.key.ECDH(serverPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	keyInfo := append([]byte("WebPush: info\x00"), b.key.PublicKey().Bytes()...)
+	keyInfo = append(keyInfo, serverPublicKey.Bytes()...)
+	ikm := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, sharedSecret, b.auth, keyInfo), ikm); err != nil {
+		return nil, err
+	}
+	prk := hkdf.Extract(sha256.New, ikm, salt)
+	cek := make([]byte, 16)
+	if _, err := io.ReadFull(hkdf.Expand(sha256.New, prk, []byte("Content-Encoding: aes128gcm\x00")), cek); err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, 12)
+	if _, err := io.ReadFull(hkdf.Expand(sha256.New, prk, []byte("Content-Encoding: nonce\x00")), nonce); err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, err
+	}
+	// the padding is zeros after the delimiter, which is 2 in the last
+	// record
+	plaintext = bytes.TrimRight(plaintext, "\x00")
+	if len(plaintext) == 0 || plaintext[len(plaintext)-1] != 2 {
+		return nil, xerrors.New("not the last record")
+	}
+	return plaintext[:len(plaintext)-1], nil
+}
+
+func (b *testBrowser) decrypt(t *testing.T, body []byte) []byte {
+	t.Helper()
+	plaintext, err := b.open(body)
+	require.NoError(t, err)
+	return plaintext
+}
+
+// mockPushService is a push service that checks the VAPID authentication
+// of the requests, and records their bodies by path.
+type mockPushService struct {
+	// publicKey is the VAPID public key the requests must be signed with.
+	publicKey string
+	// gone holds the paths of the expired subscriptions.
+	gone map[string]bool
+
+	mu     sync.Mutex
+	bodies map[string][][]byte
+}
+
+func newMockPushService(t *testing.T, publicKey string) (*mockPushService, *httptest.Server) {
+	m := &mockPushService{publicKey: publicKey, gone: make(map[string]bool), bodies: make(map[string][][]byte)}
+	srv := httptest.NewTLSServer(m)
+	t.Cleanup(srv.Close)
+	return m, srv
+}
+
+func (m *mockPushService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !m.checkVAPID(r) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if r.Header.Get("Content-Encoding") != "aes128gcm" || r.Header.Get("TTL") == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if m.gone[r.URL.Path] {
+		w.WriteHeader(http.StatusGone)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	m.mu.Lock()
+	m.bodies[r.URL.Path] = append(m.bodies[r.URL.Path], body)
+	m.mu.Unlock()
+	w.WriteHeader(http.StatusCreated)
+}
+
+// checkVAPID verifies the VAPID token of a request, as specified by RFC
+// 8292.
+func (m *mockPushService) checkVAPID(r *http.Request) bool {
+	scheme, params, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || scheme != "vapid" {
+		return false
+	}
+	var token, key string
+	for _, param := range strings.Split(params, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+		switch name {
+		case "t":
+			token = value
+		case "k":
+			key = value
+		}
+	}
+	if key != m.publicKey {
+		return false
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return false
+	}
+	keyBytes, err := base64.RawURLEncoding.DecodeString(key)
+	if err != nil || len(keyBytes) != 65 {
+		return false
+	}
+	publicKey := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(keyBytes[1:33]), Y: new(big.Int).SetBytes(keyBytes[33:])}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || len(signature) != 64 {
+		return false
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if !ecdsa.Verify(publicKey, digest[:], new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])) {
+		return false
+	}
+	claimsJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return false
+	}
+	var claims struct {
+		Aud string `json:"aud"`
+		Exp int64  `json:"exp"`
+		Sub string `json:"sub"`
+	}
+	if err := json.Unmarshal(claimsJSON, &claims); err != nil {
+		return false
+	}
+	exp := time.Unix(claims.Exp, 0)
+	return claims.Aud == "https://"+r.Host && exp.After(time.Now()) && exp.Before(time.Now().Add(24*time.Hour)) && claims.Sub != ""
+}
+
+func (m *mockPushService) Bodies(path string) [][]byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.bodies[path]
+}
+
+func newTestWebPushNotifier(t *testing.T) *WebPushNotifier {
+	notifier, err := NewWebPushNotifier("mailto:test@example.com")
+	require.NoError(t, err)
+	return notifier
+}
+
+func TestWebPushNotify(t *testing.T) {
+	notifier := newTestWebPushNotifier(t)
+	push, pushSrv := newMockPushService(t, notifier.PublicKey())
+	notifier.client = pushSrv.Client()
+	push.gone["/expired"] = true
+
+	browser := newTestBrowser(t)
+	other := newTestBrowser(t)
+	require.NoError(t, notifier.Subscribe(browser.subscription(pushSrv.URL+"/browser")))
+	require.NoError(t, notifier.Subscribe(other.subscription(pushSrv.URL+"/expired")))
+	assert.Equal(t, 2, notifier.SubscriptionCount())
+
+	notification := PushNotification{Title: "Agent finished its task", Body: "The claude agent finished responding after 3m0s."}
+	require.NoError(t, notifier.Notify(context.Background(), notification))
+
+	// the expired subscription was removed
+	assert.Equal(t, 1, notifier.SubscriptionCount())
+	bodies := push.Bodies("/browser")
+	require.Len(t, bodies, 1)
+	assert.NotContains(t, string(bodies[0]), "Agent finished")
+	assert.JSONEq(t, `{"title":"Agent finished its task","body":"The claude agent finished responding after 3m0s."}`, string(browser.decrypt(t, bodies[0])))
+	// the payload can only be decrypted with the subscription's keys
+	_, err := other.open(bodies[0])
+	assert.Error(t, err)
+
+	// a push service that rejects the request
+	notifier.vapidKey = newTestWebPushNotifier(t).vapidKey
+	err = notifier.Notify(context.Background(), notification)
+	assert.ErrorContains(t, err, "returned 401")
+	assert.Equal(t, 1, notifier.SubscriptionCount())
+}
+
+func TestWebPushSubscribe(t *testing.T) {
+	notifier := newTestWebPushNotifier(t)
+	browser := newTestBrowser(t)
+
+	invalid := map[string]PushSubscription{
+		"http endpoint":  browser.subscription("http://push.example.com/1"),
+		"no host":        browser.subscription("https:///1"),
+		"invalid p256dh": browser.subscription("https://push.example.com/1"),
+		"invalid auth":   browser.subscription("https://push.example.com/1"),
+	}
+	sub := invalid["invalid p256dh"]
+	sub.Keys.P256dh = base64.RawURLEncoding.EncodeToString(make([]byte, 65))
+	invalid["invalid p256dh"] = sub
+	sub = invalid["invalid auth"]
+	sub.Keys.Auth = base64.RawURLEncoding.EncodeToString(make([]byte, 8))
+	invalid["invalid auth"] = sub
+	for name, sub := range invalid {
+		assert.Error(t, notifier.Subscribe(sub), name)
+	}
+	assert.Zero(t, notifier.SubscriptionCount())
+
+	// padded keys are accepted, and subscribing again replaces the
+	// subscription
+	sub = browser.subscription("https://push.example.com/1")
+	sub.Keys.Auth = base64.URLEncoding.EncodeToString(browser.auth)
+	require.NoError(t, notifier.Subscribe(sub))
+	require.NoError(t, notifier.Subscribe(sub))
+	assert.Equal(t, 1, notifier.SubscriptionCount())
+
+	for i := 2; i <= maxPushSubscriptions; i++ {
+		require.NoError(t, notifier.Subscribe(browser.subscription(fmt.Sprintf("https://push.example.com/%d", i))))
+	}
+	assert.ErrorContains(t, notifier.Subscribe(browser.subscription("https://push.example.com/more")), "too many")
+}
+
+func TestServerWebPush(t *testing.T) {
+	ctx, cancel := context.WithCancel(logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil))))
+	defer cancel()
+	srv := NewServer(ctx, mf.AgentTypeClaude, nil, 0, "/chat")
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		srv.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// not enabled
+	assert.Equal(t, http.StatusServiceUnavailable, request(http.MethodGet, "/v1/push/vapid-public-key", "").Code)
+
+	notifier := newTestWebPushNotifier(t)
+	push, pushSrv := newMockPushService(t, notifier.PublicKey())
+	notifier.client = pushSrv.Client()
+	srv.EnableWebPush(ctx, notifier)
+
+	rec := request(http.MethodGet, "/v1/push/vapid-public-key", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var keyResp struct {
+		PublicKey string `json:"public_key"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &keyResp))
+	assert.Equal(t, notifier.PublicKey(), keyResp.PublicKey)
+
+	browser := newTestBrowser(t)
+	sub, err := json.Marshal(browser.subscription(pushSrv.URL + "/browser"))
+	require.NoError(t, err)
+	// browsers send the expiration time, which is null
+	subJSON := strings.Replace(string(sub), "{", `{"expirationTime":null,`, 1)
+	rec = request(http.MethodPost, "/v1/push/subscribe", subJSON)
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+	rec = request(http.MethodPost, "/v1/push/subscribe", strings.Replace(subJSON, "https://", "http://", 1))
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Equal(t, 1, notifier.SubscriptionCount())
+
+	// the agent starting up isn't a task
+	srv.emitter.UpdateStatusAndEmitChanges(st.ConversationStatusStable)
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, push.Bodies("/browser"))
+
+	// wait for the notifier to subscribe to the bus
+	require.Eventually(t, func() bool {
+		srv.bus.Publish(events.TopicMessageSent, st.ConversationMessage{Role: st.ConversationRoleUser, Message: "hi"})
+		srv.emitter.UpdateStatusAndEmitChanges(st.ConversationStatusChanging)
+		srv.emitter.UpdateStatusAndEmitChanges(st.ConversationStatusStable)
+		return len(push.Bodies("/browser")) > 0
+	}, 5*time.Second, 50*time.Millisecond)
+	var notification PushNotification
+	require.NoError(t, json.Unmarshal(browser.decrypt(t, push.Bodies("/browser")[0]), &notification))
+	assert.Equal(t, "Agent finished its task", notification.Title)
+	assert.Contains(t, notification.Body, "The claude agent finished responding after")
+}
@@ -0,0 +1,303 @@
+package httpapi
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/pion/webrtc/v4"
+	"golang.org/x/xerrors"
+)
+
+// ptyDataChannelLabel is the label of the data channel that carries the
+// agent's terminal output and input.
+const ptyDataChannelLabel = "pty"
+
+// maxPTYFrameSize is the largest frame sent over the data channel. Terminal
+// output arrives rune by rune, so it's batched into frames of up to this size.
+// 16 KiB is the largest message size that works across all browsers.
+const maxPTYFrameSize = 16 * 1024
+
+var ptyBroadcasterOverflows = newCounterVec(
+	"pty_broadcaster_overflows_total",
+	"Number of subscribers to the agent's raw terminal output that were disconnected because they couldn't keep up.",
+)
+
+// PTYBroadcaster fans out the raw output of the agent's terminal to
+// subscribers. It's meant to be used as termexec.StartProcessConfig.Output.
+type PTYBroadcaster struct {
+	mu      sync.Mutex
+	subs    map[int]chan []byte
+	nextId  int
+	bufSize int
+}
+
+// NewPTYBroadcaster creates a broadcaster whose subscriptions buffer up to
+// bufSize writes. A subscriber whose buffer is full is unsubscribed, which
+// closes its channel: dropping the write could cut an escape sequence and
+// corrupt the terminal, so the subscriber must start over from the screen.
+func NewPTYBroadcaster(bufSize int) *PTYBroadcaster {
+	return &PTYBroadcaster{
+		subs:    make(map[int]chan []byte),
+		bufSize: bufSize,
+	}
+}
+
+// Write implements io.Writer. It never blocks.
+func (b *PTYBroadcaster) Write(data []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for id, ch := range b.subs {
+		select {
+		case ch <- append([]byte(nil), data...):
+		default:
+			ptyBroadcasterOverflows.Inc()
+			close(ch)
+			delete(b.subs, id)
+		}
+	}
+	return len(data), nil
+}
+
+func (b *PTYBroadcaster) Subscribe() (int, <-chan []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ch := make(chan []byte, b.bufSize)
+	id := b.nextId
+	b.nextId++
+	b.subs[id] = ch
+	return id, ch
+}
+
+func (b *PTYBroadcaster) Unsubscribe(id int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ch, ok := b.subs[id]; ok {
+		close(ch)
+		delete(b.subs, id)
+	}
+}
+
+type WebRTCConfig struct {
+	// Output is the raw output of the agent's terminal.
+	Output *PTYBroadcaster
+	// Input receives the frames sent by the client.
+	Input io.Writer
+	// ICEServers are advertised to clients and used by the server's peer
+	// connections.
+	ICEServers []webrtc.ICEServer
+	// SettingEngine customizes the peer connections, e.g. to allow loopback
+	// candidates in tests.
+	SettingEngine webrtc.SettingEngine
+}
+
+type ICEServer struct {
+	URLs       []string `json:"urls" doc:"STUN or TURN server URLs"`
+	Username   string   `json:"username,omitempty" doc:"Username for TURN servers"`
+	Credential string   `json:"credential,omitempty" doc:"Credential for TURN servers"`
+}
+
+type ICEServersResponse struct {
+	Body struct {
+		ICEServers []ICEServer `json:"ice_servers" nullable:"false" doc:"ICE servers to use when creating the peer connection"`
+	}
+}
+
+type SessionDescription struct {
+	Type string `json:"type" enum:"offer,answer" doc:"Type of the session description"`
+	SDP  string `json:"sdp" doc:"Session description in the SDP format"`
+}
+
+type WebRTCOfferRequest struct {
+	Body SessionDescription
+}
+
+type WebRTCOfferResponse struct {
+	Body SessionDescription
+}
+
+// webRTCServer streams the agent's terminal over WebRTC data channels. Unlike
+// SSE, data channels don't suffer from TCP head-of-line blocking, which adds
+// latency on lossy networks like cellular.
+type webRTCServer struct {
+	cfg    WebRTCConfig
+	api    *webrtc.API
+	logger *slog.Logger
+
+	mu    sync.Mutex
+	peers map[*webrtc.PeerConnection]struct{}
+}
+
+func newWebRTCServer(cfg WebRTCConfig, logger *slog.Logger) *webRTCServer {
+	return &webRTCServer{
+		cfg:    cfg,
+		api:    webrtc.NewAPI(webrtc.WithSettingEngine(cfg.SettingEngine)),
+		logger: logger,
+		peers:  make(map[*webrtc.PeerConnection]struct{}),
+	}
+}
+
+// answer creates a peer connection for the offer and returns the answer once
+// ICE gathering is complete, so the client doesn't need trickle ICE.
+func (w *webRTCServer) answer(ctx context.Context, offer webrtc.SessionDescription) (*webrtc.SessionDescription, error) {
+	pc, err := w.api.NewPeerConnection(webrtc.Configuration{ICEServers: w.cfg.ICEServers})
+	if err != nil {
+		return nil, xerrors.Errorf("failed to create peer connection: %w", err)
+	}
+	w.mu.Lock()
+	w.peers[pc] = struct{}{}
+	w.mu.Unlock()
+
+	pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		w.logger.Info("WebRTC connection state changed", "state", state.String())
+		if state == webrtc.PeerConnectionStateFailed || state == webrtc.PeerConnectionStateClosed {
+			w.closePeer(pc)
+		}
+	})
+	pc.OnDataChannel(func(dc *webrtc.DataChannel) {
+		if dc.Label() != ptyDataChannelLabel {
+			w.logger.Warn("Ignoring unknown data channel", "label", dc.Label())
+			return
+		}
+		w.handlePTYChannel(dc)
+	})
+
+	if err := pc.SetRemoteDescription(offer); err != nil {
+		w.closePeer(pc)
+		return nil, xerrors.Errorf("failed to set remote description: %w", err)
+	}
+	answer, err := pc.CreateAnswer(nil)
+	if err != nil {
+		w.closePeer(pc)
+		return nil, xerrors.Errorf("failed to create answer: %w", err)
+	}
+	gatheringComplete := webrtc.GatheringCompletePromise(pc)
+	if err := pc.SetLocalDescription(answer); err != nil {
+		w.closePeer(pc)
+		return nil, xerrors.Errorf("failed to set local description: %w", err)
+	}
+	select {
+	case <-gatheringComplete:
+	case <-ctx.Done():
+		w.closePeer(pc)
+		return nil, xerrors.Errorf("failed to gather ICE candidates: %w", ctx.Err())
+	}
+	return pc.LocalDescription(), nil
+}
+
+func (w *webRTCServer) handlePTYChannel(dc *webrtc.DataChannel) {
+	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+		if _, err := w.cfg.Input.Write(msg.Data); err != nil {
+			w.logger.Error("Failed to write data channel input", "error", err)
+		}
+	})
+	dc.OnOpen(func() {
+		subscriberId, ch := w.cfg.Output.Subscribe()
+		dc.OnClose(func() {
+			w.cfg.Output.Unsubscribe(subscriberId)
+		})
+		go func() {
+			// the channel is closed once the subscriber fell behind, and the
+			// client must reconnect to get a consistent terminal again
+			defer func() {
+				if err := dc.Close(); err != nil {
+					w.logger.Error("Failed to close data channel", "error", err)
+				}
+			}()
+			for data := range ch {
+				// batch whatever else is already buffered into one frame
+			batch:
+				for len(data) < maxPTYFrameSize {
+					select {
+					case more, ok := <-ch:
+						if !ok {
+							break batch
+						}
+						data = append(data, more...)
+					default:
+						break batch
+					}
+				}
+				if err := dc.Send(data); err != nil {
+					w.logger.Error("Failed to send data channel output", "error", err)
+					w.cfg.Output.Unsubscribe(subscriberId)
+					return
+				}
+			}
+		}()
+	})
+}
+
+func (w *webRTCServer) closePeer(pc *webrtc.PeerConnection) {
+	w.mu.Lock()
+	delete(w.peers, pc)
+	w.mu.Unlock()
+	if err := pc.Close(); err != nil {
+		w.logger.Error("Failed to close peer connection", "error", err)
+	}
+}
+
+// Close closes all peer connections.
+func (w *webRTCServer) Close() {
+	w.mu.Lock()
+	peers := make([]*webrtc.PeerConnection, 0, len(w.peers))
+	for pc := range w.peers {
+		peers = append(peers, pc)
+	}
+	w.mu.Unlock()
+	for _, pc := range peers {
+		w.closePeer(pc)
+	}
+}
+
+// EnableWebRTC allows clients to stream the agent's terminal over a WebRTC
+// data channel with POST /webrtc/offer.
+func (s *Server) EnableWebRTC(cfg WebRTCConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.webrtc = newWebRTCServer(cfg, s.logger)
+}
+
+// getWebRTCICE handles GET /webrtc/ice
+func (s *Server) getWebRTCICE(ctx context.Context, input *struct{}) (*ICEServersResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	resp := &ICEServersResponse{}
+	resp.Body.ICEServers = []ICEServer{}
+	if s.webrtc == nil {
+		return resp, nil
+	}
+	for _, server := range s.webrtc.cfg.ICEServers {
+		credential, _ := server.Credential.(string)
+		resp.Body.ICEServers = append(resp.Body.ICEServers, ICEServer{
+			URLs:       server.URLs,
+			Username:   server.Username,
+			Credential: credential,
+		})
+	}
+	return resp, nil
+}
+
+// createWebRTCOffer handles POST /webrtc/offer
+func (s *Server) createWebRTCOffer(ctx context.Context, input *WebRTCOfferRequest) (*WebRTCOfferResponse, error) {
+	s.mu.RLock()
+	w := s.webrtc
+	s.mu.RUnlock()
+	if w == nil {
+		return nil, huma.Error503ServiceUnavailable("WebRTC is not enabled")
+	}
+	if input.Body.Type != "offer" {
+		return nil, huma.Error400BadRequest("session description must be an offer")
+	}
+
+	answer, err := w.answer(ctx, webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: input.Body.SDP})
+	if err != nil {
+		return nil, huma.Error400BadRequest("failed to answer offer", err)
+	}
+	resp := &WebRTCOfferResponse{}
+	resp.Body = SessionDescription{Type: answer.Type.String(), SDP: answer.SDP}
+	return resp, nil
+}
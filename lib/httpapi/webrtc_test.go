@@ -0,0 +1,129 @@
+package httpapi
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	mf "github.com/zohaibahmed/clauder/lib/msgfmt"
+)
+
+// echoTerminal echoes its input back as terminal output.
+type echoTerminal struct {
+	output *PTYBroadcaster
+}
+
+func (e *echoTerminal) Write(data []byte) (int, error) {
+	return e.output.Write(append([]byte("echo: "), data...))
+}
+
+func loopbackSettingEngine() webrtc.SettingEngine {
+	se := webrtc.SettingEngine{}
+	se.SetIncludeLoopbackCandidate(true)
+	se.SetNetworkTypes([]webrtc.NetworkType{webrtc.NetworkTypeUDP4})
+	return se
+}
+
+func TestWebRTC(t *testing.T) {
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(os.Stdout, nil)))
+	srv := NewServer(ctx, mf.AgentTypeClaude, nil, 0, "/chat")
+
+	_, err := srv.createWebRTCOffer(ctx, &WebRTCOfferRequest{Body: SessionDescription{Type: "offer"}})
+	require.Error(t, err, "WebRTC is disabled by default")
+
+	output := NewPTYBroadcaster(64)
+	srv.EnableWebRTC(WebRTCConfig{
+		Output:        output,
+		Input:         &echoTerminal{output: output},
+		ICEServers:    []webrtc.ICEServer{{URLs: []string{"stun:stun.example.com:3478"}}},
+		SettingEngine: loopbackSettingEngine(),
+	})
+	defer srv.Stop(ctx)
+
+	ice, err := srv.getWebRTCICE(ctx, &struct{}{})
+	require.NoError(t, err)
+	assert.Equal(t, []ICEServer{{URLs: []string{"stun:stun.example.com:3478"}}}, ice.Body.ICEServers)
+
+	client, err := webrtc.NewAPI(webrtc.WithSettingEngine(loopbackSettingEngine())).NewPeerConnection(webrtc.Configuration{})
+	require.NoError(t, err)
+	defer client.Close()
+
+	dc, err := client.CreateDataChannel(ptyDataChannelLabel, nil)
+	require.NoError(t, err)
+	received := make(chan string, 16)
+	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+		assert.False(t, msg.IsString, "output must be sent as binary frames")
+		received <- string(msg.Data)
+	})
+	opened := make(chan struct{})
+	dc.OnOpen(func() { close(opened) })
+
+	offer, err := client.CreateOffer(nil)
+	require.NoError(t, err)
+	gatheringComplete := webrtc.GatheringCompletePromise(client)
+	require.NoError(t, client.SetLocalDescription(offer))
+	<-gatheringComplete
+
+	answer, err := srv.createWebRTCOffer(ctx, &WebRTCOfferRequest{Body: SessionDescription{
+		Type: "offer",
+		SDP:  client.LocalDescription().SDP,
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, "answer", answer.Body.Type)
+	require.NoError(t, client.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: answer.Body.SDP}))
+
+	select {
+	case <-opened:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the data channel to open")
+	}
+
+	// The server subscribes to the output once it sees the channel open,
+	// which may be slightly after the client does.
+	deadline := time.After(10 * time.Second)
+	for {
+		require.NoError(t, dc.SendText("hello"))
+		select {
+		case msg := <-received:
+			assert.Contains(t, msg, "echo: hello")
+			return
+		case <-time.After(100 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("timed out waiting for the echoed message")
+		}
+	}
+}
+
+func TestPTYBroadcasterOverflow(t *testing.T) {
+	b := NewPTYBroadcaster(2)
+	overflowsBefore := ptyBroadcasterOverflows.Value()
+	_, slow := b.Subscribe()
+	fastId, fast := b.Subscribe()
+
+	_, _ = b.Write([]byte("\x1b["))
+	_, _ = b.Write([]byte("1"))
+	<-fast
+	<-fast
+	// the slow subscriber can't take the rest of the escape sequence, so
+	// it's closed rather than left with a partial one
+	_, _ = b.Write([]byte("m"))
+	assert.Equal(t, overflowsBefore+1, ptyBroadcasterOverflows.Value())
+	var received []string
+	for data := range slow {
+		received = append(received, string(data))
+	}
+	assert.Equal(t, []string{"\x1b[", "1"}, received)
+	assert.Equal(t, "m", string(<-fast))
+
+	// unsubscribing a closed subscriber is a no-op
+	b.Unsubscribe(0)
+	b.Unsubscribe(fastId)
+	_, ok := <-fast
+	assert.False(t, ok)
+}
@@ -0,0 +1,443 @@
+package httpapi
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/go-chi/chi/v5"
+	mf "github.com/zohaibahmed/clauder/lib/msgfmt"
+	"github.com/zohaibahmed/clauder/lib/termexec"
+	"golang.org/x/xerrors"
+)
+
+// DefaultWorkspaceID is the ID of the workspace of the agent the server was
+// started with. Its endpoints are also served at their usual paths.
+const DefaultWorkspaceID = "default"
+
+// workspaceIDChars are the characters of generated workspace IDs.
+const workspaceIDChars = "abcdefghijklmnopqrstuvwxyz0123456789"
+
+// workspaceCloseTimeout is how long the agent of a deleted workspace has to
+// exit after it's interrupted.
+const workspaceCloseTimeout = 5 * time.Second
+
+// WorkspaceAgentConfig is the agent a workspace runs.
+type WorkspaceAgentConfig struct {
+	Type    mf.AgentType      `json:"type,omitempty" required:"false" example:"claude" doc:"Agent type, which sets how messages are formatted. Defaults to the program if it's a registered agent type, and to 'custom' otherwise."`
+	Program string            `json:"program" minLength:"1" example:"claude" doc:"Agent program, looked up in the agent's usual install directories and in the PATH"`
+	Args    []string          `json:"args,omitempty" required:"false" doc:"Arguments passed to the program"`
+	Dir     string            `json:"dir,omitempty" required:"false" example:"/home/team-a/project" doc:"Working directory of the agent. Defaults to the server's agent's."`
+	Env     map[string]string `json:"env,omitempty" required:"false" example:"{\"ANTHROPIC_MODEL\":\"claude-sonnet-4-5\"}" doc:"Environment variables set for the agent, on top of the ones set for the server's agent. PATH, LD_PRELOAD and LD_LIBRARY_PATH can't be set. Their values may be secrets like API keys, so they're only returned masked as '***'."`
+}
+
+// maskedEnvValue replaces the values of the environment variables of
+// workspace agents in responses.
+const maskedEnvValue = "***"
+
+// withMaskedEnv returns the config with the values of its environment
+// variables masked.
+func (c WorkspaceAgentConfig) withMaskedEnv() WorkspaceAgentConfig {
+	if c.Env == nil {
+		return c
+	}
+	env := make(map[string]string, len(c.Env))
+	for key := range c.Env {
+		env[key] = maskedEnvValue
+	}
+	c.Env = env
+	return c
+}
+
+// Workspace is an agent with its own conversation and event stream, so
+// that teams can share a server. Its endpoints are served under
+// /workspaces/{id}, e.g. POST /workspaces/{id}/v1/message, and require its
+// token.
+type Workspace struct {
+	ID          string               `json:"id" doc:"ID of the workspace"`
+	Name        string               `json:"name" doc:"Name of the workspace"`
+	Token       string               `json:"token,omitempty" doc:"Bearer token the workspace's endpoints require. Only returned when the workspace is created."`
+	AgentConfig WorkspaceAgentConfig `json:"agent_config" doc:"Agent the workspace runs"`
+	Parent      string               `json:"parent,omitempty" doc:"ID of the workspace it was branched from, if it's a branch"`
+}
+
+// withMaskedEnv returns the workspace with the values of its agent's
+// environment variables masked.
+func (w Workspace) withMaskedEnv() Workspace {
+	w.AgentConfig = w.AgentConfig.withMaskedEnv()
+	return w
+}
+
+// StartWorkspaceAgent starts the agent of a new workspace. The agent must
+// exit once ctx is done. The workspace's agent config is the effective
+// one: its working directory and environment variables include the
+// server's agent's.
+type StartWorkspaceAgent func(ctx context.Context, workspace Workspace) (*termexec.Process, error)
+
+type CreateWorkspaceRequest struct {
+	Authorization string `header:"Authorization" doc:"Bearer token with the admin token"`
+	Body          struct {
+		ID          string               `json:"id,omitempty" required:"false" pattern:"^[a-z0-9][a-z0-9-]*$" maxLength:"64" example:"team-a" doc:"ID of the workspace, which its endpoints are served under. Lowercase letters, digits and dashes. Generated if empty."`
+		Name        string               `json:"name" minLength:"1" maxLength:"128" example:"Team A" doc:"Name of the workspace"`
+		Token       string               `json:"token,omitempty" required:"false" minLength:"16" doc:"Bearer token the workspace's endpoints require. Generated if empty."`
+		AgentConfig WorkspaceAgentConfig `json:"agent_config" doc:"Agent the workspace runs"`
+	}
+}
+
+type WorkspaceResponse struct {
+	Body Workspace
+}
+
+type ListWorkspacesRequest struct {
+	Authorization string `header:"Authorization" doc:"Bearer token with the admin token"`
+}
+
+type WorkspaceConfigRequest struct {
+	Authorization string `header:"Authorization" doc:"Bearer token with the admin token"`
+	ID            string `path:"id" doc:"ID of the workspace"`
+}
+
+type WorkspaceConfigResponse struct {
+	Body WorkspaceAgentConfig
+}
+
+type WorkspacesResponse struct {
+	Body struct {
+		Workspaces []Workspace `json:"workspaces" nullable:"false" doc:"Workspaces sorted by ID, starting with the default workspace. Their tokens are left out."`
+	}
+}
+
+type DeleteWorkspaceRequest struct {
+	Authorization string `header:"Authorization" doc:"Bearer token with the admin token"`
+	ID            string `path:"id" doc:"ID of the workspace"`
+}
+
+// workspace is a workspace created with POST /admin/workspaces.
+type workspace struct {
+	Workspace
+	server *Server
+	// ctx is done once the workspace is deleted.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// workspaceStore holds the workspaces created with POST /admin/workspaces.
+type workspaceStore struct {
+	ctx context.Context
+	// startServer starts the agent of a workspace and returns its server,
+	// which serves the endpoints under basePath. Tests replace it to use
+	// fake agents.
+	startServer func(ctx context.Context, workspace Workspace, basePath string) (*Server, error)
+
+	mu         sync.RWMutex
+	workspaces map[string]*workspace
+	// parents maps the IDs of branches to the IDs of the workspaces they
+	// were branched from, including the branches whose agent is starting.
+	parents map[string]string
+}
+
+func (w *workspaceStore) get(id string) (*workspace, bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	ws, ok := w.workspaces[id]
+	return ws, ok
+}
+
+// EnableWorkspaces lets clients with the admin token create workspaces
+// with POST /admin/workspaces. start starts their agents. The workspaces
+// are deleted once ctx is done.
+func (s *Server) EnableWorkspaces(ctx context.Context, start StartWorkspaceAgent) {
+	store := &workspaceStore{
+		ctx: ctx,
+		startServer: func(ctx context.Context, workspace Workspace, basePath string) (*Server, error) {
+			workspace.AgentConfig = s.effectiveAgentConfig(workspace.AgentConfig)
+			var srv *Server
+			if s.lazyWorkspaceAgents {
+				agent := termexec.NewLazyProcessFunc(ctx, func(ctx context.Context) (*termexec.Process, error) {
+					return start(ctx, workspace)
+				})
+				srv = newServer(ctx, workspace.AgentConfig.Type, nil, agent, s.port, basePath+"/chat", workspace.Token)
+			} else {
+				process, err := start(ctx, workspace)
+				if err != nil {
+					return nil, err
+				}
+				srv = NewServerWithAuth(ctx, workspace.AgentConfig.Type, process, s.port, basePath+"/chat", workspace.Token)
+			}
+			if err := srv.SetBasePath(basePath); err != nil {
+				return nil, err
+			}
+			srv.SetSSEMaxEventsPerSecond(s.sseMaxEventsPerSecond)
+			srv.StartSnapshotLoop(ctx)
+			return srv, nil
+		},
+		workspaces: make(map[string]*workspace),
+		parents:    make(map[string]string),
+	}
+	s.workspaces.Store(store)
+	go func() {
+		<-ctx.Done()
+		store.mu.Lock()
+		workspaces := store.workspaces
+		store.workspaces = make(map[string]*workspace)
+		store.parents = make(map[string]string)
+		store.mu.Unlock()
+		for _, ws := range workspaces {
+			if ws != nil {
+				s.closeWorkspace(ws)
+			}
+		}
+	}()
+}
+
+// loadWorkspaces returns the workspace store after checking the admin
+// token.
+func (s *Server) loadWorkspaces(authorization string) (*workspaceStore, error) {
+	store := s.workspaces.Load()
+	if store == nil {
+		return nil, huma.Error503ServiceUnavailable("workspaces are not enabled")
+	}
+	if err := s.checkAdminToken(authorization, "workspaces require an admin token"); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// SetLazyWorkspaceAgents makes the agents of the workspaces created from
+// then on start on their first message rather than when the workspace is
+// created, so that workspaces that are never used don't take up resources.
+// Until then, their status is not_started. It must be called before the
+// server starts.
+func (s *Server) SetLazyWorkspaceAgents(lazy bool) {
+	s.lazyWorkspaceAgents = lazy
+}
+
+// SetDefaultWorkspaceAgent sets the agent the server was started with, so
+// that the default workspace can be branched. It must be called before the
+// server starts.
+func (s *Server) SetDefaultWorkspaceAgent(agent WorkspaceAgentConfig) {
+	s.defaultWorkspaceAgent = agent
+}
+
+// effectiveAgentConfig returns the config a workspace's agent is started
+// with: its working directory defaults to the server's agent's, and its
+// environment variables are added to the server's agent's.
+func (s *Server) effectiveAgentConfig(agent WorkspaceAgentConfig) WorkspaceAgentConfig {
+	if agent.Dir == "" {
+		agent.Dir = s.defaultWorkspaceAgent.Dir
+	}
+	if len(s.defaultWorkspaceAgent.Env) > 0 || len(agent.Env) > 0 {
+		env := maps.Clone(s.defaultWorkspaceAgent.Env)
+		if env == nil {
+			env = make(map[string]string, len(agent.Env))
+		}
+		maps.Copy(env, agent.Env)
+		agent.Env = env
+	}
+	return agent
+}
+
+// defaultWorkspace returns the workspace of the server's own agent.
+func (s *Server) defaultWorkspace() Workspace {
+	agent := s.defaultWorkspaceAgent
+	if agent.Program == "" {
+		agent = WorkspaceAgentConfig{Type: s.agentType}
+	}
+	return Workspace{ID: DefaultWorkspaceID, Name: DefaultWorkspaceID, AgentConfig: agent}
+}
+
+// generateWorkspaceCredentials generates the ID and token of a new
+// workspace if they're empty.
+func generateWorkspaceCredentials(created *Workspace) error {
+	var err error
+	if created.ID == "" {
+		if created.ID, err = randomString(workspaceIDChars, 8); err != nil {
+			return err
+		}
+	}
+	if created.Token == "" {
+		tokenBytes := make([]byte, 32)
+		if _, err := rand.Read(tokenBytes); err != nil {
+			return xerrors.Errorf("failed to generate token: %w", err)
+		}
+		created.Token = hex.EncodeToString(tokenBytes)
+	}
+	return nil
+}
+
+// createWorkspace handles POST /admin/workspaces
+func (s *Server) createWorkspace(ctx context.Context, input *CreateWorkspaceRequest) (*WorkspaceResponse, error) {
+	store, err := s.loadWorkspaces(input.Authorization)
+	if err != nil {
+		return nil, err
+	}
+	body := input.Body
+	created := Workspace{ID: body.ID, Name: body.Name, Token: body.Token, AgentConfig: body.AgentConfig}
+	if err := generateWorkspaceCredentials(&created); err != nil {
+		return nil, err
+	}
+	agent := &created.AgentConfig
+	if agent.Type == "" {
+		agent.Type = mf.AgentTypeCustom
+		if _, ok := mf.DefaultRegistry.Lookup(agent.Program); ok {
+			agent.Type = mf.AgentType(agent.Program)
+		}
+	} else if _, ok := mf.DefaultRegistry.Lookup(string(agent.Type)); !ok {
+		return nil, huma.Error422UnprocessableEntity(fmt.Sprintf("unknown agent type %s, expected one of %s", agent.Type, strings.Join(mf.DefaultRegistry.AgentTypes(), ", ")))
+	}
+	if err := termexec.ValidateEnv(agent.Env); err != nil {
+		return nil, huma.Error422UnprocessableEntity(err.Error(), &huma.ErrorDetail{
+			Location: "body.agent_config.env",
+			Message:  err.Error(),
+		})
+	}
+	if _, err := s.startWorkspace(store, created); err != nil {
+		return nil, err
+	}
+	return &WorkspaceResponse{Body: created.withMaskedEnv()}, nil
+}
+
+// getWorkspaceConfig handles GET /admin/workspaces/{id}/config
+func (s *Server) getWorkspaceConfig(ctx context.Context, input *WorkspaceConfigRequest) (*WorkspaceConfigResponse, error) {
+	store, err := s.loadWorkspaces(input.Authorization)
+	if err != nil {
+		return nil, err
+	}
+	workspace, _, err := s.lookupWorkspace(store, input.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &WorkspaceConfigResponse{Body: s.effectiveAgentConfig(workspace.AgentConfig).withMaskedEnv()}, nil
+}
+
+// startWorkspace starts the agent of a new workspace and adds it to the
+// store. A branch is only added if its parent has fewer than
+// maxWorkspaceBranches branches.
+func (s *Server) startWorkspace(store *workspaceStore, created Workspace) (*workspace, error) {
+	// the ID is reserved while the agent starts
+	store.mu.Lock()
+	if _, ok := store.workspaces[created.ID]; ok || created.ID == DefaultWorkspaceID {
+		store.mu.Unlock()
+		return nil, huma.Error409Conflict(fmt.Sprintf("workspace %s already exists", created.ID))
+	}
+	if created.Parent != "" {
+		if branches := store.branches(created.Parent); len(branches) >= maxWorkspaceBranches {
+			store.mu.Unlock()
+			return nil, huma.Error409Conflict(fmt.Sprintf("workspace %s already has %d branches", created.Parent, len(branches)))
+		}
+		store.parents[created.ID] = created.Parent
+	}
+	store.workspaces[created.ID] = nil
+	store.mu.Unlock()
+
+	wsCtx, cancel := context.WithCancel(store.ctx)
+	srv, err := store.startServer(wsCtx, created, s.basePath+"/workspaces/"+created.ID)
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if err != nil {
+		cancel()
+		delete(store.workspaces, created.ID)
+		delete(store.parents, created.ID)
+		return nil, xerrors.Errorf("failed to start the agent of workspace %s: %w", created.ID, err)
+	}
+	ws := &workspace{Workspace: created, server: srv, ctx: wsCtx, cancel: cancel}
+	store.workspaces[created.ID] = ws
+	if events := s.eventStore.Load(); events != nil {
+		srv.recordEvents(wsCtx, events, created.ID)
+	}
+	s.logger.Info("Created workspace", "id", created.ID, "name", created.Name, "program", created.AgentConfig.Program, "parent", created.Parent)
+	return ws, nil
+}
+
+// listWorkspaces handles GET /admin/workspaces
+func (s *Server) listWorkspaces(ctx context.Context, input *ListWorkspacesRequest) (*WorkspacesResponse, error) {
+	store, err := s.loadWorkspaces(input.Authorization)
+	if err != nil {
+		return nil, err
+	}
+	store.mu.RLock()
+	workspaces := make([]Workspace, 0, len(store.workspaces))
+	for _, ws := range store.workspaces {
+		if ws != nil {
+			listed := ws.Workspace.withMaskedEnv()
+			listed.Token = ""
+			workspaces = append(workspaces, listed)
+		}
+	}
+	store.mu.RUnlock()
+	slices.SortFunc(workspaces, func(a, b Workspace) int { return strings.Compare(a.ID, b.ID) })
+
+	resp := &WorkspacesResponse{}
+	resp.Body.Workspaces = append([]Workspace{s.defaultWorkspace().withMaskedEnv()}, workspaces...)
+	return resp, nil
+}
+
+// deleteWorkspace handles DELETE /admin/workspaces/{id}
+func (s *Server) deleteWorkspace(ctx context.Context, input *DeleteWorkspaceRequest) (*struct{}, error) {
+	store, err := s.loadWorkspaces(input.Authorization)
+	if err != nil {
+		return nil, err
+	}
+	if input.ID == DefaultWorkspaceID {
+		return nil, huma.Error400BadRequest("the default workspace can't be deleted")
+	}
+	store.mu.Lock()
+	ws := store.workspaces[input.ID]
+	if ws != nil {
+		delete(store.workspaces, input.ID)
+		delete(store.parents, input.ID)
+	}
+	store.mu.Unlock()
+	if ws == nil {
+		return nil, huma.Error404NotFound(fmt.Sprintf("workspace %s not found", input.ID))
+	}
+	s.closeWorkspace(ws)
+	s.logger.Info("Deleted workspace", "id", ws.ID)
+	return nil, nil
+}
+
+// closeWorkspace closes the event streams of a deleted workspace and stops
+// its agent.
+func (s *Server) closeWorkspace(ws *workspace) {
+	ctx, cancel := context.WithTimeout(context.Background(), workspaceCloseTimeout)
+	defer cancel()
+	if err := ws.server.Stop(ctx); err != nil {
+		s.logger.Error("Failed to stop workspace server", "id", ws.ID, "error", err)
+	}
+	if err := ws.server.closeAgent(workspaceCloseTimeout); err != nil {
+		s.logger.Error("Failed to close workspace agent", "id", ws.ID, "error", err)
+	}
+	ws.cancel()
+}
+
+// serveWorkspace serves the endpoints of a workspace under
+// /workspaces/{workspace_id}. The requests of the default workspace are
+// served by the server's own routes.
+func (s *Server) serveWorkspace(w http.ResponseWriter, r *http.Request) {
+	store := s.workspaces.Load()
+	if store == nil {
+		http.NotFound(w, r)
+		return
+	}
+	id := chi.URLParam(r, "workspace_id")
+	var handler http.Handler = s.router
+	if id != DefaultWorkspaceID {
+		ws, ok := store.get(id)
+		if !ok || ws == nil {
+			http.NotFound(w, r)
+			return
+		}
+		handler = ws.server.router
+	}
+	// the workspace's router routes the request from scratch
+	r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, nil))
+	http.StripPrefix("/workspaces/"+id, handler).ServeHTTP(w, r)
+}
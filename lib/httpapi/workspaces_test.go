@@ -0,0 +1,248 @@
+package httpapi
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	mf "github.com/zohaibahmed/clauder/lib/msgfmt"
+	st "github.com/zohaibahmed/clauder/lib/screentracker"
+	"github.com/zohaibahmed/clauder/lib/termexec"
+)
+
+// doWorkspaceRequest sends a request with the Bearer token and decodes the
+// response into out. The body of event streams is left open for the caller
+// to read and close.
+func doWorkspaceRequest(t *testing.T, method, url, token, body string, out any) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		return resp
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	if out != nil && resp.StatusCode < 300 {
+		require.NoError(t, json.Unmarshal(data, out), string(data))
+	}
+	return resp
+}
+
+// nextUserMessage reads SSE events until a message_update event of a user
+// message, and returns its content.
+func nextUserMessage(t *testing.T, reader *bufio.Reader) string {
+	t.Helper()
+	for {
+		name, data := nextEvent(t, reader)
+		if name != "message_update" {
+			continue
+		}
+		var update MessageUpdateBody
+		require.NoError(t, json.Unmarshal([]byte(data), &update))
+		if update.Role == st.ConversationRoleUser {
+			return update.Message
+		}
+	}
+}
+
+func TestWorkspaces(t *testing.T) {
+	ctx, cancel := context.WithCancel(logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil))))
+	defer cancel()
+	srv := NewServer(ctx, mf.AgentTypeClaude, nil, 0, "/chat")
+	httpSrv := httptest.NewServer(srv.handler())
+	defer httpSrv.Close()
+	admin := httpSrv.URL + "/v1/admin/workspaces"
+	createBody := func(id string) string {
+		return `{"id":"` + id + `","name":"Team ` + id + `","token":"token-` + id + `-0123456789","agent_config":{"program":"agent-` + id + `"}}`
+	}
+
+	assert.Equal(t, http.StatusServiceUnavailable, doWorkspaceRequest(t, http.MethodGet, admin, "", "", nil).StatusCode)
+	srv.EnableWorkspaces(ctx, nil)
+	assert.Equal(t, http.StatusServiceUnavailable, doWorkspaceRequest(t, http.MethodGet, admin, "", "", nil).StatusCode, "no admin token")
+	srv.EnableAdminShutdown("admin", nil)
+	started := map[string]Workspace{}
+	srv.workspaces.Load().startServer = func(ctx context.Context, workspace Workspace, basePath string) (*Server, error) {
+		started[workspace.ID] = workspace
+		wsSrv := NewServerWithAuth(ctx, workspace.AgentConfig.Type, nil, 0, basePath+"/chat", workspace.Token)
+		require.NoError(t, wsSrv.SetBasePath(basePath))
+		wsSrv.conversation = st.NewConversation(ctx, st.ConversationConfig{
+			AgentIO:               &echoAgent{},
+			GetTime:               time.Now,
+			SnapshotInterval:      time.Millisecond,
+			ScreenStabilityLength: 20 * time.Millisecond,
+		})
+		wsSrv.StartSnapshotLoop(ctx)
+		return wsSrv, nil
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, doWorkspaceRequest(t, http.MethodPost, admin, "wrong", createBody("a"), nil).StatusCode)
+	var created Workspace
+	require.Equal(t, http.StatusCreated, doWorkspaceRequest(t, http.MethodPost, admin, "admin", createBody("a"), &created).StatusCode)
+	assert.Equal(t, Workspace{ID: "a", Name: "Team a", Token: "token-a-0123456789", AgentConfig: WorkspaceAgentConfig{Type: mf.AgentTypeCustom, Program: "agent-a"}}, created)
+	assert.Equal(t, created, started["a"])
+	require.Equal(t, http.StatusCreated, doWorkspaceRequest(t, http.MethodPost, admin, "admin", createBody("b"), nil).StatusCode)
+	assert.Equal(t, http.StatusConflict, doWorkspaceRequest(t, http.MethodPost, admin, "admin", createBody("b"), nil).StatusCode)
+	assert.Equal(t, http.StatusConflict, doWorkspaceRequest(t, http.MethodPost, admin, "admin", createBody("default"), nil).StatusCode)
+
+	// the ID and token are generated if they're missing
+	require.Equal(t, http.StatusCreated, doWorkspaceRequest(t, http.MethodPost, admin, "admin", `{"name":"Generated","agent_config":{"program":"claude"}}`, &created).StatusCode)
+	assert.Regexp(t, "^[a-z0-9]{8}$", created.ID)
+	assert.Len(t, created.Token, 64)
+	assert.Equal(t, mf.AgentTypeClaude, created.AgentConfig.Type)
+	generated := created.ID
+
+	var list WorkspacesResponse
+	require.Equal(t, http.StatusOK, doWorkspaceRequest(t, http.MethodGet, admin, "admin", "", &list.Body).StatusCode)
+	ids := []string{}
+	for _, workspace := range list.Body.Workspaces {
+		ids = append(ids, workspace.ID)
+		assert.Empty(t, workspace.Token)
+	}
+	require.NotEmpty(t, ids)
+	assert.Equal(t, DefaultWorkspaceID, ids[0])
+	assert.ElementsMatch(t, []string{"a", "b", generated}, ids[1:])
+	assert.IsIncreasing(t, ids[1:])
+
+	// each workspace requires its own token
+	workspaceURL := func(id string) string { return httpSrv.URL + "/workspaces/" + id }
+	assert.Equal(t, http.StatusUnauthorized, doWorkspaceRequest(t, http.MethodGet, workspaceURL("a")+"/v1/status", "token-b-0123456789", "", nil).StatusCode)
+	assert.Equal(t, http.StatusNotFound, doWorkspaceRequest(t, http.MethodGet, workspaceURL("c")+"/v1/status", "token-a-0123456789", "", nil).StatusCode)
+	assert.Equal(t, http.StatusOK, doWorkspaceRequest(t, http.MethodGet, workspaceURL(DefaultWorkspaceID)+"/v1/status", "", "", nil).StatusCode)
+
+	// a message sent to workspace A isn't in workspace B's event stream
+	subscribe := func(id string) (*bufio.Reader, io.Closer) {
+		resp := doWorkspaceRequest(t, http.MethodGet, workspaceURL(id)+"/v1/events?topics=message_update", "token-"+id+"-0123456789", "", nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		return bufio.NewReader(resp.Body), resp.Body
+	}
+	eventsA, closeA := subscribe("a")
+	defer closeA.Close()
+	eventsB, closeB := subscribe("b")
+	defer closeB.Close()
+	waitStable := func(id string) {
+		ws, ok := srv.workspaces.Load().get(id)
+		require.True(t, ok)
+		require.Eventually(t, func() bool {
+			return ws.server.conversation.Status() == st.ConversationStatusStable
+		}, 5*time.Second, 10*time.Millisecond)
+	}
+	send := func(id, content string) {
+		waitStable(id)
+		resp := doWorkspaceRequest(t, http.MethodPost, workspaceURL(id)+"/v1/message", "token-"+id+"-0123456789", `{"type":"user","content":"`+content+`"}`, nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+	send("a", "hello workspace a")
+	assert.Equal(t, "hello workspace a", nextUserMessage(t, eventsA))
+	send("b", "hello workspace b")
+	assert.Equal(t, "hello workspace b", nextUserMessage(t, eventsB), "workspace a's message must not be sent to workspace b")
+	var messages MessagesResponse
+	require.Equal(t, http.StatusOK, doWorkspaceRequest(t, http.MethodGet, workspaceURL("b")+"/v1/messages", "token-b-0123456789", "", &messages.Body).StatusCode)
+	for _, message := range messages.Body.Messages {
+		assert.NotContains(t, message.Content, "workspace a")
+	}
+	for _, message := range srv.messages() {
+		assert.NotEqual(t, st.ConversationRoleUser, message.Role, "the default workspace has no user messages")
+	}
+
+	// deleting a workspace closes its event streams
+	assert.Equal(t, http.StatusBadRequest, doWorkspaceRequest(t, http.MethodDelete, admin+"/"+DefaultWorkspaceID, "admin", "", nil).StatusCode)
+	assert.Equal(t, http.StatusNoContent, doWorkspaceRequest(t, http.MethodDelete, admin+"/a", "admin", "", nil).StatusCode)
+	assert.Equal(t, http.StatusNotFound, doWorkspaceRequest(t, http.MethodDelete, admin+"/a", "admin", "", nil).StatusCode)
+	assert.Equal(t, http.StatusNotFound, doWorkspaceRequest(t, http.MethodGet, workspaceURL("a")+"/v1/status", "token-a-0123456789", "", nil).StatusCode)
+	for name := ""; name != "server_shutdown"; {
+		name, _ = nextEvent(t, eventsA)
+	}
+	_, err := eventsA.ReadString('\n')
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestWorkspaceAgentEnv(t *testing.T) {
+	if _, err := exec.LookPath("cat"); err != nil {
+		t.Skip("cat not found")
+	}
+	ctx, cancel := context.WithCancel(logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil))))
+	defer cancel()
+	srv := NewServer(ctx, mf.AgentTypeClaude, nil, 0, "/chat")
+	srv.EnableAdminShutdown("admin", nil)
+	srv.SetDefaultWorkspaceAgent(WorkspaceAgentConfig{Type: mf.AgentTypeClaude, Program: "claude", Dir: "/srv", Env: map[string]string{"SHARED": "shared-secret", "TEAM": "default"}})
+	var mu sync.Mutex
+	started := map[string]WorkspaceAgentConfig{}
+	srv.EnableWorkspaces(ctx, func(ctx context.Context, workspace Workspace) (*termexec.Process, error) {
+		mu.Lock()
+		started[workspace.ID] = workspace.AgentConfig
+		mu.Unlock()
+		return termexec.StartProcess(ctx, termexec.StartProcessConfig{
+			Program:        "cat",
+			TerminalWidth:  80,
+			TerminalHeight: 24,
+		})
+	})
+	httpSrv := httptest.NewServer(srv.handler())
+	defer httpSrv.Close()
+	admin := httpSrv.URL + "/v1/admin/workspaces"
+
+	var created Workspace
+	require.Equal(t, http.StatusCreated, doWorkspaceRequest(t, http.MethodPost, admin, "admin", `{"id":"a","name":"A","agent_config":{"type":"custom","program":"cat","env":{"TEAM":"a","API_KEY":"secret-a"}}}`, &created).StatusCode)
+	assert.Equal(t, map[string]string{"TEAM": "***", "API_KEY": "***"}, created.AgentConfig.Env)
+	require.Equal(t, http.StatusCreated, doWorkspaceRequest(t, http.MethodPost, admin, "admin", `{"id":"b","name":"B","agent_config":{"type":"custom","program":"cat","dir":"/srv/b","env":{"TEAM":"b"}}}`, nil).StatusCode)
+
+	// each agent gets its own variables on top of the server's agent's
+	mu.Lock()
+	assert.Equal(t, WorkspaceAgentConfig{Type: mf.AgentTypeCustom, Program: "cat", Dir: "/srv", Env: map[string]string{"SHARED": "shared-secret", "TEAM": "a", "API_KEY": "secret-a"}}, started["a"])
+	assert.Equal(t, WorkspaceAgentConfig{Type: mf.AgentTypeCustom, Program: "cat", Dir: "/srv/b", Env: map[string]string{"SHARED": "shared-secret", "TEAM": "b"}}, started["b"])
+	mu.Unlock()
+
+	// variables that change how the agent program is found or loaded are rejected
+	for _, key := range []string{"PATH", "LD_PRELOAD", "LD_LIBRARY_PATH"} {
+		resp := doWorkspaceRequest(t, http.MethodPost, admin, "admin", `{"id":"c","name":"C","agent_config":{"type":"custom","program":"cat","env":{"`+key+`":"/tmp"}}}`, nil)
+		assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode, key)
+	}
+	mu.Lock()
+	assert.NotContains(t, started, "c")
+	mu.Unlock()
+
+	// the config endpoint returns the effective config with the values masked
+	var config WorkspaceAgentConfig
+	require.Equal(t, http.StatusOK, doWorkspaceRequest(t, http.MethodGet, admin+"/a/config", "admin", "", &config).StatusCode)
+	assert.Equal(t, WorkspaceAgentConfig{Type: mf.AgentTypeCustom, Program: "cat", Dir: "/srv", Env: map[string]string{"SHARED": "***", "TEAM": "***", "API_KEY": "***"}}, config)
+	config = WorkspaceAgentConfig{}
+	require.Equal(t, http.StatusOK, doWorkspaceRequest(t, http.MethodGet, admin+"/"+DefaultWorkspaceID+"/config", "admin", "", &config).StatusCode)
+	assert.Equal(t, map[string]string{"SHARED": "***", "TEAM": "***"}, config.Env)
+	assert.Equal(t, http.StatusUnauthorized, doWorkspaceRequest(t, http.MethodGet, admin+"/a/config", "wrong", "", nil).StatusCode)
+	assert.Equal(t, http.StatusNotFound, doWorkspaceRequest(t, http.MethodGet, admin+"/missing/config", "admin", "", nil).StatusCode)
+
+	// so does the list of workspaces
+	var list WorkspacesResponse
+	require.Equal(t, http.StatusOK, doWorkspaceRequest(t, http.MethodGet, admin, "admin", "", &list.Body).StatusCode)
+	require.Len(t, list.Body.Workspaces, 3)
+	for _, workspace := range list.Body.Workspaces {
+		require.NotEmpty(t, workspace.AgentConfig.Env, workspace.ID)
+		for key, value := range workspace.AgentConfig.Env {
+			assert.Equal(t, "***", value, key)
+		}
+	}
+
+	// the stored config keeps the values
+	ws, ok := srv.workspaces.Load().get("a")
+	require.True(t, ok)
+	assert.Equal(t, "secret-a", ws.AgentConfig.Env["API_KEY"])
+}
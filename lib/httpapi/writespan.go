@@ -0,0 +1,64 @@
+package httpapi
+
+import (
+	"context"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/zohaibahmed/clauder/lib/termexec"
+)
+
+// writeSpanBuckets are the upper bounds of the buckets of the write span
+// histograms, in seconds.
+var writeSpanBuckets = []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60}
+
+var (
+	ptyWriteFirstOutput = newHistogram(
+		"pty_write_first_output_seconds",
+		"Time from writing to the agent's terminal until the agent prints something.",
+		writeSpanBuckets,
+	)
+	ptyWriteIdle = newHistogram(
+		"pty_write_idle_seconds",
+		"Time from writing to the agent's terminal until the agent is idle again, i.e. stopped printing for 300ms.",
+		writeSpanBuckets,
+	)
+)
+
+// recordWriteSpan records the latencies of a complete write span.
+func recordWriteSpan(span termexec.WriteSpan) {
+	ptyWriteFirstOutput.Observe(span.FirstOutputAt.Sub(span.WrittenAt).Seconds())
+	ptyWriteIdle.Observe(span.IdleAt.Sub(span.WrittenAt).Seconds())
+}
+
+// WriteSpanResponse is the span of the last write to the agent's terminal.
+type WriteSpanResponse struct {
+	Body struct {
+		WrittenAt     time.Time  `json:"written_at" doc:"When the write started"`
+		FirstOutputAt *time.Time `json:"first_output_at" doc:"When the agent printed something after the write, usually the echo of the input. Null if it hasn't yet."`
+		IdleAt        *time.Time `json:"idle_at" doc:"When the agent was idle again, i.e. stopped printing for 300ms. Null if it isn't yet."`
+		BytesWritten  int        `json:"bytes_written" doc:"Number of bytes written"`
+	}
+}
+
+// getLastSpan handles GET /agent/last_span
+func (s *Server) getLastSpan(ctx context.Context, input *struct{}) (*WriteSpanResponse, error) {
+	process := s.process()
+	if process == nil {
+		return nil, huma.Error404NotFound("nothing was written to the agent yet")
+	}
+	span, ok := process.LastWriteSpan()
+	if !ok {
+		return nil, huma.Error404NotFound("nothing was written to the agent yet")
+	}
+	resp := &WriteSpanResponse{}
+	resp.Body.WrittenAt = span.WrittenAt
+	if !span.FirstOutputAt.IsZero() {
+		resp.Body.FirstOutputAt = &span.FirstOutputAt
+	}
+	if !span.IdleAt.IsZero() {
+		resp.Body.IdleAt = &span.IdleAt
+	}
+	resp.Body.BytesWritten = span.BytesWritten
+	return resp, nil
+}
@@ -0,0 +1,55 @@
+package httpapi
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	mf "github.com/zohaibahmed/clauder/lib/msgfmt"
+	"github.com/zohaibahmed/clauder/lib/termexec"
+)
+
+func TestGetLastSpan(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+	ctx, cancel := context.WithCancel(logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil))))
+	defer cancel()
+	process, err := termexec.StartProcess(ctx, termexec.StartProcessConfig{
+		Program:        "sh",
+		Args:           []string{"-c", `read line; echo "got it"; sleep 5`},
+		TerminalWidth:  80,
+		TerminalHeight: 24,
+	})
+	require.NoError(t, err)
+	defer process.Close(slog.New(slog.NewTextHandler(io.Discard, nil)), time.Second)
+	srv := NewServer(ctx, mf.AgentTypeCustom, process, 0, "/chat")
+	httpSrv := httptest.NewServer(srv.router)
+	defer httpSrv.Close()
+
+	assert.Equal(t, http.StatusNotFound, doJSON(t, http.MethodGet, httpSrv.URL+"/v1/agent/last_span", "", nil))
+
+	idleCount := ptyWriteIdle.Count()
+	_, err = process.Write([]byte("hello\r"))
+	require.NoError(t, err)
+	var span WriteSpanResponse
+	require.Eventually(t, func() bool {
+		code := doJSON(t, http.MethodGet, httpSrv.URL+"/v1/agent/last_span", "", &span.Body)
+		return code == http.StatusOK && span.Body.IdleAt != nil
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.Equal(t, 6, span.Body.BytesWritten)
+	require.NotNil(t, span.Body.FirstOutputAt)
+	assert.True(t, span.Body.FirstOutputAt.After(span.Body.WrittenAt))
+	assert.True(t, span.Body.IdleAt.After(*span.Body.FirstOutputAt))
+	assert.Eventually(t, func() bool {
+		return ptyWriteIdle.Count() == idleCount+1
+	}, time.Second, 10*time.Millisecond, "the span is recorded in the metrics")
+}
@@ -0,0 +1,190 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// Session is a clauder server that the tools control.
+type Session struct {
+	// URL is the server's base URL, without a trailing slash.
+	URL string
+	// Token authenticates the requests, if the server requires it.
+	Token string
+}
+
+// SessionResolver returns the session with the ID the model passed to a
+// tool. The ID is empty if the model didn't pass one.
+type SessionResolver func(ctx context.Context, sessionID string) (Session, error)
+
+const sessionIDDescription = "Session to use: the URL of a clauder server, or the passcode of a session registered with the coordinator. Defaults to the session clauder mcp was started with"
+
+// AddClauderTools adds the tools that control clauder sessions to s:
+// clauder_send_message, clauder_get_snapshot and clauder_list_files.
+func AddClauderTools(s *Server, resolve SessionResolver, client *http.Client) {
+	t := &clauderTools{resolve: resolve, client: client}
+	s.AddTool(Tool{
+		Name:        "clauder_send_message",
+		Description: "Send a message to the agent of a clauder session, e.g. to ask another agent to review a change. The agent must be idle; check with clauder_get_snapshot. It returns once the agent started working on the message",
+		InputSchema: json.RawMessage(`{"type":"object","properties":{"session_id":{"type":"string","description":"` + sessionIDDescription + `"},"text":{"type":"string","description":"Message to send"}},"required":["text"]}`),
+	}, t.sendMessage)
+	s.AddTool(Tool{
+		Name:        "clauder_get_snapshot",
+		Description: "Get the contents of the terminal screen of a clauder session's agent, and whether the agent is running or idle",
+		InputSchema: json.RawMessage(`{"type":"object","properties":{"session_id":{"type":"string","description":"` + sessionIDDescription + `"}}}`),
+	}, t.getSnapshot)
+	s.AddTool(Tool{
+		Name:        "clauder_list_files",
+		Description: "List the files in the working directory of a clauder session's agent, one path per line",
+		InputSchema: json.RawMessage(`{"type":"object","properties":{"session_id":{"type":"string","description":"` + sessionIDDescription + `"}}}`),
+	}, t.listFiles)
+}
+
+type clauderTools struct {
+	resolve SessionResolver
+	client  *http.Client
+}
+
+// toolArguments are the arguments of the clauder tools.
+type toolArguments struct {
+	SessionID string `json:"session_id"`
+	// Text is only used by clauder_send_message.
+	Text string `json:"text"`
+}
+
+// do sends a request to the session's server, and decodes the JSON
+// response into out.
+func (t *clauderTools) do(ctx context.Context, session Session, method, path string, body any, out any) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, session.URL+path, reqBody)
+	if err != nil {
+		return xerrors.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if session.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+session.Token)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return xerrors.Errorf("failed to reach the clauder server at %s: %w", session.URL, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return xerrors.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		// huma errors explain what went wrong in their detail
+		var apiErr struct {
+			Detail string `json:"detail"`
+		}
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Detail != "" {
+			return xerrors.Errorf("%s %s failed: %s: %s", method, path, resp.Status, apiErr.Detail)
+		}
+		return xerrors.Errorf("%s %s failed: %s", method, path, resp.Status)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return xerrors.Errorf("invalid response to %s %s: %w", method, path, err)
+	}
+	return nil
+}
+
+// session decodes the arguments into args, and resolves the session they
+// name.
+func (t *clauderTools) session(ctx context.Context, arguments json.RawMessage, args *toolArguments) (Session, error) {
+	if err := json.Unmarshal(arguments, args); err != nil {
+		return Session{}, xerrors.Errorf("invalid arguments: %w", err)
+	}
+	return t.resolve(ctx, strings.TrimSpace(args.SessionID))
+}
+
+func (t *clauderTools) sendMessage(ctx context.Context, arguments json.RawMessage) *ToolResult {
+	var args toolArguments
+	session, err := t.session(ctx, arguments, &args)
+	if err != nil {
+		return ErrorResult(err)
+	}
+	if strings.TrimSpace(args.Text) == "" {
+		return ErrorResult(xerrors.New("text is required"))
+	}
+	var resp struct {
+		Ok             bool   `json:"ok"`
+		CachedResponse string `json:"cached_response"`
+		Queued         bool   `json:"queued"`
+		Position       int    `json:"position"`
+	}
+	body := map[string]string{"content": args.Text, "type": "user"}
+	if err := t.do(ctx, session, http.MethodPost, "/v1/message", body, &resp); err != nil {
+		return ErrorResult(err)
+	}
+	switch {
+	case resp.CachedResponse != "":
+		return TextResult("The agent already answered the same message:\n\n" + resp.CachedResponse)
+	case resp.Queued:
+		return TextResult(fmt.Sprintf("The message was queued at position %d.", resp.Position))
+	case !resp.Ok:
+		return ErrorResult(xerrors.New("the agent didn't accept the message"))
+	}
+	return TextResult("The message was sent, and the agent started working on it.")
+}
+
+func (t *clauderTools) getSnapshot(ctx context.Context, arguments json.RawMessage) *ToolResult {
+	session, err := t.session(ctx, arguments, &toolArguments{})
+	if err != nil {
+		return ErrorResult(err)
+	}
+	var status struct {
+		Status string `json:"status"`
+	}
+	if err := t.do(ctx, session, http.MethodGet, "/v1/status", nil, &status); err != nil {
+		return ErrorResult(err)
+	}
+	var snapshot struct {
+		Screen string `json:"screen"`
+	}
+	if err := t.do(ctx, session, http.MethodGet, "/snapshot", nil, &snapshot); err != nil {
+		return ErrorResult(err)
+	}
+	// the screen is padded with spaces and empty lines
+	lines := strings.Split(snapshot.Screen, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " ")
+	}
+	screen := strings.TrimRight(strings.Join(lines, "\n"), "\n")
+	return TextResult(fmt.Sprintf("Agent status: %s\n\n%s", status.Status, screen))
+}
+
+func (t *clauderTools) listFiles(ctx context.Context, arguments json.RawMessage) *ToolResult {
+	session, err := t.session(ctx, arguments, &toolArguments{})
+	if err != nil {
+		return ErrorResult(err)
+	}
+	var resp struct {
+		Files     []string `json:"files"`
+		Truncated bool     `json:"truncated"`
+	}
+	if err := t.do(ctx, session, http.MethodGet, "/v1/files", nil, &resp); err != nil {
+		return ErrorResult(err)
+	}
+	text := strings.Join(resp.Files, "\n")
+	if resp.Truncated {
+		text += "\n(more files not listed)"
+	}
+	return TextResult(text)
+}
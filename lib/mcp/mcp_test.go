@@ -0,0 +1,227 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	"golang.org/x/xerrors"
+)
+
+// testClient is an MCP client connected to a server through pipes.
+type testClient struct {
+	t      *testing.T
+	in     *io.PipeWriter
+	out    *bufio.Scanner
+	nextID int
+}
+
+func newTestClient(t *testing.T, s *Server) *testClient {
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	inReader, inWriter := io.Pipe()
+	outReader, outWriter := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Serve(ctx, inReader, outWriter)
+		_ = outWriter.Close()
+	}()
+	t.Cleanup(func() {
+		_ = inWriter.Close()
+		assert.NoError(t, <-done)
+	})
+	return &testClient{t: t, in: inWriter, out: bufio.NewScanner(outReader)}
+}
+
+// send writes a raw message, and returns the raw response.
+func (c *testClient) send(message string) map[string]any {
+	c.t.Helper()
+	_, err := io.WriteString(c.in, message+"\n")
+	require.NoError(c.t, err)
+	require.True(c.t, c.out.Scan(), "no response to %s", message)
+	var resp map[string]any
+	require.NoError(c.t, json.Unmarshal(c.out.Bytes(), &resp))
+	return resp
+}
+
+// call sends a request, and returns its result after checking that it
+// succeeded.
+func (c *testClient) call(method string, params any) map[string]any {
+	c.t.Helper()
+	c.nextID++
+	data, err := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": c.nextID, "method": method, "params": params})
+	require.NoError(c.t, err)
+	resp := c.send(string(data))
+	assert.Equal(c.t, "2.0", resp["jsonrpc"])
+	assert.EqualValues(c.t, c.nextID, resp["id"])
+	require.Nil(c.t, resp["error"])
+	result, ok := resp["result"].(map[string]any)
+	require.True(c.t, ok, "invalid result %v", resp["result"])
+	return result
+}
+
+// callTool calls a tool, checks that the result has the format of a tool
+// result, and returns its text and whether it's an error.
+func (c *testClient) callTool(name string, arguments map[string]any) (string, bool) {
+	c.t.Helper()
+	result := c.call("tools/call", map[string]any{"name": name, "arguments": arguments})
+	for key := range result {
+		assert.Contains(c.t, []string{"content", "isError"}, key)
+	}
+	content, ok := result["content"].([]any)
+	require.True(c.t, ok, "invalid content %v", result["content"])
+	require.Len(c.t, content, 1)
+	item := content[0].(map[string]any)
+	assert.Equal(c.t, "text", item["type"])
+	text, ok := item["text"].(string)
+	require.True(c.t, ok)
+	isError, _ := result["isError"].(bool)
+	return text, isError
+}
+
+// fakeClauder is a clauder server that records the messages it receives.
+type fakeClauder struct {
+	mu       sync.Mutex
+	messages []string
+	token    string
+}
+
+func (f *fakeClauder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+f.token {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	switch r.Method + " " + r.URL.Path {
+	case "POST /v1/message":
+		var body struct {
+			Content string `json:"content"`
+			Type    string `json:"type"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if body.Type != "user" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if strings.Contains(body.Content, "busy") {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			_, _ = io.WriteString(w, `{"title":"Unprocessable Entity","detail":"Agent is not stable"}`)
+			return
+		}
+		f.mu.Lock()
+		f.messages = append(f.messages, body.Content)
+		f.mu.Unlock()
+		_, _ = io.WriteString(w, `{"ok":true}`)
+	case "GET /v1/status":
+		_, _ = io.WriteString(w, `{"status":"stable"}`)
+	case "GET /snapshot":
+		_, _ = io.WriteString(w, `{"screen":"> hello   \n  world\n    \n","seq":3}`)
+	case "GET /v1/files":
+		_, _ = io.WriteString(w, `{"files":["go.mod","main.go"],"truncated":false}`)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestServerProtocol(t *testing.T) {
+	s := NewServer("clauder", "1.2.3")
+	s.AddTool(Tool{Name: "echo", Description: "Echo", InputSchema: json.RawMessage(`{"type":"object"}`)}, func(ctx context.Context, arguments json.RawMessage) *ToolResult {
+		return TextResult(string(arguments))
+	})
+	c := newTestClient(t, s)
+
+	result := c.call("initialize", map[string]any{"protocolVersion": ProtocolVersion, "capabilities": map[string]any{}, "clientInfo": map[string]any{"name": "test", "version": "1"}})
+	assert.Equal(t, ProtocolVersion, result["protocolVersion"])
+	assert.Equal(t, map[string]any{"name": "clauder", "version": "1.2.3"}, result["serverInfo"])
+	assert.Contains(t, result["capabilities"], "tools")
+
+	// notifications aren't answered, so the next response is the ping's
+	_, err := io.WriteString(c.in, `{"jsonrpc":"2.0","method":"notifications/initialized"}`+"\n")
+	require.NoError(t, err)
+	assert.Empty(t, c.call("ping", nil))
+
+	tools := c.call("tools/list", nil)["tools"].([]any)
+	require.Len(t, tools, 1)
+	assert.Equal(t, map[string]any{"name": "echo", "description": "Echo", "inputSchema": map[string]any{"type": "object"}}, tools[0])
+
+	text, isError := c.callTool("echo", map[string]any{"a": 1})
+	assert.JSONEq(t, `{"a":1}`, text)
+	assert.False(t, isError)
+
+	for message, code := range map[string]float64{
+		`{"jsonrpc":`:              CodeParseError,
+		`{"id":1,"method":"ping"}`: CodeInvalidRequest,
+		`{"jsonrpc":"2.0","id":1,"method":"resources/list"}`:                         CodeMethodNotFound,
+		`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"missing"}}`: CodeInvalidParams,
+	} {
+		resp := c.send(message)
+		require.NotNil(t, resp["error"], message)
+		assert.Equal(t, code, resp["error"].(map[string]any)["code"], message)
+	}
+}
+
+func TestClauderTools(t *testing.T) {
+	clauder := &fakeClauder{token: "secret"}
+	server := httptest.NewServer(clauder)
+	defer server.Close()
+
+	s := NewServer("clauder", "test")
+	AddClauderTools(s, func(ctx context.Context, sessionID string) (Session, error) {
+		switch sessionID {
+		case "", "sibling":
+			return Session{URL: server.URL, Token: "secret"}, nil
+		case "unauthorized":
+			return Session{URL: server.URL}, nil
+		}
+		return Session{}, xerrors.Errorf("unknown session %q", sessionID)
+	}, server.Client())
+	c := newTestClient(t, s)
+	c.call("initialize", map[string]any{"protocolVersion": ProtocolVersion})
+
+	tools := c.call("tools/list", nil)["tools"].([]any)
+	var names []string
+	for _, tool := range tools {
+		tool := tool.(map[string]any)
+		names = append(names, tool["name"].(string))
+		schema := tool["inputSchema"].(map[string]any)
+		assert.Equal(t, "object", schema["type"])
+		assert.Contains(t, schema["properties"], "session_id")
+	}
+	assert.Equal(t, []string{"clauder_send_message", "clauder_get_snapshot", "clauder_list_files"}, names)
+
+	text, isError := c.callTool("clauder_send_message", map[string]any{"session_id": "sibling", "text": "Review the last commit please"})
+	assert.False(t, isError, text)
+	assert.Contains(t, text, "sent")
+	clauder.mu.Lock()
+	assert.Equal(t, []string{"Review the last commit please"}, clauder.messages)
+	clauder.mu.Unlock()
+
+	text, isError = c.callTool("clauder_send_message", map[string]any{"text": "you are busy"})
+	assert.True(t, isError)
+	assert.Contains(t, text, "Agent is not stable")
+	_, isError = c.callTool("clauder_send_message", map[string]any{"text": " "})
+	assert.True(t, isError)
+
+	text, isError = c.callTool("clauder_get_snapshot", map[string]any{})
+	assert.False(t, isError, text)
+	assert.Equal(t, "Agent status: stable\n\n> hello\n  world", text)
+
+	text, isError = c.callTool("clauder_list_files", map[string]any{"session_id": "sibling"})
+	assert.False(t, isError, text)
+	assert.Equal(t, "go.mod\nmain.go", text)
+
+	text, isError = c.callTool("clauder_list_files", map[string]any{"session_id": "unauthorized"})
+	assert.True(t, isError)
+	assert.Contains(t, text, "401")
+	text, isError = c.callTool("clauder_get_snapshot", map[string]any{"session_id": "other"})
+	assert.True(t, isError)
+	assert.Contains(t, text, `unknown session "other"`)
+}
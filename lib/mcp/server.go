@@ -0,0 +1,136 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	"golang.org/x/xerrors"
+)
+
+// maxMessageSize is the size of the largest message the server reads.
+const maxMessageSize = 10 << 20
+
+// ToolHandler runs a tool with its JSON encoded arguments.
+type ToolHandler func(ctx context.Context, arguments json.RawMessage) *ToolResult
+
+type tool struct {
+	Tool
+	handler ToolHandler
+}
+
+// Server is an MCP server that offers tools. Tools must be added before
+// Serve is called.
+type Server struct {
+	name    string
+	version string
+	tools   []tool
+}
+
+func NewServer(name, version string) *Server {
+	return &Server{name: name, version: version}
+}
+
+// AddTool adds a tool, which is listed in the order it was added.
+func (s *Server) AddTool(t Tool, handler ToolHandler) {
+	s.tools = append(s.tools, tool{Tool: t, handler: handler})
+}
+
+// Serve reads requests from r and writes the responses to w, one JSON
+// object per line, until r is closed or ctx is done. Requests are handled
+// one at a time.
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	logger := logctx.From(ctx)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxMessageSize)
+	encoder := json.NewEncoder(w)
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		resp := s.handleMessage(ctx, line)
+		if resp == nil {
+			continue
+		}
+		if err := encoder.Encode(resp); err != nil {
+			return xerrors.Errorf("failed to write response: %w", err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return xerrors.Errorf("failed to read request: %w", err)
+	}
+	logger.Debug("MCP client disconnected")
+	return nil
+}
+
+// handleMessage returns the response to a message, or nil if it's a
+// notification.
+func (s *Server) handleMessage(ctx context.Context, message []byte) *Response {
+	var req Request
+	if err := json.Unmarshal(message, &req); err != nil {
+		return &Response{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &Error{Code: CodeParseError, Message: "invalid JSON: " + err.Error()}}
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		id := req.ID
+		if id == nil {
+			id = json.RawMessage("null")
+		}
+		return &Response{JSONRPC: "2.0", ID: id, Error: &Error{Code: CodeInvalidRequest, Message: "invalid JSON-RPC 2.0 request"}}
+	}
+	result, err := s.handleRequest(ctx, req)
+	if req.ID == nil {
+		// notifications are never answered, not even with an error
+		return nil
+	}
+	resp := &Response{JSONRPC: "2.0", ID: req.ID}
+	if err != nil {
+		resp.Error = err
+	} else {
+		resp.Result = result
+	}
+	return resp
+}
+
+func (s *Server) handleRequest(ctx context.Context, req Request) (any, *Error) {
+	switch req.Method {
+	case "initialize":
+		return initializeResult{
+			ProtocolVersion: ProtocolVersion,
+			Capabilities:    map[string]any{"tools": map[string]any{}},
+			ServerInfo:      serverInfo{Name: s.name, Version: s.version},
+		}, nil
+	case "notifications/initialized", "notifications/cancelled":
+		return nil, nil
+	case "ping":
+		return struct{}{}, nil
+	case "tools/list":
+		tools := make([]Tool, 0, len(s.tools))
+		for _, t := range s.tools {
+			tools = append(tools, t.Tool)
+		}
+		return listToolsResult{Tools: tools}, nil
+	case "tools/call":
+		var params callToolParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, &Error{Code: CodeInvalidParams, Message: "invalid params: " + err.Error()}
+		}
+		for _, t := range s.tools {
+			if t.Name == params.Name {
+				arguments := params.Arguments
+				if arguments == nil {
+					arguments = json.RawMessage("{}")
+				}
+				return t.handler(ctx, arguments), nil
+			}
+		}
+		return nil, &Error{Code: CodeInvalidParams, Message: fmt.Sprintf("unknown tool %q", params.Name)}
+	}
+	return nil, &Error{Code: CodeMethodNotFound, Message: fmt.Sprintf("method %q not found", req.Method)}
+}
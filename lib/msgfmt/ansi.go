@@ -0,0 +1,76 @@
+package msgfmt
+
+import (
+	"strings"
+)
+
+const escape = 0x1b
+
+// StripANSI removes ANSI escape sequences from raw terminal output, along
+// with any bytes that aren't valid UTF-8. Incomplete sequences at the end of
+// the output are removed too. The output is never longer than the input.
+//
+// It recognizes CSI sequences (ESC [), strings terminated by BEL or ST such
+// as OSC sequences (ESC ]), and other escape sequences like ESC ( B. An ESC
+// that interrupts a sequence starts a new one.
+func StripANSI(s string) string {
+	if strings.IndexByte(s, escape) == -1 {
+		return strings.ToValidUTF8(s, "")
+	}
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); {
+		if s[i] != escape {
+			next := strings.IndexByte(s[i:], escape)
+			if next == -1 {
+				next = len(s) - i
+			}
+			b.WriteString(s[i : i+next])
+			i += next
+			continue
+		}
+		i = skipEscapeSequence(s, i)
+	}
+	return strings.ToValidUTF8(b.String(), "")
+}
+
+// skipEscapeSequence returns the index right after the escape sequence that
+// starts at s[start], which must be ESC.
+func skipEscapeSequence(s string, start int) int {
+	i := start + 1
+	if i == len(s) {
+		return i
+	}
+	switch s[i] {
+	case '[':
+		// CSI: parameter bytes, intermediate bytes, then a final byte
+		for i++; i < len(s) && s[i] >= 0x20 && s[i] <= 0x3f; i++ {
+		}
+		if i < len(s) && s[i] >= 0x40 && s[i] <= 0x7e {
+			return i + 1
+		}
+		return i
+	case ']', 'P', 'X', '^', '_':
+		// OSC, DCS, SOS, PM and APC: a string terminated by BEL or ST
+		for i++; i < len(s); i++ {
+			switch s[i] {
+			case 0x07:
+				return i + 1
+			case escape:
+				if i+1 < len(s) && s[i+1] == '\\' {
+					return i + 2
+				}
+				return i
+			}
+		}
+		return i
+	default:
+		// intermediate bytes, then a final byte
+		for ; i < len(s) && s[i] >= 0x20 && s[i] <= 0x2f; i++ {
+		}
+		if i < len(s) && s[i] >= 0x30 && s[i] <= 0x7e {
+			return i + 1
+		}
+		return i
+	}
+}
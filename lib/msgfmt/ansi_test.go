@@ -0,0 +1,61 @@
+package msgfmt
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var ansiTestCases = []struct {
+	name     string
+	input    string
+	expected string
+}{
+	{"plain", "hello world", "hello world"},
+	{"colour", "\x1b[1;31merror\x1b[0m: failed", "error: failed"},
+	{"partial escape", "done\x1b[", "done"},
+	{"lone escape", "done\x1b", "done"},
+	{"overlong CSI parameters", "a\x1b[" + strings.Repeat("1;", 4096) + "mb", "ab"},
+	{"CSI with an invalid byte", "a\x1b[12\nb", "a\nb"},
+	{"OSC terminated by BEL", "\x1b]0;title\x07prompt", "prompt"},
+	{"OSC terminated by ST", "\x1b]8;;https://example.com\x1b\\link\x1b]8;;\x1b\\", "link"},
+	{"nested OSC", "\x1b]0;outer\x1b]0;inner\x07text", "text"},
+	{"unterminated OSC", "text\x1b]0;title", "text"},
+	{"charset designation", "\x1b(Bbox\x1b(0", "box"},
+	{"save and restore cursor", "\x1b7moved\x1b8", "moved"},
+	{"private mode", "\x1b[?2004hpaste\x1b[?2004l", "paste"},
+	{"multi-byte UTF-8", "\x1b[32m✓\x1b[0m héllo 世界 🎉", "✓ héllo 世界 🎉"},
+	{"invalid UTF-8", "a\xffb\xe2\x82", "ab"},
+	{"escape splitting a multi-byte rune", "\xe2\x1b[0m\x9c\x93", "✓"},
+}
+
+func TestStripANSI(t *testing.T) {
+	for _, c := range ansiTestCases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.expected, StripANSI(c.input))
+		})
+	}
+}
+
+func FuzzANSIStrip(f *testing.F) {
+	for _, c := range ansiTestCases {
+		f.Add(c.input)
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		output := StripANSI(input)
+		if !utf8.ValidString(output) {
+			t.Fatalf("output %q of %q isn't valid UTF-8", output, input)
+		}
+		if len(output) > len(input) {
+			t.Fatalf("output %q is longer than input %q", output, input)
+		}
+		if strings.IndexByte(output, escape) != -1 {
+			t.Fatalf("output %q of %q contains an escape", output, input)
+		}
+		if again := StripANSI(output); again != output {
+			t.Fatalf("stripping %q again returned %q", output, again)
+		}
+	})
+}
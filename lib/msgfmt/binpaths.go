@@ -0,0 +1,27 @@
+package msgfmt
+
+import "slices"
+
+// npmBinPaths are where npm installs the executables of global packages
+// when it's configured with a user prefix, or runs as root.
+var npmBinPaths = []string{"~/.npm-global/bin", "~/.npm/bin", "/usr/local/lib/node_modules/.bin"}
+
+// binarySearchPaths are the directories the agents' installers put their
+// executables in, which aren't always in the PATH of a service.
+var binarySearchPaths = map[AgentType][]string{
+	// ~/.claude/local is where Claude Code's local installation goes
+	AgentTypeClaude: append([]string{"~/.claude/local", "~/.local/bin"}, npmBinPaths...),
+	AgentTypeCodex:  npmBinPaths,
+	AgentTypeGemini: npmBinPaths,
+	// aider is installed with pip or pipx, and goose with its install
+	// script, which all default to ~/.local/bin
+	AgentTypeAider: {"~/.local/bin"},
+	AgentTypeGoose: {"~/.local/bin"},
+}
+
+// BinarySearchPaths returns the directories the executable of an agent of
+// the given type is looked up in before PATH, see
+// termexec.ResolveBinary. It returns nil for custom agents.
+func BinarySearchPaths(agentType AgentType) []string {
+	return slices.Clone(binarySearchPaths[agentType])
+}
@@ -0,0 +1,16 @@
+package msgfmt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBinarySearchPaths(t *testing.T) {
+	paths := BinarySearchPaths(AgentTypeClaude)
+	assert.Equal(t, []string{"~/.claude/local", "~/.local/bin", "~/.npm-global/bin", "~/.npm/bin", "/usr/local/lib/node_modules/.bin"}, paths)
+	paths[0] = "changed"
+	assert.Equal(t, "~/.claude/local", BinarySearchPaths(AgentTypeClaude)[0], "the defaults are copied")
+	assert.Equal(t, []string{"~/.local/bin"}, BinarySearchPaths(AgentTypeAider))
+	assert.Nil(t, BinarySearchPaths(AgentTypeCustom))
+}
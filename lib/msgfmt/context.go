@@ -0,0 +1,59 @@
+package msgfmt
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// charsPerToken is the average number of characters in a token of English
+// text or code. It's only good enough for a rough estimate.
+const charsPerToken = 4
+
+// ContextTrimThreshold is the fraction of the context window that the
+// conversation may fill before the oldest messages are trimmed.
+const ContextTrimThreshold = 0.8
+
+// EstimateTokens approximates the number of tokens in text from its length.
+func EstimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + charsPerToken - 1) / charsPerToken
+}
+
+// ContextManager keeps the conversation history the server keeps within
+// the agent's context window, so that long sessions don't grow it without
+// bound. The agent's own context isn't affected.
+type ContextManager struct {
+	window int
+}
+
+// NewContextManager creates a manager for a context window of window tokens.
+func NewContextManager(window int) *ContextManager {
+	return &ContextManager{window: window}
+}
+
+func (m *ContextManager) Window() int {
+	return m.window
+}
+
+// Trim returns how many of the oldest messages must be removed for the
+// estimated size of the conversation to fit within ContextTrimThreshold of
+// the window, and the estimated number of tokens in the remaining messages.
+// The most recent message is never removed.
+func (m *ContextManager) Trim(messages []string) (int, int) {
+	tokens := 0
+	for _, message := range messages {
+		tokens += EstimateTokens(message)
+	}
+	limit := int(float64(m.window) * ContextTrimThreshold)
+	removed := 0
+	for tokens > limit && removed < len(messages)-1 {
+		tokens -= EstimateTokens(messages[removed])
+		removed++
+	}
+	return removed, tokens
+}
+
+// ContextTrimmedAnnotation tells clients that earlier messages of the
+// conversation were removed.
+func ContextTrimmedAnnotation(removed int) string {
+	return fmt.Sprintf("[Context trimmed: %d messages removed]", removed)
+}
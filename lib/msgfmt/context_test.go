@@ -0,0 +1,60 @@
+package msgfmt
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEstimateTokens(t *testing.T) {
+	assert.Equal(t, 0, EstimateTokens(""))
+	assert.Equal(t, 1, EstimateTokens("abc"))
+	assert.Equal(t, 1, EstimateTokens("abcd"))
+	assert.Equal(t, 2, EstimateTokens("abcde"))
+	// runes, not bytes, are counted
+	assert.Equal(t, 1, EstimateTokens("héö"))
+}
+
+func TestContextManagerTrim(t *testing.T) {
+	// 10 tokens each
+	message := strings.Repeat("x", 40)
+	manager := NewContextManager(100)
+
+	t.Run("fits", func(t *testing.T) {
+		removed, tokens := manager.Trim([]string{message, message, message})
+		assert.Equal(t, 0, removed)
+		assert.Equal(t, 30, tokens)
+
+		// exactly 80% of the window
+		removed, tokens = manager.Trim([]string{message, message, message, message, message, message, message, message})
+		assert.Equal(t, 0, removed)
+		assert.Equal(t, 80, tokens)
+	})
+
+	t.Run("trims oldest", func(t *testing.T) {
+		messages := make([]string, 20)
+		for i := range messages {
+			messages[i] = message
+		}
+		removed, tokens := manager.Trim(messages)
+		assert.Equal(t, 12, removed)
+		assert.Equal(t, 80, tokens)
+	})
+
+	t.Run("keeps last message", func(t *testing.T) {
+		removed, tokens := manager.Trim([]string{message, strings.Repeat("x", 400)})
+		assert.Equal(t, 1, removed)
+		assert.Equal(t, 100, tokens)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		removed, tokens := manager.Trim(nil)
+		assert.Equal(t, 0, removed)
+		assert.Equal(t, 0, tokens)
+	})
+}
+
+func TestContextTrimmedAnnotation(t *testing.T) {
+	assert.Equal(t, "[Context trimmed: 3 messages removed]", ContextTrimmedAnnotation(3))
+}
@@ -0,0 +1,99 @@
+package msgfmt
+
+import (
+	"strings"
+)
+
+// GeminiReadyPrompt is shown in Gemini CLI's input box when it's waiting
+// for user input.
+const GeminiReadyPrompt = "gemini> "
+
+// geminiFormatter formats the messages of Gemini CLI. Gemini draws the
+// user's messages, tool calls and its input box in panels with rounded
+// corners, like
+// ╭──────────────────╮
+// │ ✔  ReadFile a.go │
+// ╰──────────────────╯
+// The panel borders are removed and their content is kept.
+type geminiFormatter struct{}
+
+func (geminiFormatter) FormatInput(s string) string {
+	return TrimWhitespace(s)
+}
+
+func (geminiFormatter) FormatOutput(s string) string {
+	lines := strings.Split(s, "\n")
+	if idx := findGeminiInputBox(lines); idx != -1 {
+		// the status line below the input box is removed too
+		lines = lines[:idx]
+	}
+	lines = stripPanelBorders(lines)
+	return trimEmptyLines(strings.Join(lines, "\n"))
+}
+
+// findGeminiInputBox returns the index of the first line of the input box
+// at the bottom of Gemini's screen, or -1 if there isn't one.
+func findGeminiInputBox(lines []string) int {
+	for i := len(lines) - 1; i >= max(len(lines)-6, 0); i-- {
+		if strings.Contains(lines[i], strings.TrimSpace(GeminiReadyPrompt)) {
+			if i > 0 && isPanelEdge(lines[i-1]) {
+				return i - 1
+			}
+			return i
+		}
+	}
+	return -1
+}
+
+// isPanelEdge reports whether line is the top or the bottom border of a
+// panel.
+func isPanelEdge(line string) bool {
+	line = strings.TrimSpace(line)
+	if !(strings.HasPrefix(line, "╭") && strings.HasSuffix(line, "╮")) &&
+		!(strings.HasPrefix(line, "╰") && strings.HasSuffix(line, "╯")) {
+		return false
+	}
+	inner := []rune(line)
+	return strings.Trim(string(inner[1:len(inner)-1]), "─") == ""
+}
+
+// stripPanelBorders removes the borders of panels, and the padding on the
+// right of every line. Only the lines between a panel's top and bottom
+// borders lose their side borders, so that the box drawing characters
+// of tables and other content are kept. The message may start inside a
+// panel, since the echoed user input is removed from it.
+func stripPanelBorders(lines []string) []string {
+	result := make([]string, 0, len(lines))
+	inPanel := true
+	for _, line := range lines {
+		line = strings.TrimRight(line, WhiteSpaceChars)
+		if isPanelEdge(line) {
+			inPanel = strings.HasPrefix(strings.TrimSpace(line), "╭")
+			continue
+		}
+		trimmed := strings.TrimLeft(line, " ")
+		if inPanel && len(trimmed) > len("│") && strings.HasPrefix(trimmed, "│") && strings.HasSuffix(trimmed, "│") {
+			indent := line[:len(line)-len(trimmed)]
+			content := strings.TrimSuffix(strings.TrimPrefix(trimmed, "│"), "│")
+			line = strings.TrimRight(indent+strings.TrimPrefix(content, " "), WhiteSpaceChars)
+		} else if !strings.HasPrefix(trimmed, "│") {
+			inPanel = false
+		}
+		result = append(result, line)
+	}
+	return result
+}
+
+func init() {
+	DefaultRegistry.Register(string(AgentTypeGemini), geminiFormatter{})
+}
+
+// ReadyPrompt returns the text shown by agents of the given type when
+// they're waiting for user input, or "" if it can't be told from their
+// screen.
+func ReadyPrompt(agentType AgentType) string {
+	if agentType == AgentTypeGemini {
+		return GeminiReadyPrompt
+	}
+	return ""
+}
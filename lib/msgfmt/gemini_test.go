@@ -0,0 +1,36 @@
+package msgfmt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStripPanelBorders(t *testing.T) {
+	lines := []string{
+		"│ > hi      │",
+		"╰───────────╯",
+		"┌───┬───┐",
+		"│ a │ b │",
+		"└───┴───┘",
+		"╭───────────╮",
+		"│ ✔  Shell  │",
+		"│           │",
+		"│    output │",
+		"╰───────────╯   ",
+	}
+	assert.Equal(t, []string{
+		"> hi",
+		"┌───┬───┐",
+		"│ a │ b │",
+		"└───┴───┘",
+		"✔  Shell",
+		"",
+		"   output",
+	}, stripPanelBorders(lines))
+}
+
+func TestReadyPrompt(t *testing.T) {
+	assert.Equal(t, "gemini> ", ReadyPrompt(AgentTypeGemini))
+	assert.Empty(t, ReadyPrompt(AgentTypeClaude))
+}
@@ -197,29 +197,47 @@ const (
 	AgentTypeGoose  AgentType = "goose"
 	AgentTypeAider  AgentType = "aider"
 	AgentTypeCodex  AgentType = "codex"
+	AgentTypeGemini AgentType = "gemini"
 	AgentTypeCustom AgentType = "custom"
 )
 
-func formatGenericMessage(message string, userInput string) string {
-	message = RemoveUserInput(message, userInput)
-	message = removeMessageBox(message)
-	message = trimEmptyLines(message)
-	return message
+// genericFormatter formats the messages of agents with a terminal UI like
+// Claude Code's, where the user's input is entered in a message box.
+type genericFormatter struct{}
+
+func (genericFormatter) FormatInput(s string) string {
+	return TrimWhitespace(s)
+}
+
+func (genericFormatter) FormatOutput(s string) string {
+	s = removeMessageBox(s)
+	s = trimEmptyLines(s)
+	return s
 }
 
+func init() {
+	for _, agentType := range []AgentType{AgentTypeClaude, AgentTypeGoose, AgentTypeAider, AgentTypeCodex, AgentTypeCustom} {
+		DefaultRegistry.Register(string(agentType), genericFormatter{})
+	}
+}
+
+// FormatAgentMessage removes the echoed user input from a message read from
+// the agent's screen and formats it with the formatter registered for the
+// agent type. Messages of unknown agent types are returned unchanged.
 func FormatAgentMessage(agentType AgentType, message string, userInput string) string {
-	switch agentType {
-	case AgentTypeClaude:
-		return formatGenericMessage(message, userInput)
-	case AgentTypeGoose:
-		return formatGenericMessage(message, userInput)
-	case AgentTypeAider:
-		return formatGenericMessage(message, userInput)
-	case AgentTypeCodex:
-		return formatGenericMessage(message, userInput)
-	case AgentTypeCustom:
-		return formatGenericMessage(message, userInput)
-	default:
+	f, ok := DefaultRegistry.Lookup(string(agentType))
+	if !ok {
 		return message
 	}
+	return f.FormatOutput(RemoveUserInput(message, userInput))
+}
+
+// FormatUserMessage formats a user message before it's sent to an agent
+// of the given type. Messages of unknown agent types are only trimmed.
+func FormatUserMessage(agentType AgentType, message string) string {
+	f, ok := DefaultRegistry.Lookup(string(agentType))
+	if !ok {
+		return TrimWhitespace(message)
+	}
+	return f.FormatInput(message)
 }
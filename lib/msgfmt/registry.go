@@ -0,0 +1,65 @@
+package msgfmt
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Formatter formats the messages exchanged with an agent of a given type.
+type Formatter interface {
+	// FormatInput formats a user message before it's sent to the agent.
+	FormatInput(s string) string
+	// FormatOutput formats a message read from the agent's screen, after
+	// the echoed user input was removed from it.
+	FormatOutput(s string) string
+}
+
+// Registry maps agent types to their formatters. It's safe for concurrent use.
+type Registry struct {
+	mu         sync.RWMutex
+	formatters map[string]Formatter
+}
+
+func NewRegistry() *Registry {
+	return &Registry{formatters: make(map[string]Formatter)}
+}
+
+// DefaultRegistry holds the formatters of the built-in agent types.
+// Other packages can support more agent types by registering their
+// formatters in it from an init function.
+var DefaultRegistry = NewRegistry()
+
+// Register makes a formatter available for agentType. It panics if
+// f is nil or if a formatter is already registered for agentType.
+func (r *Registry) Register(agentType string, f Formatter) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if f == nil {
+		panic("msgfmt: Register formatter is nil")
+	}
+	if _, ok := r.formatters[agentType]; ok {
+		panic(fmt.Sprintf("msgfmt: Register called twice for agent type %s", agentType))
+	}
+	r.formatters[agentType] = f
+}
+
+// Lookup returns the formatter registered for agentType.
+func (r *Registry) Lookup(agentType string) (Formatter, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	f, ok := r.formatters[agentType]
+	return f, ok
+}
+
+// AgentTypes returns the registered agent types in alphabetical order.
+func (r *Registry) AgentTypes() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	agentTypes := make([]string, 0, len(r.formatters))
+	for agentType := range r.formatters {
+		agentTypes = append(agentTypes, agentType)
+	}
+	sort.Strings(agentTypes)
+	return agentTypes
+}
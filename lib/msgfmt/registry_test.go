@@ -0,0 +1,41 @@
+package msgfmt
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type upperFormatter struct{}
+
+func (upperFormatter) FormatInput(s string) string  { return strings.ToUpper(s) }
+func (upperFormatter) FormatOutput(s string) string { return strings.ToLower(s) }
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	_, ok := r.Lookup("enterprise")
+	assert.False(t, ok)
+
+	r.Register("enterprise", upperFormatter{})
+	f, ok := r.Lookup("enterprise")
+	require.True(t, ok)
+	assert.Equal(t, "HELLO", f.FormatInput("hello"))
+	assert.Equal(t, "hello", f.FormatOutput("HELLO"))
+
+	r.Register("another", upperFormatter{})
+	assert.Equal(t, []string{"another", "enterprise"}, r.AgentTypes())
+
+	assert.Panics(t, func() { r.Register("enterprise", upperFormatter{}) })
+	assert.Panics(t, func() { r.Register("nil", nil) })
+}
+
+func TestDefaultRegistry(t *testing.T) {
+	for _, agentType := range []AgentType{AgentTypeClaude, AgentTypeGoose, AgentTypeAider, AgentTypeCodex, AgentTypeCustom} {
+		_, ok := DefaultRegistry.Lookup(string(agentType))
+		assert.True(t, ok, agentType)
+	}
+	assert.Equal(t, "hello", FormatUserMessage(AgentTypeClaude, "  hello\n"))
+	assert.Equal(t, "  hello\n", FormatAgentMessage("unknown", "  hello\n", ""))
+}
@@ -0,0 +1,35 @@
+package msgfmt
+
+// TerminalDimensions is the size of an agent's terminal, in columns and
+// rows.
+type TerminalDimensions struct {
+	Width  uint16
+	Height uint16
+}
+
+// defaultTerminalHeight is tall enough for the screen to hold a long
+// response, so the conversation can be read from it without scrolling.
+const defaultTerminalHeight = 1000
+
+// FallbackTerminalDimensions is the size of the terminal of agents that
+// aren't in DefaultTerminalDimensions.
+var FallbackTerminalDimensions = TerminalDimensions{Width: 80, Height: defaultTerminalHeight}
+
+// DefaultTerminalDimensions are the terminal sizes the agents render best
+// at, used unless the user picks one.
+var DefaultTerminalDimensions = map[AgentType]TerminalDimensions{
+	// Claude Code's boxes and tables wrap awkwardly in narrow terminals
+	AgentTypeClaude: {Width: 220, Height: defaultTerminalHeight},
+	// aider's diffs are laid out for 80 columns
+	AgentTypeAider: {Width: 80, Height: defaultTerminalHeight},
+	AgentTypeGoose: {Width: 100, Height: defaultTerminalHeight},
+}
+
+// AgentTerminalDimensions returns the default terminal size of an agent of
+// the given type.
+func AgentTerminalDimensions(agentType AgentType) TerminalDimensions {
+	if dimensions, ok := DefaultTerminalDimensions[agentType]; ok {
+		return dimensions
+	}
+	return FallbackTerminalDimensions
+}
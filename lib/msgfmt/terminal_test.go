@@ -0,0 +1,21 @@
+package msgfmt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAgentTerminalDimensions(t *testing.T) {
+	for agentType, want := range map[AgentType]TerminalDimensions{
+		AgentTypeClaude: {Width: 220, Height: 1000},
+		AgentTypeAider:  {Width: 80, Height: 1000},
+		AgentTypeGoose:  {Width: 100, Height: 1000},
+		AgentTypeCodex:  {Width: 80, Height: 1000},
+		AgentTypeGemini: {Width: 80, Height: 1000},
+		AgentTypeCustom: {Width: 80, Height: 1000},
+		"my-agent":      {Width: 80, Height: 1000},
+	} {
+		assert.Equal(t, want, AgentTerminalDimensions(agentType), agentType)
+	}
+}
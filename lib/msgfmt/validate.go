@@ -0,0 +1,71 @@
+package msgfmt
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxRunes is the maximum number of runes in a message accepted by Validate.
+var MaxRunes = 32000
+
+// MinWords is the minimum number of words in a message without a code block.
+// It guards against accidentally sending an empty or truncated prompt.
+const MinWords = 3
+
+type ValidationErrorKind string
+
+const (
+	ValidationErrorInvalidUTF8 ValidationErrorKind = "invalid_utf8"
+	ValidationErrorNullByte    ValidationErrorKind = "null_byte"
+	ValidationErrorTooLong     ValidationErrorKind = "too_long"
+	ValidationErrorTooShort    ValidationErrorKind = "too_short"
+)
+
+// ValidationError describes why a message was rejected by Validate.
+type ValidationError struct {
+	Kind   ValidationErrorKind
+	Detail string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid message: %s", e.Detail)
+}
+
+func hasCodeBlock(msg string) bool {
+	for _, line := range strings.Split(msg, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			return true
+		}
+	}
+	return false
+}
+
+// isSlashCommand reports whether the message is an agent command like
+// "/clear". Commands are short by design, so they're exempt from MinWords.
+func isSlashCommand(agentType AgentType, msg string) bool {
+	if agentType == AgentTypeCustom {
+		return false
+	}
+	trimmed := TrimWhitespace(msg)
+	return strings.HasPrefix(trimmed, "/") && !strings.ContainsAny(trimmed, WhiteSpaceChars)
+}
+
+// Validate checks that a user message is safe to type into the agent's
+// terminal. It returns a *ValidationError if it isn't.
+func Validate(agentType AgentType, msg string) error {
+	if !utf8.ValidString(msg) {
+		return &ValidationError{Kind: ValidationErrorInvalidUTF8, Detail: "message is not valid UTF-8"}
+	}
+	if idx := strings.IndexByte(msg, 0); idx != -1 {
+		return &ValidationError{Kind: ValidationErrorNullByte, Detail: fmt.Sprintf("message contains a null byte at offset %d", idx)}
+	}
+	if n := utf8.RuneCountInString(msg); n > MaxRunes {
+		return &ValidationError{Kind: ValidationErrorTooLong, Detail: fmt.Sprintf("message has %d characters, the limit is %d", n, MaxRunes)}
+	}
+	if len(strings.Fields(msg)) < MinWords && !hasCodeBlock(msg) && !isSlashCommand(agentType, msg) {
+		return &ValidationError{Kind: ValidationErrorTooShort, Detail: fmt.Sprintf("message must contain at least %d words or a code block", MinWords)}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package msgfmt
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	validationErrorKind := func(t *testing.T, err error) ValidationErrorKind {
+		t.Helper()
+		var validationErr *ValidationError
+		require.ErrorAs(t, err, &validationErr)
+		return validationErr.Kind
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		assert.NoError(t, Validate(AgentTypeClaude, "Fix the failing test"))
+		assert.NoError(t, Validate(AgentTypeClaude, "Explain:\n```\nx := 1\n```"))
+		assert.NoError(t, Validate(AgentTypeClaude, "~~~\nls\n~~~"))
+		assert.NoError(t, Validate(AgentTypeClaude, "/clear"))
+		assert.NoError(t, Validate(AgentTypeAider, " /undo\n"))
+	})
+
+	t.Run("invalid-utf8", func(t *testing.T) {
+		err := Validate(AgentTypeClaude, "fix this bug \xff\xfe please")
+		assert.Equal(t, ValidationErrorInvalidUTF8, validationErrorKind(t, err))
+	})
+
+	t.Run("null-byte", func(t *testing.T) {
+		err := Validate(AgentTypeClaude, "fix this bug\x00 please")
+		assert.Equal(t, ValidationErrorNullByte, validationErrorKind(t, err))
+		assert.Contains(t, err.Error(), "offset 12")
+	})
+
+	t.Run("too-long", func(t *testing.T) {
+		assert.NoError(t, Validate(AgentTypeClaude, strings.Repeat("a ", MaxRunes/2)))
+		err := Validate(AgentTypeClaude, strings.Repeat("a ", MaxRunes/2)+"a")
+		assert.Equal(t, ValidationErrorTooLong, validationErrorKind(t, err))
+	})
+
+	t.Run("emoji", func(t *testing.T) {
+		// Runes are counted, not bytes. Each emoji is 4 bytes.
+		emoji := strings.Repeat("🎉 ", MaxRunes/2)
+		assert.Greater(t, len(emoji), MaxRunes)
+		assert.NoError(t, Validate(AgentTypeClaude, emoji))
+
+		err := Validate(AgentTypeClaude, emoji+"🎉")
+		assert.Equal(t, ValidationErrorTooLong, validationErrorKind(t, err))
+
+		// Emoji count as words when separated by whitespace.
+		assert.NoError(t, Validate(AgentTypeClaude, "😄 🎉 🌮"))
+		err = Validate(AgentTypeClaude, "😄🎉🌮😄🎉🌮")
+		assert.Equal(t, ValidationErrorTooShort, validationErrorKind(t, err))
+	})
+
+	t.Run("too-short", func(t *testing.T) {
+		for _, msg := range []string{"", "   \n\t", "hello", "fix it"} {
+			err := Validate(AgentTypeClaude, msg)
+			assert.Equal(t, ValidationErrorTooShort, validationErrorKind(t, err), msg)
+		}
+		// Custom agents may not support slash commands.
+		err := Validate(AgentTypeCustom, "/clear")
+		assert.Equal(t, ValidationErrorTooShort, validationErrorKind(t, err))
+	})
+}
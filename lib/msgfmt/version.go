@@ -0,0 +1,93 @@
+package msgfmt
+
+import (
+	"regexp"
+	"strings"
+
+	"golang.org/x/mod/semver"
+	"golang.org/x/xerrors"
+)
+
+// agentVersionConstraints are the versions of the agents whose terminal UI
+// the formatters were written for. A new major version may change it in
+// ways that break them.
+var agentVersionConstraints = map[AgentType]string{
+	AgentTypeClaude: ">=1.0.0 <2.0.0",
+	AgentTypeGoose:  ">=1.0.0 <2.0.0",
+	AgentTypeAider:  ">=0.80.0 <1.0.0",
+	AgentTypeCodex:  ">=0.1.0 <1.0.0",
+	AgentTypeGemini: ">=0.1.0 <1.0.0",
+}
+
+// AgentVersionConstraint returns the versions of the agent of the given type
+// that are known to work, as space-separated comparisons that must all hold,
+// e.g. ">=1.0.0 <2.0.0". It returns "" for custom agents.
+func AgentVersionConstraint(agentType AgentType) string {
+	return agentVersionConstraints[agentType]
+}
+
+// versionPattern matches the first version in the output of an agent's
+// --version flag, e.g. "1.0.51 (Claude Code)", "codex-cli 0.10.0" or
+// "aider 0.85.2.dev12+g1a2b3c". The patch version is optional, and anything
+// after it but a semver prerelease is ignored.
+var versionPattern = regexp.MustCompile(`(?:^|[^\w.])v?(\d+\.\d+(?:\.\d+)?)(-[0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*)?`)
+
+// ParseAgentVersion returns the version in the output of an agent's
+// --version flag in the canonical semver form, e.g. "v1.0.51".
+func ParseAgentVersion(output string) (string, error) {
+	match := versionPattern.FindStringSubmatch(output)
+	if match == nil {
+		return "", xerrors.Errorf("no version found in %q", strings.TrimSpace(output))
+	}
+	version := semver.Canonical("v" + match[1] + match[2])
+	if version == "" {
+		return "", xerrors.Errorf("invalid version %s%s", match[1], match[2])
+	}
+	return version, nil
+}
+
+// constraintOperators are the comparisons a version constraint may use,
+// longest first so that ">=" isn't read as ">".
+var constraintOperators = []string{">=", "<=", "!=", ">", "<", "="}
+
+// CheckVersionConstraint reports whether version, as returned by
+// ParseAgentVersion, satisfies constraint, as returned by
+// AgentVersionConstraint. An empty constraint allows every version.
+func CheckVersionConstraint(version, constraint string) (bool, error) {
+	if !semver.IsValid(version) {
+		return false, xerrors.Errorf("invalid version %s", version)
+	}
+	for _, comparison := range strings.Fields(constraint) {
+		operator := "="
+		for _, op := range constraintOperators {
+			if strings.HasPrefix(comparison, op) {
+				operator = op
+				break
+			}
+		}
+		bound := strings.TrimPrefix(strings.TrimPrefix(comparison, operator), "v")
+		if !semver.IsValid("v" + bound) {
+			return false, xerrors.Errorf("invalid version constraint %q", constraint)
+		}
+		cmp := semver.Compare(version, "v"+bound)
+		var ok bool
+		switch operator {
+		case ">=":
+			ok = cmp >= 0
+		case "<=":
+			ok = cmp <= 0
+		case "!=":
+			ok = cmp != 0
+		case ">":
+			ok = cmp > 0
+		case "<":
+			ok = cmp < 0
+		case "=":
+			ok = cmp == 0
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
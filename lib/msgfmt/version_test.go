@@ -0,0 +1,65 @@
+package msgfmt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAgentVersion(t *testing.T) {
+	for _, test := range []struct {
+		agentType AgentType
+		output    string
+		want      string
+	}{
+		{AgentTypeClaude, "1.0.51 (Claude Code)\n", "v1.0.51"},
+		{AgentTypeGoose, "goose 1.0.29\n", "v1.0.29"},
+		{AgentTypeGoose, " 1.0.35\n", "v1.0.35"},
+		{AgentTypeAider, "aider 0.85.1\n", "v0.85.1"},
+		{AgentTypeAider, "aider 0.85.2.dev12+g1a2b3c4\n", "v0.85.2"},
+		{AgentTypeCodex, "codex-cli 0.10.0\n", "v0.10.0"},
+		{AgentTypeGemini, "0.1.12\n", "v0.1.12"},
+		{AgentTypeGemini, "0.2.0-nightly.20250801\n", "v0.2.0-nightly.20250801"},
+		{AgentTypeCustom, "my-agent version v2.3\n", "v2.3.0"},
+	} {
+		got, err := ParseAgentVersion(test.output)
+		require.NoError(t, err, test.output)
+		assert.Equal(t, test.want, got, test.output)
+		ok, err := CheckVersionConstraint(got, AgentVersionConstraint(test.agentType))
+		require.NoError(t, err)
+		assert.True(t, ok, "%s %s", test.agentType, got)
+	}
+
+	_, err := ParseAgentVersion("command not found")
+	assert.Error(t, err)
+	assert.Empty(t, AgentVersionConstraint(AgentTypeCustom))
+}
+
+func TestCheckVersionConstraint(t *testing.T) {
+	for _, test := range []struct {
+		version    string
+		constraint string
+		want       bool
+	}{
+		{"v1.0.0", ">=1.0.0 <2.0.0", true},
+		{"v1.9.99", ">=1.0.0 <2.0.0", true},
+		{"v2.0.0", ">=1.0.0 <2.0.0", false},
+		{"v0.9.0", ">=1.0.0 <2.0.0", false},
+		{"v2.0.0-beta.1", ">=1.0.0 <2.0.0", true},
+		{"v1.2.3", "1.2.3", true},
+		{"v1.2.3", "=v1.2.4", false},
+		{"v1.2.3", "!=1.2.3", false},
+		{"v1.2.3", ">1.2.2 <=1.2.3", true},
+		{"v1.2.3", "", true},
+	} {
+		got, err := CheckVersionConstraint(test.version, test.constraint)
+		require.NoError(t, err)
+		assert.Equal(t, test.want, got, "%s %s", test.version, test.constraint)
+	}
+
+	_, err := CheckVersionConstraint("v1.0.0", ">=one")
+	assert.Error(t, err)
+	_, err = CheckVersionConstraint("1.0.0", ">=1.0.0")
+	assert.Error(t, err)
+}
@@ -0,0 +1,133 @@
+// Package notify shows desktop notifications with the notification tool
+// of the operating system.
+package notify
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// Notifier shows notifications to the user.
+type Notifier interface {
+	Notify(title, body string) error
+}
+
+// command is a command line that shows a notification.
+type command struct {
+	name string
+	args []string
+	// env is appended to the environment of the server.
+	env []string
+}
+
+// commandNotifier shows notifications by running the command build returns.
+type commandNotifier struct {
+	build func(title, body string) command
+	// run runs the command. It's replaced in tests.
+	run func(cmd command) error
+}
+
+func (n *commandNotifier) Notify(title, body string) error {
+	return n.run(n.build(title, body))
+}
+
+func runCommand(c command) error {
+	cmd := exec.Command(c.name, c.args...)
+	if len(c.env) > 0 {
+		cmd.Env = append(os.Environ(), c.env...)
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return xerrors.Errorf("%s failed: %w: %s", c.name, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// macOSScript displays a notification with the title and body it's passed
+// as arguments, so that they don't have to be quoted as AppleScript
+// strings.
+var macOSScript = []string{
+	"on run argv",
+	"display notification (item 2 of argv) with title (item 1 of argv)",
+	"end run",
+}
+
+func newMacOSNotifier() *commandNotifier {
+	return &commandNotifier{
+		build: func(title, body string) command {
+			var args []string
+			for _, line := range macOSScript {
+				args = append(args, "-e", line)
+			}
+			return command{name: "osascript", args: append(args, title, body)}
+		},
+		run: runCommand,
+	}
+}
+
+func newLinuxNotifier() *commandNotifier {
+	return &commandNotifier{
+		build: func(title, body string) command {
+			return command{name: "notify-send", args: []string{"--app-name=clauder", "--", title, body}}
+		},
+		run: runCommand,
+	}
+}
+
+// windowsAppID is the application ID of PowerShell. Toasts are only shown
+// for registered applications, so they're shown as PowerShell's.
+const windowsAppID = `{1AC14E77-02E7-4E5D-B744-2EB1AE5198B7}\WindowsPowerShell\v1.0\powershell.exe`
+
+// windowsScript shows a toast notification. The title and body are read
+// from the environment, so that they don't have to be quoted as
+// PowerShell strings.
+const windowsScript = `[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] | Out-Null
+$template = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$text = $template.GetElementsByTagName('text')
+$text.Item(0).AppendChild($template.CreateTextNode($env:CLAUDER_NOTIFY_TITLE)) | Out-Null
+$text.Item(1).AppendChild($template.CreateTextNode($env:CLAUDER_NOTIFY_BODY)) | Out-Null
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier('` + windowsAppID + `').Show([Windows.UI.Notifications.ToastNotification]::new($template))`
+
+func newWindowsNotifier() *commandNotifier {
+	return &commandNotifier{
+		build: func(title, body string) command {
+			return command{
+				name: "powershell",
+				args: []string{"-NoProfile", "-NonInteractive", "-Command", windowsScript},
+				env:  []string{"CLAUDER_NOTIFY_TITLE=" + title, "CLAUDER_NOTIFY_BODY=" + body},
+			}
+		},
+		run: runCommand,
+	}
+}
+
+// platformNotifier returns the notifier of goos, if its command is found
+// by lookPath.
+func platformNotifier(goos string, lookPath func(file string) (string, error)) (Notifier, error) {
+	var notifier *commandNotifier
+	switch goos {
+	case "darwin":
+		notifier = newMacOSNotifier()
+	case "linux", "freebsd", "openbsd", "netbsd":
+		notifier = newLinuxNotifier()
+	case "windows":
+		notifier = newWindowsNotifier()
+	default:
+		return nil, xerrors.Errorf("desktop notifications aren't supported on %s", goos)
+	}
+	name := notifier.build("", "").name
+	if _, err := lookPath(name); err != nil {
+		return nil, xerrors.Errorf("desktop notifications require %s: %w", name, err)
+	}
+	return notifier, nil
+}
+
+// PlatformNotifier returns the notifier of the operating system: osascript
+// on macOS, notify-send on Linux and the BSDs, and PowerShell on Windows.
+// It returns an error if the command isn't installed.
+func PlatformNotifier() (Notifier, error) {
+	return platformNotifier(runtime.GOOS, exec.LookPath)
+}
@@ -0,0 +1,101 @@
+package notify
+
+import (
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+)
+
+// record replaces the command runner of n, and returns the commands it
+// was asked to run.
+func record(n *commandNotifier) *[]command {
+	var commands []command
+	n.run = func(cmd command) error {
+		commands = append(commands, cmd)
+		return nil
+	}
+	return &commands
+}
+
+func TestNotifiers(t *testing.T) {
+	// quotes and leading dashes are passed as is
+	title, body := `Agent "claude" finished`, `-took 1m30s; it's done`
+	for _, tc := range []struct {
+		name     string
+		notifier *commandNotifier
+		expected command
+	}{
+		{
+			name:     "macOS",
+			notifier: newMacOSNotifier(),
+			expected: command{name: "osascript", args: []string{
+				"-e", "on run argv",
+				"-e", "display notification (item 2 of argv) with title (item 1 of argv)",
+				"-e", "end run",
+				title, body,
+			}},
+		},
+		{
+			name:     "Linux",
+			notifier: newLinuxNotifier(),
+			expected: command{name: "notify-send", args: []string{"--app-name=clauder", "--", title, body}},
+		},
+		{
+			name:     "Windows",
+			notifier: newWindowsNotifier(),
+			expected: command{
+				name: "powershell",
+				args: []string{"-NoProfile", "-NonInteractive", "-Command", windowsScript},
+				env:  []string{"CLAUDER_NOTIFY_TITLE=" + title, "CLAUDER_NOTIFY_BODY=" + body},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			commands := record(tc.notifier)
+			require.NoError(t, tc.notifier.Notify(title, body))
+			assert.Equal(t, []command{tc.expected}, *commands)
+		})
+	}
+}
+
+func TestNotifyError(t *testing.T) {
+	notifier := newLinuxNotifier()
+	notifier.run = func(cmd command) error {
+		return xerrors.New("no notification daemon")
+	}
+	assert.ErrorContains(t, notifier.Notify("title", "body"), "no notification daemon")
+}
+
+func TestPlatformNotifier(t *testing.T) {
+	var looked []string
+	found := func(file string) (string, error) {
+		looked = append(looked, file)
+		return "/usr/bin/" + file, nil
+	}
+	for goos, name := range map[string]string{
+		"darwin":  "osascript",
+		"linux":   "notify-send",
+		"freebsd": "notify-send",
+		"windows": "powershell",
+	} {
+		looked = nil
+		notifier, err := platformNotifier(goos, found)
+		require.NoError(t, err, goos)
+		commands := record(notifier.(*commandNotifier))
+		require.NoError(t, notifier.Notify("title", "body"))
+		assert.Equal(t, name, (*commands)[0].name, goos)
+		assert.Equal(t, []string{name}, looked, goos)
+	}
+
+	_, err := platformNotifier("plan9", found)
+	assert.ErrorContains(t, err, "aren't supported on plan9")
+
+	_, err = platformNotifier("linux", func(file string) (string, error) {
+		return "", exec.ErrNotFound
+	})
+	assert.ErrorIs(t, err, exec.ErrNotFound)
+	assert.ErrorContains(t, err, "require notify-send")
+}
@@ -0,0 +1,70 @@
+package project
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/xerrors"
+)
+
+// ErrNotGitRepository is returned by FindGitRoot when no parent directory
+// is a git repository.
+var ErrNotGitRepository = xerrors.New("not in a git repository")
+
+// FindGitRoot returns the first of startDir and its parents that contains
+// a .git directory. A .git file, which git creates in worktrees and
+// submodules, counts too.
+func FindGitRoot(startDir string) (string, error) {
+	dir, err := filepath.Abs(startDir)
+	if err != nil {
+		return "", xerrors.Errorf("failed to resolve %s: %w", startDir, err)
+	}
+	for {
+		_, err := os.Stat(filepath.Join(dir, ".git"))
+		if err == nil {
+			return dir, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", xerrors.Errorf("failed to check %s: %w", dir, err)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", ErrNotGitRepository
+		}
+		dir = parent
+	}
+}
+
+// WorkDir returns the directory the agent runs in. It's workdir if it's
+// set. Otherwise, it's the root of the git repository that cwd is in, or
+// cwd if it isn't in one, unless requireGitRoot is set. isGitRoot reports
+// whether the git root was used.
+func WorkDir(cwd, workdir string, requireGitRoot bool) (dir string, isGitRoot bool, err error) {
+	if workdir != "" {
+		if requireGitRoot {
+			return "", false, xerrors.Errorf("a working directory can't be set along with the git root")
+		}
+		dir, err := filepath.Abs(workdir)
+		if err != nil {
+			return "", false, xerrors.Errorf("failed to resolve %s: %w", workdir, err)
+		}
+		info, err := os.Stat(dir)
+		if err != nil {
+			return "", false, xerrors.Errorf("invalid working directory: %w", err)
+		}
+		if !info.IsDir() {
+			return "", false, xerrors.Errorf("invalid working directory: %s isn't a directory", dir)
+		}
+		return dir, false, nil
+	}
+	root, err := FindGitRoot(cwd)
+	if err == nil {
+		return root, true, nil
+	}
+	if requireGitRoot || !errors.Is(err, ErrNotGitRepository) {
+		return "", false, err
+	}
+	return cwd, false, nil
+}
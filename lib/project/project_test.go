@@ -0,0 +1,97 @@
+package project
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mkdirs creates the directories under root, and returns root's real path.
+func mkdirs(t *testing.T, root string, dirs ...string) string {
+	t.Helper()
+	for _, dir := range dirs {
+		require.NoError(t, os.MkdirAll(filepath.Join(root, dir), 0o755))
+	}
+	root, err := filepath.EvalSymlinks(root)
+	require.NoError(t, err)
+	return root
+}
+
+func TestFindGitRoot(t *testing.T) {
+	root := mkdirs(t, t.TempDir(), "repo/.git", "repo/a/b/c", "repo/nested/.git", "repo/nested/d")
+
+	for start, expected := range map[string]string{
+		"repo":          "repo",
+		"repo/.git":     "repo",
+		"repo/a":        "repo",
+		"repo/a/b/c":    "repo",
+		"repo/nested":   "repo/nested",
+		"repo/nested/d": "repo/nested",
+	} {
+		gitRoot, err := FindGitRoot(filepath.Join(root, start))
+		require.NoError(t, err, start)
+		assert.Equal(t, filepath.Join(root, expected), gitRoot, start)
+	}
+}
+
+func TestFindGitRootWorktree(t *testing.T) {
+	root := mkdirs(t, t.TempDir(), "worktree/src")
+	require.NoError(t, os.WriteFile(filepath.Join(root, "worktree", ".git"), []byte("gitdir: /repo/.git/worktrees/w\n"), 0o644))
+
+	gitRoot, err := FindGitRoot(filepath.Join(root, "worktree", "src"))
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(root, "worktree"), gitRoot)
+}
+
+func TestFindGitRootNotFound(t *testing.T) {
+	dir := mkdirs(t, t.TempDir(), "a/b")
+	if _, err := FindGitRoot(dir); err == nil {
+		t.Skip("the temporary directory is in a git repository")
+	}
+	_, err := FindGitRoot(filepath.Join(dir, "a", "b"))
+	assert.ErrorIs(t, err, ErrNotGitRepository)
+}
+
+func TestWorkDir(t *testing.T) {
+	root := mkdirs(t, t.TempDir(), "repo/.git", "repo/sub", "other")
+	sub := filepath.Join(root, "repo", "sub")
+
+	dir, isGitRoot, err := WorkDir(sub, "", false)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(root, "repo"), dir)
+	assert.True(t, isGitRoot)
+
+	dir, isGitRoot, err = WorkDir(sub, "", true)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(root, "repo"), dir)
+	assert.True(t, isGitRoot)
+
+	// an explicit working directory wins
+	dir, isGitRoot, err = WorkDir(sub, sub, false)
+	require.NoError(t, err)
+	assert.Equal(t, sub, dir)
+	assert.False(t, isGitRoot)
+
+	_, _, err = WorkDir(sub, sub, true)
+	assert.Error(t, err)
+	_, _, err = WorkDir(sub, filepath.Join(root, "missing"), false)
+	assert.ErrorContains(t, err, "invalid working directory")
+	require.NoError(t, os.WriteFile(filepath.Join(root, "file"), nil, 0o644))
+	_, _, err = WorkDir(sub, filepath.Join(root, "file"), false)
+	assert.ErrorContains(t, err, "isn't a directory")
+
+	other := filepath.Join(root, "other")
+	if _, err := FindGitRoot(other); err == nil {
+		t.Skip("the temporary directory is in a git repository")
+	}
+	dir, isGitRoot, err = WorkDir(other, "", false)
+	require.NoError(t, err)
+	assert.Equal(t, other, dir)
+	assert.False(t, isGitRoot)
+
+	_, _, err = WorkDir(other, "", true)
+	assert.ErrorIs(t, err, ErrNotGitRepository)
+}
@@ -0,0 +1,502 @@
+// Package qrcode encodes data as QR codes, so that links can be shown in a
+// terminal and scanned with a phone. It only implements what that needs:
+// byte mode, error correction level L and versions 1 to 10, which hold up
+// to 271 bytes.
+package qrcode
+
+import (
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// QRCode is a square grid of modules. Dark modules are true.
+type QRCode struct {
+	Version int
+	Size    int
+	modules [][]bool
+	// function marks the modules that aren't data, like the finder
+	// patterns, which masks don't apply to.
+	function [][]bool
+}
+
+// Dark reports whether the module at column x and row y is dark.
+func (q *QRCode) Dark(x, y int) bool {
+	return q.modules[y][x]
+}
+
+// versionInfo is the error correction layout of a version at level L.
+type versionInfo struct {
+	ecCodewords int
+	// blocks holds the number of data codewords of each block.
+	blocks []int
+	// alignment holds the center coordinates of the alignment patterns.
+	alignment []int
+}
+
+var versions = []versionInfo{
+	1:  {7, []int{19}, nil},
+	2:  {10, []int{34}, []int{6, 18}},
+	3:  {15, []int{55}, []int{6, 22}},
+	4:  {20, []int{80}, []int{6, 26}},
+	5:  {26, []int{108}, []int{6, 30}},
+	6:  {18, []int{68, 68}, []int{6, 34}},
+	7:  {20, []int{78, 78}, []int{6, 22, 38}},
+	8:  {24, []int{97, 97}, []int{6, 24, 42}},
+	9:  {30, []int{116, 116}, []int{6, 26, 46}},
+	10: {18, []int{68, 68, 69, 69}, []int{6, 28, 50}},
+}
+
+// MaxVersion is the largest version Encode creates.
+const MaxVersion = 10
+
+func (v versionInfo) dataCodewords() int {
+	n := 0
+	for _, block := range v.blocks {
+		n += block
+	}
+	return n
+}
+
+// charCountBits is the length of the byte mode character count.
+func charCountBits(version int) int {
+	if version < 10 {
+		return 8
+	}
+	return 16
+}
+
+// Encode returns the smallest QR code that holds data.
+func Encode(data []byte) (*QRCode, error) {
+	for version := 1; version <= MaxVersion; version++ {
+		capacity := (versions[version].dataCodewords()*8 - 4 - charCountBits(version)) / 8
+		if len(data) <= capacity {
+			q := newQRCode(version)
+			q.drawCodewords(interleave(version, encodeData(version, data)))
+			q.applyBestMask()
+			return q, nil
+		}
+	}
+	return nil, xerrors.Errorf("%d bytes don't fit in a QR code", len(data))
+}
+
+// bitBuffer appends bits, most significant first.
+type bitBuffer []bool
+
+func (b *bitBuffer) append(value, length int) {
+	for i := length - 1; i >= 0; i-- {
+		*b = append(*b, value>>i&1 == 1)
+	}
+}
+
+// encodeData returns the data codewords of a version, which are the data in
+// byte mode, padded to the capacity of the version.
+func encodeData(version int, data []byte) []byte {
+	capacity := versions[version].dataCodewords() * 8
+	var bits bitBuffer
+	bits.append(0b0100, 4)
+	bits.append(len(data), charCountBits(version))
+	for _, b := range data {
+		bits.append(int(b), 8)
+	}
+	bits.append(0, min(4, capacity-len(bits)))
+	bits.append(0, (8-len(bits)%8)%8)
+	codewords := make([]byte, len(bits)/8, capacity/8)
+	for i, bit := range bits {
+		if bit {
+			codewords[i/8] |= 1 << (7 - i%8)
+		}
+	}
+	for pad := byte(0xEC); len(codewords) < cap(codewords); pad ^= 0xEC ^ 0x11 {
+		codewords = append(codewords, pad)
+	}
+	return codewords
+}
+
+// interleave splits the data codewords into blocks, adds the error
+// correction codewords of each block, and interleaves them.
+func interleave(version int, data []byte) []byte {
+	info := versions[version]
+	var blocks, ecBlocks [][]byte
+	for _, n := range info.blocks {
+		blocks = append(blocks, data[:n])
+		ecBlocks = append(ecBlocks, reedSolomon(data[:n], info.ecCodewords))
+		data = data[n:]
+	}
+	var result []byte
+	for i := 0; i < info.blocks[len(info.blocks)-1]; i++ {
+		for _, block := range blocks {
+			if i < len(block) {
+				result = append(result, block[i])
+			}
+		}
+	}
+	for i := 0; i < info.ecCodewords; i++ {
+		for _, block := range ecBlocks {
+			result = append(result, block[i])
+		}
+	}
+	return result
+}
+
+// gfExp and gfLog are the exponent and logarithm tables of GF(256) with
+// the primitive polynomial x^8 + x^4 + x^3 + x^2 + 1.
+var gfExp, gfLog = func() (exp [512]byte, log [256]byte) {
+	x := 1
+	for i := 0; i < 255; i++ {
+		exp[i] = byte(x)
+		log[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11D
+		}
+	}
+	for i := 255; i < 512; i++ {
+		exp[i] = exp[i-255]
+	}
+	return exp, log
+}()
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+// reedSolomon returns the n error correction codewords of data.
+func reedSolomon(data []byte, n int) []byte {
+	// the generator polynomial is (x - a^0)(x - a^1)...(x - a^(n-1)),
+	// with the coefficients from the highest degree down, without the
+	// leading 1
+	generator := make([]byte, n)
+	generator[n-1] = 1
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			generator[j] = gfMul(generator[j], gfExp[i])
+			if j+1 < n {
+				generator[j] ^= generator[j+1]
+			}
+		}
+	}
+	remainder := make([]byte, n)
+	for _, b := range data {
+		factor := b ^ remainder[0]
+		copy(remainder, remainder[1:])
+		remainder[n-1] = 0
+		for i := range remainder {
+			remainder[i] ^= gfMul(generator[i], factor)
+		}
+	}
+	return remainder
+}
+
+// newQRCode returns a QR code of the given version with its function
+// patterns drawn.
+func newQRCode(version int) *QRCode {
+	size := version*4 + 17
+	q := &QRCode{Version: version, Size: size, modules: make([][]bool, size), function: make([][]bool, size)}
+	for i := range size {
+		q.modules[i] = make([]bool, size)
+		q.function[i] = make([]bool, size)
+	}
+	for i := range size {
+		q.setFunction(6, i, i%2 == 0)
+		q.setFunction(i, 6, i%2 == 0)
+	}
+	q.drawFinder(3, 3)
+	q.drawFinder(size-4, 3)
+	q.drawFinder(3, size-4)
+	alignment := versions[version].alignment
+	last := len(alignment) - 1
+	for i, y := range alignment {
+		for j, x := range alignment {
+			// the corners with finder patterns don't have alignment patterns
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			q.drawAlignment(x, y)
+		}
+	}
+	// reserve the format information, which depends on the mask
+	q.drawFormat(0)
+	q.drawVersion()
+	return q
+}
+
+func (q *QRCode) setFunction(x, y int, dark bool) {
+	q.modules[y][x] = dark
+	q.function[y][x] = true
+}
+
+// drawFinder draws a finder pattern and its separator around the center.
+func (q *QRCode) drawFinder(cx, cy int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			x, y := cx+dx, cy+dy
+			if x < 0 || x >= q.Size || y < 0 || y >= q.Size {
+				continue
+			}
+			dist := max(abs(dx), abs(dy))
+			q.setFunction(x, y, dist != 2 && dist != 4)
+		}
+	}
+}
+
+func (q *QRCode) drawAlignment(cx, cy int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			q.setFunction(cx+dx, cy+dy, max(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+// formatBits returns the format information of level L with the mask:
+// the level and the mask, followed by their BCH code, masked.
+func formatBits(mask int) int {
+	data := 0b01<<3 | mask
+	rem := data
+	for range 10 {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	return (data<<10 | rem) ^ 0x5412
+}
+
+// drawFormat draws both copies of the format information, and the dark
+// module next to the bottom left finder pattern.
+func (q *QRCode) drawFormat(mask int) {
+	bits := formatBits(mask)
+	bit := func(i int) bool { return bits>>i&1 == 1 }
+	for i := 0; i <= 5; i++ {
+		q.setFunction(8, i, bit(i))
+	}
+	q.setFunction(8, 7, bit(6))
+	q.setFunction(8, 8, bit(7))
+	q.setFunction(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		q.setFunction(14-i, 8, bit(i))
+	}
+	for i := 0; i < 8; i++ {
+		q.setFunction(q.Size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		q.setFunction(8, q.Size-15+i, bit(i))
+	}
+	q.setFunction(8, q.Size-8, true)
+}
+
+// versionBits returns the version information: the version followed by
+// its BCH code.
+func versionBits(version int) int {
+	rem := version
+	for range 12 {
+		rem = rem<<1 ^ (rem>>11)*0x1F25
+	}
+	return version<<12 | rem
+}
+
+// drawVersion draws both copies of the version information, which only
+// versions 7 and up have.
+func (q *QRCode) drawVersion() {
+	if q.Version < 7 {
+		return
+	}
+	bits := versionBits(q.Version)
+	for i := range 18 {
+		dark := bits>>i&1 == 1
+		a, b := q.Size-11+i%3, i/3
+		q.setFunction(a, b, dark)
+		q.setFunction(b, a, dark)
+	}
+}
+
+// drawCodewords places the codewords in the modules that aren't function
+// modules, in two module wide columns that zigzag up and down from the
+// bottom right corner. The remaining modules stay light.
+func (q *QRCode) drawCodewords(codewords []byte) {
+	i := 0
+	for right := q.Size - 1; right >= 1; right -= 2 {
+		// the vertical timing pattern is skipped
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := range q.Size {
+			y := vert
+			if upward {
+				y = q.Size - 1 - vert
+			}
+			for j := range 2 {
+				x := right - j
+				if q.function[y][x] || i >= len(codewords)*8 {
+					continue
+				}
+				q.modules[y][x] = codewords[i/8]>>(7-i%8)&1 == 1
+				i++
+			}
+		}
+	}
+}
+
+// masked reports whether mask inverts the module at column x and row y.
+func masked(mask, x, y int) bool {
+	switch mask {
+	case 0:
+		return (x+y)%2 == 0
+	case 1:
+		return y%2 == 0
+	case 2:
+		return x%3 == 0
+	case 3:
+		return (x+y)%3 == 0
+	case 4:
+		return (x/3+y/2)%2 == 0
+	case 5:
+		return x*y%2+x*y%3 == 0
+	case 6:
+		return (x*y%2+x*y%3)%2 == 0
+	default:
+		return ((x+y)%2+x*y%3)%2 == 0
+	}
+}
+
+// applyMask inverts the data modules selected by mask. Applying it twice
+// undoes it.
+func (q *QRCode) applyMask(mask int) {
+	for y := range q.Size {
+		for x := range q.Size {
+			if !q.function[y][x] && masked(mask, x, y) {
+				q.modules[y][x] = !q.modules[y][x]
+			}
+		}
+	}
+}
+
+// applyBestMask applies the mask with the lowest penalty, which makes the
+// code easier to scan.
+func (q *QRCode) applyBestMask() {
+	best, bestPenalty := 0, -1
+	for mask := range 8 {
+		q.applyMask(mask)
+		q.drawFormat(mask)
+		if penalty := q.penalty(); bestPenalty == -1 || penalty < bestPenalty {
+			best, bestPenalty = mask, penalty
+		}
+		q.applyMask(mask)
+	}
+	q.applyMask(best)
+	q.drawFormat(best)
+}
+
+// penalty scores the modules with the rules of ISO/IEC 18004 section
+// 7.8.3. Lower is better.
+func (q *QRCode) penalty() int {
+	penalty := 0
+	finderLike := [][]bool{
+		{true, false, true, true, true, false, true, false, false, false, false},
+		{false, false, false, false, true, false, true, true, true, false, true},
+	}
+	for _, column := range []bool{false, true} {
+		for i := range q.Size {
+			line := make([]bool, q.Size)
+			for j := range q.Size {
+				if column {
+					line[j] = q.modules[j][i]
+				} else {
+					line[j] = q.modules[i][j]
+				}
+			}
+			// runs of five or more modules of the same color
+			run := 1
+			for j := 1; j <= q.Size; j++ {
+				if j < q.Size && line[j] == line[j-1] {
+					run++
+					continue
+				}
+				if run >= 5 {
+					penalty += 3 + run - 5
+				}
+				run = 1
+			}
+			// patterns that look like finder patterns
+			for j := 0; j+11 <= q.Size; j++ {
+				for _, pattern := range finderLike {
+					if equal(line[j:j+11], pattern) {
+						penalty += 40
+					}
+				}
+			}
+		}
+	}
+	dark := 0
+	for y := range q.Size {
+		for x := range q.Size {
+			if q.modules[y][x] {
+				dark++
+			}
+			// 2x2 blocks of the same color
+			if x+1 < q.Size && y+1 < q.Size {
+				c := q.modules[y][x]
+				if q.modules[y][x+1] == c && q.modules[y+1][x] == c && q.modules[y+1][x+1] == c {
+					penalty += 3
+				}
+			}
+		}
+	}
+	// the proportion of dark modules, in steps of 5% away from 50%
+	percent := dark * 100 / (q.Size * q.Size)
+	penalty += abs(percent-50) / 5 * 10
+	return penalty
+}
+
+func equal(a, b []bool) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// quietZone is the width of the light border around the code, in modules.
+// The standard asks for 4, but 2 is enough for phones and saves space.
+const quietZone = 2
+
+// String renders the code with Unicode half blocks, two rows of modules
+// per line. Light modules are drawn, so that the code is scannable on a
+// terminal with a dark background.
+func (q *QRCode) String() string {
+	light := func(x, y int) bool {
+		x, y = x-quietZone, y-quietZone
+		if x < 0 || y < 0 || x >= q.Size || y >= q.Size {
+			return true
+		}
+		return !q.modules[y][x]
+	}
+	size := q.Size + 2*quietZone
+	var sb strings.Builder
+	for y := 0; y < size; y += 2 {
+		for x := range size {
+			top, bottom := light(x, y), y+1 < size && light(x, y+1)
+			switch {
+			case top && bottom:
+				sb.WriteString("█")
+			case top:
+				sb.WriteString("▀")
+			case bottom:
+				sb.WriteString("▄")
+			default:
+				sb.WriteString(" ")
+			}
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
@@ -0,0 +1,182 @@
+package qrcode
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReedSolomon(t *testing.T) {
+	// "HELLO WORLD" as version 1-M, from https://www.thonky.com/qr-code-tutorial/
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	assert.Equal(t, []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}, reedSolomon(data, 10))
+}
+
+func TestFormatAndVersionBits(t *testing.T) {
+	// from the format and version information tables of ISO/IEC 18004
+	for mask, want := range []string{
+		"111011111000100", "111001011110011", "111110110101010", "111100010011101",
+		"110011000101111", "110001100011000", "110110001000001", "110100101110110",
+	} {
+		assert.Equal(t, want, fmt.Sprintf("%015b", formatBits(mask)), "mask %d", mask)
+	}
+	assert.Equal(t, "000111110010010100", fmt.Sprintf("%018b", versionBits(7)))
+	assert.Equal(t, "001010010011010011", fmt.Sprintf("%018b", versionBits(10)))
+}
+
+func TestVersions(t *testing.T) {
+	// the number of data modules of each version, including the remainder
+	// bits, from ISO/IEC 18004 table 1
+	dataModules := []int{1: 208, 2: 359, 3: 567, 4: 807, 5: 1079, 6: 1383, 7: 1568, 8: 1936, 9: 2336, 10: 2768}
+	for version := 1; version <= MaxVersion; version++ {
+		q := newQRCode(version)
+		modules := 0
+		for y := range q.Size {
+			for x := range q.Size {
+				if !q.function[y][x] {
+					modules++
+				}
+			}
+		}
+		assert.Equal(t, dataModules[version], modules, "version %d", version)
+		info := versions[version]
+		assert.Equal(t, dataModules[version]/8, info.dataCodewords()+len(info.blocks)*info.ecCodewords, "version %d", version)
+	}
+}
+
+// decode reads the data back from a QR code made by Encode.
+func decode(t *testing.T, q *QRCode) []byte {
+	t.Helper()
+	// read the mask from the first copy of the format information
+	format := 0
+	for i := 0; i <= 5; i++ {
+		format |= b2i(q.Dark(8, i)) << i
+	}
+	format |= b2i(q.Dark(8, 7))<<6 | b2i(q.Dark(8, 8))<<7 | b2i(q.Dark(7, 8))<<8
+	for i := 9; i < 15; i++ {
+		format |= b2i(q.Dark(14-i, 8)) << i
+	}
+	mask := -1
+	for m := range 8 {
+		if formatBits(m) == format {
+			mask = m
+		}
+	}
+	require.NotEqual(t, -1, mask, "invalid format information %015b", format)
+
+	// read the codewords in placement order
+	info := versions[q.Version]
+	total := info.dataCodewords() + len(info.blocks)*info.ecCodewords
+	codewords := make([]byte, total)
+	i := 0
+	for right := q.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := range q.Size {
+			y := vert
+			if (right+1)&2 == 0 {
+				y = q.Size - 1 - vert
+			}
+			for j := range 2 {
+				x := right - j
+				if q.function[y][x] || i >= total*8 {
+					continue
+				}
+				if q.Dark(x, y) != masked(mask, x, y) {
+					codewords[i/8] |= 1 << (7 - i%8)
+				}
+				i++
+			}
+		}
+	}
+
+	// deinterleave the data codewords, and check the error correction
+	blocks := make([][]byte, len(info.blocks))
+	k := 0
+	for i := 0; i < info.blocks[len(info.blocks)-1]; i++ {
+		for b, n := range info.blocks {
+			if i < n {
+				blocks[b] = append(blocks[b], codewords[k])
+				k++
+			}
+		}
+	}
+	for i := 0; i < info.ecCodewords; i++ {
+		for b := range blocks {
+			assert.Equal(t, reedSolomon(blocks[b], info.ecCodewords)[i], codewords[k], "block %d", b)
+			k++
+		}
+	}
+	var data []byte
+	for _, block := range blocks {
+		data = append(data, block...)
+	}
+
+	// parse the byte mode segment
+	bit := func(n int) bool { return data[n/8]>>(7-n%8)&1 == 1 }
+	read := func(pos, length int) int {
+		v := 0
+		for n := range length {
+			v = v<<1 | b2i(bit(pos+n))
+		}
+		return v
+	}
+	require.Equal(t, 0b0100, read(0, 4), "byte mode")
+	length := read(4, charCountBits(q.Version))
+	result := make([]byte, length)
+	for n := range length {
+		result[n] = byte(read(4+charCountBits(q.Version)+8*n, 8))
+	}
+	return result
+}
+
+func b2i(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func TestEncode(t *testing.T) {
+	for _, data := range []string{
+		"",
+		"hello",
+		"clauderapp://session?tunnel=https%3A%2F%2Fabc123.lhr.life&token=1735689600.c2lnbmF0dXJl&passcode=ABC234",
+		strings.Repeat("x", 154),
+		strings.Repeat("y", 271),
+	} {
+		q, err := Encode([]byte(data))
+		require.NoError(t, err)
+		assert.Equal(t, 17+4*q.Version, q.Size)
+		assert.Equal(t, data, string(decode(t, q)), "version %d", q.Version)
+		// the timing patterns alternate, and the dark module is set
+		for i := 8; i < q.Size-8; i++ {
+			assert.Equal(t, i%2 == 0, q.Dark(i, 6))
+			assert.Equal(t, i%2 == 0, q.Dark(6, i))
+		}
+		assert.True(t, q.Dark(8, q.Size-8))
+	}
+
+	q, err := Encode([]byte(strings.Repeat("x", 154)))
+	require.NoError(t, err)
+	assert.Equal(t, 7, q.Version, "the smallest version that fits is used")
+
+	_, err = Encode([]byte(strings.Repeat("z", 272)))
+	assert.ErrorContains(t, err, "272 bytes don't fit in a QR code")
+}
+
+func TestString(t *testing.T) {
+	q, err := Encode([]byte("hi"))
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(q.String(), "\n"), "\n")
+	// 21 modules and the quiet zone on both sides, two rows per line
+	assert.Len(t, lines, 13)
+	assert.Equal(t, strings.Repeat("█", 25), lines[0])
+	// the top left finder pattern starts after the quiet zone: its top row
+	// is dark, and the row below is only dark on the sides
+	assert.True(t, strings.HasPrefix(lines[1], "██ ▄▄▄▄▄ █"), lines[1])
+}
@@ -0,0 +1,148 @@
+package screentracker
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/zohaibahmed/clauder/lib/msgfmt"
+)
+
+const (
+	// AutoResizeWindow is how long AutoResizer collects the lengths of the
+	// lines the agent prints before deciding whether to resize.
+	AutoResizeWindow = 10 * time.Second
+	// AutoResizeStep is the number of columns AutoResizer widens or narrows
+	// the terminal by at once.
+	AutoResizeStep = 20
+	// MinAutoResizeWidth and MaxAutoResizeWidth bound the widths
+	// AutoResizer picks. A terminal that's already wider or narrower isn't
+	// resized in that direction.
+	MinAutoResizeWidth = 40
+	MaxAutoResizeWidth = 300
+
+	// autoResizeWrapRatio is the share of lines that reach the width above
+	// which the agent's output is assumed to wrap.
+	autoResizeWrapRatio = 0.8
+	// autoResizeNarrowRatio is the share of lines that reach half the width
+	// below which most of the width is assumed to be unused.
+	autoResizeNarrowRatio = 0.4
+	// autoResizeMinLines is the number of lines needed to decide. A few
+	// lines don't tell how the agent uses the width.
+	autoResizeMinLines = 10
+)
+
+type lineLength struct {
+	at     time.Time
+	length int
+}
+
+// AutoResizer picks the width of the agent's terminal from the lengths of
+// the lines the agent prints. If more than 80% of the lines in the last
+// AutoResizeWindow fill the whole width, the agent is wrapping its output,
+// and the terminal is widened by AutoResizeStep columns. If fewer than 40%
+// reach half the width, it's narrowed by as much, so that the screen sent
+// to clients is smaller.
+//
+// Blank lines aren't counted, since they say nothing about the width the
+// agent needs.
+type AutoResizer struct {
+	mu      sync.Mutex
+	buf     []byte
+	width   int
+	lengths []lineLength
+	// now returns the current time. It's replaced in tests.
+	now func() time.Time
+}
+
+// NewAutoResizer creates a resizer for a terminal that's width columns
+// wide.
+func NewAutoResizer(width int) *AutoResizer {
+	return &AutoResizer{width: width, now: time.Now}
+}
+
+// Width returns the current width of the terminal.
+func (r *AutoResizer) Width() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.width
+}
+
+// Write implements io.Writer so the resizer can receive the process output.
+func (r *AutoResizer) Write(data []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := len(data)
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i == -1 {
+			r.buf = append(r.buf, data...)
+			// a line can't be longer than maxLineLength anyway
+			if len(r.buf) >= maxLineLength {
+				r.record()
+			}
+			break
+		}
+		r.buf = append(r.buf, data[:i]...)
+		r.record()
+		data = data[i+1:]
+	}
+	return n, nil
+}
+
+// Assumes the caller holds the lock.
+func (r *AutoResizer) record() {
+	line := strings.TrimRight(msgfmt.StripANSI(string(r.buf)), "\r")
+	r.buf = r.buf[:0]
+	if i := strings.LastIndexByte(line, '\r'); i != -1 {
+		line = line[i+1:]
+	}
+	line = strings.TrimRight(line, " \t")
+	if line == "" {
+		return
+	}
+	r.lengths = append(r.lengths, lineLength{at: r.now(), length: utf8.RuneCountInString(line)})
+}
+
+// Check decides whether to resize the terminal from the lines printed in
+// the last AutoResizeWindow, and returns the new width and true if it
+// should be. The lines measured at the old width are discarded then.
+func (r *AutoResizer) Check() (int, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cutoff := r.now().Add(-AutoResizeWindow)
+	i := 0
+	for i < len(r.lengths) && r.lengths[i].at.Before(cutoff) {
+		i++
+	}
+	r.lengths = r.lengths[i:]
+	if len(r.lengths) < autoResizeMinLines {
+		return r.width, false
+	}
+
+	var full, half int
+	for _, l := range r.lengths {
+		if l.length >= r.width {
+			full++
+		}
+		if l.length >= r.width/2 {
+			half++
+		}
+	}
+	total := float64(len(r.lengths))
+	width := r.width
+	switch {
+	case float64(full)/total > autoResizeWrapRatio:
+		width = max(r.width, min(r.width+AutoResizeStep, MaxAutoResizeWidth))
+	case float64(half)/total < autoResizeNarrowRatio:
+		width = min(r.width, max(r.width-AutoResizeStep, MinAutoResizeWidth))
+	}
+	if width == r.width {
+		return r.width, false
+	}
+	r.width = width
+	r.lengths = nil
+	return width, true
+}
@@ -0,0 +1,97 @@
+package screentracker
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestAutoResizer(width int) (*AutoResizer, *time.Time) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	r := NewAutoResizer(width)
+	r.now = func() time.Time { return now }
+	return r, &now
+}
+
+// printLines writes n lines of the given length, with ANSI escape sequences
+// that don't count towards it.
+func printLines(r *AutoResizer, n, length int) {
+	for range n {
+		fmt.Fprintf(r, "\x1b[32m%s\x1b[0m\r\n", strings.Repeat("x", length))
+	}
+}
+
+func TestAutoResizerWidens(t *testing.T) {
+	r, _ := newTestAutoResizer(120)
+	printLines(r, 9, 120)
+	_, resized := r.Check()
+	assert.False(t, resized, "only wrapped lines, but too few to decide")
+
+	printLines(r, 8, 120)
+	printLines(r, 2, 30)
+	width, resized := r.Check()
+	assert.True(t, resized)
+	assert.Equal(t, 140, width)
+	assert.Equal(t, 140, r.Width())
+
+	// the lines measured at the old width don't count anymore
+	printLines(r, 8, 120)
+	printLines(r, 2, 140)
+	_, resized = r.Check()
+	assert.False(t, resized)
+
+	// the width doesn't grow past the maximum
+	r, _ = newTestAutoResizer(MaxAutoResizeWidth - 10)
+	printLines(r, 20, MaxAutoResizeWidth)
+	width, resized = r.Check()
+	assert.True(t, resized)
+	assert.Equal(t, MaxAutoResizeWidth, width)
+	printLines(r, 20, MaxAutoResizeWidth)
+	_, resized = r.Check()
+	assert.False(t, resized)
+}
+
+func TestAutoResizerNarrows(t *testing.T) {
+	r, _ := newTestAutoResizer(120)
+	// 30% of the lines reach half the width
+	printLines(r, 3, 70)
+	printLines(r, 7, 20)
+	// blank lines don't count
+	fmt.Fprint(r, strings.Repeat("\r\n", 20))
+	width, resized := r.Check()
+	assert.True(t, resized)
+	assert.Equal(t, 100, width)
+
+	// 40% of the lines reach half the width
+	printLines(r, 4, 50)
+	printLines(r, 6, 20)
+	_, resized = r.Check()
+	assert.False(t, resized)
+
+	// the width doesn't shrink past the minimum
+	r, _ = newTestAutoResizer(MinAutoResizeWidth)
+	printLines(r, 20, 5)
+	_, resized = r.Check()
+	assert.False(t, resized)
+}
+
+func TestAutoResizerWindow(t *testing.T) {
+	r, now := newTestAutoResizer(120)
+	printLines(r, 20, 120)
+	*now = now.Add(AutoResizeWindow + time.Second)
+	// the wrapped lines are too old to count
+	printLines(r, 10, 80)
+	_, resized := r.Check()
+	assert.False(t, resized)
+
+	// a redrawn line counts as what it ends up showing
+	for range 10 {
+		fmt.Fprintf(r, "%s\r%s\n", strings.Repeat("x", 10), strings.Repeat("y", 120))
+	}
+	width, resized := r.Check()
+	assert.False(t, resized, "only half of the lines wrap")
+	assert.Equal(t, 120, width)
+}
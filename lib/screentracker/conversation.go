@@ -8,16 +8,12 @@ import (
 	"time"
 
 	"github.com/danielgtaylor/huma/v2"
+	"github.com/zohaibahmed/clauder/lib/events"
 	"github.com/zohaibahmed/clauder/lib/msgfmt"
 	"github.com/zohaibahmed/clauder/lib/util"
 	"golang.org/x/xerrors"
 )
 
-type screenSnapshot struct {
-	timestamp time.Time
-	screen    string
-}
-
 type AgentIO interface {
 	Write(data []byte) (int, error)
 	ReadScreen() string
@@ -40,6 +36,18 @@ type ConversationConfig struct {
 	// SkipSendMessageStatusCheck skips the check for whether the message can be sent.
 	// This is used in tests
 	SkipSendMessageStatusCheck bool
+	// ReadyPrompt, if set, is shown by the agent when it's waiting for user
+	// input. The screen is only considered stable once it contains it, for
+	// agents that can stop updating the screen while they're still working.
+	ReadyPrompt string
+	// Bus, if set, receives an events.TopicPTYOutput event with the screen
+	// every time the snapshot loop reads it.
+	Bus *events.EventBus
+	// SnapshotCompressionThreshold is how many of the most recent snapshots
+	// are kept uncompressed. The older ones are compressed to save memory.
+	// 0 uses DefaultSnapshotCompressionThreshold, and a negative value
+	// disables compression.
+	SnapshotCompressionThreshold int
 }
 
 type ConversationRole string
@@ -63,13 +71,17 @@ type ConversationMessage struct {
 	Message string
 	Role    ConversationRole
 	Time    time.Time
+	// Keepalive is true for the messages sent by SendKeepalive, and the
+	// agent's responses to them. They aren't part of the conversation
+	// shown to users.
+	Keepalive bool
 }
 
 type Conversation struct {
 	cfg ConversationConfig
 	// How many stable snapshots are required to consider the screen stable
 	stableSnapshotsThreshold    int
-	snapshotBuffer              *RingBuffer[screenSnapshot]
+	snapshotBuffer              *snapshotHistory
 	messages                    []ConversationMessage
 	screenBeforeLastUserMessage string
 	lock                        sync.Mutex
@@ -98,7 +110,7 @@ func NewConversation(ctx context.Context, cfg ConversationConfig) *Conversation
 	c := &Conversation{
 		cfg:                      cfg,
 		stableSnapshotsThreshold: threshold,
-		snapshotBuffer:           NewRingBuffer[screenSnapshot](threshold),
+		snapshotBuffer:           newSnapshotHistory(threshold, cfg.SnapshotCompressionThreshold),
 		messages: []ConversationMessage{
 			{
 				Message: "",
@@ -128,6 +140,9 @@ func (c *Conversation) StartSnapshotLoop(ctx context.Context) {
 				screen := c.cfg.AgentIO.ReadScreen()
 				c.addSnapshotInner(screen)
 				c.lock.Unlock()
+				if c.cfg.Bus != nil {
+					c.cfg.Bus.Publish(events.TopicPTYOutput, screen)
+				}
 			}
 		}
 	}()
@@ -189,26 +204,35 @@ func (c *Conversation) updateLastAgentMessage(screen string, timestamp time.Time
 		return
 	}
 	conversationMessage := ConversationMessage{
-		Message: agentMessage,
-		Role:    ConversationRoleAgent,
-		Time:    timestamp,
+		Message:   agentMessage,
+		Role:      ConversationRoleAgent,
+		Time:      timestamp,
+		Keepalive: lastUserMessage.Keepalive,
 	}
 	if shouldCreateNewMessage {
+		conversationMessage.Id = c.nextMessageId()
 		c.messages = append(c.messages, conversationMessage)
 	} else {
+		conversationMessage.Id = c.messages[len(c.messages)-1].Id
 		c.messages[len(c.messages)-1] = conversationMessage
 	}
-	c.messages[len(c.messages)-1].Id = len(c.messages) - 1
+}
+
+// nextMessageId returns the id of the next message. Ids keep increasing
+// when old messages are trimmed, so they don't always match the index.
+// This function assumes that the caller holds the lock
+func (c *Conversation) nextMessageId() int {
+	if len(c.messages) == 0 {
+		return 0
+	}
+	return c.messages[len(c.messages)-1].Id + 1
 }
 
 // assumes the caller holds the lock
 func (c *Conversation) addSnapshotInner(screen string) {
-	snapshot := screenSnapshot{
-		timestamp: c.cfg.GetTime(),
-		screen:    screen,
-	}
-	c.snapshotBuffer.Add(snapshot)
-	c.updateLastAgentMessage(screen, snapshot.timestamp)
+	timestamp := c.cfg.GetTime()
+	c.snapshotBuffer.Add(timestamp, screen)
+	c.updateLastAgentMessage(screen, timestamp)
 }
 
 func (c *Conversation) AddSnapshot(screen string) {
@@ -318,6 +342,16 @@ var MessageValidationErrorEmpty = xerrors.New("message must not be empty")
 var MessageValidationErrorChanging = xerrors.New("message can only be sent when the agent is waiting for user input")
 
 func (c *Conversation) SendMessage(messageParts ...MessagePart) error {
+	return c.sendMessage(false, messageParts...)
+}
+
+// SendKeepalive sends a message that only keeps the agent's session alive.
+// The message and the agent's response to it are marked as Keepalive.
+func (c *Conversation) SendKeepalive(messageParts ...MessagePart) error {
+	return c.sendMessage(true, messageParts...)
+}
+
+func (c *Conversation) sendMessage(keepalive bool, messageParts ...MessagePart) error {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 
@@ -345,10 +379,11 @@ func (c *Conversation) SendMessage(messageParts ...MessagePart) error {
 
 	c.screenBeforeLastUserMessage = screenBeforeMessage
 	c.messages = append(c.messages, ConversationMessage{
-		Id:      len(c.messages),
-		Message: message,
-		Role:    ConversationRoleUser,
-		Time:    now,
+		Id:        c.nextMessageId(),
+		Message:   message,
+		Role:      ConversationRoleUser,
+		Time:      now,
+		Keepalive: keepalive,
 	})
 	return nil
 }
@@ -375,11 +410,15 @@ func (c *Conversation) statusInner() ConversationStatus {
 		return ConversationStatusInitializing
 	}
 
+	firstScreen := snapshots[0].Screen()
 	for i := 1; i < len(snapshots); i++ {
-		if snapshots[0].screen != snapshots[i].screen {
+		if !snapshots[i].sameScreen(snapshots[0], firstScreen) {
 			return ConversationStatusChanging
 		}
 	}
+	if c.cfg.ReadyPrompt != "" && !strings.Contains(firstScreen, c.cfg.ReadyPrompt) {
+		return ConversationStatusChanging
+	}
 	return ConversationStatusStable
 }
 
@@ -399,6 +438,32 @@ func (c *Conversation) Messages() []ConversationMessage {
 	return result
 }
 
+// TrimContext removes the oldest messages if the conversation, including the
+// pending message about to be sent, doesn't fit in the manager's context
+// window. It returns the number of removed messages and the estimated number
+// of tokens in the remaining ones. The last message is always kept.
+func (c *Conversation) TrimContext(manager *msgfmt.ContextManager, pending string) (int, int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	contents := make([]string, 0, len(c.messages)+1)
+	for _, message := range c.messages {
+		contents = append(contents, message.Message)
+	}
+	contents = append(contents, pending)
+	removed, tokens := manager.Trim(contents)
+	if removed > 0 && removed == len(c.messages) {
+		// the agent's last message is updated in place, so it must be kept
+		removed--
+		tokens += msgfmt.EstimateTokens(c.messages[removed].Message)
+	}
+	if removed == 0 {
+		return 0, tokens
+	}
+	c.messages = append([]ConversationMessage(nil), c.messages[removed:]...)
+	return removed, tokens
+}
+
 func (c *Conversation) Screen() string {
 	c.lock.Lock()
 	defer c.lock.Unlock()
@@ -407,5 +472,14 @@ func (c *Conversation) Screen() string {
 	if len(snapshots) == 0 {
 		return ""
 	}
-	return snapshots[len(snapshots)-1].screen
+	return snapshots[len(snapshots)-1].Screen()
+}
+
+// SnapshotMemory returns the memory used by the snapshots kept to check
+// whether the screen is stable.
+func (c *Conversation) SnapshotMemory() SnapshotMemory {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.snapshotBuffer.memory()
 }
@@ -9,7 +9,10 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
+	"github.com/zohaibahmed/clauder/lib/events"
+	"github.com/zohaibahmed/clauder/lib/msgfmt"
 	st "github.com/zohaibahmed/clauder/lib/screentracker"
 )
 
@@ -112,6 +115,44 @@ func TestConversation(t *testing.T) {
 			{snapshot: "2", status: stable},
 		},
 	})
+
+	// only the latest snapshot is uncompressed
+	statusTest(t, statusTestParams{
+		cfg: st.ConversationConfig{
+			SnapshotInterval:             6 * time.Second,
+			ScreenStabilityLength:        14 * time.Second,
+			SnapshotCompressionThreshold: 1,
+			// stability threshold: 4
+		},
+		steps: []statusTestStep{
+			{snapshot: "1", status: initializing},
+			{snapshot: "1", status: initializing},
+			{snapshot: "1", status: initializing},
+			{snapshot: "1", status: stable},
+			{snapshot: "1", status: stable},
+			{snapshot: "2", status: changing},
+			{snapshot: "1", status: changing},
+			{snapshot: "1", status: changing},
+			{snapshot: "1", status: changing},
+			{snapshot: "1", status: stable},
+		},
+	})
+
+	// the screen is only stable once the ready prompt is shown
+	statusTest(t, statusTestParams{
+		cfg: st.ConversationConfig{
+			SnapshotInterval:      1 * time.Second,
+			ScreenStabilityLength: 1 * time.Second,
+			ReadyPrompt:           msgfmt.GeminiReadyPrompt,
+			// stability threshold: 2
+		},
+		steps: []statusTestStep{
+			{snapshot: "⠏ Thinking...", status: initializing},
+			{snapshot: "⠏ Thinking...", status: changing},
+			{snapshot: "│ gemini>   │", status: changing},
+			{snapshot: "│ gemini>   │", status: stable},
+		},
+	})
 }
 
 func TestMessages(t *testing.T) {
@@ -257,6 +298,33 @@ func TestMessages(t *testing.T) {
 		assert.Equal(t, st.ConversationStatusStable, c.Status())
 	})
 
+	t.Run("keepalive messages", func(t *testing.T) {
+		agent := &testAgent{}
+		c := newConversation(func(cfg *st.ConversationConfig) {
+			cfg.AgentIO = agent
+		})
+		keepalive := func(msg st.ConversationMessage) st.ConversationMessage {
+			msg.Keepalive = true
+			return msg
+		}
+		c.AddSnapshot("1")
+		agent.screen = "1"
+		assert.NoError(t, c.SendKeepalive(st.MessagePartText{Content: "."}))
+		// the response to a keepalive is marked too, even once it's updated
+		// before the next message
+		c.AddSnapshot("1\n2")
+		agent.screen = "1\n2x"
+		assert.NoError(t, sendMsg(c, "3"))
+		c.AddSnapshot("1\n2x\n4")
+		assert.Equal(t, []st.ConversationMessage{
+			agentMsg(0, "1"),
+			keepalive(userMsg(1, ".")),
+			keepalive(agentMsg(2, "2x")),
+			userMsg(3, "3"),
+			agentMsg(4, "4"),
+		}, c.Messages())
+	})
+
 	t.Run("tracking messages overlap", func(t *testing.T) {
 		agent := &testAgent{}
 		c := newConversation(func(cfg *st.ConversationConfig) {
@@ -347,11 +415,79 @@ func TestMessages(t *testing.T) {
 		c := newConversation()
 		assert.Error(t, sendMsg(c, ""), st.MessageValidationErrorEmpty)
 	})
+
+	t.Run("trim-context", func(t *testing.T) {
+		agent := &testAgent{}
+		c := newConversation(func(cfg *st.ConversationConfig) {
+			cfg.AgentIO = agent
+		})
+		// every message is 10 tokens
+		message := func(i int) string {
+			return fmt.Sprintf("%040d", i)
+		}
+		for i := 0; i < 10; i += 2 {
+			agent.screen = message(i)
+			c.AddSnapshot(agent.screen)
+			assert.NoError(t, sendMsg(c, message(i+1)))
+		}
+		agent.screen = message(10)
+		c.AddSnapshot(agent.screen)
+		require.Len(t, c.Messages(), 11)
+
+		// 120 tokens including the pending message
+		manager := msgfmt.NewContextManager(100)
+		removed, tokens := c.TrimContext(manager, message(11))
+		assert.Equal(t, 4, removed)
+		assert.Equal(t, 80, tokens)
+		messages := c.Messages()
+		require.Len(t, messages, 7)
+		// ids don't change when messages are trimmed
+		assert.Equal(t, agentMsg(4, message(4)), messages[0])
+		assert.Equal(t, agentMsg(10, message(10)), messages[6])
+
+		removed, _ = c.TrimContext(manager, message(11))
+		assert.Equal(t, 0, removed)
+
+		assert.NoError(t, sendMsg(c, message(11)))
+		agent.screen = message(12)
+		c.AddSnapshot(agent.screen)
+		messages = c.Messages()
+		assert.Equal(t, userMsg(11, message(11)), messages[len(messages)-2])
+		assert.Equal(t, agentMsg(12, message(12)), messages[len(messages)-1])
+
+		// the last message is kept even if it doesn't fit on its own
+		removed, tokens = c.TrimContext(msgfmt.NewContextManager(10), "")
+		assert.Equal(t, len(messages)-1, removed)
+		assert.Equal(t, 10, tokens)
+		assert.Equal(t, []st.ConversationMessage{agentMsg(12, message(12))}, c.Messages())
+	})
 }
 
 //go:embed testdata
 var testdataDir embed.FS
 
+func TestSnapshotLoopPublishesScreen(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bus := events.NewEventBus(16)
+	screens := bus.Subscribe(events.TopicPTYOutput)
+	c := st.NewConversation(ctx, st.ConversationConfig{
+		AgentIO:               &testAgent{screen: "$ clauder"},
+		GetTime:               time.Now,
+		SnapshotInterval:      time.Millisecond,
+		ScreenStabilityLength: 2 * time.Millisecond,
+		Bus:                   bus,
+	})
+	c.StartSnapshotLoop(ctx)
+
+	select {
+	case screen := <-screens:
+		assert.Equal(t, "$ clauder", screen)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the screen to be published")
+	}
+}
+
 func TestFindNewMessage(t *testing.T) {
 	assert.Equal(t, "", st.FindNewMessage("123456", "123456"))
 	assert.Equal(t, "1234567", st.FindNewMessage("123456", "1234567"))
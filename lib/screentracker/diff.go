@@ -0,0 +1,73 @@
+package screentracker
+
+import (
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	// DiffOpSet replaces the line at DiffOp.Line with DiffOp.Content, or
+	// appends it if the line is right after the last one.
+	DiffOpSet = "set"
+	// DiffOpTruncate removes the lines from DiffOp.Line onwards.
+	DiffOpTruncate = "truncate"
+)
+
+// DiffOp is a change to a single line of the screen. Lines are numbered
+// from 0.
+type DiffOp struct {
+	Op      string `json:"op" enum:"set,truncate" doc:"'set' replaces the line, or appends it if it's right after the last line. 'truncate' removes the line and all the lines after it."`
+	Line    int    `json:"line" doc:"Line number, starting at 0"`
+	Content string `json:"content,omitempty" doc:"New content of the line. Only set for 'set' operations."`
+}
+
+// TerminalDiff holds the changes that turn a screen into the next one.
+type TerminalDiff struct {
+	Ops []DiffOp `json:"ops" nullable:"false" doc:"Changes to apply in order"`
+}
+
+// DiffScreens compares two screens line by line, and returns the changes
+// that turn oldScreen into newScreen.
+func DiffScreens(oldScreen, newScreen string) TerminalDiff {
+	oldLines := strings.Split(oldScreen, "\n")
+	newLines := strings.Split(newScreen, "\n")
+	diff := TerminalDiff{Ops: []DiffOp{}}
+	if len(newLines) < len(oldLines) {
+		diff.Ops = append(diff.Ops, DiffOp{Op: DiffOpTruncate, Line: len(newLines)})
+	}
+	for i, line := range newLines {
+		if i < len(oldLines) && oldLines[i] == line {
+			continue
+		}
+		diff.Ops = append(diff.Ops, DiffOp{Op: DiffOpSet, Line: i, Content: line})
+	}
+	return diff
+}
+
+// ApplyDiff returns the screen with the diff's changes applied.
+func ApplyDiff(screen string, diff TerminalDiff) (string, error) {
+	lines := strings.Split(screen, "\n")
+	for _, op := range diff.Ops {
+		switch op.Op {
+		case DiffOpSet:
+			if op.Line < 0 || op.Line > len(lines) {
+				return "", xerrors.Errorf("cannot set line %d of a screen with %d lines", op.Line, len(lines))
+			}
+			if op.Line == len(lines) {
+				lines = append(lines, op.Content)
+			} else {
+				lines[op.Line] = op.Content
+			}
+		case DiffOpTruncate:
+			// a screen always has at least one line, even if it's empty
+			if op.Line < 1 || op.Line > len(lines) {
+				return "", xerrors.Errorf("cannot truncate a screen with %d lines to %d lines", len(lines), op.Line)
+			}
+			lines = lines[:op.Line]
+		default:
+			return "", xerrors.Errorf("unknown diff operation %q", op.Op)
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
@@ -0,0 +1,80 @@
+package screentracker_test
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	st "github.com/zohaibahmed/clauder/lib/screentracker"
+)
+
+func TestDiffScreens(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		old, new string
+		ops      []st.DiffOp
+	}{
+		{"unchanged", "a\nb", "a\nb", []st.DiffOp{}},
+		{"changed line", "a\nb\nc", "a\nB\nc", []st.DiffOp{{Op: st.DiffOpSet, Line: 1, Content: "B"}}},
+		{"appended lines", "a", "a\nb\nc", []st.DiffOp{{Op: st.DiffOpSet, Line: 1, Content: "b"}, {Op: st.DiffOpSet, Line: 2, Content: "c"}}},
+		{"removed lines", "a\nb\nc", "a", []st.DiffOp{{Op: st.DiffOpTruncate, Line: 1}}},
+		{"from empty", "", "a\nb", []st.DiffOp{{Op: st.DiffOpSet, Line: 0, Content: "a"}, {Op: st.DiffOpSet, Line: 1, Content: "b"}}},
+		{"to empty", "a\nb", "", []st.DiffOp{{Op: st.DiffOpTruncate, Line: 1}, {Op: st.DiffOpSet, Line: 0, Content: ""}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			diff := st.DiffScreens(tc.old, tc.new)
+			assert.Equal(t, tc.ops, diff.Ops)
+			screen, err := st.ApplyDiff(tc.old, diff)
+			require.NoError(t, err)
+			assert.Equal(t, tc.new, screen)
+		})
+	}
+}
+
+func TestApplyDiffErrors(t *testing.T) {
+	_, err := st.ApplyDiff("a", st.TerminalDiff{Ops: []st.DiffOp{{Op: st.DiffOpSet, Line: 2, Content: "c"}}})
+	assert.ErrorContains(t, err, "cannot set line 2 of a screen with 1 lines")
+	_, err = st.ApplyDiff("a\nb", st.TerminalDiff{Ops: []st.DiffOp{{Op: st.DiffOpTruncate, Line: 0}}})
+	assert.ErrorContains(t, err, "cannot truncate a screen with 2 lines to 0 lines")
+	_, err = st.ApplyDiff("a", st.TerminalDiff{Ops: []st.DiffOp{{Op: "delete", Line: 0}}})
+	assert.ErrorContains(t, err, `unknown diff operation "delete"`)
+}
+
+// TestApplyDiffSequence applies the diffs between consecutive snapshots to
+// the first one, and checks that it gives the last snapshot.
+func TestApplyDiffSequence(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	randomLine := func() string {
+		return strings.Repeat(string(rune('a'+rng.Intn(26))), rng.Intn(80)) + strings.Repeat(" ", rng.Intn(3))
+	}
+	lines := []string{"╭───╮", "│ > │", "╰───╯"}
+	snapshots := []string{strings.Join(lines, "\n")}
+	for range 200 {
+		switch rng.Intn(4) {
+		case 0:
+			lines = append(lines, randomLine())
+		case 1:
+			if len(lines) > 1 {
+				lines = lines[:rng.Intn(len(lines)-1)+1]
+			}
+		case 2:
+			// scrolling changes every line
+			lines = append(lines[1:], randomLine())
+		default:
+			lines[rng.Intn(len(lines))] = randomLine()
+		}
+		snapshots = append(snapshots, strings.Join(lines, "\n"))
+	}
+
+	screen := snapshots[0]
+	for i := 1; i < len(snapshots); i++ {
+		var err error
+		screen, err = st.ApplyDiff(screen, st.DiffScreens(snapshots[i-1], snapshots[i]))
+		require.NoError(t, err, fmt.Sprintf("snapshot %d", i))
+	}
+	assert.Equal(t, []byte(snapshots[len(snapshots)-1]), []byte(screen))
+}
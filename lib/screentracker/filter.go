@@ -0,0 +1,68 @@
+package screentracker
+
+import (
+	"regexp"
+	"sync"
+
+	"github.com/zohaibahmed/clauder/lib/msgfmt"
+)
+
+var (
+	// CursorUpPattern matches lines that move the cursor up, which agents
+	// print to redraw what they printed before, e.g. a progress bar.
+	CursorUpPattern = regexp.MustCompile(`\x1b\[\d*A`)
+	// SpinnerPattern matches lines that start with a spinner frame: a
+	// braille pattern, a rotating circle, or one of the stars Claude Code's
+	// spinner cycles through.
+	SpinnerPattern = regexp.MustCompile(`^\s*[\x{2800}-\x{28FF}◐◓◑◒◴◷◶◵✢✳✶✻✽]`)
+	// BlankLinePattern matches lines with nothing but whitespace.
+	BlankLinePattern = regexp.MustCompile(`^\s*$`)
+)
+
+// DefaultSuppressPatterns are the patterns of the output that changes what
+// the terminal shows without adding information.
+var DefaultSuppressPatterns = []*regexp.Regexp{CursorUpPattern, SpinnerPattern, BlankLinePattern}
+
+// OutputFilter drops the lines of the agent's output that match any of its
+// patterns, e.g. spinner frames and progress bars that would flood the line
+// events.
+type OutputFilter struct {
+	patterns []*regexp.Regexp
+
+	mu         sync.Mutex
+	onSuppress func()
+}
+
+// NewOutputFilter creates a filter that drops the lines matching any of
+// patterns.
+func NewOutputFilter(patterns []*regexp.Regexp) *OutputFilter {
+	return &OutputFilter{patterns: patterns}
+}
+
+// OnSuppress sets a function that's called for every line that's dropped,
+// e.g. to count them.
+func (f *OutputFilter) OnSuppress(fn func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.onSuppress = fn
+}
+
+// Suppress reports whether line should be dropped: whether it, or the line
+// without its ANSI escape sequences, matches any of the patterns. The line
+// is passed as the agent printed it, so that patterns can match escape
+// sequences like CursorUpPattern does.
+func (f *OutputFilter) Suppress(line string) bool {
+	plain := msgfmt.StripANSI(line)
+	for _, pattern := range f.patterns {
+		if pattern.MatchString(line) || pattern.MatchString(plain) {
+			f.mu.Lock()
+			onSuppress := f.onSuppress
+			f.mu.Unlock()
+			if onSuppress != nil {
+				onSuppress()
+			}
+			return true
+		}
+	}
+	return false
+}
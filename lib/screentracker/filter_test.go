@@ -0,0 +1,48 @@
+package screentracker
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutputFilter(t *testing.T) {
+	f := NewOutputFilter(append([]*regexp.Regexp{regexp.MustCompile(`^DEBUG `)}, DefaultSuppressPatterns...))
+	var suppressed int
+	f.OnSuppress(func() { suppressed++ })
+
+	for _, line := range []string{
+		"\x1b[2A\x1b[2K[=====>    ] 50%",
+		"⠋ Installing dependencies",
+		"  ⠙ Installing dependencies",
+		"✻ Thinking…",
+		"\x1b[33m✶\x1b[0m Thinking…",
+		"",
+		"   \t",
+		"\x1b[0m",
+		"DEBUG connecting",
+		"\x1b[2mDEBUG connecting\x1b[0m",
+	} {
+		assert.True(t, f.Suppress(line), "%q", line)
+	}
+	assert.Equal(t, 10, suppressed)
+
+	for _, line := range []string{
+		"Installing dependencies ⠋",
+		"The tests pass",
+		"\x1b[32mdone\x1b[0m",
+		"run with DEBUG enabled",
+	} {
+		assert.False(t, f.Suppress(line), "%q", line)
+	}
+	assert.Equal(t, 10, suppressed)
+}
+
+func TestLineEmitterFilter(t *testing.T) {
+	e := NewLineEmitter(16)
+	e.SetFilter(NewOutputFilter(DefaultSuppressPatterns))
+	_, _ = e.Write([]byte("first\n⠋ working\r\n\n\x1b[1A\x1b[2Kredrawn\n\x1b[32msecond\x1b[0m\r\n   \nthird ⠋\n"))
+	// the lines that pass through are emitted like without the filter
+	assert.Equal(t, []string{"first", "second", "third ⠋"}, receiveLines(e))
+}
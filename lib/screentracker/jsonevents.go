@@ -0,0 +1,225 @@
+package screentracker
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/zohaibahmed/clauder/lib/msgfmt"
+)
+
+// ClaudeEvent is a structured event emitted by Claude Code when it runs
+// with `--output-format json`.
+type ClaudeEvent struct {
+	// EventType is the "type" field of the event, e.g. "assistant", "user",
+	// "system" or "result".
+	EventType string
+	// SubType is the "subtype" field of the event, e.g. "init" or "success".
+	SubType string
+	// Text is the text content of the event, if any.
+	Text string
+	// ToolName is the name of the tool the agent invoked, if any.
+	ToolName string
+	// ToolInput is the raw JSON input of the tool invocation, if any.
+	ToolInput string
+	// ToolOutput is the text returned by the tool, if any.
+	ToolOutput string
+}
+
+// JSONEventParser reads the raw output of an agent running in JSON output
+// mode and emits a ClaudeEvent for every complete root JSON object.
+//
+// The screen-based tracking in Conversation works on lines, but JSON objects
+// may span many lines and arrive in arbitrary chunks. JSONEventParser buffers
+// the output and tracks the brace depth, ignoring braces inside strings, so
+// it only parses an object once it's been closed. Anything outside of a root
+// object is discarded, and so are objects longer than maxJSONObjectLength.
+type JSONEventParser struct {
+	mu      sync.Mutex
+	scanner jsonObjectScanner
+	events  chan ClaudeEvent
+}
+
+// maxJSONObjectLength is the length after which jsonObjectScanner discards
+// an object that hasn't been closed yet, so that a stray brace or a huge
+// object doesn't grow the buffer without bound. Unlike a line, an object
+// can't be emitted in parts, so it's larger than maxLineLength, to fit
+// e.g. the contents of a file a tool read.
+const maxJSONObjectLength = 16 * maxLineLength
+
+// jsonObjectScanner finds the root JSON objects in a stream of bytes. It
+// tracks the brace depth, ignoring braces inside strings, and discards
+// anything outside of a root object.
+type jsonObjectScanner struct {
+	buf      []byte
+	depth    int
+	inString bool
+	escaped  bool
+	// overflowed is set once an object exceeded maxJSONObjectLength, until
+	// a line starts with an object. Objects are either printed on one line
+	// or with their nested objects indented, so this skips the rest of the
+	// discarded object, whose nested objects aren't root objects.
+	overflowed bool
+	// lineStart is set if the last byte was a newline.
+	lineStart bool
+}
+
+// write scans data, and calls emit with every root object that's closed
+// in it. The object is only valid until emit returns.
+func (s *jsonObjectScanner) write(data []byte, emit func(object []byte)) {
+	for _, b := range data {
+		lineStart := s.lineStart
+		s.lineStart = b == '\n'
+		if s.depth == 0 {
+			if b == '{' && (!s.overflowed || lineStart) {
+				s.buf = append(s.buf[:0], b)
+				s.depth = 1
+				s.overflowed = false
+			}
+			continue
+		}
+		s.buf = append(s.buf, b)
+		if len(s.buf) > maxJSONObjectLength {
+			s.buf, s.depth, s.inString, s.escaped = nil, 0, false, false
+			s.overflowed = true
+			continue
+		}
+		if s.inString {
+			switch {
+			case s.escaped:
+				s.escaped = false
+			case b == '\\':
+				s.escaped = true
+			case b == '"':
+				s.inString = false
+			}
+			continue
+		}
+		switch b {
+		case '"':
+			s.inString = true
+		case '{':
+			s.depth++
+		case '}':
+			s.depth--
+			if s.depth == 0 {
+				emit(s.buf)
+			}
+		}
+	}
+}
+
+// NewJSONEventParser creates a parser whose event channel has the given
+// buffer size. Write never blocks on the channel: if the buffer is full,
+// the event is dropped.
+func NewJSONEventParser(bufSize int) *JSONEventParser {
+	return &JSONEventParser{
+		events: make(chan ClaudeEvent, bufSize),
+	}
+}
+
+// Events returns the channel on which parsed events are delivered.
+func (p *JSONEventParser) Events() <-chan ClaudeEvent {
+	return p.events
+}
+
+// Write implements io.Writer so the parser can receive the process output.
+func (p *JSONEventParser) Write(data []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.scanner.write(data, p.emit)
+	return len(data), nil
+}
+
+// Close closes the event channel. Write must not be called after Close.
+func (p *JSONEventParser) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	close(p.events)
+}
+
+// Assumes the caller holds the lock.
+func (p *JSONEventParser) emit(raw []byte) {
+	// the terminal may interleave escape sequences with the output, e.g.
+	// to hide the cursor, and they aren't valid JSON
+	event, ok := ParseClaudeEvent([]byte(msgfmt.StripANSI(string(raw))))
+	if !ok {
+		return
+	}
+	select {
+	case p.events <- event:
+	default:
+	}
+}
+
+type claudeContentBlock struct {
+	Type    string          `json:"type"`
+	Text    string          `json:"text"`
+	Name    string          `json:"name"`
+	Input   json.RawMessage `json:"input"`
+	Content json.RawMessage `json:"content"`
+}
+
+type claudeJSONEvent struct {
+	Type    string `json:"type"`
+	Subtype string `json:"subtype"`
+	Result  string `json:"result"`
+	Message struct {
+		Content json.RawMessage `json:"content"`
+	} `json:"message"`
+}
+
+// contentText returns the text of a content field, which is either a plain
+// string or a list of content blocks.
+func contentText(raw json.RawMessage) (string, []claudeContentBlock) {
+	if len(raw) == 0 {
+		return "", nil
+	}
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text, nil
+	}
+	var blocks []claudeContentBlock
+	if err := json.Unmarshal(raw, &blocks); err != nil {
+		return "", nil
+	}
+	texts := make([]string, 0, len(blocks))
+	for _, block := range blocks {
+		if block.Type == "text" {
+			texts = append(texts, block.Text)
+		}
+	}
+	return strings.Join(texts, "\n"), blocks
+}
+
+// ParseClaudeEvent converts a single JSON object emitted by Claude Code into
+// a ClaudeEvent. It returns false if the object isn't a valid event.
+func ParseClaudeEvent(raw []byte) (ClaudeEvent, bool) {
+	var msg claudeJSONEvent
+	if err := json.Unmarshal(raw, &msg); err != nil || msg.Type == "" {
+		return ClaudeEvent{}, false
+	}
+	event := ClaudeEvent{
+		EventType: msg.Type,
+		SubType:   msg.Subtype,
+		Text:      msg.Result,
+	}
+	text, blocks := contentText(msg.Message.Content)
+	if text != "" {
+		event.Text = text
+	}
+	for _, block := range blocks {
+		switch block.Type {
+		case "tool_use":
+			if event.ToolName == "" {
+				event.ToolName = block.Name
+				event.ToolInput = string(block.Input)
+			}
+		case "tool_result":
+			if event.ToolOutput == "" {
+				event.ToolOutput, _ = contentText(block.Content)
+			}
+		}
+	}
+	return event, true
+}
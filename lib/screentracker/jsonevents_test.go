@@ -0,0 +1,113 @@
+package screentracker_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	st "github.com/zohaibahmed/clauder/lib/screentracker"
+)
+
+func collectEvents(p *st.JSONEventParser) []st.ClaudeEvent {
+	p.Close()
+	events := []st.ClaudeEvent{}
+	for event := range p.Events() {
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestJSONEventParser(t *testing.T) {
+	session, err := testdataDir.ReadFile("testdata/json-events/session.txt")
+	require.NoError(t, err)
+	// The pseudo terminal translates newlines to CRLF.
+	output := strings.ReplaceAll(string(session), "\n", "\r\n")
+	expected := []st.ClaudeEvent{
+		{EventType: "system", SubType: "init"},
+		{EventType: "assistant", Text: "I'll check which tests are failing."},
+		{EventType: "assistant", ToolName: "Bash", ToolInput: `{"command":"go test ./...","description":"Run the test suite"}`},
+		{EventType: "user", ToolOutput: "--- FAIL: TestParse (0.00s)\n    parse_test.go:12: expected \"}\" got \"{\"\nFAIL"},
+		{EventType: "result", SubType: "success", Text: "TestParse fails because the closing brace isn't escaped."},
+	}
+
+	t.Run("single-write", func(t *testing.T) {
+		p := st.NewJSONEventParser(16)
+		_, err := p.Write([]byte(output))
+		require.NoError(t, err)
+		assert.Equal(t, expected, collectEvents(p))
+	})
+
+	t.Run("byte-by-byte", func(t *testing.T) {
+		p := st.NewJSONEventParser(16)
+		for i := range len(output) {
+			_, err := p.Write([]byte{output[i]})
+			require.NoError(t, err)
+		}
+		assert.Equal(t, expected, collectEvents(p))
+	})
+
+	t.Run("incomplete-object", func(t *testing.T) {
+		p := st.NewJSONEventParser(16)
+		_, err := p.Write([]byte(`{"type":"assistant","message":{"content":"hel`))
+		require.NoError(t, err)
+		select {
+		case event := <-p.Events():
+			t.Fatalf("unexpected event: %v", event)
+		default:
+		}
+		_, err = p.Write([]byte(`lo {world}"}}`))
+		require.NoError(t, err)
+		assert.Equal(t, []st.ClaudeEvent{{EventType: "assistant", Text: "hello {world}"}}, collectEvents(p))
+	})
+
+	t.Run("noise-between-objects", func(t *testing.T) {
+		p := st.NewJSONEventParser(16)
+		_, err := p.Write([]byte("\x1b[?25l> starting\r\n{\"type\":\"system\"}} junk {\"not\":\"an event\"}{\"type\":\"result\",\"result\":\"ok\"}"))
+		require.NoError(t, err)
+		assert.Equal(t, []st.ClaudeEvent{
+			{EventType: "system"},
+			{EventType: "result", Text: "ok"},
+		}, collectEvents(p))
+	})
+
+	t.Run("escape-sequences-inside-object", func(t *testing.T) {
+		p := st.NewJSONEventParser(16)
+		_, err := p.Write([]byte("{\"type\":\x1b[?25l\"result\",\x1b]0;claude\x07\"result\":\"ok\"}"))
+		require.NoError(t, err)
+		assert.Equal(t, []st.ClaudeEvent{{EventType: "result", Text: "ok"}}, collectEvents(p))
+	})
+
+	t.Run("oversized-object", func(t *testing.T) {
+		huge := strings.Repeat("a", 2<<20)
+		p := st.NewJSONEventParser(16)
+		// the rest of the discarded object isn't mistaken for objects,
+		// whether it's printed on one line or indented
+		_, err := p.Write([]byte(`{"type":"assistant","message":{"content":"` + huge + `"},"blocks":[{"type":"text"}]}` + "\r\n"))
+		require.NoError(t, err)
+		_, err = p.Write([]byte("{\r\n  \"type\": \"user\",\r\n  \"text\": \"" + huge + "\",\r\n  \"block\": {\r\n    \"type\": \"text\"\r\n  }\r\n}\r\n"))
+		require.NoError(t, err)
+		_, err = p.Write([]byte(`{"type":"result","result":"ok"}`))
+		require.NoError(t, err)
+		assert.Equal(t, []st.ClaudeEvent{{EventType: "result", Text: "ok"}}, collectEvents(p))
+	})
+
+	t.Run("unbalanced-brace", func(t *testing.T) {
+		p := st.NewJSONEventParser(16)
+		// a stray brace opens an object that's never closed, which is
+		// discarded once it's too long
+		_, err := p.Write([]byte("progress: {" + strings.Repeat("50%\r\n", 1<<20)))
+		require.NoError(t, err)
+		_, err = p.Write([]byte(`{"type":"result","result":"ok"}`))
+		require.NoError(t, err)
+		assert.Equal(t, []st.ClaudeEvent{{EventType: "result", Text: "ok"}}, collectEvents(p))
+	})
+
+	t.Run("full-buffer-drops-events", func(t *testing.T) {
+		p := st.NewJSONEventParser(1)
+		_, err := p.Write([]byte(`{"type":"a"}{"type":"b"}`))
+		require.NoError(t, err)
+		assert.Equal(t, []st.ClaudeEvent{{EventType: "a"}}, collectEvents(p))
+	})
+}
@@ -0,0 +1,106 @@
+package screentracker
+
+import (
+	"bytes"
+	"sync"
+)
+
+// maxLineLength is the length after which LineEmitter emits a line that
+// hasn't been terminated yet, so that output without newlines doesn't grow
+// the buffer without bound.
+const maxLineLength = 64 * 1024
+
+// LineEmitter receives the raw output of an agent and emits every complete
+// line as soon as its newline arrives, without waiting for the screen to
+// settle like Conversation does. Each line goes through the emitter's
+// processors, which by default remove its ANSI escape sequences and the
+// text a carriage return overwrote.
+//
+// Lines are read from the output rather than the screen, so they include
+// whatever the agent prints, e.g. the redraws of a spinner that ends its
+// lines with newlines.
+type LineEmitter struct {
+	mu         sync.Mutex
+	buf        []byte
+	lines      chan string
+	filter     *OutputFilter
+	processors []Processor
+}
+
+// NewLineEmitter creates an emitter whose line channel has the given buffer
+// size. Write never blocks on the channel: if the buffer is full, the line
+// is dropped.
+func NewLineEmitter(bufSize int) *LineEmitter {
+	return &LineEmitter{
+		lines:      make(chan string, bufSize),
+		processors: []Processor{ANSIStripper{}, CarriageReturnResolver{}},
+	}
+}
+
+// Lines returns the channel on which complete lines are delivered.
+func (e *LineEmitter) Lines() <-chan string {
+	return e.lines
+}
+
+// SetFilter makes the emitter drop the lines the filter suppresses. The
+// filter sees the lines before any processor, as the agent printed them.
+func (e *LineEmitter) SetFilter(filter *OutputFilter) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.filter = filter
+}
+
+// AddProcessor appends p to the processors the lines go through, after the
+// ones that remove the ANSI escape sequences and overwritten text. It must
+// be called before the first Write.
+func (e *LineEmitter) AddProcessor(p Processor) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.processors = append(e.processors, p)
+}
+
+// Write implements io.Writer so the emitter can receive the process output.
+func (e *LineEmitter) Write(data []byte) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	n := len(data)
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i == -1 {
+			e.buf = append(e.buf, data...)
+			if len(e.buf) >= maxLineLength {
+				e.emit()
+			}
+			break
+		}
+		e.buf = append(e.buf, data[:i]...)
+		e.emit()
+		data = data[i+1:]
+	}
+	return n, nil
+}
+
+// Close closes the line channel, dropping an unterminated last line. Write
+// must not be called after Close.
+func (e *LineEmitter) Close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	close(e.lines)
+}
+
+// Assumes the caller holds the lock.
+func (e *LineEmitter) emit() {
+	// the processors get a copy, since the buffer is reused
+	line := append([]byte{}, bytes.TrimRight(e.buf, "\r")...)
+	e.buf = e.buf[:0]
+	if e.filter != nil {
+		line = e.filter.Process(line)
+	}
+	if line = ProcessLine(line, e.processors...); line == nil {
+		return
+	}
+	select {
+	case e.lines <- string(line):
+	default:
+	}
+}
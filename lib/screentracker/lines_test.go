@@ -0,0 +1,51 @@
+package screentracker
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func receiveLines(e *LineEmitter) []string {
+	lines := []string{}
+	for {
+		select {
+		case line := <-e.Lines():
+			lines = append(lines, line)
+		default:
+			return lines
+		}
+	}
+}
+
+func TestLineEmitter(t *testing.T) {
+	e := NewLineEmitter(16)
+
+	// lines are emitted once their newline arrives, in any chunks
+	for _, chunk := range []string{"hel", "lo\r\nwor", "ld\n\x1b[32mgr", "een\x1b[0m\n", "partial"} {
+		n, err := e.Write([]byte(chunk))
+		require.NoError(t, err)
+		assert.Equal(t, len(chunk), n)
+	}
+	assert.Equal(t, []string{"hello", "world", "green"}, receiveLines(e))
+
+	_, _ = e.Write([]byte(" line\n\n10%\r50%\r100%\r\n"))
+	assert.Equal(t, []string{"partial line", "", "100%"}, receiveLines(e))
+
+	// output without newlines is emitted once it's too long
+	_, _ = e.Write([]byte(strings.Repeat("a", maxLineLength)))
+	lines := receiveLines(e)
+	require.Len(t, lines, 1)
+	assert.Len(t, lines[0], maxLineLength)
+
+	// lines are dropped while the channel is full
+	_, _ = e.Write([]byte(strings.Repeat("line\n", 20)))
+	assert.Len(t, receiveLines(e), 16)
+
+	_, _ = e.Write([]byte("unterminated"))
+	e.Close()
+	_, ok := <-e.Lines()
+	assert.False(t, ok)
+}
@@ -0,0 +1,160 @@
+package screentracker
+
+import (
+	"encoding/binary"
+
+	"golang.org/x/xerrors"
+)
+
+// This is a minimal encoder and decoder of the LZ4 block format
+// (https://github.com/lz4/lz4/blob/dev/doc/lz4_Block_format.md), without
+// the frame format around it, to compress snapshots. A block is a series
+// of sequences, each a token with the lengths of its literals and match,
+// the literals, and the offset of the match in the decompressed output.
+// The last sequence only has literals.
+const (
+	lz4MinMatch = 4
+	// lz4LastLiterals is how many bytes at the end are always literals.
+	lz4LastLiterals = 5
+	// lz4MFLimit is how far from the end the last match must start.
+	lz4MFLimit   = 12
+	lz4MaxOffset = 1<<16 - 1
+	lz4HashLog   = 12
+)
+
+func lz4Hash(v uint32) uint32 {
+	return (v * 2654435761) >> (32 - lz4HashLog)
+}
+
+// lz4AppendLength appends the part of a length that doesn't fit in the
+// token: bytes of 255 and a last one below it.
+func lz4AppendLength(dst []byte, n int) []byte {
+	for ; n >= 255; n -= 255 {
+		dst = append(dst, 255)
+	}
+	return append(dst, byte(n))
+}
+
+// lz4AppendSequence appends a sequence of literals followed by a match of
+// matchLen bytes at offset. The last sequence has a matchLen of 0.
+func lz4AppendSequence(dst, literals []byte, offset, matchLen int) []byte {
+	token := byte(min(len(literals), 15)) << 4
+	if matchLen > 0 {
+		token |= byte(min(matchLen-lz4MinMatch, 15))
+	}
+	dst = append(dst, token)
+	if len(literals) >= 15 {
+		dst = lz4AppendLength(dst, len(literals)-15)
+	}
+	dst = append(dst, literals...)
+	if matchLen == 0 {
+		return dst
+	}
+	dst = binary.LittleEndian.AppendUint16(dst, uint16(offset))
+	if matchLen-lz4MinMatch >= 15 {
+		dst = lz4AppendLength(dst, matchLen-lz4MinMatch-15)
+	}
+	return dst
+}
+
+// lz4Compress compresses src into an LZ4 block with greedy matching. The
+// output is deterministic, so two blocks are equal if and only if their
+// inputs are.
+func lz4Compress(src []byte) []byte {
+	dst := make([]byte, 0, len(src)/4+16)
+	// table holds the last position+1 of each hash of 4 bytes
+	var table [1 << lz4HashLog]int32
+	anchor := 0
+	for i := 0; i < len(src)-lz4MFLimit; {
+		seq := binary.LittleEndian.Uint32(src[i:])
+		h := lz4Hash(seq)
+		ref := int(table[h]) - 1
+		table[h] = int32(i + 1)
+		if ref < 0 || i-ref > lz4MaxOffset || binary.LittleEndian.Uint32(src[ref:]) != seq {
+			i++
+			continue
+		}
+		end := i + lz4MinMatch
+		for end < len(src)-lz4LastLiterals && src[end] == src[ref+end-i] {
+			end++
+		}
+		dst = lz4AppendSequence(dst, src[anchor:i], i-ref, end-i)
+		i = end
+		anchor = i
+	}
+	return lz4AppendSequence(dst, src[anchor:], 0, 0)
+}
+
+// lz4ReadLength reads the part of a length that doesn't fit in the token.
+func lz4ReadLength(src []byte, i int) (int, int, error) {
+	n := 0
+	for {
+		if i >= len(src) {
+			return 0, 0, xerrors.New("lz4: truncated length")
+		}
+		b := src[i]
+		i++
+		n += int(b)
+		if b != 255 {
+			return n, i, nil
+		}
+	}
+}
+
+// lz4Decompress decompresses an LZ4 block of size bytes.
+func lz4Decompress(src []byte, size int) ([]byte, error) {
+	dst := make([]byte, 0, size)
+	for i := 0; i < len(src); {
+		token := src[i]
+		i++
+		literals := int(token >> 4)
+		if literals == 15 {
+			n, next, err := lz4ReadLength(src, i)
+			if err != nil {
+				return nil, err
+			}
+			literals += n
+			i = next
+		}
+		if i+literals > len(src) {
+			return nil, xerrors.New("lz4: truncated literals")
+		}
+		dst = append(dst, src[i:i+literals]...)
+		i += literals
+		if i == len(src) {
+			break
+		}
+
+		if i+2 > len(src) {
+			return nil, xerrors.New("lz4: truncated offset")
+		}
+		offset := int(binary.LittleEndian.Uint16(src[i:]))
+		i += 2
+		if offset == 0 || offset > len(dst) {
+			return nil, xerrors.Errorf("lz4: invalid offset %d", offset)
+		}
+		matchLen := int(token & 15)
+		if matchLen == 15 {
+			n, next, err := lz4ReadLength(src, i)
+			if err != nil {
+				return nil, err
+			}
+			matchLen += n
+			i = next
+		}
+		matchLen += lz4MinMatch
+		start := len(dst) - offset
+		if offset >= matchLen {
+			dst = append(dst, dst[start:start+matchLen]...)
+			continue
+		}
+		// the match overlaps the bytes it produces, e.g. a run of spaces
+		for k := range matchLen {
+			dst = append(dst, dst[start+k])
+		}
+	}
+	if len(dst) != size {
+		return nil, xerrors.Errorf("lz4: decompressed %d bytes, expected %d", len(dst), size)
+	}
+	return dst, nil
+}
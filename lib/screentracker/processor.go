@@ -0,0 +1,63 @@
+package screentracker
+
+import (
+	"bytes"
+
+	"github.com/zohaibahmed/clauder/lib/msgfmt"
+)
+
+// Processor transforms a line of the agent's output, e.g. to redact
+// secrets or to highlight code. It returns nil to drop the line, and an
+// empty slice for an empty line. Beware that some functions, like
+// regexp.ReplaceAll, return nil for an empty input.
+type Processor interface {
+	Process(line []byte) []byte
+}
+
+// ProcessorFunc adapts a function to a Processor.
+type ProcessorFunc func(line []byte) []byte
+
+func (f ProcessorFunc) Process(line []byte) []byte {
+	return f(line)
+}
+
+// ProcessLine runs line through processors in order, each transforming the
+// previous one's output. It returns nil as soon as a processor drops the
+// line, or if line is nil.
+func ProcessLine(line []byte, processors ...Processor) []byte {
+	for _, p := range processors {
+		if line == nil {
+			return nil
+		}
+		line = p.Process(line)
+	}
+	return line
+}
+
+// ANSIStripper removes the ANSI escape sequences from lines.
+type ANSIStripper struct{}
+
+func (ANSIStripper) Process(line []byte) []byte {
+	return append(line[:0:0], msgfmt.StripANSI(string(line))...)
+}
+
+// CarriageReturnResolver keeps what a line ends up showing in a terminal.
+// A carriage return moves the cursor back to the start of the line, so
+// that's the text after the last one, besides trailing ones.
+type CarriageReturnResolver struct{}
+
+func (CarriageReturnResolver) Process(line []byte) []byte {
+	line = bytes.TrimRight(line, "\r")
+	if i := bytes.LastIndexByte(line, '\r'); i != -1 {
+		line = line[i+1:]
+	}
+	return line
+}
+
+// Process implements Processor: it drops the lines Suppress reports.
+func (f *OutputFilter) Process(line []byte) []byte {
+	if f.Suppress(string(line)) {
+		return nil
+	}
+	return line
+}
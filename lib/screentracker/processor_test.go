@@ -0,0 +1,73 @@
+package screentracker
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var apiKeyPattern = regexp.MustCompile(`sk-[A-Za-z0-9]+`)
+
+// redactor replaces API keys with a placeholder.
+var redactor = ProcessorFunc(func(line []byte) []byte {
+	if len(line) == 0 {
+		return line
+	}
+	return apiKeyPattern.ReplaceAll(line, []byte("[REDACTED]"))
+})
+
+// highlighter colors the minus operators red, like a syntax highlighter.
+var highlighter = ProcessorFunc(func(line []byte) []byte {
+	return bytes.ReplaceAll(line, []byte("-"), []byte("\x1b[31m-\x1b[0m"))
+})
+
+func TestProcessLine(t *testing.T) {
+	line := `key := "sk-abc123"; n := a - b`
+	assert.Equal(t, "key := \"[REDACTED]\"; n := a \x1b[31m-\x1b[0m b", string(ProcessLine([]byte(line), redactor, highlighter)))
+	// the colors split the key, so the redactor doesn't see it anymore
+	assert.Contains(t, string(ProcessLine([]byte(line), highlighter, redactor)), "abc123")
+
+	assert.Equal(t, "plain", string(ProcessLine([]byte("\x1b[1mplain\x1b[0m"), ANSIStripper{})))
+	assert.Equal(t, "100%", string(ProcessLine([]byte("10%\r50%\r100%\r\r"), CarriageReturnResolver{})))
+	assert.Equal(t, "as is", string(ProcessLine([]byte("as is"))))
+}
+
+func TestProcessLineDrop(t *testing.T) {
+	called := false
+	dropSecrets := ProcessorFunc(func(line []byte) []byte {
+		if apiKeyPattern.Match(line) {
+			return nil
+		}
+		return line
+	})
+	after := ProcessorFunc(func(line []byte) []byte {
+		called = true
+		return line
+	})
+	assert.Nil(t, ProcessLine([]byte("export KEY=sk-abc123"), dropSecrets, after))
+	assert.False(t, called, "the processors after the one that dropped the line aren't called")
+
+	// empty lines aren't dropped
+	line := ProcessLine([]byte("\x1b[0m"), ANSIStripper{}, CarriageReturnResolver{}, dropSecrets, after)
+	assert.NotNil(t, line)
+	assert.Empty(t, line)
+	assert.True(t, called)
+}
+
+func TestLineEmitterProcessors(t *testing.T) {
+	e := NewLineEmitter(16)
+	e.SetFilter(NewOutputFilter([]*regexp.Regexp{CursorUpPattern}))
+	e.AddProcessor(redactor)
+	e.AddProcessor(ProcessorFunc(func(line []byte) []byte {
+		if bytes.HasPrefix(line, []byte("DEBUG")) {
+			return nil
+		}
+		return line
+	}))
+
+	// the processors get the lines without escape sequences
+	_, _ = e.Write([]byte("\x1b[32mtoken: sk-abc123\x1b[0m\nDEBUG noise\n\x1b[1A\x1b[2Kredraw\n\nsk-\x1b[1mdef456\x1b[0m\n"))
+	assert.Equal(t, []string{"token: [REDACTED]", "", "[REDACTED]"}, receiveLines(e))
+}
@@ -1,5 +1,7 @@
 package screentracker
 
+import "fmt"
+
 // RingBuffer is a generic circular buffer that can store items of any type
 type RingBuffer[T any] struct {
 	items     []T
@@ -40,3 +42,17 @@ func (b *RingBuffer[T]) GetAll() []T {
 func (b *RingBuffer[T]) Capacity() int {
 	return b.size
 }
+
+// Len returns the number of items in the buffer
+func (b *RingBuffer[T]) Len() int {
+	return b.count
+}
+
+// At returns a pointer to the i-th oldest item in the buffer, to update it
+// in place
+func (b *RingBuffer[T]) At(i int) *T {
+	if i < 0 || i >= b.count {
+		panic(fmt.Sprintf("ring buffer index %d out of range [0:%d]", i, b.count))
+	}
+	return &b.items[(b.nextIndex-b.count+i+len(b.items))%len(b.items)]
+}
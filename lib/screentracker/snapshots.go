@@ -0,0 +1,106 @@
+package screentracker
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+// DefaultSnapshotCompressionThreshold is how many of the most recent
+// snapshots are kept uncompressed unless
+// ConversationConfig.SnapshotCompressionThreshold is set.
+const DefaultSnapshotCompressionThreshold = 50
+
+type screenSnapshot struct {
+	timestamp time.Time
+	screen    string
+	// compressed is the LZ4 block of the screen once the snapshot was
+	// compressed, in which case screen is empty.
+	compressed []byte
+	// size is the length of the screen.
+	size int
+}
+
+// Screen returns the screen of the snapshot, decompressing it if needed.
+func (s screenSnapshot) Screen() string {
+	if s.compressed == nil {
+		return s.screen
+	}
+	screen, err := lz4Decompress(s.compressed, s.size)
+	if err != nil {
+		panic(fmt.Sprintf("snapshot from %s is corrupted: %v", s.timestamp, err))
+	}
+	return string(screen)
+}
+
+// sameScreen reports whether the snapshot has the same screen as first,
+// whose decompressed screen is firstScreen. Compressed snapshots are
+// compared without decompressing them, since equal screens compress to
+// equal blocks.
+func (s screenSnapshot) sameScreen(first screenSnapshot, firstScreen string) bool {
+	switch {
+	case s.compressed != nil && first.compressed != nil:
+		return bytes.Equal(s.compressed, first.compressed)
+	case s.compressed != nil:
+		return s.Screen() == firstScreen
+	default:
+		return s.screen == firstScreen
+	}
+}
+
+// snapshotHistory holds the most recent snapshots. The ones older than the
+// most recent threshold are compressed with LZ4, since a snapshot of a
+// large terminal takes tens of kilobytes and a history of a few seconds
+// holds dozens of them.
+type snapshotHistory struct {
+	*RingBuffer[screenSnapshot]
+	// threshold is negative if the snapshots are never compressed.
+	threshold int
+}
+
+func newSnapshotHistory(size, threshold int) *snapshotHistory {
+	if threshold == 0 {
+		threshold = DefaultSnapshotCompressionThreshold
+	}
+	return &snapshotHistory{RingBuffer: NewRingBuffer[screenSnapshot](size), threshold: threshold}
+}
+
+// Add adds a snapshot of screen, and compresses the snapshot that's now
+// older than the threshold.
+func (h *snapshotHistory) Add(timestamp time.Time, screen string) {
+	h.RingBuffer.Add(screenSnapshot{timestamp: timestamp, screen: screen, size: len(screen)})
+	if h.threshold < 0 || h.Len() <= h.threshold {
+		return
+	}
+	snapshot := h.At(h.Len() - h.threshold - 1)
+	if snapshot.compressed == nil {
+		snapshot.compressed = lz4Compress([]byte(snapshot.screen))
+		snapshot.screen = ""
+	}
+}
+
+// SnapshotMemory is the memory used by the snapshot history.
+type SnapshotMemory struct {
+	Snapshots  int
+	Compressed int
+	// UncompressedBytes is the size of the screens of the snapshots.
+	UncompressedBytes int
+	// StoredBytes is the size of the snapshots as they're stored.
+	StoredBytes int
+}
+
+func (h *snapshotHistory) memory() SnapshotMemory {
+	var memory SnapshotMemory
+	for i := range h.Len() {
+		snapshot := h.At(i)
+		memory.Snapshots++
+		memory.UncompressedBytes += snapshot.size
+		if snapshot.compressed != nil {
+			memory.Compressed++
+			memory.StoredBytes += len(snapshot.compressed)
+		} else {
+			memory.StoredBytes += len(snapshot.screen)
+		}
+	}
+	return memory
+}
@@ -0,0 +1,145 @@
+package screentracker
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLZ4(t *testing.T) {
+	rnd := rand.New(rand.NewPCG(1, 2))
+	random := make([]byte, 100000)
+	for i := range random {
+		random[i] = byte(rnd.IntN(256))
+	}
+	inputs := map[string][]byte{
+		"empty":        nil,
+		"short":        []byte("hello"),
+		"spaces":       bytes.Repeat([]byte(" "), 70000),
+		"random":       random,
+		"long literal": random[:300],
+		"screen":       []byte(testScreen(220, 50, 7)),
+		"repeated":     bytes.Repeat([]byte("> Thinking about the answer…\n"), 5000),
+	}
+	for name, input := range inputs {
+		compressed := lz4Compress(input)
+		output, err := lz4Decompress(compressed, len(input))
+		require.NoError(t, err, name)
+		assert.True(t, bytes.Equal(input, output), name)
+		assert.Equal(t, compressed, lz4Compress(input), "%s: the compression is deterministic", name)
+	}
+	assert.Less(t, len(lz4Compress(inputs["spaces"])), 500)
+	screen := inputs["screen"]
+	assert.Less(t, len(lz4Compress(screen)), len(screen)/2)
+
+	compressed := lz4Compress(screen)
+	for _, corrupted := range [][]byte{compressed[:len(compressed)/2], {0x0f}, {0x10, 'a', 0x05, 0x00}} {
+		_, err := lz4Decompress(corrupted, len(screen))
+		assert.Error(t, err)
+	}
+	_, err := lz4Decompress(compressed, len(screen)+1)
+	assert.Error(t, err)
+}
+
+func TestSnapshotHistory(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	h := newSnapshotHistory(5, 2)
+	for i := range 4 {
+		h.Add(now, testScreen(220, 50, i))
+	}
+	memory := h.memory()
+	assert.Equal(t, 4, memory.Snapshots)
+	assert.Equal(t, 2, memory.Compressed)
+	assert.Equal(t, 4*len(testScreen(220, 50, 0)), memory.UncompressedBytes)
+	assert.Less(t, memory.StoredBytes, memory.UncompressedBytes)
+	for i, snapshot := range h.GetAll() {
+		assert.Equal(t, i < 2, snapshot.compressed != nil, i)
+		assert.Equal(t, testScreen(220, 50, i), snapshot.Screen(), i)
+	}
+
+	// the oldest snapshots are dropped
+	for i := 4; i < 8; i++ {
+		h.Add(now, testScreen(220, 50, i))
+	}
+	memory = h.memory()
+	assert.Equal(t, 5, memory.Snapshots)
+	assert.Equal(t, 3, memory.Compressed)
+	for i, snapshot := range h.GetAll() {
+		assert.Equal(t, testScreen(220, 50, i+3), snapshot.Screen(), i)
+	}
+
+	// equal screens are equal whether they're compressed or not
+	h.Add(now, testScreen(220, 50, 1))
+	h.Add(now, testScreen(220, 50, 1))
+	h.Add(now, testScreen(220, 50, 1))
+	snapshots := h.GetAll()
+	require.NotNil(t, snapshots[2].compressed)
+	require.Nil(t, snapshots[3].compressed)
+	first := snapshots[2]
+	for _, snapshot := range snapshots[2:] {
+		assert.True(t, snapshot.sameScreen(first, first.Screen()))
+	}
+	assert.False(t, snapshots[1].sameScreen(first, first.Screen()))
+	assert.True(t, snapshots[4].sameScreen(snapshots[4], snapshots[4].Screen()))
+
+	// compression can be disabled
+	h = newSnapshotHistory(5, -1)
+	for i := range 5 {
+		h.Add(now, testScreen(80, 24, i))
+	}
+	assert.Zero(t, h.memory().Compressed)
+	assert.Equal(t, DefaultSnapshotCompressionThreshold, newSnapshotHistory(5, 0).threshold)
+}
+
+// testScreen returns a screen of width×height that looks like an agent's
+// output, which changes with i.
+func testScreen(width, height, i int) string {
+	words := strings.Fields("func the agent reads a file and writes the result to the terminal ( ) { } := return err nil if for range")
+	rnd := rand.New(rand.NewPCG(42, 0))
+	lines := make([]string, height)
+	for l := range lines {
+		var line strings.Builder
+		line.WriteString(strings.Repeat("  ", rnd.IntN(4)))
+		for line.Len() < width-10 && rnd.IntN(12) != 0 {
+			line.WriteString(words[rnd.IntN(len(words))] + " ")
+		}
+		// the screen is padded with spaces to its width
+		lines[l] = line.String() + strings.Repeat(" ", max(0, width-line.Len()))
+	}
+	lines[height-1] = fmt.Sprintf("%-*s", width, fmt.Sprintf("⠋ Working… (%ds)", i))
+	return strings.Join(lines, "\n")
+}
+
+// BenchmarkSnapshotHistory compares the memory used by a history of 2000
+// snapshots of a 220×50 terminal with and without compression.
+func BenchmarkSnapshotHistory(b *testing.B) {
+	screens := make([]string, 2000)
+	for i := range screens {
+		screens[i] = testScreen(220, 50, i)
+	}
+	for _, threshold := range []int{-1, DefaultSnapshotCompressionThreshold} {
+		name := "uncompressed"
+		if threshold > 0 {
+			name = "compressed"
+		}
+		b.Run(name, func(b *testing.B) {
+			var memory SnapshotMemory
+			for range b.N {
+				h := newSnapshotHistory(len(screens), threshold)
+				for _, screen := range screens {
+					// each snapshot is read from the terminal into a new string
+					h.Add(time.Time{}, strings.Clone(screen))
+				}
+				memory = h.memory()
+			}
+			b.ReportMetric(float64(memory.StoredBytes), "stored-B")
+			b.ReportMetric(float64(memory.UncompressedBytes), "uncompressed-B")
+		})
+	}
+}
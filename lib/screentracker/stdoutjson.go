@@ -0,0 +1,74 @@
+package screentracker
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// StdoutEvent is a JSON object an agent printed to its standard output.
+type StdoutEvent struct {
+	// Type is the "type" field of the object, if it has one.
+	Type string
+	// Object is the JSON object.
+	Object json.RawMessage
+	// Claude is the object parsed as a Claude Code event. IsClaude is false
+	// if it can't be one, because it has no type.
+	Claude   ClaudeEvent
+	IsClaude bool
+}
+
+// StdoutJSONParser reads the standard output of an agent that prints
+// structured JSON, like Claude Code with `--output-format json` or Aider
+// with `--json`, from a pipe separate from its terminal. It emits a
+// StdoutEvent for every complete root JSON object, found like
+// JSONEventParser does. Anything else, including invalid objects, is
+// discarded.
+type StdoutJSONParser struct {
+	r       io.Reader
+	scanner jsonObjectScanner
+	events  chan StdoutEvent
+}
+
+// NewStdoutJSONParser creates a parser that reads from r, whose event
+// channel has the given buffer size. Unlike JSONEventParser, the parser
+// waits for room in the channel rather than dropping events, so the
+// events must be received until the channel is closed.
+func NewStdoutJSONParser(r io.Reader, bufSize int) *StdoutJSONParser {
+	return &StdoutJSONParser{r: r, events: make(chan StdoutEvent, bufSize)}
+}
+
+// Events returns the channel on which parsed events are delivered. It's
+// closed once Run returns.
+func (p *StdoutJSONParser) Events() <-chan StdoutEvent {
+	return p.events
+}
+
+// Run reads and parses the output until the reader returns an error, which
+// is returned unless it's io.EOF.
+func (p *StdoutJSONParser) Run() error {
+	defer close(p.events)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := p.r.Read(buf)
+		p.scanner.write(buf[:n], p.emit)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (p *StdoutJSONParser) emit(raw []byte) {
+	var header struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(raw, &header); err != nil {
+		return
+	}
+	// raw is reused by the scanner
+	event := StdoutEvent{Type: header.Type, Object: append(json.RawMessage(nil), raw...)}
+	event.Claude, event.IsClaude = ParseClaudeEvent(raw)
+	p.events <- event
+}
@@ -0,0 +1,71 @@
+package screentracker_test
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	st "github.com/zohaibahmed/clauder/lib/screentracker"
+)
+
+// runStdoutJSONParser parses everything r returns, and returns the events
+// and Run's error.
+func runStdoutJSONParser(r io.Reader) ([]st.StdoutEvent, error) {
+	p := st.NewStdoutJSONParser(r, 1)
+	errCh := make(chan error, 1)
+	go func() { errCh <- p.Run() }()
+	events := []st.StdoutEvent{}
+	for event := range p.Events() {
+		events = append(events, event)
+	}
+	return events, <-errCh
+}
+
+func TestStdoutJSONParserClaude(t *testing.T) {
+	session, err := testdataDir.ReadFile("testdata/json-events/session.txt")
+	require.NoError(t, err)
+
+	// the pipe has no line discipline, and returns the output in chunks
+	events, err := runStdoutJSONParser(iotest.OneByteReader(strings.NewReader(string(session))))
+	require.NoError(t, err)
+	var types []string
+	var claudeEvents []st.ClaudeEvent
+	for _, event := range events {
+		types = append(types, event.Type)
+		assert.True(t, event.IsClaude)
+		assert.True(t, strings.HasPrefix(string(event.Object), "{"))
+		claudeEvents = append(claudeEvents, event.Claude)
+	}
+	assert.Equal(t, []string{"system", "assistant", "assistant", "user", "result"}, types)
+	assert.Equal(t, st.ClaudeEvent{EventType: "assistant", ToolName: "Bash", ToolInput: `{"command":"go test ./...","description":"Run the test suite"}`}, claudeEvents[2])
+	assert.Equal(t, "TestParse fails because the closing brace isn't escaped.", claudeEvents[4].Text)
+}
+
+func TestStdoutJSONParserAider(t *testing.T) {
+	output, err := testdataDir.ReadFile("testdata/stdout-json/aider.txt")
+	require.NoError(t, err)
+
+	events, err := runStdoutJSONParser(strings.NewReader(string(output)))
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+	assert.Equal(t, "edit", events[0].Type)
+	assert.JSONEq(t, `{"type": "edit", "file": "main.go", "diff": "@@ -1 +1 @@\n-func main() {}\n+func main() { run() }"}`, string(events[0].Object))
+	assert.Equal(t, "commit", events[1].Type)
+	// objects without a type are emitted too, but aren't Claude events
+	assert.Equal(t, "", events[2].Type)
+	assert.False(t, events[2].IsClaude)
+	assert.JSONEq(t, `{"tokens": {"sent": 1200, "received": 85}}`, string(events[2].Object))
+}
+
+func TestStdoutJSONParserReadError(t *testing.T) {
+	readErr := errors.New("pipe broken")
+	events, err := runStdoutJSONParser(io.MultiReader(strings.NewReader(`{"type":"a"} {"type":`), iotest.ErrReader(readErr)))
+	assert.ErrorIs(t, err, readErr)
+	require.Len(t, events, 1)
+	assert.Equal(t, "a", events[0].Type)
+}
@@ -0,0 +1,76 @@
+package termexec
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// DefaultBatchWindow is StartProcessConfig.BatchWindow if it isn't set.
+const DefaultBatchWindow = 5 * time.Millisecond
+
+// writeBatcher collects the input written to a process within a window,
+// which starts with the first write after the previous flush, and writes
+// it at once when the window ends. Automation scripts and keepalive pings
+// send many small writes in quick succession, and each would otherwise be
+// a syscall.
+type writeBatcher struct {
+	window time.Duration
+	write  func([]byte) (int, error)
+
+	// flushMu is held while a batch is written, so that batches are
+	// written in order.
+	flushMu sync.Mutex
+
+	mu      sync.Mutex
+	buf     []byte
+	pending bool
+	// err is the error of the last flush, returned by the next write.
+	err error
+}
+
+// newWriteBatcher returns a batcher that writes its batches with write.
+func newWriteBatcher(window time.Duration, write func([]byte) (int, error)) *writeBatcher {
+	if window <= 0 {
+		window = DefaultBatchWindow
+	}
+	return &writeBatcher{window: window, write: write}
+}
+
+// Write adds data to the current batch, and starts a new batch if there's
+// none. It returns the error of the previous batch, if writing it failed.
+func (b *writeBatcher) Write(data []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.err; err != nil {
+		b.err = nil
+		return 0, xerrors.Errorf("failed to write batched input: %w", err)
+	}
+	b.buf = append(b.buf, data...)
+	if !b.pending {
+		b.pending = true
+		time.AfterFunc(b.window, b.flush)
+	}
+	return len(data), nil
+}
+
+// flush writes the current batch. Writes that happen while it's written
+// go to the next batch.
+func (b *writeBatcher) flush() {
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+	b.mu.Lock()
+	buf := b.buf
+	b.buf = nil
+	b.pending = false
+	b.mu.Unlock()
+	if len(buf) == 0 {
+		return
+	}
+	if _, err := b.write(buf); err != nil {
+		b.mu.Lock()
+		b.err = err
+		b.mu.Unlock()
+	}
+}
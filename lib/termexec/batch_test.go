@@ -0,0 +1,120 @@
+package termexec
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingWriter counts the writes to the pseudo terminal, each of which
+// is a syscall.
+type countingWriter struct {
+	lockedBuffer
+	writes atomic.Int32
+}
+
+func (w *countingWriter) Write(data []byte) (int, error) {
+	w.writes.Add(1)
+	return w.lockedBuffer.Write(data)
+}
+
+// newWriteTestProcess returns a process whose input is written to in, in
+// batches of window if it isn't 0.
+func newWriteTestProcess(t testing.TB, window time.Duration) (*Process, *countingWriter) {
+	in := &countingWriter{}
+	p := newTestProcess(t, strings.NewReader(""))
+	p.term.in = in
+	if window > 0 {
+		p.batcher = newWriteBatcher(window, p.writeTerminal)
+	}
+	return p, in
+}
+
+func TestBatchedWrites(t *testing.T) {
+	unbatched, unbatchedIn := newWriteTestProcess(t, 0)
+	batched, batchedIn := newWriteTestProcess(t, DefaultBatchWindow)
+	var want strings.Builder
+	for i := range 200 {
+		chunk := []byte(strings.Repeat("ü", i%3) + string(rune('a'+i%26)))
+		want.Write(chunk)
+		for _, p := range []*Process{unbatched, batched} {
+			n, err := p.Write(chunk)
+			require.NoError(t, err)
+			assert.Equal(t, len(chunk), n)
+		}
+		if i%50 == 0 {
+			time.Sleep(2 * DefaultBatchWindow)
+		}
+	}
+
+	assert.Equal(t, want.String(), unbatchedIn.String())
+	require.Eventually(t, func() bool {
+		return batchedIn.String() == want.String()
+	}, 5*time.Second, time.Millisecond, "the batched input is the same")
+	assert.Equal(t, int32(200), unbatchedIn.writes.Load())
+	assert.Less(t, batchedIn.writes.Load(), int32(200))
+}
+
+func TestBatchWindow(t *testing.T) {
+	p, in := newWriteTestProcess(t, 20*time.Millisecond)
+	_, err := p.Write([]byte("a"))
+	require.NoError(t, err)
+	_, err = p.Write([]byte("b"))
+	require.NoError(t, err)
+	assert.Empty(t, in.String(), "the input is written once the window ends")
+	require.Eventually(t, func() bool { return in.String() == "ab" }, 5*time.Second, time.Millisecond)
+
+	// the next write starts a new window
+	_, err = p.Write([]byte("c"))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return in.String() == "abc" }, 5*time.Second, time.Millisecond)
+	assert.Equal(t, int32(2), in.writes.Load())
+
+	// the error of a batch is returned by the next write
+	p.term.in = failingWriter{}
+	_, err = p.Write([]byte("d"))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		_, err := p.Write(nil)
+		return err != nil
+	}, 5*time.Second, time.Millisecond)
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("input/output error")
+}
+
+// BenchmarkBatchedWrites reports the number of writes to the pseudo
+// terminal, i.e. syscalls, of 100 sequential one-byte writes.
+func BenchmarkBatchedWrites(b *testing.B) {
+	for _, bench := range []struct {
+		name   string
+		window time.Duration
+	}{
+		{"unbatched", 0},
+		{"batched", DefaultBatchWindow},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			p, in := newWriteTestProcess(b, bench.window)
+			data := []byte("x")
+			for range b.N {
+				for range 100 {
+					if _, err := p.Write(data); err != nil {
+						b.Fatal(err)
+					}
+				}
+				if p.batcher != nil {
+					p.batcher.flush()
+				}
+			}
+			b.ReportMetric(float64(in.writes.Load())/float64(b.N), "syscalls/op")
+		})
+	}
+}
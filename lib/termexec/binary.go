@@ -0,0 +1,43 @@
+package termexec
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// ResolveBinary returns the path of the executable name. It's looked up in
+// extraPaths first, in order, and then in PATH. A leading ~ in extraPaths
+// is the user's home directory. Names that contain a path separator are
+// only looked up as is, like exec.LookPath does.
+func ResolveBinary(name string, extraPaths []string) (string, error) {
+	return resolveBinary(name, extraPaths, exec.LookPath, os.UserHomeDir)
+}
+
+func resolveBinary(name string, extraPaths []string, lookPath func(file string) (string, error), homeDir func() (string, error)) (string, error) {
+	if strings.ContainsRune(name, '/') || strings.ContainsRune(name, filepath.Separator) {
+		return lookPath(name)
+	}
+	for _, dir := range extraPaths {
+		if dir == "~" || strings.HasPrefix(dir, "~/") {
+			home, err := homeDir()
+			if err != nil {
+				continue
+			}
+			dir = filepath.Join(home, dir[1:])
+		}
+		// lookPath checks that a path with a separator is executable, and
+		// adds the executable extensions on Windows
+		if path, err := lookPath(filepath.Join(dir, name)); err == nil {
+			return path, nil
+		}
+	}
+	path, err := lookPath(name)
+	if err != nil {
+		return "", xerrors.Errorf("%s not found in %s or PATH: %w", name, strings.Join(extraPaths, ", "), err)
+	}
+	return path, nil
+}
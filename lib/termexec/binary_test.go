@@ -0,0 +1,100 @@
+package termexec
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	"golang.org/x/xerrors"
+)
+
+func TestResolveBinary(t *testing.T) {
+	home := func() (string, error) { return "/home/user", nil }
+	// lookPath records the paths it's asked about, and finds those in
+	// found
+	lookPaths := func(found ...string) (func(string) (string, error), *[]string) {
+		var looked []string
+		return func(file string) (string, error) {
+			looked = append(looked, file)
+			for _, path := range found {
+				if file == path {
+					return "/resolved/" + file, nil
+				}
+			}
+			return "", exec.ErrNotFound
+		}, &looked
+	}
+	extraPaths := []string{"~/.npm/bin", "/usr/local/lib/node_modules/.bin", "~"}
+
+	// every directory is tried in order before PATH
+	lookPath, looked := lookPaths("claude")
+	path, err := resolveBinary("claude", extraPaths, lookPath, home)
+	require.NoError(t, err)
+	assert.Equal(t, "/resolved/claude", path)
+	assert.Equal(t, []string{
+		filepath.Join("/home/user/.npm/bin", "claude"),
+		filepath.Join("/usr/local/lib/node_modules/.bin", "claude"),
+		filepath.Join("/home/user", "claude"),
+		"claude",
+	}, *looked)
+
+	// the first directory that has it wins
+	second := filepath.Join("/usr/local/lib/node_modules/.bin", "claude")
+	lookPath, looked = lookPaths(second, filepath.Join("/home/user", "claude"), "claude")
+	path, err = resolveBinary("claude", extraPaths, lookPath, home)
+	require.NoError(t, err)
+	assert.Equal(t, "/resolved/"+second, path)
+	assert.Len(t, *looked, 2)
+
+	// without a home directory, its paths are skipped
+	lookPath, looked = lookPaths("claude")
+	_, err = resolveBinary("claude", extraPaths, lookPath, func() (string, error) { return "", xerrors.New("no home") })
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join("/usr/local/lib/node_modules/.bin", "claude"), "claude"}, *looked)
+
+	// paths are only looked up as is
+	lookPath, looked = lookPaths()
+	_, err = resolveBinary("./bin/claude", extraPaths, lookPath, home)
+	assert.ErrorIs(t, err, exec.ErrNotFound)
+	assert.Equal(t, []string{"./bin/claude"}, *looked)
+
+	lookPath, _ = lookPaths()
+	_, err = resolveBinary("claude", extraPaths, lookPath, home)
+	assert.ErrorIs(t, err, exec.ErrNotFound)
+	assert.ErrorContains(t, err, "claude not found in ~/.npm/bin")
+}
+
+func TestStartProcessBinarySearchPaths(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test agent is a shell script")
+	}
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+	// the agent is only in a directory that's not in PATH
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "clauder-test-agent"), []byte("#!/bin/sh\necho found-agent\nsleep 5\n"), 0o755))
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	config := StartProcessConfig{Program: "clauder-test-agent", TerminalWidth: 80, TerminalHeight: 24}
+
+	_, err := StartProcess(ctx, config)
+	require.Error(t, err)
+
+	config.BinarySearchPaths = []string{filepath.Join(dir, "missing"), dir}
+	p, err := StartProcess(ctx, config)
+	require.NoError(t, err)
+	defer p.Close(slog.New(slog.NewTextHandler(io.Discard, nil)), time.Second)
+	require.Eventually(t, func() bool {
+		return strings.Contains(p.ReadScreen(), "found-agent")
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,64 @@
+package termexec
+
+import (
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	// DefaultWriteChunkSize is StartProcessConfig.WriteChunkSize if it
+	// isn't set. It's the size of the input buffer of a terminal on Linux
+	// (N_TTY_BUF_SIZE); there's no portable way to query it.
+	DefaultWriteChunkSize = 4096
+	// DefaultWriteChunkDelay is StartProcessConfig.WriteChunkDelay if it
+	// isn't set.
+	DefaultWriteChunkDelay = 10 * time.Millisecond
+)
+
+// writeChunker splits large writes to a pseudo terminal. The kernel
+// drops the input that doesn't fit in the terminal's input buffer, so a
+// long message written at once is silently truncated if the process
+// doesn't read it fast enough.
+type writeChunker struct {
+	size  int
+	delay time.Duration
+	sleep func(time.Duration)
+}
+
+// newWriteChunker returns the chunker for the chunk size and delay of a
+// StartProcessConfig, applying their defaults.
+func newWriteChunker(size int, delay time.Duration) (*writeChunker, error) {
+	if size < 0 {
+		return nil, xerrors.Errorf("invalid write chunk size of %d bytes", size)
+	}
+	if delay < 0 {
+		return nil, xerrors.Errorf("invalid write chunk delay of %v", delay)
+	}
+	if size == 0 {
+		size = DefaultWriteChunkSize
+	}
+	if delay == 0 {
+		delay = DefaultWriteChunkDelay
+	}
+	return &writeChunker{size: size, delay: delay, sleep: time.Sleep}, nil
+}
+
+// write writes data with write in chunks of up to the chunk size, waiting
+// for the delay between them.
+func (c *writeChunker) write(write func([]byte) (int, error), data []byte) (int, error) {
+	written := 0
+	for len(data) > 0 {
+		if written > 0 {
+			c.sleep(c.delay)
+		}
+		chunk := data[:min(len(data), c.size)]
+		n, err := write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		data = data[len(chunk):]
+	}
+	return written, nil
+}
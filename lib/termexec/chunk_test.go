@@ -0,0 +1,95 @@
+package termexec
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteChunkerConfig(t *testing.T) {
+	chunker, err := newWriteChunker(0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, DefaultWriteChunkSize, chunker.size)
+	assert.Equal(t, DefaultWriteChunkDelay, chunker.delay)
+
+	_, err = newWriteChunker(-1, 0)
+	assert.Error(t, err)
+	_, err = newWriteChunker(0, -time.Millisecond)
+	assert.Error(t, err)
+}
+
+func TestProcessWriteChunks(t *testing.T) {
+	if _, err := exec.LookPath("wc"); err != nil {
+		t.Skip("wc not found")
+	}
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer r.Close()
+	cmd := exec.Command("wc", "-c")
+	cmd.Stdin = r
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	require.NoError(t, cmd.Start())
+
+	p := newTestProcess(t, strings.NewReader(""))
+	p.chunker, err = newWriteChunker(0, 0)
+	require.NoError(t, err)
+	var sleeps []time.Duration
+	p.chunker.sleep = func(d time.Duration) {
+		sleeps = append(sleeps, d)
+		time.Sleep(d)
+	}
+	in := &chunkRecorder{}
+	p.term.in = io.MultiWriter(w, in)
+
+	data := bytes.Repeat([]byte("x"), DefaultWriteChunkSize+1)
+	n, err := p.Write(data)
+	require.NoError(t, err)
+	assert.Equal(t, len(data), n)
+	require.NoError(t, w.Close())
+	require.NoError(t, cmd.Wait())
+
+	assert.Equal(t, strconv.Itoa(len(data)), strings.TrimSpace(out.String()), "the process received all of the input")
+	assert.Equal(t, []int{DefaultWriteChunkSize, 1}, in.chunks)
+	assert.Equal(t, []time.Duration{DefaultWriteChunkDelay}, sleeps)
+
+	// small writes aren't delayed
+	in.chunks = nil
+	p.term.in = in
+	_, err = p.Write([]byte("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, []int{5}, in.chunks)
+	assert.Len(t, sleeps, 1)
+}
+
+func BenchmarkChunkedWrites(b *testing.B) {
+	data := bytes.Repeat([]byte("x"), 4*DefaultWriteChunkSize)
+	for _, chunked := range []bool{false, true} {
+		name := "single"
+		if chunked {
+			name = "chunked"
+		}
+		b.Run(name, func(b *testing.B) {
+			p := newTestProcess(b, strings.NewReader(""))
+			if chunked {
+				var err error
+				p.chunker, err = newWriteChunker(0, 0)
+				require.NoError(b, err)
+			}
+			b.SetBytes(int64(len(data)))
+			for range b.N {
+				if _, err := p.Write(data); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package termexec
+
+import (
+	"slices"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// Color profiles of StartProcessConfig.ColorProfile.
+const (
+	ColorProfileNone      = "none"
+	ColorProfileANSI      = "ansi"
+	ColorProfile256       = "256color"
+	ColorProfileTrueColor = "truecolor"
+)
+
+// ColorProfiles are the valid values of StartProcessConfig.ColorProfile,
+// besides "" which keeps the default.
+var ColorProfiles = []string{ColorProfileNone, ColorProfileANSI, ColorProfile256, ColorProfileTrueColor}
+
+// DefaultTermType is the terminal type of processes by default. vt100 is
+// the terminal type that the vt10x library emulates. Setting it signals to
+// the process that it should only use compatible escape sequences.
+const DefaultTermType = "vt100"
+
+// colorProfileTermTypes are the terminal types set for the color profiles
+// if StartProcessConfig.TermType is empty.
+var colorProfileTermTypes = map[string]string{
+	ColorProfileNone:      DefaultTermType,
+	ColorProfileANSI:      "xterm",
+	ColorProfile256:       "xterm-256color",
+	ColorProfileTrueColor: "xterm-256color",
+}
+
+// validateTerminal checks the terminal type and color profile of a
+// StartProcessConfig.
+func validateTerminal(args StartProcessConfig) error {
+	if strings.ContainsAny(args.TermType, "=\x00 \t\n") {
+		return xerrors.Errorf("invalid terminal type %q", args.TermType)
+	}
+	if args.ColorProfile != "" && !slices.Contains(ColorProfiles, args.ColorProfile) {
+		return xerrors.Errorf("invalid color profile %q, expected one of %v", args.ColorProfile, ColorProfiles)
+	}
+	return nil
+}
+
+// terminalEnv returns the TERM and COLORTERM variables of a process with
+// the given terminal type and color profile, and NO_COLOR if it shouldn't
+// print colors at all. The variables with an empty value are unset. The
+// terminal type defaults to one that supports the color profile.
+func terminalEnv(termType, colorProfile string) map[string]string {
+	if termType == "" {
+		termType = DefaultTermType
+		if colorProfile != "" {
+			termType = colorProfileTermTypes[colorProfile]
+		}
+	}
+	env := map[string]string{"TERM": termType}
+	switch colorProfile {
+	case ColorProfileNone:
+		env["COLORTERM"] = ""
+		env["NO_COLOR"] = "1"
+	case ColorProfileANSI, ColorProfile256:
+		env["COLORTERM"] = ""
+	case ColorProfileTrueColor:
+		env["COLORTERM"] = "truecolor"
+	}
+	return env
+}
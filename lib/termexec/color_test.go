@@ -0,0 +1,71 @@
+package termexec
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+)
+
+func TestTerminalEnv(t *testing.T) {
+	t.Setenv("COLORTERM", "24bit")
+	for _, test := range []struct {
+		termType, colorProfile string
+		want                   []string
+		unset                  []string
+	}{
+		{"", "", []string{"TERM=vt100", "COLORTERM=24bit"}, nil},
+		{"xterm", "", []string{"TERM=xterm", "COLORTERM=24bit"}, nil},
+		{"", ColorProfileNone, []string{"TERM=vt100", "NO_COLOR=1"}, []string{"COLORTERM"}},
+		{"", ColorProfileANSI, []string{"TERM=xterm"}, []string{"COLORTERM"}},
+		{"", ColorProfile256, []string{"TERM=xterm-256color"}, []string{"COLORTERM"}},
+		{"", ColorProfileTrueColor, []string{"TERM=xterm-256color", "COLORTERM=truecolor"}, nil},
+		{"xterm-truecolor", ColorProfileTrueColor, []string{"TERM=xterm-truecolor", "COLORTERM=truecolor"}, nil},
+	} {
+		env := processEnv(map[string]string{"TERM": "extra"}, terminalEnv(test.termType, test.colorProfile))
+		for _, kv := range test.want {
+			assert.Contains(t, env, kv, "%s %s", test.termType, test.colorProfile)
+		}
+		for _, kv := range env {
+			key, _, _ := strings.Cut(kv, "=")
+			assert.NotContains(t, test.unset, key, "%s %s", test.termType, test.colorProfile)
+		}
+		assert.True(t, strings.HasPrefix(env[len(env)-1], "TERM="))
+	}
+}
+
+func TestStartProcessTerminal(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	start := func(termType, colorProfile string) (*Process, error) {
+		return StartProcess(ctx, StartProcessConfig{
+			Program:        "sh",
+			Args:           []string{"-c", `echo "term=$TERM colorterm=$COLORTERM"; sleep 5`},
+			TerminalWidth:  80,
+			TerminalHeight: 24,
+			TermType:       termType,
+			ColorProfile:   colorProfile,
+		})
+	}
+
+	p, err := start("xterm", ColorProfileTrueColor)
+	require.NoError(t, err)
+	defer p.Close(slog.New(slog.NewTextHandler(io.Discard, nil)), time.Second)
+	require.Eventually(t, func() bool {
+		return strings.Contains(p.ReadScreen(), "term=xterm colorterm=truecolor")
+	}, 5*time.Second, 10*time.Millisecond, p.ReadScreen())
+
+	_, err = start("", "16color")
+	assert.ErrorContains(t, err, `invalid color profile "16color"`)
+	_, err = start("xterm 256", "")
+	assert.ErrorContains(t, err, "invalid terminal type")
+}
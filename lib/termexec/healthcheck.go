@@ -0,0 +1,129 @@
+package termexec
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	"golang.org/x/xerrors"
+)
+
+// ErrAgentUnhealthy is returned by StartProcess when the process's health
+// check didn't pass within StartProcessConfig.StartupTimeout.
+var ErrAgentUnhealthy = xerrors.New("the agent didn't pass its health check")
+
+const (
+	// DefaultStartupTimeout is how long StartProcess waits for the health
+	// check to pass unless StartProcessConfig.StartupTimeout is set.
+	DefaultStartupTimeout = readyTimeout
+	// DefaultHealthCheckInterval is how long to wait between the attempts
+	// of a health check unless HealthCheckConfig.Interval is set.
+	DefaultHealthCheckInterval = 500 * time.Millisecond
+)
+
+// HealthCheckConfig is a local HTTP endpoint of the process, like the ones
+// some Goose plugins expose, that tells whether it finished loading models
+// or connecting to APIs, which its screen may not show.
+type HealthCheckConfig struct {
+	// URL is requested with GET.
+	URL string
+	// ExpectedStatus is the status code of a healthy process, 200 by
+	// default.
+	ExpectedStatus int
+	// Retries is how many times a failed check is retried, or 0 to retry
+	// until the startup timeout.
+	Retries int
+	// Interval is the time between the checks, DefaultHealthCheckInterval
+	// by default.
+	Interval time.Duration
+}
+
+func (c *HealthCheckConfig) validate() error {
+	if c.URL == "" {
+		return xerrors.New("the health check URL is empty")
+	}
+	if c.ExpectedStatus != 0 && (c.ExpectedStatus < 100 || c.ExpectedStatus > 599) {
+		return xerrors.Errorf("invalid expected health check status %d", c.ExpectedStatus)
+	}
+	if c.Retries < 0 || c.Interval < 0 {
+		return xerrors.New("the health check retries and interval must not be negative")
+	}
+	return nil
+}
+
+// check requests the URL once.
+func (c *HealthCheckConfig) check(ctx context.Context, client *http.Client) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.URL, nil)
+	if err != nil {
+		return xerrors.Errorf("failed to create the health check request: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	expected := c.ExpectedStatus
+	if expected == 0 {
+		expected = http.StatusOK
+	}
+	if resp.StatusCode != expected {
+		return xerrors.Errorf("status %d, expected %d", resp.StatusCode, expected)
+	}
+	return nil
+}
+
+// waitHealthy waits for the process to be ready, like before pre-injecting
+// input, and then for the health check to pass, until deadline.
+func (p *Process) waitHealthy(ctx context.Context, check *HealthCheckConfig, deadline time.Time) error {
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+	if err := p.waitReady(ctx); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return xerrors.Errorf("timed out waiting for the process to be ready: %w", ErrAgentUnhealthy)
+		}
+		return err
+	}
+	interval := check.Interval
+	if interval == 0 {
+		interval = DefaultHealthCheckInterval
+	}
+	client := &http.Client{}
+	for attempt := 0; ; attempt++ {
+		err := check.check(ctx, client)
+		if err == nil {
+			return nil
+		}
+		logctx.From(ctx).Debug("Health check failed", "url", check.URL, "attempt", attempt+1, "error", err)
+		if check.Retries > 0 && attempt >= check.Retries {
+			return xerrors.Errorf("%s failed %d times, last with %v: %w", check.URL, attempt+1, err, ErrAgentUnhealthy)
+		}
+		if sleepErr := p.sleep(ctx, interval); sleepErr != nil {
+			if ctx.Err() == context.DeadlineExceeded {
+				return xerrors.Errorf("%s didn't pass in time, last failed with %v: %w", check.URL, err, ErrAgentUnhealthy)
+			}
+			return sleepErr
+		}
+	}
+}
+
+// sleep waits for d. It fails if ctx is done or the terminal reader stopped
+// in the meantime.
+func (p *Process) sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case _, ok := <-p.heartbeat:
+			if !ok {
+				return xerrors.New("the terminal was closed")
+			}
+		case <-timer.C:
+			return nil
+		}
+	}
+}
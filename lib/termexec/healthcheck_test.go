@@ -0,0 +1,100 @@
+package termexec
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+)
+
+// newHealthEndpoint returns a health endpoint that responds with 503 to the
+// first unhealthy requests, and with 204 afterwards.
+func newHealthEndpoint(t *testing.T, unhealthy int32) (*httptest.Server, *atomic.Int32) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= unhealthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func TestStartProcessHealthCheck(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sh isn't available on Windows")
+	}
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	config := func(check HealthCheckConfig) StartProcessConfig {
+		return StartProcessConfig{
+			Program:        "sh",
+			Args:           []string{"-c", "echo loading; sleep 5"},
+			TerminalWidth:  80,
+			TerminalHeight: 24,
+			HealthCheck:    &check,
+			StartupTimeout: 3 * time.Second,
+		}
+	}
+
+	t.Run("Healthy", func(t *testing.T) {
+		endpoint, requests := newHealthEndpoint(t, 3)
+		start := time.Now()
+		p, err := StartProcess(ctx, config(HealthCheckConfig{URL: endpoint.URL, ExpectedStatus: http.StatusNoContent, Interval: 50 * time.Millisecond}))
+		require.NoError(t, err)
+		defer p.Close(logger, time.Second)
+		assert.Equal(t, int32(4), requests.Load())
+		// the endpoint is only checked once the process is ready
+		assert.GreaterOrEqual(t, time.Since(start), readySettleTime+3*50*time.Millisecond)
+	})
+
+	t.Run("RetriesExhausted", func(t *testing.T) {
+		endpoint, requests := newHealthEndpoint(t, 10)
+		_, err := StartProcess(ctx, config(HealthCheckConfig{URL: endpoint.URL, ExpectedStatus: http.StatusNoContent, Retries: 2, Interval: 10 * time.Millisecond}))
+		require.ErrorIs(t, err, ErrAgentUnhealthy)
+		assert.ErrorContains(t, err, "failed 3 times, last with status 503, expected 204")
+		assert.Equal(t, int32(3), requests.Load())
+	})
+
+	t.Run("StartupTimeout", func(t *testing.T) {
+		endpoint, _ := newHealthEndpoint(t, 0)
+		start := time.Now()
+		// the endpoint is healthy, but with another status
+		unhealthy := config(HealthCheckConfig{URL: endpoint.URL, Interval: 100 * time.Millisecond})
+		unhealthy.StartupTimeout = time.Second
+		_, err := StartProcess(ctx, unhealthy)
+		require.ErrorIs(t, err, ErrAgentUnhealthy)
+		assert.ErrorContains(t, err, "didn't pass in time, last failed with status 204, expected 200")
+		elapsed := time.Since(start)
+		assert.GreaterOrEqual(t, elapsed, time.Second)
+		// closing the process takes up to a second
+		assert.Less(t, elapsed, 3*time.Second)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, check := range []HealthCheckConfig{
+			{},
+			{URL: "http://localhost", ExpectedStatus: 42},
+			{URL: "http://localhost", Retries: -1},
+		} {
+			_, err := StartProcess(ctx, config(check))
+			assert.Error(t, err, check)
+			assert.NotErrorIs(t, err, ErrAgentUnhealthy, check)
+		}
+	})
+}
@@ -0,0 +1,99 @@
+package termexec
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// ErrLazyProcessClosed is returned by a LazyProcess that's used after it was
+// closed.
+var ErrLazyProcessClosed = xerrors.New("the process was closed before it was started")
+
+// LazyProcess starts a process the first time it's written to or its screen
+// is read, so that agents that are never used don't take up resources.
+// It's safe for concurrent use, and the process is started at most once.
+type LazyProcess struct {
+	ctx    context.Context
+	config StartProcessConfig
+	// startProcess is StartProcess, and is replaced in tests.
+	startProcess func(context.Context, StartProcessConfig) (*Process, error)
+
+	once    sync.Once
+	started atomic.Bool
+	process *Process
+	err     error
+}
+
+// NewLazyProcess returns a LazyProcess that starts a process with config.
+// ctx is used when the process is started.
+func NewLazyProcess(ctx context.Context, config StartProcessConfig) *LazyProcess {
+	return &LazyProcess{ctx: ctx, config: config, startProcess: StartProcess}
+}
+
+// NewLazyProcessFunc returns a LazyProcess that's started by start, e.g. to
+// take the process from a ProcessPool. ctx is passed to start.
+func NewLazyProcessFunc(ctx context.Context, start func(ctx context.Context) (*Process, error)) *LazyProcess {
+	return &LazyProcess{ctx: ctx, startProcess: func(ctx context.Context, _ StartProcessConfig) (*Process, error) {
+		return start(ctx)
+	}}
+}
+
+// Start starts the process if it hasn't been started yet, and returns it.
+// Every call after the first returns the same process, or the same error.
+func (p *LazyProcess) Start() (*Process, error) {
+	p.once.Do(func() {
+		p.process, p.err = p.startProcess(p.ctx, p.config)
+		p.started.Store(true)
+	})
+	return p.process, p.err
+}
+
+// IsStarted reports whether the process was started, or failed to start.
+func (p *LazyProcess) IsStarted() bool {
+	return p.started.Load()
+}
+
+// Process returns the process if it was started, or nil if it wasn't or
+// failed to start. Unlike the other methods, it doesn't start the process.
+func (p *LazyProcess) Process() *Process {
+	if !p.started.Load() {
+		return nil
+	}
+	return p.process
+}
+
+// Write starts the process if needed, and writes data to it.
+func (p *LazyProcess) Write(data []byte) (int, error) {
+	process, err := p.Start()
+	if err != nil {
+		return 0, err
+	}
+	return process.Write(data)
+}
+
+// ReadScreen starts the process if needed, and returns its screen. It
+// returns an empty screen if the process failed to start.
+func (p *LazyProcess) ReadScreen() string {
+	process, err := p.Start()
+	if err != nil {
+		return ""
+	}
+	return process.ReadScreen()
+}
+
+// Close closes the process if it was started. A process that wasn't started
+// won't be anymore.
+func (p *LazyProcess) Close(logger *slog.Logger, timeout time.Duration) error {
+	p.once.Do(func() {
+		p.err = ErrLazyProcessClosed
+	})
+	if p.process == nil {
+		return nil
+	}
+	return p.process.Close(logger, timeout)
+}
@@ -0,0 +1,110 @@
+package termexec
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+)
+
+func TestLazyProcessStartsOnce(t *testing.T) {
+	input := &lockedBuffer{}
+	var starts atomic.Int32
+	p := NewLazyProcess(context.Background(), StartProcessConfig{Program: "claude"})
+	p.startProcess = func(ctx context.Context, config StartProcessConfig) (*Process, error) {
+		starts.Add(1)
+		assert.Equal(t, "claude", config.Program)
+		// give the other writers time to race for the start
+		time.Sleep(10 * time.Millisecond)
+		process := newTestProcess(t, strings.NewReader(""))
+		process.term.in = input
+		return process, nil
+	}
+	assert.False(t, p.IsStarted())
+	assert.Nil(t, p.Process())
+
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			n, err := p.Write([]byte("x"))
+			assert.NoError(t, err)
+			assert.Equal(t, 1, n)
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), starts.Load())
+	assert.True(t, p.IsStarted())
+	assert.Equal(t, strings.Repeat("x", 50), input.String())
+	process, err := p.Start()
+	require.NoError(t, err)
+	assert.NotNil(t, process)
+	assert.Same(t, process, p.Process())
+	assert.Equal(t, int32(1), starts.Load())
+}
+
+func TestLazyProcessFunc(t *testing.T) {
+	type ctxKey struct{}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "workspace")
+	var starts atomic.Int32
+	p := NewLazyProcessFunc(ctx, func(ctx context.Context) (*Process, error) {
+		starts.Add(1)
+		assert.Equal(t, "workspace", ctx.Value(ctxKey{}))
+		return newTestProcess(t, strings.NewReader("")), nil
+	})
+	assert.Nil(t, p.Process())
+	assert.Equal(t, int32(0), starts.Load())
+	process, err := p.Start()
+	require.NoError(t, err)
+	assert.Same(t, process, p.Process())
+	assert.Equal(t, int32(1), starts.Load())
+}
+
+func TestLazyProcessStartsOnRead(t *testing.T) {
+	p := NewLazyProcess(context.Background(), StartProcessConfig{})
+	p.startProcess = func(ctx context.Context, config StartProcessConfig) (*Process, error) {
+		return newTestProcess(t, strings.NewReader("")), nil
+	}
+	assert.Empty(t, strings.TrimSpace(p.ReadScreen()))
+	assert.True(t, p.IsStarted())
+}
+
+func TestLazyProcessStartFailure(t *testing.T) {
+	var starts atomic.Int32
+	p := NewLazyProcess(context.Background(), StartProcessConfig{})
+	p.startProcess = func(ctx context.Context, config StartProcessConfig) (*Process, error) {
+		starts.Add(1)
+		return nil, xerrors.New("no such program")
+	}
+	_, err := p.Write([]byte("hi"))
+	assert.ErrorContains(t, err, "no such program")
+	_, err = p.Write([]byte("hi"))
+	assert.ErrorContains(t, err, "no such program")
+	assert.Equal(t, "", p.ReadScreen())
+	assert.True(t, p.IsStarted())
+	assert.Nil(t, p.Process())
+	assert.Equal(t, int32(1), starts.Load())
+}
+
+func TestLazyProcessClose(t *testing.T) {
+	p := NewLazyProcess(context.Background(), StartProcessConfig{})
+	p.startProcess = func(ctx context.Context, config StartProcessConfig) (*Process, error) {
+		t.Error("the process was started after it was closed")
+		return nil, nil
+	}
+	assert.NoError(t, p.Close(nil, time.Second))
+	_, err := p.Write([]byte("hi"))
+	assert.ErrorIs(t, err, ErrLazyProcessClosed)
+	assert.False(t, p.IsStarted())
+}
@@ -0,0 +1,164 @@
+package termexec
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	"golang.org/x/xerrors"
+)
+
+// ErrProcessPoolClosed is returned by Acquire once the pool's context is
+// done.
+var ErrProcessPoolClosed = xerrors.New("the process pool was closed")
+
+// poolCloseTimeout is how long the processes left in a closed pool have to
+// exit after they're interrupted.
+const poolCloseTimeout = 5 * time.Second
+
+// warmProcess is a process that finished warming up, or the reason it
+// couldn't be started.
+type warmProcess struct {
+	process *Process
+	err     error
+}
+
+// ProcessPool keeps processes started ahead of time, so that agents that
+// take seconds to start are ready as soon as they're needed. Every process
+// is started with the same config, so its Output, if set, receives the
+// output of all of them.
+type ProcessPool struct {
+	ctx    context.Context
+	config StartProcessConfig
+	size   int
+	logger *slog.Logger
+	// startProcess and closeProcess start and close the processes, and
+	// are replaced in tests.
+	startProcess func(context.Context, StartProcessConfig) (*Process, error)
+	closeProcess func(*Process)
+
+	// ready holds the processes that are ready to be acquired. mu keeps
+	// processes from being added to it once the pool is closed.
+	ready  chan warmProcess
+	mu     sync.Mutex
+	closed bool
+}
+
+// NewProcessPool returns a pool that starts size processes with config in
+// the background, and starts a new one every time one is acquired. Once
+// ctx is done, the processes that weren't acquired are closed.
+func NewProcessPool(ctx context.Context, config StartProcessConfig, size int) *ProcessPool {
+	p := newProcessPool(ctx, config, size, StartProcess)
+	p.start()
+	return p
+}
+
+func newProcessPool(ctx context.Context, config StartProcessConfig, size int, startProcess func(context.Context, StartProcessConfig) (*Process, error)) *ProcessPool {
+	logger := logctx.From(ctx)
+	return &ProcessPool{
+		ctx:          ctx,
+		config:       config,
+		size:         size,
+		logger:       logger,
+		startProcess: startProcess,
+		closeProcess: func(process *Process) {
+			if err := process.Close(logger, poolCloseTimeout); err != nil {
+				logger.Error("Failed to close pooled process", "error", err)
+			}
+		},
+		ready: make(chan warmProcess, size),
+	}
+}
+
+// start warms up the initial processes, and closes the pool once its
+// context is done.
+func (p *ProcessPool) start() {
+	for range p.size {
+		go p.warm()
+	}
+	go func() {
+		<-p.ctx.Done()
+		p.mu.Lock()
+		p.closed = true
+		p.mu.Unlock()
+		for {
+			select {
+			case warm := <-p.ready:
+				if warm.process != nil {
+					p.closeProcess(warm.process)
+				}
+			default:
+				return
+			}
+		}
+	}()
+}
+
+// warm starts a process and adds it to the pool.
+func (p *ProcessPool) warm() {
+	if p.ctx.Err() != nil {
+		return
+	}
+	process, err := p.startProcess(p.ctx, p.config)
+	if err != nil && p.ctx.Err() == nil {
+		p.logger.Warn("Failed to warm up a process", "program", p.config.Program, "error", err)
+	}
+	p.put(warmProcess{process: process, err: err})
+}
+
+// put adds a process to the pool, or closes it if the pool is full or
+// closed.
+func (p *ProcessPool) put(warm warmProcess) {
+	p.mu.Lock()
+	if !p.closed {
+		select {
+		case p.ready <- warm:
+			p.mu.Unlock()
+			return
+		default:
+		}
+	}
+	p.mu.Unlock()
+	if warm.process != nil {
+		p.closeProcess(warm.process)
+	}
+}
+
+// Ready returns the number of processes that can be acquired without
+// waiting.
+func (p *ProcessPool) Ready() int {
+	return len(p.ready)
+}
+
+// Acquire takes a process out of the pool and starts warming up a new one.
+// If none is ready, it waits for the next one, until ctx is done. It
+// returns the error of a process that failed to start, so that a broken
+// config doesn't go unnoticed.
+func (p *ProcessPool) Acquire(ctx context.Context) (*Process, error) {
+	if p.ctx.Err() != nil {
+		return nil, ErrProcessPoolClosed
+	}
+	select {
+	case <-p.ctx.Done():
+		return nil, ErrProcessPoolClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case warm := <-p.ready:
+		go p.warm()
+		if warm.err != nil {
+			return nil, xerrors.Errorf("failed to warm up the process: %w", warm.err)
+		}
+		return warm.process, nil
+	}
+}
+
+// Release returns a process that was acquired but not used, e.g. because
+// the session it was acquired for failed to start, so that it's acquired
+// again. If the pool is full or closed, the process is closed instead. A
+// process that was used must be closed instead of released, since it
+// keeps its conversation.
+func (p *ProcessPool) Release(process *Process) {
+	p.put(warmProcess{process: process})
+}
@@ -0,0 +1,134 @@
+package termexec
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	"golang.org/x/xerrors"
+)
+
+// fakePool is a pool whose processes are started once a value is sent to
+// starts, and records the processes it closes.
+type fakePool struct {
+	*ProcessPool
+	starts  chan error
+	started atomic.Int32
+
+	mu     sync.Mutex
+	closed []*Process
+}
+
+func newFakePool(t *testing.T, ctx context.Context, size int) *fakePool {
+	f := &fakePool{starts: make(chan error)}
+	f.ProcessPool = newProcessPool(ctx, StartProcessConfig{Program: "claude"}, size, func(ctx context.Context, config StartProcessConfig) (*Process, error) {
+		assert.Equal(t, "claude", config.Program)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case err := <-f.starts:
+			if err != nil {
+				return nil, err
+			}
+		}
+		f.started.Add(1)
+		return newTestProcess(t, strings.NewReader("")), nil
+	})
+	f.closeProcess = func(process *Process) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.closed = append(f.closed, process)
+	}
+	f.start()
+	return f
+}
+
+func (f *fakePool) closedCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.closed)
+}
+
+func TestProcessPoolReplenishes(t *testing.T) {
+	ctx, cancel := context.WithCancel(logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil))))
+	defer cancel()
+	pool := newFakePool(t, ctx, 2)
+	pool.starts <- nil
+	pool.starts <- nil
+	require.Eventually(t, func() bool { return pool.Ready() == 2 }, 5*time.Second, time.Millisecond)
+
+	process, err := pool.Acquire(ctx)
+	require.NoError(t, err)
+	assert.NotNil(t, process)
+	assert.Equal(t, 1, pool.Ready())
+	// acquiring a process starts warming up another one
+	pool.starts <- nil
+	require.Eventually(t, func() bool { return pool.Ready() == 2 }, 5*time.Second, time.Millisecond)
+	assert.Equal(t, int32(3), pool.started.Load())
+
+	// the pool is full, so a released process is closed
+	pool.Release(process)
+	assert.Equal(t, 1, pool.closedCount())
+}
+
+func TestProcessPoolExhausted(t *testing.T) {
+	ctx, cancel := context.WithCancel(logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil))))
+	defer cancel()
+	pool := newFakePool(t, ctx, 1)
+	pool.starts <- nil
+	first, err := pool.Acquire(ctx)
+	require.NoError(t, err)
+
+	// the replacement is still warming up
+	acquireCtx, acquireCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer acquireCancel()
+	_, err = pool.Acquire(acquireCtx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// Acquire waits for the replacement
+	acquired := make(chan *Process)
+	go func() {
+		process, err := pool.Acquire(ctx)
+		assert.NoError(t, err)
+		acquired <- process
+	}()
+	pool.starts <- nil
+	select {
+	case second := <-acquired:
+		assert.NotSame(t, first, second)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the replacement wasn't acquired")
+	}
+
+	// a process that fails to start is reported by Acquire
+	pool.starts <- xerrors.New("claude not found")
+	_, err = pool.Acquire(ctx)
+	assert.ErrorContains(t, err, "failed to warm up the process: claude not found")
+}
+
+func TestProcessPoolCanceledDuringWarmup(t *testing.T) {
+	ctx, cancel := context.WithCancel(logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil))))
+	pool := newFakePool(t, ctx, 2)
+	pool.starts <- nil
+	require.Eventually(t, func() bool { return pool.Ready() == 1 }, 5*time.Second, time.Millisecond)
+
+	// the second process is still warming up
+	cancel()
+	_, err := pool.Acquire(context.Background())
+	assert.ErrorIs(t, err, ErrProcessPoolClosed)
+	require.Eventually(t, func() bool { return pool.closedCount() == 1 }, 5*time.Second, time.Millisecond, "the ready process is closed")
+	assert.Equal(t, 0, pool.Ready())
+	assert.Equal(t, int32(1), pool.started.Load(), "the warm-up is canceled")
+
+	// processes released to a closed pool are closed
+	pool.Release(newTestProcess(t, strings.NewReader("")))
+	assert.Equal(t, 2, pool.closedCount())
+}
@@ -0,0 +1,29 @@
+package termexec
+
+import (
+	"slices"
+
+	"golang.org/x/xerrors"
+)
+
+// IO priority classes of StartProcessConfig.IOPriorityClass.
+const (
+	IOPriorityIdle       = "idle"
+	IOPriorityBestEffort = "best-effort"
+	IOPriorityRealtime   = "realtime"
+)
+
+// IOPriorityClasses are the valid values of StartProcessConfig.IOPriorityClass,
+// besides "" which leaves the IO priority unchanged.
+var IOPriorityClasses = []string{IOPriorityIdle, IOPriorityBestEffort, IOPriorityRealtime}
+
+// validatePriority checks the priority fields of a StartProcessConfig.
+func validatePriority(args StartProcessConfig) error {
+	if args.NicePriority < -20 || args.NicePriority > 19 {
+		return xerrors.Errorf("nice priority %d is not between -20 and 19", args.NicePriority)
+	}
+	if args.IOPriorityClass != "" && !slices.Contains(IOPriorityClasses, args.IOPriorityClass) {
+		return xerrors.Errorf("invalid IO priority class %q, expected one of %v", args.IOPriorityClass, IOPriorityClasses)
+	}
+	return nil
+}
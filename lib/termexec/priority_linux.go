@@ -0,0 +1,44 @@
+package termexec
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+	"golang.org/x/xerrors"
+)
+
+// See ioprio_set(2).
+const (
+	ioprioWhoProcess = 1
+	ioprioClassShift = 13
+	// ioprioDefaultLevel is the level within the best-effort and realtime
+	// classes, from 0 (highest) to 7.
+	ioprioDefaultLevel = 4
+)
+
+var ioprioClasses = map[string]int{
+	IOPriorityRealtime:   1,
+	IOPriorityBestEffort: 2,
+	IOPriorityIdle:       3,
+}
+
+// setPriority sets the nice value and the IO priority class of the process
+// with the given pid. Both are left unchanged if they're zero values.
+func setPriority(pid int, nice int, ioClass string) error {
+	if nice != 0 {
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, pid, nice); err != nil {
+			return xerrors.Errorf("failed to set nice priority: %w", err)
+		}
+	}
+	if ioClass != "" {
+		level := ioprioDefaultLevel
+		if ioClass == IOPriorityIdle {
+			level = 0
+		}
+		prio := ioprioClasses[ioClass]<<ioprioClassShift | level
+		if _, _, errno := syscall.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(pid), uintptr(prio)); errno != 0 {
+			return xerrors.Errorf("failed to set IO priority: %w", errno)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package termexec
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	"golang.org/x/sys/unix"
+)
+
+// readNice returns the nice value of a process from /proc/<pid>/stat.
+func readNice(t *testing.T, pid int) int {
+	t.Helper()
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	require.NoError(t, err)
+	// the command name in parentheses can contain spaces, so the fields
+	// are counted from the end of it. nice is the 19th field.
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	nice, err := strconv.Atoi(fields[19-3])
+	require.NoError(t, err)
+	return nice
+}
+
+func TestStartProcessPriority(t *testing.T) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("sleep not found")
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ctx := logctx.WithLogger(context.Background(), logger)
+	p, err := StartProcess(ctx, StartProcessConfig{
+		Program:         "sleep",
+		Args:            []string{"5"},
+		TerminalWidth:   80,
+		TerminalHeight:  24,
+		NicePriority:    10,
+		IOPriorityClass: IOPriorityIdle,
+	})
+	require.NoError(t, err)
+	defer p.Close(logger, time.Second)
+
+	assert.Equal(t, 10, readNice(t, p.process.Pid))
+	prio, _, errno := syscall.Syscall(unix.SYS_IOPRIO_GET, ioprioWhoProcess, uintptr(p.process.Pid), 0)
+	require.Zero(t, errno)
+	assert.Equal(t, ioprioClasses[IOPriorityIdle], int(prio)>>ioprioClassShift)
+}
@@ -0,0 +1,23 @@
+//go:build !linux && !windows
+
+package termexec
+
+import (
+	"syscall"
+
+	"golang.org/x/xerrors"
+)
+
+// setPriority sets the nice value of the process with the given pid. IO
+// priorities can only be set on Linux.
+func setPriority(pid int, nice int, ioClass string) error {
+	if nice != 0 {
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, pid, nice); err != nil {
+			return xerrors.Errorf("failed to set nice priority: %w", err)
+		}
+	}
+	if ioClass != "" {
+		return xerrors.Errorf("IO priorities are only supported on Linux")
+	}
+	return nil
+}
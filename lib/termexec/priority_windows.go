@@ -0,0 +1,44 @@
+//go:build windows
+
+package termexec
+
+import (
+	"golang.org/x/sys/windows"
+	"golang.org/x/xerrors"
+)
+
+// priorityClass returns the Windows priority class closest to a nice value.
+func priorityClass(nice int) uint32 {
+	switch {
+	case nice >= 15:
+		return windows.IDLE_PRIORITY_CLASS
+	case nice >= 5:
+		return windows.BELOW_NORMAL_PRIORITY_CLASS
+	case nice <= -15:
+		return windows.HIGH_PRIORITY_CLASS
+	case nice <= -5:
+		return windows.ABOVE_NORMAL_PRIORITY_CLASS
+	default:
+		return windows.NORMAL_PRIORITY_CLASS
+	}
+}
+
+// setPriority sets the priority class of the process with the given pid
+// to the one closest to the nice value. IO priorities can only be set on
+// Linux.
+func setPriority(pid int, nice int, ioClass string) error {
+	if nice != 0 {
+		handle, err := windows.OpenProcess(windows.PROCESS_SET_INFORMATION, false, uint32(pid))
+		if err != nil {
+			return xerrors.Errorf("failed to open process: %w", err)
+		}
+		defer windows.CloseHandle(handle)
+		if err := windows.SetPriorityClass(handle, priorityClass(nice)); err != nil {
+			return xerrors.Errorf("failed to set priority class: %w", err)
+		}
+	}
+	if ioClass != "" {
+		return xerrors.Errorf("IO priorities are only supported on Linux")
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package termexec
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	// ptyLogBufferSize is the number of writes the PTY log buffers while
+	// the file is written to. The terminal reader writes every rune
+	// separately, so it's a few kilobytes of output at worst.
+	ptyLogBufferSize = 16 * 1024
+	// ptyLogMaxChunk is the size after which buffered writes are logged
+	// as a new chunk.
+	ptyLogMaxChunk = 32 * 1024
+	// ptyLogTimeFormat is the format of the timestamps in the PTY log.
+	ptyLogTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+)
+
+type ptyLogWrite struct {
+	time time.Time
+	data []byte
+}
+
+// ptyLog writes the output of a process to a file, in chunks preceded by a
+// line with the time the chunk's first byte was read and its length:
+//
+//	[2025-01-02T15:04:05.123456Z] 12 bytes
+//	hello world
+//
+// The chunk's bytes are followed by a newline that isn't part of the
+// output. Write never blocks: the writes are buffered and written by
+// another goroutine, which merges the ones that are waiting into a chunk.
+// If the buffer is full because the file is slow, writes are dropped and
+// a "[time] dropped n writes" line is logged.
+type ptyLog struct {
+	w       io.WriteCloser
+	writes  chan ptyLogWrite
+	dropped atomic.Int64
+	done    chan struct{}
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// openPTYLog opens the PTY log at path, appending to the file if it exists.
+func openPTYLog(path string) (*ptyLog, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to open PTY log: %w", err)
+	}
+	return newPTYLog(f, ptyLogBufferSize), nil
+}
+
+func newPTYLog(w io.WriteCloser, bufSize int) *ptyLog {
+	l := &ptyLog{w: w, writes: make(chan ptyLogWrite, bufSize), done: make(chan struct{})}
+	go l.run()
+	return l
+}
+
+// Write implements io.Writer so the log can receive the process output.
+func (l *ptyLog) Write(data []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return len(data), nil
+	}
+	select {
+	case l.writes <- ptyLogWrite{time: time.Now(), data: append([]byte(nil), data...)}:
+	default:
+		l.dropped.Add(1)
+	}
+	return len(data), nil
+}
+
+// Dropped returns the number of writes dropped because the buffer was full.
+func (l *ptyLog) Dropped() int64 {
+	return l.dropped.Load()
+}
+
+// Close writes the buffered output and closes the file.
+func (l *ptyLog) Close() error {
+	l.mu.Lock()
+	if !l.closed {
+		l.closed = true
+		close(l.writes)
+	}
+	l.mu.Unlock()
+	<-l.done
+	return l.w.Close()
+}
+
+func (l *ptyLog) run() {
+	defer close(l.done)
+	bw := bufio.NewWriter(l.w)
+	var reportedDrops int64
+	var chunk []byte
+	for write := range l.writes {
+		chunk = append(chunk[:0], write.data...)
+		// merge the writes that are already waiting
+	merge:
+		for len(chunk) < ptyLogMaxChunk {
+			select {
+			case next, ok := <-l.writes:
+				if !ok {
+					break merge
+				}
+				chunk = append(chunk, next.data...)
+			default:
+				break merge
+			}
+		}
+		timestamp := write.time.UTC().Format(ptyLogTimeFormat)
+		if dropped := l.dropped.Load(); dropped > reportedDrops {
+			fmt.Fprintf(bw, "[%s] dropped %d writes\n", timestamp, dropped-reportedDrops)
+			reportedDrops = dropped
+		}
+		fmt.Fprintf(bw, "[%s] %d bytes\n", timestamp, len(chunk))
+		bw.Write(chunk)
+		bw.WriteByte('\n')
+		// errors are ignored, like the output of a process whose
+		// terminal reader fails to write it
+		_ = bw.Flush()
+	}
+}
@@ -0,0 +1,125 @@
+package termexec
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+)
+
+var ptyLogHeader = regexp.MustCompile(`^\[(\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{6}Z)\] (?:(\d+) bytes|dropped (\d+) writes)\n`)
+
+// readPTYLog returns the output logged in a PTY log, and the number of
+// dropped writes it reports.
+func readPTYLog(t *testing.T, data []byte) ([]byte, int) {
+	t.Helper()
+	var output []byte
+	dropped := 0
+	for len(data) > 0 {
+		match := ptyLogHeader.FindSubmatch(data)
+		require.NotNil(t, match, "invalid chunk header in %q", data)
+		_, err := time.Parse(ptyLogTimeFormat, string(match[1]))
+		require.NoError(t, err)
+		data = data[len(match[0]):]
+		if match[3] != nil {
+			n, _ := strconv.Atoi(string(match[3]))
+			dropped += n
+			continue
+		}
+		n, _ := strconv.Atoi(string(match[2]))
+		require.GreaterOrEqual(t, len(data), n+1)
+		output = append(output, data[:n]...)
+		require.Equal(t, byte('\n'), data[n])
+		data = data[n+1:]
+	}
+	return output, dropped
+}
+
+func TestPTYLog(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	path := filepath.Join(t.TempDir(), "pty.log")
+	require.NoError(t, os.WriteFile(path, nil, 0o600))
+	output := &lockedBuffer{}
+	p, err := StartProcess(ctx, StartProcessConfig{
+		Program:        "sh",
+		Args:           []string{"-c", `printf 'hello\nwörld\033[1m bold\033[0m\n'; sleep 0.1; echo done`},
+		TerminalWidth:  80,
+		TerminalHeight: 24,
+		Output:         output,
+		LogFile:        path,
+	})
+	require.NoError(t, err)
+	_ = p.Wait()
+	// the log is closed once the terminal reader stops
+	require.Eventually(t, func() bool {
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		logged, _ := readPTYLog(t, data)
+		return bytes.Contains(logged, []byte("done"))
+	}, 5*time.Second, 10*time.Millisecond)
+	_ = p.Close(slog.New(slog.NewTextHandler(io.Discard, nil)), time.Second)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	logged, dropped := readPTYLog(t, data)
+	assert.Zero(t, dropped)
+	assert.Equal(t, output.String(), string(logged))
+	assert.Contains(t, string(logged), "wörld\x1b[1m bold")
+}
+
+// blockingWriter blocks every write until release is closed.
+type blockingWriter struct {
+	release chan struct{}
+	buf     bytes.Buffer
+}
+
+func (w *blockingWriter) Write(data []byte) (int, error) {
+	<-w.release
+	return w.buf.Write(data)
+}
+
+func (w *blockingWriter) Close() error { return nil }
+
+func TestPTYLogSlowFile(t *testing.T) {
+	w := &blockingWriter{release: make(chan struct{})}
+	l := newPTYLog(w, 8)
+
+	// the writes return while the file is blocked, and the ones that don't
+	// fit in the buffer are dropped
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range 100 {
+			n, err := l.Write([]byte{byte('a' + i%26)})
+			assert.NoError(t, err)
+			assert.Equal(t, 1, n)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("a slow file blocked the writer")
+	}
+	assert.Positive(t, l.Dropped())
+
+	close(w.release)
+	require.NoError(t, l.Close())
+	logged, dropped := readPTYLog(t, w.buf.Bytes())
+	assert.Equal(t, 100-len(logged), int(l.Dropped()))
+	assert.Equal(t, int(l.Dropped()), dropped, "the drops are logged")
+	assert.Equal(t, "a", string(logged[:1]), "the first write was picked up before the file blocked")
+}
@@ -0,0 +1,103 @@
+package termexec
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// WriteRateLimiter limits how fast input is written to a process. Agents
+// lose input that's written to the pseudo terminal faster than they read
+// it. Characters are counted as bytes. Writes aren't limited if both
+// fields are 0.
+type WriteRateLimiter struct {
+	// RateCharsPerSecond is how many characters can be written per second.
+	RateCharsPerSecond float64
+	// BurstChars is how many characters can be written at once, after
+	// nothing was written for a while. It defaults to a second's worth of
+	// characters.
+	BurstChars int
+}
+
+// Validate returns an error if the limiter's fields are invalid.
+func (l WriteRateLimiter) Validate() error {
+	_, err := l.newTokenBucket()
+	return err
+}
+
+// newTokenBucket returns the token bucket that implements the limiter, or
+// nil if writes aren't limited.
+func (l WriteRateLimiter) newTokenBucket() (*tokenBucket, error) {
+	rate, burst := l.RateCharsPerSecond, l.BurstChars
+	if rate < 0 || burst < 0 || math.IsNaN(rate) || math.IsInf(rate, 0) {
+		return nil, xerrors.Errorf("invalid write rate limit of %v chars/s with bursts of %d chars", rate, burst)
+	}
+	if rate == 0 {
+		if burst != 0 {
+			return nil, xerrors.Errorf("a write burst size requires a write rate limit")
+		}
+		return nil, nil
+	}
+	if burst == 0 {
+		burst = max(1, int(math.Ceil(rate)))
+	}
+	return &tokenBucket{
+		rate:    rate,
+		burst:   burst,
+		getTime: time.Now,
+		sleep:   time.Sleep,
+		tokens:  float64(burst),
+	}, nil
+}
+
+// tokenBucket holds up to burst tokens, and gains rate tokens per second.
+// Writing a character takes a token.
+type tokenBucket struct {
+	rate    float64
+	burst   int
+	getTime func() time.Time
+	sleep   func(time.Duration)
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// reserve takes n tokens from the bucket, and returns how long to wait
+// before they're available. n must not be larger than the burst size.
+// Tokens are reserved in order, so concurrent writers are served fairly.
+func (b *tokenBucket) reserve(n int) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.getTime()
+	if !b.last.IsZero() {
+		b.tokens = min(float64(b.burst), b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+	b.last = now
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// write writes data with write in chunks of up to the burst size, blocking
+// until there are enough tokens for each of them.
+func (b *tokenBucket) write(write func([]byte) (int, error), data []byte) (int, error) {
+	written := 0
+	for len(data) > 0 {
+		chunk := data[:min(len(data), b.burst)]
+		if wait := b.reserve(len(chunk)); wait > 0 {
+			b.sleep(wait)
+		}
+		n, err := write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		data = data[len(chunk):]
+	}
+	return written, nil
+}
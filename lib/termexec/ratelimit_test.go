@@ -0,0 +1,102 @@
+package termexec
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// chunkRecorder records the chunks written to it.
+type chunkRecorder struct {
+	chunks []int
+	buf    bytes.Buffer
+}
+
+func (r *chunkRecorder) Write(data []byte) (int, error) {
+	r.chunks = append(r.chunks, len(data))
+	return r.buf.Write(data)
+}
+
+func TestWriteRateLimiterConfig(t *testing.T) {
+	bucket, err := WriteRateLimiter{}.newTokenBucket()
+	require.NoError(t, err)
+	assert.Nil(t, bucket, "writes aren't limited by default")
+
+	bucket, err = WriteRateLimiter{RateCharsPerSecond: 2.5}.newTokenBucket()
+	require.NoError(t, err)
+	assert.Equal(t, 3, bucket.burst, "the burst defaults to a second's worth of characters")
+
+	for _, limiter := range []WriteRateLimiter{
+		{RateCharsPerSecond: -1},
+		{RateCharsPerSecond: 10, BurstChars: -1},
+		{BurstChars: 10},
+	} {
+		_, err := limiter.newTokenBucket()
+		assert.Error(t, err, "%+v", limiter)
+	}
+}
+
+func TestWriteRateLimiterReserve(t *testing.T) {
+	bucket, err := WriteRateLimiter{RateCharsPerSecond: 10, BurstChars: 5}.newTokenBucket()
+	require.NoError(t, err)
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	bucket.getTime = func() time.Time { return now }
+
+	assert.Zero(t, bucket.reserve(5), "the bucket starts full")
+	assert.Equal(t, 300*time.Millisecond, bucket.reserve(3))
+	now = now.Add(time.Second)
+	// the bucket was 3 tokens short, and gained 10, but only holds 5
+	assert.Zero(t, bucket.reserve(5))
+	assert.Equal(t, 100*time.Millisecond, bucket.reserve(1))
+}
+
+func TestProcessWriteRateLimit(t *testing.T) {
+	const rate, burst = 1000, 100
+	p := newTestProcess(t, strings.NewReader(""))
+	in := &chunkRecorder{}
+	p.term.in = in
+	require.NoError(t, p.SetWriteRateLimiter(WriteRateLimiter{RateCharsPerSecond: rate, BurstChars: burst}))
+
+	start := time.Now()
+	n, err := p.Write(bytes.Repeat([]byte("a"), burst))
+	require.NoError(t, err)
+	assert.Equal(t, burst, n)
+	assert.Less(t, time.Since(start), 50*time.Millisecond, "a burst isn't delayed")
+
+	// the bucket is empty, so all of the write has to wait for tokens
+	data := bytes.Repeat([]byte("b"), 3*burst)
+	start = time.Now()
+	n, err = p.Write(data)
+	require.NoError(t, err)
+	assert.Equal(t, len(data), n)
+	assert.GreaterOrEqual(t, time.Since(start), time.Duration(float64(len(data))/rate*float64(time.Second)))
+	assert.Equal(t, []int{burst, burst, burst, burst}, in.chunks)
+	assert.Equal(t, strings.Repeat("a", burst)+string(data), in.buf.String())
+}
+
+func BenchmarkProcessWrite(b *testing.B) {
+	data := bytes.Repeat([]byte("x"), 1<<20)
+	for _, tc := range []struct {
+		name    string
+		limiter WriteRateLimiter
+	}{
+		{"unlimited", WriteRateLimiter{}},
+		{"limited", WriteRateLimiter{RateCharsPerSecond: 256 << 20, BurstChars: 64 << 10}},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			p := newTestProcess(b, strings.NewReader(""))
+			require.NoError(b, p.SetWriteRateLimiter(tc.limiter))
+			b.SetBytes(int64(len(data)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := p.Write(data); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package termexec
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+
+	"golang.org/x/xerrors"
+)
+
+// SandboxLevel is how much the process is isolated from the rest of the
+// machine.
+type SandboxLevel string
+
+const (
+	// SandboxOff runs the process like any other.
+	SandboxOff SandboxLevel = "off"
+	// SandboxRestricted cuts the process off from the network, and makes
+	// every file outside of its working directory read-only.
+	SandboxRestricted SandboxLevel = "restricted"
+	// SandboxStrict restricts the process, and only lets it execute the
+	// program and the files in StartProcessConfig.SandboxExecAllowlist.
+	SandboxStrict SandboxLevel = "strict"
+)
+
+// SandboxLevels are the valid values of StartProcessConfig.Sandbox, besides
+// "" which is the same as SandboxOff.
+var SandboxLevels = []SandboxLevel{SandboxOff, SandboxRestricted, SandboxStrict}
+
+// sandboxConfig is what the sandbox is set up with, resolved from a
+// StartProcessConfig.
+type sandboxConfig struct {
+	Level SandboxLevel `json:"level"`
+	// WorkDir is the only directory the process can write to.
+	WorkDir string `json:"work_dir"`
+	// Program is the absolute path of the program.
+	Program string `json:"program"`
+	// AllowExec holds the absolute paths that can be executed in strict
+	// mode, besides the program.
+	AllowExec []string `json:"allow_exec,omitempty"`
+}
+
+// newSandboxConfig validates the sandbox fields of args, and returns the
+// sandbox to run the process in, or nil if it's not sandboxed.
+func newSandboxConfig(args StartProcessConfig) (*sandboxConfig, error) {
+	if args.Sandbox == "" || args.Sandbox == SandboxOff {
+		return nil, nil
+	}
+	if !slices.Contains(SandboxLevels, args.Sandbox) {
+		return nil, xerrors.Errorf("invalid sandbox level %q, expected one of %v", args.Sandbox, SandboxLevels)
+	}
+	if !sandboxSupported {
+		return nil, xerrors.Errorf("the sandbox isn't supported on this operating system")
+	}
+	program, err := exec.LookPath(args.Program)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to find %s: %w", args.Program, err)
+	}
+	workDir := args.Dir
+	if workDir == "" {
+		if workDir, err = os.Getwd(); err != nil {
+			return nil, xerrors.Errorf("failed to get working directory: %w", err)
+		}
+	}
+	config := &sandboxConfig{Level: args.Sandbox}
+	// the sandbox works with the real paths, since symlinks outside of
+	// the working directory can't be followed in it
+	for _, path := range append([]string{workDir, program}, args.SandboxExecAllowlist...) {
+		resolved, err := filepath.Abs(path)
+		if err == nil {
+			resolved, err = filepath.EvalSymlinks(resolved)
+		}
+		if err != nil {
+			return nil, xerrors.Errorf("failed to resolve %s: %w", path, err)
+		}
+		switch {
+		case config.WorkDir == "":
+			config.WorkDir = resolved
+		case config.Program == "":
+			config.Program = resolved
+		default:
+			config.AllowExec = append(config.AllowExec, resolved)
+		}
+	}
+	return config, nil
+}
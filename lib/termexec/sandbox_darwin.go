@@ -0,0 +1,49 @@
+//go:build darwin
+
+package termexec
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+const sandboxSupported = true
+
+// sandboxProfile returns the sandbox-exec profile of the sandbox. Writes
+// are allowed to the working directory, the temporary directories and
+// terminals.
+func sandboxProfile(config *sandboxConfig) string {
+	var sb strings.Builder
+	sb.WriteString("(version 1)\n(allow default)\n")
+	sb.WriteString("(deny network*)\n(allow network* (remote unix-socket))\n")
+	sb.WriteString("(deny file-write*)\n")
+	fmt.Fprintf(&sb, "(allow file-write* (subpath %s) (subpath \"/private/tmp\") (subpath \"/private/var/folders\") (literal \"/dev/null\") (regex #\"^/dev/tty\"))\n", sandboxString(config.WorkDir))
+	if config.Level == SandboxStrict {
+		sb.WriteString("(deny process-exec*)\n")
+		fmt.Fprintf(&sb, "(allow process-exec* (literal %s)", sandboxString(config.Program))
+		for _, path := range config.AllowExec {
+			fmt.Fprintf(&sb, " (subpath %s)", sandboxString(path))
+		}
+		sb.WriteString(")\n")
+	}
+	return sb.String()
+}
+
+// sandboxString quotes s as a string of the sandbox profile language.
+func sandboxString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// sandboxCommand returns the command that runs the program in the
+// sandbox. On macOS, it's run with sandbox-exec and a generated profile.
+func sandboxCommand(config *sandboxConfig, args StartProcessConfig, env []string) (*exec.Cmd, error) {
+	cmd := exec.Command("/usr/bin/sandbox-exec", append([]string{"-p", sandboxProfile(config), config.Program}, args.Args...)...)
+	cmd.Env = env
+	cmd.Dir = config.WorkDir
+	return cmd, nil
+}
+
+// SandboxInit does nothing on macOS, where the sandbox is set up by
+// sandbox-exec.
+func SandboxInit() {}
@@ -0,0 +1,260 @@
+//go:build linux
+
+package termexec
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+	"golang.org/x/xerrors"
+)
+
+const sandboxSupported = true
+
+const (
+	// sandboxInitArg0 is the name clauder is re-executed with to set up the
+	// sandbox, see SandboxInit.
+	sandboxInitArg0 = "clauder-sandbox-init"
+	// sandboxConfigEnv holds the JSON encoded sandboxConfig of the sandbox
+	// init.
+	sandboxConfigEnv = "CLAUDER_SANDBOX_CONFIG"
+	// sandboxRoot is where the sandbox's root is assembled before the
+	// sandbox init pivots to it. /tmp is replaced with a tmpfs first, so
+	// nothing is written to the real one.
+	sandboxRoot = "/tmp/root"
+	// sandboxRootID is the uid and gid the agent runs as if clauder runs as
+	// root, nobody's.
+	sandboxRootID = 65534
+)
+
+// sandboxLibraryDirs are the directories that stay executable in strict
+// mode if they exist, since dynamically linked programs can't be loaded
+// without them.
+var sandboxLibraryDirs = []string{"/lib", "/lib32", "/lib64", "/libx32", "/usr/lib", "/usr/lib32", "/usr/lib64", "/usr/libx32"}
+
+// sandboxID returns the id in the sandbox's user namespace that id maps
+// to. It's the same id, unless it's root's.
+func sandboxID(id int) int {
+	if id == 0 {
+		return sandboxRootID
+	}
+	return id
+}
+
+// sandboxCommand returns the command that runs the program in the
+// sandbox. On Linux, clauder re-executes itself in new user, mount and
+// network namespaces, as the sandbox init that sets up the mounts and then
+// executes the program. The process isn't root in its user namespace, and
+// the sandbox init only keeps the capabilities it needs to set up the
+// mounts.
+func sandboxCommand(config *sandboxConfig, args StartProcessConfig, env []string) (*exec.Cmd, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to encode sandbox config: %w", err)
+	}
+	cmd := exec.Command("/proc/self/exe", args.Args...)
+	cmd.Args = append([]string{sandboxInitArg0, args.Program}, args.Args...)
+	cmd.Env = append(env, sandboxConfigEnv+"="+string(data))
+	cmd.Dir = config.WorkDir
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags:  syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWNET,
+		UidMappings: []syscall.SysProcIDMap{{ContainerID: sandboxID(os.Getuid()), HostID: os.Getuid(), Size: 1}},
+		GidMappings: []syscall.SysProcIDMap{{ContainerID: sandboxID(os.Getgid()), HostID: os.Getgid(), Size: 1}},
+		AmbientCaps: []uintptr{unix.CAP_SYS_ADMIN, unix.CAP_SETPCAP},
+	}
+	return cmd, nil
+}
+
+// SandboxInit sets up the sandbox and executes the agent in it, if the
+// process is a sandbox init started by StartProcess. It never returns then.
+// Programs that start sandboxed processes must call it first thing in main.
+func SandboxInit() {
+	if len(os.Args) < 2 || os.Args[0] != sandboxInitArg0 {
+		return
+	}
+	err := runSandboxInit()
+	fmt.Fprintf(os.Stderr, "clauder: failed to set up the sandbox: %v\n", err)
+	os.Exit(126)
+}
+
+func runSandboxInit() error {
+	var config sandboxConfig
+	if err := json.Unmarshal([]byte(os.Getenv(sandboxConfigEnv)), &config); err != nil {
+		return xerrors.Errorf("invalid sandbox config: %w", err)
+	}
+	if err := os.Unsetenv(sandboxConfigEnv); err != nil {
+		return err
+	}
+	// the mounts, the working directory and the capabilities are set up on
+	// this thread
+	runtime.LockOSThread()
+	if err := setupSandboxMounts(config); err != nil {
+		return err
+	}
+	if err := dropPrivileges(); err != nil {
+		return err
+	}
+	return unix.Exec(config.Program, os.Args[1:], os.Environ())
+}
+
+// dropPrivileges leaves the thread without capabilities, and without a
+// way to gain them again, e.g. by executing a setuid program. Otherwise
+// the agent could remount the read-only and noexec mounts.
+func dropPrivileges() error {
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return xerrors.Errorf("failed to set no_new_privs: %w", err)
+	}
+	// the kernel may know more capabilities than unix.CAP_LAST_CAP, and
+	// fails with EINVAL after its last one
+	for capability := 0; capability < 64; capability++ {
+		err := unix.Prctl(unix.PR_CAPBSET_DROP, uintptr(capability), 0, 0, 0)
+		if errors.Is(err, unix.EINVAL) {
+			break
+		}
+		if err != nil {
+			return xerrors.Errorf("failed to drop capability %d from the bounding set: %w", capability, err)
+		}
+	}
+	if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL, 0, 0, 0); err != nil {
+		return xerrors.Errorf("failed to clear the ambient capabilities: %w", err)
+	}
+	header := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	var data [2]unix.CapUserData
+	if err := unix.Capset(&header, &data[0]); err != nil {
+		return xerrors.Errorf("failed to clear the capabilities: %w", err)
+	}
+	return nil
+}
+
+// setupSandboxMounts replaces the root with a read-only copy of it, in
+// which the working directory, /dev and a new /tmp are writable. In
+// strict mode, nothing but the program, the allowed paths and the shared
+// libraries can be executed.
+func setupSandboxMounts(config sandboxConfig) error {
+	strict := config.Level == SandboxStrict
+	// keep the mounts from propagating to the rest of the machine
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return xerrors.Errorf("failed to make the mounts private: %w", err)
+	}
+	execPaths := append([]string{config.Program}, config.AllowExec...)
+	if strict {
+		for _, dir := range sandboxLibraryDirs {
+			if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+				execPaths = append(execPaths, resolved)
+			}
+		}
+	}
+	// parents are mounted before their children, which they'd hide
+	slices.Sort(execPaths)
+	execPaths = slices.Compact(execPaths)
+	// the paths are opened before /tmp is replaced, since they may be in it
+	bindSources := map[string]int{}
+	for _, path := range append([]string{config.WorkDir}, execPaths...) {
+		if _, ok := bindSources[path]; ok {
+			continue
+		}
+		fd, err := unix.Open(path, unix.O_PATH|unix.O_CLOEXEC, 0)
+		if err != nil {
+			return xerrors.Errorf("failed to open %s: %w", path, err)
+		}
+		bindSources[path] = fd
+	}
+	bind := func(path string, attr uint64) error {
+		target := filepath.Join(sandboxRoot, path)
+		var st unix.Stat_t
+		if err := unix.Fstat(bindSources[path], &st); err != nil {
+			return xerrors.Errorf("failed to stat %s: %w", path, err)
+		}
+		// the mount point only has to be created if it's in the new /tmp
+		if st.Mode&unix.S_IFMT == unix.S_IFDIR {
+			_ = os.MkdirAll(target, 0o755)
+		} else if _, err := os.Stat(target); err != nil {
+			_ = os.MkdirAll(filepath.Dir(target), 0o755)
+			_ = os.WriteFile(target, nil, 0o644)
+		}
+		source := "/proc/self/fd/" + strconv.Itoa(bindSources[path])
+		if err := unix.Mount(source, target, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+			return xerrors.Errorf("failed to mount %s: %w", path, err)
+		}
+		if attr == 0 {
+			return nil
+		}
+		// the source is the original mount, which is writable and executable
+		// unless it was outside of the sandbox too
+		return setMountAttr(target, attr, 0)
+	}
+
+	if err := unix.Mount("tmpfs", "/tmp", "tmpfs", 0, "mode=755"); err != nil {
+		return xerrors.Errorf("failed to mount a tmpfs: %w", err)
+	}
+	if err := os.Mkdir(sandboxRoot, 0o755); err != nil {
+		return err
+	}
+	if err := unix.Mount("/", sandboxRoot, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return xerrors.Errorf("failed to copy the root: %w", err)
+	}
+	readOnly := uint64(unix.MOUNT_ATTR_RDONLY | unix.MOUNT_ATTR_NOSUID)
+	noExec := uint64(0)
+	if strict {
+		noExec = unix.MOUNT_ATTR_NOEXEC
+	}
+	if err := setMountAttr(sandboxRoot, readOnly|noExec, 0); err != nil {
+		return err
+	}
+	if err := unix.Mount("tmpfs", filepath.Join(sandboxRoot, "tmp"), "tmpfs", uintptr(unix.MS_NOSUID), "mode=1777"); err != nil {
+		return xerrors.Errorf("failed to mount /tmp: %w", err)
+	}
+	if strict {
+		if err := setMountAttr(filepath.Join(sandboxRoot, "tmp"), noExec, 0); err != nil {
+			return err
+		}
+	}
+	if err := unix.Mount("/dev", filepath.Join(sandboxRoot, "dev"), "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return xerrors.Errorf("failed to mount /dev: %w", err)
+	}
+	if err := bind(config.WorkDir, noExec); err != nil {
+		return err
+	}
+	if strict {
+		for _, path := range execPaths {
+			if err := bind(path, readOnly); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := unix.Chdir(sandboxRoot); err != nil {
+		return err
+	}
+	// pivoting to the current directory stacks the old root on top of the
+	// new one, where it can be unmounted
+	if err := unix.PivotRoot(".", "."); err != nil {
+		return xerrors.Errorf("failed to pivot to the new root: %w", err)
+	}
+	if err := unix.Unmount(".", unix.MNT_DETACH); err != nil {
+		return xerrors.Errorf("failed to unmount the old root: %w", err)
+	}
+	for _, fd := range bindSources {
+		_ = unix.Close(fd)
+	}
+	return unix.Chdir(config.WorkDir)
+}
+
+// setMountAttr sets and clears the attributes of the mount at path and
+// the mounts below it.
+func setMountAttr(path string, set, clear uint64) error {
+	attr := unix.MountAttr{Attr_set: set, Attr_clr: clear}
+	if err := unix.MountSetattr(-1, path, unix.AT_RECURSIVE, &attr); err != nil {
+		return xerrors.Errorf("failed to change the mount attributes of %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package termexec
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	"golang.org/x/sys/unix"
+)
+
+func TestSandboxPrivileges(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+	output := runSandboxed(t, SandboxRestricted, dir, "echo uid=$(id -u) gid=$(id -g); grep -E '^(CapEff|CapPrm|CapBnd|CapAmb|NoNewPrivs):' /proc/self/status")
+	assert.Regexp(t, `uid=[1-9][0-9]* gid=[1-9]`, output)
+	for _, set := range []string{"CapEff", "CapPrm", "CapBnd", "CapAmb"} {
+		assert.Regexp(t, set+`:\s+0000000000000000`, output)
+	}
+	assert.Regexp(t, `NoNewPrivs:\s+1`, output)
+}
+
+// TestSandboxRemount runs TestSandboxRemountHelper in the sandbox, which
+// tries to make the root writable again.
+func TestSandboxRemount(t *testing.T) {
+	if err := exec.Command("unshare", "-Urm", "true").Run(); err != nil {
+		t.Skip("unprivileged user namespaces aren't available")
+	}
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+	executable, err := os.Executable()
+	require.NoError(t, err)
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	output := &lockedBuffer{}
+	// the test binary is in /tmp, which is only mounted for the program in
+	// strict mode
+	p, err := StartProcess(ctx, StartProcessConfig{
+		Program:        executable,
+		Args:           []string{"-test.run=^TestSandboxRemountHelper$"},
+		Env:            map[string]string{"CLAUDER_SANDBOX_REMOUNT_HELPER": "1"},
+		Dir:            dir,
+		TerminalWidth:  200,
+		TerminalHeight: 24,
+		Output:         output,
+		Sandbox:        SandboxStrict,
+	})
+	require.NoError(t, err)
+	defer p.Close(slog.New(slog.NewTextHandler(io.Discard, nil)), time.Second)
+	require.Eventually(t, func() bool {
+		return strings.Contains(output.String(), "done")
+	}, 5*time.Second, 10*time.Millisecond, output.String())
+
+	for _, attempt := range []string{"remount", "setattr", "nested remount", "nested setattr"} {
+		assert.Contains(t, output.String(), attempt+": operation not permitted")
+	}
+	assert.Contains(t, output.String(), "create: open /remounted: read-only file system")
+}
+
+func TestSandboxRemountHelper(t *testing.T) {
+	mode := os.Getenv("CLAUDER_SANDBOX_REMOUNT_HELPER")
+	if mode == "" {
+		t.Skip("only run in the sandbox by TestSandboxRemount")
+	}
+	prefix := ""
+	if mode == "nested" {
+		prefix = "nested "
+	}
+	err := unix.Mount("", "/", "", unix.MS_REMOUNT|unix.MS_BIND, "")
+	fmt.Printf("%sremount: %v\n", prefix, err)
+	attr := unix.MountAttr{Attr_clr: unix.MOUNT_ATTR_RDONLY}
+	err = unix.MountSetattr(-1, "/", unix.AT_RECURSIVE, &attr)
+	fmt.Printf("%ssetattr: %v\n", prefix, err)
+	if mode == "nested" {
+		return
+	}
+
+	// the helper in new user and mount namespaces has every capability,
+	// but the mounts it copies from the sandbox are locked
+	cmd := exec.Command("/proc/self/exe", "-test.run=^TestSandboxRemountHelper$")
+	cmd.Env = append(os.Environ(), "CLAUDER_SANDBOX_REMOUNT_HELPER=nested")
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{Cloneflags: syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS}
+	if err := cmd.Run(); err != nil {
+		fmt.Printf("nested helper: %v\n", err)
+	}
+	_, err = os.Create("/remounted")
+	fmt.Printf("create: %v\n", err)
+	fmt.Println("done")
+	time.Sleep(5 * time.Second)
+}
@@ -0,0 +1,18 @@
+//go:build !linux && !darwin
+
+package termexec
+
+import (
+	"os/exec"
+
+	"golang.org/x/xerrors"
+)
+
+const sandboxSupported = false
+
+func sandboxCommand(config *sandboxConfig, args StartProcessConfig, env []string) (*exec.Cmd, error) {
+	return nil, xerrors.Errorf("the sandbox isn't supported on this operating system")
+}
+
+// SandboxInit does nothing on operating systems without sandbox support.
+func SandboxInit() {}
@@ -0,0 +1,112 @@
+package termexec
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+)
+
+func TestMain(m *testing.M) {
+	// the test binary is re-executed as the sandbox init on Linux
+	SandboxInit()
+	os.Exit(m.Run())
+}
+
+func TestNewSandboxConfig(t *testing.T) {
+	config, err := newSandboxConfig(StartProcessConfig{Program: "sh"})
+	require.NoError(t, err)
+	assert.Nil(t, config)
+	config, err = newSandboxConfig(StartProcessConfig{Program: "sh", Sandbox: SandboxOff})
+	require.NoError(t, err)
+	assert.Nil(t, config)
+
+	_, err = newSandboxConfig(StartProcessConfig{Program: "sh", Sandbox: "paranoid"})
+	assert.ErrorContains(t, err, "invalid sandbox level")
+	if !sandboxSupported {
+		_, err = newSandboxConfig(StartProcessConfig{Program: "sh", Sandbox: SandboxRestricted})
+		assert.ErrorContains(t, err, "isn't supported")
+		return
+	}
+	_, err = newSandboxConfig(StartProcessConfig{Program: "clauder-missing-program", Sandbox: SandboxRestricted})
+	assert.ErrorContains(t, err, "failed to find")
+
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+	config, err = newSandboxConfig(StartProcessConfig{Program: "sh", Dir: dir, Sandbox: SandboxStrict, SandboxExecAllowlist: []string{dir}})
+	require.NoError(t, err)
+	assert.Equal(t, SandboxStrict, config.Level)
+	assert.Equal(t, dir, config.WorkDir)
+	assert.True(t, filepath.IsAbs(config.Program))
+	assert.Equal(t, []string{dir}, config.AllowExec)
+}
+
+// runSandboxed runs script with sh in the sandbox, in dir, and returns its
+// output once it printed "done".
+func runSandboxed(t *testing.T, level SandboxLevel, dir, script string) string {
+	t.Helper()
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("the sandbox isn't supported on " + runtime.GOOS)
+	}
+	if runtime.GOOS == "linux" {
+		if err := exec.Command("unshare", "-Urm", "true").Run(); err != nil {
+			t.Skip("unprivileged user namespaces aren't available")
+		}
+	}
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	output := &lockedBuffer{}
+	p, err := StartProcess(ctx, StartProcessConfig{
+		Program:        "sh",
+		Args:           []string{"-c", script + "; echo done; sleep 5"},
+		Dir:            dir,
+		TerminalWidth:  200,
+		TerminalHeight: 24,
+		Output:         output,
+		Sandbox:        level,
+	})
+	require.NoError(t, err)
+	defer p.Close(slog.New(slog.NewTextHandler(io.Discard, nil)), time.Second)
+	require.Eventually(t, func() bool {
+		return strings.Contains(output.String(), "done")
+	}, 5*time.Second, 10*time.Millisecond, output.String())
+	return output.String()
+}
+
+func TestSandboxWrites(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+	// the package directory is outside of the working directory and, unlike
+	// /tmp, isn't replaced in the sandbox
+	cwd, err := os.Getwd()
+	require.NoError(t, err)
+	outside := filepath.Join(cwd, "sandbox-test-out")
+	t.Cleanup(func() { _ = os.Remove(outside) })
+
+	runSandboxed(t, SandboxRestricted, dir, "echo > in; echo > "+outside)
+	assert.FileExists(t, filepath.Join(dir, "in"))
+	assert.NoFileExists(t, outside)
+}
+
+func TestSandboxStrict(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+	sh, err := exec.LookPath("sh")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "script"), []byte("#!"+sh+"\necho ran\n"), 0o755))
+
+	output := runSandboxed(t, SandboxRestricted, dir, "./script")
+	assert.Contains(t, output, "ran")
+	output = runSandboxed(t, SandboxStrict, dir, "./script || echo denied")
+	assert.NotContains(t, output, "ran")
+	assert.Contains(t, output, "denied")
+}
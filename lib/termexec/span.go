@@ -0,0 +1,110 @@
+package termexec
+
+import (
+	"sync"
+	"time"
+)
+
+// WriteSpan measures how a process responded to a write to its pseudo
+// terminal: how long it took to print something, and to be idle again,
+// i.e. the end-to-end latency of a message.
+type WriteSpan struct {
+	// WrittenAt is when the write started.
+	WrittenAt time.Time
+	// FirstOutputAt is when the process printed something after the
+	// write, or zero if it hasn't yet. That's usually the terminal echoing
+	// the input.
+	FirstOutputAt time.Time
+	// IdleAt is when the process is considered idle again, because it
+	// didn't print anything for readySettleTime, or zero if it isn't yet.
+	IdleAt       time.Time
+	BytesWritten int
+}
+
+// spanTracker records the span of the last write. Its zero value is ready
+// to use.
+type spanTracker struct {
+	mu      sync.Mutex
+	current *WriteSpan
+	// lastOutput is when the process last printed something during the
+	// current span.
+	lastOutput time.Time
+	idleTimer  *time.Timer
+	// onIdle is called with every span that's complete.
+	onIdle func(WriteSpan)
+}
+
+// written starts a span for a write of n bytes at now. It replaces the
+// current span, whether or not it was complete.
+func (t *spanTracker) written(now time.Time, n int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.idleTimer != nil {
+		t.idleTimer.Stop()
+	}
+	t.current = &WriteSpan{WrittenAt: now, BytesWritten: n}
+}
+
+// output records that the process printed something at now, and waits
+// for it to be idle.
+func (t *spanTracker) output(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.current == nil || !t.current.IdleAt.IsZero() {
+		return
+	}
+	if t.current.FirstOutputAt.IsZero() {
+		t.current.FirstOutputAt = now
+	}
+	t.lastOutput = now
+	if t.idleTimer == nil {
+		t.idleTimer = time.AfterFunc(readySettleTime, t.idle)
+	} else {
+		t.idleTimer.Reset(readySettleTime)
+	}
+}
+
+// idle completes the current span if the process didn't print anything
+// for readySettleTime.
+func (t *spanTracker) idle() {
+	t.mu.Lock()
+	span := t.current
+	// the timer may fire while it's reset by output or stopped by written
+	if span == nil || span.FirstOutputAt.IsZero() || !span.IdleAt.IsZero() || time.Since(t.lastOutput) < readySettleTime {
+		t.mu.Unlock()
+		return
+	}
+	span.IdleAt = t.lastOutput.Add(readySettleTime)
+	completed, onIdle := *span, t.onIdle
+	t.mu.Unlock()
+	if onIdle != nil {
+		onIdle(completed)
+	}
+}
+
+// last returns the span of the last write, and false if nothing was
+// written yet.
+func (t *spanTracker) last() (WriteSpan, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.current == nil {
+		return WriteSpan{}, false
+	}
+	return *t.current, true
+}
+
+// LastWriteSpan returns the span of the last write to the process, which
+// may still be incomplete, and false if nothing was written to it yet.
+func (p *Process) LastWriteSpan() (WriteSpan, bool) {
+	return p.spans.last()
+}
+
+// OnWriteSpan sets a function that's called with the span of every write
+// once the process is idle again, e.g. to record its latency. A span is
+// never completed if the process didn't print anything after the write,
+// or if it was written to again before it was idle.
+func (p *Process) OnWriteSpan(f func(WriteSpan)) {
+	p.spans.mu.Lock()
+	defer p.spans.mu.Unlock()
+	p.spans.onIdle = f
+}
@@ -0,0 +1,51 @@
+package termexec
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+)
+
+func TestWriteSpan(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	p, err := StartProcess(ctx, StartProcessConfig{
+		Program:        "sh",
+		Args:           []string{"-c", `read line; echo "got it"; sleep 5`},
+		TerminalWidth:  80,
+		TerminalHeight: 24,
+	})
+	require.NoError(t, err)
+	defer p.Close(slog.New(slog.NewTextHandler(io.Discard, nil)), time.Second)
+	completed := make(chan WriteSpan, 1)
+	p.OnWriteSpan(func(span WriteSpan) { completed <- span })
+
+	_, ok := p.LastWriteSpan()
+	assert.False(t, ok, "nothing was written yet")
+	_, err = p.Write([]byte("hello\r"))
+	require.NoError(t, err)
+
+	var span WriteSpan
+	select {
+	case span = <-completed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the span wasn't completed")
+	}
+	assert.True(t, strings.Contains(p.ReadScreen(), "got it"))
+	assert.Equal(t, 6, span.BytesWritten)
+	assert.True(t, span.FirstOutputAt.After(span.WrittenAt), "%+v", span)
+	assert.True(t, span.IdleAt.After(span.FirstOutputAt), "%+v", span)
+	last, ok := p.LastWriteSpan()
+	require.True(t, ok)
+	assert.Equal(t, span, last)
+}
@@ -7,99 +7,474 @@ import (
 	"log/slog"
 	"os"
 	"os/exec"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
+	"unicode/utf8"
 
-	"github.com/ActiveState/termtest/xpty"
+	"github.com/ActiveState/vt10x"
 	"github.com/zohaibahmed/clauder/lib/logctx"
-	"github.com/zohaibahmed/clauder/lib/util"
 	"golang.org/x/xerrors"
 )
 
+// terminal is the pseudo terminal a process runs in, together with the
+// emulator that tracks its screen. It's created by the platform-specific
+// startInTerminal.
+type terminal struct {
+	// in sends input to the process.
+	in io.Writer
+	// out reads the output of the process. Reading from it must not update
+	// the screen, which is done separately with vt.
+	out io.RuneReader
+	vt  *vt10x.VT
+	// state is the screen updated by vt.
+	state *vt10x.State
+	// resize changes the size of the pseudo terminal and of vt.
+	resize func(width, height uint16) error
+	close  func() error
+}
+
 type Process struct {
-	xp               *xpty.Xpty
-	execCmd          *exec.Cmd
+	term             *terminal
+	process          *os.Process
 	screenUpdateLock sync.RWMutex
 	lastScreenUpdate time.Time
+	heartbeat        chan struct{}
+	// writeLimit holds nil if writes aren't rate limited. writeLock keeps
+	// the chunks of a limited write from being interleaved with others.
+	writeLimit atomic.Pointer[tokenBucket]
+	writeLock  sync.Mutex
+	// batcher is nil unless StartProcessConfig.BatchWrites is set.
+	batcher *writeBatcher
+	// chunker is nil if writes aren't split, like in tests.
+	chunker *writeChunker
+	spans   spanTracker
 }
 
 type StartProcessConfig struct {
-	Program        string
-	Args           []string
+	Program string
+	Args    []string
+	// BinarySearchPaths are directories Program is looked up in, in order,
+	// before PATH. See ResolveBinary.
+	BinarySearchPaths []string
+	// Dir is the working directory of the process. If empty, it's the
+	// server's working directory.
+	Dir            string
 	TerminalWidth  uint16
 	TerminalHeight uint16
+	// Output, if set, receives a copy of everything the process writes
+	// to the pseudo terminal. It's written to from the terminal reader
+	// goroutine, so it must not block, and like any io.Writer it must
+	// not retain the data it's passed.
+	Output io.Writer
+	// Stdout, if set, receives the process's standard output through a
+	// pipe instead of the pseudo terminal, which keeps its input and
+	// standard error. It's for agents that print structured output, which
+	// the terminal would mix with escape sequences. It isn't supported on
+	// Windows.
+	Stdout io.Writer
+	// Env holds environment variables set for the process on top of the
+	// server's own environment. See ValidateEnv for the variables that
+	// can't be overridden.
+	Env map[string]string
+	// WriteRateLimiter limits how fast Process.Write sends input to the
+	// process.
+	WriteRateLimiter WriteRateLimiter
+	// NicePriority is the nice value of the process, from -20 (highest
+	// priority) to 19 (lowest). On Windows, it's mapped to the closest
+	// priority class.
+	NicePriority int
+	// IOPriorityClass is the IO scheduling class of the process, one of
+	// IOPriorityClasses. It's only supported on Linux.
+	IOPriorityClass string
+	// Sandbox isolates the process from the rest of the machine, see
+	// SandboxLevel. It's supported on Linux, where it requires
+	// unprivileged user namespaces, and macOS. Programs that start
+	// sandboxed processes on Linux must call SandboxInit.
+	Sandbox SandboxLevel
+	// SandboxExecAllowlist holds the paths that can be executed in
+	// SandboxStrict mode, besides the program. Directories allow
+	// everything in them.
+	SandboxExecAllowlist []string
+	// PreinjectLines are written to the process, each followed by Enter,
+	// before StartProcess returns, to answer the prompts some agents show
+	// when they start, like accepting their terms. They're written once
+	// the process is ready, i.e. its screen hasn't changed for a moment,
+	// PreinjectDelay apart.
+	PreinjectLines []string
+	PreinjectDelay time.Duration
+	// TermType is the process's TERM environment variable. It defaults to
+	// DefaultTermType, or to a terminal type that supports ColorProfile if
+	// that's set. The screen is emulated as a vt100 terminal either way,
+	// so escape sequences it doesn't support may garble it.
+	TermType string
+	// ColorProfile is one of ColorProfiles. It sets the process's
+	// COLORTERM environment variable, and NO_COLOR for ColorProfileNone.
+	// If it's empty, COLORTERM is inherited from the server.
+	ColorProfile string
+	// LogFile, if set, is a file that everything the process writes to the
+	// pseudo terminal is appended to, in timestamped chunks, to debug what
+	// the agent printed exactly. Writing to it never blocks the terminal
+	// reader; output is dropped if the file can't keep up.
+	LogFile string
+	// WarmupProbeCommand, if set, is a cheap command, like echo ready, that
+	// is run in Dir with the process's environment before the program, to
+	// check that the program can run there. StartProcess fails if it
+	// exits with an error.
+	WarmupProbeCommand []string
+	// BatchWrites makes Process.Write collect the input written within
+	// BatchWindow, which defaults to DefaultBatchWindow, and send it to
+	// the process at once, in order, to save syscalls when many small
+	// writes arrive in quick succession. Write then returns before the
+	// input is sent, and errors are returned by the next Write.
+	BatchWrites bool
+	BatchWindow time.Duration
+	// WriteChunkSize is the size in bytes of the chunks a write larger
+	// than it is split into, so that a long message doesn't overflow the
+	// terminal's input buffer. It defaults to DefaultWriteChunkSize.
+	// WriteChunkDelay is how long to wait between the chunks, to give the
+	// process time to read them. It defaults to DefaultWriteChunkDelay.
+	WriteChunkSize  int
+	WriteChunkDelay time.Duration
+	// HealthCheck, if set, is requested once the process is ready, i.e. its
+	// screen hasn't changed for a moment, and StartProcess only returns
+	// once it passes. It fails with ErrAgentUnhealthy if it doesn't pass
+	// within StartupTimeout of the process starting, which defaults to
+	// DefaultStartupTimeout.
+	HealthCheck    *HealthCheckConfig
+	StartupTimeout time.Duration
+}
+
+const (
+	// readySettleTime is how long the screen of a process must not change
+	// for it to be considered ready for input.
+	readySettleTime = 300 * time.Millisecond
+	// readyTimeout is how long to wait for a process to be ready before
+	// writing to it anyway.
+	readyTimeout = 30 * time.Second
+)
+
+// ForbiddenEnvVars are the environment variables that StartProcessConfig.Env
+// can't override, because they change which code the process runs.
+var ForbiddenEnvVars = []string{"PATH", "LD_PRELOAD", "LD_LIBRARY_PATH"}
+
+// ValidateEnv checks that env can be used as StartProcessConfig.Env.
+func ValidateEnv(env map[string]string) error {
+	for key := range env {
+		if key == "" || strings.ContainsAny(key, "=\x00") {
+			return xerrors.Errorf("invalid environment variable name %q", key)
+		}
+		if slices.Contains(ForbiddenEnvVars, strings.ToUpper(key)) {
+			return xerrors.Errorf("environment variable %s can't be overridden", key)
+		}
+	}
+	return nil
+}
+
+// processEnv returns the environment of a process: the server's own, with
+// the variables in extra added or replaced, and the terminal variables
+// returned by terminalEnv set last. The terminal variables can't be
+// overridden with extra, and the ones with an empty value are removed.
+func processEnv(extra map[string]string, terminal map[string]string) []string {
+	env := slices.DeleteFunc(os.Environ(), func(kv string) bool {
+		key, _, _ := strings.Cut(kv, "=")
+		_, inExtra := extra[key]
+		_, inTerminal := terminal[key]
+		return inExtra || inTerminal || key == "TERM"
+	})
+	keys := make([]string, 0, len(extra))
+	for key := range extra {
+		if _, ok := terminal[key]; !ok && key != "TERM" {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		env = append(env, key+"="+extra[key])
+	}
+	keys = keys[:0]
+	for key, value := range terminal {
+		if key != "TERM" && value != "" {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		env = append(env, key+"="+terminal[key])
+	}
+	return append(env, "TERM="+terminal["TERM"])
+}
+
+// runWarmupProbe runs the command of StartProcessConfig.WarmupProbeCommand.
+func runWarmupProbe(ctx context.Context, command []string, dir string, env []string) error {
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Dir = dir
+	cmd.Env = env
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return xerrors.Errorf("warm-up probe %q failed: %w: %s", strings.Join(command, " "), err, strings.TrimSpace(string(output)))
+	}
+	return nil
 }
 
 func StartProcess(ctx context.Context, args StartProcessConfig) (*Process, error) {
 	logger := logctx.From(ctx)
-	xp, err := xpty.New(args.TerminalWidth, args.TerminalHeight, false)
+	if err := ValidateEnv(args.Env); err != nil {
+		return nil, err
+	}
+	writeLimit, err := args.WriteRateLimiter.newTokenBucket()
+	if err != nil {
+		return nil, err
+	}
+	if args.BatchWindow < 0 {
+		return nil, xerrors.Errorf("invalid write batch window of %v", args.BatchWindow)
+	}
+	chunker, err := newWriteChunker(args.WriteChunkSize, args.WriteChunkDelay)
+	if err != nil {
+		return nil, err
+	}
+	if err := validatePriority(args); err != nil {
+		return nil, err
+	}
+	if err := validateTerminal(args); err != nil {
+		return nil, err
+	}
+	if args.HealthCheck != nil {
+		if err := args.HealthCheck.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if args.StartupTimeout < 0 {
+		return nil, xerrors.Errorf("invalid startup timeout of %v", args.StartupTimeout)
+	}
+	if len(args.BinarySearchPaths) > 0 {
+		if args.Program, err = ResolveBinary(args.Program, args.BinarySearchPaths); err != nil {
+			return nil, xerrors.Errorf("failed to find the program: %w", err)
+		}
+	}
+	sandbox, err := newSandboxConfig(args)
 	if err != nil {
 		return nil, err
 	}
-	execCmd := exec.Command(args.Program, args.Args...)
-	// vt100 is the terminal type that the vt10x library emulates.
-	// Setting this signals to the process that it should only use compatible
-	// escape sequences.
-	execCmd.Env = append(os.Environ(), "TERM=vt100")
-	if err := xp.StartProcessInTerminal(execCmd); err != nil {
+	env := processEnv(args.Env, terminalEnv(args.TermType, args.ColorProfile))
+	if len(args.WarmupProbeCommand) > 0 {
+		if err := runWarmupProbe(ctx, args.WarmupProbeCommand, args.Dir, env); err != nil {
+			return nil, err
+		}
+	}
+	output := args.Output
+	var outputLog *ptyLog
+	if args.LogFile != "" {
+		if outputLog, err = openPTYLog(args.LogFile); err != nil {
+			return nil, err
+		}
+		if output == nil {
+			output = outputLog
+		} else {
+			output = io.MultiWriter(output, outputLog)
+		}
+	}
+	term, osProcess, err := startInTerminal(ctx, args, env, sandbox)
+	if err != nil {
+		if outputLog != nil {
+			_ = outputLog.Close()
+		}
 		return nil, err
 	}
 
-	process := &Process{xp: xp, execCmd: execCmd}
+	started := time.Now()
+	process := &Process{term: term, process: osProcess, heartbeat: make(chan struct{}, 1), chunker: chunker}
+	process.writeLimit.Store(writeLimit)
+	if args.BatchWrites {
+		process.batcher = newWriteBatcher(args.BatchWindow, process.writeTerminal)
+	}
+	// the process keeps running at the default priority if this fails,
+	// e.g. because raising it requires privileges
+	if err := setPriority(osProcess.Pid, args.NicePriority, args.IOPriorityClass); err != nil {
+		logger.Warn("Failed to set the process priority", "error", err)
+	}
 
 	go func() {
-		// HACK: Working around xpty concurrency limitations
-		//
-		// Problem:
-		// 1. We need to track when the terminal screen was last updated (for ReadScreen)
-		// 2. xpty only updates terminal state through xp.ReadRune()
-		// 3. xp.ReadRune() has a bug - it panics when SetReadDeadline is used
-		// 4. Without deadlines, ReadRune blocks until the process outputs data
-		//
-		// Why this matters:
-		// If we wrapped ReadRune + lastScreenUpdate in a mutex, this goroutine would
-		// hold the lock while waiting for process output. Since ReadRune blocks indefinitely,
-		// ReadScreen callers would be locked out until new output arrives. Even worse,
-		// after output arrives, this goroutine could immediately reacquire the lock
-		// for the next ReadRune call, potentially starving ReadScreen callers indefinitely.
-		//
-		// Solution:
-		// Instead of using xp.ReadRune(), we directly use its internal components:
-		// - pp.ReadRune() - handles the blocking read from the process
-		// - xp.Term.WriteRune() - updates the terminal state
-		//
-		// This lets us apply the mutex only around the terminal update and timestamp,
-		// keeping reads non-blocking while maintaining thread safety.
-		//
-		// Warning: This depends on xpty internals and may break if xpty changes.
-		// A proper fix would require forking xpty or getting upstream changes.
-		pp := util.GetUnexportedField(xp, "pp").(*xpty.PassthroughPipe)
-		for {
-			r, _, err := pp.ReadRune()
-			if err != nil {
-				if err != io.EOF {
-					logger.Error("Error reading from pseudo terminal", "error", err)
-				}
-				// TODO: handle this error better. if this happens, the terminal
-				// state will never be updated anymore and the process will appear
-				// unresponsive.
-				return
-			}
-			process.screenUpdateLock.Lock()
-			// writing to the terminal updates its state. without it,
-			// xp.State will always return an empty string
-			xp.Term.WriteRune(r)
-			process.lastScreenUpdate = time.Now()
-			process.screenUpdateLock.Unlock()
+		process.readTerminal(logger, output)
+		if outputLog == nil {
+			return
+		}
+		if dropped := outputLog.Dropped(); dropped > 0 {
+			logger.Warn("Dropped output from the PTY log because the file was too slow", "writes", dropped)
+		}
+		if err := outputLog.Close(); err != nil {
+			logger.Error("Failed to close PTY log", "error", err)
 		}
 	}()
 
+	if len(args.PreinjectLines) > 0 {
+		if err := process.preinject(ctx, args.PreinjectLines, args.PreinjectDelay); err != nil {
+			if closeErr := process.Close(logger, time.Second); closeErr != nil {
+				logger.Error("Failed to close process", "error", closeErr)
+			}
+			return nil, xerrors.Errorf("failed to pre-inject input: %w", err)
+		}
+	}
+	if args.HealthCheck != nil {
+		timeout := args.StartupTimeout
+		if timeout == 0 {
+			timeout = DefaultStartupTimeout
+		}
+		if err := process.waitHealthy(ctx, args.HealthCheck, started.Add(timeout)); err != nil {
+			if closeErr := process.Close(logger, time.Second); closeErr != nil {
+				logger.Error("Failed to close process", "error", closeErr)
+			}
+			return nil, xerrors.Errorf("health check failed: %w", err)
+		}
+		logger.Info("The agent passed its health check", "url", args.HealthCheck.URL, "duration", time.Since(started))
+	}
+
 	return process, nil
 }
 
+// waitReady waits until the screen hasn't changed for readySettleTime,
+// counting from when it's called if the process hasn't printed anything
+// yet, or until readyTimeout elapsed. It fails if the terminal reader
+// stopped.
+func (p *Process) waitReady(ctx context.Context) error {
+	start := time.Now()
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		p.screenUpdateLock.RLock()
+		lastUpdate := p.lastScreenUpdate
+		p.screenUpdateLock.RUnlock()
+		if lastUpdate.Before(start) {
+			lastUpdate = start
+		}
+		if time.Since(lastUpdate) >= readySettleTime {
+			return nil
+		}
+		if time.Since(start) >= readyTimeout {
+			logctx.From(ctx).Warn("The process didn't become ready, writing to it anyway", "timeout", readyTimeout)
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case _, ok := <-p.heartbeat:
+			if !ok {
+				return xerrors.New("the terminal was closed")
+			}
+		case <-ticker.C:
+		}
+	}
+}
+
+// preinject writes lines to the process once it's ready, each followed by
+// Enter and delay after the previous one.
+func (p *Process) preinject(ctx context.Context, lines []string, delay time.Duration) error {
+	if err := p.waitReady(ctx); err != nil {
+		return err
+	}
+	for i, line := range lines {
+		if i > 0 && delay > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(delay):
+			}
+		}
+		if _, err := p.Write([]byte(line + "\r")); err != nil {
+			return xerrors.Errorf("failed to write line %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// readBufferPool holds the buffers that terminal output is copied into
+// before it's written to StartProcessConfig.Output. Agents can print a lot of
+// output, and allocating a slice for every rune puts pressure on the GC.
+var readBufferPool = sync.Pool{
+	New: func() any {
+		buf := make([]byte, 0, 4096)
+		return &buf
+	},
+}
+
+// readTerminal updates the screen with the process's output until the
+// pseudo terminal is closed, and copies the output to output if it's set.
+func (p *Process) readTerminal(logger *slog.Logger, output io.Writer) {
+	defer close(p.heartbeat)
+	// HACK: Working around xpty concurrency limitations
+	//
+	// Problem:
+	// 1. We need to track when the terminal screen was last updated (for ReadScreen)
+	// 2. xpty only updates terminal state through xp.ReadRune()
+	// 3. xp.ReadRune() has a bug - it panics when SetReadDeadline is used
+	// 4. Without deadlines, ReadRune blocks until the process outputs data
+	//
+	// Why this matters:
+	// If we wrapped ReadRune + lastScreenUpdate in a mutex, this goroutine would
+	// hold the lock while waiting for process output. Since ReadRune blocks indefinitely,
+	// ReadScreen callers would be locked out until new output arrives. Even worse,
+	// after output arrives, this goroutine could immediately reacquire the lock
+	// for the next ReadRune call, potentially starving ReadScreen callers indefinitely.
+	//
+	// Solution:
+	// Instead of using xp.ReadRune(), we directly use its internal components:
+	// - p.term.out.ReadRune() - handles the blocking read from the process
+	// - p.term.vt.WriteRune() - updates the terminal state
+	//
+	// This lets us apply the mutex only around the terminal update and timestamp,
+	// keeping reads non-blocking while maintaining thread safety.
+	//
+	// Warning: On Unix, this depends on xpty internals and may break if xpty
+	// changes. A proper fix would require forking xpty or getting upstream changes.
+	for {
+		r, _, err := p.term.out.ReadRune()
+		if err != nil {
+			if err != io.EOF {
+				logger.Error("Error reading from pseudo terminal", "error", err)
+			}
+			// TODO: handle this error better. if this happens, the terminal
+			// state will never be updated anymore and the process will appear
+			// unresponsive.
+			return
+		}
+		p.screenUpdateLock.Lock()
+		// writing to the terminal updates its state. without it,
+		// term.state will always return an empty string
+		p.term.vt.WriteRune(r)
+		p.lastScreenUpdate = time.Now()
+		p.screenUpdateLock.Unlock()
+		p.spans.output(p.lastScreenUpdate)
+		select {
+		case p.heartbeat <- struct{}{}:
+		default:
+		}
+		if output != nil {
+			buf := readBufferPool.Get().(*[]byte)
+			*buf = utf8.AppendRune((*buf)[:0], r)
+			if _, err := output.Write(*buf); err != nil {
+				logger.Error("Error writing process output", "error", err)
+			}
+			readBufferPool.Put(buf)
+		}
+	}
+}
+
+// Heartbeat returns a channel that receives a value whenever the pseudo
+// terminal reader processes output, and is closed once the reader stops.
+// After that, the screen is never updated again.
+func (p *Process) Heartbeat() <-chan struct{} {
+	return p.heartbeat
+}
+
+// IsAlive reports whether the process is still running.
+func (p *Process) IsAlive() bool {
+	return isAlive(p.process)
+}
+
 func (p *Process) Signal(sig os.Signal) error {
-	return p.execCmd.Process.Signal(sig)
+	return p.process.Signal(sig)
 }
 
 // ReadScreen returns the contents of the terminal window.
@@ -115,32 +490,92 @@ func (p *Process) ReadScreen() string {
 	for range 3 {
 		p.screenUpdateLock.RLock()
 		if time.Since(p.lastScreenUpdate) >= 16*time.Millisecond {
-			state := p.xp.State.String()
+			state := p.term.state.String()
 			p.screenUpdateLock.RUnlock()
 			return state
 		}
 		p.screenUpdateLock.RUnlock()
 		time.Sleep(16 * time.Millisecond)
 	}
-	return p.xp.State.String()
+	return p.term.state.String()
+}
+
+// Resize changes the size of the terminal window. The process is notified
+// with SIGWINCH, or by the pseudo console on Windows, and usually redraws
+// its screen.
+func (p *Process) Resize(width, height uint16) error {
+	if width < 10 || height < 10 {
+		return xerrors.Errorf("terminal size must be at least 10x10, got %dx%d", width, height)
+	}
+	p.screenUpdateLock.Lock()
+	defer p.screenUpdateLock.Unlock()
+	if err := p.term.resize(width, height); err != nil {
+		return xerrors.Errorf("failed to resize pseudo terminal: %w", err)
+	}
+	p.lastScreenUpdate = time.Now()
+	return nil
 }
 
-// Write sends input to the process via the pseudo terminal.
+// Write sends input to the process via the pseudo terminal. If writes are
+// rate limited, or data has to be split into chunks, it blocks until all
+// of data was written. If they're
+// batched, it returns once data was added to the current batch.
 func (p *Process) Write(data []byte) (int, error) {
-	return p.xp.TerminalInPipe().Write(data)
+	if p.batcher != nil {
+		return p.batcher.Write(data)
+	}
+	return p.writeTerminal(data)
+}
+
+// writeTerminal writes data to the pseudo terminal, within the rate limit,
+// in chunks if it's too large to be written at once.
+func (p *Process) writeTerminal(data []byte) (int, error) {
+	p.spans.written(time.Now(), len(data))
+	writeLimit := p.writeLimit.Load()
+	chunked := p.chunker != nil && len(data) > p.chunker.size
+	if writeLimit == nil && !chunked {
+		return p.term.in.Write(data)
+	}
+	p.writeLock.Lock()
+	defer p.writeLock.Unlock()
+	write := p.term.in.Write
+	if chunked {
+		write = func(data []byte) (int, error) {
+			return p.chunker.write(p.term.in.Write, data)
+		}
+	}
+	if writeLimit == nil {
+		return write(data)
+	}
+	return writeLimit.write(write, data)
 }
 
-// Close closes the process using a SIGINT signal or forcefully killing it if the process
-// does not exit after the timeout. It then closes the pseudo terminal.
+// SetWriteRateLimiter replaces the rate limit of writes, e.g. when the
+// configuration is reloaded. Writes that already started keep the previous
+// limit.
+func (p *Process) SetWriteRateLimiter(limiter WriteRateLimiter) error {
+	writeLimit, err := limiter.newTokenBucket()
+	if err != nil {
+		return err
+	}
+	p.writeLimit.Store(writeLimit)
+	return nil
+}
+
+// Close closes the process using a SIGINT signal, or Ctrl+C on Windows, or forcefully
+// killing it if the process does not exit after the timeout. It then closes the pseudo terminal.
 func (p *Process) Close(logger *slog.Logger, timeout time.Duration) error {
 	logger.Info("Closing process")
-	if err := p.execCmd.Process.Signal(os.Interrupt); err != nil {
+	if p.batcher != nil {
+		p.batcher.flush()
+	}
+	if err := p.interrupt(); err != nil {
 		return xerrors.Errorf("failed to send SIGINT to process: %w", err)
 	}
 
 	exited := make(chan error, 1)
 	go func() {
-		_, err := p.execCmd.Process.Wait()
+		_, err := p.process.Wait()
 		exited <- err
 		close(exited)
 	}()
@@ -148,7 +583,7 @@ func (p *Process) Close(logger *slog.Logger, timeout time.Duration) error {
 	var exitErr error
 	select {
 	case <-time.After(timeout):
-		if err := p.execCmd.Process.Kill(); err != nil {
+		if err := p.process.Kill(); err != nil {
 			exitErr = xerrors.Errorf("failed to forcefully kill the process: %w", err)
 		}
 		// don't wait for the process to exit to avoid hanging indefinitely
@@ -160,7 +595,7 @@ func (p *Process) Close(logger *slog.Logger, timeout time.Duration) error {
 			exitErr = xerrors.Errorf("process exited with error: %w", err)
 		}
 	}
-	if err := p.xp.Close(); err != nil {
+	if err := p.term.close(); err != nil {
 		return xerrors.Errorf("failed to close pseudo terminal: %w, exitErr: %w", err, exitErr)
 	}
 	return exitErr
@@ -170,7 +605,7 @@ var ErrNonZeroExitCode = xerrors.New("non-zero exit code")
 
 // Wait waits for the process to exit.
 func (p *Process) Wait() error {
-	state, err := p.execCmd.Process.Wait()
+	state, err := p.process.Wait()
 	if err != nil {
 		return xerrors.Errorf("process exited with error: %w", err)
 	}
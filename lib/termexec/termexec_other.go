@@ -0,0 +1,93 @@
+//go:build !windows
+
+package termexec
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"github.com/ActiveState/termtest/xpty"
+	"github.com/zohaibahmed/clauder/lib/util"
+	"golang.org/x/xerrors"
+)
+
+func startInTerminal(ctx context.Context, args StartProcessConfig, env []string, sandbox *sandboxConfig) (*terminal, *os.Process, error) {
+	execCmd := exec.Command(args.Program, args.Args...)
+	execCmd.Env = env
+	execCmd.Dir = args.Dir
+	if sandbox != nil {
+		var err error
+		if execCmd, err = sandboxCommand(sandbox, args, env); err != nil {
+			return nil, nil, err
+		}
+	}
+	xp, err := xpty.New(args.TerminalWidth, args.TerminalHeight, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	start := xp.StartProcessInTerminal
+	if args.Stdout != nil {
+		start = func(cmd *exec.Cmd) error {
+			return startWithStdoutPipe(xp, cmd, args.Stdout)
+		}
+	}
+	if err := start(execCmd); err != nil {
+		if sandbox != nil {
+			return nil, nil, xerrors.Errorf("failed to start the sandboxed process: %w", err)
+		}
+		return nil, nil, err
+	}
+	// See the comment in StartProcess for why xp.ReadRune() isn't used.
+	pp := util.GetUnexportedField(xp, "pp").(*xpty.PassthroughPipe)
+	return &terminal{
+		in:     xp.TerminalInPipe(),
+		out:    pp,
+		vt:     xp.Term,
+		state:  xp.State,
+		resize: xp.Resize,
+		close:  xp.Close,
+	}, execCmd.Process, nil
+}
+
+// startWithStdoutPipe starts cmd in the terminal like
+// xpty.StartProcessInTerminal, except that its standard output is copied
+// to stdout through a pipe.
+func startWithStdoutPipe(xp *xpty.Xpty, cmd *exec.Cmd, stdout io.Writer) error {
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return xerrors.Errorf("failed to create stdout pipe: %w", err)
+	}
+	cmd.Stdin = xp.Tty()
+	cmd.Stdout = pw
+	cmd.Stderr = xp.Tty()
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setctty = true
+	cmd.SysProcAttr.Setsid = true
+	err = cmd.Start()
+	// the child has its own copy of the write end, and the read end
+	// returns EOF once it's closed
+	_ = pw.Close()
+	if err != nil {
+		_ = pr.Close()
+		return err
+	}
+	go func() {
+		defer pr.Close()
+		_, _ = io.Copy(stdout, pr)
+	}()
+	return nil
+}
+
+func isAlive(process *os.Process) bool {
+	// Signal 0 performs error checking without sending a signal.
+	return process.Signal(syscall.Signal(0)) == nil
+}
+
+func (p *Process) interrupt() error {
+	return p.process.Signal(os.Interrupt)
+}
@@ -0,0 +1,333 @@
+package termexec
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ActiveState/vt10x"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+)
+
+// newTestProcess creates a process whose terminal output is read from out.
+func newTestProcess(t testing.TB, out io.Reader) *Process {
+	t.Helper()
+	state := &vt10x.State{}
+	vt, err := vt10x.New(state, nil, io.Discard)
+	require.NoError(t, err)
+	return &Process{
+		term:      &terminal{in: io.Discard, out: bufio.NewReader(out), vt: vt, state: state},
+		heartbeat: make(chan struct{}, 1),
+	}
+}
+
+// lockedBuffer is a bytes.Buffer that's safe to read while it's written to.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(data []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(data)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestReadTerminal(t *testing.T) {
+	input := strings.Repeat("héllo wörld ✓\r\n", 100)
+	pr, pw := io.Pipe()
+	p := newTestProcess(t, pr)
+	output := &lockedBuffer{}
+	go p.readTerminal(slog.New(slog.NewTextHandler(io.Discard, nil)), output)
+
+	go func() {
+		for range 10 {
+			_, _ = io.WriteString(pw, input[:len(input)/10])
+			_, _ = io.WriteString(pw, input[len(input)/10:len(input)/5])
+		}
+		_ = pw.Close()
+	}()
+	// read the screen while the output is processed
+	for range p.Heartbeat() {
+		assert.NotPanics(t, func() { p.ReadScreen() })
+	}
+	assert.Equal(t, strings.Repeat(input[:len(input)/5], 10), output.String())
+	assert.Contains(t, p.ReadScreen(), "héllo wörld ✓")
+}
+
+func TestValidateEnv(t *testing.T) {
+	assert.NoError(t, ValidateEnv(nil))
+	assert.NoError(t, ValidateEnv(map[string]string{"ANTHROPIC_API_KEY": "sk-ant-1", "CLAUDE_MODEL": "opus"}))
+	for _, key := range []string{"PATH", "LD_PRELOAD", "LD_LIBRARY_PATH", "Path"} {
+		assert.ErrorContains(t, ValidateEnv(map[string]string{key: "/tmp"}), "can't be overridden", key)
+	}
+	for _, key := range []string{"", "A=B", "A\x00"} {
+		assert.ErrorContains(t, ValidateEnv(map[string]string{key: "x"}), "invalid environment variable name", key)
+	}
+}
+
+func TestProcessEnv(t *testing.T) {
+	t.Setenv("CLAUDER_TEST_KEEP", "kept")
+	t.Setenv("CLAUDER_TEST_OVERRIDE", "server")
+	env := processEnv(map[string]string{"CLAUDER_TEST_OVERRIDE": "session", "CLAUDER_TEST_NEW": "new", "TERM": "xterm"}, terminalEnv("", ""))
+	assert.Contains(t, env, "CLAUDER_TEST_KEEP=kept")
+	assert.Contains(t, env, "CLAUDER_TEST_OVERRIDE=session")
+	assert.NotContains(t, env, "CLAUDER_TEST_OVERRIDE=server")
+	assert.Contains(t, env, "CLAUDER_TEST_NEW=new")
+	assert.Equal(t, "TERM=vt100", env[len(env)-1], "the terminal type can't be overridden")
+}
+
+func TestStartProcessEnv(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	start := func(env map[string]string) (*Process, error) {
+		return StartProcess(ctx, StartProcessConfig{
+			Program:        "sh",
+			Args:           []string{"-c", `echo "key=$CLAUDER_TEST_KEY"; sleep 5`},
+			TerminalWidth:  80,
+			TerminalHeight: 24,
+			Env:            env,
+		})
+	}
+
+	// two agents started with different variables each see their own
+	first, err := start(map[string]string{"CLAUDER_TEST_KEY": "first"})
+	require.NoError(t, err)
+	defer first.Close(slog.New(slog.NewTextHandler(io.Discard, nil)), time.Second)
+	second, err := start(map[string]string{"CLAUDER_TEST_KEY": "second"})
+	require.NoError(t, err)
+	defer second.Close(slog.New(slog.NewTextHandler(io.Discard, nil)), time.Second)
+	require.Eventually(t, func() bool {
+		return strings.Contains(first.ReadScreen(), "key=first") && strings.Contains(second.ReadScreen(), "key=second")
+	}, 5*time.Second, 10*time.Millisecond)
+
+	_, err = start(map[string]string{"LD_PRELOAD": "/tmp/evil.so"})
+	assert.ErrorContains(t, err, "environment variable LD_PRELOAD can't be overridden")
+}
+
+func TestStartProcessDir(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+	p, err := StartProcess(ctx, StartProcessConfig{
+		Program:        "sh",
+		Args:           []string{"-c", `echo "dir=$(pwd -P)"; sleep 5`},
+		Dir:            dir,
+		TerminalWidth:  200,
+		TerminalHeight: 24,
+	})
+	require.NoError(t, err)
+	defer p.Close(slog.New(slog.NewTextHandler(io.Discard, nil)), time.Second)
+	require.Eventually(t, func() bool {
+		return strings.Contains(p.ReadScreen(), "dir="+dir)
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestStartProcessWarmupProbe(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	dir := t.TempDir()
+	config := StartProcessConfig{
+		Program:            "sh",
+		Args:               []string{"-c", "echo started; sleep 5"},
+		Dir:                dir,
+		Env:                map[string]string{"PROBE_FILE": "probe"},
+		TerminalWidth:      80,
+		TerminalHeight:     24,
+		WarmupProbeCommand: []string{"sh", "-c", `echo ready > "$PROBE_FILE"`},
+	}
+	p, err := StartProcess(ctx, config)
+	require.NoError(t, err)
+	defer p.Close(slog.New(slog.NewTextHandler(io.Discard, nil)), time.Second)
+	probed, err := os.ReadFile(filepath.Join(dir, "probe"))
+	require.NoError(t, err, "the probe runs in Dir with Env")
+	assert.Equal(t, "ready\n", string(probed))
+
+	config.WarmupProbeCommand = []string{"sh", "-c", "echo no API key; exit 1"}
+	_, err = StartProcess(ctx, config)
+	assert.ErrorContains(t, err, `warm-up probe "sh -c echo no API key; exit 1" failed: exit status 1: no API key`)
+}
+
+func TestProcessResize(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("stty isn't available on Windows")
+	}
+	if _, err := exec.LookPath("stty"); err != nil {
+		t.Skip("stty not found")
+	}
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	p, err := StartProcess(ctx, StartProcessConfig{
+		Program:        "sh",
+		Args:           []string{"-c", `echo "size=$(stty size)"; read line; echo "size=$(stty size)"; sleep 5`},
+		TerminalWidth:  80,
+		TerminalHeight: 24,
+	})
+	require.NoError(t, err)
+	defer p.Close(slog.New(slog.NewTextHandler(io.Discard, nil)), time.Second)
+	require.Eventually(t, func() bool {
+		return strings.Contains(p.ReadScreen(), "size=24 80")
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, p.Resize(100, 30))
+	_, err = p.Write([]byte("\n"))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return strings.Contains(p.ReadScreen(), "size=30 100")
+	}, 5*time.Second, 10*time.Millisecond, p.ReadScreen())
+	assert.Len(t, strings.Split(strings.Split(p.ReadScreen(), "\n")[0], ""), 100, "the emulated screen is resized too")
+
+	assert.ErrorContains(t, p.Resize(5, 30), "terminal size must be at least 10x10")
+}
+
+func TestStartProcessStdout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("separate stdout isn't supported on Windows")
+	}
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	stdout := &lockedBuffer{}
+	p, err := StartProcess(ctx, StartProcessConfig{
+		Program:        "sh",
+		Args:           []string{"-c", `echo '{"type":"result"}'; echo to-stderr >&2; [ -t 0 ] && echo stdin-is-tty >&2; sleep 5`},
+		TerminalWidth:  200,
+		TerminalHeight: 24,
+		Stdout:         stdout,
+	})
+	require.NoError(t, err)
+	defer p.Close(slog.New(slog.NewTextHandler(io.Discard, nil)), time.Second)
+	require.Eventually(t, func() bool {
+		return strings.Contains(p.ReadScreen(), "stdin-is-tty")
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Contains(t, p.ReadScreen(), "to-stderr")
+	assert.NotContains(t, p.ReadScreen(), "result")
+	require.Eventually(t, func() bool {
+		return stdout.String() == "{\"type\":\"result\"}\n"
+	}, 5*time.Second, 10*time.Millisecond, stdout.String())
+}
+
+// markerTimes records when each of its markers first appears in what's
+// written to it.
+type markerTimes struct {
+	mu      sync.Mutex
+	buf     strings.Builder
+	markers []string
+	seen    map[string]time.Time
+}
+
+func (m *markerTimes) Write(data []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.buf.Write(data)
+	for _, marker := range m.markers {
+		if _, ok := m.seen[marker]; !ok && strings.Contains(m.buf.String(), marker) {
+			m.seen[marker] = time.Now()
+		}
+	}
+	return len(data), nil
+}
+
+func (m *markerTimes) get(marker string) (time.Time, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	at, ok := m.seen[marker]
+	return at, ok
+}
+
+func TestStartProcessPreinject(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sh isn't available on Windows")
+	}
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	lines := []string{"yes", "my project", "3"}
+	delay := 200 * time.Millisecond
+	output := &markerTimes{seen: make(map[string]time.Time)}
+	for _, line := range lines {
+		output.markers = append(output.markers, "got:"+line+";")
+	}
+	start := time.Now()
+	p, err := StartProcess(ctx, StartProcessConfig{
+		Program:        "sh",
+		Args:           []string{"-c", `echo 'Accept the terms?'; while read -r line; do echo "got:$line;"; done`},
+		TerminalWidth:  80,
+		TerminalHeight: 24,
+		Output:         output,
+		PreinjectLines: lines,
+		PreinjectDelay: delay,
+	})
+	require.NoError(t, err)
+	defer p.Close(slog.New(slog.NewTextHandler(io.Discard, nil)), time.Second)
+	// every line was written before StartProcess returned
+	assert.GreaterOrEqual(t, time.Since(start), readySettleTime+2*delay)
+
+	var times []time.Time
+	for _, marker := range output.markers {
+		require.Eventually(t, func() bool {
+			_, ok := output.get(marker)
+			return ok
+		}, 5*time.Second, 10*time.Millisecond, marker)
+		at, _ := output.get(marker)
+		times = append(times, at)
+	}
+	for i := 1; i < len(times); i++ {
+		assert.True(t, times[i].After(times[i-1]), "line %d received before line %d", i+1, i)
+		// reading the output adds jitter on top of the delay
+		assert.Greater(t, times[i].Sub(times[i-1]), delay*3/4, "line %d", i+1)
+	}
+	screen := p.ReadScreen()
+	assert.Less(t, strings.Index(screen, "Accept the terms?"), strings.Index(screen, "got:yes;"))
+
+}
+
+func BenchmarkPTYRead(b *testing.B) {
+	data := []byte(strings.Repeat("Reading lib/termexec/termexec.go… ✓ done\r\n", 1024))
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	p := newTestProcess(b, nil)
+	reader := bytes.NewReader(data)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		reader.Reset(data)
+		p.term.out = bufio.NewReader(reader)
+		p.heartbeat = make(chan struct{}, 1)
+		p.readTerminal(logger, io.Discard)
+	}
+}
+
+func TestValidatePriority(t *testing.T) {
+	assert.NoError(t, validatePriority(StartProcessConfig{}))
+	assert.NoError(t, validatePriority(StartProcessConfig{NicePriority: 19, IOPriorityClass: IOPriorityBestEffort}))
+	assert.ErrorContains(t, validatePriority(StartProcessConfig{NicePriority: 20}), "not between -20 and 19")
+	assert.ErrorContains(t, validatePriority(StartProcessConfig{NicePriority: -21}), "not between -20 and 19")
+	assert.ErrorContains(t, validatePriority(StartProcessConfig{IOPriorityClass: "low"}), `invalid IO priority class "low"`)
+}
@@ -0,0 +1,153 @@
+//go:build windows
+
+package termexec
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/ActiveState/vt10x"
+	"github.com/UserExistsError/conpty"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+	"golang.org/x/sys/windows"
+	"golang.org/x/xerrors"
+)
+
+// stillActive is the exit code GetExitCodeProcess reports for a running process.
+const stillActive = 259
+
+// conPtyAvailable reports whether the ConPTY API is available. It was added
+// in Windows 10 version 1809 and works reliably since version 1903.
+var conPtyAvailable = conpty.IsConPtyAvailable
+
+// startInTerminal ignores sandbox, which is always nil since the sandbox
+// isn't supported on Windows.
+func startInTerminal(ctx context.Context, args StartProcessConfig, env []string, sandbox *sandboxConfig) (*terminal, *os.Process, error) {
+	if args.Stdout != nil {
+		return nil, nil, xerrors.Errorf("capturing the standard output separately isn't supported on Windows")
+	}
+	if !conPtyAvailable() {
+		logctx.From(ctx).Warn("ConPTY is not available, falling back to pipes. " +
+			"The agent won't detect a terminal, so its output may not render correctly. " +
+			"Windows 10 version 1903 or later is required for full support.")
+		return startWithPipes(args, env)
+	}
+
+	commandLine := windows.ComposeCommandLine(append([]string{args.Program}, args.Args...))
+	cpty, err := conpty.Start(commandLine,
+		conpty.ConPtyDimensions(int(args.TerminalWidth), int(args.TerminalHeight)),
+		conpty.ConPtyEnv(env),
+		conpty.ConPtyWorkDir(args.Dir),
+	)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("failed to start process in pseudo console: %w", err)
+	}
+	process, err := os.FindProcess(cpty.Pid())
+	if err != nil {
+		_ = cpty.Close()
+		return nil, nil, xerrors.Errorf("failed to find process: %w", err)
+	}
+	// The emulator answers device status queries by writing to the process's
+	// input. Agents may hang waiting for these answers otherwise.
+	term, err := newTerminal(cpty, cpty, args)
+	if err != nil {
+		_ = cpty.Close()
+		return nil, nil, err
+	}
+	term.resize = func(width, height uint16) error {
+		if err := cpty.Resize(int(width), int(height)); err != nil {
+			return err
+		}
+		term.vt.Resize(int(width), int(height))
+		return nil
+	}
+	// Closing the pseudo console also terminates the process.
+	term.close = cpty.Close
+	return term, process, nil
+}
+
+// startWithPipes starts the process with its standard streams connected to
+// pipes, for Windows versions without ConPTY.
+func startWithPipes(args StartProcessConfig, env []string) (*terminal, *os.Process, error) {
+	execCmd := exec.Command(args.Program, args.Args...)
+	execCmd.Env = env
+	execCmd.Dir = args.Dir
+	stdin, err := execCmd.StdinPipe()
+	if err != nil {
+		return nil, nil, xerrors.Errorf("failed to create stdin pipe: %w", err)
+	}
+	outReader, outWriter, err := os.Pipe()
+	if err != nil {
+		return nil, nil, xerrors.Errorf("failed to create output pipe: %w", err)
+	}
+	execCmd.Stdout = outWriter
+	execCmd.Stderr = outWriter
+	if err := execCmd.Start(); err != nil {
+		_ = outReader.Close()
+		_ = outWriter.Close()
+		return nil, nil, xerrors.Errorf("failed to start process: %w", err)
+	}
+	// the child has its own copy of the write end
+	_ = outWriter.Close()
+
+	term, err := newTerminal(stdin, outReader, args)
+	if err != nil {
+		_ = execCmd.Process.Kill()
+		return nil, nil, err
+	}
+	term.close = func() error {
+		stdinErr := stdin.Close()
+		if err := outReader.Close(); err != nil {
+			return err
+		}
+		return stdinErr
+	}
+	return term, execCmd.Process, nil
+}
+
+func newTerminal(in io.Writer, out io.Reader, args StartProcessConfig) (*terminal, error) {
+	state := &vt10x.State{}
+	// The screen is updated with WriteRune, so the emulator never reads.
+	vt, err := vt10x.New(state, nil, in)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to create terminal emulator: %w", err)
+	}
+	vt.Resize(int(args.TerminalWidth), int(args.TerminalHeight))
+	return &terminal{
+		in:    in,
+		out:   bufio.NewReader(out),
+		vt:    vt,
+		state: state,
+		// without a pseudo console, only the emulated screen has a size
+		resize: func(width, height uint16) error {
+			vt.Resize(int(width), int(height))
+			return nil
+		},
+	}, nil
+}
+
+func isAlive(process *os.Process) bool {
+	// os.Process.Signal only supports os.Kill on Windows, so the exit code
+	// is queried directly.
+	handle, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(process.Pid))
+	if err != nil {
+		return false
+	}
+	defer windows.CloseHandle(handle)
+	var exitCode uint32
+	if err := windows.GetExitCodeProcess(handle, &exitCode); err != nil {
+		return false
+	}
+	return exitCode == stillActive
+}
+
+// interrupt sends Ctrl+C to the process. ConPTY turns it into a
+// CTRL_C_EVENT; a process without a pseudo console will be killed once
+// Close times out.
+func (p *Process) interrupt() error {
+	_, err := p.term.in.Write([]byte{0x03})
+	return err
+}
@@ -0,0 +1,66 @@
+//go:build windows
+
+package termexec
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/UserExistsError/conpty"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+)
+
+func startCmd(t *testing.T) *Process {
+	t.Helper()
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(os.Stdout, nil)))
+	process, err := StartProcess(ctx, StartProcessConfig{
+		Program:        "cmd.exe",
+		Args:           []string{"/Q"},
+		TerminalWidth:  80,
+		TerminalHeight: 24,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = process.Close(slog.New(slog.NewTextHandler(os.Stdout, nil)), time.Second)
+	})
+	return process
+}
+
+func requireScreenContains(t *testing.T, process *Process, text string) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		return strings.Contains(process.ReadScreen(), text)
+	}, 10*time.Second, 50*time.Millisecond, "screen: %q", process.ReadScreen())
+}
+
+func TestStartProcess(t *testing.T) {
+	process := startCmd(t)
+	assert.True(t, process.IsAlive())
+
+	_, err := process.Write([]byte("echo hello from clauder\r\n"))
+	require.NoError(t, err)
+	requireScreenContains(t, process, "hello from clauder")
+}
+
+func TestStartProcessWithoutConPty(t *testing.T) {
+	conPtyAvailable = func() bool { return false }
+	t.Cleanup(func() { conPtyAvailable = conpty.IsConPtyAvailable })
+
+	process := startCmd(t)
+	assert.True(t, process.IsAlive())
+
+	_, err := process.Write([]byte("echo hello from clauder\r\n"))
+	require.NoError(t, err)
+	requireScreenContains(t, process, "hello from clauder")
+
+	_, err = process.Write([]byte("exit\r\n"))
+	require.NoError(t, err)
+	require.NoError(t, process.Wait())
+	assert.False(t, process.IsAlive())
+}
@@ -10,6 +10,7 @@ import (
 	"log/slog"
 	"net/http"
 	"net/url"
+	"os"
 	"os/exec"
 	"regexp"
 	"strings"
@@ -31,8 +32,67 @@ const (
 	ProviderNgrok TunnelProvider = "ngrok"
 	ProviderBore  TunnelProvider = "bore"
 	ProviderLocal TunnelProvider = "localhost.run"
+
+	// ProviderCodespaces uses the port forwarding of GitHub Codespaces,
+	// which serves every port at a public HTTPS URL.
+	ProviderCodespaces TunnelProvider = "codespaces"
+	// ProviderVSCode uses the port forwarding of a VS Code Remote session,
+	// which forwards the port to the same port on the local machine.
+	ProviderVSCode TunnelProvider = "vscode"
 )
 
+// Providers lists the tunnel providers in order of preference.
+var Providers = []TunnelProvider{ProviderNgrok, ProviderBore, ProviderLocal}
+
+// tunnelProviders is the order Connect tries the providers in, localhost.run
+// first since it needs no signup.
+var tunnelProviders = []TunnelProvider{ProviderLocal, ProviderBore, ProviderNgrok}
+
+// defaultCodespacesDomain is the domain of forwarded ports when
+// GITHUB_CODESPACES_PORT_FORWARDING_DOMAIN isn't set.
+const defaultCodespacesDomain = "preview.app.github.dev"
+
+// DetectPortForwarding returns the editor provider that forwards ports for
+// us, if clauder runs in GitHub Codespaces or a VS Code Remote session.
+func DetectPortForwarding() (TunnelProvider, bool) {
+	if os.Getenv("CODESPACES") == "true" && os.Getenv("CODESPACE_NAME") != "" {
+		return ProviderCodespaces, true
+	}
+	// VSCODE_INJECTION is set in every VS Code terminal, only forward ports
+	// when the terminal runs on a remote machine or in a container
+	if os.Getenv("VSCODE_INJECTION") == "1" && (os.Getenv("REMOTE_CONTAINERS") == "true" || os.Getenv("SSH_CONNECTION") != "") {
+		return ProviderVSCode, true
+	}
+	return "", false
+}
+
+// ForwardedURL returns the URL at which an editor provider detected by
+// DetectPortForwarding serves localPort.
+func ForwardedURL(provider TunnelProvider, localPort int) (string, error) {
+	switch provider {
+	case ProviderCodespaces:
+		domain := os.Getenv("GITHUB_CODESPACES_PORT_FORWARDING_DOMAIN")
+		if domain == "" {
+			domain = defaultCodespacesDomain
+		}
+		return fmt.Sprintf("https://%s-%d.%s", os.Getenv("CODESPACE_NAME"), localPort, domain), nil
+	case ProviderVSCode:
+		// VS Code forwards ports it sees in the terminal output to the
+		// same port on the local machine, when it's free
+		return fmt.Sprintf("http://localhost:%d", localPort), nil
+	default:
+		return "", fmt.Errorf("%s doesn't forward ports", provider)
+	}
+}
+
+// Binary returns the name of the command the provider runs.
+func (p TunnelProvider) Binary() string {
+	if p == ProviderLocal {
+		return "ssh"
+	}
+	return string(p)
+}
+
 // TunnelClient manages the tunnel connection
 type TunnelClient struct {
 	provider  TunnelProvider
@@ -51,14 +111,111 @@ type TunnelInfo struct {
 	LocalPort int    `json:"local_port"`
 }
 
-// Connect establishes a tunnel connection and returns the public URL
-func Connect(ctx context.Context, localPort int) (string, error) {
+// ConnectOption configures Connect
+type ConnectOption func(*connectOptions)
+
+type connectOptions struct {
+	skipReachabilityCheck bool
+	forceTunnel           bool
+	directURL             string
+	allowPlaintextDirect  bool
+	probeURL              string
+	client                *http.Client
+	onProvider            func(TunnelProvider)
+}
+
+// WithDirectURL makes Connect ask the probe service whether the server is
+// reachable from the internet at directURL, e.g. https://home.example.com:3284
+// when the router forwards the port to this machine, and return directURL
+// without starting a tunnel if it is. The probe service is only asked with
+// this option. directURL must be https unless WithPlaintextDirectURL is
+// passed too.
+func WithDirectURL(directURL string) ConnectOption {
+	return func(o *connectOptions) {
+		o.directURL = directURL
+	}
+}
+
+// WithPlaintextDirectURL allows an http URL in WithDirectURL, e.g. on a
+// trusted network.
+func WithPlaintextDirectURL() ConnectOption {
+	return func(o *connectOptions) {
+		o.allowPlaintextDirect = true
+	}
+}
+
+// WithSkipReachabilityCheck makes Connect start a tunnel without checking
+// whether the server is reachable at the WithDirectURL URL first.
+func WithSkipReachabilityCheck() ConnectOption {
+	return func(o *connectOptions) {
+		o.skipReachabilityCheck = true
+	}
+}
+
+// WithForceTunnel makes Connect start a tunnel even if the port is already
+// forwarded by an editor or reachable from the internet.
+func WithForceTunnel() ConnectOption {
+	return func(o *connectOptions) {
+		o.forceTunnel = true
+	}
+}
+
+// WithProbeURL makes Connect check whether the port is reachable with the
+// probe service at probeURL instead of ProbeURL().
+func WithProbeURL(probeURL string) ConnectOption {
+	return func(o *connectOptions) {
+		o.probeURL = probeURL
+	}
+}
+
+// WithProviderCallback makes Connect call fn with the provider that serves
+// the port, if the port isn't reachable without one.
+func WithProviderCallback(fn func(TunnelProvider)) ConnectOption {
+	return func(o *connectOptions) {
+		o.onProvider = fn
+	}
+}
+
+// Connect establishes a tunnel connection and returns the public URL. If
+// the server is reachable from the internet at the WithDirectURL URL, no
+// tunnel is started and that URL is returned instead.
+func Connect(ctx context.Context, localPort int, opts ...ConnectOption) (string, error) {
 	logger := logctx.From(ctx)
+	o := connectOptions{probeURL: ProbeURL(), client: http.DefaultClient}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if !o.forceTunnel {
+		if provider, ok := DetectPortForwarding(); ok {
+			logger.Info("Using Codespaces/VS Code port forwarding", "provider", provider)
+			if o.onProvider != nil {
+				o.onProvider(provider)
+			}
+			return ForwardedURL(provider, localPort)
+		}
+	}
 
-	// Try tunnel providers in order of preference (localhost.run first - no signup required)
-	providers := []TunnelProvider{ProviderLocal, ProviderBore, ProviderNgrok}
+	if o.directURL != "" && !o.forceTunnel && !o.skipReachabilityCheck {
+		direct, err := ValidateDirectURL(o.directURL, o.allowPlaintextDirect)
+		if err != nil {
+			return "", err
+		}
+		// the probe service only says whether the configured URL is
+		// reachable; the address it sees isn't trusted
+		result, err := probe(ctx, o.client, o.probeURL, direct.Hostname(), directURLPort(direct))
+		switch {
+		case err != nil:
+			logger.Warn("Failed to check whether the direct URL is reachable, starting a tunnel", "error", err)
+		case result.Reachable:
+			logger.Info("Direct URL is reachable from the internet, not starting a tunnel", "url", o.directURL)
+			return o.directURL, nil
+		default:
+			logger.Info("Direct URL isn't reachable from the internet, starting a tunnel", "url", o.directURL)
+		}
+	}
 
-	for _, provider := range providers {
+	for _, provider := range tunnelProviders {
 		logger.Info("Attempting tunnel connection", "provider", provider)
 
 		client, err := connectWithProvider(ctx, provider, localPort)
@@ -68,6 +225,9 @@ func Connect(ctx context.Context, localPort int) (string, error) {
 		}
 
 		logger.Info("Tunnel connected successfully", "provider", provider, "url", client.publicURL)
+		if o.onProvider != nil {
+			o.onProvider(provider)
+		}
 		return client.publicURL, nil
 	}
 
@@ -308,7 +468,7 @@ func (c *TunnelClient) parseLocalhostOutput(stdout io.Reader) (string, error) {
 func (c *TunnelClient) isConnected(publicURL string) bool {
 	// Check if the tunnel is working by making a health check request
 	// to our local server through the tunnel
-	healthURL, err := url.JoinPath(publicURL, "/health")
+	healthURL, err := url.JoinPath(publicURL, "/v1/health")
 	if err != nil {
 		return false
 	}
@@ -353,7 +513,7 @@ func (c *TunnelClient) GetTunnelInfo() TunnelInfo {
 
 // VerifyConnection tests the tunnel connection
 func VerifyConnection(publicURL string) error {
-	healthURL, err := url.JoinPath(publicURL, "/health")
+	healthURL, err := url.JoinPath(publicURL, "/v1/health")
 	if err != nil {
 		return fmt.Errorf("invalid public URL: %w", err)
 	}
@@ -388,16 +548,13 @@ func InstallInstructions() map[TunnelProvider]string {
 func CheckAvailableProviders() []TunnelProvider {
 	var available []TunnelProvider
 
-	if _, err := exec.LookPath("ngrok"); err == nil {
-		available = append(available, ProviderNgrok)
-	}
-
-	if _, err := exec.LookPath("bore"); err == nil {
-		available = append(available, ProviderBore)
+	if provider, ok := DetectPortForwarding(); ok {
+		available = append(available, provider)
 	}
-
-	if _, err := exec.LookPath("ssh"); err == nil {
-		available = append(available, ProviderLocal)
+	for _, provider := range Providers {
+		if _, err := exec.LookPath(provider.Binary()); err == nil {
+			available = append(available, provider)
+		}
 	}
 
 	return available
@@ -0,0 +1,214 @@
+package tunnel
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+)
+
+// clearForwardingEnv unsets the variables DetectPortForwarding looks at.
+func clearForwardingEnv(t *testing.T) {
+	for _, name := range []string{"CODESPACES", "CODESPACE_NAME", "GITHUB_CODESPACES_PORT_FORWARDING_DOMAIN", "VSCODE_INJECTION", "REMOTE_CONTAINERS", "SSH_CONNECTION"} {
+		t.Setenv(name, "")
+	}
+}
+
+func TestDetectPortForwarding(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		env      map[string]string
+		provider TunnelProvider
+		detected bool
+	}{
+		{"none", nil, "", false},
+		{"codespaces", map[string]string{"CODESPACES": "true", "CODESPACE_NAME": "fuzzy-space"}, ProviderCodespaces, true},
+		{"codespaces without a name", map[string]string{"CODESPACES": "true"}, "", false},
+		{"vscode over ssh", map[string]string{"VSCODE_INJECTION": "1", "SSH_CONNECTION": "10.0.0.1 50000 10.0.0.2 22"}, ProviderVSCode, true},
+		{"vscode in a container", map[string]string{"VSCODE_INJECTION": "1", "REMOTE_CONTAINERS": "true"}, ProviderVSCode, true},
+		{"local vscode", map[string]string{"VSCODE_INJECTION": "1"}, "", false},
+		{"codespaces in vscode", map[string]string{"CODESPACES": "true", "CODESPACE_NAME": "fuzzy-space", "VSCODE_INJECTION": "1", "SSH_CONNECTION": "x"}, ProviderCodespaces, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			clearForwardingEnv(t)
+			for name, value := range tc.env {
+				t.Setenv(name, value)
+			}
+			provider, ok := DetectPortForwarding()
+			assert.Equal(t, tc.detected, ok)
+			assert.Equal(t, tc.provider, provider)
+
+			available := CheckAvailableProviders()
+			if tc.detected {
+				require.NotEmpty(t, available)
+				assert.Equal(t, tc.provider, available[0], "port forwarding is preferred")
+			} else {
+				assert.NotContains(t, available, ProviderCodespaces)
+				assert.NotContains(t, available, ProviderVSCode)
+			}
+		})
+	}
+}
+
+func TestConnectPortForwarding(t *testing.T) {
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	// no provider would be found if Connect looked for tunnel binaries
+	t.Setenv("PATH", "")
+
+	t.Run("codespaces", func(t *testing.T) {
+		clearForwardingEnv(t)
+		t.Setenv("CODESPACES", "true")
+		t.Setenv("CODESPACE_NAME", "fuzzy-space")
+		url, err := Connect(ctx, 3284)
+		require.NoError(t, err)
+		assert.Equal(t, "https://fuzzy-space-3284.preview.app.github.dev", url)
+
+		t.Setenv("GITHUB_CODESPACES_PORT_FORWARDING_DOMAIN", "app.github.dev")
+		url, err = Connect(ctx, 3284)
+		require.NoError(t, err)
+		assert.Equal(t, "https://fuzzy-space-3284.app.github.dev", url)
+	})
+
+	t.Run("vscode", func(t *testing.T) {
+		clearForwardingEnv(t)
+		t.Setenv("VSCODE_INJECTION", "1")
+		t.Setenv("REMOTE_CONTAINERS", "true")
+		var provider TunnelProvider
+		url, err := Connect(ctx, 8080, WithProviderCallback(func(p TunnelProvider) { provider = p }))
+		require.NoError(t, err)
+		assert.Equal(t, "http://localhost:8080", url)
+		assert.Equal(t, ProviderVSCode, provider)
+	})
+
+	t.Run("none", func(t *testing.T) {
+		clearForwardingEnv(t)
+		_, err := Connect(ctx, 3284, WithSkipReachabilityCheck())
+		assert.ErrorContains(t, err, "all tunnel providers failed")
+	})
+
+	t.Run("forced tunnel", func(t *testing.T) {
+		clearForwardingEnv(t)
+		t.Setenv("CODESPACES", "true")
+		t.Setenv("CODESPACE_NAME", "fuzzy-space")
+		_, err := Connect(ctx, 3284, WithForceTunnel())
+		assert.ErrorContains(t, err, "all tunnel providers failed")
+	})
+}
+
+// newProbeServer returns a probe service that answers with response, and
+// records the host:port addresses it was asked about.
+func newProbeServer(t *testing.T, status int, response string) (*httptest.Server, *[]string) {
+	var addrs []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addrs = append(addrs, r.URL.Query().Get("host")+":"+r.URL.Query().Get("port"))
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(response))
+	}))
+	t.Cleanup(server.Close)
+	return server, &addrs
+}
+
+func TestIsExternallyReachable(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		status    int
+		response  string
+		reachable bool
+		err       string
+	}{
+		{"reachable", http.StatusOK, `{"reachable":true}`, true, ""},
+		{"blocked", http.StatusOK, `{"reachable":false}`, false, ""},
+		{"server error", http.StatusBadGateway, ``, false, "status 502"},
+		{"invalid json", http.StatusOK, `<html>`, false, "failed to decode"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server, addrs := newProbeServer(t, tc.status, tc.response)
+			t.Setenv("CLAUDER_PROBE_URL", server.URL+"/api/check")
+			reachable, err := IsExternallyReachable(3284)
+			if tc.err != "" {
+				assert.ErrorContains(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.reachable, reachable)
+			assert.Equal(t, []string{":3284"}, *addrs)
+		})
+	}
+}
+
+func TestConnectReachability(t *testing.T) {
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	// no provider would be found if Connect looked for tunnel binaries
+	t.Setenv("PATH", "")
+	clearForwardingEnv(t)
+
+	t.Run("reachable", func(t *testing.T) {
+		// the address the probe service reports isn't used
+		server, addrs := newProbeServer(t, http.StatusOK, `{"ip":"198.51.100.66","reachable":true}`)
+		url, err := Connect(ctx, 3284, WithProbeURL(server.URL), WithDirectURL("https://home.example.com:8443"))
+		require.NoError(t, err)
+		assert.Equal(t, "https://home.example.com:8443", url)
+		assert.Equal(t, []string{"home.example.com:8443"}, *addrs)
+
+		url, err = Connect(ctx, 3284, WithProbeURL(server.URL), WithDirectURL("https://[2001:db8::1]"))
+		require.NoError(t, err)
+		assert.Equal(t, "https://[2001:db8::1]", url)
+		assert.Equal(t, "2001:db8::1:443", (*addrs)[1])
+	})
+
+	t.Run("not configured", func(t *testing.T) {
+		server, addrs := newProbeServer(t, http.StatusOK, `{"reachable":true}`)
+		_, err := Connect(ctx, 3284, WithProbeURL(server.URL))
+		assert.ErrorContains(t, err, "all tunnel providers failed")
+		assert.Empty(t, *addrs)
+	})
+
+	t.Run("blocked", func(t *testing.T) {
+		server, addrs := newProbeServer(t, http.StatusOK, `{"reachable":false}`)
+		_, err := Connect(ctx, 3284, WithProbeURL(server.URL), WithDirectURL("https://203.0.113.7:3284"))
+		assert.ErrorContains(t, err, "all tunnel providers failed")
+		assert.Equal(t, []string{"203.0.113.7:3284"}, *addrs)
+	})
+
+	t.Run("probe failure", func(t *testing.T) {
+		server, _ := newProbeServer(t, http.StatusInternalServerError, ``)
+		_, err := Connect(ctx, 3284, WithProbeURL(server.URL), WithDirectURL("https://203.0.113.7:3284"))
+		assert.ErrorContains(t, err, "all tunnel providers failed")
+	})
+
+	t.Run("plaintext", func(t *testing.T) {
+		server, addrs := newProbeServer(t, http.StatusOK, `{"reachable":true}`)
+		_, err := Connect(ctx, 3284, WithProbeURL(server.URL), WithDirectURL("http://203.0.113.7:3284"))
+		assert.ErrorContains(t, err, "isn't https")
+		assert.Empty(t, *addrs)
+
+		url, err := Connect(ctx, 3284, WithProbeURL(server.URL), WithDirectURL("http://203.0.113.7"), WithPlaintextDirectURL())
+		require.NoError(t, err)
+		assert.Equal(t, "http://203.0.113.7", url)
+		assert.Equal(t, []string{"203.0.113.7:80"}, *addrs)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, directURL := range []string{"home.example.com:3284", "ftp://home.example.com", "https://"} {
+			_, err := Connect(ctx, 3284, WithDirectURL(directURL))
+			assert.ErrorContains(t, err, "invalid direct URL", directURL)
+		}
+	})
+
+	t.Run("skipped", func(t *testing.T) {
+		server, addrs := newProbeServer(t, http.StatusOK, `{"reachable":true}`)
+		_, err := Connect(ctx, 3284, WithProbeURL(server.URL), WithDirectURL("https://home.example.com"), WithSkipReachabilityCheck())
+		assert.ErrorContains(t, err, "all tunnel providers failed")
+		assert.Empty(t, *addrs)
+
+		_, err = Connect(ctx, 3284, WithProbeURL(server.URL), WithDirectURL("https://home.example.com"), WithForceTunnel())
+		assert.ErrorContains(t, err, "all tunnel providers failed")
+		assert.Empty(t, *addrs)
+	})
+}
@@ -0,0 +1,282 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/zohaibahmed/clauder/lib/logctx"
+)
+
+const (
+	// DefaultHealthCheckInterval is how often DualTunnel checks the
+	// primary tunnel by default.
+	DefaultHealthCheckInterval = 30 * time.Second
+	// failoverThreshold is the number of consecutive failed health checks
+	// after which DualTunnel promotes the standby tunnel.
+	failoverThreshold = 3
+)
+
+// DualTunnelConfig configures a DualTunnel.
+type DualTunnelConfig struct {
+	LocalPort int
+	// Providers are the tunnel providers to use, in order of preference.
+	// The standby uses another provider than the primary when it can, so
+	// that an outage of one provider doesn't take both down. Defaults to
+	// localhost.run, bore and ngrok.
+	Providers []TunnelProvider
+	// HealthCheckInterval is how often the primary tunnel is checked.
+	// Defaults to DefaultHealthCheckInterval.
+	HealthCheckInterval time.Duration
+	// OnURLChange is called with the URLs of the old and new primary
+	// tunnels after the standby was promoted, e.g. to register the new URL
+	// with the coordinator.
+	OnURLChange func(oldURL, newURL string)
+}
+
+// DualTunnel keeps a standby tunnel connected next to the primary one, so
+// that the server stays reachable while the primary is replaced. Only the
+// primary's URL is meant to be shared. The primary is checked with
+// VerifyConnection, and when the check fails three times in a row, the
+// standby is promoted if it passes the check, and a new standby is
+// connected. The tunnels
+// connected after Start must pass the check before they're used. Failed
+// reconnections are retried after ReconnectDelay.
+type DualTunnel struct {
+	config DualTunnelConfig
+	logger *slog.Logger
+	// connect and healthy are replaced in tests.
+	connect func(ctx context.Context, provider TunnelProvider, localPort int) (*TunnelClient, error)
+	healthy func(publicURL string) bool
+	backoff *reconnectBackoff
+	// failures is the number of failed health checks of the primary in a
+	// row. Only monitor uses it.
+	failures int
+
+	mu      sync.Mutex
+	primary *TunnelClient
+	standby *TunnelClient
+}
+
+// NewDualTunnel creates a DualTunnel. Start connects it.
+func NewDualTunnel(config DualTunnelConfig) *DualTunnel {
+	if len(config.Providers) == 0 {
+		config.Providers = tunnelProviders
+	}
+	if config.HealthCheckInterval <= 0 {
+		config.HealthCheckInterval = DefaultHealthCheckInterval
+	}
+	return &DualTunnel{
+		config:  config,
+		connect: connectWithProvider,
+		healthy: func(publicURL string) bool { return VerifyConnection(publicURL) == nil },
+		backoff: newReconnectBackoff(),
+	}
+}
+
+// Start connects the primary and standby tunnels and returns the primary's
+// URL. The primary is checked until ctx is done, when both tunnels are
+// closed. Start fails if the primary can't be connected; the server runs
+// without a standby if only the standby can't.
+func (d *DualTunnel) Start(ctx context.Context) (string, error) {
+	d.logger = logctx.From(ctx)
+	// like Connect, Start doesn't check the tunnels, so that the server
+	// starts even if the check can't pass yet; monitor checks the primary
+	primary, err := d.connectExcept(ctx, "", false)
+	if err != nil {
+		return "", err
+	}
+	standby, err := d.connectExcept(ctx, primary.provider, false)
+	if err != nil {
+		d.logger.Warn("Failed to connect the standby tunnel", "error", err)
+	}
+
+	d.mu.Lock()
+	d.primary, d.standby = primary, standby
+	d.mu.Unlock()
+	d.logger.Info("Dual tunnel connected", "primary", primary.publicURL, "standby", d.StandbyURL())
+
+	go d.monitor(ctx)
+	return primary.publicURL, nil
+}
+
+// PrimaryURL returns the URL of the primary tunnel.
+func (d *DualTunnel) PrimaryURL() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.primary == nil {
+		return ""
+	}
+	return d.primary.publicURL
+}
+
+// PrimaryProvider returns the provider of the primary tunnel.
+func (d *DualTunnel) PrimaryProvider() TunnelProvider {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.primary == nil {
+		return ""
+	}
+	return d.primary.provider
+}
+
+// StandbyURL returns the URL of the standby tunnel, or "" if there's none.
+func (d *DualTunnel) StandbyURL() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.standby == nil {
+		return ""
+	}
+	return d.standby.publicURL
+}
+
+// ReconnectStatus returns the state of the attempts to replace the primary
+// tunnel or connect the standby.
+func (d *DualTunnel) ReconnectStatus() ReconnectStatus {
+	return d.backoff.get()
+}
+
+// Close closes both tunnels.
+func (d *DualTunnel) Close() error {
+	d.mu.Lock()
+	primary, standby := d.primary, d.standby
+	d.primary, d.standby = nil, nil
+	d.mu.Unlock()
+	for _, client := range []*TunnelClient{primary, standby} {
+		if client != nil {
+			_ = client.Close()
+		}
+	}
+	return nil
+}
+
+// connectExcept connects a tunnel with the first provider that works,
+// trying the ones other than avoid first. If verify is set, tunnels that
+// fail the health check are closed and the next provider is tried.
+func (d *DualTunnel) connectExcept(ctx context.Context, avoid TunnelProvider, verify bool) (*TunnelClient, error) {
+	providers := make([]TunnelProvider, 0, len(d.config.Providers))
+	for _, provider := range d.config.Providers {
+		if provider != avoid {
+			providers = append(providers, provider)
+		}
+	}
+	if avoid != "" {
+		providers = append(providers, avoid)
+	}
+	for _, provider := range providers {
+		client, err := d.connect(ctx, provider, d.config.LocalPort)
+		if err != nil {
+			d.logger.Warn("Tunnel provider failed", "provider", provider, "error", err)
+			continue
+		}
+		if verify && !d.healthy(client.publicURL) {
+			d.logger.Warn("New tunnel failed its health check", "provider", provider, "url", client.publicURL)
+			_ = client.Close()
+			continue
+		}
+		return client, nil
+	}
+	return nil, fmt.Errorf("all tunnel providers failed")
+}
+
+// monitor checks the primary tunnel every HealthCheckInterval until ctx is
+// done, or sooner while reconnecting fails.
+func (d *DualTunnel) monitor(ctx context.Context) {
+	defer d.Close()
+	wait := d.config.HealthCheckInterval
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		wait = d.check(ctx)
+	}
+}
+
+// check checks the primary tunnel, fails over after failoverThreshold failed
+// checks in a row, and connects a standby if there's none. It returns how
+// long to wait before the next check.
+func (d *DualTunnel) check(ctx context.Context) time.Duration {
+	primaryURL := d.PrimaryURL()
+	if d.healthy(primaryURL) {
+		d.failures = 0
+	} else {
+		d.failures++
+		d.logger.Warn("Primary tunnel health check failed", "url", primaryURL, "failures", d.failures)
+	}
+	if d.failures >= failoverThreshold {
+		if err := d.failover(ctx); err != nil {
+			return d.retryLater("Failed to replace the primary tunnel", err)
+		}
+		d.failures = 0
+		d.backoff.reconnected()
+	}
+	if d.StandbyURL() == "" {
+		if err := d.connectStandby(ctx); err != nil {
+			return d.retryLater("Failed to connect a new standby tunnel", err)
+		}
+	}
+	d.backoff.reset()
+	return d.config.HealthCheckInterval
+}
+
+// retryLater logs a failed reconnection and returns how long to wait
+// before the next attempt.
+func (d *DualTunnel) retryLater(msg string, err error) time.Duration {
+	delay := d.backoff.failed()
+	d.logger.Error(msg, "error", err, "retryIn", delay)
+	return delay
+}
+
+// failover promotes the standby tunnel if it passes the health check, and
+// otherwise connects a new primary. The new standby is connected by check.
+func (d *DualTunnel) failover(ctx context.Context) error {
+	d.mu.Lock()
+	old, promoted := d.primary, d.standby
+	d.standby = nil
+	d.mu.Unlock()
+
+	// the standby may have gone down with the primary, e.g. if both lost
+	// the network
+	if promoted != nil && !d.healthy(promoted.publicURL) {
+		d.logger.Warn("Standby tunnel failed its health check, connecting a new primary", "url", promoted.publicURL)
+		_ = promoted.Close()
+		promoted = nil
+	}
+	if promoted == nil {
+		var err error
+		if promoted, err = d.connectExcept(ctx, old.provider, true); err != nil {
+			return err
+		}
+	}
+	d.mu.Lock()
+	d.primary = promoted
+	d.mu.Unlock()
+	_ = old.Close()
+	d.logger.Info("Promoted the standby tunnel", "oldURL", old.publicURL, "newURL", promoted.publicURL)
+	if d.config.OnURLChange != nil {
+		d.config.OnURLChange(old.publicURL, promoted.publicURL)
+	}
+	return nil
+}
+
+// connectStandby connects a standby tunnel, preferably with another provider
+// than the primary's.
+func (d *DualTunnel) connectStandby(ctx context.Context) error {
+	standby, err := d.connectExcept(ctx, d.PrimaryProvider(), true)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.primary == nil {
+		// closed in the meantime
+		_ = standby.Close()
+		return nil
+	}
+	d.standby = standby
+	return nil
+}
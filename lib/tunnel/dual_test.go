@@ -0,0 +1,270 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zohaibahmed/clauder/lib/logctx"
+)
+
+// fakeTunnels connects fake tunnels whose health checks fail once their URL
+// is marked as down.
+type fakeTunnels struct {
+	connected atomic.Int32
+
+	mu     sync.Mutex
+	down   map[string]bool
+	closed map[string]bool
+	// failing are the providers that fail to connect.
+	failing map[TunnelProvider]bool
+}
+
+func newFakeTunnels() *fakeTunnels {
+	return &fakeTunnels{down: map[string]bool{}, closed: map[string]bool{}, failing: map[TunnelProvider]bool{}}
+}
+
+func (f *fakeTunnels) connect(ctx context.Context, provider TunnelProvider, localPort int) (*TunnelClient, error) {
+	f.mu.Lock()
+	failing := f.failing[provider]
+	f.mu.Unlock()
+	if failing {
+		return nil, fmt.Errorf("%s not found in PATH", provider.Binary())
+	}
+	publicURL := fmt.Sprintf("https://%s-%d.example.com", provider.Binary(), f.connected.Add(1))
+	return &TunnelClient{provider: provider, localPort: localPort, publicURL: publicURL, cancel: func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.closed[publicURL] = true
+	}}, nil
+}
+
+func (f *fakeTunnels) verify(publicURL string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.down[publicURL] {
+		return errors.New("tunnel health check failed: status 502")
+	}
+	return nil
+}
+
+func (f *fakeTunnels) setDown(publicURL string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.down[publicURL] = true
+}
+
+func (f *fakeTunnels) isClosed(publicURL string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.closed[publicURL]
+}
+
+func TestDualTunnelFailover(t *testing.T) {
+	ctx, cancel := context.WithCancel(logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil))))
+	defer cancel()
+
+	var connected atomic.Int32
+	var mu sync.Mutex
+	down := map[string]bool{}
+	closed := map[string]bool{}
+	type change struct{ oldURL, newURL string }
+	changes := make(chan change, 10)
+
+	d := NewDualTunnel(DualTunnelConfig{
+		LocalPort:           3284,
+		Providers:           []TunnelProvider{ProviderLocal, ProviderBore},
+		HealthCheckInterval: 10 * time.Millisecond,
+		OnURLChange: func(oldURL, newURL string) {
+			changes <- change{oldURL, newURL}
+		},
+	})
+	d.connect = func(ctx context.Context, provider TunnelProvider, localPort int) (*TunnelClient, error) {
+		assert.Equal(t, 3284, localPort)
+		publicURL := fmt.Sprintf("https://%s-%d.example.com", provider.Binary(), connected.Add(1))
+		return &TunnelClient{provider: provider, localPort: localPort, publicURL: publicURL, cancel: func() {
+			mu.Lock()
+			defer mu.Unlock()
+			closed[publicURL] = true
+		}}, nil
+	}
+	d.healthy = func(publicURL string) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return !down[publicURL]
+	}
+
+	primaryURL, err := d.Start(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "https://ssh-1.example.com", primaryURL)
+	assert.Equal(t, "https://bore-2.example.com", d.StandbyURL(), "the standby uses another provider")
+	assert.Equal(t, ProviderLocal, d.PrimaryProvider())
+
+	// the primary stays while it's healthy
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, primaryURL, d.PrimaryURL())
+	assert.Empty(t, changes)
+
+	mu.Lock()
+	down[primaryURL] = true
+	mu.Unlock()
+	select {
+	case c := <-changes:
+		assert.Equal(t, change{"https://ssh-1.example.com", "https://bore-2.example.com"}, c)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the standby wasn't promoted")
+	}
+	assert.Equal(t, "https://bore-2.example.com", d.PrimaryURL())
+	assert.Equal(t, ProviderBore, d.PrimaryProvider())
+	require.Eventually(t, func() bool {
+		return d.StandbyURL() == "https://ssh-3.example.com"
+	}, 5*time.Second, 10*time.Millisecond, "a new standby is connected")
+	mu.Lock()
+	assert.True(t, closed["https://ssh-1.example.com"], "the failed primary is closed")
+	mu.Unlock()
+
+	// both tunnels are closed once the context is done
+	cancel()
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return closed["https://bore-2.example.com"] && closed["https://ssh-3.example.com"]
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Empty(t, changes)
+}
+
+func TestDualTunnelStartFails(t *testing.T) {
+	ctx := logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	d := NewDualTunnel(DualTunnelConfig{LocalPort: 3284})
+	d.connect = func(ctx context.Context, provider TunnelProvider, localPort int) (*TunnelClient, error) {
+		return nil, fmt.Errorf("%s isn't installed", provider)
+	}
+	_, err := d.Start(ctx)
+	assert.Error(t, err)
+}
+
+func TestDualTunnelReconnectBackoff(t *testing.T) {
+	ctx, cancel := context.WithCancel(logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil))))
+	defer cancel()
+	fake := newFakeTunnels()
+	d := NewDualTunnel(DualTunnelConfig{
+		LocalPort:           3284,
+		Providers:           []TunnelProvider{ProviderLocal, ProviderBore},
+		HealthCheckInterval: 10 * time.Millisecond,
+	})
+	d.connect = fake.connect
+	d.healthy = func(publicURL string) bool { return fake.verify(publicURL) == nil }
+	var mu sync.Mutex
+	var attempts []int
+	d.backoff.delay = func(attempt int) time.Duration {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts = append(attempts, attempt)
+		return 10 * time.Millisecond
+	}
+
+	primaryURL, err := d.Start(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, ReconnectStatus{}, d.ReconnectStatus())
+
+	// the standby is promoted, but no new standby can be connected
+	fake.mu.Lock()
+	fake.failing[ProviderLocal] = true
+	fake.failing[ProviderBore] = true
+	fake.mu.Unlock()
+	fake.setDown(primaryURL)
+	require.Eventually(t, func() bool {
+		return d.ReconnectStatus().Attempt >= 3
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "https://bore-2.example.com", d.PrimaryURL())
+	assert.Empty(t, d.StandbyURL())
+	mu.Lock()
+	assert.Equal(t, []int{0, 1, 2}, attempts[:3], "the delay grows with every failed attempt")
+	mu.Unlock()
+	status := d.ReconnectStatus()
+	assert.Equal(t, 1, status.Count)
+	assert.Equal(t, 10*time.Millisecond, status.Delay)
+	assert.False(t, status.NextRetryAt.IsZero())
+
+	fake.mu.Lock()
+	fake.failing[ProviderLocal] = false
+	fake.mu.Unlock()
+	require.Eventually(t, func() bool {
+		return d.StandbyURL() != ""
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		return d.ReconnectStatus() == ReconnectStatus{Count: 1}
+	}, 5*time.Second, 10*time.Millisecond, "the attempts are reset once the standby is connected")
+}
+
+func TestDualTunnelVerifiesNewTunnels(t *testing.T) {
+	ctx, cancel := context.WithCancel(logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil))))
+	defer cancel()
+	fake := newFakeTunnels()
+	d := NewDualTunnel(DualTunnelConfig{
+		LocalPort:           3284,
+		Providers:           []TunnelProvider{ProviderLocal, ProviderBore, ProviderNgrok},
+		HealthCheckInterval: 10 * time.Millisecond,
+	})
+	d.connect = fake.connect
+	d.healthy = func(publicURL string) bool { return fake.verify(publicURL) == nil }
+
+	primaryURL, err := d.Start(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "https://bore-2.example.com", d.StandbyURL())
+
+	// the first tunnel connected after the failover fails its health
+	// check, so the next provider is used for the new standby
+	fake.setDown("https://ssh-3.example.com")
+	fake.setDown(primaryURL)
+	require.Eventually(t, func() bool {
+		return d.StandbyURL() == "https://ngrok-4.example.com"
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "https://bore-2.example.com", d.PrimaryURL())
+	assert.True(t, fake.isClosed("https://ssh-3.example.com"), "the unhealthy new tunnel is closed")
+	assert.False(t, fake.isClosed("https://ngrok-4.example.com"))
+}
+
+func TestDualTunnelUnhealthyStandby(t *testing.T) {
+	ctx, cancel := context.WithCancel(logctx.WithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil))))
+	defer cancel()
+	fake := newFakeTunnels()
+	urls := make(chan string, 10)
+	d := NewDualTunnel(DualTunnelConfig{
+		LocalPort:           3284,
+		Providers:           []TunnelProvider{ProviderLocal, ProviderBore, ProviderNgrok},
+		HealthCheckInterval: 10 * time.Millisecond,
+		OnURLChange:         func(oldURL, newURL string) { urls <- newURL },
+	})
+	d.connect = fake.connect
+	d.healthy = func(publicURL string) bool { return fake.verify(publicURL) == nil }
+
+	primaryURL, err := d.Start(ctx)
+	require.NoError(t, err)
+	standbyURL := d.StandbyURL()
+	assert.Equal(t, "https://bore-2.example.com", standbyURL)
+
+	// both tunnels go down, so a new primary is connected instead of
+	// promoting the standby
+	fake.setDown(standbyURL)
+	fake.setDown(primaryURL)
+	select {
+	case newURL := <-urls:
+		assert.Equal(t, "https://bore-3.example.com", newURL, "a new tunnel of another provider than the failed primary's")
+	case <-time.After(5 * time.Second):
+		t.Fatal("the primary wasn't replaced")
+	}
+	assert.True(t, fake.isClosed(standbyURL), "the unhealthy standby is closed")
+	assert.True(t, fake.isClosed(primaryURL))
+	require.Eventually(t, func() bool {
+		return d.StandbyURL() == "https://ssh-4.example.com"
+	}, 5*time.Second, 10*time.Millisecond, "a new standby is connected")
+}
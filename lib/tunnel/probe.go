@@ -0,0 +1,110 @@
+package tunnel
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	// DefaultProbeURL is the service that checks whether a port of this
+	// machine is reachable from the internet (can be overridden with the
+	// CLAUDER_PROBE_URL env var).
+	DefaultProbeURL = "https://portcheck.io/api/check"
+	ProbeTimeout    = 10 * time.Second
+)
+
+// ProbeURL returns the probe service URL from environment or default
+func ProbeURL() string {
+	if url := os.Getenv("CLAUDER_PROBE_URL"); url != "" {
+		return url
+	}
+	return DefaultProbeURL
+}
+
+// ProbeResponse is the response of the probe service to
+// GET <probe URL>?host=<host>&port=<port>. The service connects to the port
+// on host, or on the address the request came from if host is missing.
+type ProbeResponse struct {
+	// Reachable is whether the service could connect to the port.
+	Reachable bool `json:"reachable"`
+}
+
+// probe asks the probe service at probeURL whether port is reachable on
+// host from the internet. An empty host is the address of this machine as
+// the service sees it.
+func probe(ctx context.Context, client *http.Client, probeURL string, host string, port int) (ProbeResponse, error) {
+	u, err := url.Parse(probeURL)
+	if err != nil {
+		return ProbeResponse{}, fmt.Errorf("invalid probe URL: %w", err)
+	}
+	query := u.Query()
+	if host != "" {
+		query.Set("host", host)
+	}
+	query.Set("port", strconv.Itoa(port))
+	u.RawQuery = query.Encode()
+
+	ctx, cancel := context.WithTimeout(ctx, ProbeTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return ProbeResponse{}, fmt.Errorf("failed to create probe request: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return ProbeResponse{}, fmt.Errorf("failed to reach the probe service: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ProbeResponse{}, fmt.Errorf("probe service returned status %d", resp.StatusCode)
+	}
+
+	var result ProbeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return ProbeResponse{}, fmt.Errorf("failed to decode probe response: %w", err)
+	}
+	return result, nil
+}
+
+// IsExternallyReachable reports whether localPort can be connected to from
+// the internet, e.g. because the machine has a public IP or the router
+// forwards the port to it. No tunnel is needed then.
+func IsExternallyReachable(localPort int) (bool, error) {
+	result, err := probe(context.Background(), http.DefaultClient, ProbeURL(), "", localPort)
+	if err != nil {
+		return false, err
+	}
+	return result.Reachable, nil
+}
+
+// ValidateDirectURL checks that directURL, the URL at which the server is
+// reachable without a tunnel, is an https URL with a host. Clients send the
+// session's token to it, so plain http is only accepted with
+// allowPlaintext.
+func ValidateDirectURL(directURL string, allowPlaintext bool) (*url.URL, error) {
+	u, err := url.Parse(directURL)
+	if err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+		return nil, fmt.Errorf("invalid direct URL %q, expected an https URL like https://home.example.com:3284", directURL)
+	}
+	if u.Scheme == "http" && !allowPlaintext {
+		return nil, fmt.Errorf("the direct URL %q isn't https, so clients would send the session's token in cleartext", directURL)
+	}
+	return u, nil
+}
+
+// directURLPort returns the port of u, or the default port of its scheme.
+func directURLPort(u *url.URL) int {
+	if port, err := strconv.Atoi(u.Port()); err == nil {
+		return port
+	}
+	if u.Scheme == "http" {
+		return 80
+	}
+	return 443
+}
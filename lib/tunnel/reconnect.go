@@ -0,0 +1,94 @@
+package tunnel
+
+import (
+	"crypto/rand"
+	"io"
+	"math/big"
+	"sync"
+	"time"
+)
+
+// MaxReconnectDelay caps the delay ReconnectDelay returns.
+const MaxReconnectDelay = 5 * time.Minute
+
+// ReconnectDelay returns how long to wait before the reconnection attempt
+// with the given number, starting at 0: 2^attempt * RetryDelay, plus up to
+// RetryDelay of random jitter so that servers restarted together don't
+// reconnect to the tunnel providers at the same time. It's at most
+// MaxReconnectDelay.
+func ReconnectDelay(attempt int) time.Duration {
+	return reconnectDelay(attempt, rand.Reader)
+}
+
+// reconnectDelay is ReconnectDelay with the jitter read from random.
+func reconnectDelay(attempt int, random io.Reader) time.Duration {
+	delay := MaxReconnectDelay
+	// the shift would overflow long before the cap matters
+	if attempt < 20 {
+		delay = min(RetryDelay<<max(attempt, 0), MaxReconnectDelay)
+	}
+	if jitter, err := rand.Int(random, big.NewInt(int64(RetryDelay))); err == nil {
+		delay += time.Duration(jitter.Int64())
+	}
+	return min(delay, MaxReconnectDelay)
+}
+
+// ReconnectStatus is the state of the reconnection attempts of a tunnel.
+type ReconnectStatus struct {
+	// Attempt is the number of reconnection attempts that failed in a
+	// row, or 0 if none failed since the last one that succeeded.
+	Attempt int
+	// Delay is how long is waited before the next attempt after Attempt
+	// failed, and NextRetryAt when it's made. They're zero if no attempt
+	// is pending.
+	Delay       time.Duration
+	NextRetryAt time.Time
+	// Count is the number of times the tunnel was reconnected.
+	Count int
+}
+
+// reconnectBackoff tracks the reconnection attempts of a tunnel, and
+// returns the ReconnectDelay to wait after the ones that fail.
+type reconnectBackoff struct {
+	// delay is ReconnectDelay, and is replaced in tests.
+	delay func(attempt int) time.Duration
+
+	mu     sync.Mutex
+	status ReconnectStatus
+}
+
+func newReconnectBackoff() *reconnectBackoff {
+	return &reconnectBackoff{delay: ReconnectDelay}
+}
+
+// failed records a failed attempt and returns how long to wait before the
+// next one.
+func (b *reconnectBackoff) failed() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.status.Delay = b.delay(b.status.Attempt)
+	b.status.Attempt++
+	b.status.NextRetryAt = time.Now().Add(b.status.Delay)
+	return b.status.Delay
+}
+
+// reconnected records that the tunnel was reconnected.
+func (b *reconnectBackoff) reconnected() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.status = ReconnectStatus{Count: b.status.Count + 1}
+}
+
+// reset records that no attempt is pending anymore, e.g. because the tunnel
+// recovered by itself.
+func (b *reconnectBackoff) reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.status = ReconnectStatus{Count: b.status.Count}
+}
+
+func (b *reconnectBackoff) get() ReconnectStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.status
+}
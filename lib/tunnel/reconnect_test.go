@@ -0,0 +1,34 @@
+package tunnel
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReconnectDelay(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	jittered := false
+	for attempt := 0; attempt < 40; attempt++ {
+		for range 50 {
+			delay := reconnectDelay(attempt, random)
+			base := min(RetryDelay<<min(attempt, 20), MaxReconnectDelay)
+			assert.GreaterOrEqual(t, delay, base, "attempt %d", attempt)
+			assert.Less(t, delay, base+RetryDelay, "attempt %d", attempt)
+			assert.LessOrEqual(t, delay, MaxReconnectDelay, "attempt %d", attempt)
+			if delay != base {
+				jittered = true
+			}
+		}
+	}
+	assert.True(t, jittered)
+
+	assert.Equal(t, MaxReconnectDelay, reconnectDelay(1000, random))
+	for range 50 {
+		delay := ReconnectDelay(3)
+		assert.GreaterOrEqual(t, delay, 16*time.Second)
+		assert.Less(t, delay, 18*time.Second)
+	}
+}
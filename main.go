@@ -1,13 +1,20 @@
 package main
 
 import (
+	"errors"
 	"log"
+	"os"
 
 	"github.com/joho/godotenv"
 	"github.com/zohaibahmed/clauder/cmd"
+	"github.com/zohaibahmed/clauder/lib/termexec"
 )
 
 func main() {
+	// Set up the sandbox if clauder was started as the sandbox init of an
+	// agent process; it doesn't return then
+	termexec.SandboxInit()
+
 	// Load .env file if it exists (fail silently if it doesn't)
 	if err := godotenv.Load(); err != nil {
 		// Only log if it's not a "file not found" error
@@ -21,6 +28,5 @@ func main() {
 
 // isFileNotFoundError checks if the error is due to .env file not existing
 func isFileNotFoundError(err error) bool {
-	return err != nil && (err.Error() == "open .env: no such file or directory" || 
-		err.Error() == "open .env: The system cannot find the file specified.")
+	return errors.Is(err, os.ErrNotExist)
 }
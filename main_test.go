@@ -0,0 +1,28 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/joho/godotenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsFileNotFoundError(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := os.Open(filepath.Join(dir, ".env"))
+	var pathErr *os.PathError
+	require.ErrorAs(t, err, &pathErr)
+	assert.True(t, isFileNotFoundError(err))
+	assert.True(t, isFileNotFoundError(godotenv.Load(filepath.Join(dir, ".env"))))
+
+	// reading a directory fails with another error
+	_, err = os.ReadFile(dir)
+	require.Error(t, err)
+	assert.False(t, isFileNotFoundError(err))
+	assert.False(t, isFileNotFoundError(godotenv.Load(dir)))
+	assert.False(t, isFileNotFoundError(nil))
+}